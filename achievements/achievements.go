@@ -0,0 +1,108 @@
+// Package achievements implements the RetroAchievements client: the web API
+// used to log in, identify the game and award the achievements, and the runtime
+// evaluating the achievement logic against the console memory every frame. The
+// logic follows the condition syntax of rcheevos, the reference implementation.
+package achievements
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// HashNES returns the hash RetroAchievements identifies the NES games by: the
+// MD5 of the ROM file without the iNES header.
+func HashNES(data []byte) string {
+	if len(data) >= 16 && string(data[:4]) == "NES\x1a" {
+		data = data[16:]
+	}
+
+	sum := md5.Sum(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Achievement is a single achievement of the game.
+type Achievement struct {
+	ID          int
+	Title       string
+	Description string
+	Points      int
+	Logic       string // trigger in the rcheevos condition syntax
+	Earned      bool   // earned before, in the current mode
+}
+
+type entry struct {
+	*Achievement
+	trigger *trigger
+	active  bool // the trigger has been false at least once since the reset
+}
+
+// Runtime evaluates the achievements of the game every frame.
+type Runtime struct {
+	mem     Memory
+	entries []*entry
+}
+
+// NewRuntime creates the runtime for the achievements not yet earned, reading
+// the memory with the function, which must not have side effects. The ones with
+// the logic that cannot be parsed are left out and reported in the error, which
+// does not prevent the rest from working.
+func NewRuntime(mem Memory, list []*Achievement) (*Runtime, error) {
+	var (
+		r    = &Runtime{mem: mem}
+		errs []error
+	)
+
+	for _, a := range list {
+		if a.Earned {
+			continue
+		}
+
+		t, err := parseTrigger(a.Logic)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("achievement %d: %w", a.ID, err))
+			continue
+		}
+
+		r.entries = append(r.entries, &entry{Achievement: a, trigger: t})
+	}
+
+	return r, errors.Join(errs...)
+}
+
+// Reset forgets the progress of the achievements not yet earned, which must be
+// done when the console is reset or a state is loaded, so that the achievements
+// do not trigger on the sudden change of the memory.
+func (r *Runtime) Reset() {
+	for _, e := range r.entries {
+		e.active = false
+		e.trigger.resetHits()
+	}
+}
+
+// Frame evaluates the achievements at the end of the frame and returns the
+// ones that have just been earned. An achievement can only trigger after its
+// logic has been false, so that it is not earned as soon as the game loads.
+func (r *Runtime) Frame() []*Achievement {
+	var earned []*Achievement
+
+	for _, e := range r.entries {
+		if e.Earned {
+			continue
+		}
+
+		ok := e.trigger.test(r.mem)
+
+		switch {
+		case !e.active:
+			e.active = !ok
+		case ok:
+			e.Earned = true
+			earned = append(earned, e.Achievement)
+		}
+	}
+
+	return earned
+}
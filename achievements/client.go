@@ -0,0 +1,269 @@
+package achievements
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiURL         = "https://retroachievements.org/dorequest.php"
+	userAgent      = "Dendy/1.0"
+	requestTimeout = 30 * time.Second
+
+	// Only the core achievements are awarded, as opposed to the unofficial
+	// ones still being worked on.
+	flagCore = 3
+)
+
+// ErrUnknownGame is returned when the ROM hash is not linked to any game.
+var ErrUnknownGame = errors.New("game not found")
+
+// Client talks to the RetroAchievements web API on behalf of the user.
+type Client struct {
+	http     *http.Client
+	baseURL  string
+	username string
+	token    string
+	hardcore bool
+}
+
+// Game is the game identified by the ROM hash, with its achievements.
+type Game struct {
+	ID           int
+	Title        string
+	Hash         string
+	Achievements []*Achievement
+}
+
+// response is the part of the API response shared by all requests.
+type response struct {
+	Success bool   `json:"Success"`
+	Error   string `json:"Error"`
+}
+
+func (c *Client) request(ctx context.Context, params url.Values, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var (
+		raw  json.RawMessage
+		body response
+	)
+
+	// The errors are reported in the body, sometimes with the error status.
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("%s: %s", params.Get("r"), resp.Status)
+	}
+
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return err
+	}
+
+	if !body.Success {
+		if body.Error == "" {
+			body.Error = resp.Status
+		}
+
+		return fmt.Errorf("%s: %s", params.Get("r"), body.Error)
+	}
+
+	return json.Unmarshal(raw, result)
+}
+
+// Login logs the user in with either the password or the token returned by
+// the previous login, which is returned again to be stored instead of the
+// password. In hardcore mode, the achievements are awarded as hardcore ones.
+func Login(ctx context.Context, username, password, token string, hardcore bool) (*Client, error) {
+	c := &Client{
+		http:     &http.Client{Timeout: requestTimeout},
+		baseURL:  apiURL,
+		username: username,
+		hardcore: hardcore,
+	}
+
+	params := url.Values{"r": {"login2"}, "u": {username}}
+	if token != "" {
+		params.Set("t", token)
+	} else {
+		params.Set("p", password)
+	}
+
+	var result struct {
+		Token string `json:"Token"`
+	}
+
+	if err := c.request(ctx, params, &result); err != nil {
+		return nil, err
+	}
+
+	c.token = result.Token
+
+	return c, nil
+}
+
+// Token returns the token to log in without the password.
+func (c *Client) Token() string {
+	return c.token
+}
+
+func (c *Client) hardcoreParam() string {
+	if c.hardcore {
+		return "1"
+	}
+
+	return "0"
+}
+
+// LoadGame identifies the game by the ROM hash, fetches its achievements and
+// starts the session, which marks the ones the user has already earned.
+func (c *Client) LoadGame(ctx context.Context, hash string) (*Game, error) {
+	var id struct {
+		GameID int `json:"GameID"`
+	}
+
+	if err := c.request(ctx, url.Values{"r": {"gameid"}, "m": {hash}}, &id); err != nil {
+		return nil, err
+	}
+
+	if id.GameID == 0 {
+		return nil, ErrUnknownGame
+	}
+
+	var patch struct {
+		PatchData struct {
+			ID           int    `json:"ID"`
+			Title        string `json:"Title"`
+			Achievements []struct {
+				ID          int    `json:"ID"`
+				Title       string `json:"Title"`
+				Description string `json:"Description"`
+				Points      int    `json:"Points"`
+				MemAddr     string `json:"MemAddr"`
+				Flags       int    `json:"Flags"`
+			} `json:"Achievements"`
+		} `json:"PatchData"`
+	}
+
+	params := url.Values{
+		"r": {"patch"},
+		"u": {c.username},
+		"t": {c.token},
+		"g": {strconv.Itoa(id.GameID)},
+	}
+
+	if err := c.request(ctx, params, &patch); err != nil {
+		return nil, err
+	}
+
+	game := &Game{ID: patch.PatchData.ID, Title: patch.PatchData.Title, Hash: hash}
+
+	for _, a := range patch.PatchData.Achievements {
+		if a.Flags != flagCore {
+			continue
+		}
+
+		game.Achievements = append(game.Achievements, &Achievement{
+			ID:          a.ID,
+			Title:       a.Title,
+			Description: a.Description,
+			Points:      a.Points,
+			Logic:       a.MemAddr,
+		})
+	}
+
+	type unlock struct {
+		ID int `json:"ID"`
+	}
+
+	var session struct {
+		Unlocks         []unlock `json:"Unlocks"`
+		HardcoreUnlocks []unlock `json:"HardcoreUnlocks"`
+	}
+
+	params = url.Values{
+		"r": {"startsession"},
+		"u": {c.username},
+		"t": {c.token},
+		"g": {strconv.Itoa(game.ID)},
+		"h": {c.hardcoreParam()},
+		"m": {hash},
+	}
+
+	if err := c.request(ctx, params, &session); err != nil {
+		return nil, err
+	}
+
+	// The hardcore unlocks also count in softcore, but not the other way round.
+	unlocked := make(map[int]bool)
+	for _, u := range session.HardcoreUnlocks {
+		unlocked[u.ID] = true
+	}
+
+	if !c.hardcore {
+		for _, u := range session.Unlocks {
+			unlocked[u.ID] = true
+		}
+	}
+
+	for _, a := range game.Achievements {
+		a.Earned = unlocked[a.ID]
+	}
+
+	return game, nil
+}
+
+// Award reports the achievement earned in the game. Awarding the achievement
+// the user already has is not an error.
+func (c *Client) Award(ctx context.Context, game *Game, a *Achievement) error {
+	id := strconv.Itoa(a.ID)
+	hardcore := c.hardcoreParam()
+
+	// The validation hash proves the request comes from the client that knows
+	// the achievement, rather than from a script calling the API.
+	sum := md5.Sum([]byte(id + c.username + hardcore))
+
+	params := url.Values{
+		"r": {"awardachievement"},
+		"u": {c.username},
+		"t": {c.token},
+		"a": {id},
+		"h": {hardcore},
+		"m": {game.Hash},
+		"v": {hex.EncodeToString(sum[:])},
+	}
+
+	var result response
+
+	err := c.request(ctx, params, &result)
+	if err != nil && strings.Contains(err.Error(), "already has") {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,667 @@
+package achievements
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Memory reads the byte from the console address space without side effects.
+type Memory func(addr uint16) uint8
+
+type operandKind uint8
+
+const (
+	operandValue   operandKind = iota // constant
+	operandAddress                    // current value in memory
+	operandDelta                      // value in memory as of the previous frame
+	operandPrior                      // last value in memory different from the current one
+	operandBCD                        // current value decoded from BCD
+	operandInvert                     // current value with the bits inverted
+)
+
+// memSize is the part of the memory an operand reads, named after the letter
+// following "0x" in the condition syntax.
+type memSize uint8
+
+const (
+	size8 memSize = iota
+	size16
+	size24
+	size32
+	size16BE
+	size24BE
+	size32BE
+	sizeBit0 // bit0 to bit7 follow in order
+	sizeBit1
+	sizeBit2
+	sizeBit3
+	sizeBit4
+	sizeBit5
+	sizeBit6
+	sizeBit7
+	sizeLowNibble
+	sizeHighNibble
+	sizeBitCount
+)
+
+var sizeLetters = map[byte]memSize{
+	'H': size8, 'W': size24, 'X': size32,
+	'I': size16BE, 'J': size24BE, 'G': size32BE,
+	'M': sizeBit0, 'N': sizeBit1, 'O': sizeBit2, 'P': sizeBit3,
+	'Q': sizeBit4, 'R': sizeBit5, 'S': sizeBit6, 'T': sizeBit7,
+	'L': sizeLowNibble, 'U': sizeHighNibble, 'K': sizeBitCount,
+}
+
+type operand struct {
+	kind  operandKind
+	size  memSize
+	addr  uint32
+	value uint32
+
+	// Values read in the previous frames, for the delta and prior operands.
+	last  uint32
+	prior uint32
+
+	offset uint32 // added by AddAddress the last time it was read
+	read   bool   // during the current frame
+}
+
+func (s memSize) mask() uint32 {
+	switch s {
+	case size8:
+		return 0xFF
+	case size16, size16BE:
+		return 0xFFFF
+	case size24, size24BE:
+		return 0xFFFFFF
+	case size32, size32BE:
+		return 0xFFFFFFFF
+	case sizeLowNibble, sizeHighNibble:
+		return 0x0F
+	case sizeBitCount:
+		return 0x0F
+	default:
+		return 0x01
+	}
+}
+
+func (s memSize) read(mem Memory, addr uint32) uint32 {
+	at := func(i uint32) uint32 {
+		return uint32(mem(uint16(addr + i)))
+	}
+
+	switch s {
+	case size8:
+		return at(0)
+	case size16:
+		return at(0) | at(1)<<8
+	case size24:
+		return at(0) | at(1)<<8 | at(2)<<16
+	case size32:
+		return at(0) | at(1)<<8 | at(2)<<16 | at(3)<<24
+	case size16BE:
+		return at(0)<<8 | at(1)
+	case size24BE:
+		return at(0)<<16 | at(1)<<8 | at(2)
+	case size32BE:
+		return at(0)<<24 | at(1)<<16 | at(2)<<8 | at(3)
+	case sizeLowNibble:
+		return at(0) & 0x0F
+	case sizeHighNibble:
+		return at(0) >> 4
+	case sizeBitCount:
+		count := uint32(0)
+		for v := at(0); v != 0; v >>= 1 {
+			count += v & 1
+		}
+		return count
+	default:
+		return at(0) >> (s - sizeBit0) & 1
+	}
+}
+
+func fromBCD(v uint32) uint32 {
+	result, scale := uint32(0), uint32(1)
+
+	for ; v != 0; v >>= 4 {
+		result += (v & 0x0F) * scale
+		scale *= 10
+	}
+
+	return result
+}
+
+// get returns the value of the operand, where offset is the address added by
+// the preceding AddAddress condition. Reading the memory operands also updates
+// their history, so each of them must be read once per frame, which endFrame
+// makes sure of.
+func (o *operand) get(mem Memory, offset uint32) uint32 {
+	if o.kind == operandValue {
+		return o.value
+	}
+
+	current := o.size.read(mem, o.addr+offset)
+	last := o.last
+
+	if current != o.last {
+		o.prior = o.last
+		o.last = current
+	}
+
+	o.offset, o.read = offset, true
+
+	switch o.kind {
+	case operandDelta:
+		return last
+	case operandPrior:
+		return o.prior
+	case operandBCD:
+		return fromBCD(current)
+	case operandInvert:
+		return ^current & o.size.mask()
+	default:
+		return current
+	}
+}
+
+// endFrame reads the operand, if it has not been read during the frame, e.g.
+// because its condition was paused, so that the delta and the prior values are
+// still of the previous frame when it is read again.
+func (o *operand) endFrame(mem Memory) {
+	if o.kind != operandValue && !o.read {
+		o.get(mem, o.offset)
+	}
+
+	o.read = false
+}
+
+// parseOperand parses the operand at the start of s and returns the rest.
+func parseOperand(s string) (operand, string, error) {
+	var op operand
+
+	switch {
+	case s == "":
+		return op, s, fmt.Errorf("missing operand")
+
+	case s[0] == 'h' || s[0] == 'H':
+		n, rest := takeWhile(s[1:], isHexDigit)
+
+		v, err := strconv.ParseUint(n, 16, 32)
+		if err != nil {
+			return op, s, fmt.Errorf("invalid hex value: %q", s)
+		}
+
+		op.value = uint32(v)
+
+		return op, rest, nil
+
+	case s[0] == 'v' || s[0] == '-' || isDigit(s[0]) && !strings.HasPrefix(s, "0x"):
+		text := strings.TrimPrefix(s, "v")
+
+		sign := ""
+		if strings.HasPrefix(text, "-") {
+			sign, text = "-", text[1:]
+		}
+
+		n, rest := takeWhile(text, isDigit)
+
+		v, err := strconv.ParseInt(sign+n, 10, 64)
+		if err != nil {
+			return op, s, fmt.Errorf("invalid value: %q", s)
+		}
+
+		op.value = uint32(v)
+
+		return op, rest, nil
+	}
+
+	op.kind = operandAddress
+
+	switch s[0] {
+	case 'd', 'D':
+		op.kind, s = operandDelta, s[1:]
+	case 'p', 'P':
+		op.kind, s = operandPrior, s[1:]
+	case 'b', 'B':
+		op.kind, s = operandBCD, s[1:]
+	case '~':
+		op.kind, s = operandInvert, s[1:]
+	}
+
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return op, s, fmt.Errorf("invalid operand: %q", s)
+	}
+
+	s = s[2:]
+	op.size = size16
+
+	if s != "" {
+		if size, ok := sizeLetters[upper(s[0])]; ok {
+			op.size, s = size, s[1:]
+		} else if s[0] == ' ' {
+			s = s[1:]
+		}
+	}
+
+	n, rest := takeWhile(s, isHexDigit)
+
+	addr, err := strconv.ParseUint(n, 16, 32)
+	if err != nil {
+		return op, s, fmt.Errorf("invalid address: %q", s)
+	}
+
+	op.addr = uint32(addr)
+
+	return op, rest, nil
+}
+
+// condition is a single comparison, or a modifier of the next condition,
+// depending on its flag, e.g. "R:0xH0010=5.2." is the reset condition which
+// is true once the byte at $0010 has been equal to 5 for two frames.
+type condition struct {
+	flag     byte // 0 for the plain conditions
+	left     operand
+	op       string
+	right    operand
+	required uint32 // hit target, 0 for none
+	hits     uint32
+	pause    bool // part of a PauseIf chain
+}
+
+// modifier reports whether the condition modifies the next one, rather than
+// being tested on its own.
+func (c *condition) modifier() bool {
+	switch c.flag {
+	case 'A', 'B', 'I', 'N', 'O', 'C', 'D', 'Z', 'K':
+		return true
+	default:
+		return false
+	}
+}
+
+var comparisons = []string{"!=", "<=", ">=", "=", "<", ">", "*", "/", "&", "^", "%", "+", "-"}
+
+func parseCondition(s string) (*condition, error) {
+	c := &condition{}
+
+	if len(s) >= 2 && s[1] == ':' {
+		c.flag, s = upper(s[0]), s[2:]
+
+		if !strings.ContainsRune("PRABCDNOZMQTIK", rune(c.flag)) {
+			return nil, fmt.Errorf("unknown condition flag: %q", c.flag)
+		}
+	}
+
+	var err error
+
+	if c.left, s, err = parseOperand(s); err != nil {
+		return nil, err
+	}
+
+	for _, op := range comparisons {
+		if strings.HasPrefix(s, op) {
+			c.op, s = op, s[len(op):]
+			break
+		}
+	}
+
+	if c.op != "" {
+		if c.right, s, err = parseOperand(s); err != nil {
+			return nil, err
+		}
+	}
+
+	// The hit target is either ".N." or the legacy "(N)".
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "(") {
+		n, rest := takeWhile(s[1:], isDigit)
+
+		v, err := strconv.ParseUint(n, 10, 32)
+		if err != nil || rest == "" || (rest[0] != '.' && rest[0] != ')') {
+			return nil, fmt.Errorf("invalid hit target: %q", s)
+		}
+
+		c.required, s = uint32(v), rest[1:]
+	}
+
+	if s != "" {
+		return nil, fmt.Errorf("unexpected %q", s)
+	}
+
+	return c, nil
+}
+
+// value returns the result of the arithmetic modifiers, such as AddSource.
+func (c *condition) value(mem Memory, offset uint32) uint32 {
+	left := c.left.get(mem, offset)
+	if c.op == "" {
+		return left
+	}
+
+	right := c.right.get(mem, offset)
+
+	switch c.op {
+	case "*":
+		return left * right
+	case "/":
+		if right == 0 {
+			return 0
+		}
+		return left / right
+	case "%":
+		if right == 0 {
+			return 0
+		}
+		return left % right
+	case "&":
+		return left & right
+	case "^":
+		return left ^ right
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	default:
+		return left
+	}
+}
+
+// compare tests the condition, with the accumulated AddSource/SubSource value
+// added to the left operand.
+func (c *condition) compare(mem Memory, add, offset uint32) bool {
+	var (
+		left  = c.left.get(mem, offset) + add
+		right = c.right.get(mem, offset)
+	)
+
+	switch c.op {
+	case "=":
+		return left == right
+	case "!=":
+		return left != right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	default:
+		return left != 0 // a condition without comparison
+	}
+}
+
+// group is a set of conditions which are all required to be true: either the
+// core of the trigger, or one of its alternatives.
+type group struct {
+	conditions []*condition
+	hasPause   bool
+}
+
+func parseGroup(s string) (*group, error) {
+	g := &group{}
+
+	if s == "" {
+		return g, nil
+	}
+
+	for _, text := range strings.Split(s, "_") {
+		c, err := parseCondition(text)
+		if err != nil {
+			return nil, fmt.Errorf("condition %q: %w", text, err)
+		}
+
+		g.conditions = append(g.conditions, c)
+	}
+
+	// The modifiers belong to the chain of the condition they modify, which
+	// is evaluated before the rest when it is a PauseIf.
+	pause := false
+
+	for i := len(g.conditions) - 1; i >= 0; i-- {
+		c := g.conditions[i]
+
+		if !c.modifier() {
+			pause = c.flag == 'P'
+		}
+
+		c.pause = pause
+		g.hasPause = g.hasPause || pause
+	}
+
+	return g, nil
+}
+
+func (g *group) resetHits() {
+	for _, c := range g.conditions {
+		c.hits = 0
+	}
+}
+
+// test evaluates the conditions of one kind: either the PauseIf chains or all
+// other conditions. Returns whether they are true and whether any of the
+// ResetIf conditions is true. With pause, true means the group is paused.
+func (g *group) test(mem Memory, pause bool) (result, reset bool) {
+	var (
+		add, offset uint32
+		addHits     int64
+		chained     bool // whether the previous condition was AndNext/OrNext
+		chainAnd    bool
+		chainValue  bool
+		resetNext   bool
+	)
+
+	result = !pause
+
+	for _, c := range g.conditions {
+		if c.pause != pause {
+			continue
+		}
+
+		switch c.flag {
+		case 'A':
+			add += c.value(mem, offset)
+			offset = 0
+			continue
+		case 'B':
+			add -= c.value(mem, offset)
+			offset = 0
+			continue
+		case 'I':
+			offset = c.value(mem, offset)
+			continue
+		case 'K':
+			offset = 0
+			continue
+		}
+
+		ok := c.compare(mem, add, offset)
+		add, offset = 0, 0
+
+		if chained {
+			if chainAnd {
+				ok = ok && chainValue
+			} else {
+				ok = ok || chainValue
+			}
+
+			chained = false
+		}
+
+		if resetNext {
+			c.hits = 0
+			resetNext = false
+		}
+
+		switch c.flag {
+		case 'N', 'O':
+			chained, chainAnd, chainValue = true, c.flag == 'N', ok
+			continue
+		}
+
+		if ok && (c.required == 0 || c.hits < c.required) {
+			c.hits++
+		}
+
+		switch c.flag {
+		case 'C':
+			addHits += int64(c.hits)
+			continue
+		case 'D':
+			addHits -= int64(c.hits)
+			continue
+		}
+
+		if c.required > 0 {
+			ok = int64(c.hits)+addHits >= int64(c.required)
+		}
+
+		addHits = 0
+
+		switch c.flag {
+		case 'Z':
+			resetNext = resetNext || ok
+		case 'R':
+			reset = reset || ok
+		case 'P':
+			result = result || ok
+		default:
+			result = result && ok
+		}
+	}
+
+	return result, reset
+}
+
+// trigger is the full logic of an achievement: the core group, which must be
+// true, and the alternatives, of which at least one must be true if any.
+type trigger struct {
+	core *group
+	alts []*group
+}
+
+// splitGroups splits the trigger into the groups by the "S" separators, taking
+// care not to split on the "0xS" bit6 operands.
+func splitGroups(s string) []string {
+	var (
+		groups []string
+		start  int
+	)
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'S' && (i < 2 || (s[i-2:i] != "0x" && s[i-2:i] != "0X")) {
+			groups = append(groups, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(groups, s[start:])
+}
+
+func parseTrigger(s string) (*trigger, error) {
+	var (
+		t     = &trigger{}
+		parts = splitGroups(s)
+	)
+
+	for i, part := range parts {
+		g, err := parseGroup(part)
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			t.core = g
+		} else {
+			t.alts = append(t.alts, g)
+		}
+	}
+
+	return t, nil
+}
+
+func (t *trigger) groups() []*group {
+	return append([]*group{t.core}, t.alts...)
+}
+
+func (t *trigger) resetHits() {
+	for _, g := range t.groups() {
+		g.resetHits()
+	}
+}
+
+// endFrame updates the history of the operands skipped during the frame.
+func (t *trigger) endFrame(mem Memory) {
+	for _, g := range t.groups() {
+		for _, c := range g.conditions {
+			c.left.endFrame(mem)
+			c.right.endFrame(mem)
+		}
+	}
+}
+
+// test evaluates the trigger for the current frame. The hits are reset when
+// any of the ResetIf conditions is true, which also prevents the trigger.
+func (t *trigger) test(mem Memory) bool {
+	var (
+		reset  bool
+		result = true
+		altOK  = len(t.alts) == 0
+	)
+
+	defer t.endFrame(mem)
+
+	for i, g := range t.groups() {
+		if g.hasPause {
+			if paused, _ := g.test(mem, true); paused {
+				if i == 0 {
+					result = false
+				}
+
+				continue
+			}
+		}
+
+		ok, r := g.test(mem, false)
+		reset = reset || r
+
+		if i == 0 {
+			result = ok
+		} else {
+			altOK = altOK || ok
+		}
+	}
+
+	if reset {
+		t.resetHits()
+		return false
+	}
+
+	return result && altOK
+}
+
+func takeWhile(s string, pred func(byte) bool) (string, string) {
+	i := 0
+	for i < len(s) && pred(s[i]) {
+		i++
+	}
+
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+
+	return c
+}
@@ -0,0 +1,278 @@
+package achievements
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		flag     byte
+		left     operand
+		op       string
+		right    operand
+		required uint32
+	}{
+		"byte equals value": {
+			input: "0xH0010=5",
+			left:  operand{kind: operandAddress, size: size8, addr: 0x10},
+			op:    "=",
+			right: operand{value: 5},
+		},
+		"default size is 16 bits": {
+			input: "0x1234!=h1F",
+			left:  operand{kind: operandAddress, size: size16, addr: 0x1234},
+			op:    "!=",
+			right: operand{value: 0x1F},
+		},
+		"legacy space before address": {
+			input: "0x 1234>=10",
+			left:  operand{kind: operandAddress, size: size16, addr: 0x1234},
+			op:    ">=",
+			right: operand{value: 10},
+		},
+		"delta and bit": {
+			input: "d0xS0020<0xS0020",
+			left:  operand{kind: operandDelta, size: sizeBit6, addr: 0x20},
+			op:    "<",
+			right: operand{kind: operandAddress, size: sizeBit6, addr: 0x20},
+		},
+		"prior, bcd and invert": {
+			input: "p0xL0001=b0xU0002",
+			left:  operand{kind: operandPrior, size: sizeLowNibble, addr: 0x01},
+			op:    "=",
+			right: operand{kind: operandBCD, size: sizeHighNibble, addr: 0x02},
+		},
+		"inverted big-endian": {
+			input: "~0xI0003>v-1",
+			left:  operand{kind: operandInvert, size: size16BE, addr: 0x03},
+			op:    ">",
+			right: operand{value: 0xFFFFFFFF},
+		},
+		"reset with hit target": {
+			input:    "R:0xH0010=5.2.",
+			flag:     'R',
+			left:     operand{kind: operandAddress, size: size8, addr: 0x10},
+			op:       "=",
+			right:    operand{value: 5},
+			required: 2,
+		},
+		"legacy hit target": {
+			input:    "0xH0010=1(3)",
+			left:     operand{kind: operandAddress, size: size8, addr: 0x10},
+			op:       "=",
+			right:    operand{value: 1},
+			required: 3,
+		},
+		"modifier without comparison": {
+			input: "a:0xX0100",
+			flag:  'A',
+			left:  operand{kind: operandAddress, size: size32, addr: 0x100},
+		},
+		"modifier with arithmetic": {
+			input: "I:0xH0004*2",
+			flag:  'I',
+			left:  operand{kind: operandAddress, size: size8, addr: 0x04},
+			op:    "*",
+			right: operand{value: 2},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, err := parseCondition(tt.input)
+			testutil.Equal(t, err, nil)
+			testutil.Equal(t, c.flag, tt.flag)
+			testutil.Equal(t, c.left, tt.left)
+			testutil.Equal(t, c.op, tt.op)
+			testutil.Equal(t, c.right, tt.right)
+			testutil.Equal(t, c.required, tt.required)
+		})
+	}
+}
+
+func TestParseCondition_Errors(t *testing.T) {
+	tests := map[string]string{
+		"unknown flag":         "X:0xH0010=1",
+		"missing operand":      "0xH0010=",
+		"invalid address":      "0xHZZ=1",
+		"invalid operand":      "q0x10=1",
+		"invalid hex value":    "0xH0010=hZ",
+		"unterminated target":  "0xH0010=1.2",
+		"invalid hit target":   "0xH0010=1.x.",
+		"trailing characters":  "0xH0010=1junk",
+		"empty condition text": "",
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseCondition(input)
+			testutil.Equal(t, err != nil, true)
+		})
+	}
+}
+
+func TestSplitGroups(t *testing.T) {
+	testutil.Equal(t, strings.Join(splitGroups("0xS0010=1S0xH0001=1S0xH0002=1"), "|"), "0xS0010=1|0xH0001=1|0xH0002=1")
+	testutil.Equal(t, strings.Join(splitGroups("S0xH0001=1"), "|"), "|0xH0001=1")
+}
+
+func TestMemSize_Read(t *testing.T) {
+	data := []uint8{0x12, 0x34, 0x56, 0x78}
+	mem := func(addr uint16) uint8 {
+		return data[addr]
+	}
+
+	tests := map[memSize]uint32{
+		size8:          0x12,
+		size16:         0x3412,
+		size24:         0x563412,
+		size32:         0x78563412,
+		size16BE:       0x1234,
+		size24BE:       0x123456,
+		size32BE:       0x12345678,
+		sizeBit1:       1,
+		sizeBit4:       1,
+		sizeBit5:       0,
+		sizeLowNibble:  0x02,
+		sizeHighNibble: 0x01,
+		sizeBitCount:   2,
+	}
+
+	for size, want := range tests {
+		testutil.Equal(t, size.read(mem, 0), want)
+	}
+
+	testutil.Equal(t, fromBCD(0x1234), uint32(1234))
+}
+
+// Each frame sets the bytes of the memory, starting at $0000, and tells
+// whether the trigger is expected to be true on that frame.
+type testFrame struct {
+	mem  []uint8
+	want bool
+}
+
+func TestTrigger_Test(t *testing.T) {
+	tests := map[string]struct {
+		trigger string
+		frames  []testFrame
+	}{
+		"plain comparison": {
+			trigger: "0xH0000=1_0xH0001>2",
+			frames: []testFrame{
+				{mem: []uint8{1, 2}, want: false},
+				{mem: []uint8{1, 3}, want: true},
+				{mem: []uint8{0, 3}, want: false},
+			},
+		},
+		"hit count": {
+			trigger: "0xH0000=1.3.",
+			frames: []testFrame{
+				{mem: []uint8{1}, want: false},
+				{mem: []uint8{0}, want: false},
+				{mem: []uint8{1}, want: false},
+				{mem: []uint8{1}, want: true},
+				{mem: []uint8{0}, want: true}, // the hits are kept
+			},
+		},
+		"delta": {
+			trigger: "d0xH0000=1_0xH0000=2",
+			frames: []testFrame{
+				{mem: []uint8{1}, want: false},
+				{mem: []uint8{2}, want: true},
+				{mem: []uint8{3}, want: false},
+			},
+		},
+		"prior": {
+			trigger: "p0xH0000=1_0xH0000=3",
+			frames: []testFrame{
+				{mem: []uint8{1}, want: false},
+				{mem: []uint8{3}, want: true},
+				{mem: []uint8{3}, want: true}, // not changed since
+				{mem: []uint8{2}, want: false},
+			},
+		},
+		"add source": {
+			trigger: "A:0xH0000_0xH0001=5",
+			frames: []testFrame{
+				{mem: []uint8{2, 2}, want: false},
+				{mem: []uint8{2, 3}, want: true},
+			},
+		},
+		"add address": {
+			trigger: "I:0xH0000_0xH0002=7",
+			frames: []testFrame{
+				{mem: []uint8{0, 0, 1, 7}, want: false},
+				{mem: []uint8{1, 0, 1, 7}, want: true},
+			},
+		},
+		"pause stops the hits": {
+			trigger: "0xH0001=1.2._P:0xH0000=1",
+			frames: []testFrame{
+				{mem: []uint8{0, 1}, want: false},
+				{mem: []uint8{1, 1}, want: false},
+				{mem: []uint8{0, 1}, want: true},
+			},
+		},
+		"reset clears the hits": {
+			trigger: "0xH0001=1.2._R:0xH0000=1",
+			frames: []testFrame{
+				{mem: []uint8{0, 1}, want: false},
+				{mem: []uint8{1, 1}, want: false},
+				{mem: []uint8{0, 1}, want: false},
+				{mem: []uint8{0, 1}, want: true},
+			},
+		},
+		"alternatives": {
+			trigger: "0xH0000=1S0xH0001=1S0xH0001=2",
+			frames: []testFrame{
+				{mem: []uint8{1, 0}, want: false},
+				{mem: []uint8{1, 2}, want: true},
+				{mem: []uint8{0, 1}, want: false},
+				{mem: []uint8{1, 1}, want: true},
+			},
+		},
+		"delta is of the previous frame after pause": {
+			trigger: "d0xH0001=1_0xH0001=2_P:0xH0000=1",
+			frames: []testFrame{
+				{mem: []uint8{0, 5}, want: false},
+				{mem: []uint8{1, 3}, want: false},
+				{mem: []uint8{1, 1}, want: false},
+				{mem: []uint8{0, 2}, want: true},
+			},
+		},
+		"delta is not of the frame before pause": {
+			trigger: "d0xH0001=1_0xH0001=2_P:0xH0000=1",
+			frames: []testFrame{
+				{mem: []uint8{0, 1}, want: false},
+				{mem: []uint8{1, 5}, want: false},
+				{mem: []uint8{1, 7}, want: false},
+				{mem: []uint8{0, 2}, want: false},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			trig, err := parseTrigger(tt.trigger)
+			testutil.Equal(t, err, nil)
+
+			var data [16]uint8
+			mem := func(addr uint16) uint8 {
+				return data[addr%16]
+			}
+
+			for i, frame := range tt.frames {
+				copy(data[:], frame.mem)
+
+				if got := trig.test(mem); got != frame.want {
+					t.Fatalf("frame %d: got %v, want %v", i, got, frame.want)
+				}
+			}
+		})
+	}
+}
@@ -25,6 +25,8 @@ type APU struct {
 	triangle triangle
 	filters  []*filter
 
+	expansion func() float32 // the sound channels of the cartridge, if any
+
 	irqDisable bool
 	frameIRQ   bool
 }
@@ -130,6 +132,10 @@ func (a *APU) Output() float32 {
 	d := a.dmc.output()
 
 	out := a.mix(p1, p2, t, n, d)
+	if a.expansion != nil {
+		out += a.expansion()
+	}
+
 	for _, f := range a.filters {
 		out = f.do(out)
 	}
@@ -199,6 +205,12 @@ func (a *APU) SetDMACallback(cb func(addr uint16) byte) {
 	a.dmc.dmaCallback = cb
 }
 
+// SetExpansion sets the output of the expansion audio of the cartridge, mixed
+// with the APU channels, or nil if there is none.
+func (a *APU) SetExpansion(output func() float32) {
+	a.expansion = output
+}
+
 func (a *APU) SaveState(w *binario.Writer) error {
 	return errors.Join(
 		a.pulse1.saveState(w),
@@ -208,8 +220,8 @@ func (a *APU) SaveState(w *binario.Writer) error {
 		a.dmc.saveState(w),
 		w.WriteBool(a.PendingIRQ),
 		w.WriteUint8(a.mode),
-		w.WriteUint64(a.cycle),
-		w.WriteUint64(a.frame),
+		w.WriteVarUint(a.cycle),
+		w.WriteVarUint(a.frame),
 		w.WriteBool(a.irqDisable),
 		w.WriteBool(a.frameIRQ),
 	)
@@ -224,8 +236,8 @@ func (a *APU) LoadState(r *binario.Reader) error {
 		a.dmc.loadState(r),
 		r.ReadBoolTo(&a.PendingIRQ),
 		r.ReadUint8To(&a.mode),
-		r.ReadUint64To(&a.cycle),
-		r.ReadUint64To(&a.frame),
+		r.ReadVarUintTo(&a.cycle),
+		r.ReadVarUintTo(&a.frame),
 		r.ReadBoolTo(&a.irqDisable),
 		r.ReadBoolTo(&a.frameIRQ),
 	)
@@ -0,0 +1,153 @@
+package cheats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cheat is a single code the user has entered, which can be turned on and off
+// without removing it. The code is either a Game Genie code, patching the reads
+// from the cartridge, or a raw AAAA:VV code, freezing the byte at the RAM
+// address to the value, the way the Pro Action Rocky did.
+type Cheat struct {
+	Code    string // normalized, e.g. "SXIOPO" or "075A:09"
+	Name    string // optional description
+	Enabled bool
+
+	patch  Patch
+	freeze bool // patch is a RAM address and value written every frame
+}
+
+// List is the set of cheats of the running game. The enabled patches are kept
+// separately, as they are checked on every cartridge read.
+type List struct {
+	cheats  []*Cheat
+	patches []Patch
+	freezes []Patch
+}
+
+// NewList creates an empty cheat list.
+func NewList() *List {
+	return &List{}
+}
+
+// parseFreeze parses the AAAA:VV code, where the address is in one of the RAM
+// ranges, as writing to the registers every frame would break the game.
+func parseFreeze(code string) (Patch, error) {
+	addrText, valueText, _ := strings.Cut(code, ":")
+
+	addr, err := strconv.ParseUint(addrText, 16, 16)
+	if err != nil {
+		return Patch{}, fmt.Errorf("invalid address in %q", code)
+	}
+
+	value, err := strconv.ParseUint(valueText, 16, 8)
+	if err != nil {
+		return Patch{}, fmt.Errorf("invalid value in %q", code)
+	}
+
+	for _, r := range searchRanges {
+		if uint16(addr) >= r[0] && uint16(addr) <= r[1] {
+			return Patch{Addr: uint16(addr), Value: uint8(value)}, nil
+		}
+	}
+
+	return Patch{}, fmt.Errorf("address is not in RAM: %q", code)
+}
+
+// Add decodes the code and adds it to the list, enabled. Adding the same code
+// again returns the existing cheat.
+func (l *List) Add(code string) (*Cheat, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	c := &Cheat{Enabled: true}
+
+	if strings.Contains(code, ":") {
+		patch, err := parseFreeze(code)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Code = fmt.Sprintf("%04X:%02X", patch.Addr, patch.Value)
+		c.patch, c.freeze = patch, true
+	} else {
+		patch, err := DecodeGameGenie(code)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Code, c.patch = code, patch
+	}
+
+	for _, existing := range l.cheats {
+		if existing.Code == c.Code {
+			return existing, nil
+		}
+	}
+
+	l.cheats = append(l.cheats, c)
+	l.update()
+
+	return c, nil
+}
+
+// AddCodes adds the comma-separated list of codes.
+func (l *List) AddCodes(codes string) error {
+	for _, code := range strings.Split(codes, ",") {
+		if strings.TrimSpace(code) == "" {
+			continue
+		}
+
+		if _, err := l.Add(code); err != nil {
+			return fmt.Errorf("cheat %q: %w", code, err)
+		}
+	}
+
+	return nil
+}
+
+// Cheats returns all cheats in the order they were added.
+func (l *List) Cheats() []*Cheat {
+	return l.cheats
+}
+
+// SetEnabled turns the cheat on or off.
+func (l *List) SetEnabled(c *Cheat, enabled bool) {
+	c.Enabled = enabled
+	l.update()
+}
+
+func (l *List) update() {
+	l.patches = l.patches[:0]
+	l.freezes = l.freezes[:0]
+
+	for _, c := range l.cheats {
+		switch {
+		case !c.Enabled:
+			continue
+		case c.freeze:
+			l.freezes = append(l.freezes, c.patch)
+		default:
+			l.patches = append(l.patches, c.patch)
+		}
+	}
+}
+
+// PatchRead returns the byte read from the cartridge address with the enabled
+// patches applied. It is called by the bus on every read, so it must be fast.
+func (l *List) PatchRead(addr uint16, data uint8) uint8 {
+	for i := range l.patches {
+		data = l.patches[i].Apply(addr, data)
+	}
+
+	return data
+}
+
+// Freeze writes the values of the enabled RAM cheats. It is called once per
+// frame, so the game may see its own value for the rest of the frame.
+func (l *List) Freeze(write func(addr uint16, data uint8)) {
+	for _, p := range l.freezes {
+		write(p.Addr, p.Value)
+	}
+}
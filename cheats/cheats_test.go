@@ -0,0 +1,76 @@
+package cheats
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+func TestParseFreeze(t *testing.T) {
+	tests := map[string]struct {
+		code    string
+		want    Patch
+		wantErr bool
+	}{
+		"internal ram":  {code: "075A:09", want: Patch{Addr: 0x075A, Value: 0x09}},
+		"short":         {code: "5A:9", want: Patch{Addr: 0x005A, Value: 0x09}},
+		"first":         {code: "0000:FF", want: Patch{Addr: 0x0000, Value: 0xFF}},
+		"cartridge ram": {code: "7FFF:01", want: Patch{Addr: 0x7FFF, Value: 0x01}},
+		"mirror":        {code: "0800:01", wantErr: true},
+		"registers":     {code: "2000:01", wantErr: true},
+		"rom":           {code: "8000:01", wantErr: true},
+		"no address":    {code: ":01", wantErr: true},
+		"no value":      {code: "075A:", wantErr: true},
+		"value too big": {code: "075A:100", wantErr: true},
+		"not hex":       {code: "07XA:01", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseFreeze(tt.code)
+			testutil.Equal(t, err != nil, tt.wantErr)
+			testutil.Equal(t, got, tt.want)
+		})
+	}
+}
+
+// The RAM cheats are written every frame, while the Game Genie ones patch the
+// reads, and neither applies once disabled.
+func TestList(t *testing.T) {
+	l := NewList()
+
+	if err := l.AddCodes("075a:09,, SXIOPO ,"); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, len(l.Cheats()), 2)
+	testutil.Equal(t, l.Cheats()[0].Code, "075A:09")
+
+	var ram [0x800]uint8
+
+	write := func(addr uint16, data uint8) { ram[addr] = data }
+
+	l.Freeze(write)
+	testutil.Equal(t, ram[0x075A], uint8(0x09))
+	testutil.Equal(t, l.PatchRead(0x91D9, 0xCE), uint8(0xAD))
+	testutil.Equal(t, l.PatchRead(0x075A, 0x03), uint8(0x03))
+
+	ram[0x075A] = 0
+	l.SetEnabled(l.Cheats()[0], false)
+	l.SetEnabled(l.Cheats()[1], false)
+
+	l.Freeze(write)
+	testutil.Equal(t, ram[0x075A], uint8(0))
+	testutil.Equal(t, l.PatchRead(0x91D9, 0xCE), uint8(0xCE))
+
+	c, err := l.Add("075A:09")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, c, l.Cheats()[0])
+	testutil.Equal(t, len(l.Cheats()), 2)
+
+	err = l.AddCodes("075A:09,SXIOPB")
+	testutil.Equal(t, err != nil, true)
+}
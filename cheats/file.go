@@ -0,0 +1,89 @@
+package cheats
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const fileHeader = "# Cheat codes, one per line: <code> <on|off> [name]\n"
+
+// Load reads the cheat file, a text file with a cheat per line: the code, its
+// state and an optional name, e.g. "075A:09 on Infinite lives". Empty lines and
+// the lines starting with # are ignored.
+func Load(filename string) (*List, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var (
+		l       = NewList()
+		scanner = bufio.NewScanner(f)
+		lineNum = 0
+	)
+
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		c, err := l.Add(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, lineNum, err)
+		}
+
+		if len(fields) > 1 {
+			switch fields[1] {
+			case "on":
+			case "off":
+				l.SetEnabled(c, false)
+			default:
+				return nil, fmt.Errorf("%s:%d: expected on or off, got %q", filename, lineNum, fields[1])
+			}
+		}
+
+		if len(fields) > 2 {
+			c.Name = strings.Join(fields[2:], " ")
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Save writes the cheats to the file in the format read by Load.
+func (l *List) Save(filename string) error {
+	var sb strings.Builder
+
+	sb.WriteString(fileHeader)
+
+	for _, c := range l.cheats {
+		state := "on"
+		if !c.Enabled {
+			state = "off"
+		}
+
+		line := c.Code + " " + state
+		if c.Name != "" {
+			line += " " + c.Name
+		}
+
+		sb.WriteString(line + "\n")
+	}
+
+	return os.WriteFile(filename, []byte(sb.String()), 0644)
+}
@@ -0,0 +1,136 @@
+package cheats
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+func writeCheatFile(t *testing.T, content string) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "game.cht")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+// formatCheats returns the cheats as "code state name" joined with the commas.
+func formatCheats(l *List) string {
+	var lines []string
+
+	for _, c := range l.Cheats() {
+		state := "on"
+		if !c.Enabled {
+			state = "off"
+		}
+
+		lines = append(lines, strings.TrimSpace(c.Code+" "+state+" "+c.Name))
+	}
+
+	return strings.Join(lines, ",")
+}
+
+func TestLoad(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		want    string
+		wantErr string
+	}{
+		"codes": {
+			content: "075a:09 on Infinite lives\nSXIOPO off\n",
+			want:    "075A:09 on Infinite lives,SXIOPO off",
+		},
+		"no state": {
+			content: "ZEXPYGLA\n",
+			want:    "ZEXPYGLA on",
+		},
+		"comments and empty lines": {
+			content: "# lives\n\n   \n  075A:09 on   Infinite   lives  \n# end\n",
+			want:    "075A:09 on Infinite lives",
+		},
+		"duplicate": {
+			content: "075A:09 on First\n075a:09 off\n",
+			want:    "075A:09 off First",
+		},
+		"empty": {
+			content: "",
+			want:    "",
+		},
+		"invalid code": {
+			content: "# lives\nSXIOPB on\n",
+			wantErr: ":2: invalid game genie letter",
+		},
+		"invalid state": {
+			content: "075A:09 yes\n",
+			wantErr: `:1: expected on or off, got "yes"`,
+		},
+		"not ram": {
+			content: "8000:09 on\n",
+			wantErr: ":1: address is not in RAM",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			l, err := Load(writeCheatFile(t, tt.content))
+
+			if tt.wantErr != "" {
+				testutil.Equal(t, err != nil && strings.Contains(err.Error(), tt.wantErr), true)
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testutil.Equal(t, formatCheats(l), tt.want)
+		})
+	}
+}
+
+func TestLoad_NotExist(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "game.cht"))
+	testutil.Equal(t, os.IsNotExist(err), true)
+}
+
+// The saved file is read back the same, including the disabled cheats, and has
+// the header describing the format.
+func TestList_Save(t *testing.T) {
+	l := NewList()
+
+	if err := l.AddCodes("075a:09, sxiopo, ZEXPYGLA"); err != nil {
+		t.Fatal(err)
+	}
+
+	cheats := l.Cheats()
+	cheats[0].Name = "Infinite lives"
+	l.SetEnabled(cheats[1], false)
+
+	filename := filepath.Join(t.TempDir(), "game.cht")
+	if err := l.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, string(data), fileHeader+
+		"075A:09 on Infinite lives\n"+
+		"SXIOPO off\n"+
+		"ZEXPYGLA on\n")
+
+	loaded, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, formatCheats(loaded), formatCheats(l))
+}
@@ -0,0 +1,72 @@
+package cheats
+
+import (
+	"fmt"
+	"strings"
+)
+
+// genieLetters maps the Game Genie letters to the 4-bit values they encode.
+const genieLetters = "APZLGITYEOXUKSVN"
+
+// Patch replaces the byte the CPU reads from the cartridge address. With the
+// compare value, the byte is only replaced when the original matches it, as
+// the games with bank switching map different code to the same address.
+type Patch struct {
+	Addr       uint16
+	Value      uint8
+	Compare    uint8
+	HasCompare bool
+}
+
+// DecodeGameGenie decodes the 6-letter (address and value) or 8-letter (with
+// the compare value) Game Genie code.
+func DecodeGameGenie(code string) (Patch, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	if len(code) != 6 && len(code) != 8 {
+		return Patch{}, fmt.Errorf("game genie code must be 6 or 8 letters: %q", code)
+	}
+
+	n := make([]uint16, len(code))
+
+	for i := 0; i < len(code); i++ {
+		v := strings.IndexByte(genieLetters, code[i])
+		if v < 0 {
+			return Patch{}, fmt.Errorf("invalid game genie letter %q in %q", code[i], code)
+		}
+
+		n[i] = uint16(v)
+	}
+
+	// The bits of the address and the values are scattered across the letters,
+	// see https://www.nesdev.org/wiki/Game_Genie
+	p := Patch{
+		Addr: 0x8000 |
+			(n[3]&7)<<12 |
+			(n[5]&7)<<8 | (n[4]&8)<<8 |
+			(n[2]&7)<<4 | (n[1]&8)<<4 |
+			(n[4] & 7) | (n[3] & 8),
+	}
+
+	value := (n[1]&7)<<4 | (n[0]&8)<<4 | (n[0] & 7)
+
+	if len(code) == 6 {
+		p.Value = uint8(value | n[5]&8)
+		return p, nil
+	}
+
+	p.Value = uint8(value | n[7]&8)
+	p.Compare = uint8((n[7]&7)<<4 | (n[6]&8)<<4 | (n[6] & 7) | (n[5] & 8))
+	p.HasCompare = true
+
+	return p, nil
+}
+
+// Apply returns the byte read from the address with the patch applied.
+func (p *Patch) Apply(addr uint16, data uint8) uint8 {
+	if addr != p.Addr || (p.HasCompare && data != p.Compare) {
+		return data
+	}
+
+	return p.Value
+}
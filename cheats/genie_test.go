@@ -0,0 +1,64 @@
+package cheats
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// The decoded codes are the examples of the Game Genie documentation and the
+// well-known infinite lives of Super Mario Bros.
+func TestDecodeGameGenie(t *testing.T) {
+	tests := map[string]struct {
+		code    string
+		want    Patch
+		wantErr bool
+	}{
+		"6 letters":         {code: "GOSSIP", want: Patch{Addr: 0xD1DD, Value: 0x14}},
+		"6 letters, smb":    {code: "SXIOPO", want: Patch{Addr: 0x91D9, Value: 0xAD}},
+		"6 letters, lowest": {code: "AAAAAA", want: Patch{Addr: 0x8000, Value: 0x00}},
+		"6 letters, top":    {code: "NNNNNN", want: Patch{Addr: 0xFFFF, Value: 0xFF}},
+		"8 letters":         {code: "ZEXPYGLA", want: Patch{Addr: 0x94A7, Value: 0x02, Compare: 0x03, HasCompare: true}},
+		"8 letters, top":    {code: "NNNNNNNN", want: Patch{Addr: 0xFFFF, Value: 0xFF, Compare: 0xFF, HasCompare: true}},
+		"lowercase":         {code: " sxiopo ", want: Patch{Addr: 0x91D9, Value: 0xAD}},
+		"too short":         {code: "SXIOP", wantErr: true},
+		"7 letters":         {code: "SXIOPOA", wantErr: true},
+		"too long":          {code: "ZEXPYGLAA", wantErr: true},
+		"invalid letter":    {code: "SXIOPB", wantErr: true},
+		"empty":             {code: "", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := DecodeGameGenie(tt.code)
+			testutil.Equal(t, err != nil, tt.wantErr)
+			testutil.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestPatch_Apply(t *testing.T) {
+	tests := map[string]struct {
+		code string
+		addr uint16
+		data uint8
+		want uint8
+	}{
+		"6 letters":                {code: "SXIOPO", addr: 0x91D9, data: 0xCE, want: 0xAD},
+		"6 letters, other address": {code: "SXIOPO", addr: 0x91DA, data: 0xCE, want: 0xCE},
+		"8 letters, compare":       {code: "ZEXPYGLA", addr: 0x94A7, data: 0x03, want: 0x02},
+		"8 letters, other data":    {code: "ZEXPYGLA", addr: 0x94A7, data: 0x04, want: 0x04},
+		"8 letters, other address": {code: "ZEXPYGLA", addr: 0x94A8, data: 0x03, want: 0x03},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := DecodeGameGenie(tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testutil.Equal(t, p.Apply(tt.addr, tt.data), tt.want)
+		})
+	}
+}
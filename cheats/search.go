@@ -0,0 +1,153 @@
+// Package cheats implements the cheat codes and the search for the memory
+// addresses to make them from.
+package cheats
+
+import "fmt"
+
+// searchRanges are the parts of the CPU address space where the games keep
+// their variables: the internal RAM and the cartridge RAM.
+var searchRanges = [][2]uint16{
+	{0x0000, 0x07FF},
+	{0x6000, 0x7FFF},
+}
+
+// Comparison filters the candidates by how their value has changed since the
+// previous snapshot.
+type Comparison int
+
+const (
+	Unchanged   Comparison = iota // same as before
+	Changed                       // different from before
+	Increased                     // greater than before
+	Decreased                     // less than before
+	IncreasedBy                   // greater than before by exactly N
+	DecreasedBy                   // less than before by exactly N
+	EqualTo                       // equal to N
+)
+
+func (c Comparison) String() string {
+	switch c {
+	case Unchanged:
+		return "unchanged"
+	case Changed:
+		return "changed"
+	case Increased:
+		return "increased"
+	case Decreased:
+		return "decreased"
+	case IncreasedBy:
+		return "increased by"
+	case DecreasedBy:
+		return "decreased by"
+	case EqualTo:
+		return "equal to"
+	default:
+		return fmt.Sprintf("Comparison(%d)", int(c))
+	}
+}
+
+func (c Comparison) match(prev, value, n uint8) bool {
+	switch c {
+	case Unchanged:
+		return value == prev
+	case Changed:
+		return value != prev
+	case Increased:
+		return value > prev
+	case Decreased:
+		return value < prev
+	case IncreasedBy:
+		return value-prev == n && value != prev
+	case DecreasedBy:
+		return prev-value == n && value != prev
+	case EqualTo:
+		return value == n
+	default:
+		return false
+	}
+}
+
+// Candidate is an address that has matched all the filters so far.
+type Candidate struct {
+	Addr  uint16
+	Prev  uint8 // value at the last snapshot
+	Value uint8 // current value
+}
+
+// Search narrows down the addresses of a variable, such as the number of lives,
+// by comparing the memory with its previous snapshot after it has changed in the
+// game, e.g. when a life is lost. Starts with all the RAM addresses.
+type Search struct {
+	read       func(addr uint16) uint8
+	candidates []uint16
+	prev       []uint8 // values of the candidates at the last snapshot
+}
+
+// NewSearch starts the search, taking the first snapshot of the memory with the
+// read function, which must not have side effects.
+func NewSearch(read func(addr uint16) uint8) *Search {
+	s := &Search{read: read}
+	s.Restart()
+
+	return s
+}
+
+// Restart makes all the addresses candidates again and takes a new snapshot.
+func (s *Search) Restart() {
+	s.candidates = s.candidates[:0]
+
+	for _, r := range searchRanges {
+		for addr := int(r[0]); addr <= int(r[1]); addr++ {
+			s.candidates = append(s.candidates, uint16(addr))
+		}
+	}
+
+	s.snapshot()
+}
+
+func (s *Search) snapshot() {
+	s.prev = s.prev[:0]
+
+	for _, addr := range s.candidates {
+		s.prev = append(s.prev, s.read(addr))
+	}
+}
+
+// Filter keeps the candidates whose current value compares to the snapshot as
+// given, where n is the operand of the comparisons that take one. The current
+// values then become the snapshot for the next filter.
+func (s *Search) Filter(cmp Comparison, n uint8) {
+	var (
+		candidates = s.candidates[:0]
+		prev       = s.prev[:0]
+	)
+
+	for i, addr := range s.candidates {
+		value := s.read(addr)
+
+		if cmp.match(s.prev[i], value, n) {
+			candidates = append(candidates, addr)
+			prev = append(prev, value)
+		}
+	}
+
+	s.candidates = candidates
+	s.prev = prev
+}
+
+// Count returns the number of candidates left.
+func (s *Search) Count() int {
+	return len(s.candidates)
+}
+
+// Candidates returns up to limit candidates with their current values.
+func (s *Search) Candidates(limit int) []Candidate {
+	result := make([]Candidate, 0, min(limit, len(s.candidates)))
+
+	for i := 0; i < len(s.candidates) && i < limit; i++ {
+		addr := s.candidates[i]
+		result = append(result, Candidate{Addr: addr, Prev: s.prev[i], Value: s.read(addr)})
+	}
+
+	return result
+}
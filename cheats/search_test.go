@@ -0,0 +1,111 @@
+package cheats
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+func TestComparison_Match(t *testing.T) {
+	tests := map[string]struct {
+		cmp   Comparison
+		prev  uint8
+		value uint8
+		n     uint8
+		want  bool
+	}{
+		"unchanged":            {cmp: Unchanged, prev: 3, value: 3, want: true},
+		"unchanged, changed":   {cmp: Unchanged, prev: 3, value: 4, want: false},
+		"changed":              {cmp: Changed, prev: 3, value: 4, want: true},
+		"changed, unchanged":   {cmp: Changed, prev: 3, value: 3, want: false},
+		"increased":            {cmp: Increased, prev: 3, value: 4, want: true},
+		"increased, decreased": {cmp: Increased, prev: 3, value: 2, want: false},
+		"decreased":            {cmp: Decreased, prev: 3, value: 2, want: true},
+		"decreased, unchanged": {cmp: Decreased, prev: 3, value: 3, want: false},
+		"increased by":         {cmp: IncreasedBy, prev: 3, value: 5, n: 2, want: true},
+		"increased by, other":  {cmp: IncreasedBy, prev: 3, value: 4, n: 2, want: false},
+		"increased by, wraps":  {cmp: IncreasedBy, prev: 0xFF, value: 0x01, n: 2, want: true},
+		"increased by zero":    {cmp: IncreasedBy, prev: 3, value: 3, n: 0, want: false},
+		"decreased by":         {cmp: DecreasedBy, prev: 3, value: 1, n: 2, want: true},
+		"decreased by, other":  {cmp: DecreasedBy, prev: 3, value: 2, n: 2, want: false},
+		"decreased by, wraps":  {cmp: DecreasedBy, prev: 0x01, value: 0xFF, n: 2, want: true},
+		"equal to":             {cmp: EqualTo, prev: 3, value: 9, n: 9, want: true},
+		"equal to, other":      {cmp: EqualTo, prev: 9, value: 3, n: 9, want: false},
+		"unknown comparison":   {cmp: Comparison(100), prev: 3, value: 3, want: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testutil.Equal(t, tt.cmp.match(tt.prev, tt.value, tt.n), tt.want)
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	var mem [0x10000]uint8
+
+	s := NewSearch(func(addr uint16) uint8 { return mem[addr] })
+	testutil.Equal(t, s.Count(), 0x0800+0x2000)
+
+	// Lives at $075A and a copy at $6010 go from 3 to 2, while $0300 changes
+	// for a reason of its own.
+	mem[0x075A], mem[0x6010], mem[0x0300] = 3, 3, 7
+	s.Restart()
+
+	mem[0x075A], mem[0x6010], mem[0x0300] = 2, 2, 8
+	s.Filter(DecreasedBy, 1)
+	testutil.Equal(t, s.Count(), 2)
+
+	mem[0x075A], mem[0x6010] = 1, 5
+	s.Filter(Decreased, 0)
+	testutil.Equal(t, s.Count(), 1)
+
+	got := s.Candidates(10)
+	testutil.Equal(t, len(got), 1)
+	testutil.Equal(t, got[0], Candidate{Addr: 0x075A, Prev: 1, Value: 1})
+
+	// The current value is read again, while the snapshot stays.
+	mem[0x075A] = 9
+	testutil.Equal(t, s.Candidates(10)[0], Candidate{Addr: 0x075A, Prev: 1, Value: 9})
+
+	s.Filter(EqualTo, 9)
+	testutil.Equal(t, s.Count(), 1)
+
+	s.Filter(Changed, 0)
+	testutil.Equal(t, s.Count(), 0)
+
+	s.Restart()
+	testutil.Equal(t, s.Count(), 0x0800+0x2000)
+}
+
+// Only the RAM is searched, not the registers or the cartridge ROM.
+func TestSearch_Ranges(t *testing.T) {
+	var mem [0x10000]uint8
+
+	s := NewSearch(func(addr uint16) uint8 { return mem[addr] })
+
+	for addr := range mem {
+		mem[addr] = 1
+	}
+
+	s.Filter(Changed, 0)
+
+	candidates := s.Candidates(s.Count())
+	testutil.Equal(t, len(candidates), 0x0800+0x2000)
+	testutil.Equal(t, candidates[0].Addr, uint16(0x0000))
+	testutil.Equal(t, candidates[0x07FF].Addr, uint16(0x07FF))
+	testutil.Equal(t, candidates[0x0800].Addr, uint16(0x6000))
+	testutil.Equal(t, candidates[len(candidates)-1].Addr, uint16(0x7FFF))
+}
+
+func TestSearch_CandidatesLimit(t *testing.T) {
+	var mem [0x10000]uint8
+
+	s := NewSearch(func(addr uint16) uint8 { return mem[addr] })
+
+	got := s.Candidates(3)
+	testutil.Equal(t, len(got), 3)
+	testutil.Equal(t, got[2].Addr, uint16(0x0002))
+
+	testutil.Equal(t, len(s.Candidates(0)), 0)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+
+	"github.com/maxpoletaev/dendy/achievements"
+	"github.com/maxpoletaev/dendy/system"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+// achievementSession is the RetroAchievements session of the running game.
+type achievementSession struct {
+	client  *achievements.Client
+	game    *achievements.Game
+	runtime *achievements.Runtime
+
+	// Cancels the awards still being sent when the game is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// startAchievements logs into RetroAchievements with the account from the
+// config and loads the achievements of the game. Returns nil if the account is
+// not set or anything fails, which does not prevent the game from running. The
+// password is replaced with the token after the first login.
+func startAchievements(nes *system.System, opts *options) *achievementSession {
+	cfg := &opts.config.Achievements
+	if cfg.Username == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(opts.romFile)
+	if err != nil {
+		log.Printf("[ERROR] failed to read rom file: %s", err)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client, err := achievements.Login(ctx, cfg.Username, cfg.Password, cfg.Token, opts.hardcore)
+	if err != nil {
+		log.Printf("[ERROR] failed to log into RetroAchievements: %s", err)
+		cancel()
+		return nil
+	}
+
+	// Only the token is kept once it is obtained, the password is removed from
+	// the config, see config.save.
+	if token := client.Token(); token != "" && (cfg.Token != token || cfg.Password != "") {
+		cfg.Token = token
+		opts.config.save()
+	}
+
+	game, err := client.LoadGame(ctx, achievements.HashNES(data))
+	if err != nil {
+		if errors.Is(err, achievements.ErrUnknownGame) {
+			log.Printf("[INFO] no achievements for this game")
+		} else {
+			log.Printf("[ERROR] failed to load achievements: %s", err)
+		}
+
+		cancel()
+		return nil
+	}
+
+	runtime, err := achievements.NewRuntime(nes.Peek, game.Achievements)
+	if err != nil {
+		log.Printf("[WARN] some achievements are not supported: %s", err)
+	}
+
+	earned := 0
+	for _, a := range game.Achievements {
+		if a.Earned {
+			earned++
+		}
+	}
+
+	mode := "softcore"
+	if opts.hardcore {
+		mode = "hardcore"
+	}
+
+	log.Printf("[INFO] achievements loaded: %s, %d of %d earned (%s)", game.Title, earned, len(game.Achievements), mode)
+
+	return &achievementSession{
+		client:  client,
+		game:    game,
+		runtime: runtime,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// frame evaluates the achievements at the end of the frame. The earned ones
+// are awarded in the background, so that the game does not stutter.
+func (s *achievementSession) frame(w *ui.Window) {
+	for _, a := range s.runtime.Frame() {
+		a := a
+
+		log.Printf("[INFO] achievement unlocked: %s (%d)", a.Title, a.ID)
+		w.ShowMessage("Achievement unlocked: %s (%d points)", a.Title, a.Points)
+
+		go func() {
+			if err := s.client.Award(s.ctx, s.game, a); err != nil {
+				log.Printf("[ERROR] failed to award achievement %d: %s", a.ID, err)
+			}
+		}()
+	}
+}
+
+// reset restarts the achievements after the console is reset, a state is
+// loaded or the game is rewound, as the memory changes all at once.
+func (s *achievementSession) reset() {
+	s.runtime.Reset()
+}
+
+// close cancels the requests still in progress.
+func (s *achievementSession) close() {
+	s.cancel()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/maxpoletaev/dendy/system"
+)
+
+const numAutoSaves = 3
+
+// autoSaveFile returns the name of the zero-based rotating auto-save file, e.g.
+// game.save.auto1 for the first one.
+func autoSaveFile(saveFile string, n int) string {
+	return fmt.Sprintf("%s.auto%d", saveFile, n+1)
+}
+
+// autoSaver periodically saves the state into one of the auto-save files,
+// overwriting the oldest one, so that a power loss or a system crash does not
+// wipe the progress made since the game was started. The crash state does not
+// help there, as it is only saved when the emulator itself panics.
+type autoSaver struct {
+	saveFile string
+	interval time.Duration
+	lastSave time.Time
+	next     int
+}
+
+func newAutoSaver(saveFile string, interval time.Duration) *autoSaver {
+	a := &autoSaver{
+		saveFile: saveFile,
+		interval: interval,
+		lastSave: time.Now(),
+	}
+
+	// Continue the rotation from the oldest file, or the first missing one.
+	var oldest time.Time
+
+	for i := 0; i < numAutoSaves; i++ {
+		info, err := os.Stat(autoSaveFile(saveFile, i))
+		if err != nil {
+			a.next = i
+			break
+		}
+
+		if oldest.IsZero() || info.ModTime().Before(oldest) {
+			oldest = info.ModTime()
+			a.next = i
+		}
+	}
+
+	return a
+}
+
+// tick saves the state if the interval has passed since the last auto-save.
+func (a *autoSaver) tick(nes *system.System) {
+	if time.Since(a.lastSave) < a.interval {
+		return
+	}
+
+	a.lastSave = time.Now()
+	filename := autoSaveFile(a.saveFile, a.next)
+	a.next = (a.next + 1) % numAutoSaves
+
+	if err := saveState(nes, filename); err != nil {
+		log.Printf("[ERROR] auto-save failed: %s", err)
+		return
+	}
+
+	log.Printf("[INFO] auto-saved: %s", filename)
+}
+
+// latestAutoSave returns the newest auto-save file if it is newer than the save
+// file, which means the emulator did not exit normally after it was made.
+func latestAutoSave(saveFile string) (string, bool) {
+	var (
+		latest   string
+		latestAt time.Time
+	)
+
+	if info, err := os.Stat(saveFile); err == nil {
+		latestAt = info.ModTime()
+	}
+
+	for i := 0; i < numAutoSaves; i++ {
+		filename := autoSaveFile(saveFile, i)
+
+		info, err := os.Stat(filename)
+		if err == nil && info.ModTime().After(latestAt) {
+			latest, latestAt = filename, info.ModTime()
+		}
+	}
+
+	return latest, latest != ""
+}
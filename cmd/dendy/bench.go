@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"time"
+
+	"github.com/maxpoletaev/dendy/consts"
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/loglevel"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+const benchUsage = "usage: dendy bench [-frames=10000] [-full] [-cpuprof=file] [-json] romfile"
+
+// benchResult is what the "bench" subcommand reports. The times are in
+// microseconds, apart from the total one.
+type benchResult struct {
+	ROM        string  `json:"rom"`
+	Mode       string  `json:"mode"`
+	Frames     int     `json:"frames"`
+	ElapsedMS  int64   `json:"elapsed_ms"`
+	FPS        float64 `json:"fps"`
+	RealTime   float64 `json:"real_time"` // times faster than the console
+	AvgFrameUS int64   `json:"avg_frame_us"`
+	P50FrameUS int64   `json:"p50_frame_us"`
+	P99FrameUS int64   `json:"p99_frame_us"`
+	MaxFrameUS int64   `json:"max_frame_us"`
+	Allocs     uint64  `json:"allocs"`
+	AllocBytes uint64  `json:"alloc_bytes"`
+	GCCycles   uint32  `json:"gc_cycles"`
+}
+
+// runBench runs the "bench" subcommand, which emulates the game headless as
+// fast as possible and reports the speed and the allocations, so that the
+// performance can be compared between the versions.
+func runBench(args []string) {
+	var (
+		frames  int
+		full    bool
+		cpuprof string
+		romFile string
+		jsonOut bool
+	)
+
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, benchUsage); fs.PrintDefaults() }
+	fs.IntVar(&frames, "frames", 10000, "number of frames to emulate")
+	fs.BoolVar(&full, "full", false, "render the picture and the sound, instead of fast-forwarding")
+	fs.StringVar(&cpuprof, "cpuprof", "", "write cpu profile to file")
+	fs.BoolVar(&jsonOut, "json", false, "print the results as json")
+
+	_ = fs.Parse(args) // exits on error
+
+	// The flags are also accepted after the ROM file.
+	for fs.NArg() > 0 {
+		if romFile != "" {
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		romFile = fs.Arg(0)
+		_ = fs.Parse(fs.Args()[1:])
+	}
+
+	if romFile == "" || frames < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	log.Default().SetFlags(0)
+	log.Default().SetOutput(loglevel.New(os.Stderr, loglevel.LevelWarn))
+
+	rom, err := ines.NewFromFile(romFile)
+	if err != nil {
+		log.Printf("[ERROR] failed to open rom file: %s", err)
+		os.Exit(1)
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		log.Printf("[ERROR] failed to open rom file: %s", err)
+		os.Exit(1)
+	}
+
+	nes := system.New(cart, input.NewJoystick(), input.NewZapper())
+	nes.SetFastForward(!full)
+
+	if cpuprof != "" {
+		f, err := os.Create(cpuprof)
+		if err != nil {
+			log.Printf("[ERROR] failed to create cpu profile: %v", err)
+			os.Exit(1)
+		}
+
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Printf("[ERROR] failed to start cpu profile: %v", err)
+			os.Exit(1)
+		}
+
+		defer pprof.StopCPUProfile()
+	}
+
+	var (
+		frameTimes  = make([]time.Duration, 0, frames)
+		audioBuffer = make([]float32, 0, consts.AudioBufferSize)
+		sampleClock system.SampleClock
+		nextSample  = sampleClock.Next()
+		memBefore   runtime.MemStats
+		memAfter    runtime.MemStats
+	)
+
+	runtime.GC()
+	runtime.ReadMemStats(&memBefore)
+
+	start := time.Now()
+	frameStart := start
+
+	for len(frameTimes) < frames {
+		nes.Tick()
+
+		// The sound is produced the same way as in the offline mode, just not
+		// played, as the fast-forward does not skip the APU.
+		if full {
+			if nextSample--; nextSample == 0 {
+				nextSample = sampleClock.Next()
+
+				if audioBuffer = append(audioBuffer, nes.AudioSample()); len(audioBuffer) == cap(audioBuffer) {
+					audioBuffer = audioBuffer[:0]
+				}
+			}
+		}
+
+		if nes.FrameReady() {
+			now := time.Now()
+			frameTimes = append(frameTimes, now.Sub(frameStart))
+			frameStart = now
+		}
+	}
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&memAfter)
+
+	slices.Sort(frameTimes)
+	percentile := func(p int) time.Duration {
+		return frameTimes[(len(frameTimes)-1)*p/100]
+	}
+
+	mode := "fast-forward"
+	if full {
+		mode = "full"
+	}
+
+	fps := float64(frames) / elapsed.Seconds()
+
+	result := &benchResult{
+		ROM:        romFile,
+		Mode:       mode,
+		Frames:     frames,
+		ElapsedMS:  elapsed.Milliseconds(),
+		FPS:        fps,
+		RealTime:   fps / consts.FrameRate,
+		AvgFrameUS: (elapsed / time.Duration(frames)).Microseconds(),
+		P50FrameUS: percentile(50).Microseconds(),
+		P99FrameUS: percentile(99).Microseconds(),
+		MaxFrameUS: frameTimes[len(frameTimes)-1].Microseconds(),
+		Allocs:     memAfter.Mallocs - memBefore.Mallocs,
+		AllocBytes: memAfter.TotalAlloc - memBefore.TotalAlloc,
+		GCCycles:   memAfter.NumGC - memBefore.NumGC,
+	}
+
+	if jsonOut {
+		printJSON(result)
+		return
+	}
+
+	us := func(v int64) time.Duration {
+		return time.Duration(v) * time.Microsecond
+	}
+
+	fmt.Printf("rom:         %s\n", result.ROM)
+	fmt.Printf("mode:        %s\n", result.Mode)
+	fmt.Printf("frames:      %d in %s\n", result.Frames, elapsed.Round(time.Millisecond))
+	fmt.Printf("speed:       %.0f fps (%.1fx real time)\n", result.FPS, result.RealTime)
+	fmt.Printf("frame time:  avg %s, p50 %s, p99 %s, max %s\n",
+		us(result.AvgFrameUS), us(result.P50FrameUS), us(result.P99FrameUS), us(result.MaxFrameUS))
+	fmt.Printf("allocations: %d (%.2f per frame), %d bytes (%.1f per frame)\n",
+		result.Allocs, float64(result.Allocs)/float64(frames), result.AllocBytes, float64(result.AllocBytes)/float64(frames))
+	fmt.Printf("gc cycles:   %d\n", result.GCCycles)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/maxpoletaev/dendy/cheats"
+	"github.com/maxpoletaev/dendy/system"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+// loadCheats loads the cheat file of the game and adds the codes given with the
+// -cheat flag to it, saving them for the next time. Exits if the file or any of
+// the codes is invalid, rather than overwrite the file later.
+func loadCheats(nes *system.System, opts *options) *cheats.List {
+	list, err := cheats.Load(opts.cheatFile)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		list = cheats.NewList()
+	case err != nil:
+		log.Printf("[ERROR] failed to load cheats: %s", err)
+		os.Exit(1)
+	}
+
+	if opts.cheats != "" {
+		if err := list.AddCodes(opts.cheats); err != nil {
+			log.Printf("[ERROR] %s", err)
+			os.Exit(1)
+		}
+
+		saveCheats(list, opts)
+	}
+
+	if n := len(list.Cheats()); n > 0 {
+		log.Printf("[INFO] cheats loaded: %d", n)
+	}
+
+	nes.SetCheats(list)
+
+	return list
+}
+
+func saveCheats(list *cheats.List, opts *options) {
+	if err := list.Save(opts.cheatFile); err != nil {
+		log.Printf("[ERROR] failed to save cheats: %s", err)
+	}
+}
+
+// setupCheats adds the toggle for each of the cheats to the settings menu, and
+// lets the cheat search add the values it has found as new cheats.
+func setupCheats(w *ui.Window, list *cheats.List, opts *options) {
+	w.FreezeDelegate = func(addr uint16, value uint8) {
+		c, err := list.Add(fmt.Sprintf("%04X:%02X", addr, value))
+		if err != nil {
+			w.ShowMessage("Failed to add cheat")
+			log.Printf("[ERROR] failed to add cheat: %s", err)
+
+			return
+		}
+
+		list.SetEnabled(c, true)
+		saveCheats(list, opts)
+		w.ShowMessage("Cheat added: %s", c.Code)
+	}
+
+	menuItems := w.MenuDelegate
+
+	w.MenuDelegate = func() []ui.MenuItem {
+		items := menuItems()
+
+		for _, c := range list.Cheats() {
+			c := c
+
+			// The names are shown instead of the codes, when given.
+			label := "Cheat " + c.Code
+			if c.Name != "" {
+				label = c.Name
+			}
+
+			items = append(items, ui.MenuItem{
+				Label: label,
+				Value: func() string { return onOff(c.Enabled) },
+				Change: func(int) {
+					list.SetEnabled(c, !c.Enabled)
+					saveCheats(list, opts)
+				},
+			})
+		}
+
+		return items
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"time"
 
@@ -64,16 +65,41 @@ func joinSession(relayAddr string, sessionID string, romCRC32 uint32) (string, s
 	return lAddr.String(), rAddr.String(), nil
 }
 
+// connectWithRetries connects to the host, retrying in case it is not up yet.
+// The delay between the attempts doubles each time, up to maxRetryDelay.
+func connectWithRetries(protocol, rAddr, lAddr string, game *netplay.Game, opts *options) (*netplay.Netplay, net.Addr, error) {
+	const maxRetryDelay = 10 * time.Second
+
+	delay := time.Second
+
+	for attempt := 0; ; attempt++ {
+		log.Printf("[INFO] connecting to %s (%s)...", rAddr, protocol)
+
+		sess, addr, err := netplay.Connect(protocol, rAddr, lAddr, opts.connectTimeout, game)
+		if err == nil || attempt == opts.retries {
+			return sess, addr, err
+		}
+
+		log.Printf("[WARN] failed to connect: %v, retrying in %s (%d/%d)", err, delay, attempt+1, opts.retries)
+		time.Sleep(delay)
+
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
 func runAsClient(cart ines.Cartridge, opts *options, rom *ines.ROM) {
 	joy1 := input.NewJoystick()
 	joy2 := input.NewJoystick()
 
 	nes := system.New(cart, joy1, joy2)
 	nes.SetNoSpriteLimit(opts.noSpriteLimit)
+	applyPalette(nes, opts)
+	enableCrashTrace(nes)
 
-	audio := ui.CreateAudio(consts.AudioSamplesPerSecond, consts.AudioSampleSize, 1, consts.AudioBufferSize)
+	defer recoverCrash(nes, opts)
+
+	audio := createAudio(opts)
 	defer audio.Close()
-	audio.Mute(opts.mute)
 
 	game := netplay.NewGame(nes, audio, joy2, joy1)
 	game.Init(nil)
@@ -120,9 +146,7 @@ func runAsClient(cart ines.Cartridge, opts *options, rom *ines.ROM) {
 		os.Exit(1)
 	}
 
-	log.Printf("[INFO] connecting to %s (%s)...", rAddr, protocol)
-	sess, addr, err := netplay.Connect(protocol, rAddr, lAddr, game)
-
+	sess, addr, err := connectWithRetries(protocol, rAddr, lAddr, game, opts)
 	if err != nil {
 		log.Printf("[ERROR] failed to connect: %v", err)
 		os.Exit(1)
@@ -131,20 +155,22 @@ func runAsClient(cart ines.Cartridge, opts *options, rom *ines.ROM) {
 	log.Printf("[INFO] connected to server: %s", addr)
 	log.Printf("[INFO] starting game...")
 
-	win := ui.CreateWindow(opts.scale, opts.verbose)
+	win := ui.CreateWindow(opts.windowOptions())
 	defer win.Close()
 
-	win.SetTitle(fmt.Sprintf("%s (P2)", windowTitle))
-	win.SetFrameRate(consts.FramesPerSecond)
+	setGameTitle(win, opts, "(P2)")
+	win.SetFrameRate(consts.FrameRate)
 	win.InputDelegate = sess.SendButtons
-	win.MuteDelegate = audio.ToggleMute
+	setupVolumeControls(win, audio, opts)
+	setupSettingsMenu(win, audio, nes, opts, false)
+	win.PauseDelegate = sess.SendTogglePause
+	sess.MessageDelegate = win.ShowMessage
 	win.ShowFPS = opts.showFPS
+	win.ShowPerf = opts.showPerf
 	win.ShowPing = true
 
-	if !opts.noCRT {
-		log.Printf("[INFO] using experimental CRT effect, disable with -nocrt flag")
-		win.EnableCRT()
-	}
+	enableShader(win, opts)
+	loadBezel(win, opts)
 
 	for {
 		startTime := time.Now()
@@ -156,16 +182,26 @@ func runAsClient(cart ines.Cartridge, opts *options, rom *ines.ROM) {
 		}
 
 		if sess.ShouldExit() {
-			log.Printf("[INFO] server disconnected")
+			if err := sess.Err(); err != nil {
+				log.Printf("[ERROR] disconnected: %s", err)
+			} else {
+				log.Printf("[INFO] server disconnected")
+			}
+
 			break
 		}
 
 		win.HandleHotKeys()
 		win.UpdateJoystick()
 		win.SetPingInfo(sess.RemotePing())
+		win.SetPaused(sess.Paused())
 
 		sess.HandleMessages()
 		sess.RunFrame(startTime)
+		win.SetFrameTimes(time.Since(startTime)-game.RollbackTime(), game.RollbackTime())
+		opts.metrics.rollback(game.RollbackFrames())
+		opts.metrics.frame()
+		opts.frameTimer.frame()
 
 		win.Refresh(nes.Frame())
 	}
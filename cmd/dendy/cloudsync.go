@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/maxpoletaev/dendy/internal/cloudsync"
+)
+
+const syncTimeout = time.Minute
+
+func syncManifestFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "dendy", "sync.json"), nil
+}
+
+// newSyncer creates the syncer for the backend in the config, or returns nil if
+// the sync is not configured.
+func newSyncer(cfg syncConfig) (*cloudsync.Syncer, error) {
+	var (
+		backend cloudsync.Backend
+		err     error
+	)
+
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "webdav":
+		backend, err = cloudsync.NewWebDAV(cfg.URL, cfg.Username, cfg.Password)
+	case "s3":
+		backend, err = cloudsync.NewS3(cfg.URL, cfg.Region, cfg.Bucket, cfg.AccessKey, cfg.SecretKey)
+	default:
+		return nil, fmt.Errorf("unknown sync backend: %s", cfg.Backend)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := syncManifestFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return cloudsync.New(backend, manifest)
+}
+
+// syncSaves syncs the save file and the save slots with the remote server. The
+// files are stored remotely under their base names. Errors are only logged, so
+// that the game can still be played offline.
+func syncSaves(syncer *cloudsync.Syncer, saveFile string) {
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+
+	files := []string{saveFile}
+	for i := 0; i < numSaveSlots; i++ {
+		files = append(files, slotFile(saveFile, i))
+	}
+
+	for _, file := range files {
+		action, err := syncer.Sync(ctx, file, filepath.Base(file))
+		if err != nil {
+			log.Printf("[ERROR] failed to sync %s: %s", file, err)
+			continue
+		}
+
+		switch action {
+		case cloudsync.Unchanged:
+		case cloudsync.ConflictKeptLocal, cloudsync.ConflictKeptRemote:
+			log.Printf("[WARN] sync %s: %s, the other copy is saved to %s", file, action, cloudsync.ConflictFile(file))
+		default:
+			log.Printf("[INFO] sync %s: %s", file, action)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+const maxHUDScale = 8
+
+// config holds the settings that are changed at runtime, e.g. with hotkeys or
+// in the settings menu, and persisted between runs in the user's config
+// directory. Flags passed explicitly take precedence over the config values.
+type config struct {
+	General generalConfig        `toml:"general"`
+	Display displayConfig        `toml:"display"`
+	Audio   audioConfig          `toml:"audio"`
+	Input   map[string]string    `toml:"input"`         // joystick button name or "mic" -> key name
+	HUD     map[string]hudConfig `toml:"hud,omitempty"` // hud element name -> settings
+	Sync    syncConfig           `toml:"sync,omitempty"`
+	Paths   pathsConfig          `toml:"paths,omitempty"`
+
+	// Games overrides the settings of the individual games, keyed by the ROM
+	// CRC32 (as printed by "dendy info") or the ROM file name without the
+	// extension.
+	Games map[string]gameConfig `toml:"game,omitempty"`
+
+	// Profiles are the input profiles, keyed by the name the games refer to
+	// them with.
+	Profiles map[string]*inputProfile `toml:"profile,omitempty"`
+
+	Achievements achievementsConfig `toml:"achievements,omitempty"`
+
+	filename string
+}
+
+type generalConfig struct {
+	// PauseOnFocusLoss pauses and mutes the game while the window is in the
+	// background. Only applies offline, as the remote player does not wait.
+	PauseOnFocusLoss bool `toml:"pause_on_focus_loss"`
+
+	// BackgroundInput keeps reading the gamepad while the window is in the
+	// background, which implies that the game is not paused.
+	BackgroundInput bool `toml:"background_input"`
+
+	// CopyScreenshots copies the unscaled screenshots to the clipboard, in
+	// addition to saving them to the screenshot directory.
+	CopyScreenshots bool `toml:"copy_screenshots"`
+
+	// AutoSaveMinutes is the interval of the periodic auto-save, 0 to disable.
+	AutoSaveMinutes int `toml:"autosave_minutes,omitempty"`
+
+	// Region is the timing of the console, as set with -region.
+	Region string `toml:"region,omitempty"`
+}
+
+type displayConfig struct {
+	ScaleMode   string `toml:"scale_mode,omitempty"`
+	Filter      string `toml:"filter,omitempty"`
+	PixelAspect bool   `toml:"pixel_aspect"`
+	Overlay     string `toml:"overlay,omitempty"`
+	Shader      string `toml:"shader,omitempty"`
+	Palette     string `toml:"palette,omitempty"`
+	Bezel       string `toml:"bezel,omitempty"`
+
+	// BezelCutout is the area of the bezel image the game is drawn into, as
+	// [x, y, width, height] in the image pixels. Detected when not set.
+	BezelCutout []int `toml:"bezel_cutout,omitempty"`
+}
+
+// pathsConfig sets the directories used instead of the defaults of the flags.
+// Only set by editing the config file manually.
+type pathsConfig struct {
+	StateDir      string `toml:"state_dir,omitempty"`
+	ScreenshotDir string `toml:"screenshot_dir,omitempty"`
+	GameDB        string `toml:"gamedb,omitempty"`
+	FDSBIOS       string `toml:"fds_bios,omitempty"`
+}
+
+// gameConfig overrides the settings for a single game, e.g. to disable the
+// sprite limit only where the flicker is annoying. The fields that are not set
+// keep the global values. Only set by editing the config file manually.
+type gameConfig struct {
+	NoSpriteLimit *bool  `toml:"no_sprite_limit,omitempty"`
+	RunAhead      *bool  `toml:"run_ahead,omitempty"`
+	FrameSkip     *int   `toml:"frame_skip,omitempty"`
+	Region        string `toml:"region,omitempty"`
+	ScaleMode     string `toml:"scale_mode,omitempty"`
+	Filter        string `toml:"filter,omitempty"`
+	PixelAspect   *bool  `toml:"pixel_aspect,omitempty"`
+	Overlay       string `toml:"overlay,omitempty"`
+	Shader        string `toml:"shader,omitempty"`
+	Palette       string `toml:"palette,omitempty"`
+	Bezel         string `toml:"bezel,omitempty"`
+	InputProfile  string `toml:"input_profile,omitempty"`
+}
+
+// hudConfig overrides the default placement of a HUD element. Only set by
+// editing the config file manually.
+type hudConfig struct {
+	Position string `toml:"position,omitempty"` // top-left, top-right, bottom-left, bottom-right
+	Scale    int    `toml:"scale,omitempty"`
+	Visible  *bool  `toml:"visible,omitempty"`
+}
+
+// syncConfig is the remote server the save files are synced with. Only set by
+// editing the config file manually.
+type syncConfig struct {
+	Backend string `toml:"backend,omitempty"` // webdav or s3, empty to disable
+	URL     string `toml:"url,omitempty"`     // webdav directory or s3 endpoint
+
+	// WebDAV basic authentication.
+	Username string `toml:"username,omitempty"`
+	Password string `toml:"password,omitempty"`
+
+	// S3 bucket and credentials.
+	Bucket    string `toml:"bucket,omitempty"`
+	Region    string `toml:"region,omitempty"`
+	AccessKey string `toml:"access_key,omitempty"`
+	SecretKey string `toml:"secret_key,omitempty"`
+}
+
+// achievementsConfig is the RetroAchievements account. The password is only
+// needed for the first login, after which it is replaced with the token.
+type achievementsConfig struct {
+	Username string `toml:"username,omitempty"`
+	Password string `toml:"password,omitempty"`
+	Token    string `toml:"token,omitempty"`
+	Hardcore bool   `toml:"hardcore,omitempty"`
+}
+
+type audioConfig struct {
+	Volume float32 `toml:"volume"`
+
+	// FastForwardVolume is the volume while fast-forwarding, in percent of the
+	// volume, as set with -ffvolume.
+	FastForwardVolume *int `toml:"fast_forward_volume,omitempty"`
+}
+
+func defaultConfig() *config {
+	return &config{
+		General: generalConfig{
+			PauseOnFocusLoss: true,
+		},
+		Audio: audioConfig{
+			Volume: 1.0,
+		},
+	}
+}
+
+func configFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "dendy", "config.toml"), nil
+}
+
+// loadConfig reads the config file, falling back to the defaults for missing
+// values or when the file does not exist.
+func loadConfig() *config {
+	cfg := defaultConfig()
+
+	filename, err := configFile()
+	if err != nil {
+		log.Printf("[WARN] failed to locate config directory: %s", err)
+		return cfg
+	}
+
+	cfg.filename = filename
+
+	if _, err := toml.DecodeFile(filename, cfg); err != nil && !os.IsNotExist(err) {
+		log.Printf("[WARN] failed to read config file: %s", err)
+	}
+
+	return cfg
+}
+
+// applyConfig overrides the options with the config values, unless the
+// corresponding flags were set on the command line.
+func (o *options) applyConfig(cfg *config) {
+	explicit := o.explicitFlags()
+
+	if cfg.General.AutoSaveMinutes != 0 && !explicit["autosave"] {
+		o.autoSave = cfg.General.AutoSaveMinutes
+	}
+
+	if cfg.Audio.FastForwardVolume != nil && !explicit["ffvolume"] {
+		o.ffVolume = *cfg.Audio.FastForwardVolume
+	}
+
+	if cfg.General.Region != "" && !explicit["region"] {
+		o.region = cfg.General.Region
+	}
+
+	if cfg.Achievements.Hardcore && !explicit["hardcore"] {
+		o.hardcore = true
+	}
+
+	if cfg.Display.ScaleMode != "" && !explicit["scalemode"] {
+		o.scaleMode = cfg.Display.ScaleMode
+	}
+
+	if cfg.Display.Filter != "" && !explicit["filter"] {
+		o.filter = cfg.Display.Filter
+	}
+
+	if cfg.Display.PixelAspect && !explicit["pixelaspect"] {
+		o.pixelAspect = true
+	}
+
+	if cfg.Display.Overlay != "" && !explicit["overlay"] {
+		o.overlay = cfg.Display.Overlay
+	}
+
+	if cfg.Display.Shader != "" && !explicit["shader"] {
+		o.shader = cfg.Display.Shader
+	}
+
+	if cfg.Display.Palette != "" && !explicit["palette"] {
+		o.palette = cfg.Display.Palette
+	}
+
+	if cfg.Display.Bezel != "" && !explicit["bezel"] {
+		o.bezel = cfg.Display.Bezel
+	}
+
+	if cfg.Paths.StateDir != "" && !explicit["statedir"] {
+		o.stateDir = cfg.Paths.StateDir
+	}
+
+	if cfg.Paths.ScreenshotDir != "" && !explicit["screenshotdir"] {
+		o.screenshotDir = cfg.Paths.ScreenshotDir
+	}
+
+	if cfg.Paths.GameDB != "" && !explicit["gamedb"] {
+		o.gameDB = cfg.Paths.GameDB
+	}
+
+	if cfg.Paths.FDSBIOS != "" && !explicit["fdsbios"] {
+		o.fdsBIOS = cfg.Paths.FDSBIOS
+	}
+
+	o.config = cfg
+}
+
+// explicitFlags returns the names of the flags set on the command line.
+func (o *options) explicitFlags() map[string]bool {
+	explicit := make(map[string]bool)
+	o.flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	return explicit
+}
+
+// forGame returns a copy of the options with the overrides of the game from the
+// config applied, unless the corresponding flags were set on the command line.
+// The copy is only used while the game is running, so that the next game given
+// with the control API starts from the global settings again.
+func (o *options) forGame(rom *ines.ROM) *options {
+	gc, ok := o.config.gameConfig(rom.CRC32, o.romName())
+	if !ok {
+		return o
+	}
+
+	var (
+		game     = *o
+		explicit = o.explicitFlags()
+	)
+
+	setBool := func(name string, dst *bool, v *bool) {
+		if v != nil && !explicit[name] {
+			*dst = *v
+		}
+	}
+
+	setString := func(name string, dst *string, v string) {
+		if v != "" && !explicit[name] {
+			*dst = v
+		}
+	}
+
+	setBool("nospritelimit", &game.noSpriteLimit, gc.NoSpriteLimit)
+	setBool("runahead", &game.runAhead, gc.RunAhead)
+	setBool("pixelaspect", &game.pixelAspect, gc.PixelAspect)
+	setString("scalemode", &game.scaleMode, gc.ScaleMode)
+	setString("filter", &game.filter, gc.Filter)
+	setString("overlay", &game.overlay, gc.Overlay)
+	setString("shader", &game.shader, gc.Shader)
+	setString("palette", &game.palette, gc.Palette)
+	setString("region", &game.region, gc.Region)
+	setString("bezel", &game.bezel, gc.Bezel)
+	setString("inputprofile", &game.inputProfile, gc.InputProfile)
+
+	if gc.FrameSkip != nil && !explicit["frameskip"] {
+		game.frameSkip = *gc.FrameSkip
+	}
+
+	log.Printf("[INFO] applied the game settings from the config")
+	game.sanitize()
+
+	return &game
+}
+
+// gameConfig finds the overrides of the game by the ROM checksum, or by the
+// file name if there are none for the checksum.
+func (c *config) gameConfig(crc uint32, romName string) (gameConfig, bool) {
+	hash := fmt.Sprintf("%08X", crc)
+
+	for key, gc := range c.Games {
+		if strings.EqualFold(key, hash) {
+			return gc, true
+		}
+	}
+
+	gc, ok := c.Games[romName]
+
+	return gc, ok
+}
+
+// hudLayout converts the HUD settings from the config, skipping the invalid ones.
+func (c *config) hudLayout() ui.HUDLayout {
+	layout := ui.DefaultHUDLayout()
+
+	for name, hc := range c.HUD {
+		e, ok := layout[name]
+		if !ok {
+			log.Printf("[WARN] unknown hud element in config: %s", name)
+			continue
+		}
+
+		if hc.Position != "" {
+			pos, err := ui.ParseHUDPosition(hc.Position)
+			if err != nil {
+				log.Printf("[WARN] %s, using the default for %s", err, name)
+			} else {
+				e.Position = pos
+			}
+		}
+
+		if hc.Scale > 0 {
+			e.Scale = min(hc.Scale, maxHUDScale)
+		}
+
+		if hc.Visible != nil {
+			e.Hidden = !*hc.Visible
+		}
+
+		layout[name] = e
+	}
+
+	return layout
+}
+
+// save writes the config, which holds the passwords and the keys of the cloud
+// sync and RetroAchievements, so it is only readable by the user. The file is
+// written through the temporary one, which also fixes the permissions of the
+// file written by the older versions with 0644.
+func (c *config) save() {
+	if c.filename == "" {
+		return
+	}
+
+	// The RetroAchievements password is only needed to obtain the token, and is
+	// never written back once there is one.
+	if c.Achievements.Token != "" {
+		c.Achievements.Password = ""
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := toml.NewEncoder(buf).Encode(c); err != nil {
+		log.Printf("[ERROR] failed to encode config: %s", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.filename), 0700); err != nil {
+		log.Printf("[ERROR] failed to create config directory: %s", err)
+		return
+	}
+
+	if err := writeConfigFile(c.filename, buf.Bytes()); err != nil {
+		log.Printf("[ERROR] failed to save config: %s", err)
+	}
+}
+
+// writeConfigFile replaces the file with the data, the same way saveState does,
+// so that the config is never left half-written.
+func writeConfigFile(filename string, data []byte) (err error) {
+	tmpFile := filename + ".tmp"
+
+	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmpFile)
+		}
+	}()
+
+	// The mode is only applied to the new files, not the one left behind by
+	// the failed write.
+	err = f.Chmod(0600)
+	if err == nil {
+		_, err = f.Write(data)
+	}
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	// The file must be closed before it is renamed, as Windows does not allow
+	// renaming the open files.
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, filename)
+}
+
+// bezelCutout converts the bezel cutout from the config. An empty rectangle is
+// returned if it is not set or invalid, so that the cutout is detected instead.
+func (c *config) bezelCutout() image.Rectangle {
+	cutout := c.Display.BezelCutout
+	if len(cutout) == 0 {
+		return image.Rectangle{}
+	}
+
+	if len(cutout) != 4 || cutout[2] <= 0 || cutout[3] <= 0 {
+		log.Printf("[WARN] bezel_cutout must be [x, y, width, height], detecting the cutout instead")
+		return image.Rectangle{}
+	}
+
+	return image.Rect(cutout[0], cutout[1], cutout[0]+cutout[2], cutout[1]+cutout[3])
+}
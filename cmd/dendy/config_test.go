@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// The config holds the passwords, so it is only readable by the user, including
+// the one written by the older versions with 0644.
+func TestConfig_SavePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix permissions on windows")
+	}
+
+	dir := filepath.Join(t.TempDir(), "dendy")
+	filename := filepath.Join(dir, "config.toml")
+
+	cfg := defaultConfig()
+	cfg.filename = filename
+	cfg.Achievements.Token = "token"
+	cfg.save()
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, info.Mode().Perm(), os.FileMode(0700))
+
+	if err := os.Chmod(filename, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.save()
+
+	info, err = os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+
+	var saved config
+	if _, err := toml.DecodeFile(filename, &saved); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, saved.Achievements.Token, "token")
+
+	_, err = os.Stat(filename + ".tmp")
+	testutil.Equal(t, os.IsNotExist(err), true)
+}
+
+// The RetroAchievements password is not saved once there is the token.
+func TestConfig_SaveAchievementsToken(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.toml")
+
+	cfg := defaultConfig()
+	cfg.filename = filename
+	cfg.Achievements.Password = "password"
+	cfg.save()
+
+	var saved config
+	if _, err := toml.DecodeFile(filename, &saved); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, saved.Achievements.Password, "password")
+
+	cfg.Achievements.Token = "token"
+	cfg.save()
+
+	saved = config{}
+	if _, err := toml.DecodeFile(filename, &saved); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, saved.Achievements.Password, "")
+	testutil.Equal(t, saved.Achievements.Token, "token")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/control"
+	"github.com/maxpoletaev/dendy/ppu"
+	"github.com/maxpoletaev/dendy/system"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+// startControlAPI starts the control API selected with the -api flag, or
+// returns nil if there is none. Exits if the address cannot be listened on.
+func startControlAPI(opts *options) *control.Server {
+	if opts.apiAddr == "" {
+		return nil
+	}
+
+	server, err := control.Listen(opts.apiAddr)
+	if err != nil {
+		log.Printf("[ERROR] failed to start control api: %s", err)
+		os.Exit(1)
+	}
+
+	log.Printf("[INFO] control api listening on %s, token: %s", opts.apiAddr, server.Token())
+
+	return server
+}
+
+// controlTarget is the offline emulator, as seen by the control API. The state
+// functions go through the window delegates, so that they behave the same way
+// as the hotkeys and the save slot menu.
+type controlTarget struct {
+	nes    *system.System
+	joy    *input.Joystick
+	w      *ui.Window
+	opts   *options
+	paused func() bool
+
+	nextROM string // the game to restart with, once the loop has ended
+
+	// Buttons pressed on behalf of the API, held for the number of frames.
+	buttons uint8
+	frames  int
+}
+
+func (t *controlTarget) Status() control.Status {
+	return control.Status{
+		ROM:    t.opts.romFile,
+		Game:   t.opts.gameName,
+		Paused: t.paused(),
+		Frame:  t.nes.FrameCount(),
+	}
+}
+
+func (t *controlTarget) SetPaused(paused bool) {
+	if paused != t.paused() {
+		t.w.PauseDelegate()
+	}
+}
+
+// LoadROM checks that the ROM can be loaded, and ends the game loop, so that
+// the current game is saved as usual before the next one is started.
+func (t *controlTarget) LoadROM(filename string) error {
+	rom, err := ines.NewFromFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ines.NewCartridge(rom); err != nil {
+		return err
+	}
+
+	t.nextROM = filename
+
+	return nil
+}
+
+func (t *controlTarget) checkSlot(slot int) error {
+	if t.w.SaveSlotDelegate == nil {
+		return errors.New("save states are disabled")
+	}
+
+	if slot < 1 || slot > numSaveSlots {
+		return fmt.Errorf("slot must be from 1 to %d", numSaveSlots)
+	}
+
+	return nil
+}
+
+func (t *controlTarget) SaveState(slot int) error {
+	if err := t.checkSlot(slot); err != nil {
+		return err
+	}
+
+	return t.w.SaveSlotDelegate(slot - 1)
+}
+
+func (t *controlTarget) LoadState(slot int) error {
+	if err := t.checkSlot(slot); err != nil {
+		return err
+	}
+
+	if slots := t.w.ListSlotsDelegate(); slots[slot-1].Empty {
+		return fmt.Errorf("slot %d is empty", slot)
+	}
+
+	return t.w.LoadSlotDelegate(slot - 1)
+}
+
+func (t *controlTarget) ReadMemory(addr uint16, length int) []uint8 {
+	data := make([]uint8, length)
+
+	for i := range data {
+		data[i] = t.nes.Peek(addr + uint16(i))
+	}
+
+	return data
+}
+
+func (t *controlTarget) PressButtons(buttons []string, frames int) error {
+	var pressed uint8
+
+	for _, name := range buttons {
+		found := false
+
+		for _, b := range ui.ButtonNames {
+			if strings.EqualFold(b.Name, name) {
+				pressed |= b.Button
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("unknown button: %q", name)
+		}
+	}
+
+	if frames < 1 {
+		return errors.New("frames must be positive")
+	}
+
+	t.buttons, t.frames = pressed, frames
+
+	return nil
+}
+
+func (t *controlTarget) Frame() ([]color.RGBA, int, int) {
+	return t.nes.Frame(), ppu.FrameWidth, ppu.FrameHeight
+}
+
+// applyButtons presses the buttons on top of the ones read from the keyboard
+// and the gamepad. Called once per frame, after the joystick is updated.
+func (t *controlTarget) applyButtons() {
+	if t.frames > 0 {
+		t.joy.SetButtons(t.joy.Buttons() | t.buttons)
+		t.frames--
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"runtime/debug"
+
+	"github.com/maxpoletaev/dendy/internal/crash"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// crashTraceSize is the number of the last executed instructions kept in
+// memory for the crash bundle.
+const crashTraceSize = 500
+
+// enableCrashTrace starts keeping the instructions for the crash bundle.
+func enableCrashTrace(nes *system.System) {
+	nes.SetTraceSize(crashTraceSize)
+}
+
+// recoverCrash writes the crash bundle into the state directory, or next to the
+// ROM, when the emulator panics, and panics again. Must be deferred directly,
+// for recover to work.
+func recoverCrash(nes *system.System, opts *options) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	report := &crash.Report{
+		Panic:   v,
+		Stack:   debug.Stack(),
+		System:  nes,
+		ROMFile: opts.romFile,
+	}
+
+	dir := opts.stateDir
+	if dir == "" {
+		dir = filepath.Dir(opts.romFile)
+	}
+
+	if bundle, err := crash.WriteBundle(dir, report); err != nil {
+		log.Printf("[ERROR] failed to write crash bundle: %s", err)
+	} else {
+		log.Printf("[ERROR] emulator crashed, crash bundle saved: %s", bundle)
+		log.Printf("[INFO] to start from the crash, run with -loadstate=%s", filepath.Join(bundle, crash.StateFile))
+	}
+
+	panic(v)
+}
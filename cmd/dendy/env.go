@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+)
+
+const envPrefix = "DENDY_"
+
+// envNames are the environment variables of the flags whose names are too
+// short to make sense on their own, such as DENDY_LISTEN_ADDR for -listen.
+var envNames = map[string]string{
+	"listen":  "LISTEN_ADDR",
+	"connect": "CONNECT_ADDR",
+	"relay":   "RELAY_ADDR",
+	"api":     "API_ADDR",
+	"v":       "VERBOSE",
+}
+
+// envName returns the environment variable of the flag, e.g. DENDY_SCALE for
+// -scale.
+func envName(flagName string) string {
+	if name, ok := envNames[flagName]; ok {
+		return envPrefix + name
+	}
+
+	return envPrefix + strings.ToUpper(flagName)
+}
+
+// applyEnv sets the flags not given on the command line from the environment
+// variables, so that they take precedence over the config file the same way.
+// Exits if the value is invalid, the same as with an invalid flag.
+func applyEnv(fs *flag.FlagSet) {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] {
+			return
+		}
+
+		name := envName(f.Name)
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+
+		if err := fs.Set(f.Name, value); err != nil {
+			log.Printf("[ERROR] invalid value of %s: %s", name, err)
+			os.Exit(1)
+		}
+	})
+}
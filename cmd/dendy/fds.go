@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/system"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+const fdsBIOSFile = "disksys.rom"
+
+// loadFDSBIOS reads the FDS BIOS passed with the -fdsbios flag or found in the
+// config directory, which is needed to run the disk images. It is only needed
+// for such games, so the missing default file is not reported here, but when
+// the disk image is opened.
+func loadFDSBIOS(opts *options) {
+	filename := opts.fdsBIOS
+
+	if filename == "" {
+		configFile, err := configFile()
+		if err != nil {
+			return
+		}
+
+		filename = filepath.Join(filepath.Dir(configFile), fdsBIOSFile)
+
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			return
+		}
+	}
+
+	bios, err := os.ReadFile(filename)
+	if err != nil {
+		log.Printf("[WARN] failed to load fds bios: %s", err)
+		return
+	}
+
+	if len(bios) != 0x2000 {
+		log.Printf("[WARN] ignoring fds bios of %d bytes, expected 8192", len(bios))
+		return
+	}
+
+	ines.FDSBIOS = bios
+}
+
+// setupDiskDrive switches the side of the disk with the hotkey. The games tell
+// which side to insert, and wait for the disk to be ejected first.
+func setupDiskDrive(w *ui.Window, nes *system.System) {
+	w.DiskSideDelegate = func() {
+		drive, ok := ines.AsDiskDrive(nes.Cartridge())
+		if !ok {
+			return
+		}
+
+		side := drive.SwitchSide()
+		w.ShowMessage("Disk %d side %c", side/2+1, 'A'+side%2)
+		log.Printf("[INFO] switching to disk side %d of %d", side+1, drive.Sides())
+	}
+}
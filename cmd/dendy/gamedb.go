@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/maxpoletaev/dendy/gamedb"
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+const gameDBFile = "gamedb.dat"
+
+// loadGameDB reads the game database passed with the -gamedb flag or found in
+// the config directory. The database is optional, so the missing default file
+// is not reported.
+func loadGameDB(opts *options) *gamedb.DB {
+	filename := opts.gameDB
+
+	if filename == "" {
+		configFile, err := configFile()
+		if err != nil {
+			return nil
+		}
+
+		filename = filepath.Join(filepath.Dir(configFile), gameDBFile)
+
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			return nil
+		}
+	}
+
+	db, err := gamedb.Load(filename)
+	if err != nil {
+		log.Printf("[WARN] failed to load game database: %s", err)
+		return nil
+	}
+
+	log.Printf("[INFO] loaded %d games from %s", db.Len(), filename)
+
+	return db
+}
+
+// lookupGame finds the loaded ROM in the game database and returns its name
+// along with the region, or an empty string if the game is unknown.
+func lookupGame(rom *ines.ROM, opts *options) string {
+	game, ok := loadGameDB(opts).Lookup(rom.CRC32)
+	if !ok {
+		return ""
+	}
+
+	log.Printf("[INFO] game: %s", game)
+
+	return game.String()
+}
+
+// setGameTitle puts the name of the game into the window title and shows it on
+// the screen when the game starts.
+func setGameTitle(w *ui.Window, opts *options, suffix string) {
+	w.SetTitle(opts.title(suffix))
+
+	if opts.gameName != "" {
+		w.ShowMessage("%s", opts.gameName)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/maxpoletaev/dendy/consts"
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/recorder"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// runHeadless runs the emulation without a window or audio output, as fast as
+// possible. It stops after the number of frames set with -frames, or when
+// interrupted. Recording with -video, it can be used to render videos on a
+// server, or to verify that a game still runs the same way in CI.
+func runHeadless(cart ines.Cartridge, opts *options, saveFile string) {
+	joy1 := input.NewJoystick()
+	zapper := input.NewZapper()
+
+	nes := system.New(cart, joy1, zapper)
+	nes.SetNoSpriteLimit(opts.noSpriteLimit)
+	nes.SetRegion(opts.consoleRegion(cart.ROM()))
+	applyPalette(nes, opts)
+	enableCrashTrace(nes)
+
+	defer saveSRAM(cart, opts.sramFile)
+	defer recoverCrash(nes, opts)
+
+	if loadFile, explicit := opts.startupStateFile(saveFile); loadFile != "" {
+		loadStartupState(nes, loadFile, explicit)
+	}
+
+	if opts.recordInput == "" {
+		loadCheats(nes, opts)
+	}
+
+	scr := loadScript(nes, joy1, opts, nil)
+	if scr != nil {
+		defer scr.Close()
+	}
+
+	var rec *recorder.Recorder
+
+	if opts.record != "" {
+		var err error
+
+		if rec, err = startRecording(opts.record); err != nil {
+			log.Printf("[ERROR] failed to start recording: %s", err)
+			os.Exit(1)
+		}
+
+		defer stopRecording(rec)
+	}
+
+	replayRec := startReplay(nes, opts)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	var (
+		frames      int
+		ticks       int
+		nextSample  int
+		sampleClock system.SampleClock
+		audioBuffer = make([]float32, 0, consts.AudioBufferSize)
+		start       = time.Now()
+	)
+
+gameloop:
+	for opts.frames == 0 || frames < opts.frames {
+		nes.Tick()
+		ticks++
+
+		// The samples are only needed for the recording.
+		if rec != nil && ticks >= nextSample {
+			nextSample += sampleClock.Next()
+			audioBuffer = append(audioBuffer, nes.AudioSample())
+
+			if len(audioBuffer) == cap(audioBuffer) {
+				rec.WriteAudio(audioBuffer)
+				audioBuffer = audioBuffer[:0]
+			}
+		}
+
+		if nes.FrameReady() {
+			recordReplayFrame(replayRec, joy1.Buttons())
+			frames++
+			opts.metrics.frame()
+			opts.frameTimer.frame()
+
+			if scr != nil {
+				scr.Frame()
+
+				if scr.ExitRequested() {
+					break gameloop
+				}
+			}
+
+			if rec != nil {
+				rec.WriteFrame(nes.Frame())
+
+				if opts.recordFrames > 0 && rec.Frames() >= opts.recordFrames {
+					break gameloop
+				}
+			}
+
+			select {
+			case <-interrupt:
+				break gameloop
+			default:
+			}
+		}
+	}
+
+	elapsed := time.Since(start)
+	if replayRec != nil {
+		saveReplay(replayRec, opts)
+	}
+
+	log.Printf("[INFO] emulated %d frames in %s (%.0f fps)", frames, elapsed.Round(time.Millisecond), float64(frames)/elapsed.Seconds())
+
+	if !opts.noSave {
+		if err := saveState(nes, saveFile); err != nil {
+			log.Printf("[ERROR] failed to save state: %s", err)
+			os.Exit(1)
+		}
+
+		log.Printf("[INFO] state saved: %s", saveFile)
+	}
+}
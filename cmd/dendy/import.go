@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/loglevel"
+	"github.com/maxpoletaev/dendy/stateimport"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+const importUsage = "usage: dendy import [-o=savefile] [-force] romfile statefile"
+
+// runImport runs the "import" subcommand, which converts the state saved by
+// FCEUX or Mesen into the save file of the game, loaded when it is started the
+// next time.
+func runImport(args []string) {
+	var (
+		outFile string
+		force   bool
+	)
+
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, importUsage); fs.PrintDefaults() }
+	fs.StringVar(&outFile, "o", "", "save file to write (default: next to the rom, as the game saves it)")
+	fs.BoolVar(&force, "force", false, "overwrite the existing save file")
+
+	_ = fs.Parse(args) // exits on error
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	log.Default().SetFlags(0)
+	log.Default().SetOutput(loglevel.New(os.Stderr, loglevel.LevelWarn))
+
+	romFile, stateFile := fs.Arg(0), fs.Arg(1)
+
+	if outFile == "" {
+		outFile = strings.TrimSuffix(romFile, filepath.Ext(romFile)) + ".save"
+	}
+
+	if err := importState(romFile, stateFile, outFile, force); err != nil {
+		log.Printf("[ERROR] failed to import %s: %s", stateFile, err)
+		os.Exit(1)
+	}
+}
+
+func importState(romFile, stateFile, outFile string, force bool) error {
+	if _, err := os.Stat(outFile); err == nil && !force {
+		return fmt.Errorf("%s already exists, use -force to overwrite it", outFile)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	rom, err := ines.NewFromFile(romFile)
+	if err != nil {
+		return err
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		return err
+	}
+
+	st, format, err := stateimport.ReadFile(stateFile, rom)
+	if err != nil {
+		return err
+	}
+
+	// The devices are the same as in the offline mode, which only loads the
+	// states made with them.
+	nes := system.New(cart, input.NewJoystick(), input.NewZapper())
+	nes.Import(st)
+
+	f, err := os.Create(outFile)
+	if err != nil {
+		return err
+	}
+
+	if err := errors.Join(nes.WriteStateFile(f), f.Close()); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported the %s state into %s\n", format, outFile)
+
+	return nil
+}
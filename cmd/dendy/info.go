@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/internal/loglevel"
+)
+
+const infoUsage = "usage: dendy info [-json] romfile"
+
+var mirrorNames = map[ines.MirrorMode]string{
+	ines.MirrorHorizontal: "horizontal",
+	ines.MirrorVertical:   "vertical",
+	ines.MirrorSingle0:    "single-screen",
+	ines.MirrorSingle1:    "single-screen",
+}
+
+// romInfo is what the "info" subcommand reports about the ROM. The sizes are in
+// bytes and the checksums are in upper-case hex.
+type romInfo struct {
+	File       string `json:"file"`
+	Format     string `json:"format"`
+	Mapper     int    `json:"mapper"`
+	Submapper  int    `json:"submapper,omitempty"`
+	MapperName string `json:"mapper_name,omitempty"`
+	PRGSize    int    `json:"prg_size"`
+	CHRSize    int    `json:"chr_size"`
+	CHRRAM     bool   `json:"chr_ram"`
+	PRGRAMSize int    `json:"prg_ram_size"`
+	PRGNVRAM   int    `json:"prg_nvram_size,omitempty"` // battery-backed
+	Mirroring  string `json:"mirroring"`
+	Battery    bool   `json:"battery"`
+	Trainer    bool   `json:"trainer"`
+	Region     string `json:"region"`
+	PlayChoice bool   `json:"playchoice,omitempty"` // a PlayChoice-10 dump
+	DiskSides  int    `json:"disk_sides,omitempty"` // FDS only
+	Fixed      bool   `json:"fixed,omitempty"`      // the header is fixed from the rom database
+	CRC32      string `json:"crc32"`
+	PRGCRC32   string `json:"prg_crc32"`
+	PRGSHA1    string `json:"prg_sha1"`
+	CHRCRC32   string `json:"chr_crc32,omitempty"`
+	CHRSHA1    string `json:"chr_sha1,omitempty"`
+	Game       string `json:"game,omitempty"`
+	Supported  bool   `json:"supported"`
+	Error      string `json:"error,omitempty"` // why it is not supported
+}
+
+// runInfo runs the "info" subcommand, which prints what the header of the ROM
+// says and whether the mapper is supported, to check the dump before reporting
+// that a game does not work.
+func runInfo(args []string) {
+	var jsonOutput bool
+
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, infoUsage); fs.PrintDefaults() }
+	fs.BoolVar(&jsonOutput, "json", false, "print the info as json")
+
+	_ = fs.Parse(args) // exits on error
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	log.Default().SetFlags(0)
+	log.Default().SetOutput(loglevel.New(os.Stderr, loglevel.LevelWarn))
+
+	romFile := fs.Arg(0)
+	loadFDSBIOS(&options{})
+	loadROMDB()
+
+	rom, err := ines.NewFromFile(romFile)
+	if err != nil {
+		log.Printf("[ERROR] failed to open rom file: %s", err)
+		os.Exit(1)
+	}
+
+	info := readROMInfo(romFile, rom)
+
+	if jsonOutput {
+		printJSON(info)
+	} else {
+		printROMInfo(info)
+	}
+
+	if !info.Supported {
+		os.Exit(1)
+	}
+}
+
+func readROMInfo(romFile string, rom *ines.ROM) *romInfo {
+	info := &romInfo{
+		File:       romFile,
+		Format:     "iNES",
+		Mapper:     int(rom.MapperID),
+		MapperName: rom.MapperName(),
+		PRGSize:    len(rom.PRG),
+		CHRSize:    len(rom.CHR),
+		CHRRAM:     rom.CHRRAM(),
+		PRGRAMSize: rom.PRGRAMSize + rom.PRGNVRAMSize,
+		PRGNVRAM:   rom.PRGNVRAMSize,
+		Mirroring:  mirrorNames[rom.MirrorMode],
+		Battery:    rom.Battery,
+		Trainer:    rom.Trainer,
+		Region:     rom.Region.String(),
+		PlayChoice: rom.PlayChoice,
+		Fixed:      rom.Fixed,
+		CRC32:      fmt.Sprintf("%08X", rom.CRC32),
+		PRGCRC32:   fmt.Sprintf("%08X", crc32.ChecksumIEEE(rom.PRG)),
+		PRGSHA1:    fmt.Sprintf("%X", sha1.Sum(rom.PRG)),
+	}
+
+	if rom.NES2 {
+		info.Format = "NES 2.0"
+		info.Submapper = int(rom.Submapper)
+	}
+
+	if rom.FourScreen {
+		info.Mirroring = "four-screen"
+	}
+
+	if rom.Disk != nil {
+		info.Format = "FDS"
+		info.DiskSides = len(rom.Disk)
+	}
+
+	if !rom.CHRRAM() {
+		info.CHRCRC32 = fmt.Sprintf("%08X", crc32.ChecksumIEEE(rom.CHR))
+		info.CHRSHA1 = fmt.Sprintf("%X", sha1.Sum(rom.CHR))
+	}
+
+	if game, ok := loadGameDB(&options{}).Lookup(rom.CRC32); ok {
+		info.Game = game.String()
+	}
+
+	// The cartridge is created the same way as when the game is started, so
+	// that anything else that prevents it from running is reported too.
+	if _, err := ines.NewCartridge(rom); err != nil {
+		info.Error = err.Error()
+	} else {
+		info.Supported = true
+	}
+
+	return info
+}
+
+func printROMInfo(info *romInfo) {
+	mapper := fmt.Sprintf("%d", info.Mapper)
+	if info.Format == "NES 2.0" {
+		mapper += fmt.Sprintf(".%d", info.Submapper)
+	}
+
+	if info.MapperName != "" {
+		mapper += " (" + info.MapperName + ")"
+	}
+
+	fmt.Printf("File:       %s\n", info.File)
+	fmt.Printf("Format:     %s\n", info.Format)
+	fmt.Printf("Mapper:     %s\n", mapper)
+	fmt.Printf("PRG-ROM:    %d KB\n", info.PRGSize/1024)
+
+	if info.CHRRAM {
+		fmt.Printf("CHR-RAM:    %d KB\n", info.CHRSize/1024)
+	} else {
+		fmt.Printf("CHR-ROM:    %d KB\n", info.CHRSize/1024)
+	}
+
+	if info.PRGNVRAM > 0 {
+		fmt.Printf("PRG-RAM:    %d KB (%d KB battery-backed)\n", info.PRGRAMSize/1024, info.PRGNVRAM/1024)
+	} else {
+		fmt.Printf("PRG-RAM:    %d KB\n", info.PRGRAMSize/1024)
+	}
+
+	fmt.Printf("Mirroring:  %s\n", info.Mirroring)
+	fmt.Printf("Battery:    %s\n", yesNo(info.Battery))
+	fmt.Printf("Trainer:    %s\n", yesNo(info.Trainer))
+	fmt.Printf("Region:     %s\n", info.Region)
+
+	if info.PlayChoice {
+		fmt.Printf("System:     PlayChoice-10\n")
+	}
+
+	if info.DiskSides > 0 {
+		fmt.Printf("Disk sides: %d\n", info.DiskSides)
+	}
+
+	if info.Fixed {
+		fmt.Printf("Header:     fixed from the ROM database\n")
+	}
+
+	fmt.Printf("CRC32:      %s (PRG+CHR)\n", info.CRC32)
+	fmt.Printf("PRG CRC32:  %s\n", info.PRGCRC32)
+	fmt.Printf("PRG SHA1:   %s\n", info.PRGSHA1)
+
+	if info.CHRCRC32 != "" {
+		fmt.Printf("CHR CRC32:  %s\n", info.CHRCRC32)
+		fmt.Printf("CHR SHA1:   %s\n", info.CHRSHA1)
+	}
+
+	if info.Game != "" {
+		fmt.Printf("Game:       %s\n", info.Game)
+	}
+
+	if !info.Supported {
+		fmt.Printf("Supported:  no, %s\n", info.Error)
+		return
+	}
+
+	fmt.Printf("Supported:  yes\n")
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+
+	return "no"
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// printJSON prints the result of the subcommand selected with the -json flag,
+// for the scripts to parse instead of the text output. The errors that prevent
+// the subcommand from running are still logged, with the non-zero exit code.
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		log.Printf("[ERROR] failed to encode json: %s", err)
+		os.Exit(1)
+	}
+}
@@ -7,11 +7,18 @@ import (
 	"os"
 	"path/filepath"
 	"runtime/pprof"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/maxpoletaev/dendy/consts"
 	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/internal/control"
 	"github.com/maxpoletaev/dendy/internal/loglevel"
+	"github.com/maxpoletaev/dendy/ppu"
+	"github.com/maxpoletaev/dendy/shaders"
+	"github.com/maxpoletaev/dendy/system"
+	"github.com/maxpoletaev/dendy/ui"
 )
 
 const (
@@ -20,11 +27,38 @@ const (
 
 type options struct {
 	scale         int
+	scaleMode     string
+	filter        string
+	pixelAspect   bool
+	fullscreen    bool
+	vsync         bool
 	noSpriteLimit bool
+	ffSpeed       int
+	ffVolume      int // percent of the volume while fast-forwarding
+	runAhead      bool
+	frameSkip     int
+	region        string // one of regionNames
 	saveFile      string
 	noSave        bool
+	autoSave      int
+	loadState     string
+	stateDir      string
+	watch         bool
+	watchState    string
+	script        string
+	cheats        string
+	cheatFile     string
+	watchFile     string // romname.wch
+	sramFile      string // romname.sav, not kept for the netplay games
+	hardcore      bool
+	apiAddr       string
+	api           *control.Server // started when apiAddr is set
+	pprofAddr     string
+	metrics       *debugMetrics // published when pprofAddr is set
+	frameTimer    *frameTimer   // logged with -vv
 	showFPS       bool
-	verbose       bool
+	showPerf      bool
+	verbosity     verbosity
 	disasm        string
 	memprof       string
 	cpuprof       string
@@ -32,38 +66,183 @@ type options struct {
 	mute          bool
 	noLogo        bool
 	noCRT         bool
+	shader        string
+	palette       string
+	bezel         string
+	inputProfile  string
+	overlay       string
+	screenshotDir string
+	romFile       string
+	record        string
+	recordFrames  int
+	recordInput   string
+	powerOn       bool
+	gifSeconds    int
+	headless      bool
+	terminal      bool
+	frames        int
+	gameDB        string
+	fdsBIOS       string
+	patch         string // applied to the rom given on the command line
+	noROMDB       bool
+	gameName      string // from the game database, empty if unknown
+	config        *config
+	command       string        // one of the cmd constants
+	flags         *flag.FlagSet // of the command, to tell the flags given explicitly
+
+	connectAddr    string
+	listenAddr     string
+	relayAddr      string
+	joinRoom       string
+	createRoom     bool
+	connectTimeout time.Duration
+	listenTimeout  time.Duration
+	retries        int
+}
+
+// The subcommands that play the game. The rest are dispatched in main before
+// the window is created.
+const (
+	cmdRun    = "run"
+	cmdRecord = "record"
+	cmdHost   = "host"
+	cmdJoin   = "join"
+)
 
-	connectAddr string
-	listenAddr  string
-	relayAddr   string
-	joinRoom    string
-	createRoom  bool
-}
-
-func (o *options) parse() *options {
-	flag.IntVar(&o.scale, "scale", 2, "scale factor (default: 2)")
-	flag.StringVar(&o.saveFile, "savefile", "", "save file (default: romname.save)")
-	flag.BoolVar(&o.noSpriteLimit, "nospritelimit", false, "disable sprite limit (eliminates flickering)")
-	flag.BoolVar(&o.noSave, "nosave", false, "disable save states")
-	flag.BoolVar(&o.showFPS, "showfps", false, "show fps counter")
-	flag.BoolVar(&o.mute, "mute", false, "disable apu emulation")
-	flag.BoolVar(&o.noLogo, "nologo", false, "do not print logo")
-	flag.BoolVar(&o.noCRT, "nocrt", false, "disable CRT effect")
-
-	flag.StringVar(&o.protocol, "protocol", "tcp", "netplay protocol (tcp, udp)")
-	flag.StringVar(&o.listenAddr, "listen", "", "netplay listen address")
-	flag.StringVar(&o.connectAddr, "connect", "", "netplay connect address")
-	flag.StringVar(&o.relayAddr, "relay", consts.DefaultRelayAddr, "relay server address")
-	flag.BoolVar(&o.createRoom, "createroom", false, "create new punlic session")
-	flag.StringVar(&o.joinRoom, "joinroom", "", "join public session by id")
+const commandsUsage = `usage: dendy [command] [flags] [romfile]
+
+commands:
+  run        play the game offline, the default when no command is given
+  record     play the game while recording a video or a replay of the input
+  host       host a network multiplayer game
+  join       join a network multiplayer game
+  info       print the ROM header and whether its mapper is supported
+  recent     list the recently played games, or start one by its number
+  bench      measure the emulation speed
+  replay     verify a replay recorded with 'dendy record -input'
+  testsuite  run a directory of test ROMs
+
+flags of the command:`
+
+const envUsage = `
+the flags can also be set with the DENDY_<FLAG> environment variables, e.g.
+DENDY_SCALE=3 or DENDY_HEADLESS=true, and DENDY_LISTEN_ADDR, DENDY_CONNECT_ADDR,
+DENDY_RELAY_ADDR and DENDY_API_ADDR for the addresses.`
+
+// parse parses the flags of the command, which are also accepted after the ROM
+// file. Each of the commands only has the flags that make sense for it.
+func (o *options) parse(cmd string, args []string) *options {
+	fs := flag.NewFlagSet("dendy "+cmd, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, commandsUsage)
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr, envUsage)
+	}
+
+	fs.IntVar(&o.scale, "scale", 2, "scale factor (default: 2)")
+	fs.StringVar(&o.scaleMode, "scalemode", "fit", "how the picture is fitted into the window (fit, integer, stretch)")
+	fs.StringVar(&o.filter, "filter", "nearest", "how the picture is smoothed when scaled (nearest, sharp-bilinear)")
+	fs.BoolVar(&o.pixelAspect, "pixelaspect", false, "correct 8:7 pixel aspect ratio")
+	fs.BoolVar(&o.fullscreen, "fullscreen", false, "start in fullscreen mode")
+	fs.BoolVar(&o.vsync, "vsync", false, "enable vsync (no tearing, but slightly higher input latency)")
+	fs.StringVar(&o.saveFile, "savefile", "", "save file (default: romname.save)")
+	fs.BoolVar(&o.noSpriteLimit, "nospritelimit", false, "disable sprite limit (eliminates flickering)")
+	fs.BoolVar(&o.noSave, "nosave", false, "disable save states")
+	fs.StringVar(&o.loadState, "loadstate", "", "state to start from, either a save slot number or a path (default: the save file)")
+	fs.StringVar(&o.stateDir, "statedir", "", "directory for the save file and slots (default: next to the rom)")
+	fs.BoolVar(&o.showFPS, "showfps", false, "show fps counter")
+	fs.BoolVar(&o.showPerf, "showperf", false, "show frame time graph and percentiles")
+	fs.BoolVar(&o.mute, "mute", false, "disable apu emulation")
+	fs.BoolVar(&o.noLogo, "nologo", false, "do not print logo")
+	fs.BoolVar(&o.noCRT, "nocrt", false, "disable CRT effect")
+	fs.StringVar(&o.overlay, "overlay", "none", "scanline overlay filter (none, scanlines, grille)")
+	fs.StringVar(&o.screenshotDir, "screenshotdir", "screenshots", "directory to save screenshots to")
+	fs.IntVar(&o.gifSeconds, "gifseconds", 10, "length of gif captures in seconds (0 = disabled)")
+	fs.StringVar(&o.shader, "shader", "scanline", "shader preset (scanline, crt, none) or path to a GLSL fragment shader")
+	fs.StringVar(&o.palette, "palette", "default", "color palette (default, sony-cxa, grayscale) or path to a .pal file")
+	fs.StringVar(&o.bezel, "bezel", "", "PNG image drawn around the picture in fullscreen mode, with a transparent cutout for the game")
+	fs.StringVar(&o.inputProfile, "inputprofile", "", "input profile from the config, e.g. with the buttons swapped or turbo enabled")
+	fs.StringVar(&o.gameDB, "gamedb", "", "game database in the No-Intro DAT format (default: gamedb.dat in the config directory)")
+	fs.StringVar(&o.patch, "patch", "", "IPS or BPS patch to apply to the rom, e.g. a translation (the saves are named after the patch)")
+	fs.BoolVar(&o.noROMDB, "noromdb", false, "do not fix the headers of the known bad dumps from the rom database")
+	fs.StringVar(&o.fdsBIOS, "fdsbios", "", "Famicom Disk System BIOS to run .fds images (default: disksys.rom in the config directory)")
+
+	switch cmd {
+	case cmdRun, cmdRecord:
+		fs.IntVar(&o.ffSpeed, "ffspeed", 4, "fast-forward speed multiplier (0 = as fast as possible)")
+		fs.IntVar(&o.ffVolume, "ffvolume", 100, "volume while fast-forwarding, in percent of the normal one (0 = mute)")
+		fs.BoolVar(&o.runAhead, "runahead", false, "run one frame ahead to reduce input lag (doubles cpu usage)")
+		fs.IntVar(&o.frameSkip, "frameskip", 0, "number of frames to skip after every displayed one (breaks the zapper)")
+		fs.IntVar(&o.autoSave, "autosave", 0, "auto-save every this many minutes into rotating files (0 = disabled)")
+		fs.BoolVar(&o.headless, "headless", false, "run without a window and sound, as fast as possible")
+		fs.StringVar(&o.script, "script", "", "run a Lua script with the FCEUX-style API")
+		fs.StringVar(&o.cheats, "cheat", "", "comma-separated Game Genie or AAAA:VV codes to add to the cheat file")
+		fs.StringVar(&o.cheatFile, "cheatfile", "", "cheat file (default: romname.cht)")
+		fs.StringVar(&o.apiAddr, "api", "", "serve the control API on the address, e.g. 127.0.0.1:7777")
+		fs.BoolVar(&o.hardcore, "hardcore", false, "RetroAchievements hardcore mode, without save states, cheats, rewind, fast-forward and scripts")
+		fs.BoolVar(&o.watch, "watch", false, "reload the rom whenever the file changes, for the homebrew development")
+		fs.StringVar(&o.watchState, "watchstate", "", "state to load after every reload, either a save slot number or a path (default: power on)")
+
+	case cmdHost, cmdJoin:
+		fs.StringVar(&o.protocol, "protocol", "tcp", "netplay protocol (tcp, udp)")
+		fs.StringVar(&o.relayAddr, "relay", consts.DefaultRelayAddr, "relay server address")
+	}
+
+	switch cmd {
+	case cmdRun:
+		fs.BoolVar(&o.terminal, "terminal", false, "draw the picture in the terminal instead of a window (no sound)")
+		fs.IntVar(&o.frames, "frames", 0, "stop after this many frames in headless mode (0 = until interrupted)")
+		fs.StringVar(&o.region, "region", "auto", "timing of the console (auto, ntsc, dendy), auto is dendy for the games marked so in the header")
+
+	case cmdRecord:
+		fs.StringVar(&o.record, "video", "", "record a video into the file using ffmpeg")
+		fs.StringVar(&o.recordInput, "input", "", "record a replay of the inputs into the file, to be checked with 'dendy replay verify'")
+		fs.IntVar(&o.recordFrames, "frames", 0, "stop recording and exit after this many frames (0 = until the window is closed)")
+		fs.BoolVar(&o.powerOn, "poweron", false, "record from power-on instead of the save file, which is not updated on exit either")
+
+	case cmdHost:
+		fs.StringVar(&o.listenAddr, "listen", "0.0.0.0:1234", "address to wait for the other player on")
+		fs.BoolVar(&o.createRoom, "room", false, "create a public room on the relay server instead, for the players behind NAT")
+		fs.DurationVar(&o.listenTimeout, "listentimeout", 0, "give up if the other player has not connected within this time, e.g. 5m (0 = wait forever)")
+
+	case cmdJoin:
+		fs.StringVar(&o.connectAddr, "connect", "", "address of the host")
+		fs.StringVar(&o.joinRoom, "room", "", "join the public room by its id instead")
+		fs.DurationVar(&o.connectTimeout, "connecttimeout", 10*time.Second, "timeout of each attempt to connect to the host (tcp only)")
+		fs.IntVar(&o.retries, "retries", 5, "number of times to retry connecting, waiting longer each time, until the host is up")
+	}
 
 	// Debugging flags.
-	flag.StringVar(&o.cpuprof, "cpuprof", "", "write cpu profile to file")
-	flag.StringVar(&o.memprof, "memprof", "", "write memory profile to file")
-	flag.StringVar(&o.disasm, "disasm", "", "write cpu disassembly to file")
-	flag.BoolVar(&o.verbose, "verbose", false, "enable verbose logging")
+	fs.StringVar(&o.cpuprof, "cpuprof", "", "write cpu profile to file")
+	fs.StringVar(&o.memprof, "memprof", "", "write memory profile to file")
+	fs.StringVar(&o.disasm, "disasm", "", "write cpu disassembly to file")
+	fs.StringVar(&o.pprofAddr, "pprof", "", "serve pprof and expvar metrics on the address, e.g. localhost:6060")
+	fs.Var(verbosityFlag{&o.verbosity, 1}, "v", "verbose logging: debug logs and mapper warnings")
+	fs.Var(verbosityFlag{&o.verbosity, 2}, "vv", "more verbose logging: also raylib logs and frame timing")
+
+	_ = fs.Parse(args) // exits on error
+
+	for fs.NArg() > 0 {
+		if o.romFile != "" {
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		o.romFile = fs.Arg(0)
+		_ = fs.Parse(fs.Args()[1:])
+	}
+
+	applyEnv(fs)
+
+	// The headless mode stops on its own after the number of frames, the same
+	// as when it is not recording.
+	if cmd == cmdRecord {
+		o.frames = o.recordFrames
+	}
+
+	o.command = cmd
+	o.flags = fs
 
-	flag.Parse()
 	return o
 }
 
@@ -71,14 +250,271 @@ func (o *options) sanitize() {
 	if o.scale < 1 {
 		o.scale = 1
 	}
+
+	if o.gifSeconds < 0 {
+		o.gifSeconds = 0
+	}
+
+	if o.ffSpeed < 0 {
+		o.ffSpeed = 0
+	}
+
+	if o.frameSkip < 0 {
+		o.frameSkip = 0
+	}
+
+	o.ffVolume = max(0, min(100, o.ffVolume))
+
+	if o.autoSave < 0 {
+		o.autoSave = 0
+	}
+
+	// Running ahead doubles the emulation cost, which defeats the purpose of
+	// skipping frames on slow hardware.
+	if o.frameSkip > 0 && o.runAhead {
+		log.Printf("[WARN] run-ahead is disabled when skipping frames")
+		o.runAhead = false
+	}
+
+	// Hardcore mode only allows playing the game as is. The game is still saved
+	// on exit, but the save file is not loaded back in this mode, as it would
+	// work as a save state.
+	if o.hardcore {
+		if o.config.Achievements.Username == "" {
+			log.Printf("[WARN] hardcore mode requires a RetroAchievements account in the config")
+			o.hardcore = false
+		} else {
+			if o.loadState != "" || o.script != "" || o.cheats != "" || o.apiAddr != "" {
+				log.Printf("[WARN] save states, cheats, scripts and the control API are disabled in hardcore mode")
+			}
+
+			o.loadState = ""
+			o.script = ""
+			o.cheats = ""
+			o.apiAddr = ""
+		}
+	}
+
+	// The movies recorded from power-on do not depend on the progress saved,
+	// and do not change it.
+	if o.powerOn {
+		if o.loadState != "" {
+			log.Printf("[WARN] the state is not loaded when recording from power-on")
+		}
+
+		o.noSave = true
+		o.loadState = ""
+	}
+
+	// The replays do not include the cheats, so they would not play back the
+	// same way.
+	if o.recordInput != "" && o.cheats != "" {
+		log.Printf("[WARN] cheats are disabled when recording a replay")
+		o.cheats = ""
+	}
+
+	// The replay would not play back once the game has changed under it.
+	if o.watch && (o.recordInput != "" || o.hardcore) {
+		log.Printf("[WARN] -watch is disabled when recording a replay or in hardcore mode")
+		o.watch = false
+	}
+
+	// The script would see the state of the frame emulated ahead, which is
+	// thrown away afterwards.
+	if o.script != "" && o.runAhead {
+		log.Printf("[WARN] run-ahead is disabled when running a script")
+		o.runAhead = false
+	}
+
+	if _, err := ui.ParseScaleMode(o.scaleMode); err != nil {
+		log.Printf("[WARN] %s, falling back to fit", err)
+		o.scaleMode = "fit"
+	}
+
+	if _, err := ui.ParseScaleFilter(o.filter); err != nil {
+		log.Printf("[WARN] %s, falling back to nearest", err)
+		o.filter = "nearest"
+	}
+
+	if _, err := ui.ParseOverlay(o.overlay); err != nil {
+		log.Printf("[WARN] %s, falling back to none", err)
+		o.overlay = "none"
+	}
+
+	if !slices.Contains(regionNames, o.region) {
+		if o.region != "" {
+			log.Printf("[WARN] unknown region %q, falling back to auto", o.region)
+		}
+
+		o.region = "auto"
+	}
+}
+
+// regionNames are the values of the -region flag.
+var regionNames = []string{"auto", "ntsc", "dendy"}
+
+// consoleRegion returns the timing of the console to run the game with. The
+// auto region follows the header, which only has the Dendy timing for the few
+// games made for it, and the PAL games run with the NTSC one, as the PAL timing
+// is not emulated. The videos and the replays are always recorded with NTSC.
+func (o *options) consoleRegion(rom *ines.ROM) ines.Region {
+	if o.record != "" || o.recordInput != "" {
+		return ines.RegionNTSC
+	}
+
+	switch o.region {
+	case "ntsc":
+		return ines.RegionNTSC
+	case "dendy":
+		return ines.RegionDendy
+	default:
+		return rom.Region
+	}
+}
+
+func (o *options) windowOptions() ui.WindowOptions {
+	scaleMode, _ := ui.ParseScaleMode(o.scaleMode) // validated in sanitize()
+	filter, _ := ui.ParseScaleFilter(o.filter)
+	overlay, _ := ui.ParseOverlay(o.overlay)
+
+	return ui.WindowOptions{
+		Scale:       o.scale,
+		ScaleMode:   scaleMode,
+		PixelAspect: o.pixelAspect,
+		Fullscreen:  o.fullscreen,
+		Overlay:     overlay,
+		VSync:       o.vsync,
+		Verbose:     o.verbosity.raylibLogs(),
+		HUD:         o.config.hudLayout(),
+
+		BackgroundInput: o.config.General.BackgroundInput,
+		Filter:          filter,
+
+		ScreenshotDir:    o.screenshotDir,
+		ScreenshotPrefix: o.romName(),
+		CopyScreenshots:  o.config.General.CopyScreenshots,
+	}
+}
+
+// title returns the window title, prefixed with the name of the game if it is
+// found in the database. The suffix is used to tell the netplay players apart.
+func (o *options) title(suffix string) string {
+	title := windowTitle
+	if o.gameName != "" {
+		title = o.gameName + " - " + title
+	}
+
+	if suffix != "" {
+		title += " " + suffix
+	}
+
+	return title
+}
+
+// romName returns the ROM file name without the directory and extension.
+func (o *options) romName() string {
+	return strings.TrimSuffix(filepath.Base(o.romFile), filepath.Ext(o.romFile))
 }
 
 func (o *options) logLevel() loglevel.Level {
-	if o.verbose {
-		return loglevel.LevelDebug
+	return o.verbosity.logLevel()
+}
+
+// shaderSource returns the source code of the shader selected with the -shader
+// flag, which is either the name of a bundled preset or a path to a file.
+func shaderSource(name string) (string, error) {
+	if code, ok := shaders.Presets[name]; ok {
+		return code, nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read shader file: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func enableShader(w *ui.Window, opts *options) {
+	if opts.noCRT || opts.shader == "none" {
+		return
+	}
+
+	code, err := shaderSource(opts.shader)
+	if err != nil {
+		log.Printf("[ERROR] %s", err)
+		return
+	}
+
+	log.Printf("[INFO] using %s shader effect, disable with -nocrt flag", opts.shader)
+	w.EnableShader(code)
+}
+
+// applyPalette sets the palette selected with the -palette flag, which is either
+// the name of a built-in palette or a path to a .pal file. Falls back to the
+// default palette if the file cannot be loaded.
+func applyPalette(nes *system.System, opts *options) {
+	if p, ok := ppu.Palettes[opts.palette]; ok {
+		nes.SetPalette(p)
+		return
 	}
 
-	return loglevel.LevelInfo
+	p, err := ppu.LoadPalette(opts.palette)
+	if err != nil {
+		log.Printf("[ERROR] failed to load palette: %s", err)
+		nes.SetPalette(&ppu.DefaultPalette)
+
+		return
+	}
+
+	log.Printf("[INFO] using palette from %s", opts.palette)
+	nes.SetPalette(p)
+}
+
+// loadBezel sets the bezel image selected with the -bezel flag. The cutout is
+// detected automatically unless it is set in the config file.
+func loadBezel(w *ui.Window, opts *options) {
+	if opts.bezel == "" {
+		return
+	}
+
+	bezel, err := ui.LoadBezel(opts.bezel, opts.config.bezelCutout())
+	if err != nil {
+		log.Printf("[ERROR] failed to load bezel: %s", err)
+		return
+	}
+
+	if !opts.fullscreen {
+		log.Printf("[INFO] the bezel is only displayed in fullscreen mode")
+	}
+
+	log.Printf("[INFO] loaded bezel %s with cutout %v", opts.bezel, bezel.Cutout)
+	w.SetBezel(bezel)
+}
+
+// createAudio initializes the audio output with the volume from the config.
+func createAudio(opts *options) *ui.AudioOut {
+	audio := ui.CreateAudio(consts.AudioSamplesPerSecond, consts.AudioSampleSize, 1, consts.AudioBufferSize)
+	audio.SetVolume(opts.config.Audio.Volume)
+	audio.Mute(opts.mute)
+	opts.metrics.setAudio(audio)
+
+	return audio
+}
+
+// setupVolumeControls connects the mute and volume hotkeys to the audio output.
+// The chosen volume is saved to the config, so it is retained between runs.
+func setupVolumeControls(w *ui.Window, audio *ui.AudioOut, opts *options) {
+	w.SetMuted(audio.Muted())
+	w.MuteDelegate = audio.ToggleMute
+
+	w.VolumeDelegate = func(delta float32) float32 {
+		volume := audio.ChangeVolume(delta)
+		opts.config.Audio.Volume = volume
+		opts.config.save()
+
+		return volume
+	}
 }
 
 func printLogo() {
@@ -92,15 +528,61 @@ func printLogo() {
 }
 
 func main() {
-	opts := new(options).parse()
-	opts.sanitize()
+	cmd, args := cmdRun, os.Args[1:]
+
+	if len(args) > 0 {
+		switch args[0] {
+		case cmdRun, cmdRecord, cmdHost, cmdJoin:
+			cmd, args = args[0], args[1:]
+		case "bench":
+			runBench(args[1:])
+			return
+		case "replay":
+			// Playing the replay back opens the window.
+			ui.Run(func() { runReplay(args[1:]) })
+			return
+		case "testsuite":
+			runTestSuite(args[1:])
+			return
+		case "info":
+			runInfo(args[1:])
+			return
+		case "import":
+			runImport(args[1:])
+			return
+		case "soak":
+			runSoak(args[1:])
+			return
+		case "recent":
+			romFile, ok := runRecent(args[1:])
+			if !ok {
+				return
+			}
+
+			cmd, args = cmdRun, append([]string{romFile}, args[2:]...)
+		}
+	}
+
+	// Some frontends need to run their own event loop on the main thread, so
+	// the emulator itself may be started in a separate goroutine.
+	ui.Run(func() { run(cmd, args) })
+}
+
+func run(cmd string, args []string) {
+	opts := new(options).parse(cmd, args)
 
 	log.Default().SetFlags(0)
 	log.Default().SetOutput(loglevel.New(os.Stderr, opts.logLevel()))
+	ines.Warnings = opts.verbosity.mapperWarnings()
 
-	if flag.NArg() != 1 {
-		fmt.Println("usage: dendy [-scale=2] [-nosave] [-nospritelimit] [-listen=addr:port] [-connect=addr:port] romfile")
-		os.Exit(1)
+	opts.applyConfig(loadConfig())
+	opts.sanitize()
+	loadFDSBIOS(opts)
+
+	ines.UseROMDB = !opts.noROMDB
+
+	if ines.UseROMDB {
+		loadROMDB()
 	}
 
 	if !opts.noLogo {
@@ -143,24 +625,130 @@ func main() {
 		}()
 	}
 
-	romFile := flag.Arg(0)
+	if (opts.headless || opts.terminal) && opts.romFile == "" {
+		log.Printf("[ERROR] rom file is required in headless and terminal modes")
+		os.Exit(1)
+	}
+
+	switch {
+	case opts.command == cmdRecord && opts.record == "" && opts.recordInput == "":
+		log.Printf("[ERROR] nothing to record, use -video or -input")
+		os.Exit(1)
+
+	case opts.command == cmdJoin && opts.connectAddr == "" && opts.joinRoom == "":
+		log.Printf("[ERROR] host to join is required, use -connect or -room")
+		os.Exit(1)
+
+	case opts.retries < 0:
+		log.Printf("[ERROR] -retries must not be negative")
+		os.Exit(1)
+	}
+
+	if opts.romFile == "" {
+		if opts.romFile = browseROM(opts); opts.romFile == "" {
+			return
+		}
+	}
+
+	opts.metrics = startPprof(opts)
+	opts.frameTimer = newFrameTimer(opts)
+
+	if opts.api = startControlAPI(opts); opts.api != nil {
+		defer opts.api.Close()
+	}
+
+	for {
+		next := play(opts)
+		if next == "" {
+			break
+		}
+
+		opts.switchROM(next)
+	}
+}
+
+// switchROM selects the next game to play, loaded with the control API. The
+// options that only apply to the game given on the command line are reset.
+func (o *options) switchROM(romFile string) {
+	o.romFile = romFile
+	o.patch = ""
+	o.saveFile = ""
+	o.cheatFile = ""
+	o.cheats = ""
+	o.loadState = ""
+	o.script = ""
+	o.record = ""
+	o.recordInput = ""
+	o.watch = false
+	o.watchState = ""
+}
+
+// loadROM reads the ROM file, applying the patch if one is given.
+func loadROM(romFile, patch string) (*ines.ROM, error) {
+	if patch != "" {
+		log.Printf("[INFO] applying patch: %s", patch)
+		return ines.NewFromFileWithPatch(romFile, patch)
+	}
+
+	return ines.NewFromFile(romFile)
+}
+
+// play loads the ROM and runs it in the selected mode. Returns the next ROM to
+// play, if one is loaded with the control API while the game is running.
+func play(opts *options) (nextROM string) {
+	romFile := opts.romFile
 	log.Printf("[INFO] loading rom file: %s", romFile)
 
-	rom, err := ines.NewFromFile(romFile)
+	rom, err := loadROM(romFile, opts.patch)
 	if err != nil {
 		log.Printf("[ERROR] failed to open rom file: %s", err)
 		os.Exit(1)
 	}
 
+	if !opts.headless {
+		stop := addRecentGame(romFile, rom)
+		defer stop()
+	}
+
 	cart, err := ines.NewCartridge(rom)
 	if err != nil {
 		log.Printf("[ERROR] failed to open rom file: %s", err)
 		os.Exit(1)
 	}
 
+	opts.gameName = lookupGame(rom, opts)
+	opts = opts.forGame(rom)
+
 	saveFile := opts.saveFile
 	romPrefix := strings.TrimSuffix(romFile, filepath.Ext(romFile))
 
+	// The patched game is another game, with the saves of its own.
+	if opts.patch != "" {
+		romPrefix = filepath.Join(filepath.Dir(romFile), strings.TrimSuffix(filepath.Base(opts.patch), filepath.Ext(opts.patch)))
+	}
+
+	if opts.stateDir != "" {
+		if err := os.MkdirAll(opts.stateDir, 0755); err != nil {
+			log.Printf("[ERROR] failed to create state directory: %s", err)
+			os.Exit(1)
+		}
+
+		romPrefix = filepath.Join(opts.stateDir, filepath.Base(romPrefix))
+	}
+
+	if opts.cheatFile == "" {
+		opts.cheatFile = romPrefix + ".cht"
+	}
+
+	opts.watchFile = romPrefix + ".wch"
+
+	// The netplay game starts from the state of the host and is not kept, so
+	// the battery saves are only for playing alone.
+	if opts.connectAddr == "" && opts.joinRoom == "" && opts.listenAddr == "" && !opts.createRoom {
+		opts.sramFile = romPrefix + ".sav"
+		loadSRAM(cart, opts.sramFile)
+	}
+
 	switch {
 	case opts.connectAddr != "" || opts.joinRoom != "":
 		log.Printf("[INFO] starting client mode")
@@ -174,12 +762,30 @@ func main() {
 		log.Printf("[INFO] starting host mode")
 		runAsServer(cart, opts, saveFile, rom)
 
+	case opts.headless:
+		if saveFile == "" {
+			saveFile = romPrefix + ".save"
+		}
+
+		log.Printf("[INFO] starting headless mode")
+		runHeadless(cart, opts, saveFile)
+
+	case opts.terminal:
+		if saveFile == "" {
+			saveFile = romPrefix + ".save"
+		}
+
+		log.Printf("[INFO] starting terminal mode")
+		runInTerminal(cart, opts, saveFile)
+
 	default:
 		if saveFile == "" {
 			saveFile = romPrefix + ".save"
 		}
 
 		log.Printf("[INFO] starting offline mode")
-		runOffline(cart, opts, saveFile)
+		return runOffline(cart, opts, saveFile)
 	}
+
+	return ""
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// Hardcore mode disables everything that could change the game from outside.
+func TestOptions_SanitizeHardcore(t *testing.T) {
+	o := &options{
+		hardcore:  true,
+		loadState: "game.state",
+		script:    "bot.lua",
+		cheats:    "cheats.txt",
+		apiAddr:   "127.0.0.1:7777",
+		config:    &config{Achievements: achievementsConfig{Username: "player"}},
+	}
+
+	o.sanitize()
+
+	testutil.Equal(t, o.hardcore, true)
+	testutil.Equal(t, o.loadState, "")
+	testutil.Equal(t, o.script, "")
+	testutil.Equal(t, o.cheats, "")
+	testutil.Equal(t, o.apiAddr, "")
+	testutil.Equal(t, o.noSave, false)
+}
+
+// The game is saved on exit in hardcore mode, but the save is not loaded.
+func TestOptions_StartupStateFileHardcore(t *testing.T) {
+	o := &options{hardcore: true}
+
+	filename, explicit := o.startupStateFile("game.save")
+	testutil.Equal(t, filename, "")
+	testutil.Equal(t, explicit, false)
+}
+
+// Without the account, hardcore mode is turned off and nothing is disabled.
+func TestOptions_SanitizeHardcoreNoAccount(t *testing.T) {
+	o := &options{
+		hardcore: true,
+		apiAddr:  "127.0.0.1:7777",
+		config:   &config{},
+	}
+
+	o.sanitize()
+
+	testutil.Equal(t, o.hardcore, false)
+	testutil.Equal(t, o.apiAddr, "127.0.0.1:7777")
+}
+
+func TestOptions_ConsoleRegion(t *testing.T) {
+	tests := map[string]struct {
+		opts   options
+		header ines.Region
+		want   ines.Region
+	}{
+		"auto":           {opts: options{region: "auto"}, header: ines.RegionDendy, want: ines.RegionDendy},
+		"auto PAL":       {opts: options{region: "auto"}, header: ines.RegionPAL, want: ines.RegionPAL},
+		"ntsc":           {opts: options{region: "ntsc"}, header: ines.RegionDendy, want: ines.RegionNTSC},
+		"dendy":          {opts: options{region: "dendy"}, header: ines.RegionNTSC, want: ines.RegionDendy},
+		"recording":      {opts: options{region: "dendy", record: "game.mp4"}, want: ines.RegionNTSC},
+		"replay":         {opts: options{region: "dendy", recordInput: "game.rpl"}, want: ines.RegionNTSC},
+		"unknown region": {opts: options{region: "pal"}, header: ines.RegionDendy, want: ines.RegionDendy},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := tt.opts
+			o.config = &config{}
+			o.sanitize()
+
+			testutil.Equal(t, o.consoleRegion(&ines.ROM{Region: tt.header}), tt.want)
+		})
+	}
+}
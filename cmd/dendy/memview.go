@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/maxpoletaev/dendy/system"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+// memorySpaces returns the memory shown in the memory viewer. The hardware
+// registers in the CPU address space read as zero, so that viewing them does
+// not affect the game, but writing to them has the usual effect.
+func memorySpaces(nes *system.System) []ui.MemorySpace {
+	ppu := nes.PPU()
+
+	return []ui.MemorySpace{
+		{
+			Name:  "CPU",
+			Size:  0x10000,
+			Read:  func(addr int) uint8 { return nes.Peek(uint16(addr)) },
+			Write: func(addr int, data uint8) { nes.Poke(uint16(addr), data) },
+		},
+		{
+			Name:  "PPU",
+			Size:  0x4000,
+			Read:  func(addr int) uint8 { return ppu.PeekVRAM(uint16(addr)) },
+			Write: func(addr int, data uint8) { ppu.PokeVRAM(uint16(addr), data) },
+		},
+		{
+			Name:  "OAM",
+			Size:  256,
+			Read:  func(addr int) uint8 { return ppu.OAM()[addr] },
+			Write: func(addr int, data uint8) { ppu.OAM()[addr] = data },
+		},
+	}
+}
@@ -2,22 +2,55 @@ package main
 
 import (
 	"bufio"
-	"encoding/binary"
-	"fmt"
 	"io"
 	"log"
 	"os"
-	"strings"
+	"time"
 
+	"github.com/maxpoletaev/dendy/cheats"
 	"github.com/maxpoletaev/dendy/consts"
 	"github.com/maxpoletaev/dendy/ines"
 	"github.com/maxpoletaev/dendy/input"
-	"github.com/maxpoletaev/dendy/internal/binario"
+	"github.com/maxpoletaev/dendy/internal/cloudsync"
+	"github.com/maxpoletaev/dendy/internal/crash"
+	"github.com/maxpoletaev/dendy/recorder"
 	"github.com/maxpoletaev/dendy/system"
 	"github.com/maxpoletaev/dendy/ui"
 )
 
+// backupFile returns the name of the copy of the previous state, kept in case
+// the new one turns out to be unloadable.
+func backupFile(saveFile string) string {
+	return saveFile + ".bak"
+}
+
+// loadState loads the state from the save file, falling back to its backup if
+// the file is missing or broken. Returns false if neither of them exists.
 func loadState(nes *system.System, saveFile string) (bool, error) {
+	ok, err := loadStateFile(nes, saveFile)
+	if ok && err == nil {
+		return true, nil
+	}
+
+	backup := backupFile(saveFile)
+
+	// The system is left untouched when the state is rejected by the header
+	// checks, but not if the file is cut short in the middle, so the backup
+	// is loaded over whatever has been read so far.
+	if bakOk, bakErr := loadStateFile(nes, backup); bakOk && bakErr == nil {
+		if err != nil {
+			log.Printf("[WARN] failed to load save file: %s", err)
+		}
+
+		log.Printf("[WARN] state loaded from backup: %s", backup)
+
+		return true, nil
+	}
+
+	return ok, err
+}
+
+func loadStateFile(nes *system.System, saveFile string) (bool, error) {
 	f, err := os.OpenFile(saveFile, os.O_RDONLY, 0644)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -33,47 +66,113 @@ func loadState(nes *system.System, saveFile string) (bool, error) {
 		}
 	}()
 
-	reader := binario.NewReader(f, binary.LittleEndian)
-	if err := nes.LoadState(reader); err != nil {
+	if err := nes.ReadStateFile(f); err != nil {
 		return false, err
 	}
 
 	return true, nil
 }
 
-func saveState(nes *system.System, saveFile string) error {
+// saveState writes the state into a temporary file first, which replaces the
+// save file only once it is complete and flushed to the disk, so that the save
+// file is never left half-written, e.g. when the crash state is saved while
+// the emulator is going down. The previous state is kept as the backup.
+func saveState(nes *system.System, saveFile string) (err error) {
 	tmpFile := saveFile + ".tmp"
 
-	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
 
 	defer func() {
-		if err := f.Close(); err != nil {
-			log.Printf("[ERROR] failed to close save file: %s", err)
+		if err != nil {
+			_ = os.Remove(tmpFile)
 		}
 	}()
 
-	writer := binario.NewWriter(f, binary.LittleEndian)
-	if err := nes.SaveState(writer); err != nil {
+	err = nes.WriteStateFile(f)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	// The file must be closed before it is renamed, as Windows does not allow
+	// renaming the open files.
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
 		return err
 	}
 
-	if err := os.Rename(tmpFile, saveFile); err != nil {
+	if err := os.Rename(saveFile, backupFile(saveFile)); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
-	return nil
+	return os.Rename(tmpFile, saveFile)
+}
+
+// scaleSamples writes the samples multiplied by the gain into dst and returns
+// it. The source is left as it is for the recording.
+func scaleSamples(dst, src []float32, gain float32) []float32 {
+	dst = dst[:len(src)]
+
+	for i, sample := range src {
+		dst[i] = sample * gain
+	}
+
+	return dst
+}
+
+// fastForward emulates additional frames without rendering them or producing
+// any sound, so that the game runs speed times faster than normal. The audio is
+// only taken from the frames that are displayed, which keeps its pitch intact.
+// When speed is 0, it runs as many frames as fit into the frame time budget.
+// The onFrame function, if any, is called after every additional frame.
+func fastForward(nes *system.System, speed int, onFrame func()) {
+	nes.SetFastForward(true)
+	defer nes.SetFastForward(false)
+
+	start := time.Now()
+
+	for i := 1; speed == 0 || i < speed; i++ {
+		// Leave some time for rendering and input handling.
+		if speed == 0 && time.Since(start) >= consts.FrameDuration*3/4 {
+			break
+		}
+
+		for {
+			nes.Tick()
+
+			if nes.FrameReady() {
+				break
+			}
+		}
+
+		if onFrame != nil {
+			onFrame()
+		}
+	}
 }
 
-func runOffline(cart ines.Cartridge, opts *options, saveFile string) {
+// runOffline runs the game in the window. Returns the next ROM to play, if one
+// is loaded with the control API.
+func runOffline(cart ines.Cartridge, opts *options, saveFile string) (nextROM string) {
 	joy1 := input.NewJoystick()
 	zapper := input.NewZapper()
 
 	nes := system.New(cart, joy1, zapper)
 	nes.SetNoSpriteLimit(opts.noSpriteLimit)
-	nes.SetRewindEnabled(true)
+	nes.SetRegion(opts.consoleRegion(cart.ROM()))
+	applyPalette(nes, opts)
+	nes.SetRewindEnabled(!opts.hardcore)
+	enableCrashTrace(nes)
+
+	// The cartridge is replaced when the ROM is reloaded with -watch.
+	defer func() {
+		saveSRAM(nes.Cartridge(), opts.sramFile)
+	}()
 
 	if opts.disasm != "" {
 		var file io.Writer
@@ -102,86 +201,498 @@ func runOffline(cart ines.Cartridge, opts *options, saveFile string) {
 		}()
 	}
 
+	var (
+		autoSave *autoSaver
+		syncer   *cloudsync.Syncer
+	)
+
+	// The game started from the crash is played to reproduce it, and its progress
+	// must not overwrite the save file.
+	if !opts.noSave && crash.IsBundleState(opts.loadState) {
+		log.Printf("[INFO] loaded from crash state, further saves disabled")
+		opts.noSave = true
+	}
+
 	if !opts.noSave {
-		if ok, err := loadState(nes, saveFile); err != nil {
-			log.Printf("[ERROR] failed to load save file: %s", err)
-			os.Exit(1)
-		} else if ok {
-			log.Printf("[INFO] state loaded: %s", saveFile)
+		var err error
+		if syncer, err = newSyncer(opts.config.Sync); err != nil {
+			log.Printf("[ERROR] failed to set up save sync: %s", err)
+		} else if syncer != nil {
+			syncSaves(syncer, saveFile)
 		}
+	}
 
-		if strings.HasSuffix(saveFile, ".crash") {
-			log.Printf("[INFO] loaded from crash state, further saves disabled")
-			opts.noSave = true
+	if loadFile, explicit := opts.startupStateFile(saveFile); loadFile != "" {
+		// An auto-save newer than the save file means the emulator was not closed
+		// properly last time, so the progress is recovered from it.
+		if file, ok := latestAutoSave(saveFile); ok && !explicit {
+			log.Printf("[INFO] recovering from auto-save: %s", file)
+			loadFile = file
 		}
+
+		loadStartupState(nes, loadFile, explicit)
 	}
 
-	w := ui.CreateWindow(opts.scale, opts.verbose)
+	if !opts.noSave && opts.autoSave > 0 {
+		autoSave = newAutoSaver(saveFile, time.Duration(opts.autoSave)*time.Minute)
+	}
+
+	w := ui.CreateWindow(opts.windowOptions())
 	defer w.Close()
 
-	audio := ui.CreateAudio(consts.AudioSamplesPerSecond, consts.AudioSampleSize, 1, consts.AudioBufferSize)
+	audio := createAudio(opts)
 	audioBuffer := make([]float32, consts.AudioBufferSize)
-	audio.Mute(opts.mute)
+	ffAudioBuffer := make([]float32, consts.AudioBufferSize) // turned down while fast-forwarding
 	defer audio.Close()
 
-	w.SetFrameRate(consts.FramesPerSecond)
-	w.SetTitle(windowTitle)
+	// Neither the hardcore mode nor the replays allow the cheats.
+	noCheats := opts.hardcore || opts.recordInput != ""
+
+	var cheatList *cheats.List
+	if !noCheats {
+		cheatList = loadCheats(nes, opts)
+	}
+
+	cheevos := startAchievements(nes, opts)
+
+	scr := loadScript(nes, joy1, opts, func(text string) {
+		w.ShowMessage("%s", text)
+	})
+	if scr != nil {
+		defer scr.Close()
+	}
+
+	w.SetFrameRate(nes.FrameRate())
+	setGameTitle(w, opts, "")
 
 	w.InputDelegate = joy1.SetButtons
 	w.ZapperDelegate = zapper.Update
-	w.MuteDelegate = audio.ToggleMute
-	w.RewindDelegate = nes.Rewind
-	w.ResetDelegate = nes.Reset
+
+	// The microphone is not part of the replays, which only have the buttons
+	// of the first joystick.
+	if opts.recordInput == "" {
+		w.MicrophoneDelegate = nes.SetMicrophone
+	}
+
+	// The slots are the save states, which are not allowed in hardcore mode,
+	// unlike the save on exit.
+	withSlots := !opts.noSave && !opts.hardcore
+
+	setupVolumeControls(w, audio, opts)
+	setupSettingsMenu(w, audio, nes, opts, withSlots)
+	w.ResetDelegate = func() {
+		nes.Reset()
+		w.ShowMessage("Reset")
+
+		if cheevos != nil {
+			cheevos.reset()
+		}
+	}
 	w.ShowFPS = opts.showFPS
+	w.ShowPerf = opts.showPerf
+	w.PPUDelegate = nes.PPU
+
+	// Hardcore mode leaves out everything that changes the game or its pace.
+	if !opts.hardcore {
+		w.RewindDelegate = func() {
+			nes.Rewind()
+			w.ShowMessage("Rewind")
 
-	if !opts.noCRT {
-		log.Printf("[INFO] using experimental CRT effect, disable with -nocrt flag")
-		w.EnableCRT()
+			if cheevos != nil {
+				cheevos.reset()
+			}
+		}
+		w.MemorySpaces = memorySpaces(nes)
 	}
 
-	defer func() {
-		if err := recover(); err != nil {
-			// Save state on crash to quickly reconstruct the faulty state,
-			// unless we are already playing the crash state.
-			if !strings.HasSuffix(saveFile, ".crash") {
-				_ = saveState(nes, fmt.Sprintf("%s.crash", saveFile))
-				log.Printf("[INFO] pre-crash state saved: %s.crash", saveFile)
+	if !noCheats {
+		setupCheats(w, cheatList, opts)
+		w.CheatSearch = cheats.NewSearch(nes.Peek)
+	}
+
+	// The watches and the registers are only read, so they are allowed in
+	// hardcore mode.
+	setupRAMWatch(w, nes, opts)
+	w.RegistersDelegate = func() []string {
+		return registerLines(nes)
+	}
+
+	// Same as the rewind, the fast-forward changes the pace of the game.
+	var fastForwarding bool
+	if !opts.hardcore {
+		w.FastForwardDelegate = func(enabled bool) {
+			fastForwarding = enabled
+		}
+	}
+
+	// The achievements are evaluated on every frame emulated for real, the
+	// fast-forwarded ones included, but not on the frames run ahead, which are
+	// rolled back and emulated again on the next iteration.
+	var cheevosFrame func()
+	if cheevos != nil {
+		defer cheevos.close()
+
+		cheevosFrame = func() {
+			cheevos.frame(w)
+		}
+	}
+
+	var paused, frameStep bool
+	w.PauseDelegate = func() {
+		paused = !paused
+		w.SetPaused(paused)
+		audio.SetPaused(paused)
+	}
+	if !opts.hardcore {
+		w.FrameStepDelegate = func() {
+			frameStep = true
+		}
+	}
+
+	if withSlots {
+		w.ListSlotsDelegate = func() []ui.SaveSlot {
+			return listSlots(saveFile)
+		}
+		w.SaveSlotDelegate = func(slot int) error {
+			if err := saveSlot(nes, saveFile, slot); err != nil {
+				return err
 			}
 
-			panic(err)
+			if scr != nil {
+				scr.StateSaved()
+			}
+
+			return nil
+		}
+		w.LoadSlotDelegate = func(slot int) error {
+			if err := loadSlot(nes, saveFile, slot); err != nil {
+				return err
+			}
+
+			if scr != nil {
+				scr.StateLoaded()
+			}
+
+			if cheevos != nil {
+				cheevos.reset()
+			}
+
+			return nil
+		}
+	}
+
+	api := &controlTarget{
+		nes:    nes,
+		joy:    joy1,
+		w:      w,
+		opts:   opts,
+		paused: func() bool { return paused },
+	}
+
+	// Set with -watch, to reload the ROM when it is rebuilt.
+	var watchROM func()
+
+	// Polled on every iteration of the loops below, so that the API responds
+	// while paused or in the menu as well.
+	processAPI := func() {
+		if opts.api != nil {
+			opts.api.Process(api)
+		}
+
+		if watchROM != nil {
+			watchROM()
+		}
+	}
+
+	// The new build is started from the power-on or the state selected, as the
+	// save file of the old one may be far from the code being tested.
+	if opts.watch {
+		log.Printf("[INFO] watching rom file: %s", opts.romFile)
+		watcher := newROMWatcher(opts.romFile, opts.patch)
+		watchState := opts.watchStateFile(saveFile)
+
+		watchROM = func() {
+			rom, ok := watcher.poll()
+			if !ok {
+				return
+			}
+
+			cart, err := ines.NewCartridge(rom)
+			if err != nil {
+				log.Printf("[ERROR] failed to reload rom: %s", err)
+				w.ShowMessage("Failed to reload ROM")
+				return
+			}
+
+			// The new build continues from the battery save of the old one.
+			saveSRAM(nes.Cartridge(), opts.sramFile)
+			loadSRAM(cart, opts.sramFile)
+
+			nes.InsertCartridge(cart)
+			nes.SetCheats(cheatList)
+
+			if cheevos != nil {
+				cheevos.reset()
+			}
+
+			if watchState != "" {
+				if err := loadRebuiltState(nes, watchState); err != nil {
+					log.Printf("[ERROR] failed to load state: %s", err)
+					w.ShowMessage("ROM reloaded, failed to load state")
+
+					// The state may be loaded halfway, so the game is started
+					// from the power-on instead.
+					loadSRAM(cart, opts.sramFile)
+					nes.InsertCartridge(cart)
+					nes.SetCheats(cheatList)
+
+					return
+				}
+			}
+
+			log.Printf("[INFO] rom reloaded: %s", opts.romFile)
+			w.ShowMessage("ROM reloaded")
+		}
+	}
+
+	var rec *recorder.Recorder
+
+	if opts.record != "" {
+		var err error
+
+		if rec, err = startRecording(opts.record); err != nil {
+			log.Printf("[ERROR] failed to start recording: %s", err)
+			os.Exit(1)
+		}
+
+		w.SetRecording(true)
+	}
+
+	// Returns whether the recording is active after toggling.
+	w.RecordDelegate = func() bool {
+		if rec != nil {
+			stopRecording(rec)
+			w.ShowMessage("Recording stopped")
+			rec = nil
+
+			return false
+		}
+
+		var err error
+
+		if rec, err = startRecording(recordingFile(opts)); err != nil {
+			log.Printf("[ERROR] failed to start recording: %s", err)
+			w.ShowMessage("Failed to start recording")
+
+			return false
+		}
+
+		w.ShowMessage("Recording started")
+
+		return true
+	}
+
+	defer func() {
+		if rec != nil {
+			stopRecording(rec)
 		}
 	}()
 
+	var gifRec *recorder.GIFRecorder
+
+	if opts.gifSeconds > 0 {
+		gifRec = recorder.NewGIFRecorder(opts.gifSeconds)
+
+		w.GIFDelegate = func() {
+			if gifRec.Len() == 0 {
+				return
+			}
+
+			saveGIF(gifRec, opts)
+			w.ShowMessage("Saving GIF of the last %d seconds", opts.gifSeconds)
+		}
+	}
+
+	setupDiskDrive(w, nes)
+	enableShader(w, opts)
+	loadBezel(w, opts)
+
+	defer recoverCrash(nes, opts)
+
+	var (
+		sampleClock system.SampleClock
+		ahead       *runAhead
+		frameCount  int
+		skipNext    bool
+
+		pauseOnFocusLoss = opts.config.General.PauseOnFocusLoss && !opts.config.General.BackgroundInput
+	)
+
+	if opts.runAhead {
+		log.Printf("[INFO] run-ahead enabled")
+		ahead = newRunAhead()
+	}
+
+	replayRec := startReplay(nes, opts)
+
+	// The emulation time of the frame for the performance HUD, which excludes
+	// the waits for the audio stream and the window.
+	var (
+		emuTime  time.Duration
+		emuStart = time.Now()
+	)
+
 gameloop:
 	for {
+		// The region may be changed in the settings menu.
+		sampleClock.Period = nes.TicksPerAudioSample()
+
 		for i := 0; i < consts.AudioBufferSize; i++ {
-			for j := 0; j < consts.TicksPerAudioSample; j++ {
+			for j, ticks := 0, sampleClock.Next(); j < ticks; j++ {
 				nes.Tick()
 
-				if nes.ScanlineReady() {
-					w.UpdateZapper(nes.Frame())
-				}
-
 				if nes.FrameReady() {
+					recordReplayFrame(replayRec, joy1.Buttons())
+
 					if w.ShouldClose() {
 						break gameloop
 					}
 
-					zapper.VBlank()
+					opts.metrics.frame()
+					opts.frameTimer.frame()
+
+					// With frame skipping, the PPU output is disabled for the
+					// skipped frames, so the frame buffer keeps the last one
+					// rendered, which is passed to the captures instead.
+					skipped := skipNext
 
 					w.UpdateJoystick()
-					w.HandleHotKeys()
-					w.SetGrayscale(false)
-					w.Refresh(nes.Frame())
+					w.UpdateZapper()
+					api.applyButtons()
+
+					if scr != nil {
+						scr.Frame()
 
-					// Pause when not in focus.
-					for !w.InFocus() {
+						if scr.ExitRequested() {
+							break gameloop
+						}
+					}
+
+					// The captures are taken before running ahead, so that
+					// they only contain the frames that were emulated for real.
+					if gifRec != nil {
+						gifRec.AddFrame(nes.Frame(), nes.Palette())
+					}
+
+					if rec != nil {
+						rec.WriteFrame(nes.Frame())
+
+						if opts.recordFrames > 0 && rec.Frames() >= opts.recordFrames {
+							break gameloop
+						}
+					}
+
+					if autoSave != nil {
+						autoSave.tick(nes)
+					}
+
+					if cheevosFrame != nil {
+						cheevosFrame()
+					}
+
+					processAPI()
+
+					if api.nextROM != "" {
+						break gameloop
+					}
+
+					// The skipped frames are not displayed, and the hotkeys are
+					// only read on the displayed ones, but the menu and the pause
+					// are still handled below.
+					if !skipped {
+						w.HandleHotKeys()
+						w.SetGrayscale(false)
+
+						// The frame run ahead replaces the one the script has
+						// drawn over, so the overlay is drawn again.
+						if ahead != nil && !fastForwarding {
+							ahead.next(nes)
+
+							if scr != nil {
+								scr.Draw()
+							}
+						}
+
+						emuTime += time.Since(emuStart)
+						w.SetFrameTimes(emuTime, 0)
+						w.Refresh(nes.Frame())
+						emuTime, emuStart = 0, time.Now()
+					}
+
+					if fastForwarding {
+						fastForward(nes, opts.ffSpeed, cheevosFrame)
+					}
+
+					// The emulation is suspended while a menu is open.
+					if w.MenuOpen() {
+						audio.SetPaused(true)
+
+						for w.MenuOpen() && api.nextROM == "" {
+							if w.ShouldClose() {
+								break gameloop
+							}
+
+							w.HandleHotKeys()
+							w.Refresh(nes.Frame())
+							processAPI()
+							emuStart = time.Now()
+						}
+
+						audio.SetPaused(paused)
+					}
+
+					// Keep the window responsive while paused. The input is
+					// still read, so that it is applied to the stepped frame.
+					for paused && !frameStep && api.nextROM == "" {
 						if w.ShouldClose() {
 							break gameloop
 						}
 
-						w.SetGrayscale(true)
+						w.UpdateJoystick()
+						w.HandleHotKeys()
 						w.Refresh(nes.Frame())
+						processAPI()
+						emuStart = time.Now()
+					}
+
+					frameStep = false
+
+					// Pause when not in focus, unless disabled in the config
+					// or the game is meant to be played in the background.
+					if pauseOnFocusLoss && !w.InFocus() {
+						audio.SetPaused(true)
+
+						for !w.InFocus() && api.nextROM == "" {
+							if w.ShouldClose() {
+								break gameloop
+							}
+
+							w.SetGrayscale(true)
+							w.Refresh(nes.Frame())
+							processAPI()
+							emuStart = time.Now()
+						}
+
+						audio.SetPaused(paused)
+					}
+
+					// The next frame is set up to be skipped after the fast
+					// forward, which turns the PPU output back on when done. The
+					// frames stepped while paused are all displayed.
+					if opts.frameSkip > 0 {
+						frameCount++
+						skipNext = !paused && frameCount%(opts.frameSkip+1) != 0
+						nes.SetFastForward(skipNext)
 					}
 				}
 			}
@@ -189,8 +700,27 @@ gameloop:
 			audioBuffer[i] = nes.AudioSample()
 		}
 
-		audio.WaitStreamProcessed()
-		audio.UpdateStream(audioBuffer)
+		// The stream is not consumed while paused, so the samples produced
+		// by the stepped frames are discarded.
+		if !paused {
+			out := audioBuffer
+			if fastForwarding && opts.ffVolume < 100 {
+				out = scaleSamples(ffAudioBuffer, audioBuffer, float32(opts.ffVolume)/100)
+			}
+
+			emuTime += time.Since(emuStart)
+			audio.WaitStreamProcessed()
+			emuStart = time.Now()
+			audio.UpdateStream(out)
+		}
+
+		if rec != nil {
+			rec.WriteAudio(audioBuffer)
+		}
+	}
+
+	if replayRec != nil {
+		saveReplay(replayRec, opts)
 	}
 
 	if !opts.noSave {
@@ -200,5 +730,11 @@ gameloop:
 		}
 
 		log.Printf("[INFO] state saved: %s", saveFile)
+
+		if syncer != nil {
+			syncSaves(syncer, saveFile)
+		}
 	}
+
+	return api.nextROM
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// The samples turned down while fast-forwarding are written into the other
+// buffer, leaving the original ones for the recording.
+func TestScaleSamples(t *testing.T) {
+	src := []float32{0.5, -1, 0.25}
+	dst := make([]float32, 8)
+
+	out := scaleSamples(dst, src, 0.5)
+
+	testutil.Equal(t, len(out), len(src))
+	testutil.Equal(t, out[0], 0.25)
+	testutil.Equal(t, out[1], -0.5)
+	testutil.Equal(t, out[2], 0.125)
+	testutil.Equal(t, src[0], 0.5)
+}
+
+// Every fast-forwarded frame is reported, so that the achievements are not
+// missed while fast-forwarding.
+func TestFastForward_OnFrame(t *testing.T) {
+	data := testutil.NewROMFile(0, 1, 1)
+	copy(data.PRG(), []byte{0x4C, 0x00, 0x80}) // JMP $8000
+	data.SetResetVector(0x8000)
+
+	rom, err := ines.NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nes := system.New(cart, input.NewJoystick(), input.NewJoystick())
+
+	frames := 0
+	fastForward(nes, 4, func() { frames++ })
+
+	testutil.Equal(t, frames, 3)
+}
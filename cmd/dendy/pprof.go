@@ -0,0 +1,139 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+	_ "net/http/pprof" // registers the /debug/pprof handlers
+	"os"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+// debugMetrics are the emulator metrics published with expvar on the -pprof
+// server, along with the memory stats published by expvar itself. The methods
+// do nothing on nil, so the loops do not have to check if the server is on.
+type debugMetrics struct {
+	frames         *expvar.Int
+	frameTime      *expvar.Float
+	maxFrameTime   *expvar.Float
+	rollbackFrames *expvar.Int
+	maxRollback    *expvar.Int
+	lastFrame      time.Time
+	audio          atomic.Pointer[ui.AudioOut] // read by the server
+}
+
+// startPprof serves pprof and expvar on the address selected with the -pprof
+// flag, or returns nil if there is none. Exits if the address cannot be
+// listened on.
+func startPprof(opts *options) *debugMetrics {
+	if opts.pprofAddr == "" {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", opts.pprofAddr)
+	if err != nil {
+		log.Printf("[ERROR] failed to start pprof server: %s", err)
+		os.Exit(1)
+	}
+
+	m := &debugMetrics{
+		frames:         new(expvar.Int),
+		frameTime:      new(expvar.Float),
+		maxFrameTime:   new(expvar.Float),
+		rollbackFrames: new(expvar.Int),
+		maxRollback:    new(expvar.Int),
+	}
+
+	vars := expvar.NewMap("dendy")
+	vars.Set("frames", m.frames)
+	vars.Set("frame_time_ms", m.frameTime)
+	vars.Set("max_frame_time_ms", m.maxFrameTime)
+	vars.Set("rollback_frames", m.rollbackFrames)
+	vars.Set("max_rollback_frames", m.maxRollback)
+	vars.Set("audio_underruns", expvar.Func(func() any { return m.audioStats().Underruns }))
+	vars.Set("audio_dropped_samples", expvar.Func(func() any { return m.audioStats().Dropped }))
+
+	expvar.Publish("gc", expvar.Func(func() any {
+		var stats debug.GCStats
+
+		debug.ReadGCStats(&stats)
+
+		var lastPause time.Duration
+		if len(stats.Pause) > 0 {
+			lastPause = stats.Pause[0]
+		}
+
+		return map[string]any{
+			"num_gc":         stats.NumGC,
+			"last_pause_ms":  float64(lastPause) / float64(time.Millisecond),
+			"total_pause_ms": float64(stats.PauseTotal) / float64(time.Millisecond),
+		}
+	}))
+
+	// Both pprof and expvar register their handlers on the default mux.
+	go func() {
+		if err := http.Serve(ln, nil); err != nil {
+			log.Printf("[ERROR] pprof server: %s", err)
+		}
+	}()
+
+	log.Printf("[INFO] pprof listening on %s", opts.pprofAddr)
+
+	return m
+}
+
+// frame records the time since the previous frame.
+func (m *debugMetrics) frame() {
+	if m == nil {
+		return
+	}
+
+	now := time.Now()
+
+	if !m.lastFrame.IsZero() {
+		ms := float64(now.Sub(m.lastFrame)) / float64(time.Millisecond)
+		m.frameTime.Set(ms)
+
+		if ms > m.maxFrameTime.Value() {
+			m.maxFrameTime.Set(ms)
+		}
+	}
+
+	m.lastFrame = now
+	m.frames.Add(1)
+}
+
+// rollback records the number of frames rolled back by the netplay.
+func (m *debugMetrics) rollback(frames int) {
+	if m == nil {
+		return
+	}
+
+	m.rollbackFrames.Set(int64(frames))
+
+	if int64(frames) > m.maxRollback.Value() {
+		m.maxRollback.Set(int64(frames))
+	}
+}
+
+// setAudio publishes the stats of the audio output along with the metrics.
+func (m *debugMetrics) setAudio(audio *ui.AudioOut) {
+	if m == nil {
+		return
+	}
+
+	m.audio.Store(audio)
+}
+
+func (m *debugMetrics) audioStats() ui.AudioStats {
+	if audio := m.audio.Load(); audio != nil {
+		return audio.Stats()
+	}
+
+	return ui.AudioStats{}
+}
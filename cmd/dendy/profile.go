@@ -0,0 +1,127 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+// turboFrames is how long the turbo buttons stay pressed, and then released,
+// which makes 15 presses a second.
+const turboFrames = 2
+
+// inputProfile is a named set of the input settings in the config, assigned to
+// the games that need them, e.g. to swap A and B or to enable turbo in the
+// shooters. The keys are changed in the settings menu while the profile is in
+// use, the rest is only set by editing the config file manually.
+type inputProfile struct {
+	Keys  map[string]string `toml:"keys,omitempty"`  // joystick button name -> key name, on top of [input]
+	Remap map[string]string `toml:"remap,omitempty"` // joystick button name -> the button it presses instead
+	Turbo []string          `toml:"turbo,omitempty"` // buttons pressed repeatedly while held
+}
+
+// profile returns the input profile selected for the game, or nil if there is
+// none or it is not in the config.
+func (o *options) profile() *inputProfile {
+	if o.inputProfile == "" {
+		return nil
+	}
+
+	p, ok := o.config.Profiles[o.inputProfile]
+	if !ok {
+		log.Printf("[WARN] unknown input profile: %s", o.inputProfile)
+		return nil
+	}
+
+	return p
+}
+
+func parseButton(name string) (input.Button, bool) {
+	for _, b := range ui.ButtonNames {
+		if strings.EqualFold(b.Name, name) {
+			return b.Button, true
+		}
+	}
+
+	return 0, false
+}
+
+// buttonMapper remaps the buttons and presses the turbo ones repeatedly, before
+// they are passed to the game.
+type buttonMapper struct {
+	remap [8]input.Button // by the bit of the button
+	turbo input.Button
+	frame int
+}
+
+func newButtonMapper(p *inputProfile) *buttonMapper {
+	m := &buttonMapper{}
+
+	for i := range m.remap {
+		m.remap[i] = 1 << i
+	}
+
+	for from, to := range p.Remap {
+		src, ok1 := parseButton(from)
+		dst, ok2 := parseButton(to)
+
+		if !ok1 || !ok2 {
+			log.Printf("[WARN] invalid button remap: %s = %s", from, to)
+			continue
+		}
+
+		for i := range m.remap {
+			if src == 1<<i {
+				m.remap[i] = dst
+			}
+		}
+	}
+
+	for _, name := range p.Turbo {
+		b, ok := parseButton(name)
+		if !ok {
+			log.Printf("[WARN] invalid turbo button: %s", name)
+			continue
+		}
+
+		m.turbo |= b
+	}
+
+	return m
+}
+
+// apply is called once per frame with the buttons held.
+func (m *buttonMapper) apply(buttons uint8) uint8 {
+	var mapped uint8
+
+	for i, b := range m.remap {
+		if buttons&(1<<i) != 0 {
+			mapped |= b
+		}
+	}
+
+	if (m.frame/turboFrames)%2 == 1 {
+		mapped &^= m.turbo
+	}
+
+	m.frame++
+
+	return mapped
+}
+
+// withInputProfile wraps the input delegate into the button mapper of the
+// profile, if there is one.
+func withInputProfile(opts *options, delegate func(buttons uint8)) func(buttons uint8) {
+	p := opts.profile()
+	if p == nil || delegate == nil || (len(p.Remap) == 0 && len(p.Turbo) == 0) {
+		return delegate
+	}
+
+	m := newButtonMapper(p)
+
+	return func(buttons uint8) {
+		delegate(m.apply(buttons))
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+
+	"github.com/maxpoletaev/dendy/ramwatch"
+	"github.com/maxpoletaev/dendy/system"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+// setupRAMWatch loads the watches of the game and saves them whenever they are
+// changed in the window. The watches cannot be loaded with an invalid file,
+// which is left as is rather than overwritten.
+func setupRAMWatch(w *ui.Window, nes *system.System, opts *options) {
+	list, err := ramwatch.Load(opts.watchFile, nes.Peek)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		list = ramwatch.NewList(nes.Peek)
+	case err != nil:
+		log.Printf("[ERROR] failed to load ram watches: %s", err)
+		return
+	}
+
+	w.RAMWatch = list
+	w.RAMWatchDelegate = func() {
+		if err := list.Save(opts.watchFile); err != nil {
+			log.Printf("[ERROR] failed to save ram watches: %s", err)
+		}
+	}
+}
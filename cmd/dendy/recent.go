@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/maxpoletaev/dendy/consts"
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+const (
+	maxRecentGames = 10
+	recentUsage    = "usage: dendy recent [n [flags]]"
+)
+
+// recentGame is a recently played ROM. The checksum makes it possible to find
+// the game after the ROM file has been moved.
+type recentGame struct {
+	Path       string    `toml:"path"`
+	CRC32      string    `toml:"crc32,omitempty"`
+	LastPlayed time.Time `toml:"last_played"`
+	PlayTime   int64     `toml:"play_time"` // seconds
+}
+
+type recentGames struct {
+	Games []recentGame `toml:"game"`
+}
+
+func recentDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "dendy"), nil
+}
+
+// loadRecentGames returns the recently played ROMs, most recent first. Files
+// that no longer exist are skipped.
+func loadRecentGames() []recentGame {
+	var games []recentGame
+
+	for _, g := range readRecentGames() {
+		if _, err := os.Stat(g.Path); err == nil {
+			games = append(games, g)
+		}
+	}
+
+	return games
+}
+
+// readRecentGames returns the whole list as it was saved, including the files
+// that no longer exist, which may have been moved and are found by the CRC.
+func readRecentGames() []recentGame {
+	dir, err := recentDir()
+	if err != nil {
+		return nil
+	}
+
+	var list recentGames
+
+	if _, err := toml.DecodeFile(filepath.Join(dir, "recent.toml"), &list); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[WARN] failed to read recent games: %s", err)
+			return nil
+		}
+
+		list.Games = loadLegacyRecentGames(filepath.Join(dir, "recent.txt"))
+	}
+
+	return list.Games
+}
+
+// loadLegacyRecentGames reads the list of the older versions, which is just the
+// paths, one per line.
+func loadLegacyRecentGames(filename string) []recentGame {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var games []recentGame
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path := strings.TrimSpace(scanner.Text()); path != "" {
+			games = append(games, recentGame{Path: path})
+		}
+	}
+
+	return games
+}
+
+func saveRecentGames(games []recentGame) {
+	dir, err := recentDir()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("[WARN] failed to save recent games: %s", err)
+		return
+	}
+
+	var buf bytes.Buffer
+
+	if err := toml.NewEncoder(&buf).Encode(recentGames{Games: games}); err != nil {
+		log.Printf("[WARN] failed to save recent games: %s", err)
+		return
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "recent.toml"), buf.Bytes(), 0644); err != nil {
+		log.Printf("[WARN] failed to save recent games: %s", err)
+	}
+}
+
+// addRecentGame moves the ROM to the top of the recently played list. Returns
+// the function to call when the game is closed, which adds the time played.
+func addRecentGame(romFile string, rom *ines.ROM) (stop func()) {
+	path, err := filepath.Abs(romFile)
+	if err != nil {
+		return func() {}
+	}
+
+	var (
+		crc     = fmt.Sprintf("%08X", rom.CRC32)
+		game    = recentGame{Path: path, CRC32: crc}
+		started = time.Now()
+	)
+
+	// The game is matched by the CRC before the missing files are dropped, so
+	// that the time played is kept when the ROM has been moved.
+	update := func(played time.Duration) {
+		games := []recentGame{game}
+
+		for _, g := range readRecentGames() {
+			if g.Path == path || g.CRC32 == crc {
+				games[0].PlayTime = g.PlayTime + int64(played/time.Second)
+				continue
+			}
+
+			if _, err := os.Stat(g.Path); err == nil && len(games) < maxRecentGames {
+				games = append(games, g)
+			}
+		}
+
+		games[0].LastPlayed = time.Now().Round(time.Second)
+		saveRecentGames(games)
+	}
+
+	update(0)
+
+	return func() {
+		update(time.Since(started))
+	}
+}
+
+func formatPlayTime(seconds int64) string {
+	d := time.Duration(seconds) * time.Second
+
+	switch {
+	case d < time.Minute:
+		return "<1m"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
+
+// runRecent runs the "recent" subcommand. Without arguments, it lists the
+// recently played games. With the number from the list, it returns the ROM to
+// start, the same as with "dendy run".
+func runRecent(args []string) (romFile string, ok bool) {
+	games := loadRecentGames()
+
+	if len(args) == 0 {
+		if len(games) == 0 {
+			fmt.Println("no recently played games")
+		}
+
+		for i, g := range games {
+			// The games from the older versions have no time recorded.
+			lastPlayed := "-"
+			if !g.LastPlayed.IsZero() {
+				lastPlayed = g.LastPlayed.Local().Format("2006-01-02 15:04")
+			}
+
+			fmt.Printf("%2d  %-16s  %7s  %s\n", i+1, lastPlayed, formatPlayTime(g.PlayTime), g.Path)
+		}
+
+		return "", false
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		fmt.Fprintln(os.Stderr, recentUsage)
+		os.Exit(1)
+	}
+
+	if n > len(games) {
+		fmt.Fprintf(os.Stderr, "there are only %d recently played games\n", len(games))
+		os.Exit(1)
+	}
+
+	return games[n-1].Path, true
+}
+
+// browseROM opens a temporary window to let the user pick a ROM file when
+// the emulator is started without arguments.
+func browseROM(opts *options) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		dir = "."
+	}
+
+	w := ui.CreateWindow(opts.windowOptions())
+	defer w.Close()
+
+	w.SetTitle(windowTitle)
+	w.SetFrameRate(consts.FrameRate)
+
+	var recent []ui.RecentROM
+	for _, g := range loadRecentGames() {
+		recent = append(recent, ui.RecentROM{Path: g.Path, Detail: formatPlayTime(g.PlayTime)})
+	}
+
+	return w.SelectROM(dir, recent)
+}
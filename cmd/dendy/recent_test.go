@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// setConfigDir points the user config directory to a temporary one.
+func setConfigDir(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+
+	return dir
+}
+
+func touch(t *testing.T, filename string) {
+	if err := os.WriteFile(filename, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The game moved to another path is found by the CRC, and keeps the time
+// played, while the other missing files are dropped.
+func TestAddRecentGame_Moved(t *testing.T) {
+	dir := setConfigDir(t)
+	romFile := filepath.Join(dir, "moved.nes")
+	otherFile := filepath.Join(dir, "other.nes")
+
+	touch(t, romFile)
+	touch(t, otherFile)
+
+	saveRecentGames([]recentGame{
+		{Path: filepath.Join(dir, "old", "moved.nes"), CRC32: "0000ABCD", PlayTime: 120},
+		{Path: filepath.Join(dir, "gone.nes"), CRC32: "00001234", PlayTime: 60},
+		{Path: otherFile, CRC32: "00005678", PlayTime: 30},
+	})
+
+	stop := addRecentGame(romFile, &ines.ROM{CRC32: 0xABCD})
+	stop()
+
+	games := readRecentGames()
+	testutil.Equal(t, len(games), 2)
+	testutil.Equal(t, games[0].Path, romFile)
+	testutil.Equal(t, games[0].CRC32, "0000ABCD")
+	testutil.Equal(t, games[0].PlayTime, int64(120))
+	testutil.Equal(t, games[1].Path, otherFile)
+}
+
+func TestLoadRecentGames_Missing(t *testing.T) {
+	dir := setConfigDir(t)
+	romFile := filepath.Join(dir, "game.nes")
+	touch(t, romFile)
+
+	saveRecentGames([]recentGame{
+		{Path: filepath.Join(dir, "gone.nes")},
+		{Path: romFile},
+	})
+
+	games := loadRecentGames()
+	testutil.Equal(t, len(games), 1)
+	testutil.Equal(t, games[0].Path, romFile)
+	testutil.Equal(t, len(readRecentGames()), 2)
+}
+
+// The list of the older versions has just the paths.
+func TestLoadRecentGames_Legacy(t *testing.T) {
+	dir := setConfigDir(t)
+	romFile := filepath.Join(dir, "game.nes")
+	touch(t, romFile)
+
+	if err := os.MkdirAll(filepath.Join(dir, "dendy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "dendy", "recent.txt"), []byte(romFile+"\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	games := loadRecentGames()
+	testutil.Equal(t, len(games), 1)
+	testutil.Equal(t, games[0].Path, romFile)
+}
+
+func TestFormatPlayTime(t *testing.T) {
+	tests := map[string]struct {
+		seconds int64
+		want    string
+	}{
+		"under a minute": {seconds: 59, want: "<1m"},
+		"over an hour":   {seconds: 61 * 60, want: "1h 1m"},
+		"hours":          {seconds: 3*3600 + 5*60 + 30, want: "3h 5m"},
+		"exact minutes":  {seconds: 45 * 60, want: "45m"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testutil.Equal(t, formatPlayTime(tt.seconds), tt.want)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/maxpoletaev/dendy/consts"
+	"github.com/maxpoletaev/dendy/recorder"
+)
+
+// recordingFile returns the file name for recordings started with the hotkey.
+// They are saved next to the screenshots.
+func recordingFile(opts *options) string {
+	name := fmt.Sprintf("%s_%s.mp4", opts.romName(), time.Now().Format("2006-01-02_150405"))
+	return filepath.Join(opts.screenshotDir, name)
+}
+
+// saveGIF encodes the recently captured frames into a GIF file. The encoding
+// takes a while, so it is done in background.
+func saveGIF(gifRec *recorder.GIFRecorder, opts *options) {
+	if err := os.MkdirAll(opts.screenshotDir, 0755); err != nil {
+		log.Printf("[ERROR] failed to create screenshot directory: %s", err)
+		return
+	}
+
+	name := fmt.Sprintf("%s_%s.gif", opts.romName(), time.Now().Format("2006-01-02_150405"))
+	filename := filepath.Join(opts.screenshotDir, name)
+	encode := gifRec.Flush()
+
+	go func() {
+		f, err := os.Create(filename)
+		if err != nil {
+			log.Printf("[ERROR] failed to create gif file: %s", err)
+			return
+		}
+
+		defer func() {
+			if err := f.Close(); err != nil {
+				log.Printf("[ERROR] failed to close gif file: %s", err)
+			}
+		}()
+
+		if err := encode(f); err != nil {
+			log.Printf("[ERROR] failed to encode gif: %s", err)
+			return
+		}
+
+		log.Printf("[INFO] gif saved: %s", filename)
+	}()
+}
+
+func startRecording(filename string) (*recorder.Recorder, error) {
+	if dir := filepath.Dir(filename); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	rec, err := recorder.Start(filename, recorder.Options{
+		FrameRate:  consts.FrameRate,
+		SampleRate: consts.AudioSamplesPerSecond,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] recording to %s", filename)
+
+	return rec, nil
+}
+
+func stopRecording(rec *recorder.Recorder) {
+	if err := rec.Close(); err != nil {
+		log.Printf("[ERROR] failed to finish recording: %s", err)
+		return
+	}
+
+	log.Printf("[INFO] recording finished, %d frames written", rec.Frames())
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// registerLines describes the state of the CPU, the PPU and the mapper for the
+// register overlay. The flags that are set are shown in upper case.
+func registerLines(nes *system.System) []string {
+	var (
+		cpu   = nes.CPU()
+		ppu   = nes.PPU().Registers()
+		cart  = nes.Cartridge()
+		flags = []byte("nv-bdizc")
+	)
+
+	for i := range flags {
+		if cpu.P&(0x80>>i) != 0 && flags[i] != '-' {
+			flags[i] -= 'a' - 'A'
+		}
+	}
+
+	return []string{
+		fmt.Sprintf("CPU  A:%02X X:%02X Y:%02X SP:%02X PC:%04X P:%s", cpu.A, cpu.X, cpu.Y, cpu.SP, cpu.PC, flags),
+		fmt.Sprintf("PPU  CTRL:%02X MASK:%02X STATUS:%02X V:%04X", ppu.Ctrl, ppu.Mask, ppu.Status, ppu.VRAMAddr),
+		fmt.Sprintf("     SCROLL:%d,%d SCANLINE:%d DOT:%d", ppu.ScrollX, ppu.ScrollY, ppu.Scanline, ppu.Dot),
+		fmt.Sprintf("MAPPER %d  %s", cart.ROM().MapperID, cart.Banks()),
+	}
+}
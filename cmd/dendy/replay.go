@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/maxpoletaev/dendy/consts"
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/internal/loglevel"
+	"github.com/maxpoletaev/dendy/ppu"
+	"github.com/maxpoletaev/dendy/recorder"
+	"github.com/maxpoletaev/dendy/replay"
+	"github.com/maxpoletaev/dendy/system"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+const replayUsage = `usage: dendy replay <action> [flags] file.replay
+
+actions:
+  verify  play the replay back headless and check that it ends in the recorded state
+  play    watch the replay, or render it into a video or png frames`
+
+// replayResult is what "dendy replay verify" reports with -json.
+type replayResult struct {
+	Replay string `json:"replay"`
+	ROM    string `json:"rom"`
+	Frames int    `json:"frames"`
+	CRC32  string `json:"crc32"` // of the recorded final state
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// startReplay starts recording the replay selected with the -input flag,
+// or returns nil if there is none. The second port has the Zapper in both the
+// offline and the headless modes.
+func startReplay(nes *system.System, opts *options) *replay.Recorder {
+	if opts.recordInput == "" {
+		return nil
+	}
+
+	romFile, err := filepath.Abs(opts.romFile)
+	if err != nil {
+		romFile = opts.romFile
+	}
+
+	log.Printf("[INFO] recording replay: %s", opts.recordInput)
+
+	return replay.NewRecorder(nes, romFile, replay.DeviceZapper, opts.noSpriteLimit)
+}
+
+// recordReplayFrame records the buttons of the first controller at the end of
+// the frame, before they are updated for the next one.
+func recordReplayFrame(rec *replay.Recorder, buttons uint8) {
+	if rec != nil && rec.Frame(buttons, 0) {
+		log.Printf("[INFO] game state changed, replay restarted from the current frame")
+	}
+}
+
+// saveReplay writes the recorded replay. Must be called at the end of a frame,
+// after recordReplayFrame.
+func saveReplay(rec *replay.Recorder, opts *options) {
+	rep := rec.Finish()
+
+	f, err := os.Create(opts.recordInput)
+	if err != nil {
+		log.Printf("[ERROR] failed to create replay file: %s", err)
+		return
+	}
+
+	writeErr := rep.Write(f)
+	closeErr := f.Close()
+
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		log.Printf("[ERROR] failed to save replay: %s", err)
+		return
+	}
+
+	log.Printf("[INFO] replay saved: %s (%d frames)", opts.recordInput, len(rep.Inputs))
+}
+
+// runReplay runs the "replay" subcommand, with the action given first.
+func runReplay(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "verify":
+			verifyReplay(args[1:])
+			return
+		case "play":
+			playReplay(args[1:])
+			return
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, replayUsage)
+	os.Exit(1)
+}
+
+func replayFlags(action string) *flag.FlagSet {
+	fs := flag.NewFlagSet("replay "+action, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, replayUsage+"\n\nflags of the action:")
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// openReplay reads the replay and inserts the ROM it is played with, which is
+// the one it was recorded with, unless given. Exits if anything fails.
+func openReplay(filename, romFile string) (*replay.Replay, ines.Cartridge, string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Printf("[ERROR] failed to open replay file: %s", err)
+		os.Exit(1)
+	}
+
+	rep, err := replay.Read(f)
+	_ = f.Close()
+
+	if err != nil {
+		log.Printf("[ERROR] failed to read replay: %s", err)
+		os.Exit(1)
+	}
+
+	if romFile == "" {
+		romFile = rep.ROMFile
+	}
+
+	rom, err := ines.NewFromFile(romFile)
+	if err != nil {
+		log.Printf("[ERROR] failed to open rom file: %s", err)
+		os.Exit(1)
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		log.Printf("[ERROR] failed to open rom file: %s", err)
+		os.Exit(1)
+	}
+
+	return rep, cart, romFile
+}
+
+// verifyReplay plays the replay back headless and checks that it ends in the
+// recorded state.
+func verifyReplay(args []string) {
+	var (
+		romFile    string
+		jsonOutput bool
+	)
+
+	fs := replayFlags("verify")
+	fs.StringVar(&romFile, "rom", "", "rom file to play the replay with (default: the one it was recorded with)")
+	fs.BoolVar(&jsonOutput, "json", false, "print the result as json")
+
+	_ = fs.Parse(args) // exits on error
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	log.Default().SetFlags(0)
+	log.Default().SetOutput(loglevel.New(os.Stderr, loglevel.LevelWarn))
+
+	rep, cart, romFile := openReplay(fs.Arg(0), romFile)
+
+	result := &replayResult{
+		Replay: fs.Arg(0),
+		ROM:    romFile,
+		Frames: len(rep.Inputs),
+		CRC32:  fmt.Sprintf("%08X", rep.FinalCRC32),
+		Passed: true,
+	}
+
+	if err := rep.Verify(cart); err != nil {
+		result.Passed = false
+		result.Error = err.Error()
+	}
+
+	switch {
+	case jsonOutput:
+		printJSON(result)
+	case result.Passed:
+		fmt.Printf("OK: %d frames, state crc32 %s\n", result.Frames, result.CRC32)
+	default:
+		fmt.Printf("FAIL: %s\n", result.Error)
+	}
+
+	if !result.Passed {
+		os.Exit(1)
+	}
+}
+
+// playReplay plays the replay back at the normal speed in the window, or as
+// fast as possible with -headless, optionally rendering it into a video or png
+// frames along the way.
+func playReplay(args []string) {
+	var (
+		romFile   string
+		headless  bool
+		video     string
+		framesDir string
+		scale     int
+	)
+
+	fs := replayFlags("play")
+	fs.StringVar(&romFile, "rom", "", "rom file to play the replay with (default: the one it was recorded with)")
+	fs.BoolVar(&headless, "headless", false, "play without a window and sound, as fast as possible")
+	fs.StringVar(&video, "video", "", "render the replay into a video file using ffmpeg")
+	fs.StringVar(&framesDir, "framesdir", "", "save every frame into the directory as a png file")
+	fs.IntVar(&scale, "scale", 2, "scale factor of the window")
+
+	_ = fs.Parse(args) // exits on error
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	log.Default().SetFlags(0)
+	log.Default().SetOutput(loglevel.New(os.Stderr, loglevel.LevelInfo))
+
+	rep, cart, _ := openReplay(fs.Arg(0), romFile)
+
+	player, err := rep.NewPlayer(cart)
+	if err != nil {
+		log.Printf("[ERROR] failed to play replay: %s", err)
+		os.Exit(1)
+	}
+
+	nes := player.System()
+
+	var rec *recorder.Recorder
+
+	if video != "" {
+		if rec, err = startRecording(video); err != nil {
+			log.Printf("[ERROR] failed to start recording: %s", err)
+			os.Exit(1)
+		}
+
+		defer stopRecording(rec)
+	}
+
+	if framesDir != "" {
+		if err := os.MkdirAll(framesDir, 0755); err != nil {
+			log.Printf("[ERROR] failed to create frames directory: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	var (
+		w     *ui.Window
+		audio *ui.AudioOut
+	)
+
+	if !headless {
+		cfg := loadConfig()
+
+		w = ui.CreateWindow(ui.WindowOptions{Scale: max(1, scale), HUD: cfg.hudLayout()})
+		defer w.Close()
+
+		w.SetTitle(filepath.Base(fs.Arg(0)) + " - " + windowTitle)
+		w.SetFrameRate(consts.FrameRate)
+
+		audio = ui.CreateAudio(consts.AudioSamplesPerSecond, consts.AudioSampleSize, 1, consts.AudioBufferSize)
+		audio.SetVolume(cfg.Audio.Volume)
+		defer audio.Close()
+	}
+
+	var (
+		sampleClock system.SampleClock
+		audioBuffer = make([]float32, consts.AudioBufferSize)
+		finished    = !player.Advance()
+	)
+
+	log.Printf("[INFO] playing replay: %s (%d frames)", fs.Arg(0), len(rep.Inputs))
+
+playback:
+	for !finished {
+		for i := range audioBuffer {
+			for j, ticks := 0, sampleClock.Next(); j < ticks; j++ {
+				nes.Tick()
+
+				if !nes.FrameReady() {
+					continue
+				}
+
+				if rec != nil {
+					rec.WriteFrame(nes.Frame())
+				}
+
+				if framesDir != "" {
+					if err := saveFramePNG(framesDir, player.Frame(), nes.Frame()); err != nil {
+						log.Printf("[ERROR] failed to save frame: %s", err)
+						os.Exit(1)
+					}
+				}
+
+				if w != nil {
+					if w.ShouldClose() {
+						break playback
+					}
+
+					w.Refresh(nes.Frame())
+				}
+
+				// Not a single tick past the last frame, so that the state
+				// can be compared with the recorded one.
+				if !player.Advance() {
+					finished = true
+					break playback
+				}
+			}
+
+			audioBuffer[i] = nes.AudioSample()
+		}
+
+		if audio != nil {
+			audio.WaitStreamProcessed()
+			audio.UpdateStream(audioBuffer)
+		}
+
+		if rec != nil {
+			rec.WriteAudio(audioBuffer)
+		}
+	}
+
+	if !finished {
+		log.Printf("[INFO] replay stopped at frame %d of %d", player.Frame(), len(rep.Inputs))
+		return
+	}
+
+	if err := player.Verify(); err != nil {
+		log.Printf("[WARN] %s", err)
+	} else {
+		log.Printf("[INFO] replay finished in the recorded state")
+	}
+
+	// The last frame stays on the screen until the window is closed.
+	if w != nil {
+		audio.SetPaused(true)
+		w.ShowMessage("Replay finished")
+
+		for !w.ShouldClose() {
+			w.Refresh(nes.Frame())
+		}
+	}
+}
+
+// saveFramePNG saves the frame into the directory, numbered from 1, so that the
+// frames can be put together with other tools, e.g. ffmpeg -i %06d.png.
+func saveFramePNG(dir string, n int, frame []color.RGBA) error {
+	img := image.NewRGBA(image.Rect(0, 0, ppu.FrameWidth, ppu.FrameHeight))
+
+	for i, c := range frame {
+		img.SetRGBA(i%ppu.FrameWidth, i/ppu.FrameWidth, c)
+	}
+
+	f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%06d.png", n)))
+	if err != nil {
+		return err
+	}
+
+	encodeErr := png.Encode(f, img)
+	closeErr := f.Close()
+
+	return errors.Join(encodeErr, closeErr)
+}
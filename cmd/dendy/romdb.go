@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/maxpoletaev/dendy/ines"
+)
+
+const romDBFile = "romdb.txt"
+
+// loadROMDB adds the header fixes from the config directory to the embedded
+// ones, for the bad dumps the emulator does not know about. The file is
+// optional, so it is not reported when missing.
+func loadROMDB() {
+	configFile, err := configFile()
+	if err != nil {
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(configFile), romDBFile))
+	if err != nil {
+		return
+	}
+
+	if err := ines.AddROMDB(string(data)); err != nil {
+		log.Printf("[WARN] failed to load rom database: %s", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// runAhead hides one frame of input lag, which most games have between reading
+// the controller and drawing the result. Every frame, the next one is emulated
+// with the current input and displayed, and then the emulator is rolled back.
+type runAhead struct {
+	state  *bytes.Buffer
+	reader *binario.Reader
+	writer *binario.Writer
+}
+
+func newRunAhead() *runAhead {
+	buf := bytes.NewBuffer(nil)
+
+	return &runAhead{
+		state:  buf,
+		reader: binario.NewReader(buf, binary.LittleEndian),
+		writer: binario.NewWriter(buf, binary.LittleEndian),
+	}
+}
+
+// next emulates the next frame and restores the current state. The frame buffer
+// is not part of the state, so it keeps the next frame until it is emulated for
+// real with the same input. The audio of the extra frame is discarded, and the
+// rewind is suspended, so that the frame rolled back is not rewound to.
+func (r *runAhead) next(nes *system.System) {
+	if nes.RewindEnabled() {
+		nes.SetRewindEnabled(false)
+		defer nes.SetRewindEnabled(true)
+	}
+
+	r.state.Reset()
+
+	if err := nes.SaveState(r.writer); err != nil {
+		panic(fmt.Sprintf("run-ahead: failed to save state: %s", err))
+	}
+
+	for {
+		nes.Tick()
+
+		if nes.FrameReady() {
+			break
+		}
+	}
+
+	if err := nes.LoadState(r.reader); err != nil {
+		panic(fmt.Sprintf("run-ahead: failed to restore state: %s", err))
+	}
+}
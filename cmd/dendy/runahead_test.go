@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// The frame run ahead is rolled back, so no rewind point is made of it, while
+// the frames emulated for real still make them.
+func TestRunAhead_NoRewindPoint(t *testing.T) {
+	data := testutil.NewROMFile(0, 1, 1)
+	copy(data.PRG(), []byte{0x4C, 0x00, 0x80}) // JMP $8000
+	data.SetResetVector(0x8000)
+
+	rom, err := ines.NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nes := system.New(cart, input.NewJoystick(), input.NewJoystick())
+	nes.SetRewindEnabled(true)
+
+	newRunAhead().next(nes)
+	testutil.Equal(t, nes.RewindEnabled(), true)
+
+	gen := nes.Generation()
+	nes.Rewind()
+	testutil.Equal(t, nes.Generation(), gen)
+
+	for !nes.FrameReady() {
+		nes.Tick()
+	}
+
+	nes.Rewind()
+	testutil.Equal(t, nes.Generation(), gen+1)
+}
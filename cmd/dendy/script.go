@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/script"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// loadScript loads the Lua script selected with the -script flag, or returns nil
+// if there is none. Exits if the script cannot be loaded.
+func loadScript(nes *system.System, joy *input.Joystick, opts *options, showText func(string)) *script.Engine {
+	if opts.script == "" {
+		return nil
+	}
+
+	engine, err := script.Load(opts.script, script.Options{
+		System:   nes,
+		Joypads:  [2]*input.Joystick{joy, nil},
+		ShowText: showText,
+	})
+	if err != nil {
+		log.Printf("[ERROR] failed to load script: %s", err)
+		os.Exit(1)
+	}
+
+	log.Printf("[INFO] script loaded: %s", opts.script)
+
+	return engine
+}
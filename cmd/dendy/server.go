@@ -88,6 +88,10 @@ func runAsServer(cart ines.Cartridge, opts *options, saveFile string, rom *ines.
 
 	nes := system.New(cart, joy1, joy2)
 	nes.SetNoSpriteLimit(opts.noSpriteLimit)
+	applyPalette(nes, opts)
+	enableCrashTrace(nes)
+
+	defer recoverCrash(nes, opts)
 
 	if !opts.noSave {
 		if ok, err := loadState(nes, saveFile); err != nil {
@@ -98,9 +102,8 @@ func runAsServer(cart ines.Cartridge, opts *options, saveFile string, rom *ines.
 		}
 	}
 
-	audio := ui.CreateAudio(consts.AudioSamplesPerSecond, consts.AudioSampleSize, 1, consts.AudioBufferSize)
+	audio := createAudio(opts)
 	defer audio.Close()
-	audio.Mute(opts.mute)
 
 	game := netplay.NewGame(nes, audio, joy1, joy2)
 	game.Init(nil)
@@ -142,7 +145,7 @@ func runAsServer(cart ines.Cartridge, opts *options, saveFile string, rom *ines.
 	}
 
 	log.Printf("[INFO] waiting for client to connect to %s (%s)...", listenAddr, protocol)
-	sess, addr, err := netplay.Listen(protocol, listenAddr, game)
+	sess, addr, err := netplay.Listen(protocol, listenAddr, opts.listenTimeout, game)
 
 	if err != nil {
 		log.Printf("[ERROR] failed to listen: %v", err)
@@ -154,22 +157,24 @@ func runAsServer(cart ines.Cartridge, opts *options, saveFile string, rom *ines.
 
 	sess.SendInitialState()
 
-	w := ui.CreateWindow(opts.scale, opts.verbose)
+	w := ui.CreateWindow(opts.windowOptions())
 	defer w.Close()
 
-	w.SetTitle(fmt.Sprintf("%s (P1)", windowTitle))
-	w.SetFrameRate(consts.FramesPerSecond)
+	setGameTitle(w, opts, "(P1)")
+	w.SetFrameRate(consts.FrameRate)
 	w.ResyncDelegate = sess.SendResync
 	w.InputDelegate = sess.SendButtons
 	w.ResetDelegate = sess.SendReset
-	w.MuteDelegate = audio.ToggleMute
+	setupVolumeControls(w, audio, opts)
+	setupSettingsMenu(w, audio, nes, opts, false)
+	w.PauseDelegate = sess.SendTogglePause
+	sess.MessageDelegate = w.ShowMessage
 	w.ShowFPS = opts.showFPS
+	w.ShowPerf = opts.showPerf
 	w.ShowPing = true
 
-	if !opts.noCRT {
-		log.Printf("[INFO] using experimental CRT effect, disable with -nocrt flag")
-		w.EnableCRT()
-	}
+	enableShader(w, opts)
+	loadBezel(w, opts)
 
 	for {
 		startTime := time.Now()
@@ -181,16 +186,26 @@ func runAsServer(cart ines.Cartridge, opts *options, saveFile string, rom *ines.
 		}
 
 		if sess.ShouldExit() {
-			log.Printf("[INFO] client disconnected")
+			if err := sess.Err(); err != nil {
+				log.Printf("[ERROR] disconnected: %s", err)
+			} else {
+				log.Printf("[INFO] client disconnected")
+			}
+
 			break
 		}
 
 		w.HandleHotKeys()
 		w.UpdateJoystick()
 		w.SetPingInfo(sess.RemotePing())
+		w.SetPaused(sess.Paused())
 
 		sess.HandleMessages()
 		sess.RunFrame(startTime)
+		w.SetFrameTimes(time.Since(startTime)-game.RollbackTime(), game.RollbackTime())
+		opts.metrics.rollback(game.RollbackFrames())
+		opts.metrics.frame()
+		opts.frameTimer.frame()
 
 		w.Refresh(nes.Frame())
 	}
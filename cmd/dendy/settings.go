@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/maxpoletaev/dendy/ppu"
+	"github.com/maxpoletaev/dendy/shaders"
+	"github.com/maxpoletaev/dendy/system"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+var (
+	scaleModes  = []ui.ScaleMode{ui.ScaleModeFit, ui.ScaleModeInteger, ui.ScaleModeStretch}
+	filters     = []ui.ScaleFilter{ui.ScaleFilterNearest, ui.ScaleFilterSharpBilinear}
+	overlays    = []ui.Overlay{ui.OverlayNone, ui.OverlayScanlines, ui.OverlayGrille}
+	shaderNames = []string{"none", "scanline", "crt"}
+)
+
+// cycle returns the element following (or preceding, for negative delta) the
+// current one, wrapping around. Unknown values start from the first element.
+func cycle[T comparable](values []T, current T, delta int) T {
+	for i, v := range values {
+		if v == current {
+			return values[(i+delta+len(values))%len(values)]
+		}
+	}
+
+	return values[0]
+}
+
+func onOff(v bool) string {
+	if v {
+		return "on"
+	}
+
+	return "off"
+}
+
+// ffVolumeStep is the change of the fast-forward volume in the settings menu,
+// in percent.
+const ffVolumeStep = 25
+
+// micBindingName is the name of the microphone key binding in the config.
+const micBindingName = "mic"
+
+// applyKeyBindings assigns the keys from the config to the joystick buttons and
+// the microphone.
+func applyKeyBindings(w *ui.Window, bindings map[string]string) {
+	if name, ok := bindings[micBindingName]; ok {
+		if key, err := ui.ParseKey(name); err != nil {
+			log.Printf("[WARN] invalid key binding for %s: %s", micBindingName, err)
+		} else {
+			w.BindMicrophoneKey(key)
+		}
+	}
+
+	for _, b := range ui.ButtonNames {
+		name, ok := bindings[b.Name]
+		if !ok {
+			continue
+		}
+
+		key, err := ui.ParseKey(name)
+		if err != nil {
+			log.Printf("[WARN] invalid key binding for %s: %s", b.Name, err)
+			continue
+		}
+
+		w.BindKey(b.Button, key)
+	}
+}
+
+// setupSettingsMenu applies the key bindings and the input profile from the
+// config and populates the settings menu (opened with Esc). Every change is
+// saved to the config file right away. The slot menu item is only displayed if
+// save slots are available. Must be called after the input delegate is set.
+func setupSettingsMenu(w *ui.Window, audio *ui.AudioOut, nes *system.System, opts *options, withSlots bool) {
+	cfg := opts.config
+	applyKeyBindings(w, cfg.Input)
+
+	// The keys assigned while a profile is in use are stored in the profile.
+	bindings := &cfg.Input
+
+	if p := opts.profile(); p != nil {
+		applyKeyBindings(w, p.Keys)
+		w.InputDelegate = withInputProfile(opts, w.InputDelegate)
+		bindings = &p.Keys
+	}
+
+	w.MenuDelegate = func() []ui.MenuItem {
+		items := []ui.MenuItem{
+			{
+				Label: "Resume",
+				Action: func() {
+					w.CloseMenu()
+				},
+			},
+			{
+				Label: "Scale mode",
+				Value: func() string { return opts.scaleMode },
+				Change: func(delta int) {
+					mode, _ := ui.ParseScaleMode(opts.scaleMode)
+					mode = cycle(scaleModes, mode, delta)
+					w.SetScaleMode(mode)
+
+					opts.scaleMode = mode.String()
+					cfg.Display.ScaleMode = opts.scaleMode
+					cfg.save()
+				},
+			},
+			{
+				Label: "Filter",
+				Value: func() string { return opts.filter },
+				Change: func(delta int) {
+					filter, _ := ui.ParseScaleFilter(opts.filter)
+					filter = cycle(filters, filter, delta)
+					w.SetScaleFilter(filter)
+
+					opts.filter = filter.String()
+					cfg.Display.Filter = opts.filter
+					cfg.save()
+				},
+			},
+			{
+				Label: "Pixel aspect 8:7",
+				Value: func() string { return onOff(opts.pixelAspect) },
+				Change: func(int) {
+					opts.pixelAspect = !opts.pixelAspect
+					w.SetPixelAspect(opts.pixelAspect)
+
+					cfg.Display.PixelAspect = opts.pixelAspect
+					cfg.save()
+				},
+			},
+			{
+				Label: "Overlay",
+				Value: func() string { return opts.overlay },
+				Change: func(delta int) {
+					overlay, _ := ui.ParseOverlay(opts.overlay)
+					overlay = cycle(overlays, overlay, delta)
+					w.SetOverlay(overlay)
+
+					opts.overlay = overlay.String()
+					cfg.Display.Overlay = opts.overlay
+					cfg.save()
+				},
+			},
+			{
+				Label: "Shader",
+				Value: func() string { return opts.shader },
+				Change: func(delta int) {
+					opts.shader = cycle(shaderNames, opts.shader, delta)
+
+					if code, ok := shaders.Presets[opts.shader]; ok && !opts.noCRT {
+						w.EnableShader(code)
+					} else {
+						w.DisableShader()
+					}
+
+					cfg.Display.Shader = opts.shader
+					cfg.save()
+				},
+			},
+			{
+				Label: "Palette",
+				Value: func() string { return opts.palette },
+				Change: func(delta int) {
+					opts.palette = cycle(ppu.PaletteNames, opts.palette, delta)
+					nes.SetPalette(ppu.Palettes[opts.palette])
+
+					cfg.Display.Palette = opts.palette
+					cfg.save()
+				},
+			},
+			{
+				Label: "Volume",
+				Value: func() string { return fmt.Sprintf("%d%%", int(audio.Volume()*100+0.5)) },
+				Change: func(delta int) {
+					w.ChangeVolume(float32(delta) * ui.VolumeStep)
+				},
+			},
+		}
+
+		// The fast-forward and the timing are only changed offline, as the
+		// remote player would go out of sync.
+		if opts.command == cmdRun || opts.command == cmdRecord {
+			items = append(items, ui.MenuItem{
+				Label: "Fast-forward volume",
+				Value: func() string { return fmt.Sprintf("%d%%", opts.ffVolume) },
+				Change: func(delta int) {
+					opts.ffVolume = max(0, min(100, opts.ffVolume+delta*ffVolumeStep))
+
+					volume := opts.ffVolume
+					cfg.Audio.FastForwardVolume = &volume
+					cfg.save()
+				},
+			})
+		}
+
+		// The videos and the replays are always recorded with NTSC.
+		if opts.command == cmdRun {
+			items = append(items, ui.MenuItem{
+				Label: "Region",
+				Value: func() string {
+					if opts.region == "auto" {
+						return "auto (" + nes.Region().String() + ")"
+					}
+
+					return opts.region
+				},
+				Change: func(delta int) {
+					opts.region = cycle(regionNames, opts.region, delta)
+					nes.SetRegion(opts.consoleRegion(nes.ROM()))
+					w.SetFrameRate(nes.FrameRate())
+
+					cfg.General.Region = opts.region
+					cfg.save()
+				},
+			})
+		}
+
+		for _, b := range ui.ButtonNames {
+			b := b
+
+			items = append(items, ui.MenuItem{
+				Label: "Button " + b.Name,
+				Value: func() string {
+					if key, ok := w.BoundKey(b.Button); ok {
+						return ui.KeyName(key)
+					}
+
+					return "none"
+				},
+				BindKey: func(key int32) {
+					w.BindKey(b.Button, key)
+
+					if *bindings == nil {
+						*bindings = make(map[string]string)
+					}
+
+					// Store all bindings, as assigning the key may have
+					// unbound it from another button.
+					for _, b := range ui.ButtonNames {
+						if key, ok := w.BoundKey(b.Button); ok {
+							(*bindings)[b.Name] = ui.KeyName(key)
+						} else {
+							delete(*bindings, b.Name)
+						}
+					}
+
+					cfg.save()
+				},
+			})
+		}
+
+		items = append(items, ui.MenuItem{
+			Label: "Microphone",
+			Value: func() string { return ui.KeyName(w.MicrophoneKey()) },
+			BindKey: func(key int32) {
+				w.BindMicrophoneKey(key)
+
+				if *bindings == nil {
+					*bindings = make(map[string]string)
+				}
+
+				(*bindings)[micBindingName] = ui.KeyName(key)
+				cfg.save()
+			},
+		})
+
+		if withSlots {
+			items = append(items, ui.MenuItem{
+				Label:  "Save states...",
+				Action: w.OpenSlotMenu,
+			})
+		}
+
+		return items
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/maxpoletaev/dendy/system"
+	"github.com/maxpoletaev/dendy/ui"
+)
+
+const numSaveSlots = 6
+
+// slotFile returns the name of the state file for the given zero-based slot,
+// e.g. game.save.1 for the first slot.
+func slotFile(saveFile string, slot int) string {
+	return fmt.Sprintf("%s.%d", saveFile, slot+1)
+}
+
+func thumbnailFile(stateFile string) string {
+	return stateFile + ".png"
+}
+
+func loadThumbnail(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return png.Decode(f)
+}
+
+// listSlots collects the information about all save slots for the slot menu.
+// The time and the thumbnail are taken from the state metadata. The states saved
+// before it existed have the thumbnail in a separate file, which may be missing.
+func listSlots(saveFile string) []ui.SaveSlot {
+	slots := make([]ui.SaveSlot, numSaveSlots)
+
+	for i := range slots {
+		stateFile := slotFile(saveFile, i)
+
+		info, err := readStateInfo(stateFile)
+		if err == nil {
+			slots[i].Time = info.Time
+			slots[i].Thumbnail = info.Thumbnail
+			continue
+		}
+
+		if os.IsNotExist(err) {
+			slots[i].Empty = true
+			continue
+		}
+
+		if !errors.Is(err, system.ErrNoStateInfo) {
+			log.Printf("[WARN] failed to read state metadata: %s", err)
+		}
+
+		if stat, err := os.Stat(stateFile); err == nil {
+			slots[i].Time = stat.ModTime()
+		}
+
+		thumbnail, err := loadThumbnail(thumbnailFile(stateFile))
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("[WARN] failed to load thumbnail: %s", err)
+		}
+
+		slots[i].Thumbnail = thumbnail
+	}
+
+	return slots
+}
+
+func readStateInfo(stateFile string) (system.StateInfo, error) {
+	f, err := os.Open(stateFile)
+	if err != nil {
+		return system.StateInfo{}, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return system.ReadStateInfo(f)
+}
+
+func saveSlot(nes *system.System, saveFile string, slot int) error {
+	stateFile := slotFile(saveFile, slot)
+
+	if err := saveState(nes, stateFile); err != nil {
+		log.Printf("[ERROR] failed to save state: %s", err)
+		return err
+	}
+
+	// The thumbnail is stored in the state now, the old one would be stale.
+	if err := os.Remove(thumbnailFile(stateFile)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[WARN] failed to remove old thumbnail: %s", err)
+	}
+
+	log.Printf("[INFO] state saved: %s", stateFile)
+
+	return nil
+}
+
+func loadSlot(nes *system.System, saveFile string, slot int) error {
+	stateFile := slotFile(saveFile, slot)
+
+	if _, err := loadState(nes, stateFile); err != nil {
+		log.Printf("[ERROR] failed to load state: %s", err)
+		return err
+	}
+
+	log.Printf("[INFO] state loaded: %s", stateFile)
+
+	return nil
+}
+
+// startupStateFile returns the state to load at startup, which is either
+// selected with the -loadstate flag as a slot number or a path, or the save
+// file. Returns an empty string if nothing is to be loaded, as in hardcore
+// mode, where the save file is only written.
+func (o *options) startupStateFile(saveFile string) (filename string, explicit bool) {
+	if o.loadState == "" {
+		if o.noSave || o.hardcore {
+			return "", false
+		}
+
+		return saveFile, false
+	}
+
+	if slot, err := strconv.Atoi(o.loadState); err == nil && slot >= 1 && slot <= numSaveSlots {
+		return slotFile(saveFile, slot-1), true
+	}
+
+	return o.loadState, true
+}
+
+// loadStartupState loads the state at startup and exits if it fails. The state
+// selected explicitly must exist, while the save file may not exist yet.
+func loadStartupState(nes *system.System, filename string, explicit bool) {
+	ok, err := loadState(nes, filename)
+	if err != nil {
+		log.Printf("[ERROR] failed to load save file: %s", err)
+		os.Exit(1)
+	}
+
+	if !ok {
+		if explicit {
+			log.Printf("[ERROR] state not found: %s", filename)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	log.Printf("[INFO] state loaded: %s", filename)
+}
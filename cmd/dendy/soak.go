@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/maxpoletaev/dendy/internal/loglevel"
+	"github.com/maxpoletaev/dendy/internal/soak"
+)
+
+const soakUsage = "usage: dendy soak [-frames=10000] [-seed=1] [-state=60] [-reset=0] [-synth=0] [romfile...]"
+
+// runSoak runs the "soak" subcommand, which runs the games with the random
+// input for a long time, checking that the emulation does not crash and the
+// save states load back the same. Besides the games given, it can make up the
+// games for every supported mapper, that poke the registers at random.
+func runSoak(args []string) {
+	var (
+		frames     int
+		seed       int64
+		stateEvery int
+		resetEvery int
+		synth      int
+	)
+
+	fs := flag.NewFlagSet("soak", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, soakUsage); fs.PrintDefaults() }
+	fs.IntVar(&frames, "frames", 10000, "frames to run every game for")
+	fs.Int64Var(&seed, "seed", 1, "seed of the random input and the synthesized games")
+	fs.IntVar(&stateEvery, "state", 60, "frames between the save state checks (0 to skip them)")
+	fs.IntVar(&resetEvery, "reset", 0, "average frames between the resets (0 to never reset)")
+	fs.IntVar(&synth, "synth", 0, "number of the games to synthesize for every mapper")
+
+	_ = fs.Parse(args) // exits on error
+
+	if (fs.NArg() == 0 && synth == 0) || frames < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// The games poking the registers at random make the mappers warn a lot.
+	log.Default().SetFlags(0)
+	log.Default().SetOutput(loglevel.New(os.Stderr, loglevel.LevelError))
+
+	opts := soak.Options{
+		Frames:     frames,
+		Seed:       seed,
+		StateEvery: stateEvery,
+		ResetEvery: resetEvery,
+	}
+
+	var failed int
+
+	run := func(name string, data []byte) {
+		err := soak.Run(data, opts)
+		if err == nil {
+			fmt.Printf("PASS  %s (%d frames)\n", name, frames)
+			return
+		}
+
+		failed++
+		fmt.Printf("FAIL  %s: %s\n", name, err)
+
+		var f *soak.Failure
+		if errors.As(err, &f) && f.Stack != nil {
+			fmt.Printf("\n%s\n", f.Stack)
+		}
+	}
+
+	for _, romFile := range fs.Args() {
+		data, err := os.ReadFile(romFile)
+		if err != nil {
+			log.Printf("[ERROR] failed to read rom: %s", err)
+			os.Exit(1)
+		}
+
+		run(romFile, data)
+	}
+
+	for i := int64(0); i < int64(synth); i++ {
+		for _, mapperID := range soak.SynthMappers {
+			run(fmt.Sprintf("mapper%d-seed%d", mapperID, seed+i), soak.SynthROM(mapperID, seed+i))
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d failed\n", failed)
+		os.Exit(1)
+	}
+}
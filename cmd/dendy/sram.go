@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/maxpoletaev/dendy/ines"
+)
+
+// loadSRAM reads the battery-backed PRG-RAM of the game from the .sav file, so
+// that the saves the game makes itself are kept between the runs, like on the
+// real cartridge, apart from the save states. The missing file is the first
+// run, so it is not reported.
+func loadSRAM(cart ines.Cartridge, filename string) {
+	battery, ok := ines.AsBatteryBacked(cart)
+	if !ok {
+		return
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[WARN] failed to load battery save: %s", err)
+		}
+
+		return
+	}
+
+	if loader, ok := battery.(ines.RAMLoader); ok {
+		if err := loader.LoadRAM(data); err != nil {
+			log.Printf("[WARN] failed to load battery save: %s", err)
+			return
+		}
+
+		log.Printf("[INFO] battery save loaded: %s", filename)
+
+		return
+	}
+
+	ram := battery.SaveRAM()
+	if len(data) != len(ram) {
+		log.Printf("[WARN] battery save is %d bytes, expected %d", len(data), len(ram))
+	}
+
+	copy(ram, data)
+	log.Printf("[INFO] battery save loaded: %s", filename)
+}
+
+// saveSRAM writes the battery-backed PRG-RAM into the .sav file, through the
+// temporary file, so that the previous saves are not lost if the write fails.
+func saveSRAM(cart ines.Cartridge, filename string) {
+	battery, ok := ines.AsBatteryBacked(cart)
+	if !ok || filename == "" {
+		return
+	}
+
+	tmpFile := filename + ".tmp"
+
+	if err := os.WriteFile(tmpFile, battery.SaveRAM(), 0644); err != nil {
+		log.Printf("[ERROR] failed to write battery save: %s", err)
+		return
+	}
+
+	if err := os.Rename(tmpFile, filename); err != nil {
+		log.Printf("[ERROR] failed to write battery save: %s", err)
+		_ = os.Remove(tmpFile)
+
+		return
+	}
+
+	log.Printf("[INFO] battery save written: %s", filename)
+}
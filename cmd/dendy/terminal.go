@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"time"
+
+	"github.com/maxpoletaev/dendy/consts"
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/loglevel"
+	"github.com/maxpoletaev/dendy/system"
+	"github.com/maxpoletaev/dendy/ui/terminal"
+)
+
+// runInTerminal runs the emulation in the terminal instead of a window. There
+// is no sound, and the emulation speed is kept by a timer.
+func runInTerminal(cart ines.Cartridge, opts *options, saveFile string) {
+	joy1 := input.NewJoystick()
+	zapper := input.NewZapper()
+
+	nes := system.New(cart, joy1, zapper)
+	nes.SetNoSpriteLimit(opts.noSpriteLimit)
+	applyPalette(nes, opts)
+
+	defer saveSRAM(cart, opts.sramFile)
+
+	if loadFile, explicit := opts.startupStateFile(saveFile); loadFile != "" {
+		loadStartupState(nes, loadFile, explicit)
+	}
+
+	screen, err := terminal.Open(terminal.Options{
+		TrueColor: terminal.DetectTrueColor(),
+	})
+	if err != nil {
+		log.Printf("[ERROR] failed to open terminal: %s", err)
+		os.Exit(1)
+	}
+
+	// Log messages would mess up the picture, so they are held back until the
+	// terminal is restored.
+	var logs bytes.Buffer
+	log.Default().SetOutput(loglevel.New(&logs, opts.logLevel()))
+
+	var paused bool
+	screen.InputDelegate = withInputProfile(opts, joy1.SetButtons)
+	screen.ResetDelegate = nes.Reset
+	screen.PauseDelegate = func() {
+		paused = !paused
+	}
+
+	ticker := time.NewTicker(consts.FrameDuration)
+
+	for !screen.ShouldClose() {
+		<-ticker.C
+
+		screen.UpdateJoystick()
+		screen.HandleHotKeys()
+
+		if paused {
+			continue
+		}
+
+		for {
+			nes.Tick()
+
+			if nes.FrameReady() {
+				break
+			}
+		}
+
+		screen.Refresh(nes.Frame())
+	}
+
+	ticker.Stop()
+	screen.Close()
+
+	log.Default().SetOutput(loglevel.New(os.Stderr, opts.logLevel()))
+	_, _ = logs.WriteTo(os.Stderr)
+
+	if !opts.noSave {
+		if err := saveState(nes, saveFile); err != nil {
+			log.Printf("[ERROR] failed to save state: %s", err)
+			os.Exit(1)
+		}
+
+		log.Printf("[INFO] state saved: %s", saveFile)
+	}
+}
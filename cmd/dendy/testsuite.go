@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/maxpoletaev/dendy/console"
+	"github.com/maxpoletaev/dendy/internal/loglevel"
+	"github.com/maxpoletaev/dendy/internal/testrom"
+)
+
+const testSuiteUsage = "usage: dendy testsuite [-manifest=romdir/suite.toml] [-timeout=3600] [-json] romdir"
+
+// suiteManifest lists the test ROMs of the suite with their pass criteria:
+//
+//	[[rom]]
+//	file = "cpu_instrs.nes"
+//	status = true
+//	timeout = 3000
+//
+//	[[rom]]
+//	file = "palette.nes"
+//	frame = "crc32:7cbf3676"
+//	memory = [{ addr = 0x00F0, value = 1 }]
+//
+// The files are relative to the ROM directory. See testrom.Criteria for the
+// meaning of the criteria.
+type suiteManifest struct {
+	ROMs []suiteROM `toml:"rom"`
+}
+
+type suiteROM struct {
+	File string `toml:"file"`
+	testrom.Criteria
+}
+
+// suiteResult is what the "testsuite" subcommand reports with -json.
+type suiteResult struct {
+	ROMs   []suiteROMResult `json:"roms"`
+	Passed int              `json:"passed"`
+	Failed int              `json:"failed"`
+	Total  int              `json:"total"`
+}
+
+type suiteROMResult struct {
+	File    string `json:"file"`
+	Passed  bool   `json:"passed"`
+	Frames  int    `json:"frames"`
+	Message string `json:"message,omitempty"`
+}
+
+// runTestSuite runs the "testsuite" subcommand, which runs the test ROMs from
+// the directory against the criteria from the manifest and reports which of
+// them pass, so that the accuracy can be tracked between the versions.
+func runTestSuite(args []string) {
+	var (
+		manifestFile string
+		timeout      int
+		romDir       string
+		jsonOutput   bool
+	)
+
+	fs := flag.NewFlagSet("testsuite", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, testSuiteUsage); fs.PrintDefaults() }
+	fs.StringVar(&manifestFile, "manifest", "", "manifest with the pass criteria (default: romdir/suite.toml)")
+	fs.IntVar(&timeout, "timeout", 3600, "frames to wait for the roms without their own timeout")
+	fs.BoolVar(&jsonOutput, "json", false, "print the results as json once all roms are run")
+
+	_ = fs.Parse(args) // exits on error
+
+	// The flags are also accepted after the ROM directory.
+	for fs.NArg() > 0 {
+		if romDir != "" {
+			fs.Usage()
+			os.Exit(1)
+		}
+
+		romDir = fs.Arg(0)
+		_ = fs.Parse(fs.Args()[1:])
+	}
+
+	if romDir == "" || timeout < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if manifestFile == "" {
+		manifestFile = filepath.Join(romDir, "suite.toml")
+	}
+
+	log.Default().SetFlags(0)
+	log.Default().SetOutput(loglevel.New(os.Stderr, loglevel.LevelWarn))
+
+	var manifest suiteManifest
+
+	if _, err := toml.DecodeFile(manifestFile, &manifest); err != nil {
+		log.Printf("[ERROR] failed to read manifest: %s", err)
+		os.Exit(1)
+	}
+
+	warnUnlisted(romDir, manifest.ROMs)
+
+	var suite suiteResult
+
+	for _, r := range manifest.ROMs {
+		if r.Timeout == 0 {
+			r.Timeout = timeout
+		}
+
+		result := runSuiteROM(filepath.Join(romDir, r.File), r.Criteria)
+
+		suite.ROMs = append(suite.ROMs, suiteROMResult{
+			File:    r.File,
+			Passed:  result.Passed,
+			Frames:  result.Frames,
+			Message: result.Message,
+		})
+
+		if result.Passed {
+			suite.Passed++
+		} else {
+			suite.Failed++
+		}
+
+		// The text results are printed as they come, as the whole suite
+		// takes a while.
+		if !jsonOutput {
+			if result.Passed {
+				fmt.Printf("PASS  %s (%d frames)\n", r.File, result.Frames)
+			} else {
+				fmt.Printf("FAIL  %s: %s\n", r.File, result.Message)
+			}
+		}
+	}
+
+	suite.Total = suite.Passed + suite.Failed
+
+	if jsonOutput {
+		printJSON(&suite)
+	} else {
+		fmt.Printf("\n%d passed, %d failed, %d total\n", suite.Passed, suite.Failed, suite.Total)
+	}
+
+	if suite.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func runSuiteROM(romFile string, crit testrom.Criteria) testrom.Result {
+	if !crit.Status && crit.Frame == "" && len(crit.Memory) == 0 {
+		return testrom.Result{Message: "no pass criteria"}
+	}
+
+	c, err := console.Open(romFile)
+	if err != nil {
+		return testrom.Result{Message: err.Error()}
+	}
+
+	return testrom.Run(c, crit)
+}
+
+// warnUnlisted warns about the ROMs in the directory that are not in the
+// manifest, as they are easy to forget when adding the new tests.
+func warnUnlisted(romDir string, roms []suiteROM) {
+	listed := make(map[string]bool, len(roms))
+	for _, r := range roms {
+		listed[filepath.Clean(r.File)] = true
+	}
+
+	entries, err := os.ReadDir(romDir)
+	if err != nil {
+		log.Printf("[WARN] failed to list rom directory: %s", err)
+		return
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() && strings.EqualFold(filepath.Ext(e.Name()), ".nes") && !listed[e.Name()] {
+			log.Printf("[WARN] %s is not in the manifest", e.Name())
+		}
+	}
+}
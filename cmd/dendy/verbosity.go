@@ -0,0 +1,124 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/maxpoletaev/dendy/internal/loglevel"
+)
+
+// verbosity is the number of -v flags given. Each kind of the debug logs is
+// enabled from its own level, so that the noisiest ones only show up with -vv.
+type verbosity int
+
+// logLevel also enables the netplay debug logs, such as the drift window
+// changes and the rollbacks running out of time.
+func (v verbosity) logLevel() loglevel.Level {
+	if v >= 1 {
+		return loglevel.LevelDebug
+	}
+
+	return loglevel.LevelInfo
+}
+
+// mapperWarnings enables the warnings about the memory accesses the mappers do
+// not handle, which some games do every frame.
+func (v verbosity) mapperWarnings() bool {
+	return v >= 1
+}
+
+// raylibLogs enables the raylib info logs, e.g. the OpenGL details. Only the
+// raylib warnings are logged otherwise.
+func (v verbosity) raylibLogs() bool {
+	return v >= 2
+}
+
+// frameTiming enables logging the frame times once per second.
+func (v verbosity) frameTiming() bool {
+	return v >= 2
+}
+
+// verbosityFlag sets the verbosity to its level when given, so that both -v
+// and -vv can be used as boolean flags. The level can also be given as a
+// number, e.g. -v=2.
+type verbosityFlag struct {
+	v     *verbosity
+	level verbosity
+}
+
+func (f verbosityFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (f verbosityFlag) String() string {
+	if f.v == nil {
+		return "false"
+	}
+
+	return strconv.FormatBool(*f.v >= f.level)
+}
+
+func (f verbosityFlag) Set(s string) error {
+	if n, err := strconv.Atoi(s); err == nil {
+		*f.v = verbosity(n)
+		return nil
+	}
+
+	on, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+
+	if on {
+		*f.v = max(*f.v, f.level)
+	}
+
+	return nil
+}
+
+// frameTimer logs the average and the longest frame time every second. The
+// methods do nothing on nil, the same as with debugMetrics.
+type frameTimer struct {
+	lastFrame time.Time
+	total     time.Duration
+	longest   time.Duration
+	frames    int
+}
+
+func newFrameTimer(opts *options) *frameTimer {
+	if !opts.verbosity.frameTiming() {
+		return nil
+	}
+
+	return &frameTimer{}
+}
+
+// frame records the time since the previous frame.
+func (t *frameTimer) frame() {
+	if t == nil {
+		return
+	}
+
+	now := time.Now()
+
+	if !t.lastFrame.IsZero() {
+		elapsed := now.Sub(t.lastFrame)
+		t.total += elapsed
+		t.longest = max(t.longest, elapsed)
+		t.frames++
+	}
+
+	t.lastFrame = now
+
+	if t.total >= time.Second {
+		avg := t.total / time.Duration(t.frames)
+		log.Printf("[DEBUG] frame time: avg %.2fms, max %.2fms (%d frames)", ms(avg), ms(t.longest), t.frames)
+
+		t.total, t.longest, t.frames = 0, 0, 0
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// watchInterval is how often the ROM file is checked for changes.
+const watchInterval = 500 * time.Millisecond
+
+// romWatcher notices when the ROM is rebuilt, for the homebrew development. The
+// file is polled, as the assemblers and the linkers replace it in all sorts of
+// ways (writing in place, renaming over it, deleting and creating again), which
+// the file system events of each OS report differently.
+type romWatcher struct {
+	filename string
+	patch    string // applied to every build
+	size     int64
+	modTime  time.Time
+	changed  bool // since the last build loaded, waiting for the file to settle
+	lastPoll time.Time
+}
+
+func newROMWatcher(filename, patch string) *romWatcher {
+	w := &romWatcher{filename: filename, patch: patch, lastPoll: time.Now()}
+
+	if info, err := os.Stat(filename); err == nil {
+		w.size, w.modTime = info.Size(), info.ModTime()
+	}
+
+	return w
+}
+
+// poll returns the new build of the ROM once the file has changed. The build
+// is only loaded when the file stays the same between two polls, so that it is
+// not read while still being written. The broken build is reported and skipped
+// until the file changes again.
+func (w *romWatcher) poll() (*ines.ROM, bool) {
+	if time.Since(w.lastPoll) < watchInterval {
+		return nil, false
+	}
+
+	w.lastPoll = time.Now()
+
+	info, err := os.Stat(w.filename)
+	if err != nil {
+		return nil, false
+	}
+
+	if info.Size() != w.size || !info.ModTime().Equal(w.modTime) {
+		w.size, w.modTime, w.changed = info.Size(), info.ModTime(), true
+		return nil, false
+	}
+
+	if !w.changed {
+		return nil, false
+	}
+
+	w.changed = false
+
+	rom, err := loadROM(w.filename, w.patch)
+	if err != nil {
+		log.Printf("[WARN] failed to reload rom: %s", err)
+		return nil, false
+	}
+
+	return rom, true
+}
+
+// watchStateFile returns the state to load after every reload, selected with
+// the -watchstate flag as a slot number or a path. Returns an empty string to
+// start the new build from the power-on.
+func (o *options) watchStateFile(saveFile string) string {
+	if slot, err := strconv.Atoi(o.watchState); err == nil && slot >= 1 && slot <= numSaveSlots {
+		return slotFile(saveFile, slot-1)
+	}
+
+	return o.watchState
+}
+
+// loadRebuiltState loads the state saved with the previous build of the ROM.
+func loadRebuiltState(nes *system.System, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return nes.ReadStateFileRebuilt(f)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// pollNow polls the watcher without waiting for the interval.
+func pollNow(w *romWatcher) bool {
+	w.lastPoll = time.Time{}
+	_, ok := w.poll()
+
+	return ok
+}
+
+// The new build is loaded once the file stays the same between two polls, and
+// the broken one is skipped.
+func TestROMWatcher_Poll(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "game.nes")
+
+	write := func(data []byte) {
+		if err := os.WriteFile(filename, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(testutil.NewROMFile(0, 1, 1))
+	w := newROMWatcher(filename, "")
+	testutil.Equal(t, pollNow(w), false)
+
+	write(testutil.NewROMFile(0, 2, 1))
+	testutil.Equal(t, pollNow(w), false) // settling
+	testutil.Equal(t, pollNow(w), true)
+	testutil.Equal(t, pollNow(w), false) // loaded already
+
+	write([]byte("broken"))
+	testutil.Equal(t, pollNow(w), false)
+	testutil.Equal(t, pollNow(w), false)
+
+	// The interval between the polls is respected.
+	write(testutil.NewROMFile(0, 1, 1))
+	testutil.Equal(t, pollNow(w), false)
+	_, ok := w.poll()
+	testutil.Equal(t, ok, false)
+}
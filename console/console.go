@@ -0,0 +1,221 @@
+// Package console is the emulator for embedding into other Go programs. It puts
+// the console together from a ROM, the way the dendy command does, and runs it
+// frame by frame, leaving the windows, the audio output and the timing to the
+// program using it:
+//
+//	c, err := console.Open("game.nes")
+//	if err != nil {
+//		return err
+//	}
+//
+//	for {
+//		c.SetButtons(1, console.ButtonStart)
+//		c.RunFrame()
+//		draw(c.Frame())
+//		play(c.AudioSamples())
+//	}
+//
+// The packages it is built from, such as system and ines, are still available
+// for what is not covered here, but their API may change between versions.
+package console
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+
+	"github.com/maxpoletaev/dendy/consts"
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/ppu"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+const (
+	// FrameWidth and FrameHeight are the size of the frame in pixels.
+	FrameWidth  = ppu.FrameWidth
+	FrameHeight = ppu.FrameHeight
+
+	// SampleRate is the number of audio samples per second.
+	SampleRate = consts.AudioSamplesPerSecond
+
+	// FrameRate is the number of frames per second the games expect to run at.
+	FrameRate = consts.FrameRate
+)
+
+// Button is the set of the controller buttons, combined with bitwise or.
+type Button = input.Button
+
+const (
+	ButtonA      = input.ButtonA
+	ButtonB      = input.ButtonB
+	ButtonSelect = input.ButtonSelect
+	ButtonStart  = input.ButtonStart
+	ButtonUp     = input.ButtonUp
+	ButtonDown   = input.ButtonDown
+	ButtonLeft   = input.ButtonLeft
+	ButtonRight  = input.ButtonRight
+)
+
+// Console is the emulated console with the game inserted and the controllers
+// plugged into both ports. It is not safe for concurrent use, but the consoles
+// share no state, so that each one can run in its own goroutine.
+type Console struct {
+	system  *system.System
+	rom     *ines.ROM
+	joy     [2]*input.Joystick
+	clock   system.SampleClock
+	ticks   int // until the next audio sample
+	samples []float32
+}
+
+// New creates the console with the game from the iNES ROM data.
+func New(data []byte) (*Console, error) {
+	c := &Console{
+		joy:     [2]*input.Joystick{input.NewJoystick(), input.NewJoystick()},
+		samples: make([]float32, 0, consts.AudioBufferSize),
+	}
+
+	if err := c.LoadROM(data); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Open creates the console with the game from the iNES ROM file.
+func Open(filename string) (*Console, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(data)
+}
+
+// LoadROM replaces the game with the one from the iNES ROM data, as if the
+// console was powered off, the cartridge swapped and powered on again.
+func (c *Console) LoadROM(data []byte) error {
+	rom, err := ines.NewFromBuffer(data)
+	if err != nil {
+		return fmt.Errorf("invalid rom: %w", err)
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		return err
+	}
+
+	if c.system == nil {
+		c.system = system.New(cart, c.joy[0], c.joy[1])
+	} else {
+		c.system.InsertCartridge(cart)
+	}
+
+	c.rom = rom
+	c.clock = system.SampleClock{}
+	c.ticks = c.clock.Next()
+	c.samples = c.samples[:0]
+
+	return nil
+}
+
+// Reset presses the reset button on the console.
+func (c *Console) Reset() {
+	c.system.Reset()
+}
+
+// RunFrame emulates the console until the next frame is complete. It takes
+// about a sixtieth of the real time on the original hardware, so the program
+// must wait for the rest of it to run the game at its normal speed.
+func (c *Console) RunFrame() {
+	c.samples = c.samples[:0]
+
+	for {
+		c.system.Tick()
+
+		if c.ticks--; c.ticks == 0 {
+			c.ticks = c.clock.Next()
+			c.samples = append(c.samples, c.system.AudioSample())
+		}
+
+		if c.system.FrameReady() {
+			return
+		}
+	}
+}
+
+// Frame returns the pixels of the last frame, row by row. The slice is reused
+// and only valid until the next call to RunFrame.
+func (c *Console) Frame() []color.RGBA {
+	return c.system.Frame()
+}
+
+// FrameImage returns a copy of the last frame as an image.
+func (c *Console) FrameImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, FrameWidth, FrameHeight))
+
+	for i, px := range c.system.Frame() {
+		img.SetRGBA(i%FrameWidth, i/FrameWidth, px)
+	}
+
+	return img
+}
+
+// AudioSamples returns the audio produced during the last frame, mono, at the
+// SampleRate. The slice is reused and only valid until the next call to RunFrame.
+func (c *Console) AudioSamples() []float32 {
+	return c.samples
+}
+
+// SetButtons sets the buttons held on the controller of the player, 1 or 2.
+// The buttons stay held until changed.
+func (c *Console) SetButtons(player int, buttons Button) {
+	if player < 1 || player > len(c.joy) {
+		panic(fmt.Sprintf("console: invalid player %d", player))
+	}
+
+	c.joy[player-1].SetButtons(buttons)
+}
+
+// ReadMemory reads the byte from the CPU address space. The hardware registers
+// read as zero, so that reading has no effect on the game.
+func (c *Console) ReadMemory(addr uint16) uint8 {
+	return c.system.Peek(addr)
+}
+
+// WriteMemory writes the byte to the CPU address space, the way the CPU does.
+func (c *Console) WriteMemory(addr uint16, data uint8) {
+	c.system.Poke(addr, data)
+}
+
+// SaveState writes the state of the console in the format of the save files of
+// the dendy command. The states are only compatible between the consoles with
+// the same controllers plugged in, which rules out the offline saves of the
+// command, as it has the Zapper in the second port.
+func (c *Console) SaveState(w io.Writer) error {
+	return c.system.WriteStateFile(w)
+}
+
+// LoadState loads the state written by SaveState. The state of another game is
+// rejected, leaving the console untouched.
+func (c *Console) LoadState(r io.Reader) error {
+	return c.system.ReadStateFile(r)
+}
+
+// FrameCount returns the number of frames since the power on or the last reset.
+func (c *Console) FrameCount() uint64 {
+	return c.system.FrameCount()
+}
+
+// CRC32 returns the checksum of the game, the same as in the game databases.
+func (c *Console) CRC32() uint32 {
+	return c.rom.CRC32
+}
+
+// System returns the underlying system, for what is not covered by Console.
+func (c *Console) System() *system.System {
+	return c.system
+}
@@ -7,12 +7,26 @@ const (
 	FramesPerSecond   = 60 * Speed
 	CPUTicksPerSecond = 1789773 * Speed
 	TicksPerSecond    = CPUTicksPerSecond * 3
-	FrameDuration     = time.Second / FramesPerSecond
+
+	// The NTSC PPU draws 341x262 dots per frame and skips one dot on every odd
+	// frame, which is 29780.5 CPU cycles per frame on average. FramesPerSecond
+	// is the rounded value for the places that need a whole number of frames.
+	CPUTicksPerFrame = 29780.5
+	FrameRate        = CPUTicksPerSecond / CPUTicksPerFrame // ~60.0988Hz
+	FrameDuration    = time.Second * (CPUTicksPerFrame * 2) / (CPUTicksPerSecond * 2)
+
+	// The Dendy clocks the CPU at 1.773448MHz, still 3 PPU dots per CPU cycle,
+	// and draws 341x312 dots per frame without skipping any, for the 50Hz TVs.
+	DendyCPUTicksPerSecond   = 1773448 * Speed
+	DendyTicksPerSecond      = DendyCPUTicksPerSecond * 3
+	DendyCPUTicksPerFrame    = 341 * 312 / 3
+	DendyFrameRate           = DendyCPUTicksPerSecond / float64(DendyCPUTicksPerFrame) // ~50.007Hz
+	DendyTicksPerAudioSample = float64(DendyTicksPerSecond) / AudioSamplesPerSecond    // ~120.64
 
 	AudioSampleSize       = 32
 	AudioSamplesPerSecond = 44100 * Speed
 	AudioSamplesPerFrame  = AudioSamplesPerSecond / FramesPerSecond
-	TicksPerAudioSample   = TicksPerSecond / AudioSamplesPerSecond
+	TicksPerAudioSample   = float64(TicksPerSecond) / AudioSamplesPerSecond // ~121.75
 	AudioBufferSize       = AudioSamplesPerFrame * 3
 
 	DefaultRelayAddr = "159.223.15.170:1234" // TODO: need FQDN for this
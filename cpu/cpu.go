@@ -164,6 +164,11 @@ func (cpu *CPU) TriggerIRQ() {
 	cpu.interrupt = interruptIRQ
 }
 
+// Stall spends the cycle without running, while the DMA has the bus.
+func (cpu *CPU) Stall() {
+	cpu.Cycles++
+}
+
 // Tick executes a single CPU cycle, returning true if the CPU has finished
 // executing the current instruction.
 func (cpu *CPU) Tick(mem Memory) bool {
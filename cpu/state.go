@@ -14,7 +14,7 @@ func (cpu *CPU) SaveState(w *binario.Writer) error {
 		w.WriteUint8(cpu.P),
 		w.WriteUint8(cpu.SP),
 		w.WriteUint16(cpu.PC),
-		w.WriteUint64(cpu.Cycles),
+		w.WriteVarUint(cpu.Cycles),
 		w.WriteUint8(cpu.interrupt),
 		w.WriteUint32(uint32(cpu.Halt)),
 	)
@@ -32,7 +32,7 @@ func (cpu *CPU) LoadState(r *binario.Reader) error {
 		r.ReadUint8To(&cpu.P),
 		r.ReadUint8To(&cpu.SP),
 		r.ReadUint16To(&cpu.PC),
-		r.ReadUint64To(&cpu.Cycles),
+		r.ReadVarUintTo(&cpu.Cycles),
 		r.ReadUint8To(&cpu.interrupt),
 		r.ReadUint32To(&halt),
 	)
@@ -0,0 +1,115 @@
+// Package gamedb looks up games by the CRC32 of their PRG and CHR data. The
+// database is not bundled with the emulator. Instead, a headerless No-Intro DAT
+// file (Logiqx XML format) can be downloaded separately, as its checksums are
+// calculated the same way as ines.ROM.CRC32.
+package gamedb
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Game is a database entry.
+type Game struct {
+	Name   string // title without the tags, e.g. "Super Mario Bros."
+	Region string // e.g. "USA", "Europe" or "Japan, USA", empty if unknown
+}
+
+func (g Game) String() string {
+	if g.Region == "" {
+		return g.Name
+	}
+
+	return fmt.Sprintf("%s (%s)", g.Name, g.Region)
+}
+
+// DB maps the ROM checksums to the games.
+type DB struct {
+	games map[uint32]Game
+}
+
+type datFile struct {
+	Games []struct {
+		Name string `xml:"name,attr"`
+		ROMs []struct {
+			CRC string `xml:"crc,attr"`
+		} `xml:"rom"`
+	} `xml:"game"`
+}
+
+// Load reads the database from a DAT file.
+func Load(filename string) (*DB, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Parse reads the database in the Logiqx XML format. Entries with malformed
+// checksums are skipped.
+func Parse(r io.Reader) (*DB, error) {
+	var dat datFile
+	if err := xml.NewDecoder(r).Decode(&dat); err != nil {
+		return nil, fmt.Errorf("failed to parse dat file: %w", err)
+	}
+
+	db := &DB{games: make(map[uint32]Game, len(dat.Games))}
+
+	for _, g := range dat.Games {
+		for _, rom := range g.ROMs {
+			crc, err := strconv.ParseUint(rom.CRC, 16, 32)
+			if err != nil {
+				continue
+			}
+
+			db.games[uint32(crc)] = parseName(g.Name)
+		}
+	}
+
+	return db, nil
+}
+
+// Lookup returns the game with the given checksum. It is safe to call on a nil
+// database, which has no games.
+func (db *DB) Lookup(crc32 uint32) (Game, bool) {
+	if db == nil {
+		return Game{}, false
+	}
+
+	g, ok := db.games[crc32]
+
+	return g, ok
+}
+
+// Len returns the number of ROMs in the database.
+func (db *DB) Len() int {
+	if db == nil {
+		return 0
+	}
+
+	return len(db.games)
+}
+
+// parseName splits a No-Intro name, such as "Tetris (USA) (Rev 1)", into the
+// title and the region, which is always the first tag.
+func parseName(name string) Game {
+	title, tags, found := strings.Cut(name, " (")
+	if !found {
+		return Game{Name: name}
+	}
+
+	region, _, _ := strings.Cut(tags, ")")
+
+	return Game{
+		Name:   title,
+		Region: region,
+	}
+}
@@ -5,13 +5,21 @@ go 1.21
 toolchain go1.21.0
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/gen2brain/raylib-go/raylib v0.0.0-20240116120507-49aab27a9ba4
+	github.com/hajimehoshi/ebiten/v2 v2.6.7
+	github.com/veandco/go-sdl2 v0.4.40
 	github.com/xtaci/kcp-go v5.4.20+incompatible
+	github.com/yuin/gopher-lua v1.1.1
+	golang.org/x/image v0.12.0
 	golang.org/x/sync v0.6.0
+	golang.org/x/term v0.16.0
 )
 
 require (
-	github.com/ebitengine/purego v0.6.0-alpha.1.0.20231122024802-192c5e846faa // indirect
+	github.com/ebitengine/oto/v3 v3.1.0 // indirect
+	github.com/ebitengine/purego v0.6.0 // indirect
+	github.com/jezek/xgb v1.1.0 // indirect
 	github.com/klauspost/cpuid/v2 v2.1.1 // indirect
 	github.com/klauspost/reedsolomon v1.12.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
@@ -2,11 +2,25 @@ package ines
 
 import (
 	"fmt"
+	"log"
+	"strings"
 
 	"github.com/maxpoletaev/dendy/internal/binario"
 )
 
+// Warnings enables logging the memory accesses the mappers do not handle. They
+// are off by default, as some games do such accesses every frame.
+var Warnings = false
+
+func warnf(format string, args ...any) {
+	if Warnings {
+		log.Printf("[WARN] "+format, args...)
+	}
+}
+
 type Cartridge interface {
+	// ROM returns the ROM the cartridge was created from.
+	ROM() *ROM
 	// Reset resets the cartridge to its initial state.
 	Reset()
 	// ScanlineTick performs a scanline tick used by some mappers.
@@ -15,6 +29,8 @@ type Cartridge interface {
 	PendingIRQ() bool
 	// MirrorMode returns the cartridge's mirroring mode.
 	MirrorMode() MirrorMode
+	// Banks describes the selected PRG and CHR banks, for debugging.
+	Banks() string
 	// ReadPRG handles CPU reads from PRG ROM (0x8000-0xFFFF).
 	ReadPRG(addr uint16) byte
 	// WritePRG handles CPU writes to PRG ROM (0x8000-0xFFFF).
@@ -29,6 +45,165 @@ type Cartridge interface {
 	LoadState(r *binario.Reader) error
 }
 
+// CPUClocked is implemented by the mappers that count the CPU cycles (the M2
+// clock of the cartridge connector) rather than the scanlines, such as the IRQ
+// counters of VRC4, FME-7 and FDS. The PendingIRQ is checked after every tick.
+type CPUClocked interface {
+	// CPUTick is called on every CPU cycle.
+	CPUTick()
+}
+
+// AsCPUClocked returns the mapper of the cartridge if it counts the CPU cycles.
+// The mappers that do not are not called on every cycle, as most of them have
+// nothing to count.
+func AsCPUClocked(cart Cartridge) (CPUClocked, bool) {
+	if c, ok := cart.(*StaticCartridge); ok {
+		cart = c.mapper
+	}
+
+	clocked, ok := cart.(CPUClocked)
+
+	return clocked, ok
+}
+
+// ExpansionAudio is implemented by the mappers with their own sound channels,
+// such as VRC6 and FDS, which are mixed into the output of the APU. The channels are
+// clocked by CPUTick, so such mappers are CPUClocked as well.
+type ExpansionAudio interface {
+	// AudioOutput returns the output of the channels on the same scale as the
+	// mix of the APU channels, before the filters.
+	AudioOutput() float32
+}
+
+// AsExpansionAudio returns the mapper of the cartridge if it has the sound
+// channels of its own.
+func AsExpansionAudio(cart Cartridge) (ExpansionAudio, bool) {
+	if c, ok := cart.(*StaticCartridge); ok {
+		cart = c.mapper
+	}
+
+	audio, ok := cart.(ExpansionAudio)
+
+	return audio, ok
+}
+
+// PPUSnooper is implemented by the mappers that take over more of the PPU than
+// the CHR, such as MMC5, which maps each of the nametables itself, watches the
+// PPU registers to select the CHR banks by what is being fetched, and replaces
+// the background tiles for its extended attributes and the split screen.
+type PPUSnooper interface {
+	// WritePPU is called on the CPU writes to the PPU registers ($2000-$2007).
+	WritePPU(addr uint16, data byte)
+	// ReadNameTable handles the PPU reads from the nametables ($2000-$2FFF),
+	// given the 2KB of the console VRAM, which replaces the mirroring.
+	ReadNameTable(addr uint16, vram *[2][1024]byte) byte
+	// WriteNameTable handles the PPU writes to the nametables.
+	WriteNameTable(addr uint16, data byte, vram *[2][1024]byte)
+	// FetchBackground fetches the pattern of the background tile line, read
+	// from the nametable in the usual way. The palette may be replaced.
+	FetchBackground(t *BackgroundTile)
+	// FetchSprites tells whether the following CHR reads are for the sprites.
+	FetchSprites(on bool)
+}
+
+// BackgroundTile is the line of the background tile being fetched by the PPU.
+type BackgroundTile struct {
+	Column   int    // on the screen, 0-32, the first one partly scrolled out
+	Scanline int    // 0-239
+	Addr     uint16 // of the tile in the nametable
+	TileID   uint8
+	FineY    uint8  // the line of the tile
+	Pattern  uint16 // the address of the line in the pattern table
+	Palette  uint8  // read from the attributes, may be replaced by the mapper
+	Low      uint8  // the pattern planes, fetched by the mapper
+	High     uint8
+}
+
+// AsPPUSnooper returns the mapper of the cartridge if it snoops on the PPU.
+func AsPPUSnooper(cart Cartridge) (PPUSnooper, bool) {
+	if c, ok := cart.(*StaticCartridge); ok {
+		cart = c.mapper
+	}
+
+	snooper, ok := cart.(PPUSnooper)
+
+	return snooper, ok
+}
+
+// PRGPeeker is implemented by the mappers with the registers that change when
+// read, such as the IRQ acknowledged by reading the status, so that the memory
+// can be inspected without affecting the game.
+type PRGPeeker interface {
+	// PeekPRG returns what ReadPRG would, without its side effects.
+	PeekPRG(addr uint16) byte
+}
+
+// AsPRGPeeker returns the mapper of the cartridge if it reads the registers
+// without the side effects.
+func AsPRGPeeker(cart Cartridge) (PRGPeeker, bool) {
+	if c, ok := cart.(*StaticCartridge); ok {
+		cart = c.mapper
+	}
+
+	peeker, ok := cart.(PRGPeeker)
+
+	return peeker, ok
+}
+
+// BatteryBacked is implemented by the mappers with the PRG-RAM, which keeps the
+// saves of the games with the battery on the board between the power-offs.
+type BatteryBacked interface {
+	// SaveRAM returns the PRG-RAM of the mapper, which is written to the save
+	// file as is, and copied back into the slice when it is loaded.
+	SaveRAM() []byte
+}
+
+// AsBatteryBacked returns the mapper of the cartridge if it has the PRG-RAM and
+// the ROM header says that it is battery-backed.
+func AsBatteryBacked(cart Cartridge) (BatteryBacked, bool) {
+	if !cart.ROM().Battery {
+		return nil, false
+	}
+
+	if c, ok := cart.(*StaticCartridge); ok {
+		cart = c.mapper
+	}
+
+	battery, ok := cart.(BatteryBacked)
+
+	return battery, ok
+}
+
+// RAMLoader is implemented by the battery-backed mappers whose save file is not
+// the RAM as is, such as the flash of UNROM 512. The file returned by SaveRAM
+// is then decoded by LoadRAM, rather than copied back into the slice.
+type RAMLoader interface {
+	LoadRAM(data []byte) error
+}
+
+// DiskDrive is implemented by the Famicom Disk System, which has the sides of
+// the disk to switch, as the games ask to flip the disk or to insert another.
+type DiskDrive interface {
+	// Sides returns the number of the disk sides in the image.
+	Sides() int
+	// Side returns the inserted side, or -1 while the disk is out.
+	Side() int
+	// SwitchSide ejects the disk and inserts the next side a second later,
+	// going back to the first one after the last. Returns the next side.
+	SwitchSide() int
+}
+
+// AsDiskDrive returns the mapper of the cartridge if it has the disk drive.
+func AsDiskDrive(cart Cartridge) (DiskDrive, bool) {
+	if c, ok := cart.(*StaticCartridge); ok {
+		cart = c.mapper
+	}
+
+	drive, ok := cart.(DiskDrive)
+
+	return drive, ok
+}
+
 func NewCartridge(rom *ROM) (Cartridge, error) {
 	switch rom.MapperID {
 	case 0:
@@ -41,9 +216,64 @@ func NewCartridge(rom *ROM) (Cartridge, error) {
 		return NewMapper3(rom), nil
 	case 4:
 		return NewMapper4(rom), nil
+	case 5:
+		return NewMapper5(rom), nil
 	case 7:
 		return NewMapper7(rom), nil
+	case 19:
+		return NewMapper19(rom), nil
+	case 20:
+		if len(rom.PRG) != fdsBIOSSize {
+			return nil, ErrNoFDSBIOS
+		}
+
+		return NewMapper20(rom), nil
+	case 24:
+		return NewMapper24(rom), nil
+	case 26:
+		return NewMapper26(rom), nil
+	case 30:
+		return NewMapper30(rom), nil
+	case 69:
+		return NewMapper69(rom), nil
 	default:
 		return nil, fmt.Errorf("unsupported mapper: %d", rom.MapperID)
 	}
 }
+
+// newPRGRAM allocates the PRG-RAM at $6000-$7FFF of the size in the header,
+// the plain and the battery-backed one together. The larger RAM is banked on
+// the boards, which is not supported, so only the first 8KB is used.
+func newPRGRAM(rom *ROM) []byte {
+	return make([]byte, min(rom.PRGRAMSize+rom.PRGNVRAMSize, 0x2000))
+}
+
+// readPRGRAM reads the PRG-RAM, the smaller one mirrored over $6000-$7FFF. The
+// boards without the RAM leave the bus open.
+func readPRGRAM(ram []byte, addr uint16) byte {
+	if len(ram) == 0 {
+		return 0
+	}
+
+	return ram[int(addr-0x6000)%len(ram)]
+}
+
+func writePRGRAM(ram []byte, addr uint16, data byte) {
+	if len(ram) != 0 {
+		ram[int(addr-0x6000)%len(ram)] = data
+	}
+}
+
+// formatBanks formats the bank numbers of the given size in KB, such as
+// "PRG 16K: 3 7".
+func formatBanks[T ~int | ~uint | ~uint8](kind string, sizeKB int, banks ...T) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%s %dK:", kind, sizeKB)
+
+	for _, bank := range banks {
+		fmt.Fprintf(&sb, " %d", bank)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,140 @@
+package ines
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+)
+
+// FDSBIOS is the 8KB BIOS of the Famicom Disk System (disksys.rom), which runs
+// the disk images. It is copyrighted, so it is not a part of the emulator and
+// has to be loaded by the user.
+var FDSBIOS []byte
+
+var ErrNoFDSBIOS = errors.New("the FDS BIOS (disksys.rom) is not loaded")
+
+const (
+	// fdsBIOSSize is the size of the BIOS mapped at $E000.
+	fdsBIOSSize = 0x2000
+
+	// fdsSideSize is the size of one disk side in the image, which only has the
+	// data of the blocks, without the gaps and the checksums of the real disk.
+	fdsSideSize = 65500
+)
+
+// fdsMagic starts the disk info block, the first block of every side.
+var fdsMagic = []byte("\x01*NINTENDO-HVC*")
+
+// isFDSImage tells whether the first 16 bytes of the file are the fwNES header
+// of the disk image, or the start of the image without the header.
+func isFDSImage(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("FDS\x1a")) || bytes.HasPrefix(header, fdsMagic)
+}
+
+// newFDSROM reads the disk image. The ROM gets the BIOS as the PRG and the 8KB
+// of CHR-RAM of the RAM adapter, and the checksum is of the disk sides.
+func newFDSROM(file io.Reader, header []byte) (*ROM, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read disk image: %w", err)
+	}
+
+	headerSides := -1
+	if bytes.HasPrefix(header, []byte("FDS\x1a")) {
+		headerSides = int(header[4])
+	} else {
+		data = append(header, data...)
+	}
+
+	if len(data) < fdsSideSize {
+		return nil, fmt.Errorf("disk image too short: %d bytes", len(data))
+	}
+
+	if len(data)%fdsSideSize != 0 {
+		log.Printf("[WARN] ignoring %d bytes after the last disk side", len(data)%fdsSideSize)
+	}
+
+	sides := make([][]byte, len(data)/fdsSideSize)
+	for i := range sides {
+		sides[i] = data[i*fdsSideSize : (i+1)*fdsSideSize]
+
+		if !bytes.HasPrefix(sides[i], fdsMagic) {
+			return nil, fmt.Errorf("invalid disk side %d", i+1)
+		}
+	}
+
+	if headerSides >= 0 && headerSides != len(sides) {
+		log.Printf("[WARN] the header says %d disk sides, the image has %d", headerSides, len(sides))
+	}
+
+	var bios []byte
+	if len(FDSBIOS) == fdsBIOSSize {
+		bios = append([]byte(nil), FDSBIOS...)
+	}
+
+	hash := crc32.ChecksumIEEE(data[:len(sides)*fdsSideSize])
+
+	log.Printf("[INFO] ROM info:")
+	log.Printf("[INFO]   > mapper ID:  20 (%s)", mapperNames[20])
+	log.Printf("[INFO]   > disk sides: %d", len(sides))
+	log.Printf("[INFO]   > CRC32:      %08X", hash)
+
+	return &ROM{
+		MapperID:   20,
+		MirrorMode: MirrorHorizontal,
+		PRG:        bios,
+		CHR:        make([]byte, 0x2000),
+		Disk:       sides,
+		CRC32:      hash,
+		PRGRAMSize: 0x8000,
+		CHRRAMSize: 0x2000,
+		chrRAM:     true,
+	}, nil
+}
+
+// addGaps converts the side of the image to what the drive reads from the
+// disk: the blocks are separated by the gaps of zeros, and each block starts
+// with the mark bit and ends with the checksum. The checksum is not verified
+// by the BIOS, so it is not calculated.
+// https://www.nesdev.org/wiki/FDS_disk_format
+func addGaps(side []byte) []byte {
+	disk := make([]byte, 0, len(side)+len(side)/8)
+	disk = append(disk, make([]byte, 28300/8)...) // the lead-in
+
+	for i := 0; i < len(side); {
+		var size int
+
+		switch side[i] {
+		case 1: // disk info
+			size = 56
+		case 2: // file amount
+			size = 2
+		case 3: // file header
+			size = 16
+		case 4: // file data, the size is in the header before it
+			if i >= 16 {
+				size = 1 + (int(side[i-3]) | int(side[i-2])<<8)
+			}
+		}
+
+		if size == 0 || i+size > len(side) {
+			break // the unused rest of the side
+		}
+
+		disk = append(disk, 0x80)
+		disk = append(disk, side[i:i+size]...)
+		disk = append(disk, 0x4D, 0x62) // the checksum
+		disk = append(disk, make([]byte, 976/8)...)
+
+		i += size
+	}
+
+	if len(disk) < fdsSideSize {
+		disk = append(disk, make([]byte, fdsSideSize-len(disk))...)
+	}
+
+	return disk
+}
@@ -0,0 +1,314 @@
+package ines
+
+import (
+	"errors"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+// fdsLevel is the output of one step of the FDS channel. At the full volume
+// it is about twice as loud as an APU pulse channel.
+const fdsLevel = 0.0045
+
+// fdsMasterVolumes are the multipliers of the four master volumes, 2/2, 2/3,
+// 2/4 and 2/5, scaled so that the full one is 36.
+var fdsMasterVolumes = [4]uint32{36, 24, 17, 14}
+
+// fdsModSteps are how much each value of the modulation table adds to the
+// counter, 4 resetting it instead.
+var fdsModSteps = [8]int32{0, 1, 2, 4, 0, -4, -2, -1}
+
+// fdsEnvelope is the volume or the modulation envelope, which moves the gain
+// up or down one step every 8*(speed+1) ticks of the master envelope speed.
+type fdsEnvelope struct {
+	speed    uint8
+	gain     uint8
+	increase bool
+	off      bool // the gain is set directly
+	timer    uint32
+}
+
+func (e *fdsEnvelope) write(data byte, masterSpeed uint8) {
+	e.speed = data & 0x3F
+	e.increase = data&0x40 != 0
+	e.off = data&0x80 != 0
+	e.resetTimer(masterSpeed)
+
+	if e.off {
+		e.gain = e.speed
+	}
+}
+
+func (e *fdsEnvelope) resetTimer(masterSpeed uint8) {
+	e.timer = 8 * (uint32(e.speed) + 1) * uint32(masterSpeed)
+}
+
+// tick clocks the envelope, returning true when the gain is updated.
+func (e *fdsEnvelope) tick(masterSpeed uint8) bool {
+	if e.off || masterSpeed == 0 {
+		return false
+	}
+
+	if e.timer > 0 {
+		e.timer--
+	}
+
+	if e.timer > 0 {
+		return false
+	}
+
+	e.resetTimer(masterSpeed)
+
+	switch {
+	case e.increase && e.gain < 32:
+		e.gain++
+	case !e.increase && e.gain > 0:
+		e.gain--
+	}
+
+	return true
+}
+
+func (e *fdsEnvelope) saveState(w *binario.Writer) error {
+	return errors.Join(
+		w.WriteUint8(e.speed),
+		w.WriteUint8(e.gain),
+		w.WriteBool(e.increase),
+		w.WriteBool(e.off),
+		w.WriteUint32(e.timer),
+	)
+}
+
+func (e *fdsEnvelope) loadState(r *binario.Reader) error {
+	return errors.Join(
+		r.ReadUint8To(&e.speed),
+		r.ReadUint8To(&e.gain),
+		r.ReadBoolTo(&e.increase),
+		r.ReadBoolTo(&e.off),
+		r.ReadUint32To(&e.timer),
+	)
+}
+
+// fdsAudio is the sound channel of the FDS: a 64-step wavetable of 6-bit
+// samples, with the volume envelope and the pitch modulation, itself driven by
+// the table of the 3-bit modulation steps.
+// https://www.nesdev.org/wiki/FDS_audio
+type fdsAudio struct {
+	wave         [64]uint8
+	waveWrite    bool // the wavetable is writable, and the channel is held
+	waveHalt     bool
+	waveFreq     uint16
+	waveAccum    uint32
+	wavePos      uint8
+	envelopeHalt bool
+	masterVolume uint8
+	masterSpeed  uint8
+	volume       fdsEnvelope
+	mod          fdsEnvelope
+	modTable     [64]uint8
+	modPos       uint8
+	modHalt      bool
+	modFreq      uint16
+	modAccum     uint32
+	modCounter   int32 // 7-bit signed
+	modOutput    int32 // the pitch added to the wave frequency
+	output       uint8
+}
+
+func (a *fdsAudio) reset() {
+	*a = fdsAudio{masterSpeed: 0xE8}
+}
+
+func (a *fdsAudio) read(addr uint16) byte {
+	switch {
+	case addr >= 0x4040 && addr <= 0x407F:
+		return a.wave[addr-0x4040] | 0x40
+	case addr == 0x4090:
+		return a.volume.gain | 0x40
+	case addr == 0x4092:
+		return a.mod.gain | 0x40
+	default:
+		return 0
+	}
+}
+
+func (a *fdsAudio) write(addr uint16, data byte) {
+	switch {
+	case addr >= 0x4040 && addr <= 0x407F:
+		if a.waveWrite {
+			a.wave[addr-0x4040] = data & 0x3F
+		}
+	case addr == 0x4080:
+		a.volume.write(data, a.masterSpeed)
+	case addr == 0x4082:
+		a.waveFreq = a.waveFreq&0x0F00 | uint16(data)
+	case addr == 0x4083:
+		a.waveFreq = a.waveFreq&0x00FF | uint16(data&0x0F)<<8
+		a.envelopeHalt = data&0x40 != 0
+		a.waveHalt = data&0x80 != 0
+
+		if a.waveHalt {
+			a.waveAccum, a.wavePos = 0, 0
+		}
+
+		if a.envelopeHalt {
+			a.volume.resetTimer(a.masterSpeed)
+			a.mod.resetTimer(a.masterSpeed)
+		}
+	case addr == 0x4084:
+		a.mod.write(data, a.masterSpeed)
+		a.updateMod()
+	case addr == 0x4085:
+		a.modCounter = int32(data&0x7F) << 25 >> 25 // sign-extend 7 bits
+		a.updateMod()
+	case addr == 0x4086:
+		a.modFreq = a.modFreq&0x0F00 | uint16(data)
+	case addr == 0x4087:
+		a.modFreq = a.modFreq&0x00FF | uint16(data&0x0F)<<8
+		a.modHalt = data&0x80 != 0
+
+		if a.modHalt {
+			a.modAccum = 0
+		}
+	case addr == 0x4088:
+		// Each write fills two entries, only while the modulation is halted.
+		if a.modHalt {
+			a.modTable[a.modPos] = data & 0x07
+			a.modTable[(a.modPos+1)&0x3F] = data & 0x07
+			a.modPos = (a.modPos + 2) & 0x3F
+		}
+	case addr == 0x4089:
+		a.waveWrite = data&0x80 != 0
+		a.masterVolume = data & 0x03
+	case addr == 0x408A:
+		a.masterSpeed = data
+		a.volume.resetTimer(a.masterSpeed)
+		a.mod.resetTimer(a.masterSpeed)
+	}
+}
+
+// updateMod calculates the pitch of the modulation from the counter, the gain
+// and the wave frequency, following the rounding of the real chip.
+func (a *fdsAudio) updateMod() {
+	temp := a.modCounter * int32(a.mod.gain)
+	remainder := temp & 0x0F
+	temp >>= 4
+
+	if remainder > 0 && temp&0x80 == 0 {
+		if a.modCounter < 0 {
+			temp--
+		} else {
+			temp += 2
+		}
+	}
+
+	switch {
+	case temp >= 192:
+		temp -= 256
+	case temp < -64:
+		temp += 256
+	}
+
+	temp *= int32(a.waveFreq)
+	remainder = temp & 0x3F
+	temp >>= 6
+
+	if remainder >= 32 {
+		temp++
+	}
+
+	a.modOutput = temp
+}
+
+// tick clocks the channel on every CPU cycle.
+func (a *fdsAudio) tick() {
+	if !a.waveHalt && !a.envelopeHalt {
+		a.volume.tick(a.masterSpeed)
+
+		if a.mod.tick(a.masterSpeed) {
+			a.updateMod()
+		}
+	}
+
+	if !a.modHalt && a.modFreq > 0 {
+		if a.modAccum += uint32(a.modFreq); a.modAccum > 0xFFFF {
+			a.modAccum -= 0x10000
+
+			if step := a.modTable[a.modPos]; step == 4 {
+				a.modCounter = 0
+			} else {
+				a.modCounter = (a.modCounter + fdsModSteps[step]) << 25 >> 25
+			}
+
+			a.modPos = (a.modPos + 1) & 0x3F
+			a.updateMod()
+		}
+	}
+
+	if !a.waveHalt && !a.waveWrite {
+		if freq := int32(a.waveFreq) + a.modOutput; freq > 0 {
+			a.waveAccum = (a.waveAccum + uint32(freq)) & 0xFFFF
+			a.wavePos = uint8(a.waveAccum >> 10)
+		}
+	}
+
+	// The output is held while the wavetable is written.
+	if !a.waveWrite {
+		level := uint32(min(a.volume.gain, 32)) * fdsMasterVolumes[a.masterVolume]
+		a.output = uint8(uint32(a.wave[a.wavePos]) * level / 1152)
+	}
+}
+
+func (a *fdsAudio) saveState(w *binario.Writer) error {
+	return errors.Join(
+		w.WriteVarBytes(a.wave[:]),
+		w.WriteBool(a.waveWrite),
+		w.WriteBool(a.waveHalt),
+		w.WriteUint16(a.waveFreq),
+		w.WriteUint32(a.waveAccum),
+		w.WriteUint8(a.wavePos),
+		w.WriteBool(a.envelopeHalt),
+		w.WriteUint8(a.masterVolume),
+		w.WriteUint8(a.masterSpeed),
+		a.volume.saveState(w),
+		a.mod.saveState(w),
+		w.WriteVarBytes(a.modTable[:]),
+		w.WriteUint8(a.modPos),
+		w.WriteBool(a.modHalt),
+		w.WriteUint16(a.modFreq),
+		w.WriteUint32(a.modAccum),
+		w.WriteUint32(uint32(a.modCounter)),
+		w.WriteUint32(uint32(a.modOutput)),
+		w.WriteUint8(a.output),
+	)
+}
+
+func (a *fdsAudio) loadState(r *binario.Reader) error {
+	var counter, output uint32
+
+	err := errors.Join(
+		r.ReadVarBytesTo(a.wave[:]),
+		r.ReadBoolTo(&a.waveWrite),
+		r.ReadBoolTo(&a.waveHalt),
+		r.ReadUint16To(&a.waveFreq),
+		r.ReadUint32To(&a.waveAccum),
+		r.ReadUint8To(&a.wavePos),
+		r.ReadBoolTo(&a.envelopeHalt),
+		r.ReadUint8To(&a.masterVolume),
+		r.ReadUint8To(&a.masterSpeed),
+		a.volume.loadState(r),
+		a.mod.loadState(r),
+		r.ReadVarBytesTo(a.modTable[:]),
+		r.ReadUint8To(&a.modPos),
+		r.ReadBoolTo(&a.modHalt),
+		r.ReadUint16To(&a.modFreq),
+		r.ReadUint32To(&a.modAccum),
+		r.ReadUint32To(&counter),
+		r.ReadUint32To(&output),
+		r.ReadUint8To(&a.output),
+	)
+
+	a.modCounter, a.modOutput = int32(counter), int32(output)
+
+	return err
+}
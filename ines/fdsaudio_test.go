@@ -0,0 +1,92 @@
+package ines
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// The wavetable is only written with bit 7 of $4089 set, and is read back with
+// the open bus bits.
+func TestFDSAudio_Wavetable(t *testing.T) {
+	var a fdsAudio
+	a.reset()
+
+	a.write(0x4040, 0x3F)
+	testutil.Equal(t, a.read(0x4040), 0x40)
+
+	a.write(0x4089, 0x80)
+	a.write(0x4040, 0xFF)
+	a.write(0x407F, 0x21)
+	testutil.Equal(t, a.read(0x4040), 0x7F)
+	testutil.Equal(t, a.read(0x407F), 0x61)
+}
+
+// Each write of the modulation table fills two entries, only while the
+// modulation is halted.
+func TestFDSAudio_ModTable(t *testing.T) {
+	var a fdsAudio
+	a.reset()
+
+	a.write(0x4088, 0x03)
+	testutil.Equal(t, a.modTable[0], 0)
+
+	a.write(0x4087, 0x80)
+	a.write(0x4088, 0x0B) // only the 3 bits
+	a.write(0x4088, 0x05)
+	testutil.Equal(t, a.modTable[0], 3)
+	testutil.Equal(t, a.modTable[1], 3)
+	testutil.Equal(t, a.modTable[2], 5)
+	testutil.Equal(t, a.modTable[3], 5)
+	testutil.Equal(t, a.modPos, 4)
+}
+
+// The sample is scaled by the volume gain, up to 32, and the master volume.
+func TestFDSAudio_Output(t *testing.T) {
+	tests := map[string]struct {
+		gain   uint8 // $4080 with the envelope off
+		master uint8 // $4089
+		want   uint8
+	}{
+		"full":          {gain: 32, master: 0, want: 63},
+		"gain over max": {gain: 63, master: 0, want: 63},
+		"half gain":     {gain: 16, master: 0, want: 31},
+		"master 2/3":    {gain: 32, master: 1, want: 42},
+		"master 2/5":    {gain: 32, master: 3, want: 24},
+		"silent":        {gain: 0, master: 0, want: 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var a fdsAudio
+			a.reset()
+
+			a.write(0x4089, 0x80)
+			a.write(0x4040, 0x3F)
+			a.write(0x4089, tt.master)
+			a.write(0x4080, 0x80|tt.gain)
+			a.write(0x4083, 0x80) // the wave is halted at the first sample
+
+			a.tick()
+			testutil.Equal(t, a.output, tt.want)
+		})
+	}
+}
+
+// The volume envelope moves the gain one step every 8*(speed+1) ticks of the
+// master envelope speed.
+func TestFDSAudio_Envelope(t *testing.T) {
+	var a fdsAudio
+	a.reset()
+
+	a.write(0x408A, 0x01)
+	a.write(0x4080, 0x40) // increasing, the speed of 0
+
+	for i := 0; i < 7; i++ {
+		a.tick()
+	}
+
+	testutil.Equal(t, a.volume.gain, 0)
+	a.tick()
+	testutil.Equal(t, a.volume.gain, 1)
+}
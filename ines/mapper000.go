@@ -1,8 +1,6 @@
 package ines
 
 import (
-	"log"
-
 	"github.com/maxpoletaev/dendy/internal/binario"
 )
 
@@ -12,13 +10,28 @@ import (
 //	PRG-ROM is mapped to 0x8000-0xFFFF.
 //	CHR-ROM is mapped to 0x0000-0x1FFF.
 type Mapper0 struct {
-	rom *ROM
+	rom     *ROM
+	prgSize int    // mirrored over 0x8000-0xFFFF, e.g. a single 16KB bank
+	prgMask uint16 // prgSize-1 if it is a power of two, 0 otherwise
 }
 
 func NewMapper0(cart *ROM) *Mapper0 {
-	return &Mapper0{
-		rom: cart,
+	m := &Mapper0{
+		rom:     cart,
+		prgSize: min(len(cart.PRG), 0x8000),
+	}
+
+	// The sizes other than a power of two are only in the broken or the hacked
+	// dumps, which are mirrored by taking the remainder.
+	if m.prgSize&(m.prgSize-1) == 0 {
+		m.prgMask = uint16(m.prgSize - 1)
 	}
+
+	return m
+}
+
+func (m *Mapper0) ROM() *ROM {
+	return m.rom
 }
 
 func (m *Mapper0) Reset() {
@@ -35,19 +48,26 @@ func (m *Mapper0) MirrorMode() MirrorMode {
 	return m.rom.MirrorMode
 }
 
+func (m *Mapper0) Banks() string {
+	return "no bank switching"
+}
+
 func (m *Mapper0) ReadPRG(addr uint16) byte {
 	switch {
-	case addr >= 0x8000 && addr <= 0xFFFF:
-		idx := addr % uint16(len(m.rom.PRG))
-		return m.rom.PRG[idx]
+	case addr >= 0x8000 && m.prgMask != 0:
+		// Masking rather than taking the remainder of the size, as dividing
+		// is slow and the PRG-ROM is read on almost every CPU cycle.
+		return m.rom.PRG[addr&m.prgMask]
+	case addr >= 0x8000:
+		return m.rom.PRG[int(addr-0x8000)%m.prgSize]
 	default:
-		log.Printf("[WARN] mapper0: unhandled prg read at %04X", addr)
+		warnf("mapper0: unhandled prg read at %04X", addr)
 		return 0
 	}
 }
 
 func (m *Mapper0) WritePRG(addr uint16, data byte) {
-	log.Printf("[WARN] mapper0: write to read-only prg at %04X", addr)
+	warnf("mapper0: write to read-only prg at %04X", addr)
 }
 
 func (m *Mapper0) ReadCHR(addr uint16) byte {
@@ -55,13 +75,13 @@ func (m *Mapper0) ReadCHR(addr uint16) byte {
 	case addr >= 0x0000 && addr <= 0x1FFF:
 		return m.rom.CHR[addr]
 	default:
-		log.Printf("[WARN] mapper0: unhandled chr read at %04X", addr)
+		warnf("mapper0: unhandled chr read at %04X", addr)
 		return 0
 	}
 }
 
 func (m *Mapper0) WriteCHR(addr uint16, data byte) {
-	log.Printf("[WARN] mapper0: write to read-only chr at %04X", addr)
+	warnf("mapper0: write to read-only chr at %04X", addr)
 }
 
 func (m *Mapper0) SaveState(w *binario.Writer) error {
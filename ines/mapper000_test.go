@@ -0,0 +1,76 @@
+package ines
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newTestPRG returns PRG where every byte holds the number of its 1KB page.
+func newTestPRG(size int) []byte {
+	prg := make([]byte, size)
+	for i := range prg {
+		prg[i] = uint8(i / 0x0400)
+	}
+
+	return prg
+}
+
+func TestMapper0_ReadPRG(t *testing.T) {
+	tests := map[string]struct {
+		size int
+		want map[uint16]uint8 // page at the address
+	}{
+		"8KB mirrored four times": {
+			size: 0x2000,
+			want: map[uint16]uint8{0x8000: 0, 0x9C00: 7, 0xA000: 0, 0xE000: 0, 0xFFFF: 7},
+		},
+		"16KB mirrored twice": {
+			size: 0x4000,
+			want: map[uint16]uint8{0x8000: 0, 0xBFFF: 15, 0xC000: 0, 0xFFFF: 15},
+		},
+		"24KB wraps around": {
+			size: 0x6000,
+			want: map[uint16]uint8{0x8000: 0, 0xDFFF: 23, 0xE000: 0, 0xFFFF: 7},
+		},
+		"32KB": {
+			size: 0x8000,
+			want: map[uint16]uint8{0x8000: 0, 0xC000: 16, 0xFFFF: 31},
+		},
+		"oversized uses the first 32KB": {
+			size: 0x10000,
+			want: map[uint16]uint8{0x8000: 0, 0xFFFF: 31},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := NewMapper0(&ROM{PRG: newTestPRG(tt.size)})
+
+			for addr, want := range tt.want {
+				testutil.Equal(t, m.ReadPRG(addr), want)
+			}
+		})
+	}
+}
+
+func BenchmarkMapper0_ReadPRG(b *testing.B) {
+	sizes := map[string]int{
+		"32KB mask":      0x8000,
+		"24KB remainder": 0x6000,
+	}
+
+	for name, size := range sizes {
+		b.Run(name, func(b *testing.B) {
+			m := NewMapper0(&ROM{PRG: newTestPRG(size)})
+
+			var sum uint8
+
+			for i := 0; i < b.N; i++ {
+				sum += m.ReadPRG(0x8000 | uint16(i))
+			}
+
+			_ = sum
+		})
+	}
+}
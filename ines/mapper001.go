@@ -3,7 +3,6 @@ package ines
 import (
 	"errors"
 	"fmt"
-	"log"
 
 	"github.com/maxpoletaev/dendy/internal/binario"
 )
@@ -12,7 +11,7 @@ import (
 // https://www.nesdev.org/wiki/MMC1
 type Mapper1 struct {
 	rom  *ROM
-	sram [0x2000]byte
+	sram []byte // of the size in the header
 
 	control  byte
 	prgBank  byte
@@ -25,10 +24,15 @@ type Mapper1 struct {
 
 func NewMapper1(rom *ROM) *Mapper1 {
 	return &Mapper1{
-		rom: rom,
+		rom:  rom,
+		sram: newPRGRAM(rom),
 	}
 }
 
+func (m *Mapper1) ROM() *ROM {
+	return m.rom
+}
+
 func (m *Mapper1) Reset() {
 	m.control = 0x0C
 	m.prgBank = 0
@@ -61,6 +65,13 @@ func (m *Mapper1) MirrorMode() MirrorMode {
 	}
 }
 
+func (m *Mapper1) Banks() string {
+	prg0, prg1 := m.prgBankIndex()
+	chr0, chr1 := m.chrBankIndex()
+
+	return formatBanks("PRG", 16, prg0, prg1) + "  " + formatBanks("CHR", 4, chr0, chr1)
+}
+
 func (m *Mapper1) prgMode() byte {
 	// 0, 1: switch 32 KB at $8000, ignoring low bit of bank number;
 	// 2: fix first bank at $8000 and switch 16 KB bank at $C000;
@@ -109,6 +120,12 @@ func (m *Mapper1) loadRegister(addr uint16, data byte) {
 }
 
 func (m *Mapper1) prgBankIndex() (uint, uint) {
+	// The submapper 5 boards (SEROM, SHROM) have 32KB of PRG-ROM without the
+	// bank lines connected, so the bank register does nothing.
+	if m.rom.Submapper == 5 {
+		return 0, 1
+	}
+
 	switch m.prgMode() {
 	case 0, 1: // Switch 32 KB at $8000, ignoring low bit of bank number.
 		return uint(m.prgBank & 0xFE), uint(m.prgBank | 0x01)
@@ -121,8 +138,15 @@ func (m *Mapper1) prgBankIndex() (uint, uint) {
 	}
 }
 
+// prgOffset returns the offset of the 16KB bank. The bank numbers of the games
+// with less than 256KB of PRG wrap around, as the unused bits are not wired.
 func (m *Mapper1) prgOffset(idx uint) uint {
-	return idx * 0x4000
+	return idx * 0x4000 % uint(len(m.rom.PRG))
+}
+
+// SaveRAM returns the PRG-RAM, for the games with the battery.
+func (m *Mapper1) SaveRAM() []byte {
+	return m.sram
 }
 
 func (m *Mapper1) ReadPRG(addr uint16) byte {
@@ -130,7 +154,7 @@ func (m *Mapper1) ReadPRG(addr uint16) byte {
 
 	switch {
 	case addr >= 0x6000 && addr <= 0x7FFF: // PRG-RAM
-		return m.sram[addr-0x6000]
+		return readPRGRAM(m.sram, addr)
 	case addr >= 0x8000 && addr <= 0xBFFF: // PRG-ROM, bank 0
 		relAddr := uint((addr - 0x8000) % 0x4000)
 		return m.rom.PRG[m.prgOffset(bank0)+relAddr]
@@ -138,7 +162,7 @@ func (m *Mapper1) ReadPRG(addr uint16) byte {
 		relAddr := uint((addr - 0x8000) % 0x4000)
 		return m.rom.PRG[m.prgOffset(bank1)+relAddr]
 	default:
-		log.Printf("[WARN] mapper1: unhandled prg read at %04X", addr)
+		warnf("mapper1: unhandled prg read at %04X", addr)
 		return 0
 	}
 }
@@ -146,11 +170,11 @@ func (m *Mapper1) ReadPRG(addr uint16) byte {
 func (m *Mapper1) WritePRG(addr uint16, data byte) {
 	switch {
 	case addr >= 0x6000 && addr <= 0x7FFF: // PRG-RAM
-		m.sram[addr-0x6000] = data
+		writePRGRAM(m.sram, addr, data)
 	case addr >= 0x8000 && addr <= 0xFFFF: // PRG-ROM (registers)
 		m.loadRegister(addr, data)
 	default:
-		log.Printf("[WARN] mapper1: unhandled prg write at %04X", addr)
+		warnf("mapper1: unhandled prg write at %04X", addr)
 	}
 }
 
@@ -165,8 +189,9 @@ func (m *Mapper1) chrBankIndex() (uint, uint) {
 	}
 }
 
+// chrOffset returns the offset of the 4KB bank, wrapped around the same way.
 func (m *Mapper1) chrOffset(idx uint) uint {
-	return idx * 0x1000
+	return idx * 0x1000 % uint(len(m.rom.CHR))
 }
 
 func (m *Mapper1) ReadCHR(addr uint16) byte {
@@ -179,14 +204,14 @@ func (m *Mapper1) ReadCHR(addr uint16) byte {
 	case addr >= 0x1000 && addr <= 0x1FFF: // CHR-RAM, bank 1
 		return m.rom.CHR[m.chrOffset(bank1)+relAddr]
 	default:
-		log.Printf("[WARN] mapper1: unhandled chr read at %04X", addr)
+		warnf("mapper1: unhandled chr read at %04X", addr)
 		return 0
 	}
 }
 
 func (m *Mapper1) WriteCHR(addr uint16, data byte) {
 	if !m.rom.chrRAM {
-		log.Printf("[WARN] mapper1: write to read-only chr at %04X", addr)
+		warnf("mapper1: write to read-only chr at %04X", addr)
 		return
 	}
 
@@ -199,14 +224,14 @@ func (m *Mapper1) WriteCHR(addr uint16, data byte) {
 	case addr >= 0x1000 && addr <= 0x1FFF: // CHR-RAM, bank 1
 		m.rom.CHR[m.chrOffset(bank1)+relAddr] = data
 	default:
-		log.Printf("mapper1: unhandled chr write at %04X", addr)
+		warnf("mapper1: unhandled chr write at %04X", addr)
 	}
 }
 
 func (m *Mapper1) SaveState(w *binario.Writer) error {
 	return errors.Join(
 		m.rom.SaveState(w),
-		w.WriteByteSlice(m.sram[:]),
+		w.WriteVarBytes(m.sram),
 		w.WriteUint8(m.control),
 		w.WriteUint8(m.chrBank0),
 		w.WriteUint8(m.chrBank1),
@@ -219,7 +244,7 @@ func (m *Mapper1) SaveState(w *binario.Writer) error {
 func (m *Mapper1) LoadState(r *binario.Reader) error {
 	return errors.Join(
 		m.rom.LoadState(r),
-		r.ReadByteSliceTo(m.sram[:]),
+		r.ReadVarBytesTo(m.sram),
 		r.ReadUint8To(&m.control),
 		r.ReadUint8To(&m.chrBank0),
 		r.ReadUint8To(&m.chrBank1),
@@ -2,7 +2,6 @@ package ines
 
 import (
 	"errors"
-	"log"
 
 	"github.com/maxpoletaev/dendy/internal/binario"
 )
@@ -19,6 +18,10 @@ func NewMapper2(rom *ROM) *Mapper2 {
 	}
 }
 
+func (m *Mapper2) ROM() *ROM {
+	return m.rom
+}
+
 func (m *Mapper2) Reset() {
 	m.prgBank0 = 0
 	m.prgBank1 = m.rom.PRGBanks - 1
@@ -35,6 +38,10 @@ func (m *Mapper2) MirrorMode() MirrorMode {
 	return m.rom.MirrorMode
 }
 
+func (m *Mapper2) Banks() string {
+	return formatBanks("PRG", 16, m.prgBank0, m.prgBank1)
+}
+
 func (m *Mapper2) ReadPRG(addr uint16) byte {
 	switch {
 	case addr >= 0x8000 && addr <= 0xBFFF:
@@ -48,7 +55,7 @@ func (m *Mapper2) ReadPRG(addr uint16) byte {
 		idx %= len(m.rom.PRG)
 		return m.rom.PRG[idx]
 	default:
-		log.Printf("[WARN] mapper2: unhandled prg read at 0x%04X", addr)
+		warnf("mapper2: unhandled prg read at 0x%04X", addr)
 		return 0
 	}
 }
@@ -64,14 +71,14 @@ func (m *Mapper2) ReadCHR(addr uint16) byte {
 	case addr >= 0x0000 && addr <= 0x1FFF:
 		return m.rom.CHR[addr]
 	default:
-		log.Printf("[WARN] mapper2: unhandled chr read at 0x%04X", addr)
+		warnf("mapper2: unhandled chr read at 0x%04X", addr)
 		return 0
 	}
 }
 
 func (m *Mapper2) WriteCHR(addr uint16, data byte) {
 	if !m.rom.chrRAM {
-		log.Printf("[WARN] mapper2: write to read-only chr at %04X", addr)
+		warnf("mapper2: write to read-only chr at %04X", addr)
 		return
 	}
 
@@ -81,8 +88,8 @@ func (m *Mapper2) WriteCHR(addr uint16, data byte) {
 func (m *Mapper2) SaveState(w *binario.Writer) error {
 	return errors.Join(
 		m.rom.SaveState(w),
-		w.WriteUint64(uint64(m.prgBank0)),
-		w.WriteUint64(uint64(m.prgBank1)),
+		w.WriteVarUint(uint64(m.prgBank0)),
+		w.WriteVarUint(uint64(m.prgBank1)),
 	)
 }
 
@@ -94,8 +101,8 @@ func (m *Mapper2) LoadState(w *binario.Reader) error {
 
 	err := errors.Join(
 		m.rom.LoadState(w),
-		w.ReadUint64To(&prgBank0),
-		w.ReadUint64To(&prgBank1),
+		w.ReadVarUintTo(&prgBank0),
+		w.ReadVarUintTo(&prgBank1),
 	)
 
 	m.prgBank0 = int(prgBank0)
@@ -2,7 +2,6 @@ package ines
 
 import (
 	"errors"
-	"log"
 
 	"github.com/maxpoletaev/dendy/internal/binario"
 )
@@ -20,6 +19,10 @@ func NewMapper3(rom *ROM) *Mapper3 {
 	}
 }
 
+func (m *Mapper3) ROM() *ROM {
+	return m.rom
+}
+
 func (m *Mapper3) Reset() {
 	m.chrBank0 = 0
 	m.prgBank0 = 0
@@ -37,6 +40,10 @@ func (m *Mapper3) MirrorMode() MirrorMode {
 	return m.rom.MirrorMode
 }
 
+func (m *Mapper3) Banks() string {
+	return formatBanks("PRG", 16, m.prgBank0, m.prgBank1) + "  " + formatBanks("CHR", 8, m.chrBank0)
+}
+
 func (m *Mapper3) ReadPRG(addr uint16) byte {
 	switch {
 	case addr >= 0x8000 && addr <= 0xBFFF:
@@ -60,14 +67,14 @@ func (m *Mapper3) ReadCHR(addr uint16) byte {
 		offset := m.chrBank0 * 0x2000
 		return m.rom.CHR[uint(addr)+offset]
 	default:
-		log.Printf("[WARN] mapper3: unhandled chr read at 0x%04X", addr)
+		warnf("mapper3: unhandled chr read at 0x%04X", addr)
 		return 0
 	}
 }
 
 func (m *Mapper3) WriteCHR(addr uint16, data byte) {
 	if !m.rom.chrRAM {
-		log.Printf("[WARN] mapper3: write to read-only chr at %04X", addr)
+		warnf("mapper3: write to read-only chr at %04X", addr)
 		return
 	}
 
@@ -77,9 +84,9 @@ func (m *Mapper3) WriteCHR(addr uint16, data byte) {
 func (m *Mapper3) SaveState(w *binario.Writer) error {
 	return errors.Join(
 		m.rom.SaveState(w),
-		w.WriteUint64(uint64(m.chrBank0)),
-		w.WriteUint64(uint64(m.prgBank0)),
-		w.WriteUint64(uint64(m.prgBank1)),
+		w.WriteVarUint(uint64(m.chrBank0)),
+		w.WriteVarUint(uint64(m.prgBank0)),
+		w.WriteVarUint(uint64(m.prgBank1)),
 	)
 }
 
@@ -92,9 +99,9 @@ func (m *Mapper3) LoadState(r *binario.Reader) error {
 
 	err := errors.Join(
 		m.rom.LoadState(r),
-		r.ReadUint64To(&chrBank0),
-		r.ReadUint64To(&prgBank0),
-		r.ReadUint64To(&prgBank1),
+		r.ReadVarUintTo(&chrBank0),
+		r.ReadVarUintTo(&prgBank0),
+		r.ReadVarUintTo(&prgBank1),
 	)
 
 	m.chrBank0 = uint(chrBank0)
@@ -3,7 +3,6 @@ package ines
 import (
 	"errors"
 	"fmt"
-	"log"
 
 	"github.com/maxpoletaev/dendy/internal/binario"
 )
@@ -12,7 +11,7 @@ import (
 // https://wiki.nesdev.com/w/index.php/MMC3
 type Mapper4 struct {
 	rom        *ROM
-	sram       [0x2000]byte
+	sram       []byte // of the size in the header
 	mirror     MirrorMode
 	chrBank    [8]int
 	prgBank    [4]int
@@ -28,10 +27,15 @@ type Mapper4 struct {
 
 func NewMapper4(rom *ROM) *Mapper4 {
 	return &Mapper4{
-		rom: rom,
+		rom:  rom,
+		sram: newPRGRAM(rom),
 	}
 }
 
+func (m *Mapper4) ROM() *ROM {
+	return m.rom
+}
+
 func (m *Mapper4) Reset() {
 	m.mirror = MirrorHorizontal
 
@@ -135,7 +139,7 @@ func (m *Mapper4) writeRegister(addr uint16, data byte) {
 	case addr >= 0xE000 && addr <= 0xFFFF && addr%2 == 1: // irq enable
 		m.irqEnable = true
 	default:
-		log.Printf("mapper4: invalid register write at %04X: %02X", addr, data)
+		warnf("mapper4: invalid register write at %04X: %02X", addr, data)
 	}
 }
 
@@ -159,16 +163,39 @@ func (m *Mapper4) MirrorMode() MirrorMode {
 	return m.mirror
 }
 
+func (m *Mapper4) Banks() string {
+	var (
+		prg [len(m.prgBank)]int
+		chr [len(m.chrBank)]int
+	)
+
+	// The banks are stored as the offsets into the ROM.
+	for i, offset := range m.prgBank {
+		prg[i] = offset / 0x2000
+	}
+
+	for i, offset := range m.chrBank {
+		chr[i] = offset / 0x0400
+	}
+
+	return formatBanks("PRG", 8, prg[:]...) + "  " + formatBanks("CHR", 1, chr[:]...)
+}
+
+// SaveRAM returns the PRG-RAM, for the games with the battery.
+func (m *Mapper4) SaveRAM() []byte {
+	return m.sram
+}
+
 func (m *Mapper4) ReadPRG(addr uint16) byte {
 	switch {
 	case addr >= 0x6000 && addr <= 0x7FFF:
-		return m.sram[addr-0x6000]
+		return readPRGRAM(m.sram, addr)
 	case addr >= 0x8000 && addr <= 0xFFFF:
 		bank := (addr - 0x8000) / 0x2000
 		offset := int(addr-0x8000) % 0x2000
 		return m.rom.PRG[m.prgBank[bank]+offset]
 	default:
-		log.Printf("[WARN] mapper4: unhandled prg read at %04X", addr)
+		warnf("mapper4: unhandled prg read at %04X", addr)
 		return 0
 	}
 }
@@ -176,11 +203,11 @@ func (m *Mapper4) ReadPRG(addr uint16) byte {
 func (m *Mapper4) WritePRG(addr uint16, data byte) {
 	switch {
 	case addr >= 0x6000 && addr <= 0x7FFF:
-		m.sram[addr-0x6000] = data
+		writePRGRAM(m.sram, addr, data)
 	case addr >= 0x8000 && addr <= 0xFFFF:
 		m.writeRegister(addr, data)
 	default:
-		log.Printf("[WARN] mapper4: unhandled prg write at %04X", addr)
+		warnf("mapper4: unhandled prg write at %04X", addr)
 	}
 }
 
@@ -191,7 +218,7 @@ func (m *Mapper4) ReadCHR(addr uint16) byte {
 		offset := int(addr % 0x0400)
 		return m.rom.CHR[m.chrBank[bank]+offset]
 	default:
-		log.Printf("[WARN] mapper4: invalid chr read at %04X", addr)
+		warnf("mapper4: invalid chr read at %04X", addr)
 		return 0
 
 	}
@@ -199,7 +226,7 @@ func (m *Mapper4) ReadCHR(addr uint16) byte {
 
 func (m *Mapper4) WriteCHR(addr uint16, data byte) {
 	if !m.rom.chrRAM {
-		log.Printf("[WARN] mapper4: write to read-only chr at %04X", addr)
+		warnf("mapper4: write to read-only chr at %04X", addr)
 		return
 	}
 
@@ -209,14 +236,14 @@ func (m *Mapper4) WriteCHR(addr uint16, data byte) {
 		offset := int(addr % 0x0400)
 		m.rom.CHR[m.chrBank[bank]+offset] = data
 	default:
-		log.Printf("[WARN] mapper4: unhandled chr write at %04X", addr)
+		warnf("mapper4: unhandled chr write at %04X", addr)
 	}
 }
 
 func (m *Mapper4) SaveState(w *binario.Writer) error {
 	err := errors.Join(
 		m.rom.SaveState(w),
-		w.WriteByteSlice(m.sram[:]),
+		w.WriteVarBytes(m.sram),
 		w.WriteUint8(m.mirror),
 		w.WriteUint8(m.prgMode),
 		w.WriteUint8(m.chrMode),
@@ -254,7 +281,7 @@ func (m *Mapper4) SaveState(w *binario.Writer) error {
 func (m *Mapper4) LoadState(r *binario.Reader) error {
 	err := errors.Join(
 		m.rom.LoadState(r),
-		r.ReadByteSliceTo(m.sram[:]),
+		r.ReadVarBytesTo(m.sram),
 		r.ReadUint8To(&m.mirror),
 		r.ReadUint8To(&m.prgMode),
 		r.ReadUint8To(&m.chrMode),
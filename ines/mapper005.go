@@ -0,0 +1,650 @@
+package ines
+
+import (
+	"errors"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+const (
+	exRAMNameTable  = 0 // ExRAM is used as a nametable
+	exRAMAttributes = 1 // the extended attributes
+	exRAMWritable   = 2 // plain RAM
+	exRAMReadOnly   = 3
+)
+
+// mmc5IdleCycles is the number of the CPU cycles without a scanline, after
+// which MMC5 decides the PPU has stopped rendering. The real chip watches the
+// PPU reads stop instead, which happens at the end of the visible scanlines.
+const mmc5IdleCycles = 142
+
+// prgSlot is the 8KB of the memory the CPU sees at $6000-$FFFF.
+type prgSlot struct {
+	offset int
+	rom    bool // or the PRG-RAM
+}
+
+// Mapper5 implements the MMC5 mapper, with the PRG and CHR banking of every
+// size, the PRG-RAM, ExRAM, the nametable mapping with the fill mode, the
+// extended attributes, the vertical split, the scanline IRQ and the multiplier.
+// The expansion audio is not emulated.
+// https://www.nesdev.org/wiki/MMC5
+type Mapper5 struct {
+	rom        *ROM
+	prgRAM     []byte // battery-backed part first, of the size in the header
+	exRAM      [0x400]byte
+	prg        [5]prgSlot // $6000, $8000, $A000, $C000, $E000
+	prgMode    uint8
+	prgRegs    [5]uint8 // $5113-$5117
+	prgProtect [2]uint8
+	chrMode    uint8
+	chrRegs    [12]uint16 // $5120-$512B, with the upper bits from $5130
+	chrUpper   uint8
+	chrLastB   bool // whether the background set was written last
+	exRAMMode  uint8
+	ntMapping  uint8
+	fillTile   uint8
+	fillColour uint8
+	splitCtrl  uint8
+	splitY     uint8
+	splitBank  uint8
+	irqCompare uint8
+	irqCounter uint8
+	irqEnable  bool
+	irqPending bool
+	inFrame    bool
+	idleCycles uint16
+	multiplier [2]uint8
+
+	// Snooped from the PPU.
+	tallSprites bool
+	rendering   bool
+	sprites     bool
+}
+
+func NewMapper5(rom *ROM) *Mapper5 {
+	// The iNES 1.0 header has no RAM size, so it is as large as MMC5 can
+	// address, and all of it is saved.
+	size := 0x10000
+	if rom.NES2 {
+		size = min(rom.PRGRAMSize+rom.PRGNVRAMSize, 0x10000)
+	}
+
+	return &Mapper5{
+		rom:    rom,
+		prgRAM: make([]byte, size),
+	}
+}
+
+func (m *Mapper5) ROM() *ROM {
+	return m.rom
+}
+
+func (m *Mapper5) Reset() {
+	m.prgMode = 3
+	m.prgRegs = [5]uint8{0, 0, 0, 0, 0xFF}
+	m.prgProtect = [2]uint8{}
+	m.chrMode = 0
+	m.chrRegs = [12]uint16{}
+	m.chrUpper = 0
+	m.chrLastB = false
+	m.exRAMMode = exRAMNameTable
+	m.ntMapping = 0
+	m.fillTile = 0
+	m.fillColour = 0
+	m.splitCtrl = 0
+	m.splitY = 0
+	m.splitBank = 0
+	m.irqCompare = 0
+	m.irqCounter = 0
+	m.irqEnable = false
+	m.irqPending = false
+	m.inFrame = false
+	m.idleCycles = 0
+	m.multiplier = [2]uint8{0xFF, 0xFF}
+	m.tallSprites = false
+	m.rendering = false
+	m.sprites = false
+
+	m.updatePRG()
+}
+
+// setPRG maps the 8KB bank to the slot. The bit 7 of the value selects the ROM.
+func (m *Mapper5) setPRG(slot int, value uint8) {
+	if value&0x80 != 0 {
+		bank := int(value&0x7F) % (len(m.rom.PRG) / 0x2000)
+		m.prg[slot] = prgSlot{offset: bank * 0x2000, rom: true}
+	} else {
+		bank := int(value & 0x07)
+		m.prg[slot] = prgSlot{offset: bank * 0x2000}
+	}
+}
+
+func (m *Mapper5) updatePRG() {
+	m.setPRG(0, m.prgRegs[0]&0x7F) // always RAM
+
+	// The last bank is always ROM. The larger banks ignore the lower bits.
+	last := m.prgRegs[4] | 0x80
+
+	switch m.prgMode {
+	case 0:
+		for i := uint8(0); i < 4; i++ {
+			m.setPRG(1+int(i), last&^0x03+i)
+		}
+	case 1:
+		m.setPRG(1, m.prgRegs[2]&^0x01)
+		m.setPRG(2, m.prgRegs[2]|0x01)
+		m.setPRG(3, last&^0x01)
+		m.setPRG(4, last|0x01)
+	case 2:
+		m.setPRG(1, m.prgRegs[2]&^0x01)
+		m.setPRG(2, m.prgRegs[2]|0x01)
+		m.setPRG(3, m.prgRegs[3])
+		m.setPRG(4, last)
+	default:
+		m.setPRG(1, m.prgRegs[1])
+		m.setPRG(2, m.prgRegs[2])
+		m.setPRG(3, m.prgRegs[3])
+		m.setPRG(4, last)
+	}
+}
+
+// chrOffset returns the offset into CHR for the address, with the sprite set
+// of the banks ($5120-$5127) or the background one ($5128-$512B).
+func (m *Mapper5) chrOffset(addr uint16, background bool) int {
+	var bank, size int
+
+	if background {
+		r := m.chrRegs[8:]
+
+		switch m.chrMode {
+		case 0:
+			bank, size = int(r[3]), 0x2000
+		case 1:
+			bank, size = int(r[3]), 0x1000
+		case 2:
+			bank, size = int(r[1+addr/0x0800%2*2]), 0x0800
+		default:
+			bank, size = int(r[addr/0x0400%4]), 0x0400
+		}
+	} else {
+		r := m.chrRegs[:8]
+
+		switch m.chrMode {
+		case 0:
+			bank, size = int(r[7]), 0x2000
+		case 1:
+			bank, size = int(r[3+addr/0x1000*4]), 0x1000
+		case 2:
+			bank, size = int(r[1+addr/0x0800*2]), 0x0800
+		default:
+			bank, size = int(r[addr/0x0400]), 0x0400
+		}
+	}
+
+	bank %= len(m.rom.CHR) / size
+
+	return bank*size + int(addr)%size
+}
+
+// backgroundSet returns whether the background set of the CHR banks is used.
+// With the 8x8 sprites, the set written last is used for everything.
+func (m *Mapper5) backgroundSet(sprites bool) bool {
+	if m.tallSprites {
+		return !sprites
+	}
+
+	return m.chrLastB
+}
+
+func (m *Mapper5) writeRegister(addr uint16, data byte) {
+	switch {
+	case addr >= 0x5000 && addr <= 0x5015: // expansion audio
+		// noop
+	case addr == 0x5100:
+		m.prgMode = data & 0x03
+		m.updatePRG()
+	case addr == 0x5101:
+		m.chrMode = data & 0x03
+	case addr == 0x5102 || addr == 0x5103:
+		m.prgProtect[addr-0x5102] = data & 0x03
+	case addr == 0x5104:
+		m.exRAMMode = data & 0x03
+	case addr == 0x5105:
+		m.ntMapping = data
+	case addr == 0x5106:
+		m.fillTile = data
+	case addr == 0x5107:
+		m.fillColour = data & 0x03
+	case addr >= 0x5113 && addr <= 0x5117:
+		m.prgRegs[addr-0x5113] = data
+		m.updatePRG()
+	case addr >= 0x5120 && addr <= 0x512B:
+		m.chrRegs[addr-0x5120] = uint16(m.chrUpper)<<8 | uint16(data)
+		m.chrLastB = addr >= 0x5128
+	case addr == 0x5130:
+		m.chrUpper = data & 0x03
+	case addr == 0x5200:
+		m.splitCtrl = data
+	case addr == 0x5201:
+		m.splitY = data
+	case addr == 0x5202:
+		m.splitBank = data
+	case addr == 0x5203:
+		m.irqCompare = data
+	case addr == 0x5204:
+		m.irqEnable = data&0x80 != 0
+	case addr == 0x5205 || addr == 0x5206:
+		m.multiplier[addr-0x5205] = data
+	case addr >= 0x5C00 && addr <= 0x5FFF:
+		m.writeExRAM(addr-0x5C00, data)
+	default:
+		warnf("mapper5: invalid register write at %04X: %02X", addr, data)
+	}
+}
+
+// writeExRAM writes to ExRAM from the CPU. While it is used by the PPU, only
+// the writes during the rendering go through, the rest write zero.
+func (m *Mapper5) writeExRAM(addr uint16, data byte) {
+	switch m.exRAMMode {
+	case exRAMNameTable, exRAMAttributes:
+		if !m.inFrame {
+			data = 0
+		}
+
+		m.exRAM[addr] = data
+	case exRAMWritable:
+		m.exRAM[addr] = data
+	default:
+		warnf("mapper5: write to read-only exram at %04X", 0x5C00+addr)
+	}
+}
+
+func (m *Mapper5) readRegister(addr uint16) byte {
+	switch {
+	case addr == 0x5204:
+		var v byte
+
+		if m.irqPending {
+			v |= 0x80
+		}
+
+		if m.inFrame {
+			v |= 0x40
+		}
+
+		m.irqPending = false
+
+		return v
+	case addr == 0x5205:
+		return byte(uint16(m.multiplier[0]) * uint16(m.multiplier[1]))
+	case addr == 0x5206:
+		return byte(uint16(m.multiplier[0]) * uint16(m.multiplier[1]) >> 8)
+	case addr >= 0x5C00 && addr <= 0x5FFF:
+		if m.exRAMMode < exRAMWritable {
+			return 0 // open bus
+		}
+
+		return m.exRAM[addr-0x5C00]
+	default:
+		warnf("mapper5: unhandled register read at %04X", addr)
+		return 0
+	}
+}
+
+// ScanlineTick counts the scanlines while the PPU is rendering. The first one
+// after the rendering has started, the pre-render scanline, resets the counter.
+func (m *Mapper5) ScanlineTick() {
+	m.idleCycles = 0
+
+	if !m.rendering {
+		m.inFrame = false
+		return
+	}
+
+	if !m.inFrame {
+		m.inFrame = true
+		m.irqCounter = 0
+		return
+	}
+
+	m.irqCounter++
+
+	if m.irqCounter == m.irqCompare && m.irqCompare != 0 {
+		m.irqPending = true
+	}
+}
+
+// CPUTick notices when the PPU has stopped rendering for the vertical blank.
+func (m *Mapper5) CPUTick() {
+	if m.inFrame {
+		if m.idleCycles++; m.idleCycles >= mmc5IdleCycles {
+			m.inFrame = false
+		}
+	}
+}
+
+// PendingIRQ keeps the IRQ line asserted until the status is read.
+func (m *Mapper5) PendingIRQ() bool {
+	return m.irqPending && m.irqEnable
+}
+
+// MirrorMode describes the nametable mapping as the closest mirroring mode. The
+// PPU does not use it, as the nametables are mapped by ReadNameTable.
+func (m *Mapper5) MirrorMode() MirrorMode {
+	switch nt0, nt1, nt2 := m.ntMapping&0x03, m.ntMapping>>2&0x03, m.ntMapping>>4&0x03; {
+	case nt0 != nt1:
+		return MirrorVertical
+	case nt0 != nt2:
+		return MirrorHorizontal
+	case nt0 == 1:
+		return MirrorSingle1
+	default:
+		return MirrorSingle0
+	}
+}
+
+func (m *Mapper5) Banks() string {
+	var (
+		prg [4]int
+		chr [8]int
+	)
+
+	for i, slot := range m.prg[1:] {
+		prg[i] = slot.offset / 0x2000
+	}
+
+	for i := range chr {
+		chr[i] = m.chrOffset(uint16(i)*0x0400, false) / 0x0400
+	}
+
+	return formatBanks("PRG", 8, prg[:]...) + "  " + formatBanks("CHR", 1, chr[:]...)
+}
+
+// SaveRAM returns the battery-backed part of the PRG-RAM, for the games with
+// the battery, or the whole of it for the iNES 1.0 dumps.
+func (m *Mapper5) SaveRAM() []byte {
+	if !m.rom.NES2 {
+		return m.prgRAM
+	}
+
+	return m.prgRAM[:min(m.rom.PRGNVRAMSize, len(m.prgRAM))]
+}
+
+// prgRAMOffset returns the offset in the PRG-RAM of the address in the slot,
+// the smaller RAM being mirrored over the banks, or -1 if there is no RAM.
+func (m *Mapper5) prgRAMOffset(slot prgSlot, addr uint16) int {
+	if len(m.prgRAM) == 0 {
+		return -1
+	}
+
+	return (slot.offset + int(addr)%0x2000) % len(m.prgRAM)
+}
+
+func (m *Mapper5) ReadPRG(addr uint16) byte {
+	switch {
+	case addr >= 0x5000 && addr <= 0x5FFF:
+		return m.readRegister(addr)
+	case addr >= 0x6000:
+		slot := m.prg[(addr-0x6000)/0x2000]
+
+		if slot.rom {
+			return m.rom.PRG[slot.offset+int(addr)%0x2000]
+		}
+
+		if offset := m.prgRAMOffset(slot, addr); offset >= 0 {
+			return m.prgRAM[offset]
+		}
+
+		return 0 // open bus
+	default:
+		warnf("mapper5: unhandled prg read at %04X", addr)
+		return 0
+	}
+}
+
+// PeekPRG reads the IRQ status without acknowledging it.
+func (m *Mapper5) PeekPRG(addr uint16) byte {
+	if addr != 0x5204 {
+		return m.ReadPRG(addr)
+	}
+
+	pending := m.irqPending
+	v := m.readRegister(addr)
+	m.irqPending = pending
+
+	return v
+}
+
+func (m *Mapper5) WritePRG(addr uint16, data byte) {
+	switch {
+	case addr >= 0x5000 && addr <= 0x5FFF:
+		m.writeRegister(addr, data)
+	case addr >= 0x6000:
+		slot := m.prg[(addr-0x6000)/0x2000]
+
+		if slot.rom || m.prgProtect != [2]uint8{2, 1} {
+			warnf("mapper5: write to read-only prg at %04X", addr)
+			return
+		}
+
+		if offset := m.prgRAMOffset(slot, addr); offset >= 0 {
+			m.prgRAM[offset] = data
+		}
+	default:
+		warnf("mapper5: unhandled prg write at %04X", addr)
+	}
+}
+
+func (m *Mapper5) ReadCHR(addr uint16) byte {
+	if addr > 0x1FFF {
+		warnf("mapper5: invalid chr read at %04X", addr)
+		return 0
+	}
+
+	return m.rom.CHR[m.chrOffset(addr, m.backgroundSet(m.sprites))]
+}
+
+func (m *Mapper5) WriteCHR(addr uint16, data byte) {
+	if !m.rom.chrRAM {
+		warnf("mapper5: write to read-only chr at %04X", addr)
+		return
+	}
+
+	if addr > 0x1FFF {
+		warnf("mapper5: unhandled chr write at %04X", addr)
+		return
+	}
+
+	m.rom.CHR[m.chrOffset(addr, m.backgroundSet(false))] = data
+}
+
+// WritePPU snoops the sprite size and whether the rendering is enabled.
+func (m *Mapper5) WritePPU(addr uint16, data byte) {
+	switch addr & 0x2007 {
+	case 0x2000:
+		m.tallSprites = data&0x20 != 0
+	case 0x2001:
+		m.rendering = data&0x18 != 0
+	}
+}
+
+// ReadNameTable reads the nametable mapped to the quadrant with $5105: either
+// of the VRAM pages, ExRAM, or the fill tile and colour.
+func (m *Mapper5) ReadNameTable(addr uint16, vram *[2][1024]byte) byte {
+	offset := addr % 0x0400
+
+	switch source := m.ntMapping >> (addr / 0x0400 % 4 * 2) & 0x03; source {
+	case 0, 1:
+		return vram[source][offset]
+	case 2:
+		if m.exRAMMode > exRAMAttributes {
+			return 0
+		}
+
+		return m.exRAM[offset]
+	default:
+		if offset >= 0x03C0 {
+			return m.fillColour * 0x55 // the same palette for every quarter
+		}
+
+		return m.fillTile
+	}
+}
+
+func (m *Mapper5) WriteNameTable(addr uint16, data byte, vram *[2][1024]byte) {
+	offset := addr % 0x0400
+
+	switch source := m.ntMapping >> (addr / 0x0400 % 4 * 2) & 0x03; source {
+	case 0, 1:
+		vram[source][offset] = data
+	case 2:
+		if m.exRAMMode <= exRAMAttributes {
+			m.exRAM[offset] = data
+		}
+	}
+}
+
+// inSplit returns whether the column of the screen is in the split region.
+func (m *Mapper5) inSplit(column int) bool {
+	if m.splitCtrl&0x80 == 0 || m.exRAMMode > exRAMAttributes {
+		return false
+	}
+
+	tiles := int(m.splitCtrl & 0x1F)
+
+	if m.splitCtrl&0x40 != 0 {
+		return column >= tiles // on the right
+	}
+
+	return column < tiles
+}
+
+// FetchBackground replaces the tiles of the split region with those of ExRAM,
+// scrolled vertically on their own, and the palettes and the banks of the rest
+// with the extended attributes.
+func (m *Mapper5) FetchBackground(t *BackgroundTile) {
+	if m.inSplit(t.Column) {
+		y := int(m.splitY) + t.Scanline
+		if y >= 240 {
+			y -= 240
+		}
+
+		row, column := y/8, t.Column%32
+		tileID := m.exRAM[row*32+column]
+		attr := m.exRAM[0x03C0+row/4*8+column/4]
+		t.Palette = attr >> (row%4/2*4 + column%4/2*2) & 0x03
+
+		bank := int(m.splitBank) % (len(m.rom.CHR) / 0x1000)
+		offset := bank*0x1000 + int(tileID)*16 + y%8
+		t.Low, t.High = m.rom.CHR[offset], m.rom.CHR[offset+8]
+
+		return
+	}
+
+	if m.exRAMMode == exRAMAttributes {
+		attr := m.exRAM[t.Addr%0x0400]
+		t.Palette = attr >> 6
+
+		bank := (int(m.chrUpper)<<6 | int(attr&0x3F)) % (len(m.rom.CHR) / 0x1000)
+		offset := bank*0x1000 + int(t.TileID)*16 + int(t.FineY)
+		t.Low, t.High = m.rom.CHR[offset], m.rom.CHR[offset+8]
+
+		return
+	}
+
+	offset := m.chrOffset(t.Pattern, m.backgroundSet(false))
+	t.Low, t.High = m.rom.CHR[offset], m.rom.CHR[offset+8]
+}
+
+// FetchSprites switches to the sprite set of the CHR banks with the 8x16
+// sprites.
+func (m *Mapper5) FetchSprites(on bool) {
+	m.sprites = on
+}
+
+func (m *Mapper5) SaveState(w *binario.Writer) error {
+	err := errors.Join(
+		m.rom.SaveState(w),
+		w.WriteVarBytes(m.prgRAM),
+		w.WriteVarBytes(m.exRAM[:]),
+		w.WriteVarBytes(m.prgRegs[:]),
+		w.WriteVarBytes(m.prgProtect[:]),
+		w.WriteVarBytes(m.multiplier[:]),
+		w.WriteUint8(m.prgMode),
+		w.WriteUint8(m.chrMode),
+		w.WriteUint8(m.chrUpper),
+		w.WriteBool(m.chrLastB),
+		w.WriteUint8(m.exRAMMode),
+		w.WriteUint8(m.ntMapping),
+		w.WriteUint8(m.fillTile),
+		w.WriteUint8(m.fillColour),
+		w.WriteUint8(m.splitCtrl),
+		w.WriteUint8(m.splitY),
+		w.WriteUint8(m.splitBank),
+		w.WriteUint8(m.irqCompare),
+		w.WriteUint8(m.irqCounter),
+		w.WriteBool(m.irqEnable),
+		w.WriteBool(m.irqPending),
+		w.WriteBool(m.inFrame),
+		w.WriteUint16(m.idleCycles),
+		w.WriteBool(m.tallSprites),
+		w.WriteBool(m.rendering),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	for i := range m.chrRegs {
+		if err := w.WriteUint16(m.chrRegs[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Mapper5) LoadState(r *binario.Reader) error {
+	err := errors.Join(
+		m.rom.LoadState(r),
+		r.ReadVarBytesTo(m.prgRAM),
+		r.ReadVarBytesTo(m.exRAM[:]),
+		r.ReadVarBytesTo(m.prgRegs[:]),
+		r.ReadVarBytesTo(m.prgProtect[:]),
+		r.ReadVarBytesTo(m.multiplier[:]),
+		r.ReadUint8To(&m.prgMode),
+		r.ReadUint8To(&m.chrMode),
+		r.ReadUint8To(&m.chrUpper),
+		r.ReadBoolTo(&m.chrLastB),
+		r.ReadUint8To(&m.exRAMMode),
+		r.ReadUint8To(&m.ntMapping),
+		r.ReadUint8To(&m.fillTile),
+		r.ReadUint8To(&m.fillColour),
+		r.ReadUint8To(&m.splitCtrl),
+		r.ReadUint8To(&m.splitY),
+		r.ReadUint8To(&m.splitBank),
+		r.ReadUint8To(&m.irqCompare),
+		r.ReadUint8To(&m.irqCounter),
+		r.ReadBoolTo(&m.irqEnable),
+		r.ReadBoolTo(&m.irqPending),
+		r.ReadBoolTo(&m.inFrame),
+		r.ReadUint16To(&m.idleCycles),
+		r.ReadBoolTo(&m.tallSprites),
+		r.ReadBoolTo(&m.rendering),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	for i := range m.chrRegs {
+		if err := r.ReadUint16To(&m.chrRegs[i]); err != nil {
+			return err
+		}
+	}
+
+	m.updatePRG()
+
+	return nil
+}
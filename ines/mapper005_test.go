@@ -0,0 +1,243 @@
+package ines
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// Peeking at the IRQ status does not acknowledge the IRQ, reading it does.
+func TestMapper5_PeekPRG(t *testing.T) {
+	m := NewMapper5(&ROM{PRG: make([]byte, 0x8000), CHR: make([]byte, 0x2000)})
+	m.Reset()
+	m.WritePRG(0x5204, 0x80) // enable the IRQ
+	m.irqPending = true
+
+	testutil.Equal(t, m.PeekPRG(0x5204)&0x80, 0x80)
+	testutil.Equal(t, m.PendingIRQ(), true)
+	testutil.Equal(t, m.ReadPRG(0x5204)&0x80, 0x80)
+	testutil.Equal(t, m.PendingIRQ(), false)
+}
+
+// newTestMapper5 creates MMC5 with 128KB of PRG and 256KB of CHR.
+func newTestMapper5() *Mapper5 {
+	m := NewMapper5(newBankedROM(0x20000, 0x40000))
+	m.Reset()
+
+	return m
+}
+
+func TestMapper5_PRGBanks(t *testing.T) {
+	tests := map[string]struct {
+		mode uint8
+		regs [4]uint8 // $5114-$5117
+		want [4]byte  // the banks at $8000, $A000, $C000 and $E000
+	}{
+		"32KB":         {mode: 0, regs: [4]uint8{0, 0, 0, 0x87}, want: [4]byte{4, 5, 6, 7}},
+		"16KB":         {mode: 1, regs: [4]uint8{0, 0x83, 0, 0x87}, want: [4]byte{2, 3, 6, 7}},
+		"16KB and 8KB": {mode: 2, regs: [4]uint8{0, 0x83, 0x85, 0x8F}, want: [4]byte{2, 3, 5, 15}},
+		"8KB":          {mode: 3, regs: [4]uint8{0x81, 0x82, 0x83, 0x84}, want: [4]byte{1, 2, 3, 4}},
+		"last is rom":  {mode: 3, regs: [4]uint8{0x81, 0x82, 0x83, 0x04}, want: [4]byte{1, 2, 3, 4}},
+		"wraps":        {mode: 3, regs: [4]uint8{0x91, 0x82, 0x83, 0x84}, want: [4]byte{1, 2, 3, 4}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestMapper5()
+			m.WritePRG(0x5100, tt.mode)
+
+			for i, v := range tt.regs {
+				m.WritePRG(0x5114+uint16(i), v)
+			}
+
+			for i, want := range tt.want {
+				testutil.Equal(t, m.ReadPRG(0x8000+uint16(i)*0x2000), want)
+			}
+		})
+	}
+}
+
+// The bank without bit 7 maps PRG-RAM, which is only writable with both of the
+// protection registers set.
+func TestMapper5_PRGRAM(t *testing.T) {
+	m := newTestMapper5()
+	m.WritePRG(0x5114, 0x01)
+
+	m.WritePRG(0x8000, 0x42)
+	testutil.Equal(t, m.ReadPRG(0x8000), byte(0))
+
+	m.WritePRG(0x5102, 0x02)
+	m.WritePRG(0x5103, 0x01)
+	m.WritePRG(0x8000, 0x42)
+	testutil.Equal(t, m.ReadPRG(0x8000), byte(0x42))
+	testutil.Equal(t, m.prgRAM[0x2000], byte(0x42))
+}
+
+// The PRG-RAM is of the size in the NES 2.0 header, the smaller one mirrored
+// over the banks, and only the battery-backed part is saved. The iNES 1.0
+// dumps have the whole 64KB, all of it saved.
+func TestMapper5_PRGRAMSize(t *testing.T) {
+	tests := map[string]struct {
+		nes2       bool
+		ram, nvram int
+		size, save int
+	}{
+		"ines":        {ram: 0x2000, size: 0x10000, save: 0x10000},
+		"battery":     {nes2: true, nvram: 0x2000, size: 0x2000, save: 0x2000},
+		"battery+ram": {nes2: true, ram: 0x2000, nvram: 0x8000, size: 0xA000, save: 0x8000},
+		"no ram":      {nes2: true, size: 0, save: 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rom := newBankedROM(0x20000, 0x40000)
+			rom.NES2, rom.PRGRAMSize, rom.PRGNVRAMSize = tt.nes2, tt.ram, tt.nvram
+
+			m := NewMapper5(rom)
+			m.Reset()
+			m.WritePRG(0x5102, 0x02)
+			m.WritePRG(0x5103, 0x01)
+			m.WritePRG(0x5114, 0x01) // the second bank of RAM at $8000
+			m.WritePRG(0x8000, 0x42)
+
+			testutil.Equal(t, len(m.prgRAM), tt.size)
+			testutil.Equal(t, len(m.SaveRAM()), tt.save)
+
+			if tt.size == 0 {
+				testutil.Equal(t, m.ReadPRG(0x8000), byte(0))
+				return
+			}
+
+			testutil.Equal(t, m.ReadPRG(0x8000), byte(0x42))
+			testutil.Equal(t, m.prgRAM[0x2000%tt.size], byte(0x42))
+		})
+	}
+}
+
+// With the 8x16 sprites, the sprites use the A set of the CHR banks and the
+// background the B set. With the 8x8 ones, both use the set written last.
+func TestMapper5_CHRSets(t *testing.T) {
+	tests := map[string]struct {
+		tall    bool
+		lastB   bool
+		sprites bool
+		addr    uint16
+		want    byte
+	}{
+		"8x16 sprites":         {tall: true, sprites: true, addr: 0x1400, want: 15},
+		"8x16 background":      {tall: true, addr: 0x1400, want: 21},
+		"8x16 background B":    {tall: true, lastB: true, addr: 0x0C00, want: 23},
+		"8x16 sprites B last":  {tall: true, lastB: true, sprites: true, addr: 0x0400, want: 11},
+		"8x8 A last":           {sprites: true, addr: 0x1400, want: 15},
+		"8x8 A last, bg":       {addr: 0x1400, want: 15},
+		"8x8 B last":           {lastB: true, sprites: true, addr: 0x1400, want: 21},
+		"8x8 B last, upper bg": {lastB: true, addr: 0x1C00, want: 23},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestMapper5()
+			m.WritePRG(0x5101, 0x03) // 1KB banks
+
+			if tt.tall {
+				m.WritePPU(0x2000, 0x20)
+			}
+
+			writeA := func() {
+				for i := uint16(0); i < 8; i++ {
+					m.WritePRG(0x5120+i, byte(10+i))
+				}
+			}
+
+			writeB := func() {
+				for i := uint16(0); i < 4; i++ {
+					m.WritePRG(0x5128+i, byte(20+i))
+				}
+			}
+
+			if tt.lastB {
+				writeA()
+				writeB()
+			} else {
+				writeB()
+				writeA()
+			}
+
+			m.FetchSprites(tt.sprites)
+			testutil.Equal(t, m.ReadCHR(tt.addr), tt.want)
+		})
+	}
+}
+
+// The status has the IRQ in bit 7 and the in-frame flag in bit 6. The counter
+// starts on the scanline after the one the rendering has started on.
+func TestMapper5_IRQStatus(t *testing.T) {
+	tests := map[string]struct {
+		scanlines int
+		idle      int // the CPU cycles after the last scanline
+		want      byte
+	}{
+		"not rendering":  {scanlines: 0, want: 0x00},
+		"in frame":       {scanlines: 1, want: 0x40},
+		"before compare": {scanlines: 2, want: 0x40},
+		"irq":            {scanlines: 3, want: 0xC0},
+		"after vblank":   {scanlines: 3, idle: mmc5IdleCycles, want: 0x80},
+		"short idle":     {scanlines: 1, idle: mmc5IdleCycles - 1, want: 0x40},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestMapper5()
+			m.WritePRG(0x5203, 2)
+			m.WritePRG(0x5204, 0x80)
+			m.WritePPU(0x2001, 0x18)
+
+			for i := 0; i < tt.scanlines; i++ {
+				m.ScanlineTick()
+			}
+
+			for i := 0; i < tt.idle; i++ {
+				m.CPUTick()
+			}
+
+			testutil.Equal(t, m.PendingIRQ(), tt.want&0x80 != 0)
+			testutil.Equal(t, m.ReadPRG(0x5204), tt.want)
+			testutil.Equal(t, m.ReadPRG(0x5204), tt.want&0x40) // acknowledged
+			testutil.Equal(t, m.PendingIRQ(), false)
+		})
+	}
+}
+
+// While ExRAM is used by the PPU, the CPU only writes it during the rendering,
+// and zero otherwise. In the read-only mode, the writes are ignored.
+func TestMapper5_ExRAMWrite(t *testing.T) {
+	tests := map[string]struct {
+		mode    uint8
+		inFrame bool
+		want    byte
+	}{
+		"nametable in frame":   {mode: exRAMNameTable, inFrame: true, want: 0x42},
+		"nametable in vblank":  {mode: exRAMNameTable, want: 0x00},
+		"attributes in frame":  {mode: exRAMAttributes, inFrame: true, want: 0x42},
+		"attributes in vblank": {mode: exRAMAttributes, want: 0x00},
+		"ram in frame":         {mode: exRAMWritable, inFrame: true, want: 0x42},
+		"ram in vblank":        {mode: exRAMWritable, want: 0x42},
+		"read-only":            {mode: exRAMReadOnly, inFrame: true, want: 0x11},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestMapper5()
+			m.exRAM[0x10] = 0x11
+			m.WritePRG(0x5104, tt.mode)
+
+			if tt.inFrame {
+				m.WritePPU(0x2001, 0x18)
+				m.ScanlineTick()
+			}
+
+			m.WritePRG(0x5C10, 0x42)
+			testutil.Equal(t, m.exRAM[0x10], tt.want)
+		})
+	}
+}
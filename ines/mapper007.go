@@ -2,7 +2,6 @@ package ines
 
 import (
 	"errors"
-	"log"
 
 	"github.com/maxpoletaev/dendy/internal/binario"
 )
@@ -38,6 +37,15 @@ func (m *Mapper7) MirrorMode() MirrorMode {
 	}
 }
 
+func (m *Mapper7) Banks() string {
+	// The CHR bank register selects the nametable instead, as the CHR is RAM.
+	return formatBanks("PRG", 32, m.prgBank) + "  " + formatBanks("NT", 1, m.chrBank)
+}
+
+func (m *Mapper7) ROM() *ROM {
+	return m.rom
+}
+
 func (m *Mapper7) Reset() {
 	m.prgBank = 0
 	m.chrBank = 0
@@ -48,24 +56,26 @@ func (m *Mapper7) WritePRG(addr uint16, data byte) {
 		m.chrBank = (data & 0x10) >> 4
 		m.prgBank = data & 0x07
 	} else {
-		log.Printf("[WARN] mapper7: unhandled prg write at %04X", addr)
+		warnf("mapper7: unhandled prg write at %04X", addr)
 	}
 }
 
 func (m *Mapper7) ReadPRG(addr uint16) byte {
 	switch {
 	case addr >= 0x8000 && addr <= 0xFFFF:
+		// The games smaller than 256KB ignore the upper bits of the bank.
+		bank := int(m.prgBank) % (len(m.rom.PRG) / 0x8000)
 		offset := int(addr-0x8000) % 0x8000
-		return m.rom.PRG[int(m.prgBank)*0x8000+offset]
+		return m.rom.PRG[bank*0x8000+offset]
 	default:
-		log.Printf("[WARN] mapper7: unhandled prg read at %04X", addr)
+		warnf("mapper7: unhandled prg read at %04X", addr)
 		return 0
 	}
 }
 
 func (m *Mapper7) WriteCHR(addr uint16, data byte) {
 	if !m.rom.chrRAM {
-		log.Printf("[WARN] mapper4: write to read-only chr at %04X", addr)
+		warnf("mapper7: write to read-only chr at %04X", addr)
 		return
 	}
 
@@ -73,7 +83,7 @@ func (m *Mapper7) WriteCHR(addr uint16, data byte) {
 	case addr >= 0x0000 && addr <= 0x1FFF:
 		m.rom.CHR[int(addr)%len(m.rom.CHR)] = data
 	default:
-		log.Printf("[WARN] mapper7: invalid chr write at %04X", addr)
+		warnf("mapper7: invalid chr write at %04X", addr)
 	}
 }
 
@@ -82,7 +92,7 @@ func (m *Mapper7) ReadCHR(addr uint16) byte {
 	case addr >= 0x0000 && addr <= 0x1FFF:
 		return m.rom.CHR[int(addr)%len(m.rom.CHR)]
 	default:
-		log.Printf("[WARN] mapper7: invalid chr read at %04X", addr)
+		warnf("mapper7: invalid chr read at %04X", addr)
 		return 0
 	}
 }
@@ -0,0 +1,295 @@
+package ines
+
+import (
+	"errors"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+// Mapper19 implements Namco 163: three 8KB PRG banks with the last one fixed,
+// eight 1KB CHR banks, and the four nametables mapped each to either page of
+// the console VRAM or to a page of CHR. The banks $E0-$FF select the VRAM as
+// the CHR too, unless disabled for the pattern table. It also has the 15-bit
+// IRQ counter clocked by the CPU, and the wavetable expansion audio.
+// https://www.nesdev.org/wiki/Namco_163
+type Mapper19 struct {
+	rom        *ROM
+	vram       *[2][1024]byte // of the console, given by the nametable accesses
+	sram       []byte         // of the size in the header
+	chrBank    [8]uint8
+	ntBank     [4]uint8
+	prgBank    [3]uint8 // $8000, $A000, $C000
+	chrROMOnly uint8    // $E800 bits 6 and 7: no VRAM in the pattern tables
+	protect    uint8    // $F800: the write protection of PRG-RAM
+	irqEnable  bool
+	irqCounter uint16
+	irqPending bool
+	audio      n163Audio
+}
+
+func NewMapper19(rom *ROM) *Mapper19 {
+	return &Mapper19{
+		rom:  rom,
+		sram: newPRGRAM(rom),
+	}
+}
+
+func (m *Mapper19) ROM() *ROM {
+	return m.rom
+}
+
+func (m *Mapper19) Reset() {
+	m.chrBank = [8]uint8{}
+	m.ntBank = [4]uint8{}
+	m.prgBank = [3]uint8{}
+	m.chrROMOnly = 0
+	m.protect = 0
+	m.irqEnable = false
+	m.irqCounter = 0
+	m.irqPending = false
+	m.audio.reset()
+}
+
+// CPUTick counts the IRQ counter up, which stops at $7FFF with the IRQ raised,
+// and clocks the audio.
+func (m *Mapper19) CPUTick() {
+	if m.irqEnable && m.irqCounter < 0x7FFF {
+		if m.irqCounter++; m.irqCounter == 0x7FFF {
+			m.irqPending = true
+		}
+	}
+
+	m.audio.tick()
+}
+
+// AudioOutput returns the mix of the wavetable channels.
+func (m *Mapper19) AudioOutput() float32 {
+	return m.audio.output()
+}
+
+func (m *Mapper19) ScanlineTick() {}
+
+// PendingIRQ keeps the IRQ line asserted until it is acknowledged.
+func (m *Mapper19) PendingIRQ() bool {
+	return m.irqPending
+}
+
+// MirrorMode is only for the information, as the nametables are mapped by
+// ReadNameTable.
+func (m *Mapper19) MirrorMode() MirrorMode {
+	switch nt0, nt1, nt2 := m.ntBank[0]&0x01, m.ntBank[1]&0x01, m.ntBank[2]&0x01; {
+	case nt0 != nt1:
+		return MirrorVertical
+	case nt0 != nt2:
+		return MirrorHorizontal
+	case nt0 == 1:
+		return MirrorSingle1
+	default:
+		return MirrorSingle0
+	}
+}
+
+func (m *Mapper19) Banks() string {
+	return formatBanks("PRG", 8, m.prgBank[:]...) + "  " + formatBanks("CHR", 1, m.chrBank[:]...) + "  " + formatBanks("NT", 1, m.ntBank[:]...)
+}
+
+// SaveRAM returns the PRG-RAM, for the games with the battery.
+func (m *Mapper19) SaveRAM() []byte {
+	return m.sram
+}
+
+func (m *Mapper19) prgOffset(bank uint8, addr uint16) int {
+	bank8 := int(bank&0x3F) % (len(m.rom.PRG) / 0x2000)
+	return bank8*0x2000 + int(addr%0x2000)
+}
+
+func (m *Mapper19) ReadPRG(addr uint16) byte {
+	switch {
+	case addr >= 0x4800 && addr <= 0x4FFF:
+		return m.audio.read()
+	case addr >= 0x5000 && addr <= 0x57FF:
+		return uint8(m.irqCounter)
+	case addr >= 0x5800 && addr <= 0x5FFF:
+		data := uint8(m.irqCounter >> 8)
+		if m.irqEnable {
+			data |= 0x80
+		}
+
+		return data
+	case addr >= 0x6000 && addr <= 0x7FFF:
+		return readPRGRAM(m.sram, addr)
+	case addr >= 0x8000 && addr <= 0xDFFF:
+		return m.rom.PRG[m.prgOffset(m.prgBank[(addr-0x8000)/0x2000], addr)]
+	case addr >= 0xE000:
+		return m.rom.PRG[len(m.rom.PRG)-0x2000+int(addr-0xE000)]
+	default:
+		warnf("mapper19: unhandled prg read at %04X", addr)
+		return 0
+	}
+}
+
+// PeekPRG reads the audio data port without incrementing the address.
+func (m *Mapper19) PeekPRG(addr uint16) byte {
+	if addr >= 0x4800 && addr <= 0x4FFF {
+		return m.audio.ram[m.audio.addr&0x7F]
+	}
+
+	return m.ReadPRG(addr)
+}
+
+// writeSRAM writes PRG-RAM if the upper bits of $F800 are $4, and the 2KB page
+// is not protected by the lower bits.
+func (m *Mapper19) writeSRAM(addr uint16, data byte) {
+	page := (addr - 0x6000) / 0x0800
+
+	if m.protect>>4 == 0x04 && m.protect&(1<<page) == 0 {
+		writePRGRAM(m.sram, addr, data)
+	}
+}
+
+func (m *Mapper19) WritePRG(addr uint16, data byte) {
+	switch {
+	case addr >= 0x4800 && addr <= 0x4FFF:
+		m.audio.write(data)
+	case addr >= 0x5000 && addr <= 0x57FF:
+		m.irqCounter = m.irqCounter&0x7F00 | uint16(data)
+		m.irqPending = false
+	case addr >= 0x5800 && addr <= 0x5FFF:
+		m.irqCounter = m.irqCounter&0x00FF | uint16(data&0x7F)<<8
+		m.irqEnable = data&0x80 != 0
+		m.irqPending = false
+	case addr >= 0x6000 && addr <= 0x7FFF:
+		m.writeSRAM(addr, data)
+	case addr >= 0x8000 && addr <= 0xBFFF:
+		m.chrBank[(addr-0x8000)/0x0800] = data
+	case addr >= 0xC000 && addr <= 0xDFFF:
+		m.ntBank[(addr-0xC000)/0x0800] = data
+	case addr >= 0xE000 && addr <= 0xE7FF:
+		m.prgBank[0] = data & 0x3F
+		m.audio.disabled = data&0x40 != 0
+	case addr >= 0xE800 && addr <= 0xEFFF:
+		m.prgBank[1] = data & 0x3F
+		m.chrROMOnly = data & 0xC0
+	case addr >= 0xF000 && addr <= 0xF7FF:
+		m.prgBank[2] = data & 0x3F
+	case addr >= 0xF800:
+		m.protect = data
+		m.audio.addr = data
+	default:
+		warnf("mapper19: unhandled prg write at %04X", addr)
+	}
+}
+
+func (m *Mapper19) chrOffset(bank uint8, addr uint16) int {
+	bank1 := int(bank) % (len(m.rom.CHR) / 0x0400)
+	return bank1*0x0400 + int(addr%0x0400)
+}
+
+// chrVRAM tells whether the bank of the pattern table selects the VRAM page.
+func (m *Mapper19) chrVRAM(addr uint16) bool {
+	return m.chrBank[addr/0x0400] >= 0xE0 && m.chrROMOnly&(0x40<<(addr/0x1000)) == 0
+}
+
+func (m *Mapper19) ReadCHR(addr uint16) byte {
+	if addr > 0x1FFF {
+		warnf("mapper19: invalid chr read at %04X", addr)
+		return 0
+	}
+
+	bank := m.chrBank[addr/0x0400]
+
+	if m.chrVRAM(addr) {
+		if m.vram == nil {
+			return 0
+		}
+
+		return m.vram[bank&0x01][addr%0x0400]
+	}
+
+	return m.rom.CHR[m.chrOffset(bank, addr)]
+}
+
+func (m *Mapper19) WriteCHR(addr uint16, data byte) {
+	if addr > 0x1FFF {
+		warnf("mapper19: unhandled chr write at %04X", addr)
+		return
+	}
+
+	bank := m.chrBank[addr/0x0400]
+
+	switch {
+	case m.chrVRAM(addr):
+		if m.vram != nil {
+			m.vram[bank&0x01][addr%0x0400] = data
+		}
+	case m.rom.chrRAM:
+		m.rom.CHR[m.chrOffset(bank, addr)] = data
+	default:
+		warnf("mapper19: write to read-only chr at %04X", addr)
+	}
+}
+
+func (m *Mapper19) WritePPU(addr uint16, data byte) {}
+
+// ReadNameTable reads the page of the VRAM or of CHR mapped to the quadrant.
+// The VRAM is remembered for the pattern tables, which may be mapped to it.
+func (m *Mapper19) ReadNameTable(addr uint16, vram *[2][1024]byte) byte {
+	m.vram = vram
+	bank := m.ntBank[addr/0x0400%4]
+
+	if bank >= 0xE0 {
+		return vram[bank&0x01][addr%0x0400]
+	}
+
+	return m.rom.CHR[m.chrOffset(bank, addr)]
+}
+
+func (m *Mapper19) WriteNameTable(addr uint16, data byte, vram *[2][1024]byte) {
+	m.vram = vram
+	bank := m.ntBank[addr/0x0400%4]
+
+	switch {
+	case bank >= 0xE0:
+		vram[bank&0x01][addr%0x0400] = data
+	case m.rom.chrRAM:
+		m.rom.CHR[m.chrOffset(bank, addr)] = data
+	}
+}
+
+func (m *Mapper19) FetchBackground(t *BackgroundTile) {
+	t.Low, t.High = m.ReadCHR(t.Pattern), m.ReadCHR(t.Pattern+8)
+}
+
+func (m *Mapper19) FetchSprites(on bool) {}
+
+func (m *Mapper19) SaveState(w *binario.Writer) error {
+	return errors.Join(
+		m.rom.SaveState(w),
+		w.WriteVarBytes(m.sram),
+		w.WriteVarBytes(m.chrBank[:]),
+		w.WriteVarBytes(m.ntBank[:]),
+		w.WriteVarBytes(m.prgBank[:]),
+		w.WriteUint8(m.chrROMOnly),
+		w.WriteUint8(m.protect),
+		w.WriteBool(m.irqEnable),
+		w.WriteUint16(m.irqCounter),
+		w.WriteBool(m.irqPending),
+		m.audio.saveState(w),
+	)
+}
+
+func (m *Mapper19) LoadState(r *binario.Reader) error {
+	return errors.Join(
+		m.rom.LoadState(r),
+		r.ReadVarBytesTo(m.sram),
+		r.ReadVarBytesTo(m.chrBank[:]),
+		r.ReadVarBytesTo(m.ntBank[:]),
+		r.ReadVarBytesTo(m.prgBank[:]),
+		r.ReadUint8To(&m.chrROMOnly),
+		r.ReadUint8To(&m.protect),
+		r.ReadBoolTo(&m.irqEnable),
+		r.ReadUint16To(&m.irqCounter),
+		r.ReadBoolTo(&m.irqPending),
+		m.audio.loadState(r),
+	)
+}
@@ -0,0 +1,145 @@
+package ines
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newTestMapper19 creates Namco 163 with 128KB of PRG and 128KB of CHR.
+func newTestMapper19() *Mapper19 {
+	m := NewMapper19(newBankedROM(0x20000, 0x20000))
+	m.Reset()
+
+	return m
+}
+
+// The counter counts up to $7FFF, where it stops with the IRQ raised, which is
+// acknowledged by writing any of the counter registers.
+func TestMapper19_IRQ(t *testing.T) {
+	m := newTestMapper19()
+	m.WritePRG(0x5000, 0xFD)
+	m.WritePRG(0x5800, 0xFF) // enabled, $7FFD
+
+	testutil.Equal(t, m.ReadPRG(0x5000), 0xFD)
+	testutil.Equal(t, m.ReadPRG(0x5800), 0xFF)
+
+	m.CPUTick()
+	testutil.Equal(t, m.PendingIRQ(), false)
+
+	m.CPUTick()
+	testutil.Equal(t, m.PendingIRQ(), true)
+	testutil.Equal(t, m.irqCounter, 0x7FFF)
+
+	m.CPUTick()
+	testutil.Equal(t, m.irqCounter, 0x7FFF)
+	testutil.Equal(t, m.PendingIRQ(), true)
+
+	m.WritePRG(0x5000, 0x00)
+	testutil.Equal(t, m.PendingIRQ(), false)
+
+	// The disabled counter does not count.
+	m.WritePRG(0x5800, 0x10)
+	m.CPUTick()
+	testutil.Equal(t, m.irqCounter, 0x1000)
+	testutil.Equal(t, m.ReadPRG(0x5800), 0x10)
+}
+
+func TestMapper19_PRGBanks(t *testing.T) {
+	m := newTestMapper19()
+	m.WritePRG(0xE000, 0x41) // the audio is disabled by bit 6
+	m.WritePRG(0xE800, 0x02)
+	m.WritePRG(0xF000, 0x13) // wraps to 3
+
+	testutil.Equal(t, m.ReadPRG(0x8000), 1)
+	testutil.Equal(t, m.ReadPRG(0xA000), 2)
+	testutil.Equal(t, m.ReadPRG(0xC000), 3)
+	testutil.Equal(t, m.ReadPRG(0xE000), 15)
+	testutil.Equal(t, m.audio.disabled, true)
+}
+
+// PRG-RAM is only written with $4x in the upper bits of $F800, to the 2KB
+// pages not protected by the lower bits.
+func TestMapper19_PRGRAM(t *testing.T) {
+	m := newTestMapper19()
+	m.sram = make([]byte, 0x2000)
+
+	m.WritePRG(0x6000, 0x11)
+	testutil.Equal(t, m.ReadPRG(0x6000), 0)
+
+	m.WritePRG(0xF800, 0x42) // the page at $6800 is protected
+	m.WritePRG(0x6000, 0x11)
+	m.WritePRG(0x6800, 0x22)
+	testutil.Equal(t, m.ReadPRG(0x6000), 0x11)
+	testutil.Equal(t, m.ReadPRG(0x6800), 0)
+}
+
+func TestMapper19_NameTables(t *testing.T) {
+	var vram [2][1024]byte
+	vram[0][0x10] = 0xA0
+	vram[1][0x10] = 0xA1
+
+	tests := map[string]struct {
+		bank uint8
+		want byte
+	}{
+		"vram page 0":   {bank: 0xE0, want: 0xA0},
+		"vram page 1":   {bank: 0xFF, want: 0xA1},
+		"chr bank":      {bank: 0x05, want: 0x05},
+		"last chr bank": {bank: 0xDF, want: 0xDF % 0x80},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestMapper19()
+			m.WritePRG(0xC800, tt.bank) // the second nametable
+
+			testutil.Equal(t, m.ReadNameTable(0x2410, &vram), tt.want)
+		})
+	}
+}
+
+// The CHR RAM of the nametables is only written on the boards with CHR-RAM.
+func TestMapper19_WriteNameTableCHR(t *testing.T) {
+	var vram [2][1024]byte
+
+	m := newTestMapper19()
+	m.WritePRG(0xC000, 0x03)
+	m.WriteNameTable(0x2000, 0x55, &vram)
+	testutil.Equal(t, m.ReadNameTable(0x2000, &vram), 0x03)
+
+	m.rom.chrRAM = true
+	m.WriteNameTable(0x2000, 0x55, &vram)
+	testutil.Equal(t, m.ReadNameTable(0x2000, &vram), 0x55)
+}
+
+// The CHR banks $E0-$FF select the VRAM pages, unless disabled for the pattern
+// table by the bits 6 and 7 of $E800.
+func TestMapper19_CHRVRAM(t *testing.T) {
+	tests := map[string]struct {
+		romOnly uint8
+		low     byte // at $0000
+		high    byte // at $1000
+	}{
+		"vram in both": {romOnly: 0x00, low: 0xA1, high: 0xA0},
+		"rom in low":   {romOnly: 0x40, low: 0xE1 % 0x80, high: 0xA0},
+		"rom in high":  {romOnly: 0x80, low: 0xA1, high: 0xE0 % 0x80},
+		"rom in both":  {romOnly: 0xC0, low: 0xE1 % 0x80, high: 0xE0 % 0x80},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var vram [2][1024]byte
+			vram[0][0], vram[1][0] = 0xA0, 0xA1
+
+			m := newTestMapper19()
+			m.ReadNameTable(0x2000, &vram) // the vram is given by the PPU
+			m.WritePRG(0x8000, 0xE1)
+			m.WritePRG(0xA000, 0xE0)
+			m.WritePRG(0xE800, tt.romOnly)
+
+			testutil.Equal(t, m.ReadCHR(0x0000), tt.low)
+			testutil.Equal(t, m.ReadCHR(0x1000), tt.high)
+		})
+	}
+}
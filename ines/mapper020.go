@@ -0,0 +1,500 @@
+package ines
+
+import (
+	"errors"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+const (
+	// fdsByteCycles is how long the drive takes to read or write a byte.
+	fdsByteCycles = 150
+
+	// fdsRewindCycles is how long the head takes to get back to the start of the
+	// disk, once the motor is turned on.
+	fdsRewindCycles = 50000
+
+	// fdsInsertCycles is how long the disk is out when the side is switched, for
+	// the games to see that it has been ejected, about a second.
+	fdsInsertCycles = 1789773
+)
+
+// Mapper20 implements the Famicom Disk System, the RAM adapter with the disk
+// drive. It has 32KB of RAM at $6000-$DFFF, the BIOS at $E000, 8KB of CHR-RAM,
+// the timer IRQ, and the sound channel. The disk is read and written a byte at
+// a time, with the IRQ after every byte. The writes only change the disk in
+// memory, which is kept in the saved states, and not the image file.
+// https://www.nesdev.org/wiki/Family_Computer_Disk_System
+type Mapper20 struct {
+	rom         *ROM
+	ram         [0x8000]byte
+	disk        [][]byte // the sides with the gaps, as the drive reads them
+	diskWritten bool     // the disk is saved in the state only once written
+	side        int      // -1 while the disk is out
+	nextSide    int
+	insertDelay int32
+	irqReload   uint16
+	irqCounter  uint16
+	irqRepeat   bool
+	irqEnable   bool
+	timerIRQ    bool
+	diskEnable  bool // $4023
+	soundEnable bool
+	control     uint8 // $4025
+	readData    uint8
+	writeData   uint8
+	transferred bool // a byte has been read or written
+	diskIRQ     bool
+	endOfHead   bool
+	scanning    bool
+	gapEnded    bool
+	position    int
+	delay       int32
+	audio       fdsAudio
+}
+
+func NewMapper20(rom *ROM) *Mapper20 {
+	m := &Mapper20{
+		rom:  rom,
+		disk: make([][]byte, len(rom.Disk)),
+		side: 0, // the first side is inserted at the power-on
+	}
+
+	for i, side := range rom.Disk {
+		m.disk[i] = addGaps(side)
+	}
+
+	return m
+}
+
+func (m *Mapper20) ROM() *ROM {
+	return m.rom
+}
+
+// Reset resets the adapter, keeping the disk in the drive.
+func (m *Mapper20) Reset() {
+	m.irqReload = 0
+	m.irqCounter = 0
+	m.irqRepeat = false
+	m.irqEnable = false
+	m.timerIRQ = false
+	m.diskEnable = false
+	m.soundEnable = false
+	m.control = 0
+	m.readData = 0
+	m.writeData = 0
+	m.transferred = false
+	m.diskIRQ = false
+	m.endOfHead = true
+	m.scanning = false
+	m.gapEnded = false
+	m.position = 0
+	m.delay = 0
+	m.audio.reset()
+}
+
+// Sides returns the number of the disk sides.
+func (m *Mapper20) Sides() int {
+	return len(m.disk)
+}
+
+// Side returns the inserted side, or -1 while the disk is out.
+func (m *Mapper20) Side() int {
+	return m.side
+}
+
+// SwitchSide ejects the disk and inserts the next side after a delay, as the
+// games wait for the disk to be taken out before reading the other side.
+func (m *Mapper20) SwitchSide() int {
+	if m.insertDelay > 0 {
+		m.nextSide = (m.nextSide + 1) % len(m.disk)
+	} else {
+		m.nextSide = (m.side + 1) % len(m.disk)
+	}
+
+	m.side = -1
+	m.insertDelay = fdsInsertCycles
+
+	return m.nextSide
+}
+
+func (m *Mapper20) motorOn() bool       { return m.control&0x01 != 0 }
+func (m *Mapper20) resetTransfer() bool { return m.control&0x02 != 0 }
+func (m *Mapper20) readMode() bool      { return m.control&0x04 != 0 }
+func (m *Mapper20) diskReady() bool     { return m.control&0x40 != 0 }
+func (m *Mapper20) diskIRQOn() bool     { return m.control&0x80 != 0 }
+
+// CPUTick clocks the timer IRQ, the sound channel, and the disk drive.
+func (m *Mapper20) CPUTick() {
+	if m.irqEnable && m.diskEnable {
+		if m.irqCounter == 0 {
+			m.timerIRQ = true
+			m.irqCounter = m.irqReload
+
+			if !m.irqRepeat {
+				m.irqEnable = false
+			}
+		} else {
+			m.irqCounter--
+		}
+	}
+
+	m.audio.tick()
+
+	if m.insertDelay > 0 {
+		if m.insertDelay--; m.insertDelay == 0 {
+			m.side = m.nextSide
+		}
+	}
+
+	m.tickDrive()
+}
+
+// tickDrive moves the disk under the head. The drive needs the time to get back
+// to the start of the disk, and then reads or writes a byte every 150 cycles,
+// the first byte of a block being found after the gap.
+func (m *Mapper20) tickDrive() {
+	if m.side < 0 || !m.motorOn() {
+		m.endOfHead = true
+		m.scanning = false
+		return
+	}
+
+	if m.resetTransfer() && !m.scanning {
+		return
+	}
+
+	if m.endOfHead {
+		m.delay = fdsRewindCycles
+		m.endOfHead = false
+		m.position = 0
+		m.gapEnded = false
+		return
+	}
+
+	if m.delay > 0 {
+		m.delay--
+		return
+	}
+
+	m.scanning = true
+	disk := m.disk[m.side]
+	needIRQ := m.diskIRQOn()
+
+	if m.readMode() {
+		data := disk[m.position]
+
+		if !m.diskReady() {
+			m.gapEnded = false
+		} else if data != 0 && !m.gapEnded {
+			m.gapEnded = true // the mark bit of the block, not a data byte
+			needIRQ = false
+		}
+
+		if m.gapEnded {
+			m.transferred = true
+			m.readData = data
+			m.diskIRQ = m.diskIRQ || needIRQ
+		}
+	} else {
+		data := m.writeData
+		m.transferred = true
+		m.diskIRQ = m.diskIRQ || needIRQ
+
+		if !m.diskReady() {
+			data = 0
+		}
+
+		if m.control&0x10 != 0 {
+			data = 0 // the checksum, which is not verified
+		}
+
+		disk[m.position] = data
+		m.diskWritten = true
+		m.gapEnded = false
+	}
+
+	if m.position++; m.position >= len(disk) {
+		m.control &^= 0x01 // the motor stops at the end of the disk
+		m.endOfHead = true
+	} else {
+		m.delay = fdsByteCycles - 1 // counting the cycle of the transfer
+	}
+}
+
+// AudioOutput returns the output of the sound channel.
+func (m *Mapper20) AudioOutput() float32 {
+	return fdsLevel * float32(m.audio.output)
+}
+
+func (m *Mapper20) ScanlineTick() {}
+
+// PendingIRQ keeps the IRQ line asserted until the status is read.
+func (m *Mapper20) PendingIRQ() bool {
+	return m.timerIRQ || m.diskIRQ
+}
+
+func (m *Mapper20) MirrorMode() MirrorMode {
+	if m.control&0x08 != 0 {
+		return MirrorHorizontal
+	}
+
+	return MirrorVertical
+}
+
+func (m *Mapper20) Banks() string {
+	if m.side < 0 {
+		return "Disk: ejected"
+	}
+
+	return formatBanks("Disk", 64, m.side+1)
+}
+
+func (m *Mapper20) readRegister(addr uint16) byte {
+	switch {
+	case addr == 0x4030:
+		var data byte
+
+		if m.timerIRQ {
+			data |= 0x01
+		}
+
+		if m.transferred {
+			data |= 0x02
+		}
+
+		if m.endOfHead {
+			data |= 0x40
+		}
+
+		m.transferred = false
+		m.timerIRQ = false
+		m.diskIRQ = false
+
+		return data
+	case addr == 0x4031:
+		m.transferred = false
+		m.diskIRQ = false
+
+		return m.readData
+	case addr == 0x4032:
+		data := byte(0x40)
+
+		if m.side < 0 {
+			data |= 0x01 | 0x04 // no disk, which is also write-protected
+		}
+
+		if m.side < 0 || !m.scanning {
+			data |= 0x02
+		}
+
+		return data
+	case addr == 0x4033:
+		return 0x80 // the battery is good
+	case addr >= 0x4040 && addr <= 0x4092:
+		return m.audio.read(addr)
+	default:
+		return 0 // open bus
+	}
+}
+
+func (m *Mapper20) writeRegister(addr uint16, data byte) {
+	if addr == 0x4023 {
+		m.diskEnable = data&0x01 != 0
+		m.soundEnable = data&0x02 != 0
+
+		if !m.diskEnable {
+			m.irqEnable = false
+			m.timerIRQ = false
+			m.diskIRQ = false
+		}
+
+		return
+	}
+
+	switch {
+	case addr >= 0x4020 && addr <= 0x4026:
+		if m.diskEnable {
+			m.writeDisk(addr, data)
+		}
+	case addr >= 0x4040 && addr <= 0x408A:
+		if m.soundEnable {
+			m.audio.write(addr, data)
+		}
+	default:
+		warnf("mapper20: unhandled register write at %04X: %02X", addr, data)
+	}
+}
+
+func (m *Mapper20) writeDisk(addr uint16, data byte) {
+	switch addr {
+	case 0x4020:
+		m.irqReload = m.irqReload&0xFF00 | uint16(data)
+	case 0x4021:
+		m.irqReload = m.irqReload&0x00FF | uint16(data)<<8
+	case 0x4022:
+		m.irqRepeat = data&0x01 != 0
+		m.irqEnable = data&0x02 != 0
+		m.timerIRQ = false
+
+		if m.irqEnable {
+			m.irqCounter = m.irqReload
+		}
+	case 0x4024:
+		m.writeData = data
+		m.transferred = false
+		m.diskIRQ = false
+	case 0x4025:
+		m.control = data
+		m.diskIRQ = false
+	case 0x4026:
+		// The expansion port, which is not connected.
+	}
+}
+
+func (m *Mapper20) ReadPRG(addr uint16) byte {
+	switch {
+	case addr >= 0xE000:
+		return m.rom.PRG[addr-0xE000]
+	case addr >= 0x6000:
+		return m.ram[addr-0x6000]
+	default:
+		return m.readRegister(addr)
+	}
+}
+
+// PeekPRG reads the RAM and the BIOS, and the registers as zero, as reading
+// them acknowledges the IRQs and moves the disk transfer along.
+func (m *Mapper20) PeekPRG(addr uint16) byte {
+	if addr < 0x6000 {
+		return 0
+	}
+
+	return m.ReadPRG(addr)
+}
+
+func (m *Mapper20) WritePRG(addr uint16, data byte) {
+	switch {
+	case addr >= 0xE000:
+		warnf("mapper20: write to bios at %04X: %02X", addr, data)
+	case addr >= 0x6000:
+		m.ram[addr-0x6000] = data
+	default:
+		m.writeRegister(addr, data)
+	}
+}
+
+func (m *Mapper20) ReadCHR(addr uint16) byte {
+	if addr > 0x1FFF {
+		warnf("mapper20: invalid chr read at %04X", addr)
+		return 0
+	}
+
+	return m.rom.CHR[addr]
+}
+
+func (m *Mapper20) WriteCHR(addr uint16, data byte) {
+	if addr > 0x1FFF {
+		warnf("mapper20: unhandled chr write at %04X", addr)
+		return
+	}
+
+	m.rom.CHR[addr] = data
+}
+
+func (m *Mapper20) SaveState(w *binario.Writer) error {
+	err := errors.Join(
+		m.rom.SaveState(w),
+		w.WriteVarBytes(m.ram[:]),
+		w.WriteBool(m.diskWritten),
+	)
+
+	// The disk is large, and most of the games never write to it.
+	if m.diskWritten {
+		for _, side := range m.disk {
+			err = errors.Join(err, w.WriteVarBytes(side))
+		}
+	}
+
+	return errors.Join(
+		err,
+		w.WriteUint32(uint32(m.side)),
+		w.WriteUint32(uint32(m.nextSide)),
+		w.WriteUint32(uint32(m.insertDelay)),
+		w.WriteUint16(m.irqReload),
+		w.WriteUint16(m.irqCounter),
+		w.WriteBool(m.irqRepeat),
+		w.WriteBool(m.irqEnable),
+		w.WriteBool(m.timerIRQ),
+		w.WriteBool(m.diskEnable),
+		w.WriteBool(m.soundEnable),
+		w.WriteUint8(m.control),
+		w.WriteUint8(m.readData),
+		w.WriteUint8(m.writeData),
+		w.WriteBool(m.transferred),
+		w.WriteBool(m.diskIRQ),
+		w.WriteBool(m.endOfHead),
+		w.WriteBool(m.scanning),
+		w.WriteBool(m.gapEnded),
+		w.WriteUint32(uint32(m.position)),
+		w.WriteUint32(uint32(m.delay)),
+		m.audio.saveState(w),
+	)
+}
+
+func (m *Mapper20) LoadState(r *binario.Reader) error {
+	err := errors.Join(
+		m.rom.LoadState(r),
+		r.ReadVarBytesTo(m.ram[:]),
+		r.ReadBoolTo(&m.diskWritten),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if m.diskWritten {
+		for _, side := range m.disk {
+			err = errors.Join(err, r.ReadVarBytesTo(side))
+		}
+	} else {
+		// The state was saved before any writes, while the disk in memory may
+		// have been written since.
+		for i, side := range m.rom.Disk {
+			m.disk[i] = addGaps(side)
+		}
+	}
+
+	var side, nextSide, insertDelay, position, delay uint32
+
+	err = errors.Join(
+		err,
+		r.ReadUint32To(&side),
+		r.ReadUint32To(&nextSide),
+		r.ReadUint32To(&insertDelay),
+		r.ReadUint16To(&m.irqReload),
+		r.ReadUint16To(&m.irqCounter),
+		r.ReadBoolTo(&m.irqRepeat),
+		r.ReadBoolTo(&m.irqEnable),
+		r.ReadBoolTo(&m.timerIRQ),
+		r.ReadBoolTo(&m.diskEnable),
+		r.ReadBoolTo(&m.soundEnable),
+		r.ReadUint8To(&m.control),
+		r.ReadUint8To(&m.readData),
+		r.ReadUint8To(&m.writeData),
+		r.ReadBoolTo(&m.transferred),
+		r.ReadBoolTo(&m.diskIRQ),
+		r.ReadBoolTo(&m.endOfHead),
+		r.ReadBoolTo(&m.scanning),
+		r.ReadBoolTo(&m.gapEnded),
+		r.ReadUint32To(&position),
+		r.ReadUint32To(&delay),
+		m.audio.loadState(r),
+	)
+
+	m.side, m.nextSide = int(int32(side)), int(nextSide)
+	m.insertDelay, m.delay = int32(insertDelay), int32(delay)
+	m.position = int(position)
+
+	return err
+}
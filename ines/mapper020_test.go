@@ -0,0 +1,200 @@
+package ines
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newTestMapper20 creates the disk system with the two sides, each holding
+// the disk info block, where the byte at the offset i is i, and the side
+// number at the end.
+func newTestMapper20() *Mapper20 {
+	rom := &ROM{
+		PRG:  make([]byte, 0x2000),
+		CHR:  make([]byte, 0x2000),
+		Disk: make([][]byte, 2),
+	}
+
+	for side := range rom.Disk {
+		info := make([]byte, 56)
+		for i := range info {
+			info[i] = byte(i)
+		}
+
+		info[0], info[55] = 1, byte(side)
+		rom.Disk[side] = append(info, 2, 0) // followed by the file amount
+	}
+
+	m := NewMapper20(rom)
+	m.Reset()
+
+	return m
+}
+
+// The timer counts down from the reload value, raising the IRQ when it is at
+// zero, and is either reloaded or stopped then.
+func TestMapper20_TimerIRQ(t *testing.T) {
+	tests := map[string]struct {
+		control uint8 // $4022
+		want    []int // the cycles at which the IRQ is raised
+	}{
+		"once":   {control: 0x02, want: []int{4}},
+		"repeat": {control: 0x03, want: []int{4, 8, 12}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestMapper20()
+			m.WritePRG(0x4023, 0x01)
+			m.WritePRG(0x4020, 0x03)
+			m.WritePRG(0x4021, 0x00)
+			m.WritePRG(0x4022, tt.control)
+
+			var got []int
+
+			for cycle := 1; cycle <= 12; cycle++ {
+				m.CPUTick()
+
+				if m.PendingIRQ() {
+					got = append(got, cycle)
+					testutil.Equal(t, m.ReadPRG(0x4030)&0x01, 0x01)
+					testutil.Equal(t, m.PendingIRQ(), false)
+				}
+			}
+
+			testutil.Equal(t, len(got), len(tt.want))
+
+			for i := range tt.want {
+				testutil.Equal(t, got[i], tt.want[i])
+			}
+		})
+	}
+}
+
+// The timer is stopped with the disk registers disabled.
+func TestMapper20_TimerDisabled(t *testing.T) {
+	m := newTestMapper20()
+	m.WritePRG(0x4023, 0x01)
+	m.WritePRG(0x4022, 0x03)
+	m.WritePRG(0x4023, 0x00)
+
+	for i := 0; i < 10; i++ {
+		m.CPUTick()
+	}
+
+	testutil.Equal(t, m.PendingIRQ(), false)
+}
+
+// readDiskByte runs the drive until the disk IRQ, acknowledged by reading the
+// data, and returns the byte and the cycles it took.
+func readDiskByte(t *testing.T, m *Mapper20) (data byte, cycles int) {
+	t.Helper()
+
+	for !m.PendingIRQ() {
+		if cycles++; cycles > fdsRewindCycles+fdsSideSize*fdsByteCycles {
+			t.Fatal("no disk irq")
+		}
+
+		m.CPUTick()
+	}
+
+	return m.ReadPRG(0x4031), cycles
+}
+
+// The first byte after the gap is the mark bit of the block, which does not
+// raise the IRQ, and then a byte is read every fdsByteCycles.
+func TestMapper20_ReadDisk(t *testing.T) {
+	m := newTestMapper20()
+	m.WritePRG(0x4023, 0x01)
+	m.WritePRG(0x4025, 0xC5) // the IRQ, ready, read mode, motor
+
+	data, cycles := readDiskByte(t, m)
+	testutil.Equal(t, data, 1) // the first byte of the block
+	testutil.Equal(t, cycles > fdsRewindCycles, true)
+	testutil.Equal(t, m.PendingIRQ(), false)
+
+	for i := 1; i < 55; i++ {
+		data, cycles = readDiskByte(t, m)
+		testutil.Equal(t, data, byte(i))
+		testutil.Equal(t, cycles, fdsByteCycles)
+	}
+
+	data, _ = readDiskByte(t, m)
+	testutil.Equal(t, data, 0) // the side number
+}
+
+// The transfer waits for the reset bit to be cleared, and the byte is only
+// signalled in the status without the IRQ enabled.
+func TestMapper20_TransferStatus(t *testing.T) {
+	m := newTestMapper20()
+	m.WritePRG(0x4023, 0x01)
+	m.WritePRG(0x4025, 0x47) // ready, read mode, reset, motor
+
+	for i := 0; i < fdsRewindCycles*2; i++ {
+		m.CPUTick()
+	}
+
+	testutil.Equal(t, m.ReadPRG(0x4032)&0x02, 0x02) // not scanning
+	testutil.Equal(t, m.ReadPRG(0x4030)&0x02, 0)
+
+	m.WritePRG(0x4025, 0x45)
+
+	for i := 0; i < fdsRewindCycles+fdsByteCycles*2; i++ {
+		m.CPUTick()
+	}
+
+	testutil.Equal(t, m.PendingIRQ(), false)
+	testutil.Equal(t, m.ReadPRG(0x4032)&0x02, 0) // scanning
+	testutil.Equal(t, m.ReadPRG(0x4030)&0x02, 0) // still in the gap
+}
+
+// The disk is out for a while when the side is switched, and switching again
+// meanwhile selects the side after the next one.
+func TestMapper20_SwitchSide(t *testing.T) {
+	m := newTestMapper20()
+	testutil.Equal(t, m.Sides(), 2)
+	testutil.Equal(t, m.Side(), 0)
+
+	testutil.Equal(t, m.SwitchSide(), 1)
+	testutil.Equal(t, m.Side(), -1)
+	testutil.Equal(t, m.ReadPRG(0x4032)&0x05, 0x05) // no disk, write-protected
+
+	for i := 0; i < fdsInsertCycles-1; i++ {
+		m.CPUTick()
+	}
+
+	testutil.Equal(t, m.Side(), -1)
+	m.CPUTick()
+	testutil.Equal(t, m.Side(), 1)
+	testutil.Equal(t, m.ReadPRG(0x4032)&0x05, 0)
+
+	testutil.Equal(t, m.SwitchSide(), 0)
+	testutil.Equal(t, m.SwitchSide(), 1)
+
+	for i := 0; i < fdsInsertCycles; i++ {
+		m.CPUTick()
+	}
+
+	testutil.Equal(t, m.Side(), 1)
+}
+
+// The inserted side is read from the start.
+func TestMapper20_ReadOtherSide(t *testing.T) {
+	m := newTestMapper20()
+	m.SwitchSide()
+
+	for i := 0; i < fdsInsertCycles; i++ {
+		m.CPUTick()
+	}
+
+	m.WritePRG(0x4023, 0x01)
+	m.WritePRG(0x4025, 0xC5)
+
+	var data byte
+	for i := 0; i < 56; i++ {
+		data, _ = readDiskByte(t, m)
+	}
+
+	testutil.Equal(t, data, 1) // the side number at the end of the block
+}
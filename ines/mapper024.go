@@ -0,0 +1,317 @@
+package ines
+
+import (
+	"errors"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+// Mapper24 implements the Konami VRC6 mapper, VRC6a (mapper 24) and VRC6b
+// (mapper 26), which only differ in the address lines of the registers. Along
+// with the banking, it has the CPU cycle IRQ counter and the expansion audio of
+// two pulse channels and a sawtooth. Only the 1KB CHR banking is supported, the
+// other modes are not used by the games.
+// https://www.nesdev.org/wiki/VRC6
+type Mapper24 struct {
+	rom         *ROM
+	sram        []byte // of the size in the header
+	swapped     bool   // VRC6b has the A0 and A1 lines swapped
+	prgBank16   uint8
+	prgBank8    uint8
+	chrBank     [8]uint8
+	control     uint8 // $B003: the PRG-RAM enable and the mirroring
+	irqLatch    uint8
+	irqCounter  uint8
+	irqPrescale int16
+	irqEnable   bool
+	irqAckReset bool // the enable after the acknowledge
+	irqCycles   bool // the cycle mode instead of the scanline one
+	irqPending  bool
+	audioHalt   bool
+	audioShift  uint8 // $9003: the periods are divided by 16 or 256
+	pulse1      vrc6Pulse
+	pulse2      vrc6Pulse
+	saw         vrc6Saw
+}
+
+func NewMapper24(rom *ROM) *Mapper24 {
+	return &Mapper24{
+		rom:  rom,
+		sram: newPRGRAM(rom),
+	}
+}
+
+func NewMapper26(rom *ROM) *Mapper24 {
+	return &Mapper24{
+		rom:     rom,
+		sram:    newPRGRAM(rom),
+		swapped: true,
+	}
+}
+
+func (m *Mapper24) ROM() *ROM {
+	return m.rom
+}
+
+func (m *Mapper24) Reset() {
+	m.prgBank16 = 0
+	m.prgBank8 = 0
+	m.chrBank = [8]uint8{}
+	m.control = 0
+	m.irqLatch = 0
+	m.irqCounter = 0
+	m.irqPrescale = 341
+	m.irqEnable = false
+	m.irqAckReset = false
+	m.irqCycles = false
+	m.irqPending = false
+	m.audioHalt = false
+	m.audioShift = 0
+	m.pulse1 = vrc6Pulse{step: 15}
+	m.pulse2 = vrc6Pulse{step: 15}
+	m.saw = vrc6Saw{}
+}
+
+func (m *Mapper24) writeRegister(addr uint16, data byte) {
+	if m.swapped {
+		addr = addr&^0x03 | addr&0x01<<1 | addr&0x02>>1
+	}
+
+	reg := addr & 0x03
+
+	switch addr & 0xF000 {
+	case 0x8000:
+		m.prgBank16 = data & 0x0F
+	case 0x9000:
+		if reg == 3 {
+			m.audioHalt = data&0x01 != 0
+
+			switch {
+			case data&0x04 != 0:
+				m.audioShift = 8
+			case data&0x02 != 0:
+				m.audioShift = 4
+			default:
+				m.audioShift = 0
+			}
+		} else {
+			m.pulse1.write(reg, data)
+		}
+	case 0xA000:
+		m.pulse2.write(reg, data)
+	case 0xB000:
+		if reg == 3 {
+			m.control = data
+		} else {
+			m.saw.write(reg, data)
+		}
+	case 0xC000:
+		m.prgBank8 = data & 0x1F
+	case 0xD000:
+		m.chrBank[reg] = data
+	case 0xE000:
+		m.chrBank[4+reg] = data
+	case 0xF000:
+		m.writeIRQ(reg, data)
+	}
+}
+
+func (m *Mapper24) writeIRQ(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		m.irqLatch = data
+	case 1:
+		m.irqAckReset = data&0x01 != 0
+		m.irqEnable = data&0x02 != 0
+		m.irqCycles = data&0x04 != 0
+		m.irqPending = false
+
+		if m.irqEnable {
+			m.irqCounter = m.irqLatch
+			m.irqPrescale = 341
+		}
+	case 2:
+		m.irqPending = false
+		m.irqEnable = m.irqAckReset
+	default:
+		warnf("mapper24: invalid irq register write at %04X: %02X", 0xF000+reg, data)
+	}
+}
+
+func (m *Mapper24) clockIRQ() {
+	if m.irqCounter == 0xFF {
+		m.irqCounter = m.irqLatch
+		m.irqPending = true
+	} else {
+		m.irqCounter++
+	}
+}
+
+// CPUTick clocks the IRQ counter, every cycle or, in the scanline mode, every
+// 113.67 cycles, and the audio channels.
+func (m *Mapper24) CPUTick() {
+	if m.irqEnable {
+		if m.irqCycles {
+			m.clockIRQ()
+		} else if m.irqPrescale -= 3; m.irqPrescale <= 0 {
+			m.irqPrescale += 341
+			m.clockIRQ()
+		}
+	}
+
+	if !m.audioHalt {
+		m.pulse1.tick(m.audioShift)
+		m.pulse2.tick(m.audioShift)
+		m.saw.tick(m.audioShift)
+	}
+}
+
+// AudioOutput mixes the channels, which are added together on the cartridge.
+func (m *Mapper24) AudioOutput() float32 {
+	return vrc6Level * float32(m.pulse1.output()+m.pulse2.output()+m.saw.output())
+}
+
+func (m *Mapper24) ScanlineTick() {}
+
+// PendingIRQ keeps the IRQ line asserted until it is acknowledged.
+func (m *Mapper24) PendingIRQ() bool {
+	return m.irqPending
+}
+
+func (m *Mapper24) MirrorMode() MirrorMode {
+	switch m.control >> 2 & 0x03 {
+	case 0:
+		return MirrorVertical
+	case 1:
+		return MirrorHorizontal
+	case 2:
+		return MirrorSingle0
+	default:
+		return MirrorSingle1
+	}
+}
+
+func (m *Mapper24) Banks() string {
+	// The last 8KB of PRG is fixed at $E000.
+	return formatBanks("PRG", 16, m.prgBank16) + "  " + formatBanks("PRG", 8, m.prgBank8) + "  " + formatBanks("CHR", 1, m.chrBank[:]...)
+}
+
+// SaveRAM returns the PRG-RAM, for the games with the battery.
+func (m *Mapper24) SaveRAM() []byte {
+	return m.sram
+}
+
+func (m *Mapper24) ReadPRG(addr uint16) byte {
+	switch {
+	case addr >= 0x6000 && addr <= 0x7FFF:
+		if m.control&0x80 == 0 {
+			return 0 // open bus
+		}
+
+		return readPRGRAM(m.sram, addr)
+	case addr >= 0x8000 && addr <= 0xBFFF:
+		bank := int(m.prgBank16) % (len(m.rom.PRG) / 0x4000)
+		return m.rom.PRG[bank*0x4000+int(addr-0x8000)]
+	case addr >= 0xC000 && addr <= 0xDFFF:
+		bank := int(m.prgBank8) % (len(m.rom.PRG) / 0x2000)
+		return m.rom.PRG[bank*0x2000+int(addr-0xC000)]
+	case addr >= 0xE000:
+		return m.rom.PRG[len(m.rom.PRG)-0x2000+int(addr-0xE000)]
+	default:
+		warnf("mapper24: unhandled prg read at %04X", addr)
+		return 0
+	}
+}
+
+func (m *Mapper24) WritePRG(addr uint16, data byte) {
+	switch {
+	case addr >= 0x6000 && addr <= 0x7FFF:
+		if m.control&0x80 != 0 {
+			writePRGRAM(m.sram, addr, data)
+		}
+	case addr >= 0x8000:
+		m.writeRegister(addr, data)
+	default:
+		warnf("mapper24: unhandled prg write at %04X", addr)
+	}
+}
+
+func (m *Mapper24) chrOffset(addr uint16) int {
+	bank := int(m.chrBank[addr/0x0400]) % (len(m.rom.CHR) / 0x0400)
+	return bank*0x0400 + int(addr%0x0400)
+}
+
+func (m *Mapper24) ReadCHR(addr uint16) byte {
+	if addr > 0x1FFF {
+		warnf("mapper24: invalid chr read at %04X", addr)
+		return 0
+	}
+
+	return m.rom.CHR[m.chrOffset(addr)]
+}
+
+func (m *Mapper24) WriteCHR(addr uint16, data byte) {
+	if !m.rom.chrRAM {
+		warnf("mapper24: write to read-only chr at %04X", addr)
+		return
+	}
+
+	if addr > 0x1FFF {
+		warnf("mapper24: unhandled chr write at %04X", addr)
+		return
+	}
+
+	m.rom.CHR[m.chrOffset(addr)] = data
+}
+
+func (m *Mapper24) SaveState(w *binario.Writer) error {
+	return errors.Join(
+		m.rom.SaveState(w),
+		w.WriteVarBytes(m.sram),
+		w.WriteUint8(m.prgBank16),
+		w.WriteUint8(m.prgBank8),
+		w.WriteVarBytes(m.chrBank[:]),
+		w.WriteUint8(m.control),
+		w.WriteUint8(m.irqLatch),
+		w.WriteUint8(m.irqCounter),
+		w.WriteUint16(uint16(m.irqPrescale)),
+		w.WriteBool(m.irqEnable),
+		w.WriteBool(m.irqAckReset),
+		w.WriteBool(m.irqCycles),
+		w.WriteBool(m.irqPending),
+		w.WriteBool(m.audioHalt),
+		w.WriteUint8(m.audioShift),
+		m.pulse1.saveState(w),
+		m.pulse2.saveState(w),
+		m.saw.saveState(w),
+	)
+}
+
+func (m *Mapper24) LoadState(r *binario.Reader) error {
+	var prescale uint16
+
+	err := errors.Join(
+		m.rom.LoadState(r),
+		r.ReadVarBytesTo(m.sram),
+		r.ReadUint8To(&m.prgBank16),
+		r.ReadUint8To(&m.prgBank8),
+		r.ReadVarBytesTo(m.chrBank[:]),
+		r.ReadUint8To(&m.control),
+		r.ReadUint8To(&m.irqLatch),
+		r.ReadUint8To(&m.irqCounter),
+		r.ReadUint16To(&prescale),
+		r.ReadBoolTo(&m.irqEnable),
+		r.ReadBoolTo(&m.irqAckReset),
+		r.ReadBoolTo(&m.irqCycles),
+		r.ReadBoolTo(&m.irqPending),
+		r.ReadBoolTo(&m.audioHalt),
+		r.ReadUint8To(&m.audioShift),
+		m.pulse1.loadState(r),
+		m.pulse2.loadState(r),
+		m.saw.loadState(r),
+	)
+
+	m.irqPrescale = int16(prescale)
+
+	return err
+}
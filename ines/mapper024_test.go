@@ -0,0 +1,227 @@
+package ines
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newTestVRC6 creates VRC6a (mapper 24) or VRC6b (mapper 26) with 128KB of PRG
+// and 128KB of CHR.
+func newTestVRC6(mapperID int) *Mapper24 {
+	rom := newBankedROM(0x20000, 0x20000)
+
+	m := NewMapper24(rom)
+	if mapperID == 26 {
+		m = NewMapper26(rom)
+	}
+
+	m.Reset()
+
+	return m
+}
+
+// VRC6b has the A0 and A1 lines swapped, so $x001 and $x002 are the other way
+// around.
+func TestMapper24_AddressLines(t *testing.T) {
+	tests := map[string]struct {
+		mapperID int
+		want     [4]byte // the CHR banks by $D000-$D003
+	}{
+		"vrc6a": {mapperID: 24, want: [4]byte{10, 11, 12, 13}},
+		"vrc6b": {mapperID: 26, want: [4]byte{10, 12, 11, 13}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestVRC6(tt.mapperID)
+
+			for reg := uint16(0); reg < 4; reg++ {
+				m.WritePRG(0xD000+reg, byte(10+reg))
+			}
+
+			for i, want := range tt.want {
+				testutil.Equal(t, m.ReadCHR(uint16(i)*0x0400), want)
+			}
+		})
+	}
+}
+
+func TestMapper24_PRGBanks(t *testing.T) {
+	m := newTestVRC6(24)
+	m.WritePRG(0x8000, 0x03) // 16KB
+	m.WritePRG(0xC000, 0x05) // 8KB
+
+	testutil.Equal(t, m.ReadPRG(0x8000), 6)
+	testutil.Equal(t, m.ReadPRG(0xA000), 7)
+	testutil.Equal(t, m.ReadPRG(0xC000), 5)
+	testutil.Equal(t, m.ReadPRG(0xE000), 15)
+}
+
+// clocksIRQ returns the number of the CPU cycles between the clocks of the
+// counter, which is counted up from $FE with the latch of $FE.
+func clocksIRQ(m *Mapper24, n int) []int {
+	var cycles []int
+
+	for count, last := 0, m.irqCounter; len(cycles) < n; {
+		m.CPUTick()
+		count++
+
+		if m.irqCounter != last {
+			cycles = append(cycles, count)
+			count, last = 0, m.irqCounter
+		}
+	}
+
+	return cycles
+}
+
+// In the scanline mode, the counter is clocked every 113.67 cycles on average,
+// by the prescaler counting down from 341 by 3.
+func TestMapper24_IRQScanline(t *testing.T) {
+	m := newTestVRC6(24)
+	m.WritePRG(0xF000, 0xFD)
+	m.WritePRG(0xF001, 0x02) // enabled, the scanline mode
+
+	cycles := clocksIRQ(m, 3)
+	testutil.Equal(t, cycles[0], 114)
+	testutil.Equal(t, cycles[1], 114)
+	testutil.Equal(t, cycles[2], 113)
+
+	// Reloaded from the latch on the overflow.
+	testutil.Equal(t, m.irqCounter, 0xFD)
+	testutil.Equal(t, m.PendingIRQ(), true)
+}
+
+func TestMapper24_IRQCycles(t *testing.T) {
+	m := newTestVRC6(24)
+	m.WritePRG(0xF000, 0xFE)
+	m.WritePRG(0xF001, 0x07) // enabled, the cycle mode, enabled after acknowledge
+
+	m.CPUTick()
+	testutil.Equal(t, m.PendingIRQ(), false)
+
+	m.CPUTick()
+	testutil.Equal(t, m.PendingIRQ(), true)
+	testutil.Equal(t, m.irqCounter, 0xFE)
+
+	// The acknowledge keeps the counter enabled with bit 0 set in $F001.
+	m.WritePRG(0xF002, 0)
+	testutil.Equal(t, m.PendingIRQ(), false)
+	testutil.Equal(t, m.irqEnable, true)
+
+	m.WritePRG(0xF001, 0x06)
+	m.WritePRG(0xF002, 0)
+	testutil.Equal(t, m.irqEnable, false)
+
+	m.CPUTick()
+	testutil.Equal(t, m.irqCounter, 0xFE)
+}
+
+// The pulse is high for duty+1 of the 16 steps, or always in the digitized
+// mode, and the period is shifted by the frequency control of $9003.
+func TestVRC6Pulse(t *testing.T) {
+	tests := map[string]struct {
+		control uint8 // $9000
+		high    int   // the steps at the volume out of 16
+	}{
+		"duty 0":    {control: 0x0A, high: 1},
+		"duty 3":    {control: 0x3A, high: 4},
+		"duty 7":    {control: 0x7A, high: 8},
+		"digitized": {control: 0xBA, high: 16},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestVRC6(24)
+			m.WritePRG(0x9000, tt.control)
+			m.WritePRG(0x9001, 0x00)
+			m.WritePRG(0x9002, 0x80) // enabled, the period of 0
+
+			high := 0
+
+			for i := 0; i < 16; i++ {
+				m.CPUTick()
+
+				switch m.pulse1.output() {
+				case 0x0A:
+					high++
+				case 0:
+				default:
+					t.Fatalf("unexpected output: %d", m.pulse1.output())
+				}
+			}
+
+			testutil.Equal(t, high, tt.high)
+		})
+	}
+}
+
+func TestVRC6Pulse_Period(t *testing.T) {
+	tests := map[string]struct {
+		shift uint8 // $9003
+		ticks int   // between the steps
+	}{
+		"full":        {shift: 0x00, ticks: 0x101},
+		"by 16":       {shift: 0x02, ticks: 0x11},
+		"by 256":      {shift: 0x04, ticks: 0x02},
+		"256 over 16": {shift: 0x06, ticks: 0x02},
+		"halted":      {shift: 0x01, ticks: 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestVRC6(24)
+			m.WritePRG(0x9003, tt.shift)
+			m.WritePRG(0xA001, 0x00)
+			m.WritePRG(0xA002, 0x81) // enabled, the period of $100
+
+			m.CPUTick() // the first step, as the timer starts at 0
+			step := m.pulse2.step
+
+			for i := 0; i < tt.ticks; i++ {
+				m.CPUTick()
+			}
+
+			if tt.ticks == 0 {
+				testutil.Equal(t, m.pulse2.step, uint8(15))
+				return
+			}
+
+			testutil.Equal(t, m.pulse2.step, step-1)
+		})
+	}
+}
+
+// The rate is added to the accumulator on every other of the 14 steps, and the
+// output is its top 5 bits.
+func TestVRC6Saw(t *testing.T) {
+	m := newTestVRC6(24)
+	m.WritePRG(0xB000, 40)
+	m.WritePRG(0xB001, 0x00)
+	m.WritePRG(0xB002, 0x80)
+
+	want := []uint8{0, 5, 5, 10, 10, 15, 15, 20, 20, 25, 25, 30, 30, 0, 0, 5}
+
+	for i, w := range want {
+		m.CPUTick()
+
+		if got := m.saw.output(); got != w {
+			t.Fatalf("step %d: got %d, want %d", i, got, w)
+		}
+	}
+
+	// Disabling the channel resets the accumulator.
+	m.WritePRG(0xB002, 0x00)
+	testutil.Equal(t, m.saw.output(), 0)
+}
+
+func TestMapper24_AudioOutput(t *testing.T) {
+	m := newTestVRC6(24)
+	m.WritePRG(0x9000, 0x85) // digitized, the volume of 5
+	m.WritePRG(0x9002, 0x80)
+	m.WritePRG(0xA000, 0x83)
+	m.WritePRG(0xA002, 0x80)
+
+	testutil.Equal(t, m.AudioOutput(), vrc6Level*float32(8))
+}
@@ -0,0 +1,368 @@
+package ines
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+const (
+	flashSectorSize = 0x1000
+	flashVendorSST  = 0xBF
+)
+
+const (
+	flashIdle         = iota
+	flashUnlock1      // $AA written to $5555
+	flashUnlock2      // $55 written to $2AAA
+	flashProgram      // the next write programs the byte
+	flashErase        // the erase command, waiting for the second unlock
+	flashEraseUnlock1 // $AA written to $5555 after the erase command
+	flashEraseUnlock2 // $55 written to $2AAA after the erase command
+)
+
+// Mapper30 implements UNROM 512, the board of the homebrew games: the 16KB PRG
+// bank at $8000 with the last bank fixed at $C000, four 8KB banks of CHR-RAM,
+// and the one-screen mirroring switched by the same register. The boards with
+// the battery flag have the flash memory instead of PRG-ROM, which the games
+// rewrite themselves to keep the saves, through the commands of SST39SF040.
+// https://www.nesdev.org/wiki/UNROM_512
+type Mapper30 struct {
+	rom        *ROM
+	flash      []byte // the contents of PRG, rewritten by the flashable boards
+	flashable  bool
+	prgBank    uint8
+	chrBank    uint8
+	screen     uint8 // the one-screen mirroring page
+	flashState uint8
+	flashID    bool // the software ID mode, reading the chip ID instead of data
+}
+
+func NewMapper30(rom *ROM) *Mapper30 {
+	// The iNES 1.0 header has no size of CHR-RAM, which is 32KB on the board.
+	if rom.chrRAM && !rom.NES2 && len(rom.CHR) < 0x8000 {
+		rom.CHR = make([]byte, 0x8000)
+	}
+
+	m := &Mapper30{
+		rom:       rom,
+		flash:     rom.PRG,
+		flashable: rom.Battery,
+	}
+
+	if m.flashable {
+		// The flash is written on the copy, so that the state only needs the
+		// sectors that differ from the original ROM.
+		m.flash = append([]byte(nil), rom.PRG...)
+	}
+
+	return m
+}
+
+func (m *Mapper30) ROM() *ROM {
+	return m.rom
+}
+
+// Reset does not touch the flash, which keeps its contents without power.
+func (m *Mapper30) Reset() {
+	m.prgBank = 0
+	m.chrBank = 0
+	m.screen = 0
+	m.flashState = flashIdle
+	m.flashID = false
+}
+
+func (m *Mapper30) ScanlineTick() {}
+
+func (m *Mapper30) PendingIRQ() bool {
+	return false
+}
+
+// MirrorMode is set by the header, where the four-screen flag with horizontal
+// mirroring selects the one-screen mirroring controlled by the mapper. The
+// four-screen variant of the board is not supported and uses the vertical one.
+func (m *Mapper30) MirrorMode() MirrorMode {
+	if m.rom.FourScreen && m.rom.MirrorMode == MirrorHorizontal {
+		return MirrorSingle0 + m.screen
+	}
+
+	return m.rom.MirrorMode
+}
+
+func (m *Mapper30) Banks() string {
+	return formatBanks("PRG", 16, m.prgBank) + "  " + formatBanks("CHR", 8, m.chrBank)
+}
+
+var errFlashMismatch = errors.New("the flash save is of another rom")
+
+// SaveRAM returns the save file of the flashable boards. The games keep their
+// saves in the sectors of PRG they choose themselves, so the file has the CRC32
+// of the ROM and the sectors that differ from it, rather than the whole chip,
+// most of which is the game itself.
+func (m *Mapper30) SaveRAM() []byte {
+	var buf bytes.Buffer
+
+	// Writing to the buffer does not fail.
+	w := binario.NewWriter(&buf, binary.LittleEndian)
+	_ = w.WriteUint32(m.rom.CRC32)
+	_ = m.saveFlash(w)
+
+	return buf.Bytes()
+}
+
+// LoadRAM restores the sectors of the save file, which must be of the same ROM.
+// The file of the whole flash, as it was saved before, is copied as is.
+func (m *Mapper30) LoadRAM(data []byte) error {
+	if len(data) == len(m.flash) {
+		copy(m.flash, data)
+		return nil
+	}
+
+	r := binario.NewReader(bytes.NewReader(data), binary.LittleEndian)
+
+	crc, err := r.ReadUint32()
+	if err != nil {
+		return err
+	}
+
+	if crc != m.rom.CRC32 {
+		return errFlashMismatch
+	}
+
+	return m.loadFlash(r)
+}
+
+// flashOffset returns the offset in PRG of the address in the bank at $8000.
+func (m *Mapper30) flashOffset(addr uint16) int {
+	bank := int(m.prgBank) % m.rom.PRGBanks
+	return bank*0x4000 + int(addr-0x8000)
+}
+
+func (m *Mapper30) ReadPRG(addr uint16) byte {
+	switch {
+	case addr >= 0x8000 && addr <= 0xBFFF:
+		if m.flashID {
+			return m.chipID(addr)
+		}
+
+		return m.flash[m.flashOffset(addr)]
+	case addr >= 0xC000:
+		return m.flash[len(m.flash)-0x4000+int(addr-0xC000)]
+	default:
+		warnf("mapper30: unhandled prg read at %04X", addr)
+		return 0
+	}
+}
+
+// chipID returns the vendor and the device ID read in the software ID mode,
+// the device being the chip of the size of PRG.
+func (m *Mapper30) chipID(addr uint16) byte {
+	if addr&0x01 == 0 {
+		return flashVendorSST
+	}
+
+	switch len(m.flash) {
+	case 0x20000:
+		return 0xB5 // SST39SF010
+	case 0x40000:
+		return 0xB6 // SST39SF020
+	default:
+		return 0xB7 // SST39SF040
+	}
+}
+
+func (m *Mapper30) WritePRG(addr uint16, data byte) {
+	switch {
+	case addr >= 0x8000 && addr <= 0xBFFF && m.flashable:
+		m.writeFlash(m.flashOffset(addr), data)
+	case addr >= 0x8000:
+		m.prgBank = data & 0x1F
+		m.chrBank = data >> 5 & 0x03
+		m.screen = data >> 7
+	default:
+		warnf("mapper30: unhandled prg write at %04X", addr)
+	}
+}
+
+// writeFlash runs the command sequence of the flash. The commands are unlocked
+// by writing $AA to $5555 and $55 to $2AAA of the chip. The byte program can
+// only clear the bits, and the sector erase sets the whole 4KB sector to $FF.
+// Any unexpected write aborts the sequence.
+func (m *Mapper30) writeFlash(offset int, data byte) {
+	cmdAddr := offset & 0x7FFF
+
+	if m.flashState == flashProgram {
+		m.flash[offset] &= data
+		m.flashState = flashIdle
+
+		return
+	}
+
+	if data == 0xF0 {
+		m.flashState = flashIdle
+		m.flashID = false
+
+		return
+	}
+
+	switch m.flashState {
+	case flashIdle, flashErase:
+		if cmdAddr == 0x5555 && data == 0xAA {
+			m.flashState++
+			return
+		}
+	case flashUnlock1, flashEraseUnlock1:
+		if cmdAddr == 0x2AAA && data == 0x55 {
+			m.flashState++
+			return
+		}
+	case flashUnlock2:
+		if cmdAddr == 0x5555 {
+			switch data {
+			case 0xA0:
+				m.flashState = flashProgram
+				return
+			case 0x80:
+				m.flashState = flashErase
+				return
+			case 0x90:
+				m.flashID = true
+			}
+		}
+	case flashEraseUnlock2:
+		switch {
+		case data == 0x30:
+			sector := offset &^ (flashSectorSize - 1)
+			eraseFlash(m.flash[sector : sector+flashSectorSize])
+		case data == 0x10 && cmdAddr == 0x5555:
+			eraseFlash(m.flash)
+		}
+	}
+
+	m.flashState = flashIdle
+}
+
+func eraseFlash(data []byte) {
+	for i := range data {
+		data[i] = 0xFF
+	}
+}
+
+func (m *Mapper30) chrOffset(addr uint16) int {
+	bank := int(m.chrBank) % (len(m.rom.CHR) / 0x2000)
+	return bank*0x2000 + int(addr)
+}
+
+func (m *Mapper30) ReadCHR(addr uint16) byte {
+	if addr > 0x1FFF {
+		warnf("mapper30: invalid chr read at %04X", addr)
+		return 0
+	}
+
+	return m.rom.CHR[m.chrOffset(addr)]
+}
+
+func (m *Mapper30) WriteCHR(addr uint16, data byte) {
+	if !m.rom.chrRAM {
+		warnf("mapper30: write to read-only chr at %04X", addr)
+		return
+	}
+
+	if addr > 0x1FFF {
+		warnf("mapper30: unhandled chr write at %04X", addr)
+		return
+	}
+
+	m.rom.CHR[m.chrOffset(addr)] = data
+}
+
+// saveFlash writes the sectors of the flash that differ from the ROM, rather
+// than the whole chip, which is mostly the same, as the state is saved often.
+func (m *Mapper30) saveFlash(w *binario.Writer) error {
+	var sectors []int
+
+	for i := 0; i < len(m.flash); i += flashSectorSize {
+		if !bytes.Equal(m.flash[i:i+flashSectorSize], m.rom.PRG[i:i+flashSectorSize]) {
+			sectors = append(sectors, i)
+		}
+	}
+
+	if err := w.WriteVarUint(uint64(len(sectors))); err != nil {
+		return err
+	}
+
+	for _, offset := range sectors {
+		err := errors.Join(
+			w.WriteVarUint(uint64(offset/flashSectorSize)),
+			w.WriteRawBytes(m.flash[offset:offset+flashSectorSize]),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Mapper30) loadFlash(r *binario.Reader) error {
+	count, err := r.ReadVarUint()
+	if err != nil {
+		return err
+	}
+
+	copy(m.flash, m.rom.PRG)
+
+	for i := uint64(0); i < count; i++ {
+		sector, err := r.ReadVarUint()
+		if err != nil {
+			return err
+		}
+
+		offset := int(sector) * flashSectorSize
+		if offset+flashSectorSize > len(m.flash) {
+			return ErrSavedStateMismatch
+		}
+
+		if err = r.ReadRawBytesTo(m.flash[offset : offset+flashSectorSize]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Mapper30) SaveState(w *binario.Writer) error {
+	err := errors.Join(
+		m.rom.SaveState(w),
+		w.WriteUint8(m.prgBank),
+		w.WriteUint8(m.chrBank),
+		w.WriteUint8(m.screen),
+		w.WriteUint8(m.flashState),
+		w.WriteBool(m.flashID),
+	)
+
+	if err == nil && m.flashable {
+		err = m.saveFlash(w)
+	}
+
+	return err
+}
+
+func (m *Mapper30) LoadState(r *binario.Reader) error {
+	err := errors.Join(
+		m.rom.LoadState(r),
+		r.ReadUint8To(&m.prgBank),
+		r.ReadUint8To(&m.chrBank),
+		r.ReadUint8To(&m.screen),
+		r.ReadUint8To(&m.flashState),
+		r.ReadBoolTo(&m.flashID),
+	)
+
+	if err == nil && m.flashable {
+		err = m.loadFlash(r)
+	}
+
+	return err
+}
@@ -0,0 +1,132 @@
+package ines
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newTestMapper30 creates the flashable board with 512KB of PRG, every byte of
+// which is $0F.
+func newTestMapper30() *Mapper30 {
+	rom := &ROM{
+		PRG:      bytes.Repeat([]byte{0x0F}, 0x80000),
+		PRGBanks: 32,
+		CHR:      make([]byte, 0x8000),
+		chrRAM:   true,
+		Battery:  true,
+		CRC32:    0x12345678,
+	}
+
+	m := NewMapper30(rom)
+	m.Reset()
+
+	return m
+}
+
+// flashWrite writes the byte at the address of the flash chip, switching the
+// bank to the one with the address at $8000.
+func flashWrite(m *Mapper30, offset int, data byte) {
+	m.WritePRG(0xC000, byte(offset/0x4000))
+	m.WritePRG(0x8000+uint16(offset%0x4000), data)
+}
+
+// flashCommand sends the command after the unlock sequence.
+func flashCommand(m *Mapper30, cmd byte) {
+	flashWrite(m, 0x5555, 0xAA)
+	flashWrite(m, 0x2AAA, 0x55)
+	flashWrite(m, 0x5555, cmd)
+}
+
+func TestMapper30_Program(t *testing.T) {
+	m := newTestMapper30()
+
+	flashCommand(m, 0xA0)
+	flashWrite(m, 0x12345, 0x3C)
+	testutil.Equal(t, m.flash[0x12345], byte(0x0C)) // only clears the bits
+
+	// Without the command, the write selects the bank.
+	flashWrite(m, 0x12346, 0x00)
+	testutil.Equal(t, m.flash[0x12346], byte(0x0F))
+	testutil.Equal(t, m.rom.PRG[0x12345], byte(0x0F)) // the ROM is kept apart
+}
+
+func TestMapper30_Erase(t *testing.T) {
+	tests := map[string]struct {
+		addr   int
+		cmd    byte
+		erased [2]int // the range set to $FF
+	}{
+		"sector":                  {addr: 0x23456, cmd: 0x30, erased: [2]int{0x23000, 0x24000}},
+		"chip":                    {addr: 0x5555, cmd: 0x10, erased: [2]int{0, 0x80000}},
+		"chip at another address": {addr: 0x1234, cmd: 0x10},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestMapper30()
+
+			flashCommand(m, 0x80)
+			flashWrite(m, 0x5555, 0xAA)
+			flashWrite(m, 0x2AAA, 0x55)
+			flashWrite(m, tt.addr, tt.cmd)
+
+			for i, b := range m.flash {
+				want := byte(0x0F)
+				if i >= tt.erased[0] && i < tt.erased[1] {
+					want = 0xFF
+				}
+
+				if b != want {
+					t.Fatalf("flash at %05X is %02X, want %02X", i, b, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMapper30_SoftwareID(t *testing.T) {
+	m := newTestMapper30()
+
+	flashCommand(m, 0x90)
+	testutil.Equal(t, m.ReadPRG(0x8000), byte(flashVendorSST))
+	testutil.Equal(t, m.ReadPRG(0x8001), byte(0xB7)) // SST39SF040
+	testutil.Equal(t, m.ReadPRG(0xC000), byte(0x0F)) // the fixed bank is read as is
+
+	flashWrite(m, 0, 0xF0) // exit
+	testutil.Equal(t, m.ReadPRG(0x8000), byte(0x0F))
+}
+
+// The save file only has the sectors changed, and is not loaded into another
+// ROM.
+func TestMapper30_SaveRAM(t *testing.T) {
+	m := newTestMapper30()
+	flashCommand(m, 0xA0)
+	flashWrite(m, 0x45678, 0x01)
+
+	data := m.SaveRAM()
+	testutil.Equal(t, len(data) < 2*flashSectorSize, true)
+
+	loaded := newTestMapper30()
+	if err := loaded.LoadRAM(data); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, bytes.Equal(loaded.flash, m.flash), true)
+
+	other := newTestMapper30()
+	other.rom.CRC32 = 0x87654321
+	testutil.Equal(t, other.LoadRAM(data), errFlashMismatch)
+
+	// The save of the whole flash, as it used to be written.
+	whole := newTestMapper30()
+	if err := whole.LoadRAM(m.flash); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, whole.flash[0x45678], byte(0x01))
+
+	// The unchanged flash is saved as nothing but the header.
+	testutil.Equal(t, len(newTestMapper30().SaveRAM()), 5)
+}
@@ -0,0 +1,211 @@
+package ines
+
+import (
+	"errors"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+// Mapper69 implements the Sunsoft FME-7 mapper. Its registers are written
+// through the command and parameter pair: eight 1KB CHR banks, the 8KB banks
+// at $6000 (either ROM or RAM), $8000, $A000 and $C000, the mirroring, and the
+// 16-bit IRQ counter decremented on every CPU cycle. The expansion audio of
+// Sunsoft 5B is not supported.
+// https://www.nesdev.org/wiki/Sunsoft_FME-7
+type Mapper69 struct {
+	rom        *ROM
+	sram       []byte // of the size in the header
+	command    uint8
+	chrBank    [8]uint8
+	prgBank    [4]uint8 // $6000, $8000, $A000, $C000
+	mirror     uint8
+	irqEnable  bool
+	irqCount   bool // the counter is decremented
+	irqCounter uint16
+	irqPending bool
+}
+
+func NewMapper69(rom *ROM) *Mapper69 {
+	return &Mapper69{
+		rom:  rom,
+		sram: newPRGRAM(rom),
+	}
+}
+
+func (m *Mapper69) ROM() *ROM {
+	return m.rom
+}
+
+func (m *Mapper69) Reset() {
+	m.command = 0
+	m.chrBank = [8]uint8{}
+	m.prgBank = [4]uint8{}
+	m.mirror = 0
+	m.irqEnable = false
+	m.irqCount = false
+	m.irqCounter = 0
+	m.irqPending = false
+}
+
+func (m *Mapper69) writeParameter(data byte) {
+	switch cmd := m.command; {
+	case cmd <= 0x07:
+		m.chrBank[cmd] = data
+	case cmd <= 0x0B:
+		m.prgBank[cmd-0x08] = data
+	case cmd == 0x0C:
+		m.mirror = data & 0x03
+	case cmd == 0x0D:
+		m.irqEnable = data&0x01 != 0
+		m.irqCount = data&0x80 != 0
+		m.irqPending = false
+	case cmd == 0x0E:
+		m.irqCounter = m.irqCounter&0xFF00 | uint16(data)
+	case cmd == 0x0F:
+		m.irqCounter = m.irqCounter&0x00FF | uint16(data)<<8
+	}
+}
+
+// CPUTick decrements the IRQ counter, the IRQ being raised when it wraps
+// around from 0 to $FFFF.
+func (m *Mapper69) CPUTick() {
+	if !m.irqCount {
+		return
+	}
+
+	if m.irqCounter--; m.irqCounter == 0xFFFF && m.irqEnable {
+		m.irqPending = true
+	}
+}
+
+func (m *Mapper69) ScanlineTick() {}
+
+// PendingIRQ keeps the IRQ line asserted until it is acknowledged.
+func (m *Mapper69) PendingIRQ() bool {
+	return m.irqPending
+}
+
+func (m *Mapper69) MirrorMode() MirrorMode {
+	switch m.mirror {
+	case 0:
+		return MirrorVertical
+	case 1:
+		return MirrorHorizontal
+	case 2:
+		return MirrorSingle0
+	default:
+		return MirrorSingle1
+	}
+}
+
+func (m *Mapper69) Banks() string {
+	return formatBanks("PRG", 8, m.prgBank[0]&0x3F, m.prgBank[1], m.prgBank[2], m.prgBank[3]) + "  " + formatBanks("CHR", 1, m.chrBank[:]...)
+}
+
+func (m *Mapper69) prgOffset(bank uint8, addr uint16) int {
+	bank8 := int(bank&0x3F) % (len(m.rom.PRG) / 0x2000)
+	return bank8*0x2000 + int(addr%0x2000)
+}
+
+// SaveRAM returns the PRG-RAM, for the games with the battery.
+func (m *Mapper69) SaveRAM() []byte {
+	return m.sram
+}
+
+func (m *Mapper69) ReadPRG(addr uint16) byte {
+	switch {
+	case addr >= 0x6000 && addr <= 0x7FFF:
+		bank := m.prgBank[0]
+
+		switch {
+		case bank&0x40 == 0:
+			return m.rom.PRG[m.prgOffset(bank, addr)]
+		case bank&0x80 == 0:
+			return 0 // open bus
+		default:
+			return readPRGRAM(m.sram, addr)
+		}
+	case addr >= 0x8000 && addr <= 0xDFFF:
+		return m.rom.PRG[m.prgOffset(m.prgBank[1+(addr-0x8000)/0x2000], addr)]
+	case addr >= 0xE000:
+		return m.rom.PRG[len(m.rom.PRG)-0x2000+int(addr-0xE000)]
+	default:
+		warnf("mapper69: unhandled prg read at %04X", addr)
+		return 0
+	}
+}
+
+func (m *Mapper69) WritePRG(addr uint16, data byte) {
+	switch {
+	case addr >= 0x6000 && addr <= 0x7FFF:
+		if m.prgBank[0]&0xC0 == 0xC0 {
+			writePRGRAM(m.sram, addr, data)
+		}
+	case addr >= 0x8000 && addr <= 0x9FFF:
+		m.command = data & 0x0F
+	case addr >= 0xA000 && addr <= 0xBFFF:
+		m.writeParameter(data)
+	case addr >= 0xC000:
+		// The audio registers of Sunsoft 5B.
+	default:
+		warnf("mapper69: unhandled prg write at %04X", addr)
+	}
+}
+
+func (m *Mapper69) chrOffset(addr uint16) int {
+	bank := int(m.chrBank[addr/0x0400]) % (len(m.rom.CHR) / 0x0400)
+	return bank*0x0400 + int(addr%0x0400)
+}
+
+func (m *Mapper69) ReadCHR(addr uint16) byte {
+	if addr > 0x1FFF {
+		warnf("mapper69: invalid chr read at %04X", addr)
+		return 0
+	}
+
+	return m.rom.CHR[m.chrOffset(addr)]
+}
+
+func (m *Mapper69) WriteCHR(addr uint16, data byte) {
+	if !m.rom.chrRAM {
+		warnf("mapper69: write to read-only chr at %04X", addr)
+		return
+	}
+
+	if addr > 0x1FFF {
+		warnf("mapper69: unhandled chr write at %04X", addr)
+		return
+	}
+
+	m.rom.CHR[m.chrOffset(addr)] = data
+}
+
+func (m *Mapper69) SaveState(w *binario.Writer) error {
+	return errors.Join(
+		m.rom.SaveState(w),
+		w.WriteVarBytes(m.sram),
+		w.WriteUint8(m.command),
+		w.WriteVarBytes(m.chrBank[:]),
+		w.WriteVarBytes(m.prgBank[:]),
+		w.WriteUint8(m.mirror),
+		w.WriteBool(m.irqEnable),
+		w.WriteBool(m.irqCount),
+		w.WriteUint16(m.irqCounter),
+		w.WriteBool(m.irqPending),
+	)
+}
+
+func (m *Mapper69) LoadState(r *binario.Reader) error {
+	return errors.Join(
+		m.rom.LoadState(r),
+		r.ReadVarBytesTo(m.sram),
+		r.ReadUint8To(&m.command),
+		r.ReadVarBytesTo(m.chrBank[:]),
+		r.ReadVarBytesTo(m.prgBank[:]),
+		r.ReadUint8To(&m.mirror),
+		r.ReadBoolTo(&m.irqEnable),
+		r.ReadBoolTo(&m.irqCount),
+		r.ReadUint16To(&m.irqCounter),
+		r.ReadBoolTo(&m.irqPending),
+	)
+}
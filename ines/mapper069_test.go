@@ -0,0 +1,145 @@
+package ines
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newTestMapper69 creates FME-7 with 256KB of PRG, 128KB of CHR and 8KB of RAM.
+func newTestMapper69() *Mapper69 {
+	m := NewMapper69(newBankedROM(0x40000, 0x20000))
+	m.sram = make([]byte, 0x2000)
+	m.Reset()
+
+	return m
+}
+
+// fme7Write writes the parameter of the command.
+func fme7Write(m *Mapper69, cmd, data byte) {
+	m.WritePRG(0x8000, cmd)
+	m.WritePRG(0xA000, data)
+}
+
+func TestMapper69_CHRBanks(t *testing.T) {
+	m := newTestMapper69()
+
+	for i := byte(0); i < 8; i++ {
+		fme7Write(m, i, 0x20+i)
+	}
+
+	for i := uint16(0); i < 8; i++ {
+		testutil.Equal(t, m.ReadCHR(i*0x0400), byte(0x20+i))
+	}
+}
+
+func TestMapper69_PRGBanks(t *testing.T) {
+	m := newTestMapper69()
+	fme7Write(m, 0x09, 0x03)
+	fme7Write(m, 0x0A, 0x04)
+	fme7Write(m, 0x0B, 0x45) // the upper bits are ignored
+
+	testutil.Equal(t, m.ReadPRG(0x8000), 3)
+	testutil.Equal(t, m.ReadPRG(0xA000), 4)
+	testutil.Equal(t, m.ReadPRG(0xC000), 5)
+	testutil.Equal(t, m.ReadPRG(0xE000), 31)
+}
+
+// The bank at $6000 is either ROM, RAM when enabled, or open bus otherwise.
+func TestMapper69_Bank6000(t *testing.T) {
+	tests := map[string]struct {
+		bank     uint8
+		writable bool
+		want     byte // read after $55 is written
+	}{
+		"rom":          {bank: 0x07, want: 7},
+		"ram disabled": {bank: 0x40, want: 0},
+		"ram enabled":  {bank: 0xC0, writable: true, want: 0x55},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestMapper69()
+			fme7Write(m, 0x08, tt.bank)
+			m.WritePRG(0x6000, 0x55)
+
+			testutil.Equal(t, m.ReadPRG(0x6000), tt.want)
+			testutil.Equal(t, m.sram[0] == 0x55, tt.writable)
+		})
+	}
+}
+
+func TestMapper69_Mirroring(t *testing.T) {
+	tests := map[uint8]MirrorMode{
+		0: MirrorVertical,
+		1: MirrorHorizontal,
+		2: MirrorSingle0,
+		3: MirrorSingle1,
+	}
+
+	for data, want := range tests {
+		m := newTestMapper69()
+		fme7Write(m, 0x0C, data)
+		testutil.Equal(t, m.MirrorMode(), want)
+	}
+}
+
+// The command is kept, so the parameter can be written again without it.
+func TestMapper69_Command(t *testing.T) {
+	m := newTestMapper69()
+	m.WritePRG(0x9FFF, 0x12) // only the low 4 bits
+	m.WritePRG(0xBFFF, 0x05)
+	m.WritePRG(0xA000, 0x06)
+
+	testutil.Equal(t, m.command, 0x02)
+	testutil.Equal(t, m.ReadCHR(0x0800), 6)
+}
+
+// The counter is decremented on every cycle, and the IRQ is raised when it
+// wraps around from 0 to $FFFF, if enabled.
+func TestMapper69_IRQ(t *testing.T) {
+	m := newTestMapper69()
+	fme7Write(m, 0x0E, 0x02)
+	fme7Write(m, 0x0F, 0x00)
+	fme7Write(m, 0x0D, 0x81) // counting, the IRQ enabled
+
+	m.CPUTick()
+	m.CPUTick()
+	testutil.Equal(t, m.irqCounter, 0)
+	testutil.Equal(t, m.PendingIRQ(), false)
+
+	m.CPUTick()
+	testutil.Equal(t, m.irqCounter, 0xFFFF)
+	testutil.Equal(t, m.PendingIRQ(), true)
+
+	// Writing the control acknowledges the IRQ.
+	fme7Write(m, 0x0D, 0x81)
+	testutil.Equal(t, m.PendingIRQ(), false)
+	m.CPUTick()
+	testutil.Equal(t, m.irqCounter, 0xFFFE)
+	testutil.Equal(t, m.PendingIRQ(), false)
+}
+
+func TestMapper69_IRQControl(t *testing.T) {
+	tests := map[string]struct {
+		control uint8
+		counter uint16 // after a tick from 0
+		pending bool
+	}{
+		"stopped":          {control: 0x00, counter: 0, pending: false},
+		"irq only":         {control: 0x01, counter: 0, pending: false},
+		"counting no irq":  {control: 0x80, counter: 0xFFFF, pending: false},
+		"counting and irq": {control: 0x81, counter: 0xFFFF, pending: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newTestMapper69()
+			fme7Write(m, 0x0D, tt.control)
+			m.CPUTick()
+
+			testutil.Equal(t, m.irqCounter, tt.counter)
+			testutil.Equal(t, m.PendingIRQ(), tt.pending)
+		})
+	}
+}
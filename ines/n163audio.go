@@ -0,0 +1,147 @@
+package ines
+
+import (
+	"errors"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+// n163Level is the output of one step of the N163 channels, the sample times
+// the volume. The channels take turns on the output, so they are averaged, and
+// a single channel at the full volume is about as loud as an APU pulse channel.
+const n163Level = 0.00125
+
+// n163Audio is the wavetable sound of Namco 163: up to 8 channels playing the
+// 4-bit samples from the 128 bytes of the internal RAM, which also holds the
+// registers of the channels at $40-$7F. One channel is updated every 15 CPU
+// cycles, so the more channels are enabled, the slower each of them plays.
+// https://www.nesdev.org/wiki/Namco_163_audio
+type n163Audio struct {
+	ram      [128]byte
+	addr     uint8 // of the data port, bit 7 is the auto-increment
+	disabled bool
+	timer    uint8
+	channel  uint8 // the channel updated next, counting down from 7
+	outputs  [8]int8
+}
+
+func (a *n163Audio) reset() {
+	a.addr = 0
+	a.disabled = false
+	a.timer = 0
+	a.channel = 7
+	a.outputs = [8]int8{}
+}
+
+func (a *n163Audio) increment() {
+	if a.addr&0x80 != 0 {
+		a.addr = 0x80 | (a.addr+1)&0x7F
+	}
+}
+
+func (a *n163Audio) read() byte {
+	data := a.ram[a.addr&0x7F]
+	a.increment()
+
+	return data
+}
+
+func (a *n163Audio) write(data byte) {
+	a.ram[a.addr&0x7F] = data
+	a.increment()
+}
+
+// channels returns the number of the enabled channels, which are the last ones,
+// set by the register of channel 7.
+func (a *n163Audio) channels() uint8 {
+	return a.ram[0x7F]>>4&0x07 + 1
+}
+
+// tick updates the next channel every 15 CPU cycles.
+func (a *n163Audio) tick() {
+	if a.disabled {
+		return
+	}
+
+	if a.timer++; a.timer < 15 {
+		return
+	}
+
+	a.timer = 0
+	a.update(a.channel)
+
+	if a.channel <= 8-a.channels() {
+		a.channel = 7
+	} else {
+		a.channel--
+	}
+}
+
+// update adds the 18-bit frequency to the 24-bit phase of the channel, wrapped
+// around by the length of the wave, and reads the sample at the phase. The
+// samples are packed two per byte, the low nibble first.
+func (a *n163Audio) update(channel uint8) {
+	reg := a.ram[0x40+channel*8:][:8]
+
+	freq := uint32(reg[0]) | uint32(reg[2])<<8 | uint32(reg[4]&0x03)<<16
+	phase := uint32(reg[1]) | uint32(reg[3])<<8 | uint32(reg[5])<<16
+	length := (256 - uint32(reg[4]&0xFC)) << 16
+
+	phase = (phase + freq) % length
+	reg[1], reg[3], reg[5] = byte(phase), byte(phase>>8), byte(phase>>16)
+
+	pos := (phase>>16 + uint32(reg[6])) & 0xFF
+	sample := a.ram[pos/2] >> (pos % 2 * 4) & 0x0F
+	a.outputs[channel] = (int8(sample) - 8) * int8(reg[7]&0x0F)
+}
+
+func (a *n163Audio) output() float32 {
+	if a.disabled {
+		return 0
+	}
+
+	count := a.channels()
+
+	var sum int
+
+	for ch := 8 - count; ch < 8; ch++ {
+		sum += int(a.outputs[ch])
+	}
+
+	return n163Level * float32(sum) / float32(count)
+}
+
+func (a *n163Audio) saveState(w *binario.Writer) error {
+	var outputs [8]byte
+	for i, v := range a.outputs {
+		outputs[i] = byte(v)
+	}
+
+	return errors.Join(
+		w.WriteVarBytes(a.ram[:]),
+		w.WriteUint8(a.addr),
+		w.WriteBool(a.disabled),
+		w.WriteUint8(a.timer),
+		w.WriteUint8(a.channel),
+		w.WriteVarBytes(outputs[:]),
+	)
+}
+
+func (a *n163Audio) loadState(r *binario.Reader) error {
+	var outputs [8]byte
+
+	err := errors.Join(
+		r.ReadVarBytesTo(a.ram[:]),
+		r.ReadUint8To(&a.addr),
+		r.ReadBoolTo(&a.disabled),
+		r.ReadUint8To(&a.timer),
+		r.ReadUint8To(&a.channel),
+		r.ReadVarBytesTo(outputs[:]),
+	)
+
+	for i, v := range outputs {
+		a.outputs[i] = int8(v)
+	}
+
+	return err
+}
@@ -0,0 +1,104 @@
+package ines
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// The data port increments the address within the 128 bytes only with bit 7
+// of the address set, for both reads and writes.
+func TestN163Audio_DataPort(t *testing.T) {
+	m := newTestMapper19()
+
+	m.WritePRG(0xF800, 0x80|0x7E)
+	m.WritePRG(0x4800, 0x11)
+	m.WritePRG(0x4800, 0x22)
+	m.WritePRG(0x4800, 0x33)
+	testutil.Equal(t, m.audio.ram[0x7E], 0x11)
+	testutil.Equal(t, m.audio.ram[0x7F], 0x22)
+	testutil.Equal(t, m.audio.ram[0x00], 0x33)
+	testutil.Equal(t, m.audio.addr, 0x81)
+
+	m.WritePRG(0xF800, 0x7F)
+	testutil.Equal(t, m.ReadPRG(0x4800), 0x22)
+	testutil.Equal(t, m.ReadPRG(0x4800), 0x22)
+
+	m.WritePRG(0xF800, 0x80|0x7F)
+	testutil.Equal(t, m.ReadPRG(0x4800), 0x22)
+	testutil.Equal(t, m.ReadPRG(0x4800), 0x33)
+}
+
+// One channel is updated every 15 cycles, from channel 7 down to the first
+// of the enabled ones.
+func TestN163Audio_Tick(t *testing.T) {
+	tests := map[string]struct {
+		channels uint8
+		want     []uint8 // the channels updated in turn
+	}{
+		"one channel":    {channels: 1, want: []uint8{7, 7, 7}},
+		"two channels":   {channels: 2, want: []uint8{7, 6, 7, 6}},
+		"eight channels": {channels: 8, want: []uint8{7, 6, 5, 4, 3, 2, 1, 0, 7}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var a n163Audio
+			a.reset()
+			a.ram[0x7F] = (tt.channels - 1) << 4
+
+			for _, want := range tt.want {
+				testutil.Equal(t, a.channel, want)
+
+				for c := 0; c < 15; c++ {
+					a.tick()
+				}
+			}
+		})
+	}
+}
+
+// The phase is advanced by the frequency and wrapped around by the length of
+// the wave, and the sample at the phase is centered and scaled by the volume.
+func TestN163Audio_Update(t *testing.T) {
+	var a n163Audio
+	a.reset()
+
+	// The wave of 4 samples: 1, 2, 3, 4, packed two per byte.
+	a.ram[0x00], a.ram[0x01] = 0x21, 0x43
+
+	reg := a.ram[0x78:]
+	reg[4] = 0xFC | 0x01 // the length of 4 samples, the frequency of $10000
+	reg[7] = 0x0F        // the volume of 15 and a single channel
+
+	want := []int8{(2 - 8) * 15, (3 - 8) * 15, (4 - 8) * 15, (1 - 8) * 15, (2 - 8) * 15}
+
+	for _, w := range want {
+		a.update(7)
+		testutil.Equal(t, a.outputs[7], w)
+	}
+
+	// The offset of the wave, in samples, from the phase of 2.
+	reg[6] = 1
+	a.update(7)
+	testutil.Equal(t, a.outputs[7], (4-8)*15)
+}
+
+// The enabled channels take turns on the output, so they are averaged.
+func TestN163Audio_Output(t *testing.T) {
+	var a n163Audio
+	a.reset()
+	a.outputs = [8]int8{100, 0, 0, 0, 0, 0, -30, 60}
+
+	a.ram[0x7F] = 0x00
+	testutil.Equal(t, a.output(), n163Level*float32(60))
+
+	a.ram[0x7F] = 0x10
+	testutil.Equal(t, a.output(), n163Level*float32(30)/2)
+
+	a.ram[0x7F] = 0x70
+	testutil.Equal(t, a.output(), n163Level*float32(130)/8)
+
+	a.disabled = true
+	testutil.Equal(t, a.output(), 0)
+}
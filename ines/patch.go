@@ -0,0 +1,271 @@
+package ines
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+)
+
+var (
+	ErrUnknownPatch     = errors.New("unknown patch format, expected IPS or BPS")
+	ErrCorruptPatch     = errors.New("corrupt patch")
+	ErrPatchROMMismatch = errors.New("the patch is for a different rom")
+)
+
+// ApplyPatch applies the IPS or BPS patch, such as a translation or a hack, to
+// the contents of the ROM file, header included, returning the patched file.
+// The original data is not changed.
+func ApplyPatch(rom, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte("PATCH")):
+		return applyIPS(rom, patch[5:])
+	case bytes.HasPrefix(patch, []byte("BPS1")):
+		return applyBPS(rom, patch)
+	default:
+		return nil, ErrUnknownPatch
+	}
+}
+
+// NewFromFileWithPatch loads the ROM with the patch applied in memory.
+func NewFromFileWithPatch(filename, patchFile string) (*ROM, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := os.ReadFile(patchFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err = ApplyPatch(data, patch); err != nil {
+		return nil, fmt.Errorf("failed to apply patch: %w", err)
+	}
+
+	return NewFromBuffer(data)
+}
+
+// applyIPS applies the records of the IPS patch, each being the 3-byte offset,
+// the 2-byte size and the data, or the run of the same byte when the size is
+// zero. The records end with "EOF", optionally followed by the size the file
+// is truncated to.
+// https://zerosoft.zophar.net/ips.php
+func applyIPS(rom, patch []byte) ([]byte, error) {
+	out := append([]byte(nil), rom...)
+
+	// grow extends the output with zeros, as the records may write past the
+	// end of the original file.
+	grow := func(size int) {
+		if size > len(out) {
+			out = append(out, make([]byte, size-len(out))...)
+		}
+	}
+
+	for {
+		if len(patch) < 3 {
+			return nil, ErrCorruptPatch
+		}
+
+		if bytes.Equal(patch[:3], []byte("EOF")) {
+			// The offset 0x454F46 is "EOF" as well, which only ends the patch
+			// when there is no record after it.
+			if len(patch) == 3 || len(patch) == 6 {
+				break
+			}
+		}
+
+		if len(patch) < 5 {
+			return nil, ErrCorruptPatch
+		}
+
+		offset := int(patch[0])<<16 | int(patch[1])<<8 | int(patch[2])
+		size := int(binary.BigEndian.Uint16(patch[3:5]))
+		patch = patch[5:]
+
+		if size == 0 { // run-length encoded
+			if len(patch) < 3 {
+				return nil, ErrCorruptPatch
+			}
+
+			size = int(binary.BigEndian.Uint16(patch[0:2]))
+			grow(offset + size)
+
+			for i := 0; i < size; i++ {
+				out[offset+i] = patch[2]
+			}
+
+			patch = patch[3:]
+
+			continue
+		}
+
+		if len(patch) < size {
+			return nil, ErrCorruptPatch
+		}
+
+		grow(offset + size)
+		copy(out[offset:], patch[:size])
+		patch = patch[size:]
+	}
+
+	if len(patch) == 6 {
+		if size := int(patch[3])<<16 | int(patch[4])<<8 | int(patch[5]); size < len(out) {
+			out = out[:size]
+		}
+	}
+
+	return out, nil
+}
+
+// applyBPS builds the patched file from the actions of the BPS patch, which
+// copy the data of the source, of the output itself, or from the patch. The
+// checksums of the source, the output and the patch are checked.
+// https://www.romhacking.net/documents/746/
+func applyBPS(rom, patch []byte) ([]byte, error) {
+	if len(patch) < 4+12 {
+		return nil, ErrCorruptPatch
+	}
+
+	footer := patch[len(patch)-12:]
+	sourceCRC := binary.LittleEndian.Uint32(footer[0:4])
+	targetCRC := binary.LittleEndian.Uint32(footer[4:8])
+	patchCRC := binary.LittleEndian.Uint32(footer[8:12])
+
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != patchCRC {
+		return nil, ErrCorruptPatch
+	}
+
+	if crc32.ChecksumIEEE(rom) != sourceCRC {
+		return nil, ErrPatchROMMismatch
+	}
+
+	r := &bpsReader{data: patch[4 : len(patch)-12]}
+
+	sourceSize := r.number()
+	targetSize := r.number()
+	metadataSize := r.number()
+	r.skip(metadataSize)
+
+	if r.err != nil || sourceSize != uint64(len(rom)) || targetSize > 1<<26 {
+		return nil, ErrCorruptPatch
+	}
+
+	out := make([]byte, 0, targetSize)
+
+	var sourcePos, targetPos int64
+
+	for r.err == nil && len(r.data) > 0 {
+		action := r.number()
+		length := int(action>>2) + 1
+
+		if uint64(len(out)+length) > targetSize {
+			return nil, ErrCorruptPatch
+		}
+
+		switch action & 0x03 {
+		case 0: // source read, at the same position as in the output
+			pos := len(out)
+			if pos+length > len(rom) {
+				return nil, ErrCorruptPatch
+			}
+
+			out = append(out, rom[pos:pos+length]...)
+		case 1: // target read, from the patch
+			out = append(out, r.bytes(length)...)
+		case 2: // source copy, from the relative position in the source
+			sourcePos += r.offset()
+			if sourcePos < 0 || sourcePos+int64(length) > int64(len(rom)) {
+				return nil, ErrCorruptPatch
+			}
+
+			out = append(out, rom[sourcePos:sourcePos+int64(length)]...)
+			sourcePos += int64(length)
+		case 3: // target copy, from the output, byte by byte as it may overlap
+			targetPos += r.offset()
+			if targetPos < 0 || targetPos >= int64(len(out)) {
+				return nil, ErrCorruptPatch
+			}
+
+			for i := 0; i < length; i++ {
+				out = append(out, out[targetPos])
+				targetPos++
+			}
+		}
+	}
+
+	if r.err != nil || uint64(len(out)) != targetSize {
+		return nil, ErrCorruptPatch
+	}
+
+	if crc32.ChecksumIEEE(out) != targetCRC {
+		return nil, ErrCorruptPatch
+	}
+
+	return out, nil
+}
+
+// bpsReader reads the variable-length numbers of the BPS patch, remembering
+// the first error, so that the actions are checked once.
+type bpsReader struct {
+	data []byte
+	err  error
+}
+
+// number reads the number of 7 bits per byte, the last byte having the top
+// bit set, with each continuation adding one to avoid the redundant forms.
+func (r *bpsReader) number() uint64 {
+	var value, shift uint64 = 0, 1
+
+	for {
+		if len(r.data) == 0 || shift > 1<<56 {
+			r.err = ErrCorruptPatch
+			return 0
+		}
+
+		b := r.data[0]
+		r.data = r.data[1:]
+		value += uint64(b&0x7F) * shift
+
+		if b&0x80 != 0 {
+			return value
+		}
+
+		shift <<= 7
+		value += shift
+	}
+}
+
+// offset reads the signed relative offset, the sign being in the lowest bit.
+func (r *bpsReader) offset() int64 {
+	n := r.number()
+
+	if n&1 != 0 {
+		return -int64(n >> 1)
+	}
+
+	return int64(n >> 1)
+}
+
+func (r *bpsReader) bytes(n int) []byte {
+	if len(r.data) < n {
+		r.err = ErrCorruptPatch
+		return nil
+	}
+
+	b := r.data[:n]
+	r.data = r.data[n:]
+
+	return b
+}
+
+func (r *bpsReader) skip(n uint64) {
+	if uint64(len(r.data)) < n {
+		r.err = ErrCorruptPatch
+		return
+	}
+
+	r.data = r.data[n:]
+}
@@ -0,0 +1,75 @@
+package ines
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+func TestApplyPatch_IPS(t *testing.T) {
+	patch := []byte("PATCH" +
+		"\x00\x00\x01\x00\x02AB" + // two bytes at 1
+		"\x00\x00\x06\x00\x00\x00\x03Z" + // three Z at 6, past the end
+		"EOF")
+
+	out, err := ApplyPatch([]byte("hello"), patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, string(out), "hABlo\x00ZZZ")
+
+	// Truncated to 4 bytes.
+	out, err = ApplyPatch([]byte("hello"), []byte("PATCHEOF\x00\x00\x04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, string(out), "hell")
+}
+
+// bpsNumber encodes the variable-length number of the BPS patch.
+func bpsNumber(n uint64) []byte {
+	var b []byte
+
+	for {
+		x := byte(n & 0x7F)
+		if n >>= 7; n == 0 {
+			return append(b, x|0x80)
+		}
+
+		b = append(b, x)
+		n--
+	}
+}
+
+func TestApplyPatch_BPS(t *testing.T) {
+	source, target := []byte("hello world"), []byte("hello there world!")
+
+	patch := []byte("BPS1")
+	patch = append(patch, bpsNumber(uint64(len(source)))...)
+	patch = append(patch, bpsNumber(uint64(len(target)))...)
+	patch = append(patch, bpsNumber(0)...)          // no metadata
+	patch = append(patch, bpsNumber((6-1)<<2|0)...) // source read "hello "
+	patch = append(patch, bpsNumber((6-1)<<2|1)...) // target read
+	patch = append(patch, "there "...)
+	patch = append(patch, bpsNumber((5-1)<<2|2)...) // source copy "world"
+	patch = append(patch, bpsNumber(6<<1)...)       // from +6
+	patch = append(patch, bpsNumber((1-1)<<2|1)...) // target read
+	patch = append(patch, '!')
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(source))
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(target))
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(patch))
+
+	out, err := ApplyPatch(source, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, string(out), string(target))
+
+	_, err = ApplyPatch([]byte("hello World"), patch)
+	testutil.Equal(t, err, ErrPatchROMMismatch)
+}
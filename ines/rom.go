@@ -7,6 +7,7 @@ import (
 	"hash/crc32"
 	"io"
 	"log"
+	"math"
 	"os"
 
 	"github.com/maxpoletaev/dendy/internal/binario"
@@ -25,25 +26,76 @@ const (
 	MirrorSingle1    MirrorMode = 3
 )
 
+// Region is the TV system the game was made for, as given in the header. Most
+// of the iNES 1.0 dumps leave it unset, which reads as NTSC.
+type Region uint8
+
+const (
+	RegionNTSC Region = iota
+	RegionPAL
+	RegionMulti // works with both
+	RegionDendy
+)
+
+var regionNames = []string{"NTSC", "PAL", "multi-region", "Dendy"}
+
+const (
+	// instROMSize is the size of the PlayChoice-10 INST-ROM, which holds the
+	// hint screens shown by the arcade cabinet next to the game.
+	instROMSize = 8192
+
+	// playChoicePROMSize is the size of the PlayChoice-10 PROM that follows the
+	// INST-ROM: 16 bytes of the data and 16 bytes of the CounterOut.
+	playChoicePROMSize = 32
+)
+
+func (r Region) String() string {
+	return regionNames[r]
+}
+
 var mapperNames = map[uint8]string{
-	0: "NROM",
-	1: "SxROM",
-	2: "UxROM",
-	3: "CNROM",
-	4: "TxROM",
-	7: "AxROM",
+	0:  "NROM",
+	1:  "SxROM",
+	2:  "UxROM",
+	3:  "CNROM",
+	4:  "TxROM",
+	5:  "ExROM",
+	7:  "AxROM",
+	19: "Namco 163",
+	20: "FDS",
+	24: "VRC6a",
+	26: "VRC6b",
+	30: "UNROM 512",
+	69: "FME-7",
 }
 
 type ROM struct {
 	MirrorMode MirrorMode
 	MapperID   uint8
+	Submapper  uint8 // NES 2.0 only
+	NES2       bool  // the header is in the NES 2.0 format
+	Region     Region
 	Battery    bool
+	Trainer    bool
+	FourScreen bool
+	PlayChoice bool // a PlayChoice-10 dump, which runs as the NES game
 	PRGBanks   int
 	CHRBanks   int
-	PRG        []byte
-	CHR        []byte
-	CRC32      uint32
-	chrRAM     bool
+	// The sizes of the RAM on the board in bytes, the NVRAM being the one
+	// backed by the battery. Only the NES 2.0 header has them, for the older
+	// dumps they are guessed.
+	PRGRAMSize   int
+	PRGNVRAMSize int
+	CHRRAMSize   int
+	CHRNVRAMSize int
+	PRG          []byte
+	CHR          []byte
+	InstROM      []byte   // PlayChoice-10 only, nil if not in the dump
+	PROM         []byte   // PlayChoice-10 only, nil if not in the dump
+	Disk         [][]byte // FDS only, the sides of the disk
+	CRC32        uint32
+	Fixed        bool // the header has been corrected from the ROM database
+	chrRAM       bool
 }
 
 func NewFromBuffer(buf []byte) (*ROM, error) {
@@ -71,6 +123,10 @@ func newROM(file io.ReadSeeker) (*ROM, error) {
 		return nil, err
 	}
 
+	if isFDSImage(header) {
+		return newFDSROM(file, header)
+	}
+
 	// Check header signature.
 	if header[0] != 'N' || header[1] != 'E' || header[2] != 'S' || header[3] != 0x1A {
 		return nil, errors.New("invalid ROM file")
@@ -78,13 +134,48 @@ func newROM(file io.ReadSeeker) (*ROM, error) {
 
 	var (
 		mapperID   = ((header[6] >> 4) & 0x0F) | (header[7] & 0xF0)
-		prgBanks   = int(header[4])
-		chrBanks   = int(header[5])
+		prgSize    = int(header[4]) * 16384
+		chrSize    = int(header[5]) * 8192
 		hasTrainer = header[6]&(1<<2) != 0
 		hasBattery = header[6]&(1<<1) != 0
 		mirrorMode = header[6] & (1 << 0)
+		fourScreen = header[6]&(1<<3) != 0
+		nes2       = header[7]&0x0C == 0x08
+		playChoice = header[7]&(1<<1) != 0
+		submapper  = uint8(0)
+		region     = Region(header[9] & 0x01)
 	)
 
+	// Without the NES 2.0 header, the RAM sizes are guessed: 8KB of PRG-RAM,
+	// battery-backed or not, and 8KB of CHR-RAM when there is no CHR-ROM.
+	prgRAMSize, prgNVRAMSize := 8192, 0
+	chrRAMSize, chrNVRAMSize := 0, 0
+
+	if hasBattery {
+		prgRAMSize, prgNVRAMSize = 0, 8192
+	}
+
+	if nes2 {
+		if plane := header[8] & 0x0F; plane != 0 {
+			return nil, fmt.Errorf("unsupported mapper: %d", int(plane)<<8|int(mapperID))
+		}
+
+		submapper = header[8] >> 4
+		region = Region(header[12] & 0x03)
+		playChoice = header[7]&0x03 == 2 // console type
+		prgSize = nes2ROMSize(header[4], header[9]&0x0F, 16384)
+		chrSize = nes2ROMSize(header[5], header[9]>>4, 8192)
+		prgRAMSize = nes2RAMSize(header[10] & 0x0F)
+		prgNVRAMSize = nes2RAMSize(header[10] >> 4)
+		chrRAMSize = nes2RAMSize(header[11] & 0x0F)
+		chrNVRAMSize = nes2RAMSize(header[11] >> 4)
+	} else if header[12] != 0 || header[13] != 0 || header[14] != 0 || header[15] != 0 {
+		// The old dumping tools wrote their names over the end of the header,
+		// such as "DiskDude!", which also breaks the upper bits of the mapper.
+		log.Printf("[WARN] ignoring the garbage at the end of the header")
+		mapperID &= 0x0F
+	}
+
 	// Skip trainer if present.
 	if hasTrainer {
 		if _, err = file.Seek(512, io.SeekCurrent); err != nil {
@@ -92,46 +183,218 @@ func newROM(file io.ReadSeeker) (*ROM, error) {
 		}
 	}
 
+	// The sizes come from the header, so they are checked against the file
+	// before anything is allocated, as a broken or crafted header may claim
+	// gigabytes.
+	remaining, err := remainingSize(file)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case prgSize == 0:
+		return nil, errors.New("invalid ROM file: no PRG ROM")
+	case prgSize > remaining:
+		return nil, fmt.Errorf("invalid ROM file: %d bytes of PRG ROM in the header, but %d in the file", prgSize, remaining)
+	case chrSize > remaining-prgSize:
+		return nil, fmt.Errorf("invalid ROM file: %d bytes of CHR ROM in the header, but %d in the file", chrSize, remaining-prgSize)
+	}
+
 	// CRC32 of CHR+PRG
 	hasher := crc32.NewIEEE()
 	romReader := io.TeeReader(file, hasher)
 
 	// Read PRG-ROM.
-	prgData := make([]uint8, prgBanks*16384)
-	if _, err = romReader.Read(prgData); err != nil {
+	prgData := make([]uint8, prgSize)
+	if _, err = io.ReadFull(romReader, prgData); err != nil {
 		return nil, fmt.Errorf("failed to read PRG ROM: %w", err)
 	}
 
 	// Read CHR-ROM.
-	chrData := make([]uint8, chrBanks*8192)
-	if _, err = romReader.Read(chrData); err != nil && err != io.EOF {
+	chrData := make([]uint8, chrSize)
+	if _, err = io.ReadFull(romReader, chrData); err != nil && err != io.EOF {
 		return nil, fmt.Errorf("failed to read chr ROM: %w", err)
 	}
 
+	// The mappers work with the 16KB banks of PRG and the 8KB banks of CHR,
+	// while the exponent form of the NES 2.0 sizes allows any size. The smaller
+	// ROMs are mirrored to fill the bank, the same as on the board, where the
+	// upper address lines are not connected.
+	prgData = mirrorToSize(prgData, 16384)
+	chrData = mirrorToSize(chrData, 8192)
+	prgSize, chrSize = len(prgData), len(chrData)
+
 	var chrRAM bool
 	if len(chrData) == 0 {
-		// No CHR-ROM, so allocate 8KB of CHR-RAM.
-		chrData = make([]uint8, 8192)
+		// No CHR-ROM, so allocate the CHR-RAM, at least the 8KB of the pattern
+		// tables, which the mappers rely on.
+		if chrRAMSize+chrNVRAMSize == 0 {
+			chrRAMSize = 8192
+		}
+
+		chrData = make([]uint8, max(8192, chrRAMSize+chrNVRAMSize))
 		chrRAM = true
 	}
 
+	// The PlayChoice-10 data follows the CHR-ROM. It is only used by the arcade
+	// cabinet and is not a part of the checksum, so that the dump is the same
+	// game as the cartridge. Some of the dumps have the flag, but not the data,
+	// which is fine as the game does not need it.
+	var instROM, prom []byte
+	if playChoice {
+		instROM = readOptional(file, instROMSize, "INST-ROM")
+		if instROM != nil {
+			prom = readOptional(file, playChoicePROMSize, "PlayChoice PROM")
+		}
+	}
+
 	log.Printf("[INFO] ROM info:")
 	log.Printf("[INFO]   > mapper ID:  %d (%s)", mapperID, mapperNames[mapperID])
-	log.Printf("[INFO]   > PRG banks:  %d (%d KB)", prgBanks, prgBanks*16)
-	log.Printf("[INFO]   > CHR banks:  %d (%d KB)", chrBanks, chrBanks*8)
+	log.Printf("[INFO]   > PRG banks:  %d (%d KB)", prgSize/16384, prgSize/1024)
+	log.Printf("[INFO]   > CHR banks:  %d (%d KB)", chrSize/8192, chrSize/1024)
+
+	if nes2 {
+		log.Printf("[INFO]   > submapper:  %d", submapper)
+		log.Printf("[INFO]   > PRG-RAM:    %d KB (%d KB battery-backed)", (prgRAMSize+prgNVRAMSize)/1024, prgNVRAMSize/1024)
+		log.Printf("[INFO]   > region:     %s", region)
+	}
+
 	log.Printf("[INFO]   > CRC32:      %08X", hasher.Sum32())
 
-	return &ROM{
-		PRG:        prgData,
-		CHR:        chrData,
-		MapperID:   mapperID,
-		Battery:    hasBattery,
-		MirrorMode: mirrorMode,
-		PRGBanks:   prgBanks,
-		CHRBanks:   chrBanks,
-		chrRAM:     chrRAM,
-		CRC32:      hasher.Sum32(),
-	}, nil
+	if playChoice {
+		log.Printf("[INFO]   > PlayChoice: INST-ROM %s, PROM %s", presence(instROM), presence(prom))
+	}
+
+	rom := &ROM{
+		PRG:          prgData,
+		CHR:          chrData,
+		MapperID:     mapperID,
+		Submapper:    submapper,
+		NES2:         nes2,
+		Region:       region,
+		Battery:      hasBattery,
+		Trainer:      hasTrainer,
+		FourScreen:   fourScreen,
+		PlayChoice:   playChoice,
+		InstROM:      instROM,
+		PROM:         prom,
+		MirrorMode:   mirrorMode,
+		PRGBanks:     prgSize / 16384,
+		CHRBanks:     chrSize / 8192,
+		PRGRAMSize:   prgRAMSize,
+		PRGNVRAMSize: prgNVRAMSize,
+		CHRRAMSize:   chrRAMSize,
+		CHRNVRAMSize: chrNVRAMSize,
+		chrRAM:       chrRAM,
+		CRC32:        hasher.Sum32(),
+	}
+
+	// The NES 2.0 headers are made for the exact board, so only the older ones
+	// are fixed.
+	if !nes2 && UseROMDB {
+		rom.applyROMDB()
+	}
+
+	return rom, nil
+}
+
+// nes2ROMSize decodes the PRG-ROM or CHR-ROM size of the NES 2.0 header, the
+// number of the units in the lower 12 bits, or the exponent and the multiplier
+// when the top nibble is all ones.
+func nes2ROMSize(lsb, msb byte, unit int) int {
+	if msb == 0x0F {
+		// Any exponent above 2^32 is more than any file could have, and would
+		// overflow, so it is left for the size check to reject.
+		if exp := lsb >> 2; exp > 32 {
+			return math.MaxInt
+		}
+
+		return (1 << (lsb >> 2)) * int(lsb&0x03*2+1)
+	}
+
+	return (int(msb)<<8 | int(lsb)) * unit
+}
+
+// nes2RAMSize decodes the RAM size of the NES 2.0 header, given as a shift
+// count of 64 bytes, zero meaning none.
+func nes2RAMSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+
+	return 64 << shift
+}
+
+// remainingSize returns the number of bytes left in the file after the current
+// position.
+func remainingSize(file io.Seeker) (int, error) {
+	pos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	end, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = file.Seek(pos, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return int(end - pos), nil
+}
+
+// mirrorToSize rounds the size of the data up to the multiple of the bank size,
+// repeating the data to fill the rest.
+func mirrorToSize(data []byte, bankSize int) []byte {
+	size := len(data)
+	if size == 0 || size%bankSize == 0 {
+		return data
+	}
+
+	out := make([]byte, (size/bankSize+1)*bankSize)
+	for i := 0; i < len(out); i += size {
+		copy(out[i:], data)
+	}
+
+	return out
+}
+
+// readOptional reads the section of the given size that the game can do
+// without. Returns nil if the file ends before the section is complete.
+func readOptional(r io.Reader, size int, name string) []byte {
+	data := make([]byte, size)
+
+	switch n, err := io.ReadFull(r, data); {
+	case err == nil:
+		return data
+	case errors.Is(err, io.EOF):
+		return nil
+	default:
+		log.Printf("[WARN] ignoring incomplete %s: %d of %d bytes: %s", name, n, size, err)
+		return nil
+	}
+}
+
+func presence(data []byte) string {
+	if data == nil {
+		return "missing"
+	}
+
+	return "present"
+}
+
+// MapperName returns the board name of the mapper, or an empty string if the
+// mapper is not supported.
+func (r *ROM) MapperName() string {
+	return mapperNames[r.MapperID]
+}
+
+// CHRRAM returns true if the cartridge has CHR-RAM instead of CHR-ROM, in which
+// case the CHR is initially empty.
+func (r *ROM) CHRRAM() bool {
+	return r.chrRAM
 }
 
 func (r *ROM) SaveState(w *binario.Writer) error {
@@ -140,7 +403,7 @@ func (r *ROM) SaveState(w *binario.Writer) error {
 	}
 
 	if r.chrRAM {
-		if err := w.WriteByteSlice(r.CHR); err != nil {
+		if err := w.WriteVarBytes(r.CHR); err != nil {
 			return err
 		}
 	}
@@ -159,7 +422,7 @@ func (r *ROM) LoadState(reader *binario.Reader) error {
 	}
 
 	if r.chrRAM {
-		if err = reader.ReadByteSliceTo(r.CHR); err != nil {
+		if err = reader.ReadVarBytesTo(r.CHR); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,301 @@
+package ines
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+func newTestDump(flags7 byte, extra int) []byte {
+	data := append(testutil.NewROMFile(0, 1, 1), make([]byte, extra)...)
+	data[7] = flags7
+
+	for i := 16; i < len(data); i++ {
+		data[i] = byte(i)
+	}
+
+	return data
+}
+
+// newBankedROM returns the ROM with the given sizes of PRG and CHR, every byte
+// of which holds the number of its bank: 8KB for PRG and 1KB for CHR.
+func newBankedROM(prgSize, chrSize int) *ROM {
+	rom := &ROM{PRG: make([]byte, prgSize), CHR: make([]byte, chrSize)}
+
+	for i := range rom.PRG {
+		rom.PRG[i] = byte(i / 0x2000)
+	}
+
+	for i := range rom.CHR {
+		rom.CHR[i] = byte(i / 0x0400)
+	}
+
+	return rom
+}
+
+// The PlayChoice-10 dump is the NES game followed by the data of the arcade
+// cabinet, which is read separately and does not change the checksum.
+func TestNewFromBuffer_PlayChoice(t *testing.T) {
+	nes, err := NewFromBuffer(newTestDump(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc10, err := NewFromBuffer(newTestDump(0x02, instROMSize+playChoicePROMSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, pc10.PlayChoice, true)
+	testutil.Equal(t, pc10.MapperID, uint8(0))
+	testutil.Equal(t, pc10.CRC32, nes.CRC32)
+	testutil.Equal(t, len(pc10.InstROM), instROMSize)
+	testutil.Equal(t, len(pc10.PROM), playChoicePROMSize)
+	testutil.Equal(t, pc10.InstROM[0], byte(0x10)) // the byte after the CHR-ROM
+
+	// The flag without the data.
+	noData, err := NewFromBuffer(newTestDump(0x02, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, noData.PlayChoice, true)
+	testutil.Equal(t, noData.InstROM == nil, true)
+	testutil.Equal(t, noData.CRC32, nes.CRC32)
+}
+
+// The NES 2.0 header has the submapper, the sizes of the RAM and the region,
+// and the ROM sizes in the exponent form.
+func TestNewFromBuffer_NES2(t *testing.T) {
+	data := make([]byte, 16+0x4000+0x600)
+	copy(data, "NES\x1a\x01")
+	data[5] = 0x21  // CHR-ROM: 2^8 * 3 = 0x300 bytes
+	data[7] = 0x08  // NES 2.0
+	data[8] = 0x30  // submapper 3
+	data[9] = 0xF0  // the exponent form of the CHR size
+	data[10] = 0x70 // 8KB of PRG-NVRAM
+	data[11] = 0x00 // no CHR-RAM
+	data[12] = 0x01 // PAL
+
+	rom, err := NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, rom.NES2, true)
+	testutil.Equal(t, rom.Submapper, uint8(3))
+	testutil.Equal(t, len(rom.PRG), 0x4000)
+	testutil.Equal(t, len(rom.CHR), 0x2000) // mirrored to the 8KB bank
+	testutil.Equal(t, bytes.Equal(rom.CHR[0x300:0x600], rom.CHR[:0x300]), true)
+	testutil.Equal(t, rom.PRGRAMSize, 0)
+	testutil.Equal(t, rom.PRGNVRAMSize, 0x2000)
+	testutil.Equal(t, rom.Region, RegionPAL)
+
+	// The mappers above 255 are not supported.
+	data[8] = 0x01
+	_, err = NewFromBuffer(data)
+	testutil.Equal(t, err != nil, true)
+}
+
+// The sizes of the header are checked against the file, before the ROM is
+// allocated.
+func TestNewFromBuffer_NES2Sizes(t *testing.T) {
+	tests := map[string]struct {
+		prg, chr, exp byte
+	}{
+		"huge exponent":        {prg: 0xFC, exp: 0x0F},
+		"overflowing exponent": {prg: 0xFF, exp: 0x0F},
+		"more than the file":   {prg: 0x02},
+		"chr exponent":         {prg: 0x01, chr: 0xA0, exp: 0xF0},
+		"no prg":               {prg: 0x00},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := make([]byte, 16+0x4000)
+			copy(data, "NES\x1a")
+			data[4], data[5] = tt.prg, tt.chr
+			data[7] = 0x08 // NES 2.0
+			data[9] = tt.exp
+
+			_, err := NewFromBuffer(data)
+			testutil.Equal(t, err != nil, true)
+		})
+	}
+}
+
+// The PRG-ROM in the exponent form smaller than the bank is mirrored to fill it.
+func TestNewFromBuffer_NES2SmallPRG(t *testing.T) {
+	data := make([]byte, 16+0x2000)
+	copy(data, "NES\x1a")
+	data[4] = 0x34 // 2^13 * 1 = 8KB
+	data[7] = 0x08 // NES 2.0
+	data[9] = 0x0F // the exponent form of the PRG size
+	data[16] = 0xEA
+
+	rom, err := NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, rom.PRGBanks, 1)
+	testutil.Equal(t, len(rom.PRG), 0x4000)
+	testutil.Equal(t, rom.PRG[0x2000], byte(0xEA))
+}
+
+// The old dumps with the garbage at the end of the header only have the lower
+// nibble of the mapper, and the RAM sizes are guessed.
+func TestNewFromBuffer_DiskDude(t *testing.T) {
+	data := newTestDump(0, 0)
+	data[6] = 0x41 // mapper 4, vertical mirroring
+	copy(data[7:], "DiskDude!")
+
+	rom, err := NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, rom.NES2, false)
+	testutil.Equal(t, rom.MapperID, uint8(4))
+	testutil.Equal(t, rom.PRGRAMSize, 0x2000)
+}
+
+// The known bad dumps are fixed from the database, unless it is disabled.
+func TestNewFromBuffer_ROMDB(t *testing.T) {
+	data := newTestDump(0, 0)
+	data[16] = 0xDB // not the same game as in the other tests
+
+	rom, err := NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddROMDB(fmt.Sprintf("%08X 4 V 8b # test", rom.CRC32)); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		romDBMu.Lock()
+		delete(loadROMDB(), rom.CRC32)
+		romDBMu.Unlock()
+	})
+
+	fixed, err := NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, fixed.Fixed, true)
+	testutil.Equal(t, fixed.MapperID, uint8(4))
+	testutil.Equal(t, fixed.MirrorMode, MirrorVertical)
+	testutil.Equal(t, fixed.Battery, true)
+	testutil.Equal(t, fixed.PRGNVRAMSize, 0x2000)
+
+	useROMDB := UseROMDB
+	UseROMDB = false
+
+	t.Cleanup(func() { UseROMDB = useROMDB })
+
+	rom, err = NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, rom.Fixed, false)
+	testutil.Equal(t, rom.MapperID, uint8(0))
+}
+
+// Only the RAM size differing from the header is a fix as well.
+func TestNewFromBuffer_ROMDBRAMSize(t *testing.T) {
+	data := newTestDump(0, 0)
+	data[16] = 0xDC
+
+	rom, err := NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddROMDB(fmt.Sprintf("%08X - - 2 # test", rom.CRC32)); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		romDBMu.Lock()
+		delete(loadROMDB(), rom.CRC32)
+		romDBMu.Unlock()
+	})
+
+	fixed, err := NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, fixed.Fixed, true)
+	testutil.Equal(t, fixed.PRGRAMSize, 0x0800)
+}
+
+func newTestDisk(sides int) []byte {
+	data := make([]byte, sides*fdsSideSize)
+	for i := 0; i < sides; i++ {
+		copy(data[i*fdsSideSize:], fdsMagic)
+	}
+
+	return data
+}
+
+// The disk images come with the fwNES header and without it, both being the
+// same disk.
+func TestNewFromBuffer_FDS(t *testing.T) {
+	raw, err := NewFromBuffer(newTestDisk(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headered, err := NewFromBuffer(append([]byte("FDS\x1a\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), newTestDisk(2)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, raw.MapperID, uint8(20))
+	testutil.Equal(t, len(raw.Disk), 2)
+	testutil.Equal(t, len(headered.Disk), 2)
+	testutil.Equal(t, headered.CRC32, raw.CRC32)
+	testutil.Equal(t, raw.CHRRAM(), true)
+
+	// No BIOS.
+	_, err = NewCartridge(raw)
+	testutil.Equal(t, err, ErrNoFDSBIOS)
+}
+
+// The PRG-RAM is of the size in the NES 2.0 header, the smaller one mirrored
+// over $6000-$7FFF, and none at all is the open bus.
+func TestNewFromBuffer_NES2PRGRAM(t *testing.T) {
+	data := make([]byte, 16+0x4000)
+	copy(data, "NES\x1a\x01")
+	data[6] = 0x10 // mapper 1
+	data[7] = 0x08 // NES 2.0
+	data[10] = 0x05
+
+	rom, err := NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, rom.PRGRAMSize, 2048)
+
+	m := NewMapper1(rom)
+	m.WritePRG(0x6001, 0x42)
+	testutil.Equal(t, len(m.SaveRAM()), 2048)
+	testutil.Equal(t, m.ReadPRG(0x6801), byte(0x42))
+
+	data[10] = 0x00
+	if rom, err = NewFromBuffer(data); err != nil {
+		t.Fatal(err)
+	}
+
+	m = NewMapper1(rom)
+	m.WritePRG(0x6001, 0x42)
+	testutil.Equal(t, m.ReadPRG(0x6001), byte(0))
+}
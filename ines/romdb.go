@@ -0,0 +1,177 @@
+package ines
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// UseROMDB enables fixing the headers of the known bad dumps from the ROM
+// database. On by default.
+var UseROMDB = true
+
+//go:embed romdb.txt
+var romDBData string
+
+// romFix is the correct header of the game. The negative values keep what the
+// header says.
+type romFix struct {
+	mapperID int
+	mirror   int // or 4 for the four-screen
+	prgRAM   int // in bytes
+	battery  bool
+}
+
+var (
+	romDB     map[uint32]romFix
+	romDBOnce sync.Once
+	romDBMu   sync.Mutex
+)
+
+func loadROMDB() map[uint32]romFix {
+	romDBOnce.Do(func() {
+		db, err := parseROMDB(romDBData)
+		if err != nil {
+			panic(fmt.Sprintf("invalid embedded rom database: %s", err))
+		}
+
+		romDB = db
+	})
+
+	return romDB
+}
+
+// AddROMDB adds the entries in the format of the embedded database, replacing
+// the ones of the same games, e.g. from the file of the user.
+func AddROMDB(data string) error {
+	entries, err := parseROMDB(data)
+	if err != nil {
+		return err
+	}
+
+	romDBMu.Lock()
+	defer romDBMu.Unlock()
+
+	db := loadROMDB()
+	for crc, fix := range entries {
+		db[crc] = fix
+	}
+
+	return nil
+}
+
+func parseROMDB(data string) (map[uint32]romFix, error) {
+	db := make(map[uint32]romFix)
+
+	for n, line := range strings.Split(data, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 fields, got %d", n+1, len(fields))
+		}
+
+		crc, err := strconv.ParseUint(fields[0], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid crc32: %s", n+1, fields[0])
+		}
+
+		fix := romFix{mapperID: -1, mirror: -1, prgRAM: -1}
+
+		if fields[1] != "-" {
+			id, err := strconv.ParseUint(fields[1], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid mapper: %s", n+1, fields[1])
+			}
+
+			fix.mapperID = int(id)
+		}
+
+		switch fields[2] {
+		case "-":
+		case "H":
+			fix.mirror = int(MirrorHorizontal)
+		case "V":
+			fix.mirror = int(MirrorVertical)
+		case "4":
+			fix.mirror = 4
+		default:
+			return nil, fmt.Errorf("line %d: invalid mirroring: %s", n+1, fields[2])
+		}
+
+		if ram := fields[3]; ram != "-" {
+			fix.battery = strings.HasSuffix(ram, "b")
+
+			kb, err := strconv.ParseUint(strings.TrimSuffix(ram, "b"), 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid prg-ram size: %s", n+1, ram)
+			}
+
+			fix.prgRAM = int(kb) * 1024
+		}
+
+		db[uint32(crc)] = fix
+	}
+
+	return db, nil
+}
+
+// applyROMDB corrects the header if the game is in the database.
+func (r *ROM) applyROMDB() {
+	romDBMu.Lock()
+	fix, ok := loadROMDB()[r.CRC32]
+	romDBMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if fix.mapperID >= 0 && uint8(fix.mapperID) != r.MapperID {
+		log.Printf("[INFO] fixing the header: mapper %d, not %d", fix.mapperID, r.MapperID)
+		r.MapperID = uint8(fix.mapperID)
+		r.Fixed = true
+	}
+
+	switch {
+	case fix.mirror == 4 && !r.FourScreen:
+		log.Printf("[INFO] fixing the header: four-screen mirroring")
+		r.FourScreen, r.Fixed = true, true
+	case fix.mirror >= 0 && fix.mirror != 4 && (r.FourScreen || MirrorMode(fix.mirror) != r.MirrorMode):
+		log.Printf("[INFO] fixing the header: %s mirroring", mirrorName(MirrorMode(fix.mirror)))
+		r.MirrorMode, r.FourScreen, r.Fixed = MirrorMode(fix.mirror), false, true
+	}
+
+	if fix.prgRAM >= 0 && fix.battery != r.Battery {
+		log.Printf("[INFO] fixing the header: battery %v", fix.battery)
+		r.Battery, r.Fixed = fix.battery, true
+	}
+
+	if fix.prgRAM >= 0 {
+		ram, nvram := fix.prgRAM, 0
+		if fix.battery {
+			ram, nvram = 0, fix.prgRAM
+		}
+
+		if ram != r.PRGRAMSize || nvram != r.PRGNVRAMSize {
+			log.Printf("[INFO] fixing the header: %d KB of PRG-RAM", fix.prgRAM/1024)
+			r.PRGRAMSize, r.PRGNVRAMSize, r.Fixed = ram, nvram, true
+		}
+	}
+}
+
+func mirrorName(m MirrorMode) string {
+	if m == MirrorVertical {
+		return "vertical"
+	}
+
+	return "horizontal"
+}
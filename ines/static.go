@@ -9,12 +9,19 @@ import (
 type MapperID uint8
 
 const (
-	MapperID0 MapperID = 0
-	MapperID1 MapperID = 1
-	MapperID2 MapperID = 2
-	MapperID3 MapperID = 3
-	MapperID4 MapperID = 4
-	MapperID7 MapperID = 7
+	MapperID0  MapperID = 0
+	MapperID1  MapperID = 1
+	MapperID2  MapperID = 2
+	MapperID3  MapperID = 3
+	MapperID4  MapperID = 4
+	MapperID5  MapperID = 5
+	MapperID7  MapperID = 7
+	MapperID19 MapperID = 19
+	MapperID20 MapperID = 20
+	MapperID24 MapperID = 24
+	MapperID26 MapperID = 26
+	MapperID30 MapperID = 30
+	MapperID69 MapperID = 69
 )
 
 // StaticCartridge is a devirtualized cartridge type that uses static dispatch to
@@ -42,8 +49,26 @@ func NewStaticCartridge(rom *ROM) (*StaticCartridge, error) {
 		c.mapper = NewMapper3(rom)
 	case MapperID4:
 		c.mapper = NewMapper4(rom)
+	case MapperID5:
+		c.mapper = NewMapper5(rom)
 	case MapperID7:
 		c.mapper = NewMapper7(rom)
+	case MapperID19:
+		c.mapper = NewMapper19(rom)
+	case MapperID20:
+		if len(rom.PRG) != fdsBIOSSize {
+			return nil, ErrNoFDSBIOS
+		}
+
+		c.mapper = NewMapper20(rom)
+	case MapperID24:
+		c.mapper = NewMapper24(rom)
+	case MapperID26:
+		c.mapper = NewMapper26(rom)
+	case MapperID30:
+		c.mapper = NewMapper30(rom)
+	case MapperID69:
+		c.mapper = NewMapper69(rom)
 	default:
 		return nil, fmt.Errorf("unsupported mapper: %d", rom.MapperID)
 	}
@@ -51,6 +76,15 @@ func NewStaticCartridge(rom *ROM) (*StaticCartridge, error) {
 	return c, nil
 }
 
+func (c *StaticCartridge) ROM() *ROM {
+	return c.mapper.ROM()
+}
+
+// Banks is not on the hot path, so it is not worth the static dispatch.
+func (c *StaticCartridge) Banks() string {
+	return c.mapper.Banks()
+}
+
 func (c *StaticCartridge) Reset() {
 	switch c.mapperID {
 	case MapperID0:
@@ -63,8 +97,20 @@ func (c *StaticCartridge) Reset() {
 		c.mapper.(*Mapper3).Reset()
 	case MapperID4:
 		c.mapper.(*Mapper4).Reset()
+	case MapperID5:
+		c.mapper.(*Mapper5).Reset()
 	case MapperID7:
 		c.mapper.(*Mapper7).Reset()
+	case MapperID19:
+		c.mapper.(*Mapper19).Reset()
+	case MapperID20:
+		c.mapper.(*Mapper20).Reset()
+	case MapperID24, MapperID26:
+		c.mapper.(*Mapper24).Reset()
+	case MapperID30:
+		c.mapper.(*Mapper30).Reset()
+	case MapperID69:
+		c.mapper.(*Mapper69).Reset()
 	default:
 		panic("unreachable")
 	}
@@ -82,8 +128,20 @@ func (c *StaticCartridge) ScanlineTick() {
 		c.mapper.(*Mapper3).ScanlineTick()
 	case MapperID4:
 		c.mapper.(*Mapper4).ScanlineTick()
+	case MapperID5:
+		c.mapper.(*Mapper5).ScanlineTick()
 	case MapperID7:
 		c.mapper.(*Mapper7).ScanlineTick()
+	case MapperID19:
+		c.mapper.(*Mapper19).ScanlineTick()
+	case MapperID20:
+		c.mapper.(*Mapper20).ScanlineTick()
+	case MapperID24, MapperID26:
+		c.mapper.(*Mapper24).ScanlineTick()
+	case MapperID30:
+		c.mapper.(*Mapper30).ScanlineTick()
+	case MapperID69:
+		c.mapper.(*Mapper69).ScanlineTick()
 	default:
 		panic("unreachable")
 	}
@@ -101,8 +159,20 @@ func (c *StaticCartridge) PendingIRQ() bool {
 		return c.mapper.(*Mapper3).PendingIRQ()
 	case MapperID4:
 		return c.mapper.(*Mapper4).PendingIRQ()
+	case MapperID5:
+		return c.mapper.(*Mapper5).PendingIRQ()
 	case MapperID7:
 		return c.mapper.(*Mapper7).PendingIRQ()
+	case MapperID19:
+		return c.mapper.(*Mapper19).PendingIRQ()
+	case MapperID20:
+		return c.mapper.(*Mapper20).PendingIRQ()
+	case MapperID24, MapperID26:
+		return c.mapper.(*Mapper24).PendingIRQ()
+	case MapperID30:
+		return c.mapper.(*Mapper30).PendingIRQ()
+	case MapperID69:
+		return c.mapper.(*Mapper69).PendingIRQ()
 	default:
 		panic("unreachable")
 	}
@@ -120,8 +190,20 @@ func (c *StaticCartridge) MirrorMode() MirrorMode {
 		return c.mapper.(*Mapper3).MirrorMode()
 	case MapperID4:
 		return c.mapper.(*Mapper4).MirrorMode()
+	case MapperID5:
+		return c.mapper.(*Mapper5).MirrorMode()
 	case MapperID7:
 		return c.mapper.(*Mapper7).MirrorMode()
+	case MapperID19:
+		return c.mapper.(*Mapper19).MirrorMode()
+	case MapperID20:
+		return c.mapper.(*Mapper20).MirrorMode()
+	case MapperID24, MapperID26:
+		return c.mapper.(*Mapper24).MirrorMode()
+	case MapperID30:
+		return c.mapper.(*Mapper30).MirrorMode()
+	case MapperID69:
+		return c.mapper.(*Mapper69).MirrorMode()
 	default:
 		panic("unreachable")
 	}
@@ -139,8 +221,20 @@ func (c *StaticCartridge) ReadPRG(addr uint16) byte {
 		return c.mapper.(*Mapper3).ReadPRG(addr)
 	case MapperID4:
 		return c.mapper.(*Mapper4).ReadPRG(addr)
+	case MapperID5:
+		return c.mapper.(*Mapper5).ReadPRG(addr)
 	case MapperID7:
 		return c.mapper.(*Mapper7).ReadPRG(addr)
+	case MapperID19:
+		return c.mapper.(*Mapper19).ReadPRG(addr)
+	case MapperID20:
+		return c.mapper.(*Mapper20).ReadPRG(addr)
+	case MapperID24, MapperID26:
+		return c.mapper.(*Mapper24).ReadPRG(addr)
+	case MapperID30:
+		return c.mapper.(*Mapper30).ReadPRG(addr)
+	case MapperID69:
+		return c.mapper.(*Mapper69).ReadPRG(addr)
 	default:
 		panic("unreachable")
 	}
@@ -158,8 +252,20 @@ func (c *StaticCartridge) WritePRG(addr uint16, data byte) {
 		c.mapper.(*Mapper3).WritePRG(addr, data)
 	case MapperID4:
 		c.mapper.(*Mapper4).WritePRG(addr, data)
+	case MapperID5:
+		c.mapper.(*Mapper5).WritePRG(addr, data)
 	case MapperID7:
 		c.mapper.(*Mapper7).WritePRG(addr, data)
+	case MapperID19:
+		c.mapper.(*Mapper19).WritePRG(addr, data)
+	case MapperID20:
+		c.mapper.(*Mapper20).WritePRG(addr, data)
+	case MapperID24, MapperID26:
+		c.mapper.(*Mapper24).WritePRG(addr, data)
+	case MapperID30:
+		c.mapper.(*Mapper30).WritePRG(addr, data)
+	case MapperID69:
+		c.mapper.(*Mapper69).WritePRG(addr, data)
 	default:
 		panic("unreachable")
 	}
@@ -177,8 +283,20 @@ func (c *StaticCartridge) ReadCHR(addr uint16) byte {
 		return c.mapper.(*Mapper3).ReadCHR(addr)
 	case MapperID4:
 		return c.mapper.(*Mapper4).ReadCHR(addr)
+	case MapperID5:
+		return c.mapper.(*Mapper5).ReadCHR(addr)
 	case MapperID7:
 		return c.mapper.(*Mapper7).ReadCHR(addr)
+	case MapperID19:
+		return c.mapper.(*Mapper19).ReadCHR(addr)
+	case MapperID20:
+		return c.mapper.(*Mapper20).ReadCHR(addr)
+	case MapperID24, MapperID26:
+		return c.mapper.(*Mapper24).ReadCHR(addr)
+	case MapperID30:
+		return c.mapper.(*Mapper30).ReadCHR(addr)
+	case MapperID69:
+		return c.mapper.(*Mapper69).ReadCHR(addr)
 	default:
 		panic("unreachable")
 	}
@@ -196,8 +314,20 @@ func (c *StaticCartridge) WriteCHR(addr uint16, data byte) {
 		c.mapper.(*Mapper3).WriteCHR(addr, data)
 	case MapperID4:
 		c.mapper.(*Mapper4).WriteCHR(addr, data)
+	case MapperID5:
+		c.mapper.(*Mapper5).WriteCHR(addr, data)
 	case MapperID7:
 		c.mapper.(*Mapper7).WriteCHR(addr, data)
+	case MapperID19:
+		c.mapper.(*Mapper19).WriteCHR(addr, data)
+	case MapperID20:
+		c.mapper.(*Mapper20).WriteCHR(addr, data)
+	case MapperID24, MapperID26:
+		c.mapper.(*Mapper24).WriteCHR(addr, data)
+	case MapperID30:
+		c.mapper.(*Mapper30).WriteCHR(addr, data)
+	case MapperID69:
+		c.mapper.(*Mapper69).WriteCHR(addr, data)
 	default:
 		panic("unreachable")
 	}
@@ -215,8 +345,20 @@ func (c *StaticCartridge) SaveState(w *binario.Writer) error {
 		return c.mapper.(*Mapper3).SaveState(w)
 	case MapperID4:
 		return c.mapper.(*Mapper4).SaveState(w)
+	case MapperID5:
+		return c.mapper.(*Mapper5).SaveState(w)
 	case MapperID7:
 		return c.mapper.(*Mapper7).SaveState(w)
+	case MapperID19:
+		return c.mapper.(*Mapper19).SaveState(w)
+	case MapperID20:
+		return c.mapper.(*Mapper20).SaveState(w)
+	case MapperID24, MapperID26:
+		return c.mapper.(*Mapper24).SaveState(w)
+	case MapperID30:
+		return c.mapper.(*Mapper30).SaveState(w)
+	case MapperID69:
+		return c.mapper.(*Mapper69).SaveState(w)
 	default:
 		panic("unreachable")
 	}
@@ -234,8 +376,20 @@ func (c *StaticCartridge) LoadState(r *binario.Reader) error {
 		return c.mapper.(*Mapper3).LoadState(r)
 	case MapperID4:
 		return c.mapper.(*Mapper4).LoadState(r)
+	case MapperID5:
+		return c.mapper.(*Mapper5).LoadState(r)
 	case MapperID7:
 		return c.mapper.(*Mapper7).LoadState(r)
+	case MapperID19:
+		return c.mapper.(*Mapper19).LoadState(r)
+	case MapperID20:
+		return c.mapper.(*Mapper20).LoadState(r)
+	case MapperID24, MapperID26:
+		return c.mapper.(*Mapper24).LoadState(r)
+	case MapperID30:
+		return c.mapper.(*Mapper30).LoadState(r)
+	case MapperID69:
+		return c.mapper.(*Mapper69).LoadState(r)
 	default:
 		panic("unreachable")
 	}
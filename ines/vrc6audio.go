@@ -0,0 +1,165 @@
+package ines
+
+import (
+	"errors"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+// vrc6Level is the output of one step of the VRC6 channels, about the same
+// as the APU pulse channels.
+const vrc6Level = 0.00752
+
+// vrc6Pulse is one of the two VRC6 pulse channels, with the 16-step duty
+// cycle of the 8 widths, or the constant output in the digitized mode.
+// https://www.nesdev.org/wiki/VRC6_audio
+type vrc6Pulse struct {
+	volume   uint8
+	duty     uint8
+	constant bool
+	enabled  bool
+	period   uint16
+	timer    uint16
+	step     uint8
+}
+
+func (p *vrc6Pulse) write(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		p.constant = data&0x80 != 0
+		p.duty = data >> 4 & 0x07
+		p.volume = data & 0x0F
+	case 1:
+		p.period = p.period&0x0F00 | uint16(data)
+	case 2:
+		p.period = p.period&0x00FF | uint16(data&0x0F)<<8
+		p.enabled = data&0x80 != 0
+
+		if !p.enabled {
+			p.step = 15
+		}
+	}
+}
+
+// tick clocks the timer, with the period shifted by the frequency control.
+func (p *vrc6Pulse) tick(shift uint8) {
+	if !p.enabled {
+		return
+	}
+
+	if p.timer == 0 {
+		p.timer = p.period >> shift
+
+		if p.step == 0 {
+			p.step = 15
+		} else {
+			p.step--
+		}
+	} else {
+		p.timer--
+	}
+}
+
+func (p *vrc6Pulse) output() uint8 {
+	if !p.enabled || (!p.constant && p.step > p.duty) {
+		return 0
+	}
+
+	return p.volume
+}
+
+func (p *vrc6Pulse) saveState(w *binario.Writer) error {
+	return errors.Join(
+		w.WriteUint8(p.volume),
+		w.WriteUint8(p.duty),
+		w.WriteBool(p.constant),
+		w.WriteBool(p.enabled),
+		w.WriteUint16(p.period),
+		w.WriteUint16(p.timer),
+		w.WriteUint8(p.step),
+	)
+}
+
+func (p *vrc6Pulse) loadState(r *binario.Reader) error {
+	return errors.Join(
+		r.ReadUint8To(&p.volume),
+		r.ReadUint8To(&p.duty),
+		r.ReadBoolTo(&p.constant),
+		r.ReadBoolTo(&p.enabled),
+		r.ReadUint16To(&p.period),
+		r.ReadUint16To(&p.timer),
+		r.ReadUint8To(&p.step),
+	)
+}
+
+// vrc6Saw is the VRC6 sawtooth channel, which adds the rate to the accumulator
+// on every other of the 14 steps, the top 5 bits of it being the output.
+type vrc6Saw struct {
+	rate        uint8
+	enabled     bool
+	period      uint16
+	timer       uint16
+	step        uint8
+	accumulator uint8
+}
+
+func (s *vrc6Saw) write(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		s.rate = data & 0x3F
+	case 1:
+		s.period = s.period&0x0F00 | uint16(data)
+	case 2:
+		s.period = s.period&0x00FF | uint16(data&0x0F)<<8
+		s.enabled = data&0x80 != 0
+
+		if !s.enabled {
+			s.step, s.accumulator = 0, 0
+		}
+	}
+}
+
+func (s *vrc6Saw) tick(shift uint8) {
+	if !s.enabled {
+		return
+	}
+
+	if s.timer != 0 {
+		s.timer--
+		return
+	}
+
+	s.timer = s.period >> shift
+
+	if s.step++; s.step == 14 {
+		s.step, s.accumulator = 0, 0
+	} else if s.step%2 == 0 {
+		s.accumulator += s.rate
+	}
+}
+
+func (s *vrc6Saw) output() uint8 {
+	return s.accumulator >> 3
+}
+
+func (s *vrc6Saw) saveState(w *binario.Writer) error {
+	return errors.Join(
+		w.WriteUint8(s.rate),
+		w.WriteBool(s.enabled),
+		w.WriteUint16(s.period),
+		w.WriteUint16(s.timer),
+		w.WriteUint8(s.step),
+		w.WriteUint8(s.accumulator),
+	)
+}
+
+func (s *vrc6Saw) loadState(r *binario.Reader) error {
+	return errors.Join(
+		r.ReadUint8To(&s.rate),
+		r.ReadBoolTo(&s.enabled),
+		r.ReadUint16To(&s.period),
+		r.ReadUint16To(&s.timer),
+		r.ReadUint8To(&s.step),
+		r.ReadUint8To(&s.accumulator),
+	)
+}
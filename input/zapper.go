@@ -1,24 +1,79 @@
 package input
 
-import "github.com/maxpoletaev/dendy/internal/binario"
+import (
+	"github.com/maxpoletaev/dendy/internal/binario"
+	"github.com/maxpoletaev/dendy/ppu"
+)
 
 var (
-	_ Device = (*Zapper)(nil)
+	_ Device   = (*Zapper)(nil)
+	_ LightGun = (*Zapper)(nil)
+)
+
+const (
+	// zapperSenseScanlines is how long the light is sensed after the beam has
+	// drawn the aimed pixel, as the photodiode takes time to fade.
+	zapperSenseScanlines = 20
+
+	// zapperLightLevel is the luminance of the pixel bright enough to be seen.
+	zapperLightLevel = 64
 )
 
+// zapperLuma is the luminance of the colors of the default palette. The light
+// is sensed from the color index, rather than from the color displayed, which
+// depends on the palette chosen by the user.
+var zapperLuma = func() (luma [ppu.PaletteSize]uint8) {
+	for i, c := range ppu.DefaultPalette {
+		luma[i] = uint8((299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000)
+	}
+
+	return luma
+}()
+
+// Screen is the picture the light guns are aimed at. It is implemented by the
+// PPU.
+type Screen interface {
+	// Beam returns the scanline and the dot being drawn.
+	Beam() (scanline, dot int)
+	// PixelIndex returns the palette index of the pixel of the frame being
+	// drawn, with the emphasis bits.
+	PixelIndex(x, y int) uint16
+}
+
+// LightGun is implemented by the devices that look at the screen.
+type LightGun interface {
+	SetScreen(s Screen)
+}
+
+// AsLightGun returns the device as a light gun, if it is one. The static device
+// is a light gun only when it wraps the Zapper.
+func AsLightGun(d Device) (LightGun, bool) {
+	if s, ok := d.(*StaticDevice); ok && s.t == DeviceTypeZapper {
+		return s.v.(*Zapper), true
+	}
+
+	gun, ok := d.(LightGun)
+
+	return gun, ok
+}
+
+// Zapper is the light gun. It senses the light of the pixel it is aimed at, as
+// the PPU draws it, so that what it sees only depends on the emulated state
+// and the aim, rather than on how the frame is displayed.
 type Zapper struct {
-	lightDetected  bool
+	screen         Screen
+	x, y           int
 	triggerPressed bool
 }
 
 func NewZapper() *Zapper {
 	return &Zapper{
-		lightDetected: false,
+		x: -1,
+		y: -1,
 	}
 }
 
 func (z *Zapper) Reset() {
-	z.lightDetected = false
 	z.triggerPressed = false
 }
 
@@ -26,7 +81,7 @@ func (z *Zapper) Read() (value byte) {
 	if z.triggerPressed {
 		value |= 1 << 4
 	}
-	if !z.lightDetected {
+	if !z.lightDetected() {
 		value |= 1 << 3
 	}
 	return value
@@ -43,11 +98,37 @@ func (z *Zapper) LoadState(r *binario.Reader) error {
 	return nil
 }
 
-func (z *Zapper) Update(brightness uint8, trigger bool) {
-	z.lightDetected = brightness > 64
+// SetScreen connects the Zapper to the screen it is aimed at.
+func (z *Zapper) SetScreen(s Screen) {
+	z.screen = s
+}
+
+// Update sets the pixel the Zapper is aimed at, and whether the trigger is
+// pressed. The coordinates are negative when it is aimed off the screen.
+func (z *Zapper) Update(x, y int, trigger bool) {
+	z.x, z.y = x, y
 	z.triggerPressed = trigger
 }
 
-func (z *Zapper) VBlank() {
-	z.lightDetected = false
+// lightDetected returns true if the aimed pixel is bright and has been drawn
+// within the last zapperSenseScanlines scanlines. The PPU draws a scanline at
+// its end, so the light is sensed from then on rather than from the dot the
+// beam passes the pixel at.
+func (z *Zapper) lightDetected() bool {
+	if z.screen == nil || z.x < 0 || z.y < 0 {
+		return false
+	}
+
+	scanline, dot := z.screen.Beam()
+
+	lines := scanline - z.y
+	if dot <= 256 {
+		lines-- // not drawn yet
+	}
+
+	if lines < 0 || lines >= zapperSenseScanlines {
+		return false
+	}
+
+	return zapperLuma[z.screen.PixelIndex(z.x, z.y)%ppu.PaletteSize] > zapperLightLevel
 }
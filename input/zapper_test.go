@@ -0,0 +1,45 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+type testScreen struct {
+	scanline, dot int
+	pixel         uint16
+}
+
+func (s *testScreen) Beam() (int, int) {
+	return s.scanline, s.dot
+}
+
+func (s *testScreen) PixelIndex(x, y int) uint16 {
+	return s.pixel
+}
+
+func TestZapper_LightDetected(t *testing.T) {
+	screen := &testScreen{pixel: 0x30} // white
+	z := NewZapper()
+	z.SetScreen(screen)
+	z.Update(100, 50, false)
+
+	sensed := func(scanline, dot int) bool {
+		screen.scanline, screen.dot = scanline, dot
+		return z.Read()&(1<<3) == 0
+	}
+
+	testutil.Equal(t, sensed(49, 300), false) // above the aimed pixel
+	testutil.Equal(t, sensed(50, 100), false) // the scanline is not drawn yet
+	testutil.Equal(t, sensed(50, 258), true)
+	testutil.Equal(t, sensed(70, 100), true)
+	testutil.Equal(t, sensed(70, 258), false) // faded
+
+	screen.pixel = 0x0F
+	testutil.Equal(t, sensed(55, 0), false) // too dark
+
+	z.Update(-1, -1, true)
+	testutil.Equal(t, sensed(55, 0), false) // off the screen
+	testutil.Equal(t, z.Read()&(1<<4) != 0, true)
+}
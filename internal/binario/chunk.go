@@ -0,0 +1,88 @@
+package binario
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Chunk is a tagged part of the stream, usually the state of a single component.
+type Chunk struct {
+	Tag   string
+	Write func(w *Writer) error
+}
+
+// WriteChunks writes the chunks prefixed with their count. Each chunk is stored
+// as its tag followed by the length of its data, so that the reader can match
+// the chunks by tag regardless of their order, and skip the ones it does not
+// know about. The data is buffered to find out its length before it is written.
+func (w *Writer) WriteChunks(chunks ...Chunk) error {
+	if err := w.WriteVarUint(uint64(len(chunks))); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	bw := NewWriter(&buf, w.byteOrder)
+
+	for _, c := range chunks {
+		buf.Reset()
+
+		if err := c.Write(bw); err != nil {
+			return fmt.Errorf("chunk %q: %w", c.Tag, err)
+		}
+
+		if err := w.WriteString(c.Tag); err != nil {
+			return err
+		}
+
+		if err := w.WriteByteSlice(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadChunks reads the chunks written by WriteChunks, passing each of them to
+// the handler with the same tag. The chunks without a handler are skipped, and
+// the handlers without a chunk are not called. A handler must read its chunk
+// to the end, as leftover data means it does not match the writer.
+func (r *Reader) ReadChunks(handlers map[string]func(r *Reader) error) error {
+	count, err := r.ReadVarUint()
+	if err != nil {
+		return err
+	}
+
+	for i := uint64(0); i < count; i++ {
+		tag, err := r.ReadString()
+		if err != nil {
+			return err
+		}
+
+		length, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+
+		handler, ok := handlers[tag]
+		if !ok {
+			if _, err := io.CopyN(io.Discard, r.reader, int64(length)); err != nil {
+				return fmt.Errorf("chunk %q: %w", tag, err)
+			}
+
+			continue
+		}
+
+		limited := &io.LimitedReader{R: r.reader, N: int64(length)}
+
+		if err := handler(NewReader(limited, r.byteOrder)); err != nil {
+			return fmt.Errorf("chunk %q: %w", tag, err)
+		}
+
+		if limited.N > 0 {
+			return fmt.Errorf("chunk %q: %d bytes left unread", tag, limited.N)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package binario
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+func writeChunks(t *testing.T, chunks ...Chunk) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	if err := NewWriter(&buf, binary.LittleEndian).WriteChunks(chunks...); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func uint8Chunk(tag string, v uint8) Chunk {
+	return Chunk{Tag: tag, Write: func(w *Writer) error {
+		return w.WriteUint8(v)
+	}}
+}
+
+// The chunks are matched by tag regardless of their order, the unknown ones are
+// skipped, and the handlers without a chunk are not called.
+func TestReader_ReadChunks(t *testing.T) {
+	data := writeChunks(t,
+		uint8Chunk("b", 2),
+		Chunk{Tag: "new", Write: func(w *Writer) error {
+			return w.WriteString("unknown to the reader")
+		}},
+		uint8Chunk("a", 1),
+	)
+
+	var (
+		a, b   uint8
+		called bool
+	)
+
+	err := newReader(data...).ReadChunks(map[string]func(r *Reader) error{
+		"a": func(r *Reader) error { return r.ReadUint8To(&a) },
+		"b": func(r *Reader) error { return r.ReadUint8To(&b) },
+		"old": func(r *Reader) error {
+			called = true
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, a, 1)
+	testutil.Equal(t, b, 2)
+	testutil.Equal(t, called, false)
+}
+
+func TestReader_ReadChunksErrors(t *testing.T) {
+	tests := map[string]struct {
+		chunk   Chunk
+		handler func(r *Reader) error
+		err     string
+	}{
+		"left unread": {
+			chunk:   Chunk{Tag: "c", Write: func(w *Writer) error { return w.WriteUint16(1) }},
+			handler: func(r *Reader) error { _, err := r.ReadUint8(); return err },
+			err:     `chunk "c": 1 bytes left unread`,
+		},
+		"read past the end": {
+			chunk:   uint8Chunk("c", 1),
+			handler: func(r *Reader) error { _, err := r.ReadUint16(); return err },
+			err:     `chunk "c": unexpected EOF`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := writeChunks(t, tt.chunk)
+
+			err := newReader(data...).ReadChunks(map[string]func(r *Reader) error{"c": tt.handler})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			testutil.Equal(t, err.Error(), tt.err)
+		})
+	}
+}
+
+// The truncated chunk is an error even if it is skipped.
+func TestReader_ReadChunksTruncated(t *testing.T) {
+	data := writeChunks(t, uint8Chunk("a", 1), uint8Chunk("skipped", 2))
+
+	err := newReader(data[:len(data)-1]...).ReadChunks(map[string]func(r *Reader) error{
+		"a": func(r *Reader) error { _, err := r.ReadUint8(); return err },
+	})
+
+	testutil.Equal(t, err != nil && strings.HasPrefix(err.Error(), `chunk "skipped"`), true)
+}
@@ -2,13 +2,30 @@ package binario
 
 import (
 	"encoding/binary"
+	"errors"
 	"io"
 )
 
+// MaxLength is the longest byte slice or string accepted by the reader. The
+// longer ones are most likely read from the corrupted data, and allocating the
+// memory for them may take down the program.
+const MaxLength = 64 << 20
+
+var (
+	// ErrOverflow is returned when a varint does not fit into 64 bits.
+	ErrOverflow = errors.New("binario: varint overflows 64 bits")
+	// ErrTooLong is returned when the length is over MaxLength.
+	ErrTooLong = errors.New("binario: length is over the limit")
+	// ErrLengthMismatch is returned when the length of the slice read into a
+	// fixed-size buffer is not the size of the buffer.
+	ErrLengthMismatch = errors.New("binario: length does not match the buffer")
+)
+
 type Reader struct {
-	byteOrder binary.ByteOrder
-	reader    io.Reader
-	buf       [8]byte
+	byteOrder  binary.ByteOrder
+	reader     io.Reader
+	buf        [8]byte
+	fixedWidth bool
 }
 
 func NewReader(reader io.Reader, byteOrder binary.ByteOrder) *Reader {
@@ -18,6 +35,14 @@ func NewReader(reader io.Reader, byteOrder binary.ByteOrder) *Reader {
 	}
 }
 
+// SetFixedWidth makes the varints read as 8 bytes and the varint lengths as 4
+// bytes, the way the formats stored them before the varints were introduced.
+// It is only meant for reading the older versions of the formats, see
+// Writer.SetFixedWidth.
+func (r *Reader) SetFixedWidth(v bool) {
+	r.fixedWidth = v
+}
+
 func (r *Reader) ReadBool() (bool, error) {
 	b, err := r.ReadUint8()
 	return b != 0, err
@@ -35,7 +60,7 @@ func (r *Reader) ReadBoolTo(dst *bool) error {
 
 func (r *Reader) ReadUint8() (uint8, error) {
 	bs := r.buf[:1]
-	if _, err := r.reader.Read(bs); err != nil {
+	if _, err := io.ReadFull(r.reader, bs); err != nil {
 		return 0, err
 	}
 
@@ -54,7 +79,7 @@ func (r *Reader) ReadUint8To(dst *uint8) error {
 
 func (r *Reader) ReadUint16() (uint16, error) {
 	bs := r.buf[:2]
-	if _, err := r.reader.Read(bs); err != nil {
+	if _, err := io.ReadFull(r.reader, bs); err != nil {
 		return 0, err
 	}
 
@@ -73,7 +98,7 @@ func (r *Reader) ReadUint16To(dst *uint16) error {
 
 func (r *Reader) ReadUint32() (uint32, error) {
 	bs := r.buf[:4]
-	if _, err := r.reader.Read(bs); err != nil {
+	if _, err := io.ReadFull(r.reader, bs); err != nil {
 		return 0, err
 	}
 
@@ -92,7 +117,7 @@ func (r *Reader) ReadUint32To(dst *uint32) error {
 
 func (r *Reader) ReadUint64() (uint64, error) {
 	bs := r.buf[:8]
-	if _, err := r.reader.Read(bs); err != nil {
+	if _, err := io.ReadFull(r.reader, bs); err != nil {
 		return 0, err
 	}
 
@@ -119,8 +144,12 @@ func (r *Reader) ReadByteSlice() ([]byte, error) {
 		return nil, nil
 	}
 
+	if length > MaxLength {
+		return nil, ErrTooLong
+	}
+
 	bs := make([]byte, length)
-	if _, err = r.reader.Read(bs); err != nil {
+	if _, err = io.ReadFull(r.reader, bs); err != nil {
 		return nil, err
 	}
 
@@ -142,7 +171,7 @@ func (r *Reader) ReadByteSliceTo(dst []byte) error {
 	}
 
 	bs := dst[:length]
-	if _, err = r.reader.Read(bs); err != nil {
+	if _, err = io.ReadFull(r.reader, bs); err != nil {
 		return err
 	}
 
@@ -150,7 +179,7 @@ func (r *Reader) ReadByteSliceTo(dst []byte) error {
 }
 
 func (r *Reader) ReadRawBytesTo(dst []byte) error {
-	if _, err := r.reader.Read(dst); err != nil {
+	if _, err := io.ReadFull(r.reader, dst); err != nil {
 		return err
 	}
 
@@ -172,7 +201,14 @@ func (r *Reader) ReadStringTo(dst *string) error {
 	return nil
 }
 
+// ReadVarUint reads an unsigned integer written by WriteVarUint. The ones that
+// do not fit into 64 bits are rejected with ErrOverflow, rather than silently
+// truncated.
 func (r *Reader) ReadVarUint() (uint64, error) {
+	if r.fixedWidth {
+		return r.ReadUint64()
+	}
+
 	var value uint64
 	var shift uint
 
@@ -182,6 +218,11 @@ func (r *Reader) ReadVarUint() (uint64, error) {
 			return 0, err
 		}
 
+		// The tenth byte only has the last bit left.
+		if shift == 63 && b > 1 {
+			return 0, ErrOverflow
+		}
+
 		value |= uint64(b&0x7F) << shift
 		if b&0x80 == 0 {
 			break
@@ -202,3 +243,99 @@ func (r *Reader) ReadVarUintTo(dst *uint64) error {
 	*dst = b
 	return nil
 }
+
+// ReadVarInt reads a signed integer written by WriteVarInt.
+func (r *Reader) ReadVarInt() (int64, error) {
+	u, err := r.ReadVarUint()
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (r *Reader) ReadVarIntTo(dst *int64) error {
+	v, err := r.ReadVarInt()
+	if err != nil {
+		return err
+	}
+
+	*dst = v
+	return nil
+}
+
+func (r *Reader) readLength() (int, error) {
+	var (
+		length uint64
+		err    error
+	)
+
+	if r.fixedWidth {
+		var l uint32
+		l, err = r.ReadUint32()
+		length = uint64(l)
+	} else {
+		length, err = r.ReadVarUint()
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if length > MaxLength {
+		return 0, ErrTooLong
+	}
+
+	return int(length), nil
+}
+
+// ReadVarBytes reads a byte slice written by WriteVarBytes.
+func (r *Reader) ReadVarBytes() ([]byte, error) {
+	length, err := r.readLength()
+	if err != nil || length == 0 {
+		return nil, err
+	}
+
+	bs := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, bs); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+// ReadVarBytesTo reads a byte slice written by WriteVarBytes into the buffer,
+// which must be of the same length, so that the data of another size is not
+// silently read as a part of the buffer.
+func (r *Reader) ReadVarBytesTo(dst []byte) error {
+	length, err := r.readLength()
+	if err != nil {
+		return err
+	}
+
+	if length != len(dst) {
+		return ErrLengthMismatch
+	}
+
+	if _, err := io.ReadFull(r.reader, dst); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReadVarString reads a string written by WriteVarString.
+func (r *Reader) ReadVarString() (string, error) {
+	bs, err := r.ReadVarBytes()
+	return string(bs), err
+}
+
+func (r *Reader) ReadVarStringTo(dst *string) error {
+	s, err := r.ReadVarString()
+	if err != nil {
+		return err
+	}
+
+	*dst = s
+	return nil
+}
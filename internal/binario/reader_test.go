@@ -0,0 +1,159 @@
+package binario
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+func newReader(data ...byte) *Reader {
+	return NewReader(bytes.NewReader(data), binary.LittleEndian)
+}
+
+func TestReader_ReadVarUint(t *testing.T) {
+	tests := map[string]struct {
+		data []byte
+		want uint64
+		err  error
+	}{
+		"zero":            {data: []byte{0x00}, want: 0},
+		"one byte":        {data: []byte{0x7F}, want: 0x7F},
+		"two bytes":       {data: []byte{0x80, 0x01}, want: 0x80},
+		"max uint64":      {data: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}, want: math.MaxUint64},
+		"overflow":        {data: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x02}, err: ErrOverflow},
+		"eleven bytes":    {data: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x81, 0x00}, err: ErrOverflow},
+		"truncated":       {data: []byte{0x80}, err: io.EOF},
+		"empty":           {data: nil, err: io.EOF},
+		"redundant zeros": {data: []byte{0x81, 0x80, 0x00}, want: 1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := newReader(tt.data...).ReadVarUint()
+			testutil.Equal(t, errors.Is(err, tt.err), true)
+			testutil.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestReader_ReadVarInt(t *testing.T) {
+	tests := map[int64][]byte{
+		0:             {0x00},
+		-1:            {0x01},
+		1:             {0x02},
+		-2:            {0x03},
+		63:            {0x7E},
+		-64:           {0x7F},
+		64:            {0x80, 0x01},
+		math.MaxInt64: {0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01},
+		math.MinInt64: {0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01},
+	}
+
+	for value, encoded := range tests {
+		var buf bytes.Buffer
+		if err := NewWriter(&buf, binary.LittleEndian).WriteVarInt(value); err != nil {
+			t.Fatal(err)
+		}
+
+		testutil.Equal(t, bytes.Equal(buf.Bytes(), encoded), true)
+
+		got, err := newReader(encoded...).ReadVarInt()
+		testutil.Equal(t, err, nil)
+		testutil.Equal(t, got, value)
+	}
+}
+
+// The lengths over MaxLength are rejected before the memory is allocated.
+func TestReader_ReadVarBytesTooLong(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf, binary.LittleEndian)
+	if err := w.WriteVarUint(MaxLength + 1); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := newReader(buf.Bytes()...).ReadVarBytes()
+	testutil.Equal(t, err, ErrTooLong)
+
+	_, err = newReader(buf.Bytes()...).ReadVarString()
+	testutil.Equal(t, err, ErrTooLong)
+
+	r := newReader(0xFF, 0xFF, 0xFF, 0xFF)
+	r.SetFixedWidth(true)
+	_, err = r.ReadVarBytes()
+	testutil.Equal(t, err, ErrTooLong)
+}
+
+func TestReader_ReadVarBytesTo(t *testing.T) {
+	tests := map[string]struct {
+		data []byte
+		size int
+		err  error
+	}{
+		"same length":  {data: []byte{0x02, 0xAA, 0xBB}, size: 2},
+		"shorter data": {data: []byte{0x01, 0xAA}, size: 2, err: ErrLengthMismatch},
+		"longer data":  {data: []byte{0x03, 0xAA, 0xBB, 0xCC}, size: 2, err: ErrLengthMismatch},
+		"truncated":    {data: []byte{0x02, 0xAA}, size: 2, err: io.ErrUnexpectedEOF},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dst := make([]byte, tt.size)
+			err := newReader(tt.data...).ReadVarBytesTo(dst)
+			testutil.Equal(t, err, tt.err)
+
+			if tt.err == nil {
+				testutil.Equal(t, bytes.Equal(dst, tt.data[1:]), true)
+			}
+		})
+	}
+}
+
+// The fixed-width mode writes and reads the varints as 8 bytes and the lengths
+// as 4 bytes, the same as the formats did before the varints.
+func TestFixedWidth(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf, binary.LittleEndian)
+	w.SetFixedWidth(true)
+
+	err := errors.Join(
+		w.WriteVarUint(0x0102),
+		w.WriteVarInt(-1),
+		w.WriteVarBytes([]byte{0xAA}),
+		w.WriteVarString("hi"),
+	)
+	testutil.Equal(t, err, nil)
+
+	want := []byte{
+		0x02, 0x01, 0, 0, 0, 0, 0, 0,
+		0x01, 0, 0, 0, 0, 0, 0, 0,
+		0x01, 0, 0, 0, 0xAA,
+		0x02, 0, 0, 0, 'h', 'i',
+	}
+	testutil.Equal(t, bytes.Equal(buf.Bytes(), want), true)
+
+	r := newReader(buf.Bytes()...)
+	r.SetFixedWidth(true)
+
+	u, err := r.ReadVarUint()
+	testutil.Equal(t, err, nil)
+	testutil.Equal(t, u, 0x0102)
+
+	i, err := r.ReadVarInt()
+	testutil.Equal(t, err, nil)
+	testutil.Equal(t, i, -1)
+
+	b := make([]byte, 1)
+	testutil.Equal(t, r.ReadVarBytesTo(b), nil)
+	testutil.Equal(t, b[0], 0xAA)
+
+	s, err := r.ReadVarString()
+	testutil.Equal(t, err, nil)
+	testutil.Equal(t, s, "hi")
+}
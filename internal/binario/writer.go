@@ -9,9 +9,10 @@ import (
 // data. It is similar to the binary.Write but avoids expensive type assertions
 // by providing separate methods for each type.
 type Writer struct {
-	byteOrder binary.ByteOrder
-	writer    io.Writer
-	buf       [8]byte
+	byteOrder  binary.ByteOrder
+	writer     io.Writer
+	buf        [8]byte
+	fixedWidth bool
 }
 
 // NewWriter returns a new Writer that writes to w using the specified byte order.
@@ -22,6 +23,14 @@ func NewWriter(w io.Writer, byteOrder binary.ByteOrder) *Writer {
 	}
 }
 
+// SetFixedWidth makes the varints take 8 bytes and the varint lengths 4 bytes,
+// the way the formats stored them before the varints were introduced. It is only
+// meant for the older versions of the formats, e.g. to compute the checksums
+// stored in them.
+func (w *Writer) SetFixedWidth(v bool) {
+	w.fixedWidth = v
+}
+
 func (w *Writer) WriteBool(value bool) error {
 	if value {
 		return w.WriteUint8(1)
@@ -65,7 +74,7 @@ func (w *Writer) WriteUint64(value uint64) error {
 	return err
 }
 
-// WriteByteSlice writes a byte slice prefixed with its length.
+// WriteByteSlice writes a byte slice prefixed with its length, as 4 bytes.
 func (w *Writer) WriteByteSlice(value []byte) error {
 	length := uint32(len(value))
 	if err := w.WriteUint32(length); err != nil {
@@ -91,7 +100,7 @@ func (w *Writer) WriteRawBytes(value []byte) error {
 	return nil
 }
 
-// WriteString writes a string prefixed with its length.
+// WriteString writes a string prefixed with its length, as 4 bytes.
 func (w *Writer) WriteString(value string) error {
 	return w.WriteByteSlice([]byte(value))
 }
@@ -99,6 +108,10 @@ func (w *Writer) WriteString(value string) error {
 // WriteVarUint writes a variable-length encoded unsigned integer.
 // See https://developers.google.com/protocol-buffers/docs/encoding#varints
 func (w *Writer) WriteVarUint(value uint64) error {
+	if w.fixedWidth {
+		return w.WriteUint64(value)
+	}
+
 	for value >= 0x80 {
 		if err := w.WriteUint8(uint8(value) | 0x80); err != nil {
 			return err
@@ -109,3 +122,34 @@ func (w *Writer) WriteVarUint(value uint64) error {
 
 	return w.WriteUint8(uint8(value))
 }
+
+// WriteVarInt writes a variable-length encoded signed integer. The sign is
+// moved to the lowest bit, so that the small negative numbers are short too.
+func (w *Writer) WriteVarInt(value int64) error {
+	return w.WriteVarUint(uint64(value<<1) ^ uint64(value>>63))
+}
+
+// WriteVarBytes writes a byte slice prefixed with its length as a varint, which
+// takes a single byte for the slices shorter than 128 bytes.
+func (w *Writer) WriteVarBytes(value []byte) error {
+	var err error
+
+	if w.fixedWidth {
+		err = w.WriteUint32(uint32(len(value)))
+	} else {
+		err = w.WriteVarUint(uint64(len(value)))
+	}
+
+	if err != nil || len(value) == 0 {
+		return err
+	}
+
+	_, err = w.writer.Write(value)
+
+	return err
+}
+
+// WriteVarString writes a string prefixed with its length as a varint.
+func (w *Writer) WriteVarString(value string) error {
+	return w.WriteVarBytes([]byte(value))
+}
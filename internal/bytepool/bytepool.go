@@ -7,6 +7,7 @@ import "sync"
 type Buffer struct {
 	Data []byte
 	pool *sync.Pool
+	ptr  *[]byte // what is put back, as putting the slice itself allocates
 }
 
 // Pooled returns true if the buffer was created from a pool.
@@ -18,40 +19,68 @@ func (b *Buffer) Pooled() bool {
 // The buffer must not be used after calling Free.
 func (b *Buffer) Free() {
 	if b.pool != nil {
-		b.pool.Put(b.Data)
+		b.pool.Put(b.ptr)
 	}
 
 	b.Data = nil
 	b.pool = nil
+	b.ptr = nil
 }
 
-// BytePool manages a pool of short reusable byte slices of up to maxSize bytes
-// and allows for occasional allocation of larger slices when needed.
+// BytePool manages pools of reusable byte slices of a few size classes, e.g.
+// the short network messages and the save states, and allows for occasional
+// allocation of larger slices when needed.
 type BytePool struct {
-	pool    *sync.Pool
-	maxSize int
+	classes []sizeClass
 }
 
-// New creates a new BytePool with maxSize slice size.
-func New(maxSize int) *BytePool {
-	return &BytePool{
-		pool: &sync.Pool{
-			New: func() interface{} {
-				return make([]byte, maxSize)
+type sizeClass struct {
+	pool *sync.Pool
+	size int
+}
+
+// New creates a new BytePool with the slices of the given sizes, in ascending
+// order. The largest one is the allowed maximum.
+func New(sizes ...int) *BytePool {
+	p := &BytePool{
+		classes: make([]sizeClass, len(sizes)),
+	}
+
+	for i, size := range sizes {
+		size := size
+
+		if i > 0 && size <= sizes[i-1] {
+			panic("bytepool: sizes must be in ascending order")
+		}
+
+		p.classes[i] = sizeClass{
+			size: size,
+			pool: &sync.Pool{
+				New: func() interface{} {
+					buf := make([]byte, size)
+					return &buf
+				},
 			},
-		},
-		maxSize: maxSize,
+		}
 	}
+
+	return p
 }
 
-// Buffer returns a new Buffer of size bytes. If the requested size is larger
-// than the allowed maximum, a new slice is allocated. The returned buffer
-// contains garbage data and must be filled before use.
+// Buffer returns a new Buffer of size bytes from the smallest size class it fits
+// into. If the requested size is larger than the allowed maximum, a new slice is
+// allocated. The returned buffer contains garbage data and must be filled before
+// use.
 func (p *BytePool) Buffer(size int) Buffer {
-	if size <= p.maxSize {
-		return Buffer{
-			Data: p.pool.Get().([]byte)[:size],
-			pool: p.pool,
+	for _, c := range p.classes {
+		if size <= c.size {
+			ptr := c.pool.Get().(*[]byte)
+
+			return Buffer{
+				Data: (*ptr)[:size],
+				pool: c.pool,
+				ptr:  ptr,
+			}
 		}
 	}
 
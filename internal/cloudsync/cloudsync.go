@@ -0,0 +1,261 @@
+// Package cloudsync keeps the local save files in sync with a copy stored on a
+// remote server, so that the progress follows the player between computers.
+package cloudsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotFound is returned by the backends when the remote file does not exist.
+var ErrNotFound = errors.New("remote file not found")
+
+// Info describes the remote file.
+type Info struct {
+	Version string // changes every time the file is written, e.g. the ETag
+	ModTime time.Time
+}
+
+// Backend stores the files on the remote server.
+type Backend interface {
+	Stat(ctx context.Context, name string) (Info, error)
+	Get(ctx context.Context, name string) ([]byte, Info, error)
+	Put(ctx context.Context, name string, data []byte) error
+}
+
+// Action is what has been done to bring the file in sync.
+type Action int
+
+const (
+	Unchanged Action = iota
+	Uploaded
+	Downloaded
+	ConflictKeptLocal  // both changed, the local file was newer
+	ConflictKeptRemote // both changed, the remote file was newer
+)
+
+func (a Action) String() string {
+	switch a {
+	case Unchanged:
+		return "unchanged"
+	case Uploaded:
+		return "uploaded"
+	case Downloaded:
+		return "downloaded"
+	case ConflictKeptLocal:
+		return "conflict, kept local"
+	case ConflictKeptRemote:
+		return "conflict, kept remote"
+	default:
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+}
+
+// entry is the state of the file after the last sync, which tells whether the
+// local and the remote files have been changed since.
+type entry struct {
+	Hash    string `json:"hash"`    // sha256 of the local file
+	Version string `json:"version"` // version of the remote file
+}
+
+// Syncer syncs the files with the backend. The state of the files after the
+// last sync is kept in the manifest file.
+type Syncer struct {
+	backend  Backend
+	manifest string
+	entries  map[string]entry
+}
+
+// New creates the syncer, loading the manifest if it exists.
+func New(backend Backend, manifest string) (*Syncer, error) {
+	s := &Syncer{
+		backend:  backend,
+		manifest: manifest,
+		entries:  make(map[string]entry),
+	}
+
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse sync manifest: %w", err)
+	}
+
+	return s, nil
+}
+
+// ConflictFile returns the name the losing side of a conflict is saved under.
+func ConflictFile(localPath string) string {
+	return localPath + ".conflict"
+}
+
+// Sync brings the local file and the remote one in sync. If only one of them
+// has changed since the last sync, it replaces the other. If both have, the
+// newer one wins and the other is saved next to the local file, so that the
+// progress is never lost silently.
+func (s *Syncer) Sync(ctx context.Context, localPath, remoteName string) (Action, error) {
+	local, err := os.ReadFile(localPath)
+	if err != nil && !os.IsNotExist(err) {
+		return Unchanged, err
+	}
+
+	var (
+		localExists = err == nil
+		localHash   = hashOf(local)
+		last        = s.entries[remoteName]
+	)
+
+	remote, err := s.backend.Stat(ctx, remoteName)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return Unchanged, err
+	}
+
+	var (
+		remoteExists = err == nil
+
+		// A file missing on one side is restored from the other one.
+		localChanged  = localExists && (localHash != last.Hash || !remoteExists)
+		remoteChanged = remoteExists && (remote.Version != last.Version || !localExists)
+	)
+
+	switch {
+	case !localChanged && !remoteChanged:
+		return Unchanged, nil
+
+	case localChanged && !remoteChanged:
+		if err := s.upload(ctx, remoteName, local); err != nil {
+			return Unchanged, err
+		}
+
+		return Uploaded, nil
+
+	case !localChanged:
+		if err := s.download(ctx, localPath, remoteName); err != nil {
+			return Unchanged, err
+		}
+
+		return Downloaded, nil
+	}
+
+	return s.resolve(ctx, localPath, remoteName, local)
+}
+
+// resolve handles the files changed on both sides.
+func (s *Syncer) resolve(ctx context.Context, localPath, remoteName string, local []byte) (Action, error) {
+	data, remote, err := s.backend.Get(ctx, remoteName)
+	if err != nil {
+		return Unchanged, err
+	}
+
+	// Both sides could have ended up with the same file, e.g. when it was
+	// copied manually, which is not a conflict.
+	if hashOf(data) == hashOf(local) {
+		s.entries[remoteName] = entry{Hash: hashOf(local), Version: remote.Version}
+		return Unchanged, s.saveManifest()
+	}
+
+	stat, err := os.Stat(localPath)
+	if err != nil {
+		return Unchanged, err
+	}
+
+	if remote.ModTime.After(stat.ModTime()) {
+		if err := writeFile(ConflictFile(localPath), local); err != nil {
+			return Unchanged, err
+		}
+
+		if err := writeFile(localPath, data); err != nil {
+			return Unchanged, err
+		}
+
+		s.entries[remoteName] = entry{Hash: hashOf(data), Version: remote.Version}
+
+		return ConflictKeptRemote, s.saveManifest()
+	}
+
+	if err := writeFile(ConflictFile(localPath), data); err != nil {
+		return Unchanged, err
+	}
+
+	if err := s.upload(ctx, remoteName, local); err != nil {
+		return Unchanged, err
+	}
+
+	return ConflictKeptLocal, nil
+}
+
+func (s *Syncer) upload(ctx context.Context, remoteName string, data []byte) error {
+	if err := s.backend.Put(ctx, remoteName, data); err != nil {
+		return err
+	}
+
+	// Not all servers return the new version in response to the upload, so
+	// it is requested separately.
+	remote, err := s.backend.Stat(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+
+	s.entries[remoteName] = entry{Hash: hashOf(data), Version: remote.Version}
+
+	return s.saveManifest()
+}
+
+func (s *Syncer) download(ctx context.Context, localPath, remoteName string) error {
+	data, remote, err := s.backend.Get(ctx, remoteName)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(localPath, data); err != nil {
+		return err
+	}
+
+	s.entries[remoteName] = entry{Hash: hashOf(data), Version: remote.Version}
+
+	return s.saveManifest()
+}
+
+func (s *Syncer) saveManifest() error {
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.manifest), 0755); err != nil {
+		return err
+	}
+
+	return writeFile(s.manifest, data)
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFile replaces the file through a temporary one, so that it is never
+// left half-written.
+func writeFile(filename string, data []byte) error {
+	tmpFile := filename + ".tmp"
+
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+
+	return os.Rename(tmpFile, filename)
+}
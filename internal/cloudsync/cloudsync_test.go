@@ -0,0 +1,290 @@
+package cloudsync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+type memFile struct {
+	data []byte
+	info Info
+}
+
+// memBackend keeps the files in memory, giving every write a new version. The
+// files are written at modTime.
+type memBackend struct {
+	files   map[string]memFile
+	writes  int
+	modTime time.Time
+}
+
+func newMemBackend() *memBackend {
+	return &memBackend{
+		files:   make(map[string]memFile),
+		modTime: time.Now(),
+	}
+}
+
+func (b *memBackend) Stat(_ context.Context, name string) (Info, error) {
+	f, ok := b.files[name]
+	if !ok {
+		return Info{}, ErrNotFound
+	}
+
+	return f.info, nil
+}
+
+func (b *memBackend) Get(_ context.Context, name string) ([]byte, Info, error) {
+	f, ok := b.files[name]
+	if !ok {
+		return nil, Info{}, ErrNotFound
+	}
+
+	return append([]byte(nil), f.data...), f.info, nil
+}
+
+func (b *memBackend) Put(_ context.Context, name string, data []byte) error {
+	b.writes++
+
+	b.files[name] = memFile{
+		data: append([]byte(nil), data...),
+		info: Info{Version: strconv.Itoa(b.writes), ModTime: b.modTime},
+	}
+
+	return nil
+}
+
+func (b *memBackend) content(name string) string {
+	f, ok := b.files[name]
+	if !ok {
+		return "<none>"
+	}
+
+	return string(f.data)
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "<none>"
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func writeLocal(t *testing.T, path, data string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func syncFile(t *testing.T, s *Syncer, path string) Action {
+	t.Helper()
+
+	action, err := s.Sync(context.Background(), path, "game.sav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return action
+}
+
+func TestSyncer_Sync(t *testing.T) {
+	var (
+		older = time.Now().Add(-time.Hour)
+		newer = time.Now().Add(time.Hour)
+	)
+
+	tests := map[string]struct {
+		setup        func(t *testing.T, s *Syncer, b *memBackend, path string)
+		want         Action
+		wantLocal    string
+		wantRemote   string
+		wantConflict string
+	}{
+		"nothing": {
+			setup:        func(t *testing.T, s *Syncer, b *memBackend, path string) {},
+			want:         Unchanged,
+			wantLocal:    "<none>",
+			wantRemote:   "<none>",
+			wantConflict: "<none>",
+		},
+		"new local": {
+			setup: func(t *testing.T, s *Syncer, b *memBackend, path string) {
+				writeLocal(t, path, "local", time.Now())
+			},
+			want:         Uploaded,
+			wantLocal:    "local",
+			wantRemote:   "local",
+			wantConflict: "<none>",
+		},
+		"new remote": {
+			setup: func(t *testing.T, s *Syncer, b *memBackend, path string) {
+				_ = b.Put(context.Background(), "game.sav", []byte("remote"))
+			},
+			want:         Downloaded,
+			wantLocal:    "remote",
+			wantRemote:   "remote",
+			wantConflict: "<none>",
+		},
+		"unchanged": {
+			setup: func(t *testing.T, s *Syncer, b *memBackend, path string) {
+				writeLocal(t, path, "local", time.Now())
+				syncFile(t, s, path)
+			},
+			want:         Unchanged,
+			wantLocal:    "local",
+			wantRemote:   "local",
+			wantConflict: "<none>",
+		},
+		"local changed": {
+			setup: func(t *testing.T, s *Syncer, b *memBackend, path string) {
+				writeLocal(t, path, "local", time.Now())
+				syncFile(t, s, path)
+				writeLocal(t, path, "local 2", time.Now())
+			},
+			want:         Uploaded,
+			wantLocal:    "local 2",
+			wantRemote:   "local 2",
+			wantConflict: "<none>",
+		},
+		"remote changed": {
+			setup: func(t *testing.T, s *Syncer, b *memBackend, path string) {
+				writeLocal(t, path, "local", time.Now())
+				syncFile(t, s, path)
+				_ = b.Put(context.Background(), "game.sav", []byte("remote"))
+			},
+			want:         Downloaded,
+			wantLocal:    "remote",
+			wantRemote:   "remote",
+			wantConflict: "<none>",
+		},
+		"local removed": {
+			setup: func(t *testing.T, s *Syncer, b *memBackend, path string) {
+				writeLocal(t, path, "local", time.Now())
+				syncFile(t, s, path)
+				_ = os.Remove(path)
+			},
+			want:         Downloaded,
+			wantLocal:    "local",
+			wantRemote:   "local",
+			wantConflict: "<none>",
+		},
+		"remote removed": {
+			setup: func(t *testing.T, s *Syncer, b *memBackend, path string) {
+				writeLocal(t, path, "local", time.Now())
+				syncFile(t, s, path)
+				delete(b.files, "game.sav")
+			},
+			want:         Uploaded,
+			wantLocal:    "local",
+			wantRemote:   "local",
+			wantConflict: "<none>",
+		},
+		"both same": {
+			setup: func(t *testing.T, s *Syncer, b *memBackend, path string) {
+				writeLocal(t, path, "same", time.Now())
+				_ = b.Put(context.Background(), "game.sav", []byte("same"))
+			},
+			want:         Unchanged,
+			wantLocal:    "same",
+			wantRemote:   "same",
+			wantConflict: "<none>",
+		},
+		"both changed, remote newer": {
+			setup: func(t *testing.T, s *Syncer, b *memBackend, path string) {
+				writeLocal(t, path, "local", older)
+				b.modTime = newer
+				_ = b.Put(context.Background(), "game.sav", []byte("remote"))
+			},
+			want:         ConflictKeptRemote,
+			wantLocal:    "remote",
+			wantRemote:   "remote",
+			wantConflict: "local",
+		},
+		"both changed, local newer": {
+			setup: func(t *testing.T, s *Syncer, b *memBackend, path string) {
+				writeLocal(t, path, "local", newer)
+				b.modTime = older
+				_ = b.Put(context.Background(), "game.sav", []byte("remote"))
+			},
+			want:         ConflictKeptLocal,
+			wantLocal:    "local",
+			wantRemote:   "local",
+			wantConflict: "remote",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				dir     = t.TempDir()
+				path    = filepath.Join(dir, "game.sav")
+				backend = newMemBackend()
+			)
+
+			s, err := New(backend, filepath.Join(dir, "sync", "manifest.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.setup(t, s, backend, path)
+
+			testutil.Equal(t, syncFile(t, s, path), tt.want)
+			testutil.Equal(t, readFile(t, path), tt.wantLocal)
+			testutil.Equal(t, backend.content("game.sav"), tt.wantRemote)
+			testutil.Equal(t, readFile(t, ConflictFile(path)), tt.wantConflict)
+
+			// Both sides are in sync afterwards.
+			testutil.Equal(t, syncFile(t, s, path), Unchanged)
+		})
+	}
+}
+
+// The state of the last sync survives the restart, so that the files synced
+// before are not taken for the changed ones.
+func TestSyncer_Manifest(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		path     = filepath.Join(dir, "game.sav")
+		manifest = filepath.Join(dir, "manifest.json")
+		backend  = newMemBackend()
+	)
+
+	s, err := New(backend, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeLocal(t, path, "local", time.Now())
+	testutil.Equal(t, syncFile(t, s, path), Uploaded)
+
+	s, err = New(backend, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, syncFile(t, s, path), Unchanged)
+	testutil.Equal(t, backend.writes, 1)
+
+	writeLocal(t, manifest, "{", time.Now())
+
+	_, err = New(backend, manifest)
+	testutil.Equal(t, err != nil, true)
+}
@@ -0,0 +1,159 @@
+package cloudsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 30 * time.Second
+
+// httpBackend keeps the files under the base URL, which is all that is needed
+// for both WebDAV and S3, as they only differ in the way requests are signed.
+type httpBackend struct {
+	client    *http.Client
+	baseURL   string
+	authorize func(req *http.Request, body []byte)
+}
+
+// NewWebDAV creates the backend storing the files in the WebDAV directory. The
+// directory must already exist. Empty username disables authentication.
+func NewWebDAV(baseURL, username, password string) (Backend, error) {
+	u, err := parseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpBackend{
+		client:  &http.Client{Timeout: requestTimeout},
+		baseURL: strings.TrimSuffix(u.String(), "/"),
+		authorize: func(req *http.Request, _ []byte) {
+			if username != "" {
+				req.SetBasicAuth(username, password)
+			}
+		},
+	}, nil
+}
+
+func (b *httpBackend) request(ctx context.Context, method, name string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+"/"+escapePath(name), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		req.Body = http.NoBody
+	}
+
+	b.authorize(req, body)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+
+	case resp.StatusCode >= 300:
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, name, resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (b *httpBackend) Stat(ctx context.Context, name string) (Info, error) {
+	resp, err := b.request(ctx, http.MethodHead, name, nil)
+	if err != nil {
+		return Info{}, err
+	}
+
+	_ = resp.Body.Close()
+
+	return infoOf(resp), nil
+}
+
+func (b *httpBackend) Get(ctx context.Context, name string) ([]byte, Info, error) {
+	resp, err := b.request(ctx, http.MethodGet, name, nil)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	return data, infoOf(resp), nil
+}
+
+func (b *httpBackend) Put(ctx context.Context, name string, data []byte) error {
+	resp, err := b.request(ctx, http.MethodPut, name, data)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// infoOf takes the version from the ETag, or the modification time for the
+// servers that do not send it.
+func infoOf(resp *http.Response) Info {
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	version := resp.Header.Get("ETag")
+	if version == "" {
+		version = resp.Header.Get("Last-Modified")
+	}
+
+	return Info{Version: version, ModTime: modTime}
+}
+
+// escapePath percent-encodes everything but the unreserved characters in each
+// segment of the path, which is also the encoding S3 expects in signatures.
+func escapePath(name string) string {
+	segments := strings.Split(name, "/")
+
+	for i, segment := range segments {
+		var sb strings.Builder
+
+		for _, c := range []byte(segment) {
+			switch {
+			case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+				c == '-', c == '.', c == '_', c == '~':
+				sb.WriteByte(c)
+			default:
+				fmt.Fprintf(&sb, "%%%02X", c)
+			}
+		}
+
+		segments[i] = sb.String()
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func parseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme: %q", u.Scheme)
+	}
+
+	return u, nil
+}
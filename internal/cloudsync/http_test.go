@@ -0,0 +1,188 @@
+package cloudsync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newWebDAVServer serves the files from memory to the user with the password,
+// giving every write a new ETag.
+func newWebDAVServer(t *testing.T) (*httptest.Server, map[string]string) {
+	t.Helper()
+
+	var (
+		files  = make(map[string]string)
+		etags  = make(map[string]string)
+		writes int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		path := r.URL.EscapedPath()
+
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			writes++
+			files[path] = string(data)
+			etags[path] = `"` + strconv.Itoa(writes) + `"`
+			w.WriteHeader(http.StatusCreated)
+
+		case http.MethodGet, http.MethodHead:
+			data, ok := files[path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("ETag", etags[path])
+			_, _ = io.WriteString(w, data)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv, files
+}
+
+func TestWebDAV(t *testing.T) {
+	srv, files := newWebDAVServer(t)
+	ctx := context.Background()
+
+	b, err := NewWebDAV(srv.URL+"/dav/", "user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = b.Stat(ctx, "saves/Game One.sav")
+	testutil.Equal(t, errors.Is(err, ErrNotFound), true)
+
+	_, _, err = b.Get(ctx, "saves/Game One.sav")
+	testutil.Equal(t, errors.Is(err, ErrNotFound), true)
+
+	if err = b.Put(ctx, "saves/Game One.sav", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, files["/dav/saves/Game%20One.sav"], "data")
+
+	info, err := b.Stat(ctx, "saves/Game One.sav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, info.Version, `"1"`)
+
+	data, info, err := b.Get(ctx, "saves/Game One.sav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, string(data), "data")
+	testutil.Equal(t, info.Version, `"1"`)
+
+	if err = b.Put(ctx, "saves/Game One.sav", []byte("data 2")); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err = b.Stat(ctx, "saves/Game One.sav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, info.Version, `"2"`)
+}
+
+// The errors other than the missing file are not taken for it.
+func TestWebDAV_Unauthorized(t *testing.T) {
+	srv, _ := newWebDAVServer(t)
+
+	b, err := NewWebDAV(srv.URL, "user", "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = b.Stat(context.Background(), "game.sav")
+	testutil.Equal(t, err != nil, true)
+	testutil.Equal(t, errors.Is(err, ErrNotFound), false)
+}
+
+func TestInfoOf(t *testing.T) {
+	const lastModified = "Tue, 02 Jan 2024 03:04:05 GMT"
+
+	tests := map[string]struct {
+		etag        string
+		wantVersion string
+	}{
+		"etag":    {etag: `"abc"`, wantVersion: `"abc"`},
+		"no etag": {etag: "", wantVersion: lastModified},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp := &http.Response{Header: make(http.Header)}
+			resp.Header.Set("Last-Modified", lastModified)
+
+			if tt.etag != "" {
+				resp.Header.Set("ETag", tt.etag)
+			}
+
+			info := infoOf(resp)
+			testutil.Equal(t, info.Version, tt.wantVersion)
+			testutil.Equal(t, info.ModTime.Unix(), int64(1704164645))
+		})
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := map[string]struct {
+		name string
+		want string
+	}{
+		"plain":       {name: "game.sav", want: "game.sav"},
+		"directories": {name: "saves/game.sav", want: "saves/game.sav"},
+		"unreserved":  {name: "a-b_c~d.sav", want: "a-b_c~d.sav"},
+		"space":       {name: "Game One.sav", want: "Game%20One.sav"},
+		"reserved":    {name: "a+b&c(1).sav", want: "a%2Bb%26c%281%29.sav"},
+		"unicode":     {name: "игра.sav", want: "%D0%B8%D0%B3%D1%80%D0%B0.sav"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testutil.Equal(t, escapePath(tt.name), tt.want)
+		})
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tests := map[string]struct {
+		url     string
+		wantErr bool
+	}{
+		"http":      {url: "http://example.com/dav"},
+		"https":     {url: "https://example.com/dav"},
+		"ftp":       {url: "ftp://example.com/dav", wantErr: true},
+		"no scheme": {url: "example.com/dav", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseURL(tt.url)
+			testutil.Equal(t, err != nil, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package cloudsync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NewS3 creates the backend storing the files in the S3 bucket. Any service
+// compatible with S3 can be used by passing its endpoint, e.g. MinIO. The bucket
+// is addressed with the path style, which is supported by all of them.
+func NewS3(endpoint, region, bucket, accessKey, secretKey string) (Backend, error) {
+	u, err := parseURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &httpBackend{
+		client:  &http.Client{Timeout: requestTimeout},
+		baseURL: strings.TrimSuffix(u.String(), "/") + "/" + escapePath(bucket),
+		authorize: func(req *http.Request, body []byte) {
+			signV4(req, body, time.Now().UTC(), region, accessKey, secretKey)
+		},
+	}, nil
+}
+
+// signV4 signs the request with AWS Signature Version 4. Only the headers that
+// are always present are signed, and the requests have no query parameters.
+func signV4(req *http.Request, body []byte, now time.Time, region, accessKey, secretKey string) {
+	var (
+		amzDate     = now.Format("20060102T150405Z")
+		date        = now.Format("20060102")
+		scope       = date + "/" + region + "/s3/aws4_request"
+		payloadHash = hashOf(body)
+	)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashOf([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,41 @@
+package cloudsync
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// The signature is checked against the one computed independently, following
+// the steps of the AWS documentation.
+func TestSignV4(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPut, "https://s3.example.com/my-bucket/"+escapePath("saves/Game One.sav"), strings.NewReader("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	signV4(req, []byte("data"), now, "us-east-1", "AKIDEXAMPLE", "secret")
+
+	testutil.Equal(t, req.Header.Get("X-Amz-Date"), "20240102T030405Z")
+	testutil.Equal(t, req.Header.Get("X-Amz-Content-Sha256"), "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7")
+	testutil.Equal(t, req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 "+
+		"Credential=AKIDEXAMPLE/20240102/us-east-1/s3/aws4_request, "+
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date, "+
+		"Signature=84f7ea4bcf0fabdaa154ec8caab8c1fd8f722ad50f9184b12d0ea263a788d49c")
+}
+
+func TestNewS3(t *testing.T) {
+	b, err := NewS3("https://s3.example.com/", "", "my bucket", "key", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, b.(*httpBackend).baseURL, "https://s3.example.com/my%20bucket")
+
+	_, err = NewS3("s3.example.com", "", "bucket", "key", "secret")
+	testutil.Equal(t, err != nil, true)
+}
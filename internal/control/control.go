@@ -0,0 +1,410 @@
+// Package control implements the local HTTP API to control the running emulator
+// from the external tools, such as stream overlays, bots and CI scripts.
+package control
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// callTimeout is how long a request waits for the emulator to pick it up, e.g.
+// while the next game is being loaded.
+const callTimeout = 5 * time.Second
+
+var (
+	errTimeout     = errors.New("emulator is not responding")
+	errHost        = errors.New("host does not match the listen address")
+	errOrigin      = errors.New("requests from other origins are not allowed")
+	errToken       = errors.New("missing or invalid token")
+	errContentType = errors.New("content type must be application/json")
+)
+
+// Status is the state of the emulator reported by the API.
+type Status struct {
+	ROM    string `json:"rom"`
+	Game   string `json:"game,omitempty"`
+	Paused bool   `json:"paused"`
+	Frame  uint64 `json:"frame"`
+}
+
+// Emulator is controlled by the API. The methods are only called from Process,
+// on the goroutine running the emulation.
+type Emulator interface {
+	Status() Status
+	SetPaused(paused bool)
+	LoadROM(filename string) error
+	SaveState(slot int) error
+	LoadState(slot int) error
+	ReadMemory(addr uint16, length int) []uint8
+	PressButtons(buttons []string, frames int) error
+	Frame() (pixels []color.RGBA, width, height int)
+}
+
+// Server serves the API on the local address. The requests are queued and
+// executed by Process, so that the emulator does not have to be safe for
+// concurrent use.
+//
+// Any web page open in the browser can send the requests to the local address,
+// so every request must have the random token generated at startup in the
+// Authorization header, and the Host and Origin headers, if set, must match the
+// listen address, which protects against the DNS rebinding.
+type Server struct {
+	server *http.Server
+	calls  chan func(Emulator)
+	token  string
+	hosts  []string // allowed values of the Host header
+}
+
+// Listen starts serving the API on the address, with the new random token.
+func Listen(addr string) (*Server, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newServer(token, listenHosts(addr, ln.Addr())...)
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[ERROR] control api: %s", err)
+		}
+	}()
+
+	return s, nil
+}
+
+func newServer(token string, hosts ...string) *Server {
+	s := &Server{
+		calls: make(chan func(Emulator)),
+		token: token,
+		hosts: hosts,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/pause", s.handlePause(true))
+	mux.HandleFunc("/resume", s.handlePause(false))
+	mux.HandleFunc("/rom", s.handleROM)
+	mux.HandleFunc("/state/save", s.handleState(false))
+	mux.HandleFunc("/state/load", s.handleState(true))
+	mux.HandleFunc("/memory", s.handleMemory)
+	mux.HandleFunc("/buttons", s.handleButtons)
+	mux.HandleFunc("/frame", s.handleFrame)
+
+	s.server = &http.Server{Handler: s.authorize(mux), ReadHeaderTimeout: callTimeout}
+
+	return s
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// listenHosts returns the addresses the clients may use to reach the server:
+// the one it was started with, the one it actually listens on, and localhost
+// in case it is the loopback address.
+func listenHosts(addr string, ln net.Addr) []string {
+	hosts := []string{addr, ln.String()}
+
+	if tcpAddr, ok := ln.(*net.TCPAddr); ok && tcpAddr.IP.IsLoopback() {
+		hosts = append(hosts, net.JoinHostPort("localhost", strconv.Itoa(tcpAddr.Port)))
+	}
+
+	return hosts
+}
+
+// Token returns the token the requests must be sent with.
+func (s *Server) Token() string {
+	return s.token
+}
+
+func (s *Server) allowedHost(host string) bool {
+	for _, h := range s.hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authorize rejects the requests that do not come from the local tools, see
+// the Server description.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowedHost(r.Host) {
+			writeError(w, http.StatusForbidden, errHost)
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Scheme != "http" || !s.allowedHost(u.Host) {
+				writeError(w, http.StatusForbidden, errOrigin)
+				return
+			}
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errToken)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// Process executes the pending requests. It must be called regularly, e.g.
+// once per frame, including when the emulation is paused.
+func (s *Server) Process(emu Emulator) {
+	for {
+		select {
+		case call := <-s.calls:
+			call(emu)
+		default:
+			return
+		}
+	}
+}
+
+// call runs the function on the emulator goroutine and waits for it to finish.
+func (s *Server) call(fn func(emu Emulator)) error {
+	done := make(chan struct{})
+
+	select {
+	case s.calls <- func(emu Emulator) { fn(emu); close(done) }:
+		<-done
+		return nil
+	case <-time.After(callTimeout):
+		return errTimeout
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// handle checks the method and decodes the JSON body of the POST requests, if
+// any. The body must be sent as application/json, which the browsers do not
+// allow the other sites to send without asking first. Returns false if the
+// response has already been written.
+func handle(w http.ResponseWriter, r *http.Request, method string, body any) bool {
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s required", method))
+		return false
+	}
+
+	if body != nil {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, errContentType)
+			return false
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+			return false
+		}
+	}
+
+	return true
+}
+
+// respond writes the result of the call, which fails with the error returned
+// by the emulator, or if the emulator does not pick up the call in time.
+func respond(w http.ResponseWriter, callErr, err error) {
+	switch {
+	case callErr != nil:
+		writeError(w, http.StatusServiceUnavailable, callErr)
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	}
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !handle(w, r, http.MethodGet, nil) {
+		return
+	}
+
+	var status Status
+
+	if err := s.call(func(emu Emulator) { status = emu.Status() }); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !handle(w, r, http.MethodPost, nil) {
+			return
+		}
+
+		respond(w, s.call(func(emu Emulator) { emu.SetPaused(paused) }), nil)
+	}
+}
+
+func (s *Server) handleROM(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Path string `json:"path"`
+	}
+
+	if !handle(w, r, http.MethodPost, &body) {
+		return
+	}
+
+	var err error
+	callErr := s.call(func(emu Emulator) { err = emu.LoadROM(body.Path) })
+	respond(w, callErr, err)
+}
+
+func (s *Server) handleState(load bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Slot int `json:"slot"`
+		}
+
+		if !handle(w, r, http.MethodPost, &body) {
+			return
+		}
+
+		var err error
+
+		callErr := s.call(func(emu Emulator) {
+			if load {
+				err = emu.LoadState(body.Slot)
+			} else {
+				err = emu.SaveState(body.Slot)
+			}
+		})
+
+		respond(w, callErr, err)
+	}
+}
+
+func (s *Server) handleMemory(w http.ResponseWriter, r *http.Request) {
+	if !handle(w, r, http.MethodGet, nil) {
+		return
+	}
+
+	// The address is accepted in decimal, or in hex with the 0x prefix.
+	addr, err := strconv.ParseUint(r.URL.Query().Get("addr"), 0, 16)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid addr: %w", err))
+		return
+	}
+
+	length := 1
+
+	if text := r.URL.Query().Get("length"); text != "" {
+		if length, err = strconv.Atoi(text); err != nil || length < 1 || length > 0x10000 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid length: %q", text))
+			return
+		}
+	}
+
+	var data []uint8
+
+	if err := s.call(func(emu Emulator) { data = emu.ReadMemory(uint16(addr), length) }); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	// Encoded as numbers, as the byte slices would be encoded in base64.
+	values := make([]int, len(data))
+	for i, v := range data {
+		values[i] = int(v)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"addr": addr, "data": values})
+}
+
+func (s *Server) handleButtons(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Buttons []string `json:"buttons"`
+		Frames  int      `json:"frames"`
+	}{Frames: 1}
+
+	if !handle(w, r, http.MethodPost, &body) {
+		return
+	}
+
+	var err error
+	callErr := s.call(func(emu Emulator) { err = emu.PressButtons(body.Buttons, body.Frames) })
+	respond(w, callErr, err)
+}
+
+func (s *Server) handleFrame(w http.ResponseWriter, r *http.Request) {
+	if !handle(w, r, http.MethodGet, nil) {
+		return
+	}
+
+	var img *image.RGBA
+
+	// Only the pixels are copied on the emulator goroutine, the encoding is
+	// left to the request goroutine.
+	callErr := s.call(func(emu Emulator) {
+		pixels, width, height := emu.Frame()
+		img = image.NewRGBA(image.Rect(0, 0, width, height))
+
+		for i, c := range pixels {
+			img.SetRGBA(i%width, i/width, c)
+		}
+	})
+
+	if callErr != nil {
+		writeError(w, http.StatusServiceUnavailable, callErr)
+		return
+	}
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, img); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	_, _ = w.Write(buf.Bytes())
+}
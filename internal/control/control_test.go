@@ -0,0 +1,310 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"image/color"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+type testEmulator struct {
+	paused   bool
+	rom      string
+	saved    int
+	loaded   int
+	buttons  []string
+	frames   int
+	readAddr uint16
+}
+
+func (e *testEmulator) Status() Status {
+	return Status{ROM: "game.nes", Paused: e.paused, Frame: 42}
+}
+
+func (e *testEmulator) SetPaused(paused bool) {
+	e.paused = paused
+}
+
+func (e *testEmulator) LoadROM(filename string) error {
+	if filename == "" {
+		return errors.New("no path")
+	}
+
+	e.rom = filename
+
+	return nil
+}
+
+func (e *testEmulator) SaveState(slot int) error {
+	e.saved = slot
+	return nil
+}
+
+func (e *testEmulator) LoadState(slot int) error {
+	e.loaded = slot
+	return nil
+}
+
+func (e *testEmulator) ReadMemory(addr uint16, length int) []uint8 {
+	e.readAddr = addr
+
+	data := make([]uint8, length)
+	for i := range data {
+		data[i] = uint8(i)
+	}
+
+	return data
+}
+
+func (e *testEmulator) PressButtons(buttons []string, frames int) error {
+	for _, b := range buttons {
+		if b != "a" && b != "start" {
+			return errors.New("unknown button")
+		}
+	}
+
+	e.buttons, e.frames = buttons, frames
+
+	return nil
+}
+
+func (e *testEmulator) Frame() ([]color.RGBA, int, int) {
+	pixels := make([]color.RGBA, 4*2)
+	pixels[5] = color.RGBA{R: 0xFF, A: 0xFF}
+
+	return pixels, 4, 2
+}
+
+const testToken = "secret"
+
+// newTestServer serves the API with the requests processed by the emulator on
+// its own goroutine, the way the game loop does.
+func newTestServer(t *testing.T, emu Emulator) *httptest.Server {
+	ts := httptest.NewUnstartedServer(nil)
+	s := newServer(testToken, ts.Listener.Addr().String())
+	ts.Config.Handler = s.server.Handler
+	ts.Start()
+
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				s.Process(emu)
+			}
+		}
+	}()
+
+	t.Cleanup(func() {
+		ts.Close()
+		close(done)
+	})
+
+	return ts
+}
+
+func request(t *testing.T, ts *httptest.Server, method, path, body string) (*http.Response, map[string]any) {
+	t.Helper()
+
+	return requestWithHeaders(t, ts, method, path, body, nil)
+}
+
+// requestWithHeaders sends the request the way the local tools do, with the
+// token and the JSON body, unless the headers override it.
+func requestWithHeaders(t *testing.T, ts *httptest.Server, method, path, body string, headers map[string]string) (*http.Response, map[string]any) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	for k, v := range headers {
+		if k == "Host" {
+			req.Host = v
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var v map[string]any
+	if resp.Header.Get("Content-Type") == "application/json" {
+		if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return resp, v
+}
+
+func TestServer_Requests(t *testing.T) {
+	emu := &testEmulator{}
+	ts := newTestServer(t, emu)
+
+	tests := map[string]struct {
+		method, path, body string
+		status             int
+	}{
+		"status":         {method: http.MethodGet, path: "/status", status: http.StatusOK},
+		"status post":    {method: http.MethodPost, path: "/status", status: http.StatusMethodNotAllowed},
+		"pause get":      {method: http.MethodGet, path: "/pause", status: http.StatusMethodNotAllowed},
+		"rom":            {method: http.MethodPost, path: "/rom", body: `{"path":"other.nes"}`, status: http.StatusOK},
+		"rom failed":     {method: http.MethodPost, path: "/rom", body: `{}`, status: http.StatusBadRequest},
+		"invalid body":   {method: http.MethodPost, path: "/rom", body: `{`, status: http.StatusBadRequest},
+		"save":           {method: http.MethodPost, path: "/state/save", body: `{"slot":3}`, status: http.StatusOK},
+		"load":           {method: http.MethodPost, path: "/state/load", body: `{"slot":4}`, status: http.StatusOK},
+		"buttons":        {method: http.MethodPost, path: "/buttons", body: `{"buttons":["a","start"],"frames":5}`, status: http.StatusOK},
+		"bad button":     {method: http.MethodPost, path: "/buttons", body: `{"buttons":["turbo"]}`, status: http.StatusBadRequest},
+		"memory":         {method: http.MethodGet, path: "/memory?addr=0x10", status: http.StatusOK},
+		"no addr":        {method: http.MethodGet, path: "/memory", status: http.StatusBadRequest},
+		"invalid addr":   {method: http.MethodGet, path: "/memory?addr=0x10000", status: http.StatusBadRequest},
+		"invalid length": {method: http.MethodGet, path: "/memory?addr=0&length=0", status: http.StatusBadRequest},
+		"long length":    {method: http.MethodGet, path: "/memory?addr=0&length=65537", status: http.StatusBadRequest},
+		"frame":          {method: http.MethodGet, path: "/frame", status: http.StatusOK},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, _ := request(t, ts, tt.method, tt.path, tt.body)
+			testutil.Equal(t, resp.StatusCode, tt.status)
+		})
+	}
+
+	testutil.Equal(t, emu.rom, "other.nes")
+	testutil.Equal(t, emu.saved, 3)
+	testutil.Equal(t, emu.loaded, 4)
+	testutil.Equal(t, strings.Join(emu.buttons, ","), "a,start")
+	testutil.Equal(t, emu.frames, 5)
+}
+
+// The requests the web pages could send to the API are rejected before they
+// reach the emulator.
+func TestServer_Rejected(t *testing.T) {
+	emu := &testEmulator{}
+	ts := newTestServer(t, emu)
+	host := ts.Listener.Addr().String()
+
+	tests := map[string]struct {
+		headers map[string]string
+		status  int
+	}{
+		"no token":          {headers: map[string]string{"Authorization": ""}, status: http.StatusUnauthorized},
+		"wrong token":       {headers: map[string]string{"Authorization": "Bearer wrong"}, status: http.StatusUnauthorized},
+		"token not bearer":  {headers: map[string]string{"Authorization": testToken}, status: http.StatusUnauthorized},
+		"other host":        {headers: map[string]string{"Host": "evil.example:80"}, status: http.StatusForbidden},
+		"other origin":      {headers: map[string]string{"Origin": "http://evil.example"}, status: http.StatusForbidden},
+		"null origin":       {headers: map[string]string{"Origin": "null"}, status: http.StatusForbidden},
+		"https origin":      {headers: map[string]string{"Origin": "https://" + host}, status: http.StatusForbidden},
+		"no content type":   {headers: map[string]string{"Content-Type": ""}, status: http.StatusUnsupportedMediaType},
+		"form content type": {headers: map[string]string{"Content-Type": "text/plain"}, status: http.StatusUnsupportedMediaType},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, _ := requestWithHeaders(t, ts, http.MethodPost, "/rom", `{"path":"other.nes"}`, tt.headers)
+			testutil.Equal(t, resp.StatusCode, tt.status)
+		})
+	}
+
+	testutil.Equal(t, emu.rom, "")
+
+	// The same origin is allowed, as well as the charset in the content type.
+	headers := map[string]string{
+		"Origin":       "http://" + host,
+		"Content-Type": "application/json; charset=utf-8",
+	}
+
+	resp, _ := requestWithHeaders(t, ts, http.MethodPost, "/rom", `{"path":"other.nes"}`, headers)
+	testutil.Equal(t, resp.StatusCode, http.StatusOK)
+	testutil.Equal(t, emu.rom, "other.nes")
+}
+
+func TestListenHosts(t *testing.T) {
+	ln := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 7777}
+	testutil.Equal(t, strings.Join(listenHosts("localhost:7777", ln), ","), "localhost:7777,127.0.0.1:7777,localhost:7777")
+
+	ln = &net.TCPAddr{IP: net.IPv4(192, 168, 0, 2), Port: 7777}
+	testutil.Equal(t, strings.Join(listenHosts("192.168.0.2:7777", ln), ","), "192.168.0.2:7777,192.168.0.2:7777")
+}
+
+func TestServer_Status(t *testing.T) {
+	emu := &testEmulator{}
+	ts := newTestServer(t, emu)
+
+	request(t, ts, http.MethodPost, "/pause", "")
+	_, v := request(t, ts, http.MethodGet, "/status", "")
+
+	testutil.Equal(t, v["rom"], any("game.nes"))
+	testutil.Equal(t, v["paused"], any(true))
+	testutil.Equal(t, v["frame"], any(42.0))
+
+	request(t, ts, http.MethodPost, "/resume", "")
+	testutil.Equal(t, emu.paused, false)
+}
+
+// The memory is returned as numbers, rather than as a base64 string.
+func TestServer_Memory(t *testing.T) {
+	emu := &testEmulator{}
+	ts := newTestServer(t, emu)
+
+	_, v := request(t, ts, http.MethodGet, "/memory?addr=0x6000&length=3", "")
+
+	testutil.Equal(t, emu.readAddr, uint16(0x6000))
+	testutil.Equal(t, v["addr"], any(float64(0x6000)))
+
+	data, _ := v["data"].([]any)
+	testutil.Equal(t, len(data), 3)
+	testutil.Equal(t, data[2], any(2.0))
+}
+
+func TestServer_Frame(t *testing.T) {
+	ts := newTestServer(t, &testEmulator{})
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/frame", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+testToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	testutil.Equal(t, resp.Header.Get("Content-Type"), "image/png")
+
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, img.Bounds().Dx(), 4)
+	testutil.Equal(t, img.Bounds().Dy(), 2)
+
+	r, _, _, _ := img.At(1, 1).RGBA()
+	testutil.Equal(t, r, uint32(0xFFFF))
+}
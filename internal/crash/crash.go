@@ -0,0 +1,152 @@
+// Package crash writes the crash bundles, with everything needed to reproduce
+// and investigate the crash: the save state, the last executed instructions,
+// the ROM hash and the emulator version.
+package crash
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/maxpoletaev/dendy/system"
+)
+
+const (
+	// StateFile is the name of the save state in the bundle, which can be
+	// loaded with -loadstate to get to the moment of the crash.
+	StateFile = "state.save"
+	TraceFile = "trace.txt"
+	InfoFile  = "info.txt"
+)
+
+// bundlePrefix starts the names of the bundle directories.
+const bundlePrefix = "crash-"
+
+// Report is the crash to write into the bundle.
+type Report struct {
+	Panic   any            // the value passed to panic
+	Stack   []byte         // the stack of the panicking goroutine
+	System  *system.System // the crashed system, or nil if there is none yet
+	ROMFile string
+}
+
+// Version returns the version of the emulator from the build info, which is
+// the commit it was built from, if known.
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	version := info.Main.Version
+
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			version += " " + s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				version += " (modified)"
+			}
+		}
+	}
+
+	return version
+}
+
+// WriteBundle writes the crash bundle into a new directory inside dir, named
+// after the time of the crash, and returns its path. The system may be in an
+// inconsistent state after the crash, so the parts that fail to be written are
+// reported in the info file rather than failing the whole bundle.
+func WriteBundle(dir string, r *Report) (string, error) {
+	bundle := filepath.Join(dir, bundlePrefix+time.Now().Format("20060102-150405"))
+
+	if err := os.MkdirAll(bundle, 0755); err != nil {
+		return "", err
+	}
+
+	var (
+		info     bytes.Buffer
+		problems []string
+	)
+
+	fmt.Fprintf(&info, "panic: %v\n\n", r.Panic)
+	fmt.Fprintf(&info, "version: %s\n", Version())
+	fmt.Fprintf(&info, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&info, "time: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&info, "rom: %s\n", r.ROMFile)
+
+	if r.System != nil {
+		rom := r.System.ROM()
+		fmt.Fprintf(&info, "rom crc32: %08X\n", rom.CRC32)
+		fmt.Fprintf(&info, "mapper: %d\n", rom.MapperID)
+		fmt.Fprintf(&info, "frame: %d\n", r.System.FrameCount())
+
+		if err := writeState(bundle, r.System); err != nil {
+			problems = append(problems, fmt.Sprintf("failed to write state: %s", err))
+		}
+
+		if err := writeTrace(bundle, r.System); err != nil {
+			problems = append(problems, fmt.Sprintf("failed to write trace: %s", err))
+		}
+	}
+
+	if len(problems) > 0 {
+		fmt.Fprintf(&info, "\n%s\n", strings.Join(problems, "\n"))
+	}
+
+	fmt.Fprintf(&info, "\n%s", r.Stack)
+
+	if err := os.WriteFile(filepath.Join(bundle, InfoFile), info.Bytes(), 0644); err != nil {
+		return "", err
+	}
+
+	return bundle, nil
+}
+
+// IsBundleState tells whether the path is the save state of a crash bundle.
+func IsBundleState(path string) bool {
+	return filepath.Base(path) == StateFile && strings.HasPrefix(filepath.Base(filepath.Dir(path)), bundlePrefix)
+}
+
+// guard turns the panic in fn into an error, as the crashed system may panic
+// again when it is being saved.
+func guard(fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+
+	return fn()
+}
+
+func writeState(bundle string, nes *system.System) error {
+	return guard(func() error {
+		var buf bytes.Buffer
+
+		if err := nes.WriteStateFile(&buf); err != nil {
+			return err
+		}
+
+		return os.WriteFile(filepath.Join(bundle, StateFile), buf.Bytes(), 0644)
+	})
+}
+
+func writeTrace(bundle string, nes *system.System) error {
+	return guard(func() error {
+		trace := nes.Trace()
+		if len(trace) == 0 {
+			return nil
+		}
+
+		data := strings.Join(trace, "\n") + "\n"
+
+		return os.WriteFile(filepath.Join(bundle, TraceFile), []byte(data), 0644)
+	})
+}
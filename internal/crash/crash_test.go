@@ -0,0 +1,147 @@
+package crash
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+func newTestSystem(t *testing.T) *system.System {
+	t.Helper()
+
+	data := testutil.NewROMFile(0, 1, 1)
+	copy(data.PRG(), []byte{0x4C, 0x00, 0x80}) // JMP $8000
+	data.SetResetVector(0x8000)
+
+	rom, err := ines.NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return system.New(cart, input.NewJoystick(), input.NewJoystick())
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestWriteBundle(t *testing.T) {
+	nes := newTestSystem(t)
+	nes.SetTraceSize(10)
+	nes.Poke(0x0010, 0x42)
+
+	for i := 0; i < 1000; i++ {
+		nes.Tick()
+	}
+
+	bundle, err := WriteBundle(t.TempDir(), &Report{
+		Panic:   "boom",
+		Stack:   []byte("goroutine 1 [running]"),
+		System:  nes,
+		ROMFile: "game.nes",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, IsBundleState(filepath.Join(bundle, StateFile)), true)
+
+	info := readFile(t, filepath.Join(bundle, InfoFile))
+	testutil.Equal(t, strings.HasPrefix(info, "panic: boom\n"), true)
+	testutil.Equal(t, strings.Contains(info, "rom: game.nes\n"), true)
+	testutil.Equal(t, strings.Contains(info, "mapper: 0\n"), true)
+	testutil.Equal(t, strings.HasSuffix(info, "\ngoroutine 1 [running]"), true)
+
+	trace := strings.Split(strings.TrimSpace(readFile(t, filepath.Join(bundle, TraceFile))), "\n")
+	testutil.Equal(t, len(trace), 10)
+	testutil.Equal(t, strings.HasPrefix(trace[0], "8000  4C 00 80  JMP $8000"), true)
+
+	// The state gets the other system to the moment of the crash.
+	loaded := newTestSystem(t)
+
+	state := readFile(t, filepath.Join(bundle, StateFile))
+	if err := loaded.ReadStateFile(bytes.NewReader([]byte(state))); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, loaded.Peek(0x0010), 0x42)
+	testutil.Equal(t, loaded.FrameCount(), nes.FrameCount())
+}
+
+// The crash before the system is created only has the info file.
+func TestWriteBundle_NoSystem(t *testing.T) {
+	bundle, err := WriteBundle(t.TempDir(), &Report{Panic: "boom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, len(entries), 1)
+	testutil.Equal(t, entries[0].Name(), InfoFile)
+}
+
+// The system without the trace has no trace file.
+func TestWriteBundle_NoTrace(t *testing.T) {
+	bundle, err := WriteBundle(t.TempDir(), &Report{Panic: "boom", System: newTestSystem(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(filepath.Join(bundle, TraceFile))
+	testutil.Equal(t, os.IsNotExist(err), true)
+
+	_, err = os.Stat(filepath.Join(bundle, StateFile))
+	testutil.Equal(t, err, nil)
+}
+
+func TestGuard(t *testing.T) {
+	err := guard(func() error {
+		panic("again")
+	})
+
+	testutil.Equal(t, err.Error(), "panic: again")
+}
+
+func TestIsBundleState(t *testing.T) {
+	tests := map[string]struct {
+		path string
+		want bool
+	}{
+		"bundle state":      {path: "saves/crash-20240101-120000/state.save", want: true},
+		"relative bundle":   {path: "crash-20240101-120000/state.save", want: true},
+		"save file":         {path: "saves/game.save", want: false},
+		"other bundle file": {path: "saves/crash-20240101-120000/info.txt", want: false},
+		"not in a bundle":   {path: "saves/state.save", want: false},
+		"slot number":       {path: "1", want: false},
+		"empty":             {path: "", want: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			testutil.Equal(t, IsBundleState(filepath.FromSlash(tt.path)), tt.want)
+		})
+	}
+}
@@ -2,8 +2,21 @@ package ringbuf
 
 import "fmt"
 
+// FullPolicy is what PushBack does when there is no room for the items.
+type FullPolicy uint8
+
+const (
+	// PolicyPanic panics, for the buffers that are never expected to be full.
+	PolicyPanic FullPolicy = iota
+	// PolicyOverwrite drops the oldest items to make room for the new ones.
+	PolicyOverwrite
+	// PolicyGrow doubles the capacity until the new items fit.
+	PolicyGrow
+)
+
 type Buffer[T any] struct {
 	EmptyValue T
+	Policy     FullPolicy
 
 	items    []T
 	capacity int
@@ -24,39 +37,65 @@ func (q *Buffer[T]) Grow(capacity int) {
 		panic("new capacity is smaller than current capacity")
 	}
 
-	newItems := make([]T, capacity)
-	for i := 0; i < q.length; i++ {
-		newItems[i] = q.items[(q.head+i)%len(q.items)]
+	q.Resize(capacity)
+}
+
+// Resize changes the capacity of the buffer. If there are more items than the
+// new capacity, the oldest ones are dropped.
+func (q *Buffer[T]) Resize(capacity int) {
+	if capacity <= 0 {
+		panic(fmt.Errorf("invalid capacity: %d", capacity))
+	}
+
+	if q.length > capacity {
+		q.TruncFront(q.length - capacity)
 	}
 
+	newItems := make([]T, capacity)
+	first, second := q.Slices()
+	copy(newItems[copy(newItems, first):], second)
+
 	q.items = newItems
 	q.capacity = capacity
 	q.head = 0
-	q.tail = q.length
+	q.tail = q.length % capacity
 }
 
+// PushBack adds the items to the back of the buffer. What happens when there is
+// no room for them depends on the Policy.
 func (q *Buffer[T]) PushBack(items ...T) {
-	if q.length+len(items) > q.capacity {
-		panic("queue is full")
-	}
+	if free := q.capacity - q.length; len(items) > free {
+		switch q.Policy {
+		case PolicyOverwrite:
+			q.PushBackEvict(items...)
+			return
+		case PolicyGrow:
+			capacity := max(q.capacity, 1)
+			for capacity < q.length+len(items) {
+				capacity *= 2
+			}
 
-	for _, item := range items {
-		q.items[q.tail] = item
-		q.tail = (q.tail + 1) % len(q.items)
-		q.length++
+			q.Resize(capacity)
+		default:
+			panic("queue is full")
+		}
 	}
+
+	q.push(items)
 }
 
+// PushBackEvict adds the items to the back of the buffer, dropping the oldest
+// ones to make room, regardless of the Policy.
 func (q *Buffer[T]) PushBackEvict(items ...T) {
 	if len(items) > q.capacity {
 		panic("queue is too small")
 	}
 
-	if len(items) > q.capacity-q.length {
-		q.TruncFront(len(items) - (q.capacity - q.length))
+	if free := q.capacity - q.length; len(items) > free {
+		q.TruncFront(len(items) - free)
 	}
 
-	q.PushBack(items...)
+	q.push(items)
 }
 
 func (q *Buffer[T]) PopFront() T {
@@ -147,6 +186,25 @@ func (q *Buffer[T]) Set(idx int, item T) {
 	q.items[(q.head+idx)%len(q.items)] = item
 }
 
+func (q *Buffer[T]) push(items []T) {
+	for _, item := range items {
+		q.items[q.tail] = item
+		q.tail = (q.tail + 1) % len(q.items)
+		q.length++
+	}
+}
+
+// Slices returns the items from the front to the back without copying them, as
+// two parts of the underlying array. The second one is only non-empty when the
+// items wrap around its end. Both are only valid until the buffer is modified.
+func (q *Buffer[T]) Slices() (first, second []T) {
+	if q.head+q.length <= len(q.items) {
+		return q.items[q.head : q.head+q.length], nil
+	}
+
+	return q.items[q.head:], q.items[:q.tail]
+}
+
 func (q *Buffer[T]) Len() int {
 	return q.length
 }
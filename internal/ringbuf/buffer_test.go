@@ -1,6 +1,7 @@
 package ringbuf
 
 import (
+	"runtime"
 	"testing"
 
 	"github.com/maxpoletaev/dendy/internal/testutil"
@@ -78,3 +79,119 @@ func TestBuffer_TruncFront(t *testing.T) {
 	testutil.Equal(t, q.At(0), 6)
 	testutil.Equal(t, q.At(1), 7)
 }
+
+func TestBuffer_PolicyOverwrite(t *testing.T) {
+	q := New[int](3)
+	q.Policy = PolicyOverwrite
+
+	q.PushBack(1, 2, 3)
+	q.PushBack(4, 5)
+
+	testutil.Equal(t, q.Len(), 3)
+	testutil.Equal(t, q.At(0), 3)
+	testutil.Equal(t, q.At(1), 4)
+	testutil.Equal(t, q.At(2), 5)
+
+	testutil.Panic(t, func() {
+		q.PushBack(6, 7, 8, 9) // more than the capacity
+	})
+}
+
+func TestBuffer_PolicyGrow(t *testing.T) {
+	q := New[int](2)
+	q.Policy = PolicyGrow
+
+	q.PushBack(1)
+	q.PopFront()
+	q.PushBack(2, 3, 4, 5, 6)
+
+	testutil.Equal(t, q.Cap(), 8)
+	testutil.Equal(t, q.Len(), 5)
+
+	for i := 0; i < 5; i++ {
+		testutil.Equal(t, q.At(i), i+2)
+	}
+}
+
+func TestBuffer_Resize(t *testing.T) {
+	q := New[int](4)
+	q.PushBack(1, 2, 3)
+	q.PopFront()
+	q.PushBack(4, 5) // wraps around
+
+	q.Resize(2)
+	testutil.Equal(t, q.Cap(), 2)
+	testutil.Equal(t, q.Front(), 4)
+	testutil.Equal(t, q.Back(), 5)
+
+	q.Resize(3)
+	q.PushBack(6)
+	testutil.Equal(t, q.Len(), 3)
+	testutil.Equal(t, q.Front(), 4)
+	testutil.Equal(t, q.Back(), 6)
+}
+
+func TestBuffer_Slices(t *testing.T) {
+	q := New[int](4)
+	q.PushBack(1, 2, 3)
+
+	first, second := q.Slices()
+	testutil.Equal(t, len(first), 3)
+	testutil.Equal(t, len(second), 0)
+
+	q.PopFront()
+	q.PushBack(4, 5) // wraps around
+
+	first, second = q.Slices()
+	testutil.Equal(t, len(first), 3)
+	testutil.Equal(t, len(second), 1)
+	testutil.Equal(t, first[0], 2)
+	testutil.Equal(t, second[0], 5)
+}
+
+func TestSPSC_Concurrent(t *testing.T) {
+	const total = 10000
+
+	q := NewSPSC[int](64)
+	done := make(chan []int)
+
+	go func() {
+		var got []int
+		buf := make([]int, 10)
+
+		for len(got) < total {
+			n := q.Pop(buf)
+			if n == 0 {
+				runtime.Gosched()
+			}
+
+			got = append(got, buf[:n]...)
+		}
+
+		done <- got
+	}()
+
+	items := make([]int, total)
+	for i := range items {
+		items[i] = i
+	}
+
+	for pushed := 0; pushed < total; {
+		n := q.Push(items[pushed:min(pushed+7, total)])
+		if n == 0 {
+			runtime.Gosched()
+		}
+
+		pushed += n
+	}
+
+	got := <-done
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("item %d is %d", i, v)
+		}
+	}
+
+	testutil.Equal(t, q.Len(), 0)
+	testutil.Equal(t, q.Push(items[:100]), 64)
+}
@@ -0,0 +1,68 @@
+package ringbuf
+
+import "sync/atomic"
+
+// SPSC is a fixed-size ring buffer for exactly one goroutine pushing and one
+// goroutine popping the items at the same time, without locking. Each side only
+// moves its own position, and reads the position of the other one, so neither
+// of them ever waits for the other.
+type SPSC[T any] struct {
+	items []T
+	head  atomic.Uint64 // total items popped, only moved by the consumer
+	tail  atomic.Uint64 // total items pushed, only moved by the producer
+}
+
+func NewSPSC[T any](capacity int) *SPSC[T] {
+	return &SPSC[T]{
+		items: make([]T, capacity),
+	}
+}
+
+// Push adds as many of the items as there is room for, and returns how many
+// were added. Must only be called by the producer.
+func (q *SPSC[T]) Push(items []T) int {
+	tail := q.tail.Load()
+	free := len(q.items) - int(tail-q.head.Load())
+	n := min(free, len(items))
+
+	for i := 0; i < n; i++ {
+		q.items[(tail+uint64(i))%uint64(len(q.items))] = items[i]
+	}
+
+	// Publishing the new tail after the items are written makes them visible
+	// to the consumer along with it.
+	q.tail.Store(tail + uint64(n))
+
+	return n
+}
+
+// Pop moves as many items as there are, up to the length of dst, and returns
+// how many were moved. Must only be called by the consumer.
+func (q *SPSC[T]) Pop(dst []T) int {
+	head := q.head.Load()
+	n := min(int(q.tail.Load()-head), len(dst))
+
+	for i := 0; i < n; i++ {
+		dst[i] = q.items[(head+uint64(i))%uint64(len(q.items))]
+	}
+
+	q.head.Store(head + uint64(n))
+
+	return n
+}
+
+// Discard drops all the items. Must only be called by the consumer.
+func (q *SPSC[T]) Discard() {
+	q.head.Store(q.tail.Load())
+}
+
+// Len returns the number of items in the buffer, which the other side may
+// change right after.
+func (q *SPSC[T]) Len() int {
+	head := q.head.Load()
+	return int(q.tail.Load() - head)
+}
+
+func (q *SPSC[T]) Cap() int {
+	return len(q.items)
+}
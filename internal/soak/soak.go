@@ -0,0 +1,140 @@
+// Package soak runs the console for thousands of frames with random input and
+// checks that the emulation holds up: nothing panics, the frames keep coming,
+// and the state saved at any point loads back the same. It is used by the fuzz
+// tests and the soak subcommand, with the real games or the synthesized ones.
+package soak
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+
+	"github.com/maxpoletaev/dendy/console"
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+// Options control the run.
+type Options struct {
+	Frames     int   // to run
+	Seed       int64 // of the random input
+	StateEvery int   // frames between the save state round trips, 0 to skip them
+	ResetEvery int   // average frames between the resets, 0 to never reset
+}
+
+// Failure is the invariant broken during the run.
+type Failure struct {
+	Frame   int
+	Message string
+	Stack   []byte // where it has panicked, nil for the other failures
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("frame %d: %s", f.Frame, f.Message)
+}
+
+// Run runs the game from the iNES ROM data with the random input, returning
+// the *Failure for the first invariant broken. The input changes every few
+// frames, the way a player mashing the buttons would press them.
+func Run(data []byte, opts Options) (err error) {
+	c, err := console.New(data)
+	if err != nil {
+		return err
+	}
+
+	var (
+		rnd   = rand.New(rand.NewSource(opts.Seed))
+		start = c.FrameCount()
+		run   uint64 // frames since the start or the reset
+		frame int
+	)
+
+	defer func() {
+		if v := recover(); v != nil {
+			err = &Failure{Frame: frame, Message: fmt.Sprintf("panic: %v", v), Stack: debug.Stack()}
+		}
+	}()
+
+	for frame = 1; frame <= opts.Frames; frame++ {
+		if rnd.Intn(8) == 0 {
+			c.SetButtons(1, console.Button(rnd.Intn(256)))
+			c.SetButtons(2, console.Button(rnd.Intn(256)))
+		}
+
+		if opts.ResetEvery > 0 && rnd.Intn(opts.ResetEvery) == 0 {
+			c.Reset()
+			start, run = c.FrameCount(), 0
+		}
+
+		c.RunFrame()
+		run++
+
+		// The counter is made from the CPU cycles, and the frames are not all
+		// of the same length, so it may be one frame off, but not more.
+		if got := c.FrameCount() - start; got+1 < run || got > run+1 {
+			return &Failure{Frame: frame, Message: fmt.Sprintf("frame counter advanced by %d in %d frames", got, run)}
+		}
+
+		if opts.StateEvery > 0 && frame%opts.StateEvery == 0 {
+			if msg := checkState(c, data); msg != "" {
+				return &Failure{Frame: frame, Message: msg}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkState saves the state, loads it into another console with the same game
+// and saves it again there. Both states must be the same, byte for byte, or
+// some of the state is not saved or not loaded back.
+func checkState(c *console.Console, data []byte) string {
+	saved, err := saveState(c)
+	if err != nil {
+		return fmt.Sprintf("failed to save state: %s", err)
+	}
+
+	loaded, err := console.New(data)
+	if err != nil {
+		return fmt.Sprintf("failed to create console: %s", err)
+	}
+
+	r := binario.NewReader(bytes.NewReader(saved), binary.LittleEndian)
+	if err := loaded.System().LoadState(r); err != nil {
+		return fmt.Sprintf("failed to load state: %s", err)
+	}
+
+	resaved, err := saveState(loaded)
+	if err != nil {
+		return fmt.Sprintf("failed to save loaded state: %s", err)
+	}
+
+	if !bytes.Equal(saved, resaved) {
+		return fmt.Sprintf("loaded state differs from the saved one at byte %d", mismatch(saved, resaved))
+	}
+
+	return ""
+}
+
+// saveState saves the in-memory state, unlike the state files, which are also
+// stamped with the time they are saved at.
+func saveState(c *console.Console) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := c.System().SaveState(binario.NewWriter(&buf, binary.LittleEndian)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func mismatch(a, b []byte) int {
+	for i := 0; i < min(len(a), len(b)); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+
+	return min(len(a), len(b))
+}
@@ -0,0 +1,35 @@
+package soak
+
+import (
+	"log"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/loglevel"
+)
+
+func FuzzSynthROM(f *testing.F) {
+	log.SetOutput(loglevel.New(os.Stderr, loglevel.LevelNone))
+	f.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	for _, id := range SynthMappers {
+		f.Add(id, int64(1))
+	}
+
+	f.Fuzz(func(t *testing.T, mapperID uint8, seed int64) {
+		if !slices.Contains(SynthMappers, mapperID) {
+			t.Skip("unsupported mapper")
+		}
+
+		opts := Options{Frames: 120, Seed: seed, StateEvery: 10, ResetEvery: 100}
+
+		if err := Run(SynthROM(mapperID, seed), opts); err != nil {
+			if f, ok := err.(*Failure); ok && f.Stack != nil {
+				t.Log(string(f.Stack))
+			}
+
+			t.Fatal(err)
+		}
+	})
+}
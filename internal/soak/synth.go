@@ -0,0 +1,138 @@
+package soak
+
+import (
+	"math/rand"
+)
+
+// SynthMappers are the mappers SynthROM makes the games for, which are all the
+// mappers supported by the ines package, but the FDS, which runs the BIOS.
+var SynthMappers = []uint8{0, 1, 2, 3, 4, 5, 7, 19, 24, 26, 30, 69}
+
+const (
+	prgBankSize  = 0x4000
+	chrBankSize  = 0x2000
+	codeBankSize = 0x2000
+
+	// synthWrites is the number of the random register accesses in the loop.
+	synthWrites = 300
+)
+
+// SynthROM creates the game for the mapper, with the program made from the seed
+// that accesses the registers of the PPU, the APU, the controllers and the
+// mapper with the random values in a loop. The CHR-ROM, if any, is filled with
+// the random tiles.
+//
+// The program is copied into every 8KB of PRG at $E000, where it runs from,
+// so that the mapper can switch the banks in any way without breaking it, as
+// every bank has the same code. The interrupts return right away.
+func SynthROM(mapperID uint8, seed int64) []byte {
+	rnd := rand.New(rand.NewSource(seed))
+
+	prgBanks, chrBanks := 8, 0
+
+	switch mapperID {
+	case 0:
+		prgBanks, chrBanks = 1+rnd.Intn(2), 1
+	case 3:
+		prgBanks, chrBanks = 2, 4
+	case 1, 4, 19, 24, 26, 69:
+		chrBanks = 8 * rnd.Intn(2) // CHR-RAM or CHR-ROM
+	}
+
+	data := make([]byte, 16, 16+prgBanks*prgBankSize+chrBanks*chrBankSize)
+	copy(data, "NES\x1a")
+	data[4], data[5] = byte(prgBanks), byte(chrBanks)
+	data[6] = mapperID<<4 | byte(rnd.Intn(2)) // the mirroring
+	data[7] = mapperID & 0xF0
+
+	if mapperID == 30 {
+		data[6] |= byte(rnd.Intn(2))<<1 | byte(rnd.Intn(2))<<3 // flashable, one-screen
+	}
+
+	code := synthCode(rnd, mapperID)
+
+	for i := 0; i < prgBanks*prgBankSize/codeBankSize; i++ {
+		data = append(data, code...)
+	}
+
+	for i := 0; i < chrBanks*chrBankSize; i++ {
+		data = append(data, byte(rnd.Intn(256)))
+	}
+
+	return data
+}
+
+// synthCode makes the 8KB bank with the program at the start, the RTI at $FFF0
+// for the interrupts, and the vectors.
+func synthCode(rnd *rand.Rand, mapperID uint8) []byte {
+	const (
+		start    = 0xE000
+		loop     = start + 5
+		handler  = 0xFFF0
+		vectors  = 0x1FFA
+		rtiIndex = handler - start
+	)
+
+	code := []byte{
+		0x78,       // SEI
+		0xD8,       // CLD
+		0xA2, 0xFF, // LDX #$FF
+		0x9A, // TXS
+	}
+
+	for i := 0; i < synthWrites; i++ {
+		addr := synthAddr(rnd, mapperID)
+
+		if rnd.Intn(8) == 0 {
+			code = append(code, 0xAD, byte(addr), byte(addr>>8)) // LDA addr
+		} else {
+			code = append(code,
+				0xA9, byte(rnd.Intn(256)), // LDA #value
+				0x8D, byte(addr), byte(addr>>8), // STA addr
+			)
+		}
+	}
+
+	code = append(code, 0x4C, byte(loop&0xFF), byte(loop>>8)) // JMP loop
+
+	bank := make([]byte, codeBankSize)
+	copy(bank, code)
+	bank[rtiIndex] = 0x40 // RTI
+
+	for i := 0; i < 3; i++ {
+		vector := uint16(handler)
+		if i == 1 {
+			vector = start // reset
+		}
+
+		bank[vectors+i*2] = byte(vector)
+		bank[vectors+i*2+1] = byte(vector >> 8)
+	}
+
+	return bank
+}
+
+// synthAddr picks the address of the register to access, mostly those of the
+// mapper and the PPU, where most of the bugs are. The registers of MMC5 are at
+// $5100-$5206, and its ExRAM at $5C00-$5FFF. Namco 163 has the audio and the
+// IRQ registers at $4800-$5FFF.
+func synthAddr(rnd *rand.Rand, mapperID uint8) uint16 {
+	switch n := rnd.Intn(10); {
+	case n < 4 && mapperID == 5:
+		if rnd.Intn(4) == 0 {
+			return 0x5C00 + uint16(rnd.Intn(0x400))
+		}
+
+		return 0x5100 + uint16(rnd.Intn(0x107))
+	case n < 4 && mapperID == 19 && rnd.Intn(4) == 0:
+		return 0x4800 + uint16(rnd.Intn(0x1800))
+	case n < 4:
+		return 0x8000 + uint16(rnd.Intn(0x8000)) // the mapper
+	case n < 7:
+		return 0x2000 + uint16(rnd.Intn(8)) // the PPU
+	case n < 9:
+		return 0x4000 + uint16(rnd.Intn(0x18)) // the APU, the DMA, the controllers
+	default:
+		return 0x6000 + uint16(rnd.Intn(0x2000)) // PRG-RAM
+	}
+}
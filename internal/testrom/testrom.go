@@ -0,0 +1,176 @@
+// Package testrom runs the test ROMs against the pass criteria, for the test
+// harness and the testsuite subcommand.
+package testrom
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strings"
+
+	"github.com/maxpoletaev/dendy/console"
+)
+
+// Status codes written to $6000 by the test ROMs. The rest are the results,
+// where zero means the test has passed.
+const (
+	statusRunning    = 0x80
+	statusResetAfter = 0x81
+)
+
+// resetDelay is the number of frames before pressing the reset requested by
+// the ROM, as it must be pressed no earlier than 100ms after the request.
+const resetDelay = 10
+
+// statusSignature at $6001 tells that the ROM reports its status at $6000.
+var statusSignature = []uint8{0xDE, 0xB0, 0x61}
+
+// MemoryByte is the value expected at the address in the CPU address space.
+type MemoryByte struct {
+	Addr  uint16 `toml:"addr"`
+	Value uint8  `toml:"value"`
+}
+
+// Criteria are what the ROM must do to pass. All of the criteria given must be
+// met at the same frame, before the timeout.
+type Criteria struct {
+	// Status expects the result reported at $6000, the way the blargg's tests
+	// do. Any other result than zero fails the test right away.
+	Status bool `toml:"status"`
+	// Frame is the checksum of the frame, as returned by FrameChecksum.
+	Frame string `toml:"frame"`
+	// Memory are the bytes expected in the memory.
+	Memory []MemoryByte `toml:"memory"`
+	// Timeout is the number of frames to wait for the criteria to be met.
+	Timeout int `toml:"timeout"`
+}
+
+// Result is the outcome of running the ROM.
+type Result struct {
+	Passed  bool
+	Frames  int    // until passed or failed
+	Message string // why the test has failed, or the text reported by the ROM
+}
+
+// FrameChecksum returns the CRC32 of the frame pixels, as "crc32:xxxxxxxx".
+func FrameChecksum(c *console.Console) string {
+	h := crc32.NewIEEE()
+
+	for _, px := range c.Frame() {
+		_, _ = h.Write([]byte{px.R, px.G, px.B})
+	}
+
+	return fmt.Sprintf("crc32:%08x", h.Sum32())
+}
+
+// StatusText returns the message the ROM has written after the signature.
+func StatusText(c *console.Console) string {
+	var text []byte
+
+	for addr := uint16(0x6004); addr < 0x7000; addr++ {
+		ch := c.ReadMemory(addr)
+		if ch == 0 {
+			break
+		}
+
+		text = append(text, ch)
+	}
+
+	return strings.TrimSpace(string(text))
+}
+
+func hasSignature(c *console.Console) bool {
+	for i, b := range statusSignature {
+		if c.ReadMemory(0x6001+uint16(i)) != b {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Run runs the ROM until the criteria are met, it reports a failure, or the
+// timeout is reached. The ROM asking for the reset gets it after a few frames.
+func Run(c *console.Console, crit Criteria) Result {
+	resetAt := -1
+
+	// The status asking for the reset stays in the memory after the reset, until
+	// the ROM starts over and overwrites it, which must not ask for another one.
+	resetDone := false
+
+	for frame := 1; frame <= crit.Timeout; frame++ {
+		c.RunFrame()
+
+		if frame == resetAt {
+			c.Reset()
+			resetAt = -1
+			resetDone = true
+		}
+
+		passed := true
+
+		if crit.Status {
+			status, ok := c.ReadMemory(0x6000), hasSignature(c)
+			if status != statusResetAfter {
+				resetDone = false
+			}
+
+			switch {
+			case !ok, status == statusRunning:
+				passed = false
+			case status == statusResetAfter:
+				if resetAt < 0 && !resetDone {
+					resetAt = frame + resetDelay
+				}
+
+				passed = false
+			case status != 0:
+				return Result{Frames: frame, Message: fmt.Sprintf("failed with code %d: %s", status, StatusText(c))}
+			}
+		}
+
+		for _, m := range crit.Memory {
+			if c.ReadMemory(m.Addr) != m.Value {
+				passed = false
+			}
+		}
+
+		if passed && crit.Frame != "" {
+			passed = FrameChecksum(c) == crit.Frame
+		}
+
+		if passed {
+			var message string
+			if crit.Status {
+				message = StatusText(c)
+			}
+
+			return Result{Passed: true, Frames: frame, Message: message}
+		}
+	}
+
+	return Result{Frames: crit.Timeout, Message: timeoutMessage(c, crit)}
+}
+
+// timeoutMessage describes the criteria that have not been met by the time
+// the timeout is reached.
+func timeoutMessage(c *console.Console, crit Criteria) string {
+	var failed []string
+
+	if crit.Status {
+		failed = append(failed, fmt.Sprintf("status $%02X: %s", c.ReadMemory(0x6000), StatusText(c)))
+	}
+
+	for _, m := range crit.Memory {
+		if value := c.ReadMemory(m.Addr); value != m.Value {
+			failed = append(failed, fmt.Sprintf("$%04X is $%02X, expected $%02X", m.Addr, value, m.Value))
+		}
+	}
+
+	if crit.Frame != "" {
+		if actual := FrameChecksum(c); actual != crit.Frame {
+			failed = append(failed, fmt.Sprintf("frame %s, expected %s", actual, crit.Frame))
+		}
+	}
+
+	return fmt.Sprintf("timed out after %d frames: %s", crit.Timeout, strings.Join(failed, "; "))
+}
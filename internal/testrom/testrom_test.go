@@ -0,0 +1,55 @@
+package testrom
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/console"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// resetProgram asks for the reset on the first boot, counted at $6010 of the
+// PRG-RAM. After the reset, it reports running for about 30 frames, longer
+// than the reset delay, and then passes.
+var resetProgram = []byte{
+	0xEE, 0x10, 0x60, // INC $6010
+	0xA9, 0xDE, 0x8D, 0x01, 0x60, // the signature
+	0xA9, 0xB0, 0x8D, 0x02, 0x60,
+	0xA9, 0x61, 0x8D, 0x03, 0x60,
+	0xAD, 0x10, 0x60, // LDA $6010
+	0xC9, 0x01, // CMP #1
+	0xD0, 0x08, // BNE after_reset
+	0xA9, 0x81, 0x8D, 0x00, 0x60, // the reset is needed
+	0x4C, 0x1E, 0xC0, // JMP *
+	// after_reset:
+	0xA9, 0x80, 0x8D, 0x00, 0x60, // running
+	0xA9, 0x03, 0x85, 0x02, // LDA #3, STA $02
+	0xA2, 0x00, // LDX #0
+	0xA0, 0x00, // LDY #0
+	0x88,       // DEY
+	0xD0, 0xFD, // BNE DEY
+	0xCA,       // DEX
+	0xD0, 0xFA, // BNE DEY
+	0xC6, 0x02, // DEC $02
+	0xD0, 0xF2, // BNE LDX
+	0xA9, 0x00, 0x8D, 0x00, 0x60, // passed
+	0x4C, 0x3D, 0xC0, // JMP *
+}
+
+// The ROM is reset once, even though it keeps the status asking for the reset
+// in the memory until it starts over.
+func TestRun_Reset(t *testing.T) {
+	data := testutil.NewROMFile(1, 1, 1) // MMC1, for the PRG-RAM
+	copy(data.PRG(), resetProgram)
+	data.SetResetVector(0xC000)
+
+	c, err := console.New(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := Run(c, Criteria{Status: true, Timeout: 200})
+
+	testutil.Equal(t, r.Passed, true)
+	testutil.Equal(t, c.ReadMemory(0x6010), uint8(2))
+	testutil.Equal(t, r.Frames > resetDelay+30, true)
+}
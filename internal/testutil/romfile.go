@@ -0,0 +1,33 @@
+package testutil
+
+// ROMFile is the iNES 1.0 file the tests make their games of.
+type ROMFile []byte
+
+// NewROMFile creates the file of the mapper with the given number of 16KB PRG
+// banks and 8KB CHR banks, none of CHR meaning CHR-RAM. Both are filled with
+// zeros, for the test to put its program and tiles into.
+func NewROMFile(mapperID uint8, prgBanks, chrBanks int) ROMFile {
+	f := make(ROMFile, 16+prgBanks*0x4000+chrBanks*0x2000)
+	copy(f, "NES\x1a")
+	f[4], f[5] = byte(prgBanks), byte(chrBanks)
+	f[6] = mapperID << 4
+	f[7] = mapperID & 0xF0
+
+	return f
+}
+
+// PRG returns the PRG-ROM of the file.
+func (f ROMFile) PRG() []byte {
+	return f[16 : 16+int(f[4])*0x4000]
+}
+
+// CHR returns the CHR-ROM of the file, empty for CHR-RAM.
+func (f ROMFile) CHR() []byte {
+	return f[16+int(f[4])*0x4000:]
+}
+
+// SetResetVector points the reset vector at the end of PRG to the address.
+func (f ROMFile) SetResetVector(addr uint16) {
+	prg := f.PRG()
+	prg[len(prg)-4], prg[len(prg)-3] = byte(addr), byte(addr>>8)
+}
@@ -8,16 +8,7 @@ import (
 // SendInitialState is used by the server to send the initial state to the client.
 func (np *Netplay) SendInitialState() {
 	np.game.Init(nil)
-	cp := np.game.syncState
-	payload := np.pool.Buffer(cp.state.Len())
-	copy(payload.Data, cp.state.Bytes())
-
-	np.sendMsg(Message{
-		Generation: np.game.Gen(),
-		Type:       MsgTypeReset,
-		Frame:      cp.frame,
-		Buffer:     payload,
-	})
+	np.sendState(np.game.syncState)
 }
 
 // SendReset restarts the game on both sides.
@@ -29,27 +20,27 @@ func (np *Netplay) SendReset() {
 	np.game.Reset()
 	np.game.Init(nil)
 
-	cp := np.game.syncState
-	payload := np.pool.Buffer(cp.state.Len())
-	copy(payload.Data, cp.state.Bytes())
-
-	np.sendMsg(Message{
-		Generation: np.game.Gen(),
-		Type:       MsgTypeReset,
-		Frame:      cp.frame,
-		Buffer:     payload,
-	})
+	np.sendState(np.game.syncState)
 }
 
+// SendResync sends the current state to the client, so the host must be the
+// one calling it.
 func (np *Netplay) SendResync() {
 	if np.game.Sleeping() {
 		return
 	}
 
 	np.game.Init(nil)
-	cp := np.game.syncState
-	payload := np.pool.Buffer(cp.state.Len())
-	copy(payload.Data, cp.state.Bytes())
+	np.sendState(np.game.syncState)
+}
+
+// sendState sends the checkpoint to the remote player, preceded by the protocol
+// version and followed by its checksum.
+func (np *Netplay) sendState(cp *checkpoint) {
+	payload := np.pool.Buffer(2 + cp.state.Len() + 4)
+	byteOrder.PutUint16(payload.Data, ProtocolVersion)
+	n := 2 + copy(payload.Data[2:], cp.state.Bytes())
+	byteOrder.PutUint32(payload.Data[n:], cp.crc32)
 
 	np.sendMsg(Message{
 		Generation: np.game.Gen(),
@@ -65,7 +56,7 @@ func (np *Netplay) SendButtons(buttons uint8) {
 		return
 	}
 
-	if np.game.Frame() == 0 {
+	if np.game.Frame() == 0 || np.game.Paused() {
 		return
 	}
 
@@ -82,6 +73,33 @@ func (np *Netplay) SendButtons(buttons uint8) {
 	np.game.HandleLocalInput(buttons)
 }
 
+// SendTogglePause pauses or resumes the game on both sides. Since the emulators
+// may stop at slightly different frames, the game is resynchronized on resume
+// by the host, whichever side resumes it.
+func (np *Netplay) SendTogglePause() {
+	if np.game.Sleeping() {
+		return
+	}
+
+	paused := !np.game.Paused()
+	np.game.SetPaused(paused)
+
+	buf := np.pool.Buffer(1)
+	if paused {
+		buf.Data[0] = 1
+	}
+
+	np.sendMsg(Message{
+		Type:       MsgTypePause,
+		Generation: np.game.Gen(),
+		Buffer:     buf,
+	})
+
+	if !paused && np.isHost {
+		np.SendResync()
+	}
+}
+
 func (np *Netplay) SendPing() {
 	if np.game.Sleeping() {
 		return
@@ -104,6 +122,11 @@ func (np *Netplay) SendBye() {
 		return
 	}
 
+	np.sayBye()
+}
+
+// sayBye sends the bye message and closes the connection once it is sent.
+func (np *Netplay) sayBye() {
 	np.sendMsg(Message{
 		Type:       MsgTypeBye,
 		Generation: np.game.Gen(),
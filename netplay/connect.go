@@ -3,25 +3,30 @@ package netplay
 import (
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/xtaci/kcp-go"
 )
 
-func Listen(protocol string, lAddr string, game *Game) (*Netplay, net.Addr, error) {
+// Listen waits for the client to connect. With a non-zero timeout, it gives up
+// if no client has connected within it.
+func Listen(protocol string, lAddr string, timeout time.Duration, game *Game) (*Netplay, net.Addr, error) {
 	switch protocol {
 	case "tcp":
-		return listenTCP(game, lAddr)
+		return listenTCP(game, lAddr, timeout)
 	case "udp":
-		return listenUDP(game, lAddr)
+		return listenUDP(game, lAddr, timeout)
 	default:
 		return nil, nil, fmt.Errorf("unknown protocol: %s", protocol)
 	}
 }
 
-func Connect(protocol string, rAddr, lAddr string, game *Game) (*Netplay, net.Addr, error) {
+// Connect connects to the host. The timeout only applies to TCP, since there is
+// no handshake in UDP to wait for.
+func Connect(protocol string, rAddr, lAddr string, timeout time.Duration, game *Game) (*Netplay, net.Addr, error) {
 	switch protocol {
 	case "tcp":
-		return connectTCP(game, rAddr)
+		return connectTCP(game, rAddr, timeout)
 	case "udp":
 		return connectUDP(game, lAddr, rAddr)
 	default:
@@ -29,15 +34,41 @@ func Connect(protocol string, rAddr, lAddr string, game *Game) (*Netplay, net.Ad
 	}
 }
 
-func listenTCP(game *Game, addr string) (*Netplay, net.Addr, error) {
+func deadline(timeout time.Duration) time.Time {
+	if timeout == 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(timeout)
+}
+
+// acceptError tells the timeout apart from the other errors by the time, as kcp
+// does not expose its timeout error.
+func acceptError(err error, timeout time.Duration, dl time.Time) error {
+	if !dl.IsZero() && !time.Now().Before(dl) {
+		return fmt.Errorf("no client connected within %s", timeout)
+	}
+
+	return fmt.Errorf("failed to accept connection: %v", err)
+}
+
+func listenTCP(game *Game, addr string, timeout time.Duration) (*Netplay, net.Addr, error) {
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
 	}
 
+	dl := deadline(timeout)
+
+	if err := listener.(*net.TCPListener).SetDeadline(dl); err != nil {
+		_ = listener.Close()
+		return nil, nil, err
+	}
+
 	conn, err := listener.Accept()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to accept connection: %v", err)
+		_ = listener.Close()
+		return nil, nil, acceptError(err, timeout, dl)
 	}
 
 	np := newNetplay(game, conn)
@@ -47,15 +78,25 @@ func listenTCP(game *Game, addr string) (*Netplay, net.Addr, error) {
 	return np, conn.RemoteAddr(), nil
 }
 
-func listenUDP(game *Game, addr string) (*Netplay, net.Addr, error) {
+func listenUDP(game *Game, addr string, timeout time.Duration) (*Netplay, net.Addr, error) {
 	listener, err := kcp.Listen(addr)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
 	}
 
+	// The listener owns the socket the session is using, so it is only closed
+	// when no client has connected.
+	dl := deadline(timeout)
+
+	if err := listener.(*kcp.Listener).SetDeadline(dl); err != nil {
+		_ = listener.Close()
+		return nil, nil, err
+	}
+
 	conn, err := listener.Accept()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to accept connection: %v", err)
+		_ = listener.Close()
+		return nil, nil, acceptError(err, timeout, dl)
 	}
 
 	np := newNetplay(game, conn)
@@ -65,8 +106,8 @@ func listenUDP(game *Game, addr string) (*Netplay, net.Addr, error) {
 	return np, conn.RemoteAddr(), nil
 }
 
-func connectTCP(game *Game, addr string) (*Netplay, net.Addr, error) {
-	conn, err := net.Dial("tcp", addr)
+func connectTCP(game *Game, addr string, timeout time.Duration) (*Netplay, net.Addr, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/maxpoletaev/dendy/consts"
@@ -13,7 +15,6 @@ import (
 	"github.com/maxpoletaev/dendy/internal/binario"
 	"github.com/maxpoletaev/dendy/internal/ringbuf"
 	"github.com/maxpoletaev/dendy/system"
-	"github.com/maxpoletaev/dendy/ui"
 )
 
 type checkpoint struct {
@@ -27,6 +28,15 @@ type checkpoint struct {
 	rolledBack  bool
 }
 
+// checkpointPool keeps the checkpoints replaced by the states received from the
+// remote player, so that the buffers grown to the size of the state are reused
+// on the next resync rather than allocated again.
+var checkpointPool = sync.Pool{
+	New: func() any {
+		return newCheckpoint()
+	},
+}
+
 func newCheckpoint() *checkpoint {
 	buf := bytes.NewBuffer(nil)
 
@@ -41,6 +51,39 @@ func newCheckpoint() *checkpoint {
 	}
 }
 
+// getCheckpoint returns an empty checkpoint from the pool.
+func getCheckpoint() *checkpoint {
+	cp := checkpointPool.Get().(*checkpoint)
+	cp.state.Reset()
+	cp.rolledBack = false
+
+	return cp
+}
+
+// putCheckpoint returns the checkpoint to the pool. It must not be used after.
+func putCheckpoint(cp *checkpoint) {
+	checkpointPool.Put(cp)
+}
+
+// verify checks the state against the checksum taken when it was saved, so that
+// a corrupted checkpoint fails loudly instead of making the players diverge.
+func (cp *checkpoint) verify() error {
+	if sum := crc32.ChecksumIEEE(cp.state.Bytes()); sum != cp.crc32 {
+		return fmt.Errorf("checkpoint for frame %d is corrupted: crc32 is %08X, expected %08X", cp.frame, sum, cp.crc32)
+	}
+
+	return nil
+}
+
+// AudioOutput is the audio stream the game samples are written to. It is
+// implemented by ui.AudioOut, but is declared here to keep the package free of
+// the frontend dependencies. UpdateStream must not block, as the frames are
+// paced by the netplay rather than by the audio.
+type AudioOutput interface {
+	UpdateStream(buf []float32)
+	SetPaused(paused bool)
+}
+
 // Game is a network play state manager. It keeps track of the inputs from both
 // players and makes sure their state is synchronized.
 type Game struct {
@@ -64,37 +107,58 @@ type Game struct {
 	frameEmulationTime time.Duration
 	roundTripTime      time.Duration
 	driftFrames        int
+	rollbackFrames     int
+	rollbackTime       time.Duration
 	sleepFrames        uint32
-	audioOut           *ui.AudioOut
+	paused             bool
+	audioOut           AudioOutput
 	audioBuffer        []float32
 	audioBufferPos     int
+	nextSampleTick     uint64
+	sampleClock        system.SampleClock
 	debugWriter        io.StringWriter
 }
 
-func NewGame(nes *system.System, audio *ui.AudioOut, localJoy, remoteJoy *input.Joystick) *Game {
+// NewGame creates a new game state manager. The audio output may be nil, in
+// which case the samples are discarded.
+func NewGame(nes *system.System, audio AudioOutput, localJoy, remoteJoy *input.Joystick) *Game {
 	return &Game{
-		nes:          nes,
-		headState:    newCheckpoint(),
-		syncState:    newCheckpoint(),
-		catchupState: newCheckpoint(),
-		audioOut:     audio,
-		audioBuffer:  make([]float32, consts.AudioBufferSize),
-		localJoy:     localJoy,
-		remoteJoy:    remoteJoy,
+		nes:                  nes,
+		headState:            newCheckpoint(),
+		syncState:            newCheckpoint(),
+		catchupState:         newCheckpoint(),
+		localInput:           newInputBuffer(),
+		remoteInput:          newInputBuffer(),
+		predictedRemoteInput: newInputBuffer(),
+		audioOut:             audio,
+		audioBuffer:          make([]float32, consts.AudioBufferSize),
+		localJoy:             localJoy,
+		remoteJoy:            remoteJoy,
 	}
 }
 
+// newInputBuffer creates the buffer of the inputs since the last synchronized
+// state. It grows rather than fails when the remote player is far behind, as
+// none of the inputs can be dropped until they are replayed.
+func newInputBuffer() *ringbuf.Buffer[uint8] {
+	buf := ringbuf.New[uint8](512)
+	buf.Policy = ringbuf.PolicyGrow
+
+	return buf
+}
+
 func (g *Game) Init(cp *checkpoint) {
 	g.lastRemoteInput = 0
 	g.catchupInputPos = 0
 	g.sleepFrames = 0
 	g.frame = 0
 
-	g.localInput = ringbuf.New[uint8](512)
-	g.remoteInput = ringbuf.New[uint8](512)
-	g.predictedRemoteInput = ringbuf.New[uint8](512)
+	g.localInput.Clear()
+	g.remoteInput.Clear()
+	g.predictedRemoteInput.Clear()
 
 	if cp != nil {
+		putCheckpoint(g.syncState)
 		g.syncState = cp
 	} else {
 		g.save(g.syncState)
@@ -126,6 +190,20 @@ func (g *Game) Gen() uint32 {
 	return g.gen
 }
 
+// SetPaused stops the emulation until it is resumed.
+func (g *Game) SetPaused(paused bool) {
+	g.paused = paused
+
+	if g.audioOut != nil {
+		g.audioOut.SetPaused(paused)
+	}
+}
+
+// Paused returns true if the game is currently paused.
+func (g *Game) Paused() bool {
+	return g.paused
+}
+
 // Sleeping returns true if the game is currently sleeping to let the remote player catch up.
 func (g *Game) Sleeping() bool {
 	return g.sleepFrames > 0
@@ -138,13 +216,13 @@ func (g *Game) playFrame() {
 		g.nes.Tick()
 		g.tick++
 
-		if g.tick%consts.TicksPerAudioSample == 0 {
-			if g.audioBufferPos < len(g.audioBuffer) {
-				g.audioBuffer[g.audioBufferPos] = g.nes.AudioSample()
-				g.audioBufferPos++
-			}
+		if g.audioOut != nil && g.tick >= g.nextSampleTick {
+			g.nextSampleTick += uint64(g.sampleClock.Next())
+
+			g.audioBuffer[g.audioBufferPos] = g.nes.AudioSample()
+			g.audioBufferPos++
 
-			if g.audioBufferPos == len(g.audioBuffer) && g.audioOut.IsStreamProcessed() {
+			if g.audioBufferPos == len(g.audioBuffer) {
 				g.audioOut.UpdateStream(g.audioBuffer)
 				g.audioBufferPos = 0
 			}
@@ -192,10 +270,14 @@ func (g *Game) dropInputs(n int) {
 func (g *Game) RunFrame(startTime time.Time) {
 	if g.sleepFrames > 0 {
 		g.sleepFrames--
+		g.rollbackTime = 0
 		return
 	}
 
+	g.rollbackFrames = 0
+	rollbackStart := time.Now()
 	g.processDelayedInput(startTime)
+	g.rollbackTime = time.Since(rollbackStart)
 	g.playFrame()
 }
 
@@ -203,6 +285,18 @@ func (g *Game) DriftFrames() int {
 	return g.driftFrames
 }
 
+// RollbackFrames returns the number of frames rolled back during the last frame,
+// or zero if there was no rollback.
+func (g *Game) RollbackFrames() int {
+	return g.rollbackFrames
+}
+
+// RollbackTime returns the time spent replaying the rolled back frames during
+// the last frame, which includes checking the delayed input.
+func (g *Game) RollbackTime() time.Duration {
+	return g.rollbackTime
+}
+
 func (g *Game) save(cp *checkpoint) {
 	cp.state.Reset()
 
@@ -222,6 +316,10 @@ func (g *Game) rollback(cp *checkpoint) {
 		panic("checkpoint already rolled back")
 	}
 
+	if err := cp.verify(); err != nil {
+		panic(err)
+	}
+
 	if err := g.nes.LoadState(cp.reader); err != nil {
 		panic(fmt.Errorf("failed to restore checkpoint: %w", err))
 	}
@@ -266,6 +364,7 @@ func (g *Game) replayLocalInput(startTime time.Time, endFrame uint32, inputPos i
 		remainingTime := consts.FrameDuration - time.Since(startTime)
 
 		if remainingTime < g.frameEmulationTime {
+			log.Printf("[DEBUG] replay lagging at frame %d of %d, catching up on the next frame", f, endFrame)
 			g.save(g.catchupState)
 			g.rollback(g.headState)
 			g.catchupInputPos = inputPos
@@ -316,6 +415,7 @@ func (g *Game) processDelayedInput(startTime time.Time) {
 
 	// Rollback to the last known synchronized state.
 	g.rollback(g.syncState)
+	g.rollbackFrames = int(endFrame - g.frame)
 
 	// Ensure we are always back to where we started.
 	defer func() {
@@ -338,6 +438,7 @@ func (g *Game) processDelayedInput(startTime time.Time) {
 		// noticeable stutter and sound glitches. When we are close to the limit, save
 		// the progress and jump back to the last known unsynchronized state.
 		if remainingTime < g.frameEmulationTime {
+			log.Printf("[DEBUG] replay lagging, synced %d of %d frames", i, numInputs)
 			g.save(g.syncState)
 			g.rollback(g.headState)
 			g.dropInputs(i)
@@ -0,0 +1,143 @@
+package netplay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// newTestGame creates the game running an endless loop, without the audio.
+func newTestGame(t *testing.T) *Game {
+	t.Helper()
+
+	data := testutil.NewROMFile(0, 1, 1)
+	copy(data.PRG(), []byte{0x4C, 0x00, 0x80}) // JMP $8000
+	data.SetResetVector(0x8000)
+
+	return newTestGameROM(t, data)
+}
+
+func newTestGameROM(t *testing.T, data testutil.ROMFile) *Game {
+	t.Helper()
+
+	rom, err := ines.NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	joy1, joy2 := input.NewJoystick(), input.NewJoystick()
+	game := NewGame(system.New(cart, joy1, joy2), nil, joy1, joy2)
+	game.Init(nil)
+
+	return game
+}
+
+// The frames do not allocate, neither on their own nor with the rollback, as
+// the garbage collection shows up as the stutter. The remote input starts to
+// arrive after the given number of frames, so that the frame played last and
+// the ones the remote player is behind by are rolled back and replayed.
+func TestGame_RunFrameAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool allocates under the race detector")
+	}
+
+	tests := map[string]struct {
+		delay    uint32
+		rollback int
+	}{
+		"no remote input": {delay: 1 << 20, rollback: 0},
+		"in time":         {delay: 0, rollback: 1},
+		"rolled back":     {delay: 2, rollback: 2},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			game := newTestGame(t)
+
+			runFrame := func() {
+				game.HandleLocalInput(0)
+
+				if frame := game.Frame(); frame >= tt.delay {
+					game.HandleRemoteInput(0, frame-tt.delay)
+				}
+
+				game.RunFrame(time.Now())
+			}
+
+			// The buffers are grown to the size of the state first.
+			for i := 0; i < 10; i++ {
+				runFrame()
+			}
+
+			testutil.Equal(t, testing.AllocsPerRun(20, runFrame), 0)
+			testutil.Equal(t, game.RollbackFrames(), tt.rollback)
+		})
+	}
+}
+
+// deterministicCRC32 is the checksum of the checkpoint made after nestest is
+// started by the local player. It must be the same on every GOARCH, as both
+// players have to end up in the same state, see the package doc of system.
+const deterministicCRC32 = 0x031EB82B
+
+// The checkpoint is the same whether the remote input arrives in time or is
+// late and the frames are rolled back, and on every platform.
+func TestGame_Deterministic(t *testing.T) {
+	for name, delay := range map[string]uint32{"in time": 0, "rolled back": 3} {
+		t.Run(name, func(t *testing.T) {
+			rom, err := ines.NewFromFile("../nestest/nestest.nes")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cart, err := ines.NewCartridge(rom)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			joy1, joy2 := input.NewJoystick(), input.NewJoystick()
+			game := NewGame(system.New(cart, joy1, joy2), nil, joy1, joy2)
+			game.Init(nil)
+
+			// The frames start in the future, so that the rollback is never cut
+			// short for the lack of time, e.g. under the race detector.
+			startTime := time.Now().Add(time.Hour)
+
+			for frame := uint32(0); frame < 120; frame++ {
+				var buttons uint8
+				if frame >= 30 && frame < 35 {
+					buttons = input.ButtonStart
+				}
+
+				game.HandleLocalInput(buttons)
+
+				if frame >= delay {
+					game.HandleRemoteInput(0, frame-delay)
+				}
+
+				game.RunFrame(startTime)
+			}
+
+			// The late remote input arrives, so that the checkpoint is made on
+			// the same frame.
+			for frame := 120 - delay; frame <= 120; frame++ {
+				game.HandleRemoteInput(0, frame)
+			}
+
+			game.HandleLocalInput(0)
+			game.RunFrame(startTime)
+
+			testutil.Equal(t, game.syncState.frame, uint32(120))
+			testutil.Equal(t, game.syncState.crc32, uint32(deterministicCRC32))
+		})
+	}
+}
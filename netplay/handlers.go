@@ -1,20 +1,23 @@
 package netplay
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"time"
 )
 
-func (np *Netplay) handleMessage(msg Message) {
+// handleMessage handles the message from the remote player. Returns an error if
+// the game cannot continue, e.g. the state sent by the host cannot be loaded.
+func (np *Netplay) handleMessage(msg Message) error {
 	if msg.Generation < np.game.Gen() {
 		log.Printf("[INFO] dropping message from old generation: %d", msg.Generation)
-		return
+		return nil
 	}
 
 	switch msg.Type {
 	case MsgTypeReset:
-		np.handleReset(msg)
+		return np.handleReset(msg)
 	case MsgTypePing:
 		np.handlePing(msg)
 	case MsgTypePong:
@@ -25,13 +28,22 @@ func (np *Netplay) handleMessage(msg Message) {
 		np.handleBye(msg)
 	case MsgTypeWait:
 		np.handleWait(msg)
+	case MsgTypePause:
+		np.handlePause(msg)
 	default:
 		// should never reach here
 		panic(fmt.Errorf("unknown message type: %d", msg.Type))
 	}
+
+	return nil
 }
 
 func (np *Netplay) handleWait(msg Message) {
+	if len(msg.Buffer.Data) < 4 {
+		log.Printf("[WARN] dropping wait message: too short")
+		return
+	}
+
 	frames := byteOrder.Uint32(msg.Buffer.Data[:4])
 	log.Printf("[INFO] sleeping for %d frames", frames)
 
@@ -40,6 +52,31 @@ func (np *Netplay) handleWait(msg Message) {
 	np.game.SleepFrames(frames)
 }
 
+// handlePause pauses or resumes the game as the remote player did. When the
+// client resumes the game, the host sends the state to resynchronize.
+func (np *Netplay) handlePause(msg Message) {
+	if len(msg.Buffer.Data) < 1 {
+		log.Printf("[WARN] dropping pause message: too short")
+		return
+	}
+
+	paused := msg.Buffer.Data[0] == 1
+
+	if paused {
+		log.Printf("[INFO] paused by the remote player")
+		np.notify("Paused by the remote player")
+	} else {
+		log.Printf("[INFO] resumed by the remote player")
+		np.notify("Resumed by the remote player")
+	}
+
+	np.game.SetPaused(paused)
+
+	if !paused && np.isHost {
+		np.SendResync()
+	}
+}
+
 func (np *Netplay) handleBye(msg Message) {
 	// The remote peer doesn't care about further messages.
 	close(np.toSend)
@@ -60,11 +97,40 @@ func (np *Netplay) handleBye(msg Message) {
 	close(np.toRecv)
 }
 
-func (np *Netplay) handleReset(msg Message) {
-	c := newCheckpoint()
+// handleReset loads the state sent by the host. The state of the other version
+// of the protocol cannot be loaded, nor can the corrupted one.
+func (np *Netplay) handleReset(msg Message) error {
+	// The very first reset is the initial state sent by the host.
+	running := np.game.Frame() > 0
+
+	if len(msg.Buffer.Data) < 2+4 {
+		return errors.New("reset message is too short")
+	}
+
+	if v := byteOrder.Uint16(msg.Buffer.Data); v != ProtocolVersion {
+		return fmt.Errorf("remote player uses netplay protocol version %d, expected %d", v, ProtocolVersion)
+	}
+
+	// The checksum is verified right away, as the state is otherwise loaded
+	// only on the first rollback.
+	data := msg.Buffer.Data[2 : len(msg.Buffer.Data)-4]
+
+	c := getCheckpoint()
 	c.frame = msg.Frame
-	c.state.Write(msg.Buffer.Data)
+	c.crc32 = byteOrder.Uint32(msg.Buffer.Data[len(msg.Buffer.Data)-4:])
+	c.state.Write(data)
+
+	if err := c.verify(); err != nil {
+		return fmt.Errorf("received state is corrupted: %w", err)
+	}
+
 	np.game.Init(c)
+
+	if running {
+		np.notify("Resynchronized")
+	}
+
+	return nil
 }
 
 func (np *Netplay) handlePing(msg Message) {
@@ -80,15 +146,21 @@ func (np *Netplay) handlePing(msg Message) {
 
 func (np *Netplay) handlePong(msg Message) {
 	timeSent := time.UnixMicro(int64(byteOrder.Uint64(msg.Buffer.Data[:8])))
-	np.rttWindow.PushBackEvict(time.Since(timeSent))
+	np.rttWindow.PushBack(time.Since(timeSent))
 
 	var sum time.Duration
 	for i := 0; i < np.rttWindow.Len(); i++ {
 		sum += np.rttWindow.At(i)
 	}
 
+	prevRTT := np.rtt
 	np.rtt = sum / time.Duration(np.rttWindow.Len())
 	np.game.SetRoundTripTime(np.rtt)
+
+	// Only notify when the latency crosses the threshold, not on every pong.
+	if np.rtt > highPingThreshold && prevRTT <= highPingThreshold {
+		np.notify("High ping: %d ms", np.rtt.Milliseconds())
+	}
 }
 
 func (np *Netplay) handleInput(msg Message) {
@@ -0,0 +1,206 @@
+package netplay
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+	"github.com/maxpoletaev/dendy/internal/bytepool"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newTestNetplay creates the session without the connection, the messages sent
+// are left in np.toSend.
+func newTestNetplay(t *testing.T, isHost bool) *Netplay {
+	t.Helper()
+
+	game := newTestGame(t)
+
+	np := newNetplay(game, nil)
+	np.isHost = isHost
+
+	return np
+}
+
+// sentTypes returns the types of the messages sent so far.
+func sentTypes(np *Netplay) []MsgType {
+	var types []MsgType
+
+	for len(np.toSend) > 0 {
+		types = append(types, (<-np.toSend).Type)
+	}
+
+	return types
+}
+
+func equalTypes(t *testing.T, got, want []MsgType) {
+	t.Helper()
+
+	testutil.Equal(t, len(got), len(want))
+
+	for i := range want {
+		testutil.Equal(t, got[i], want[i])
+	}
+}
+
+// Only the host sends the state to resynchronize on resume, as the state of
+// the client would overwrite the one of the host otherwise.
+func TestNetplay_SendTogglePause(t *testing.T) {
+	tests := map[string]struct {
+		isHost bool
+		want   []MsgType
+	}{
+		"host":   {isHost: true, want: []MsgType{MsgTypePause, MsgTypePause, MsgTypeReset}},
+		"client": {isHost: false, want: []MsgType{MsgTypePause, MsgTypePause}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			np := newTestNetplay(t, tt.isHost)
+
+			np.SendTogglePause()
+			testutil.Equal(t, np.game.Paused(), true)
+
+			np.SendTogglePause()
+			testutil.Equal(t, np.game.Paused(), false)
+
+			equalTypes(t, sentTypes(np), tt.want)
+		})
+	}
+}
+
+// The host resynchronizes the game resumed by the client.
+func TestNetplay_HandlePause(t *testing.T) {
+	tests := map[string]struct {
+		isHost bool
+		want   []MsgType
+	}{
+		"host":   {isHost: true, want: []MsgType{MsgTypeReset}},
+		"client": {isHost: false, want: nil},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			np := newTestNetplay(t, tt.isHost)
+
+			np.handleMessage(Message{Type: MsgTypePause, Generation: np.game.Gen(), Buffer: bytepool.Buffer{Data: []byte{1}}})
+			testutil.Equal(t, np.game.Paused(), true)
+			equalTypes(t, sentTypes(np), nil)
+
+			np.handleMessage(Message{Type: MsgTypePause, Generation: np.game.Gen(), Buffer: bytepool.Buffer{Data: []byte{0}}})
+			testutil.Equal(t, np.game.Paused(), false)
+			equalTypes(t, sentTypes(np), tt.want)
+		})
+	}
+}
+
+// The messages too short for their type are dropped rather than crashing.
+func TestNetplay_HandleShortMessages(t *testing.T) {
+	np := newTestNetplay(t, true)
+
+	np.handleMessage(Message{Type: MsgTypePause, Generation: np.game.Gen()})
+	testutil.Equal(t, np.game.Paused(), false)
+
+	np.handleMessage(Message{Type: MsgTypeWait, Generation: np.game.Gen(), Buffer: bytepool.Buffer{Data: []byte{1, 0}}})
+	testutil.Equal(t, np.game.Sleeping(), false)
+}
+
+// The state sent by the host is loaded by the client of the same protocol
+// version, and rejected otherwise.
+func TestNetplay_HandleReset(t *testing.T) {
+	tests := map[string]struct {
+		version uint16
+		length  int // of the message, if shortened
+		err     string
+	}{
+		"same version":  {version: ProtocolVersion},
+		"other version": {version: ProtocolVersion - 1, err: fmt.Sprintf("remote player uses netplay protocol version %d, expected %d", ProtocolVersion-1, ProtocolVersion)},
+		"too short":     {version: ProtocolVersion, length: 5, err: "reset message is too short"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			host := newTestNetplay(t, true)
+			host.SendInitialState()
+			msg := <-host.toSend
+
+			byteOrder.PutUint16(msg.Buffer.Data, tt.version)
+			if tt.length > 0 {
+				msg.Buffer.Data = msg.Buffer.Data[:tt.length]
+			}
+
+			client := newTestNetplay(t, false)
+			err := client.handleMessage(msg)
+
+			if tt.err != "" {
+				testutil.Equal(t, err != nil, true)
+				testutil.Equal(t, err.Error(), tt.err)
+				return
+			}
+
+			testutil.Equal(t, err, nil)
+			testutil.Equal(t, client.game.syncState.crc32, host.game.syncState.crc32)
+		})
+	}
+}
+
+// The client of the other protocol version says goodbye to the host and exits
+// with the error, instead of crashing, even while it is waiting for the host to
+// catch up, when the bye is not sent otherwise.
+func TestNetplay_HandleMessagesVersionMismatch(t *testing.T) {
+	tests := map[string]struct {
+		sleepFrames uint32
+	}{
+		"running":  {sleepFrames: 0},
+		"sleeping": {sleepFrames: 10},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			host := newTestNetplay(t, true)
+			host.SendInitialState()
+			msg := <-host.toSend
+			byteOrder.PutUint16(msg.Buffer.Data, ProtocolVersion+1)
+
+			local, remote := net.Pipe()
+			defer remote.Close()
+
+			client := newTestNetplay(t, false)
+			client.conn = local
+			client.game.SleepFrames(tt.sleepFrames)
+			client.start()
+
+			var messages []string
+			client.MessageDelegate = func(format string, args ...any) {
+				messages = append(messages, fmt.Sprintf(format, args...))
+			}
+
+			bye := make(chan MsgType, 1)
+
+			// The pipe is not buffered, so the rest is read until it is closed.
+			go func() {
+				var m Message
+				if err := readMsg(binario.NewReader(remote, byteOrder), &m, client.pool); err == nil {
+					bye <- m.Type
+				}
+
+				close(bye)
+				_, _ = io.Copy(io.Discard, remote)
+			}()
+
+			client.toRecv <- msg
+			client.HandleMessages()
+
+			want := fmt.Sprintf("remote player uses netplay protocol version %d, expected %d", ProtocolVersion+1, ProtocolVersion)
+
+			testutil.Equal(t, client.game.Sleeping(), tt.sleepFrames > 0)
+			testutil.Equal(t, client.ShouldExit(), true)
+			testutil.Equal(t, client.Err().Error(), want)
+			testutil.Equal(t, len(messages), 1)
+			testutil.Equal(t, messages[0], want)
+			testutil.Equal(t, <-bye, MsgTypeBye)
+		})
+	}
+}
@@ -7,6 +7,12 @@ import (
 	"github.com/maxpoletaev/dendy/internal/bytepool"
 )
 
+// ProtocolVersion is sent in front of the state in the reset message, so that
+// the players running incompatible versions fail on connecting, rather than
+// diverge later. It is bumped whenever any of the messages changes: version 2
+// added the checksum after the state.
+const ProtocolVersion uint16 = 2
+
 type MsgType = uint8
 
 const (
@@ -16,6 +22,7 @@ const (
 	MsgTypePing
 	MsgTypePong
 	MsgTypeBye
+	MsgTypePause
 )
 
 type Message struct {
@@ -1,8 +1,16 @@
+// Package netplay implements the rollback netplay for two players. The host
+// sends its state once, and after that only the inputs are sent, while each
+// side runs its own emulator, which is rolled back and replayed when the remote
+// input differs from the predicted one. So both sides only stay in sync if the
+// emulation is deterministic, even between different platforms, see the package
+// doc of system.
 package netplay
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"math/rand"
@@ -21,7 +29,9 @@ const (
 	minFrameDriftWindow = 3    // should not be <3 as int(2*1.35)=2
 	driftWindowFactor   = 1.35 // factor to increase/decrease the drift window
 	maxPoolItemSize     = 8
+	statePoolHeadroom   = 4 << 10 // for the version, the checksum and the state growing
 	maxMessageBatch     = 10
+	highPingThreshold   = 150 * time.Millisecond
 )
 
 var (
@@ -29,6 +39,10 @@ var (
 )
 
 type Netplay struct {
+	// MessageDelegate is called with notifications that should be displayed
+	// to the user, such as the remote player pausing the game.
+	MessageDelegate func(format string, args ...any)
+
 	game       *Game
 	toRecv     chan Message
 	toSend     chan Message
@@ -39,6 +53,7 @@ type Netplay struct {
 	readerDone chan struct{}
 	writerDone chan struct{}
 	shouldExit bool
+	err        error
 	isHost     bool
 
 	driftWindow   int
@@ -48,10 +63,12 @@ type Netplay struct {
 }
 
 func newNetplay(game *Game, conn net.Conn) *Netplay {
-	pool := bytepool.New(maxPoolItemSize)
+	pool := bytepool.New(maxPoolItemSize, statePoolSize(game))
+	rttWindow := ringbuf.New[time.Duration](10)
+	rttWindow.Policy = ringbuf.PolicyOverwrite
 
 	return &Netplay{
-		rttWindow:   ringbuf.New[time.Duration](10),
+		rttWindow:   rttWindow,
 		toSend:      make(chan Message, 100),
 		toRecv:      make(chan Message, 100),
 		driftWindow: minFrameDriftWindow,
@@ -63,6 +80,20 @@ func newNetplay(game *Game, conn net.Conn) *Netplay {
 	}
 }
 
+// statePoolSize returns the size of the pooled buffers for the states, which
+// differs a lot between the mappers, e.g. the FDS state has the whole disk. It
+// is measured on the state of the game, with the room for it to grow, e.g. by
+// the flash sectors written by the game. The larger states are allocated.
+func statePoolSize(game *Game) int {
+	var buf bytes.Buffer
+
+	if err := game.nes.SaveState(binario.NewWriter(&buf, byteOrder)); err != nil {
+		panic(fmt.Errorf("failed to save state: %w", err))
+	}
+
+	return buf.Len() + statePoolHeadroom
+}
+
 func (np *Netplay) startWriter() {
 	w := binario.NewWriter(np.conn, byteOrder)
 
@@ -122,20 +153,37 @@ func (np *Netplay) sendMsg(msg Message) {
 	}
 }
 
+func (np *Netplay) notify(format string, args ...any) {
+	if np.MessageDelegate != nil {
+		np.MessageDelegate(format, args...)
+	}
+}
+
 // ShouldExit indicates whether the game loop should exit.
 func (np *Netplay) ShouldExit() bool {
 	return np.shouldExit
 }
 
-// HandleMessages handles incoming messages from the remote player.
+// Err returns the error the session was ended with, if any.
+func (np *Netplay) Err() error {
+	return np.err
+}
+
+// HandleMessages handles incoming messages from the remote player. If any of
+// them cannot be handled, the session is ended, see ShouldExit and Err.
 func (np *Netplay) HandleMessages() {
 loop:
 	for i := 0; i < maxMessageBatch; i++ {
 		select {
 		case msg, ok := <-np.toRecv:
 			if ok {
-				np.handleMessage(msg)
+				err := np.handleMessage(msg)
 				msg.Buffer.Free()
+
+				if err != nil {
+					np.disconnect(err)
+					break loop
+				}
 			} else {
 				break loop
 			}
@@ -145,6 +193,16 @@ loop:
 	}
 }
 
+// disconnect ends the session with the error, saying goodbye to the remote
+// player, so that it exits as well rather than waiting for the connection to
+// time out. Unlike SendBye, it does so even while the game is sleeping.
+func (np *Netplay) disconnect(err error) {
+	np.err = err
+	np.notify("%s", err)
+	np.sayBye()
+	np.shouldExit = true
+}
+
 // handleFrameDrift makes sure both emulators are running approximately at the same speed,
 // by asking the remote side to wait if it detects a difference in the frame count.
 func (np *Netplay) handleFrameDrift() {
@@ -156,6 +214,7 @@ func (np *Netplay) handleFrameDrift() {
 
 		if driftFrames > np.driftWindow && np.syncFrame+maxFrameSyncFreq < localFrame {
 			log.Printf("[INFO] asking the remote to wait for %d frames", driftFrames)
+			np.notify("Waiting for the remote player")
 
 			// We drifted, reset the counter and set the next sync frame.
 			np.syncFrame = localFrame + uint32(rand.Int31n(maxFrameSyncFreq/10))
@@ -184,6 +243,10 @@ func (np *Netplay) handleFrameDrift() {
 
 // RunFrame progresses the game by one frame.
 func (np *Netplay) RunFrame(startTime time.Time) {
+	if np.game.Paused() {
+		return
+	}
+
 	np.game.RunFrame(startTime)
 
 	// Inject a ping message every N frames to measure latency.
@@ -194,6 +257,11 @@ func (np *Netplay) RunFrame(startTime time.Time) {
 	np.handleFrameDrift()
 }
 
+// Paused returns true if the game was paused by either of the players.
+func (np *Netplay) Paused() bool {
+	return np.game.Paused()
+}
+
 // RemotePing returns the ping time to the remote peer in milliseconds.
 func (np *Netplay) RemotePing() int64 {
 	return np.rtt.Milliseconds()
@@ -0,0 +1,32 @@
+package netplay
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// The states sent to the remote player fit into the pooled buffers, whatever
+// the size of the state of the mapper.
+func TestNetplay_StatePool(t *testing.T) {
+	tests := map[string]struct {
+		rom testutil.ROMFile
+	}{
+		"NROM":              {rom: testutil.NewROMFile(0, 1, 1)},
+		"UNROM 512 CHR-RAM": {rom: testutil.NewROMFile(30, 32, 0)},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			game := newTestGameROM(t, tt.rom)
+			game.Init(nil)
+
+			np := newNetplay(game, nil)
+			np.sendState(game.syncState)
+
+			msg := <-np.toSend
+			testutil.Equal(t, msg.Buffer.Pooled(), true)
+			testutil.Equal(t, len(msg.Buffer.Data), 2+game.syncState.state.Len()+4)
+		})
+	}
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package netplay
+
+// raceEnabled is set when the tests are run with the race detector, which
+// makes sync.Pool drop the items at random, so the pooled buffers allocate.
+const raceEnabled = true
@@ -2,8 +2,6 @@ package ppu
 
 import "image/color"
 
-var Colors [64]color.RGBA
-
 func init() {
 	colors := []uint32{
 		0x666666, 0x002A88, 0x1412A7, 0x3B00A4, 0x5C007E, 0x6E0040, 0x6C0600, 0x561D00,
@@ -17,11 +15,20 @@ func init() {
 	}
 
 	for i, c := range colors {
-		Colors[i] = color.RGBA{
+		DefaultPalette[i] = color.RGBA{
 			R: byte(c >> 16),
 			G: byte(c >> 8),
 			B: byte(c >> 0),
 			A: 0xFF,
 		}
 	}
+
+	addEmphasis(&DefaultPalette)
+
+	SonyCXAPalette = generatePalette(sonyCXA2025AS)
+	GrayscalePalette = grayscalePalette(&DefaultPalette)
+
+	Palettes["default"] = &DefaultPalette
+	Palettes["sony-cxa"] = &SonyCXAPalette
+	Palettes["grayscale"] = &GrayscalePalette
 }
@@ -0,0 +1,129 @@
+package ppu
+
+import (
+	"image/color"
+)
+
+// Sizes of the pictures drawn by the debug viewers.
+const (
+	NameTablesWidth     = FrameWidth * 2
+	NameTablesHeight    = FrameHeight * 2
+	PatternTablesWidth  = 256
+	PatternTablesHeight = 128
+	SpritesWidth        = 8 * 8
+	SpritesHeight       = 8 * 16
+)
+
+// drawDebugTile draws the 8x8 tile at the given address in the pattern table
+// into the picture with the given width, using the palette ID (0-3 for the
+// background, 4-7 for the sprites).
+func (p *PPU) drawDebugTile(pic []color.RGBA, width, x, y int, addr uint16, paletteID uint8, flipX, flipY bool) {
+	for row := 0; row < 8; row++ {
+		p1 := p.readVRAM(addr + uint16(row) + 0)
+		p2 := p.readVRAM(addr + uint16(row) + 8)
+
+		py := row
+		if flipY {
+			py = 7 - row
+		}
+
+		for col := 0; col < 8; col++ {
+			pixel := p1 & (0x80 >> col) >> (7 - col) << 0
+			pixel |= (p2 & (0x80 >> col) >> (7 - col)) << 1
+
+			px := col
+			if flipX {
+				px = 7 - col
+			}
+
+			pic[(y+py)*width+x+px] = p.colors[p.readTileColor(pixel, paletteID)]
+		}
+	}
+}
+
+// DrawNameTables draws the four nametables, as they are mirrored by the
+// cartridge, into the 512x480 picture, with the background pattern table and
+// the attributes that the game would be rendered with.
+func (p *PPU) DrawNameTables(pic []color.RGBA) {
+	tableOffset := p.tilePatternTableOffset()
+
+	for nametableID := uint16(0); nametableID < 4; nametableID++ {
+		var (
+			nametableAddr = 0x2000 + nametableID*0x0400
+			attrtableAddr = nametableAddr + 0x03C0
+			originX       = int(nametableID%2) * FrameWidth
+			originY       = int(nametableID/2) * FrameHeight
+		)
+
+		for tileY := uint16(0); tileY < 30; tileY++ {
+			for tileX := uint16(0); tileX < 32; tileX++ {
+				tileID := p.readVRAM(nametableAddr + tileY*32 + tileX)
+				attr := p.readVRAM(attrtableAddr + tileX/4 + tileY/4*8)
+				blockID := tileX%4/2 + tileY%4/2*2
+				paletteID := (attr >> (blockID * 2)) & 0x03
+
+				x, y := originX+int(tileX)*8, originY+int(tileY)*8
+				p.drawDebugTile(pic, NameTablesWidth, x, y, tableOffset+uint16(tileID)*16, paletteID, false, false)
+			}
+		}
+	}
+}
+
+// DrawPatternTables draws the two pattern tables side by side into the 256x128
+// picture, coloured with the given palette ID (0-7).
+func (p *PPU) DrawPatternTables(pic []color.RGBA, paletteID uint8) {
+	for table := 0; table < 2; table++ {
+		for tile := 0; tile < 256; tile++ {
+			var (
+				addr = uint16(table)*0x1000 + uint16(tile)*16
+				x    = table*128 + tile%16*8
+				y    = tile / 16 * 8
+			)
+
+			p.drawDebugTile(pic, PatternTablesWidth, x, y, addr, paletteID&0x07, false, false)
+		}
+	}
+}
+
+// DrawSprites draws the 64 sprites of the OAM into the 64x128 picture, in eight
+// rows of eight, each in a cell of 8x16 pixels, as tall as the largest sprite.
+func (p *PPU) DrawSprites(pic []color.RGBA) {
+	var (
+		height    = p.spriteHeight()
+		tableAddr = p.spritePatternTableOffset()
+		backdrop  = p.colors[p.backdropIndex()]
+	)
+
+	for i := range pic[:SpritesWidth*SpritesHeight] {
+		pic[i] = backdrop
+	}
+
+	for idx := 0; idx < 64; idx++ {
+		var (
+			spriteID = p.oamData[idx*4+1]
+			attr     = p.oamData[idx*4+2]
+			flipX    = attr&spriteAttrFlipX != 0
+			flipY    = attr&spriteAttrFlipY != 0
+			x        = idx % 8 * 8
+			y        = idx / 8 * 16
+		)
+
+		// Flipping an 8x16 sprite vertically also swaps its two tiles.
+		for half := 0; half < height/8; half++ {
+			row := half * 8
+			if flipY && height == 16 {
+				row = 8 - row
+			}
+
+			addr := p.spriteAddr(tableAddr, spriteID, row, height)
+			p.drawDebugTile(pic, SpritesWidth, x, y+half*8, addr, 4+attr&spriteAttrPalette, flipX, flipY)
+		}
+	}
+}
+
+// OAMEntry returns the position, the tile and the attributes of the sprite with
+// the given index (0-63), as stored in the OAM.
+func (p *PPU) OAMEntry(idx int) (x, y, tile, attr uint8) {
+	entry := p.oamData[idx*4 : idx*4+4]
+	return entry[3], entry[0], entry[1], entry[2]
+}
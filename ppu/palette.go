@@ -0,0 +1,227 @@
+package ppu
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+)
+
+// Palette is the colors of the 64 color indexes the PPU produces, for each of
+// the 8 combinations of the emphasis bits of PPUMASK: the color index is in the
+// lower 6 bits of the palette index and the emphasis bits in the upper 3. The
+// actual colors are up to the TV decoding the video signal, so there is no
+// single correct palette, just the ones that look closer to a particular TV.
+type Palette [PaletteSize]color.RGBA
+
+const (
+	// BaseColors is the number of the colors without the emphasis.
+	BaseColors = 64
+	// PaletteSize is the number of the colors with all the emphasis sets.
+	PaletteSize = 8 * BaseColors
+)
+
+var (
+	// DefaultPalette is a neutral palette close to most of the TVs.
+	DefaultPalette Palette
+	// SonyCXAPalette is decoded the way the Sony CXA2025AS chip in many of
+	// the 90s TVs did, with the warmer reds and the greener greens.
+	SonyCXAPalette Palette
+	// GrayscalePalette is the luma of the default palette, as seen on a black
+	// and white TV. The emphasis still darkens it.
+	GrayscalePalette Palette
+)
+
+// Palettes are the built-in palettes by name.
+var Palettes = map[string]*Palette{}
+
+// PaletteNames lists the built-in palettes in the order they are cycled in the
+// settings menu.
+var PaletteNames = []string{"default", "sony-cxa", "grayscale"}
+
+// LoadPalette reads the palette from a .pal file, which is 64 RGB triples, or
+// 512 with the emphasis colors. The emphasis colors missing from the file are
+// derived from the first 64.
+func LoadPalette(filename string) (*Palette, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != BaseColors*3 && len(data) != PaletteSize*3 {
+		return nil, fmt.Errorf("invalid palette file: expected %d or %d bytes, got %d", BaseColors*3, PaletteSize*3, len(data))
+	}
+
+	p := new(Palette)
+
+	for i := 0; i < len(data)/3; i++ {
+		p[i] = color.RGBA{R: data[i*3], G: data[i*3+1], B: data[i*3+2], A: 0xFF}
+	}
+
+	if len(data) == BaseColors*3 {
+		addEmphasis(p)
+	}
+
+	return p, nil
+}
+
+// addEmphasis fills the emphasis colors of the palette from its first 64. The
+// emphasis attenuates the video signal, not the RGB colors, so it shifts every
+// color differently, depending on the hue and the level. The shift is taken
+// from the signal decoded the standard way, and added to the base color, so
+// that the palette keeps its own look with the emphasis too.
+func addEmphasis(p *Palette) {
+	for i := BaseColors; i < PaletteSize; i++ {
+		base := p[i%BaseColors]
+		emph := decodeSignal(standardDemodulator, i)
+		orig := decodeSignal(standardDemodulator, i%BaseColors)
+
+		shift := func(c uint8, v, orig float64) uint8 {
+			return toByte(float64(c)/255 + v - orig)
+		}
+
+		p[i] = color.RGBA{
+			R: shift(base.R, emph[0], orig[0]),
+			G: shift(base.G, emph[1], orig[1]),
+			B: shift(base.B, emph[2], orig[2]),
+			A: 0xFF,
+		}
+	}
+}
+
+func grayscalePalette(src *Palette) Palette {
+	var p Palette
+
+	for i, c := range src {
+		gray := uint8(float64(c.R)*0.299 + float64(c.G)*0.587 + float64(c.B)*0.114 + 0.5)
+		p[i] = color.RGBA{R: gray, G: gray, B: gray, A: 0xFF}
+	}
+
+	return p
+}
+
+// demodulator is how the TV decodes the chroma into the color difference
+// signals: the axis angles and the gains of R-Y and G-Y, relative to B-Y.
+type demodulator struct {
+	angleRY, gainRY float64
+	angleGY, gainGY float64
+}
+
+// standardDemodulator decodes the signal along the standard YUV axes, without
+// the tweaks of the real TV chips.
+var standardDemodulator = demodulator{
+	angleRY: 90, gainRY: 0.562,
+	angleGY: 235.8, gainGY: 0.346,
+}
+
+// sonyCXA2025AS is the demodulator of the chip in the US mode, as given in its
+// datasheet.
+var sonyCXA2025AS = demodulator{
+	angleRY: 112, gainRY: 0.83,
+	angleGY: 252, gainGY: 0.30,
+}
+
+// Voltage levels of the PPU video signal for each of the four luma levels, as
+// measured on the real hardware, and the levels of black and white.
+var (
+	signalLow  = [4]float64{0.228, 0.312, 0.552, 0.880}
+	signalHigh = [4]float64{0.616, 0.840, 1.100, 1.100}
+)
+
+const (
+	signalBlack = 0.312
+	signalWhite = 1.100
+)
+
+// emphasisAttenuation is how much the signal is attenuated while it is in the
+// phase of the emphasis bits set.
+const emphasisAttenuation = 0.746
+
+// emphasisHues are the hues in phase with the attenuation of the red, the green
+// and the blue emphasis. Each is opposite to the hue it emphasizes, so that the
+// other colors get darker.
+var emphasisHues = [3]int{0x0C, 0x04, 0x08}
+
+// generatePalette decodes the video signal the PPU produces for each of the
+// colors, with each of the emphasis sets.
+func generatePalette(d demodulator) Palette {
+	var p Palette
+
+	for i := range p {
+		rgb := decodeSignal(d, i)
+
+		p[i] = color.RGBA{
+			R: toByte(rgb[0]),
+			G: toByte(rgb[1]),
+			B: toByte(rgb[2]),
+			A: 0xFF,
+		}
+	}
+
+	return p
+}
+
+// decodeSignal returns the RGB color of the palette index, not clamped to the
+// 0-1 range. The chroma is a square wave between the low and the high level of
+// the luma, shifted by 30 degrees for every hue. The hue 8 is in phase with the
+// color burst, which the TV takes as the -U axis. The emphasis bits attenuate
+// the signal for half of the wave, each in its own phase.
+func decodeSignal(d demodulator, i int) [3]float64 {
+	hue, level, emphasis := i&0x0F, i>>4&0x03, i>>6
+
+	inPhase := func(hue, phase int) bool {
+		return (phase-hue+12)%12 < 6
+	}
+
+	var y, u, v float64
+
+	for phase := 0; phase < 12; phase++ {
+		var signal float64
+
+		switch {
+		case hue == 0:
+			signal = signalHigh[level]
+		case hue < 13:
+			if inPhase(hue, phase) {
+				signal = signalHigh[level]
+			} else {
+				signal = signalLow[level]
+			}
+		case hue == 13:
+			signal = signalLow[level]
+		default:
+			signal = signalBlack
+		}
+
+		for bit, h := range emphasisHues {
+			if emphasis&(1<<bit) != 0 && inPhase(h, phase) {
+				signal *= emphasisAttenuation
+				break
+			}
+		}
+
+		signal = (signal - signalBlack) / (signalWhite - signalBlack)
+		angle := float64(phase*30-135) * math.Pi / 180
+
+		y += signal / 12
+		u += signal * math.Cos(angle) / 6
+		v += signal * math.Sin(angle) / 6
+	}
+
+	// Only the differences from the burst axis matter, so B-Y is taken at
+	// zero degrees with the standard gain, and the other two are relative.
+	axis := func(angle, gain float64) float64 {
+		rad := angle * math.Pi / 180
+		return 2.029 * gain * (u*math.Cos(rad) + v*math.Sin(rad))
+	}
+
+	return [3]float64{
+		y + axis(d.angleRY, d.gainRY),
+		y + axis(d.angleGY, d.gainGY),
+		y + 2.029*u,
+	}
+}
+
+func toByte(v float64) uint8 {
+	return uint8(math.Round(math.Min(math.Max(v, 0), 1) * 255))
+}
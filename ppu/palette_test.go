@@ -0,0 +1,22 @@
+package ppu
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+func TestPalette_Emphasis(t *testing.T) {
+	white := DefaultPalette[0x20]
+	red := DefaultPalette[1<<6|0x20]
+
+	// The red emphasis darkens the other colors, red itself stays the same.
+	testutil.Equal(t, red.R, white.R)
+	testutil.Equal(t, red.G < white.G, true)
+	testutil.Equal(t, red.B < white.B, true)
+
+	// All three bits together darken every color.
+	all := SonyCXAPalette[7<<6|0x20]
+	testutil.Equal(t, all.R < SonyCXAPalette[0x20].R, true)
+	testutil.Equal(t, all.R, all.B)
+}
@@ -45,28 +45,29 @@ const (
 	FrameHeight = 240
 )
 
-type (
-	dmaFunc func(addr uint16, data []byte)
-)
-
 type PPU struct {
 	Frame       []color.RGBA // 256*240
+	pixels      []uint16     // 256*240, the palette indexes of the frame
 	transparent []bool       // 256*240
+	colors      *Palette
 
 	NoSpriteLimit    bool
 	FastForward      bool
+	LightGun         bool // keep the palette indexes drawn during fast-forward
+	Dendy            bool // the timing of the Dendy, see vblankScanline
 	PendingNMI       bool
 	ScanlineComplete bool
 	FrameComplete    bool
 
-	cart         ines.Cartridge // $0000-$1FFF (CHR-ROM)
-	ctrl         CtrlFlags      // $2000
-	mask         MaskFlags      // $2001
-	status       StatusFlags    // $2002
-	oamAddr      uint8          // $2003
-	oamData      [256]byte      // $2004
-	nameTable    [2][1024]byte  // $2000-$2FFF
-	paletteTable [32]byte       // $3F00-$3FFF
+	cart         ines.Cartridge  // $0000-$1FFF (CHR-ROM)
+	snooper      ines.PPUSnooper // the mapper, if it takes over the nametables
+	ctrl         CtrlFlags       // $2000
+	mask         MaskFlags       // $2001
+	status       StatusFlags     // $2002
+	oamAddr      uint8           // $2003
+	oamData      [256]byte       // $2004
+	nameTable    [2][1024]byte   // $2000-$2FFF
+	paletteTable [32]byte        // $3F00-$3FFF
 
 	vramAddr   vramAddr
 	tmpAddr    vramAddr
@@ -78,19 +79,38 @@ type PPU struct {
 	spriteCount    int
 	spriteScanline [64]Sprite
 
-	cycle       int
-	scanline    int
-	dmaCallback dmaFunc
+	cycle    int
+	scanline int
 }
 
 func New(cart ines.Cartridge) *PPU {
+	snooper, _ := ines.AsPPUSnooper(cart)
+
 	return &PPU{
 		cart:        cart,
+		snooper:     snooper,
+		colors:      &DefaultPalette,
 		transparent: make([]bool, FrameWidth*FrameHeight),
+		pixels:      make([]uint16, FrameWidth*FrameHeight),
 		Frame:       make([]color.RGBA, FrameWidth*FrameHeight),
 	}
 }
 
+// InsertCartridge replaces the cartridge with another one, clearing the memory
+// of the old game, as it would be after the power off. Must be followed by
+// Reset.
+func (p *PPU) InsertCartridge(cart ines.Cartridge) {
+	p.cart = cart
+	p.snooper, _ = ines.AsPPUSnooper(cart)
+	p.oamData = [256]byte{}
+	p.nameTable = [2][1024]byte{}
+	p.paletteTable = [32]byte{}
+
+	clear(p.Frame)
+	clear(p.pixels)
+	clear(p.transparent)
+}
+
 func (p *PPU) Reset() {
 	p.ctrl = 0
 	p.mask = 0
@@ -176,6 +196,10 @@ func (p *PPU) Read(addr uint16) uint8 {
 }
 
 func (p *PPU) Write(addr uint16, data uint8) {
+	if p.snooper != nil {
+		p.snooper.WritePPU(addr, data)
+	}
+
 	switch addr & 0x2007 {
 	case 0x2000:
 		// Setting the NMI flag during blank should immediately trigger an NMI.
@@ -217,13 +241,14 @@ func (p *PPU) Write(addr uint16, data uint8) {
 	}
 }
 
-func (p *PPU) SetDMACallback(callback dmaFunc) {
-	p.dmaCallback = callback
+// SetPalette changes the palette the next frames are drawn with.
+func (p *PPU) SetPalette(colors *Palette) {
+	p.colors = colors
 }
 
-func (p *PPU) TransferOAM(pageAddr uint8) {
-	addr := uint16(pageAddr) << 8
-	p.dmaCallback(addr, p.oamData[:])
+// Palette returns the palette the frames are drawn with.
+func (p *PPU) Palette() *Palette {
+	return p.colors
 }
 
 // nameTableIdx returns the index of the nametable (0 or 1) for the given vram
@@ -267,6 +292,10 @@ func (p *PPU) readVRAM(addr uint16) uint8 {
 		return p.cart.ReadCHR(addr)
 	case addr <= 0x3EFF:
 		addr = addr & 0x2FFF
+		if p.snooper != nil {
+			return p.snooper.ReadNameTable(addr, &p.nameTable)
+		}
+
 		idx := p.nameTableIdx(addr)
 		return p.nameTable[idx][addr%1024]
 	case addr <= 0x3FFF:
@@ -294,6 +323,11 @@ func (p *PPU) writeVRAM(addr uint16, data uint8) {
 		p.cart.WriteCHR(addr, data)
 	case addr <= 0x3EFF:
 		addr = addr & 0x2FFF
+		if p.snooper != nil {
+			p.snooper.WriteNameTable(addr, data, &p.nameTable)
+			return
+		}
+
 		idx := p.nameTableIdx(addr)
 		p.nameTable[idx][addr%1024] = data
 	case addr <= 0x3FFF:
@@ -308,30 +342,122 @@ func (p *PPU) writeVRAM(addr uint16, data uint8) {
 	}
 }
 
-// clearFrame fills the frame with the given color.
-func (p *PPU) clearFrame(c color.RGBA) {
+// PeekVRAM reads the PPU address space without changing the state of the PPU,
+// unlike reading through the $2007 register. Meant for debugging.
+func (p *PPU) PeekVRAM(addr uint16) uint8 {
+	return p.readVRAM(addr % 0x4000)
+}
+
+// PokeVRAM writes to the PPU address space, bypassing the registers.
+func (p *PPU) PokeVRAM(addr uint16, data uint8) {
+	p.writeVRAM(addr%0x4000, data)
+}
+
+// OAM returns the sprite attribute memory, which can be modified in place.
+func (p *PPU) OAM() []byte {
+	return p.oamData[:]
+}
+
+// Registers is the state of the PPU registers and the current position, as
+// seen by the debugging tools.
+type Registers struct {
+	Ctrl     CtrlFlags
+	Mask     MaskFlags
+	Status   StatusFlags
+	VRAMAddr uint16
+	ScrollX  int // from the temporary address, as set with $2000 and $2005
+	ScrollY  int
+	Scanline int
+	Dot      int
+}
+
+// Beam returns the scanline and the dot being drawn, for the light guns.
+func (p *PPU) Beam() (scanline, dot int) {
+	return p.scanline, p.cycle
+}
+
+// PixelIndex returns the palette index of the pixel of the frame, with the
+// emphasis bits, or black if it is outside of the frame. Unlike Frame, it does
+// not depend on the palette, and is drawn during fast-forward with LightGun.
+func (p *PPU) PixelIndex(x, y int) uint16 {
+	if x < 0 || x >= FrameWidth || y < 0 || y >= FrameHeight {
+		return 0x0F
+	}
+
+	return p.pixels[y*FrameWidth+x]
+}
+
+// Registers returns the state of the registers without changing it, unlike
+// reading them through the bus.
+func (p *PPU) Registers() Registers {
+	t := p.tmpAddr
+
+	return Registers{
+		Ctrl:     p.ctrl,
+		Mask:     p.mask,
+		Status:   p.status,
+		VRAMAddr: uint16(p.vramAddr),
+		ScrollX:  int(t.nametableX()*256 + t.coarseX()*8 + uint16(p.fineX)),
+		ScrollY:  int(t.nametableY()*240 + t.coarseY()*8 + t.fineY()),
+		Scanline: p.scanline,
+		Dot:      p.cycle,
+	}
+}
+
+// clearFrame fills the frame with the given palette index. During fast-forward
+// only the transparency and the indexes are reset, as they are still needed for
+// the sprite zero hit and the light gun.
+func (p *PPU) clearFrame(idx uint16) {
+	p.transparent[0] = false
+	p.pixels[0] = idx
+
 	if p.FastForward {
+		for i := 1; i < len(p.transparent); i *= 2 {
+			copy(p.transparent[i:], p.transparent[:i])
+			copy(p.pixels[i:], p.pixels[:i])
+		}
+
 		return
 	}
 
-	p.Frame[0] = c
-	p.transparent[0] = false
+	p.Frame[0] = p.colors[idx]
 
 	// Incremental copy optimization.
 	// See https://gist.github.com/taylorza/df2f89d5f9ab3ffd06865062a4cf015d
 	for i := 1; i < len(p.Frame); i *= 2 {
 		copy(p.Frame[i:], p.Frame[:i])
+		copy(p.pixels[i:], p.pixels[:i])
 		copy(p.transparent[i:], p.transparent[:i])
 	}
 }
 
-func (p *PPU) backdropColor() color.RGBA {
+// paletteIndex returns the index of the color with the current emphasis bits.
+func (p *PPU) paletteIndex(idx uint8) uint16 {
+	emphasis := uint16(p.mask) >> 5
+	return emphasis<<6 | uint16(idx%BaseColors)
+}
+
+func (p *PPU) backdropIndex() uint16 {
 	idx := p.readVRAM(0x3F00)
-	return Colors[idx]
+	return p.paletteIndex(idx)
 }
 
+// setPixel draws the pixel of the palette index. During fast-forward, only the
+// index is kept.
+func (p *PPU) setPixel(offset int, idx uint16) {
+	p.pixels[offset] = idx
+
+	if !p.FastForward {
+		p.Frame[offset] = p.colors[idx]
+	}
+}
+
+// renderScanline renders the current scanline into the frame. During
+// fast-forward, nothing is drawn, and the scanline is only rendered when it may
+// set the sprite zero hit, the same way it does with the frame drawn, or when
+// the light gun may look at it.
 func (p *PPU) renderScanline() {
-	if p.FastForward {
+	if p.FastForward && !p.LightGun && !p.spriteZeroHitPossible() {
 		return
 	}
 
@@ -344,30 +470,45 @@ func (p *PPU) renderScanline() {
 	}
 }
 
+// spriteZeroHitPossible returns true if sprite zero is on the current scanline
+// and has not hit the background yet during this frame.
+func (p *PPU) spriteZeroHitPossible() bool {
+	if !p.getMask(MaskShowSprites) || p.getStatus(StatusSpriteZeroHit) {
+		return false
+	}
+
+	for i := 0; i < p.spriteCount; i++ {
+		if p.spriteScanline[i].Index == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (p *PPU) renderingEnabled() bool {
 	return p.getMask(MaskShowBackground) || p.getMask(MaskShowSprites)
 }
 
-func (p *PPU) fastSpriteZeroHit() bool {
-	spriteX, spriteY := int(p.oamData[3]), int(p.oamData[0])
-	frameY, frameX := p.scanline, p.cycle
-	spriteY += 1
-
-	// Check if the scanline is within the sprite's horizontal range.
-	if frameX < spriteX || frameX >= spriteX+8 {
-		return false
+// vblankScanline returns the scanline the vertical blank starts at. The Dendy
+// draws 312 scanlines for the 50Hz TVs, but keeps the vertical blank of 20
+// scanlines the NTSC games expect, starting it 50 scanlines later instead.
+// https://www.nesdev.org/wiki/Cycle_reference_chart
+func (p *PPU) vblankScanline() int {
+	if p.Dendy {
+		return 291
 	}
 
-	// Check if the scanline is within the sprite's vertical range.
-	if frameY < spriteY || frameY >= spriteY+p.spriteHeight() {
-		return false
-	}
+	return 241
+}
 
-	pixelX, pixelY := frameX%8, frameY%8
-	spritePixel := p.fetchSpritePixel(0, frameX-spriteX, frameY-spriteY)
-	tilePixel := p.fetchTileScanline(frameX/8, frameY/8, pixelY).Pixels[pixelX]
+// lastScanline returns the number of the scanline the pre-render one follows.
+func (p *PPU) lastScanline() int {
+	if p.Dendy {
+		return 311
+	}
 
-	return spritePixel != 0 && tilePixel != 0
+	return 261
 }
 
 func (p *PPU) Tick() {
@@ -377,23 +518,17 @@ func (p *PPU) Tick() {
 			p.setStatus(StatusSpriteOverflow, false)
 			p.setStatus(StatusSpriteZeroHit, false)
 			p.setStatus(StatusVBlank, false)
-			p.clearFrame(p.backdropColor())
+			p.clearFrame(p.backdropIndex())
 		}
 
-		// Skip the first cycle of the first scanline on odd frames.
-		if p.scanline == 0 {
+		// Skip the first cycle of the first scanline on odd frames, which
+		// the Dendy does not do.
+		if p.scanline == 0 && !p.Dendy {
 			if p.cycle == 0 && p.oddFrame {
 				p.cycle = 1
 			}
 		}
 
-		// Manual sprite zero hit detection during fast-forward.
-		if p.FastForward && p.cycle >= 0 && p.cycle <= 255 {
-			if p.renderingEnabled() && !p.getStatus(StatusSpriteZeroHit) {
-				p.setStatus(StatusSpriteZeroHit, p.fastSpriteZeroHit())
-			}
-		}
-
 		// Increment scrollX every 8 cycles (tile width).
 		if p.cycle%8 == 0 && p.cycle <= 256 {
 			if p.renderingEnabled() {
@@ -421,7 +556,13 @@ func (p *PPU) Tick() {
 			}
 
 			if p.renderingEnabled() {
-				p.evaluateSprites()
+				if p.snooper != nil {
+					p.snooper.FetchSprites(true)
+					p.evaluateSprites()
+					p.snooper.FetchSprites(false)
+				} else {
+					p.evaluateSprites()
+				}
 			}
 
 			p.ScanlineComplete = true
@@ -446,7 +587,7 @@ func (p *PPU) Tick() {
 	}
 
 	// Start of vertical blank.
-	if p.scanline == 241 {
+	if p.scanline == p.vblankScanline() {
 		if p.cycle == 1 {
 			p.setStatus(StatusVBlank, true)
 			p.FrameComplete = true
@@ -462,7 +603,9 @@ func (p *PPU) Tick() {
 		p.cycle = 0
 		p.scanline++
 
-		if p.scanline == 261 {
+		// The timing may be switched in the middle of the frame, which then
+		// ends early.
+		if p.scanline >= p.lastScanline() {
 			p.oddFrame = !p.oddFrame
 			p.scanline = -1
 		}
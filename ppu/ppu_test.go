@@ -0,0 +1,180 @@
+package ppu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/internal/binario"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newTestPPU creates the PPU with a cartridge where every tile is solid, and
+// sprite zero in the top left corner over the background, so that it hits the
+// background on every frame.
+func newTestPPU(t *testing.T) *PPU {
+	t.Helper()
+
+	data := testutil.NewROMFile(0, 1, 1)
+
+	chr := data.CHR()
+	for i := range chr {
+		chr[i] = 0xFF
+	}
+
+	rom, err := ines.NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(cart)
+	p.Reset()
+	p.Write(0x2000, uint8(CtrlNMI))
+	p.Write(0x2001, uint8(MaskShowBackground|MaskShowSprites|MaskShowLeftTiles|MaskShowLeftSprites))
+
+	return p
+}
+
+func saveState(t *testing.T, p *PPU) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := p.SaveState(binario.NewWriter(&buf, binary.LittleEndian)); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// Fast-forward only skips drawing the frame, so the sprite zero hit and the NMI
+// must happen on the same dot as without it, and the state must be the same.
+func TestPPU_FastForward(t *testing.T) {
+	normal, fast := newTestPPU(t), newTestPPU(t)
+	fast.FastForward = true
+
+	var hits int
+
+	for frame := 0; frame < 3; frame++ {
+		for {
+			normal.Tick()
+			fast.Tick()
+
+			hit := normal.getStatus(StatusSpriteZeroHit)
+			if hit != fast.getStatus(StatusSpriteZeroHit) {
+				t.Fatalf("sprite zero hit differs at scanline %d, dot %d", normal.scanline, normal.cycle)
+			}
+
+			if normal.PendingNMI != fast.PendingNMI {
+				t.Fatalf("nmi differs at scanline %d, dot %d", normal.scanline, normal.cycle)
+			}
+
+			if hit && normal.scanline == 1 && normal.cycle == 258 {
+				hits++
+			}
+
+			normal.PendingNMI, fast.PendingNMI = false, false
+
+			if normal.FrameComplete {
+				normal.FrameComplete, fast.FrameComplete = false, false
+				break
+			}
+		}
+
+		if !bytes.Equal(saveState(t, normal), saveState(t, fast)) {
+			t.Fatalf("state differs after frame %d", frame)
+		}
+	}
+
+	testutil.Equal(t, hits, 3)
+}
+
+// With the light gun, the palette indexes are drawn during fast-forward the
+// same as without it, while the colors are not.
+func TestPPU_FastForwardLightGun(t *testing.T) {
+	normal, fast := newTestPPU(t), newTestPPU(t)
+	fast.FastForward, fast.LightGun = true, true
+
+	for _, p := range []*PPU{normal, fast} {
+		p.PokeVRAM(0x3F03, 0x30) // white for the solid tiles
+	}
+
+	for !normal.FrameComplete {
+		normal.Tick()
+		fast.Tick()
+	}
+
+	testutil.Equal(t, slices.Equal(normal.pixels, fast.pixels), true)
+	testutil.Equal(t, fast.PixelIndex(100, 100), uint16(0x30))
+	testutil.Equal(t, fast.PixelIndex(-1, 100), uint16(0x0F))
+	testutil.Equal(t, fast.Frame[100*FrameWidth+100].A, uint8(0)) // not drawn
+}
+
+// ticksToVBlank ticks the PPU until the vertical blank starts, and returns the
+// number of ticks along with the scanline it started on.
+func ticksToVBlank(p *PPU) (ticks, scanline int) {
+	for !p.FrameComplete {
+		p.Tick()
+		ticks++
+	}
+
+	p.FrameComplete = false
+
+	return ticks, p.scanline
+}
+
+// The NTSC frames skip a dot on every other frame with rendering enabled, the
+// Dendy ones are all 341x312 dots, with the vertical blank 50 scanlines later.
+func TestPPU_Timing(t *testing.T) {
+	tests := map[string]struct {
+		dendy    bool
+		frames   [2]int
+		scanline int
+	}{
+		"NTSC":  {dendy: false, frames: [2]int{341*262 - 1, 341 * 262}, scanline: 241},
+		"Dendy": {dendy: true, frames: [2]int{341 * 312, 341 * 312}, scanline: 291},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := newTestPPU(t)
+			p.Dendy = tt.dendy
+
+			ticksToVBlank(p)
+
+			for _, want := range tt.frames {
+				ticks, scanline := ticksToVBlank(p)
+				testutil.Equal(t, ticks, want)
+				testutil.Equal(t, scanline, tt.scanline)
+				testutil.Equal(t, p.PendingNMI, true)
+				p.PendingNMI = false
+			}
+		})
+	}
+}
+
+// Switching to NTSC past its last scanline ends the frame right away.
+func TestPPU_TimingSwitch(t *testing.T) {
+	p := newTestPPU(t)
+	p.Dendy = true
+
+	ticksToVBlank(p)
+
+	for p.scanline < 300 {
+		p.Tick()
+	}
+
+	p.Dendy = false
+
+	for p.scanline == 300 {
+		p.Tick()
+	}
+
+	testutil.Equal(t, p.scanline, -1)
+}
@@ -1,9 +1,5 @@
 package ppu
 
-import (
-	"image/color"
-)
-
 const (
 	spriteAttrPalette  = 0x03 // two bits
 	spriteAttrPriority = 1 << 5
@@ -52,26 +48,6 @@ func (p *PPU) spriteAddr(tableOffset uint16, spriteID uint8, y, height int) uint
 	return tableOffset + uint16(spriteID)*16 + uint16(y)
 }
 
-// fetchSpritePixel returns the pixel value (0-3) for the given sprite at the
-// given x/y coordinates. This is used for sprite zero hit detection, when we
-// don’t need the whole sprite data, and just want to know if it’s visible.
-func (p *PPU) fetchSpritePixel(idx int, x, y int) uint8 {
-	var (
-		tableAddr = p.spritePatternTableOffset()
-		spriteID  = p.oamData[idx*4+1]
-		height    = p.spriteHeight()
-	)
-
-	addr := p.spriteAddr(tableAddr, spriteID, y, height)
-	p1 := p.readVRAM(addr + 0)
-	p2 := p.readVRAM(addr + 8)
-
-	px := p1 & (0x80 >> x) >> (7 - x) << 0
-	px |= (p2 & (0x80 >> x) >> (7 - x)) << 1
-
-	return px
-}
-
 // fetchSpriteScanline returns the sprite data for the given sprite index.
 func (p *PPU) fetchSpriteScanline(idx int, y int) Sprite {
 	var (
@@ -146,11 +122,11 @@ func (p *PPU) evaluateSprites() {
 	}
 }
 
-// readSpriteColor returns the RGBA color for the given pixel value and palette ID.
-func (p *PPU) readSpriteColor(pixel, paletteID uint8) color.RGBA {
+// readSpriteColor returns the palette index for the given pixel value and palette ID.
+func (p *PPU) readSpriteColor(pixel, paletteID uint8) uint16 {
 	colorAddr := 0x3F10 + uint16(paletteID)*4 + uint16(pixel)
 	colorIdx := p.readVRAM(colorAddr)
-	return Colors[colorIdx%64]
+	return p.paletteIndex(colorIdx)
 }
 
 // renderSpriteScanline renders the sprites currently in the p.spriteScanline array.
@@ -185,10 +161,10 @@ func (p *PPU) renderSpriteScanline() {
 				continue
 			}
 
-			p.Frame[frameY*FrameWidth+frameX] = p.readSpriteColor(
+			p.setPixel(frameY*FrameWidth+frameX, p.readSpriteColor(
 				sprite.Pixels[pixelX],
 				sprite.PaletteID,
-			)
+			))
 		}
 	}
 }
@@ -15,17 +15,17 @@ func (p *PPU) SaveState(w *binario.Writer) error {
 		w.WriteUint8(p.mask),
 		w.WriteUint8(p.status),
 		w.WriteUint8(p.oamAddr),
-		w.WriteByteSlice(p.oamData[:]),
+		w.WriteVarBytes(p.oamData[:]),
 		w.WriteUint16(uint16(p.vramAddr)),
 		w.WriteUint16(uint16(p.tmpAddr)),
 		w.WriteUint8(p.vramBuffer),
 		w.WriteBool(p.addrLatch),
 		w.WriteUint8(p.fineX),
-		w.WriteByteSlice(p.nameTable[0][:]),
-		w.WriteByteSlice(p.nameTable[1][:]),
-		w.WriteByteSlice(p.paletteTable[:]),
-		w.WriteUint64(uint64(p.cycle)),
-		w.WriteUint64(uint64(p.scanline)),
+		w.WriteVarBytes(p.nameTable[0][:]),
+		w.WriteVarBytes(p.nameTable[1][:]),
+		w.WriteVarBytes(p.paletteTable[:]),
+		w.WriteVarUint(uint64(p.cycle)),
+		w.WriteVarUint(uint64(p.scanline)),
 		w.WriteBool(p.oddFrame),
 	)
 }
@@ -46,17 +46,17 @@ func (p *PPU) LoadState(r *binario.Reader) error {
 		r.ReadUint8To(&p.mask),
 		r.ReadUint8To(&p.status),
 		r.ReadUint8To(&p.oamAddr),
-		r.ReadByteSliceTo(p.oamData[:]),
+		r.ReadVarBytesTo(p.oamData[:]),
 		r.ReadUint16To(&currAddr),
 		r.ReadUint16To(&tmpAddr),
 		r.ReadUint8To(&p.vramBuffer),
 		r.ReadBoolTo(&p.addrLatch),
 		r.ReadUint8To(&p.fineX),
-		r.ReadByteSliceTo(p.nameTable[0][:]),
-		r.ReadByteSliceTo(p.nameTable[1][:]),
-		r.ReadByteSliceTo(p.paletteTable[:]),
-		r.ReadUint64To(&cycle),
-		r.ReadUint64To(&scanline),
+		r.ReadVarBytesTo(p.nameTable[0][:]),
+		r.ReadVarBytesTo(p.nameTable[1][:]),
+		r.ReadVarBytesTo(p.paletteTable[:]),
+		r.ReadVarUintTo(&cycle),
+		r.ReadVarUintTo(&scanline),
 		r.ReadBoolTo(&p.oddFrame),
 	)
 
@@ -67,3 +67,38 @@ func (p *PPU) LoadState(r *binario.Reader) error {
 
 	return err
 }
+
+// ImportedState is the state of the PPU saved by another emulator. It only has
+// what is visible to the game, which all the emulators save the same way.
+type ImportedState struct {
+	Ctrl       CtrlFlags
+	Mask       MaskFlags
+	Status     StatusFlags
+	OAMAddr    uint8
+	VRAMAddr   uint16
+	TmpAddr    uint16
+	FineX      uint8
+	AddrLatch  bool
+	VRAMBuffer uint8
+	OAM        [256]byte
+	NameTables [2][1024]byte // the two physical nametables, before mirroring
+	Palette    [32]byte
+}
+
+// Import replaces the state of the PPU with the imported one. The position of
+// the beam and the sprites of the scanline are left as they are, as the other
+// emulators save them differently, if at all.
+func (p *PPU) Import(s *ImportedState) {
+	p.ctrl = s.Ctrl
+	p.mask = s.Mask
+	p.status = s.Status
+	p.oamAddr = s.OAMAddr
+	p.vramAddr = vramAddr(s.VRAMAddr & 0x7FFF)
+	p.tmpAddr = vramAddr(s.TmpAddr & 0x7FFF)
+	p.fineX = s.FineX & 0x07
+	p.addrLatch = s.AddrLatch
+	p.vramBuffer = s.VRAMBuffer
+	p.oamData = s.OAM
+	p.nameTable = s.NameTables
+	p.paletteTable = s.Palette
+}
@@ -1,7 +1,7 @@
 package ppu
 
 import (
-	"image/color"
+	"github.com/maxpoletaev/dendy/ines"
 )
 
 type Tile struct {
@@ -20,7 +20,8 @@ func (p *PPU) tilePatternTableOffset() uint16 {
 
 // fetchTileLine fetches a 8x1 tile line from the pattern table.
 // We usually don’t need the full tile, just the line we’re currently rendering.
-func (p *PPU) fetchTileScanline(tileX, tileY, y int) (tile Tile) {
+// The column is the position of the tile on the screen, for the mappers.
+func (p *PPU) fetchTileScanline(tileX, tileY, y, column int) (tile Tile) {
 	nametableID := p.vramAddr.nametable()
 
 	if tileX >= 32 {
@@ -29,15 +30,37 @@ func (p *PPU) fetchTileScanline(tileX, tileY, y int) (tile Tile) {
 	}
 
 	nametableAddr := 0x2000 + uint16(nametableID)*0x0400
-	tileID := p.readVRAM(nametableAddr + uint16(tileY)*32 + uint16(tileX))
+	tileIDAddr := nametableAddr + uint16(tileY)*32 + uint16(tileX)
+	tileID := p.readVRAM(tileIDAddr)
 	tileAddr := p.tilePatternTableOffset() + uint16(tileID)*16
 
 	attrtableAddr := 0x23C0 + uint16(nametableID)*0x0400
 	attrAddr := attrtableAddr + uint16(tileX)/4 + uint16(tileY)/4*8
 	attr := p.readVRAM(attrAddr)
 
-	p1 := p.readVRAM(tileAddr + uint16(y) + 0)
-	p2 := p.readVRAM(tileAddr + uint16(y) + 8)
+	// two-bit palette ID
+	blockID := uint16(tileX%4/2) + uint16(tileY%4/2)*2
+	tile.PaletteID = (attr >> (blockID * 2)) & 0x03
+
+	var p1, p2 uint8
+
+	if p.snooper != nil {
+		t := ines.BackgroundTile{
+			Column:   column,
+			Scanline: p.scanline,
+			Addr:     tileIDAddr,
+			TileID:   tileID,
+			FineY:    uint8(y),
+			Pattern:  tileAddr + uint16(y),
+			Palette:  tile.PaletteID,
+		}
+
+		p.snooper.FetchBackground(&t)
+		p1, p2, tile.PaletteID = t.Low, t.High, t.Palette
+	} else {
+		p1 = p.readVRAM(tileAddr + uint16(y) + 0)
+		p2 = p.readVRAM(tileAddr + uint16(y) + 8)
+	}
 
 	for x := 0; x < 8; x++ {
 		pixel := p1 & (0x80 >> x) >> (7 - x) << 0
@@ -45,18 +68,14 @@ func (p *PPU) fetchTileScanline(tileX, tileY, y int) (tile Tile) {
 		tile.Pixels[x] = pixel // two-bit pixel value
 	}
 
-	// two-bit palette ID
-	blockID := uint16(tileX%4/2) + uint16(tileY%4/2)*2
-	tile.PaletteID = (attr >> (blockID * 2)) & 0x03
-
 	return tile
 }
 
-// readTileColor returns the color for the given pixel and palette ID.
-func (p *PPU) readTileColor(pixel, paletteID uint8) color.RGBA {
+// readTileColor returns the palette index for the given pixel and palette ID.
+func (p *PPU) readTileColor(pixel, paletteID uint8) uint16 {
 	colorAddr := 0x3F00 + uint16(paletteID)*4 + uint16(pixel)
 	colorIdx := p.readVRAM(colorAddr)
-	return Colors[colorIdx%64]
+	return p.paletteIndex(colorIdx)
 }
 
 // renderTileScanline renders the current scanline using the background tiles.
@@ -87,7 +106,7 @@ func (p *PPU) renderTileScanline() {
 		// cross a tile boundary. We don’t need a full tile here either, just the line
 		// we’re currently rendering.
 		if tileX != lastTileX {
-			tile = p.fetchTileScanline(tileX, tileY, pixelY)
+			tile = p.fetchTileScanline(tileX, tileY, pixelY, tileX-int(scrollX/8))
 			lastTileX = tileX
 		}
 
@@ -97,7 +116,7 @@ func (p *PPU) renderTileScanline() {
 			continue
 		}
 
-		p.Frame[frameY*FrameWidth+frameX] = p.readTileColor(pixel, tile.PaletteID)
+		p.setPixel(frameY*FrameWidth+frameX, p.readTileColor(pixel, tile.PaletteID))
 		p.transparent[frameY*FrameWidth+frameX] = false
 	}
 }
@@ -0,0 +1,86 @@
+package ramwatch
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const fileHeader = "# RAM watches, one per line: <address> <u8|u16|bcd> <dec|hex|bin> [name]\n"
+
+// Load reads the watch file, a text file with a watch per line: the address in
+// hex, the type, the base, and an optional name, e.g. "0075 u8 dec Health".
+// Empty lines and the lines starting with # are ignored.
+func Load(filename string, read func(addr uint16) uint8) (*List, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var (
+		l       = NewList(read)
+		scanner = bufio.NewScanner(f)
+		lineNum = 0
+	)
+
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected <address> <type> <base> [name]", filename, lineNum)
+		}
+
+		addr, err := strconv.ParseUint(strings.TrimPrefix(fields[0], "$"), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid address %q", filename, lineNum, fields[0])
+		}
+
+		w := l.Add(uint16(addr), strings.Join(fields[3:], " "))
+
+		var ok bool
+
+		if w.Type, ok = parseName[Type](typeNames, fields[1]); !ok {
+			return nil, fmt.Errorf("%s:%d: unknown type %q", filename, lineNum, fields[1])
+		}
+
+		if w.Base, ok = parseName[Base](baseNames, fields[2]); !ok {
+			return nil, fmt.Errorf("%s:%d: unknown base %q", filename, lineNum, fields[2])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Save writes the watches to the file in the format read by Load.
+func (l *List) Save(filename string) error {
+	var sb strings.Builder
+
+	sb.WriteString(fileHeader)
+
+	for _, w := range l.watches {
+		line := fmt.Sprintf("%04X %s %s", w.Addr, w.Type, w.Base)
+		if w.Name != "" {
+			line += " " + w.Name
+		}
+
+		sb.WriteString(line + "\n")
+	}
+
+	return os.WriteFile(filename, []byte(sb.String()), 0644)
+}
@@ -0,0 +1,139 @@
+// Package ramwatch keeps the RAM addresses the user has pinned to watch their
+// values while playing, such as the player health, with a name and the way the
+// value is displayed.
+package ramwatch
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Type is how the bytes at the address are read.
+type Type uint8
+
+const (
+	U8  Type = iota // unsigned byte
+	U16             // unsigned little-endian word, the byte at the address first
+	BCD             // byte with a decimal digit in each nibble, as in the scores
+)
+
+var typeNames = []string{"u8", "u16", "bcd"}
+
+func (t Type) String() string {
+	return typeNames[t]
+}
+
+// Base is how the number is displayed. It has no effect on BCD values, which
+// are always shown in decimal.
+type Base uint8
+
+const (
+	Dec Base = iota
+	Hex
+	Bin
+)
+
+var baseNames = []string{"dec", "hex", "bin"}
+
+func (b Base) String() string {
+	return baseNames[b]
+}
+
+func parseName[T ~uint8](names []string, s string) (T, bool) {
+	for i, name := range names {
+		if name == s {
+			return T(i), true
+		}
+	}
+
+	return 0, false
+}
+
+// Watch is a single watched address.
+type Watch struct {
+	Addr uint16
+	Name string // optional, the address is shown without it
+	Type Type
+	Base Base
+}
+
+// Label returns the name of the watch, or the address if there is none.
+func (w *Watch) Label() string {
+	if w.Name != "" {
+		return w.Name
+	}
+
+	return fmt.Sprintf("$%04X", w.Addr)
+}
+
+// CycleType switches to the next type.
+func (w *Watch) CycleType() {
+	w.Type = (w.Type + 1) % Type(len(typeNames))
+}
+
+// CycleBase switches to the next base.
+func (w *Watch) CycleBase() {
+	w.Base = (w.Base + 1) % Base(len(baseNames))
+}
+
+// List is the set of the watches of the running game, in the order they are
+// displayed.
+type List struct {
+	read    func(addr uint16) uint8
+	watches []*Watch
+}
+
+// NewList creates an empty list reading the values with the function, which
+// must have no side effects, such as system.System.Peek.
+func NewList(read func(addr uint16) uint8) *List {
+	return &List{read: read}
+}
+
+// Add adds the watch of the byte at the address, displayed in decimal.
+func (l *List) Add(addr uint16, name string) *Watch {
+	w := &Watch{Addr: addr, Name: name}
+	l.watches = append(l.watches, w)
+
+	return w
+}
+
+// Remove removes the watch from the list.
+func (l *List) Remove(w *Watch) {
+	for i, other := range l.watches {
+		if other == w {
+			l.watches = append(l.watches[:i], l.watches[i+1:]...)
+			return
+		}
+	}
+}
+
+// Watches returns the watches in the order they were added.
+func (l *List) Watches() []*Watch {
+	return l.watches
+}
+
+// Value returns the current value of the watch, formatted with its type and
+// base.
+func (l *List) Value(w *Watch) string {
+	var (
+		value = uint64(l.read(w.Addr))
+		width = 2 // hex digits
+	)
+
+	switch w.Type {
+	case U16:
+		value |= uint64(l.read(w.Addr+1)) << 8
+		width = 4
+	case BCD:
+		return fmt.Sprintf("%d%d", value>>4, value&0x0F)
+	}
+
+	switch w.Base {
+	case Hex:
+		return fmt.Sprintf("$%0*X", width, value)
+	case Bin:
+		return fmt.Sprintf("%%%0*b", width*4, value)
+	default:
+		return strconv.FormatUint(value, 10)
+	}
+}
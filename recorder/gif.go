@@ -0,0 +1,146 @@
+package recorder
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+
+	"github.com/maxpoletaev/dendy/internal/ringbuf"
+	"github.com/maxpoletaev/dendy/ppu"
+)
+
+const (
+	// GIF frame delays are measured in 1/100s, so 60fps cannot be represented.
+	// Every other frame is kept instead, which gives exactly 30fps.
+	gifFrameStep  = 2
+	gifFrameDelay = 2
+	gifFrameRate  = 60 / gifFrameStep
+	gifMaxColors  = 256
+)
+
+// gifPalette is the NES palette the frames are drawn with. Every frame
+// produced by the PPU only consists of these colors, so no color quantization
+// is needed. The palette may change between the frames, but the colors are
+// stored as the NES color indexes, so they stay the same. A GIF palette holds
+// 256 colors at most, so the colors with the blue emphasis, which is the
+// highest bit, are replaced with the closest ones.
+type gifPalette struct {
+	colors  ppu.Palette
+	palette color.Palette
+	index   map[color.RGBA]uint8
+}
+
+func newGIFPalette(colors ppu.Palette) *gifPalette {
+	m := make(map[color.RGBA]uint8, gifMaxColors)
+
+	// Some colors appear in the palette more than once (e.g. black), keep
+	// the first index for consistency.
+	for i := gifMaxColors - 1; i >= 0; i-- {
+		m[colors[i]] = uint8(i)
+	}
+
+	p := make(color.Palette, gifMaxColors)
+	for i, c := range colors[:gifMaxColors] {
+		p[i] = c
+	}
+
+	return &gifPalette{colors: colors, palette: p, index: m}
+}
+
+// colorIndex returns the index of the color in the GIF palette. The closest
+// color of the ones not in the palette is searched for once and then cached,
+// as the search goes through the whole palette for every pixel. There are only
+// as many of them as the colors of the NES palette, so the cache stays small.
+func (p *gifPalette) colorIndex(c color.RGBA) uint8 {
+	if idx, ok := p.index[c]; ok {
+		return idx
+	}
+
+	idx := uint8(p.palette.Index(c))
+	p.index[c] = idx
+
+	return idx
+}
+
+// GIFRecorder keeps a ring of the most recent frames, so that the last few
+// seconds of gameplay can be saved as an animated GIF at any moment.
+type GIFRecorder struct {
+	frames  *ringbuf.Buffer[[]uint8]
+	palette *gifPalette
+	counter int
+}
+
+// NewGIFRecorder creates a recorder that keeps the given number of seconds.
+func NewGIFRecorder(seconds int) *GIFRecorder {
+	return &GIFRecorder{
+		frames:  ringbuf.New[[]uint8](seconds * gifFrameRate),
+		palette: newGIFPalette(ppu.DefaultPalette),
+	}
+}
+
+// AddFrame stores a copy of the frame drawn with the palette, evicting the
+// oldest one when the buffer is full. Should be called for every frame.
+func (g *GIFRecorder) AddFrame(frame []color.RGBA, colors *ppu.Palette) {
+	g.counter++
+	if g.counter%gifFrameStep != 0 {
+		return
+	}
+
+	var pixels []uint8
+
+	// Reuse the memory of the evicted frame.
+	if g.frames.Full() {
+		pixels = g.frames.PopFront()
+	} else {
+		pixels = make([]uint8, ppu.FrameWidth*ppu.FrameHeight)
+	}
+
+	if g.palette.colors != *colors {
+		g.palette = newGIFPalette(*colors)
+	}
+
+	for i, c := range frame {
+		pixels[i] = g.palette.colorIndex(c)
+	}
+
+	g.frames.PushBack(pixels)
+}
+
+// Len returns the number of frames currently stored.
+func (g *GIFRecorder) Len() int {
+	return g.frames.Len()
+}
+
+// Flush detaches the recorded frames and returns a function that encodes them,
+// so that the encoding can run in background while the recording continues.
+func (g *GIFRecorder) Flush() func(w io.Writer) error {
+	frames, palette := g.frames, g.palette.palette
+	g.frames = ringbuf.New[[]uint8](frames.Cap())
+
+	return func(w io.Writer) error {
+		return encodeGIF(w, frames, palette)
+	}
+}
+
+func encodeGIF(w io.Writer, frames *ringbuf.Buffer[[]uint8], palette color.Palette) error {
+	anim := &gif.GIF{
+		Image: make([]*image.Paletted, frames.Len()),
+		Delay: make([]int, frames.Len()),
+	}
+
+	bounds := image.Rect(0, 0, ppu.FrameWidth, ppu.FrameHeight)
+
+	for i := 0; i < frames.Len(); i++ {
+		anim.Image[i] = &image.Paletted{
+			Pix:     frames.At(i),
+			Stride:  ppu.FrameWidth,
+			Rect:    bounds,
+			Palette: palette,
+		}
+
+		anim.Delay[i] = gifFrameDelay
+	}
+
+	return gif.EncodeAll(w, anim)
+}
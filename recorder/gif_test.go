@@ -0,0 +1,81 @@
+package recorder
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+	"github.com/maxpoletaev/dendy/ppu"
+)
+
+func testFrame(c color.RGBA) []color.RGBA {
+	frame := make([]color.RGBA, ppu.FrameWidth*ppu.FrameHeight)
+	for i := range frame {
+		frame[i] = c
+	}
+
+	return frame
+}
+
+func TestGIFRecorder_KeepsLastFrames(t *testing.T) {
+	g := NewGIFRecorder(1)
+
+	for i := 0; i < gifFrameRate*gifFrameStep*2; i++ {
+		g.AddFrame(testFrame(ppu.DefaultPalette[i%64]), &ppu.DefaultPalette)
+	}
+
+	testutil.Equal(t, g.Len(), gifFrameRate)
+}
+
+func TestGIFRecorder_Flush(t *testing.T) {
+	g := NewGIFRecorder(1)
+
+	for i := 0; i < gifFrameStep*3; i++ {
+		g.AddFrame(testFrame(ppu.DefaultPalette[0x21]), &ppu.DefaultPalette)
+	}
+
+	encode := g.Flush()
+	testutil.Equal(t, g.Len(), 0)
+
+	buf := bytes.NewBuffer(nil)
+	if err := encode(buf); err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+
+	anim, err := gif.DecodeAll(buf)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+
+	testutil.Equal(t, len(anim.Image), 3)
+	testutil.Equal(t, anim.Delay[0], gifFrameDelay)
+	testutil.Equal(t, anim.Image[0].At(0, 0).(color.RGBA), ppu.DefaultPalette[0x21])
+}
+
+// The colors not in the palette, such as the ones with the blue emphasis, are
+// replaced with the closest ones, which are then cached.
+func TestGIFPalette_ColorIndex(t *testing.T) {
+	p := newGIFPalette(ppu.DefaultPalette)
+	size := len(p.index)
+
+	c := color.RGBA{R: 1, G: 2, B: 3, A: 255}
+	idx := p.colorIndex(c)
+	testutil.Equal(t, int(idx) < gifMaxColors, true)
+	testutil.Equal(t, len(p.index), size+1)
+	testutil.Equal(t, p.colorIndex(c), idx)
+	testutil.Equal(t, len(p.index), size+1)
+
+	testutil.Equal(t, p.colorIndex(ppu.DefaultPalette[0x21]), 0x21)
+	testutil.Equal(t, len(p.index), size+1)
+}
+
+func BenchmarkGIFRecorder_AddFrame(b *testing.B) {
+	g := NewGIFRecorder(1)
+	frame := testFrame(color.RGBA{R: 1, G: 2, B: 3, A: 255})
+
+	for i := 0; i < b.N; i++ {
+		g.AddFrame(frame, &ppu.DefaultPalette)
+	}
+}
@@ -0,0 +1,204 @@
+// Package recorder captures the emulator output into video files by piping raw
+// frames and audio samples to an external ffmpeg process.
+package recorder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"github.com/maxpoletaev/dendy/internal/bytepool"
+	"github.com/maxpoletaev/dendy/ppu"
+)
+
+const (
+	frameSize   = ppu.FrameWidth * ppu.FrameHeight * 4
+	queueSize   = 120 // frames buffered before the emulator starts blocking
+	outputScale = 3   // nearest-neighbor upscale, so that video codecs don't blur the pixels
+)
+
+// Options configures the recording.
+type Options struct {
+	FFmpegPath string // path to the ffmpeg binary, looked up in PATH if empty
+	FrameRate  float64
+	SampleRate int // audio sample rate, audio is not recorded if zero
+}
+
+// Recorder encodes frames and audio into a video file. The output format is
+// determined by ffmpeg from the file extension (e.g. mp4 or webm).
+type Recorder struct {
+	cmd        *exec.Cmd
+	pool       *bytepool.BytePool
+	videoQueue chan bytepool.Buffer
+	audioQueue chan bytepool.Buffer
+	videoDone  chan error
+	audioDone  chan error
+	frames     int
+}
+
+// Start launches ffmpeg to write the video into the given file.
+func Start(filename string, opts Options) (*Recorder, error) {
+	ffmpeg := opts.FFmpegPath
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+
+	args := []string{
+		"-y", "-loglevel", "error",
+		"-f", "rawvideo",
+		"-pixel_format", "rgba",
+		"-video_size", fmt.Sprintf("%dx%d", ppu.FrameWidth, ppu.FrameHeight),
+		"-framerate", strconv.FormatFloat(opts.FrameRate, 'f', -1, 64),
+		"-i", "pipe:0",
+	}
+
+	// The audio is passed through an extra file descriptor, which is not
+	// supported by os/exec on Windows, so the video is recorded without sound.
+	withAudio := opts.SampleRate > 0 && runtime.GOOS != "windows"
+	if opts.SampleRate > 0 && !withAudio {
+		log.Printf("[WARN] audio recording is not supported on %s", runtime.GOOS)
+	}
+
+	if withAudio {
+		args = append(args,
+			"-f", "f32le",
+			"-ar", strconv.Itoa(opts.SampleRate),
+			"-ac", "1",
+			"-i", "pipe:3",
+		)
+	}
+
+	args = append(args,
+		"-vf", fmt.Sprintf("scale=iw*%d:ih*%d:flags=neighbor", outputScale, outputScale),
+		"-pix_fmt", "yuv420p",
+		filename,
+	)
+
+	cmd := exec.Command(ffmpeg, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	videoPipe, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	var audioPipe *os.File
+
+	if withAudio {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+
+		cmd.ExtraFiles = []*os.File{r}
+		audioPipe = w
+
+		// The read end is owned by ffmpeg once it is started.
+		defer func() {
+			_ = r.Close()
+		}()
+	}
+
+	if err := cmd.Start(); err != nil {
+		if audioPipe != nil {
+			_ = audioPipe.Close()
+		}
+
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	rec := &Recorder{
+		cmd:        cmd,
+		pool:       bytepool.New(frameSize),
+		videoQueue: make(chan bytepool.Buffer, queueSize),
+		videoDone:  make(chan error, 1),
+	}
+
+	go rec.writer(videoPipe, rec.videoQueue, rec.videoDone)
+
+	if audioPipe != nil {
+		rec.audioQueue = make(chan bytepool.Buffer, queueSize)
+		rec.audioDone = make(chan error, 1)
+
+		go rec.writer(audioPipe, rec.audioQueue, rec.audioDone)
+	}
+
+	return rec, nil
+}
+
+// writer feeds ffmpeg from a separate goroutine, so that the emulator does not
+// stall when ffmpeg is busy encoding. Both streams need their own goroutine,
+// otherwise ffmpeg may block on reading one while we are writing the other.
+func (r *Recorder) writer(w io.WriteCloser, queue chan bytepool.Buffer, done chan error) {
+	var writeErr error
+
+	for buf := range queue {
+		if writeErr == nil {
+			_, writeErr = w.Write(buf.Data)
+		}
+
+		buf.Free()
+	}
+
+	done <- errors.Join(writeErr, w.Close())
+}
+
+// WriteFrame adds a video frame to the recording.
+func (r *Recorder) WriteFrame(frame []color.RGBA) {
+	buf := r.pool.Buffer(frameSize)
+
+	for i, c := range frame {
+		buf.Data[i*4+0] = c.R
+		buf.Data[i*4+1] = c.G
+		buf.Data[i*4+2] = c.B
+		buf.Data[i*4+3] = c.A
+	}
+
+	r.videoQueue <- buf
+	r.frames++
+}
+
+// WriteAudio adds audio samples to the recording.
+func (r *Recorder) WriteAudio(samples []float32) {
+	if r.audioQueue == nil {
+		return
+	}
+
+	buf := r.pool.Buffer(len(samples) * 4)
+
+	for i, s := range samples {
+		binary.LittleEndian.PutUint32(buf.Data[i*4:], math.Float32bits(s))
+	}
+
+	r.audioQueue <- buf
+}
+
+// Frames returns the number of frames recorded so far.
+func (r *Recorder) Frames() int {
+	return r.frames
+}
+
+// Close finishes the recording and waits for ffmpeg to finalize the file.
+func (r *Recorder) Close() error {
+	// Close both streams before waiting, as ffmpeg may be blocked on either of them.
+	close(r.videoQueue)
+	if r.audioQueue != nil {
+		close(r.audioQueue)
+	}
+
+	err := <-r.videoDone
+	if r.audioQueue != nil {
+		err = errors.Join(err, <-r.audioDone)
+	}
+
+	return errors.Join(err, r.cmd.Wait())
+}
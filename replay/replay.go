@@ -0,0 +1,361 @@
+// Package replay implements the replay files, which record the state the game
+// was started from and the controller input of every frame after it. As the
+// emulation is deterministic, playing the input back from the same state must
+// end in the same state, which the replay stores the checksum of. This makes
+// the replays useful for bug reports and for catching the changes that break
+// the determinism, which netplay relies on.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/maxpoletaev/dendy/consts"
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/binario"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// magic starts the replay files, followed by the format version.
+const magic = "DENDYRPL"
+
+// Version is the version of the replay files. Version 2 has the checksum of the
+// state with the varints, the version 1 of the fixed-width one, and version 3
+// of the one with the DMA, see StateVersion of system. The rest of the file is
+// the same.
+const Version = 3
+
+// The devices plugged into the second port. The Zapper is plugged in during
+// the offline play, but its input is not recorded.
+const (
+	DeviceJoystick = "joystick"
+	DeviceZapper   = "zapper"
+)
+
+// ErrMismatch is returned by Verify when the replay ends in a different state.
+var ErrMismatch = errors.New("replay ended in a different state")
+
+// Replay is the recorded game.
+type Replay struct {
+	ROMFile       string // as it was recorded, to find the ROM to verify with
+	ROMCRC32      uint32
+	Port2         string // DeviceJoystick or DeviceZapper
+	NoSpriteLimit bool
+	State         []byte     // the state file to start from
+	Inputs        [][2]uint8 // the buttons on both controllers, frame by frame
+	FinalCRC32    uint32     // of the state after the last frame
+
+	fileVersion uint16 // of the file it was read from, zero if recorded
+}
+
+// Checksum returns the CRC32 of the state of the system, which is the same for
+// the same state, unlike the state files that have the time in them.
+func Checksum(nes *system.System) uint32 {
+	return checksum(nes, system.StateVersion)
+}
+
+func checksum(nes *system.System, stateVersion uint16) uint32 {
+	var buf bytes.Buffer
+
+	w := binario.NewWriter(&buf, binary.LittleEndian)
+
+	if err := nes.SaveStateVersion(w, stateVersion); err != nil {
+		panic(fmt.Sprintf("replay: failed to save state: %s", err))
+	}
+
+	return crc32.ChecksumIEEE(buf.Bytes())
+}
+
+// Write writes the replay file. It is gzipped, as the input rarely changes
+// between frames.
+func (r *Replay) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	bw := binario.NewWriter(zw, binary.LittleEndian)
+
+	inputs := make([]byte, 0, len(r.Inputs)*2)
+	for _, in := range r.Inputs {
+		inputs = append(inputs, in[0], in[1])
+	}
+
+	err := errors.Join(
+		bw.WriteRawBytes([]byte(magic)),
+		bw.WriteUint16(r.version()),
+		bw.WriteString(r.ROMFile),
+		bw.WriteUint32(r.ROMCRC32),
+		bw.WriteString(r.Port2),
+		bw.WriteBool(r.NoSpriteLimit),
+		bw.WriteByteSlice(r.State),
+		bw.WriteByteSlice(inputs),
+		bw.WriteUint32(r.FinalCRC32),
+	)
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func (r *Replay) version() uint16 {
+	if r.fileVersion != 0 {
+		return r.fileVersion
+	}
+
+	return Version
+}
+
+// stateVersion returns the StateVersion of system the checksum is of.
+func (r *Replay) stateVersion() uint16 {
+	switch r.version() {
+	case 1:
+		return 3 // fixed-width
+	case 2:
+		return 4 // without the DMA
+	default:
+		return system.StateVersion
+	}
+}
+
+// Read reads the replay file written by Write.
+func Read(r io.Reader) (*Replay, error) {
+	zr, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("not a replay file: %w", err)
+	}
+
+	br := binario.NewReader(zr, binary.LittleEndian)
+
+	header := make([]byte, len(magic))
+	if err := br.ReadRawBytesTo(header); err != nil || string(header) != magic {
+		return nil, errors.New("not a replay file")
+	}
+
+	version, err := br.ReadUint16()
+	if err != nil {
+		return nil, err
+	}
+
+	if version > Version {
+		return nil, fmt.Errorf("unsupported replay version %d (up to %d is supported)", version, Version)
+	}
+
+	var (
+		rep    = Replay{fileVersion: version}
+		inputs []byte
+	)
+
+	err = errors.Join(
+		br.ReadStringTo(&rep.ROMFile),
+		br.ReadUint32To(&rep.ROMCRC32),
+		br.ReadStringTo(&rep.Port2),
+		br.ReadBoolTo(&rep.NoSpriteLimit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replay header: %w", err)
+	}
+
+	if rep.State, err = br.ReadByteSlice(); err != nil {
+		return nil, fmt.Errorf("failed to read replay state: %w", err)
+	}
+
+	if inputs, err = br.ReadByteSlice(); err != nil || len(inputs)%2 != 0 {
+		return nil, fmt.Errorf("failed to read replay inputs: %w", err)
+	}
+
+	if err := br.ReadUint32To(&rep.FinalCRC32); err != nil {
+		return nil, fmt.Errorf("failed to read replay checksum: %w", err)
+	}
+
+	rep.Inputs = make([][2]uint8, len(inputs)/2)
+	for i := range rep.Inputs {
+		rep.Inputs[i] = [2]uint8{inputs[i*2], inputs[i*2+1]}
+	}
+
+	return &rep, nil
+}
+
+// Player plays the replay back frame by frame, e.g. to watch it or to render it
+// into a video. The system is ticked by the caller, so that the sound can be
+// sampled along the way.
+type Player struct {
+	replay *Replay
+	nes    *system.System
+	joy1   *input.Joystick
+	joy2   *input.Joystick // nil with the Zapper
+	frame  int
+}
+
+// NewPlayer creates the system with the cartridge inserted, in the state the
+// replay starts from.
+func (r *Replay) NewPlayer(cart ines.Cartridge) (*Player, error) {
+	if crc := cart.ROM().CRC32; crc != r.ROMCRC32 {
+		return nil, fmt.Errorf("%w: replay is for ROM %08X", ines.ErrSavedStateMismatch, r.ROMCRC32)
+	}
+
+	p := &Player{replay: r, joy1: input.NewJoystick()}
+
+	switch r.Port2 {
+	case DeviceJoystick:
+		p.joy2 = input.NewJoystick()
+		p.nes = system.New(cart, p.joy1, p.joy2)
+	case DeviceZapper:
+		p.nes = system.New(cart, p.joy1, input.NewZapper())
+	default:
+		return nil, fmt.Errorf("unknown device in port 2: %q", r.Port2)
+	}
+
+	p.nes.SetNoSpriteLimit(r.NoSpriteLimit)
+
+	if err := p.nes.ReadStateFile(bytes.NewReader(r.State)); err != nil {
+		return nil, fmt.Errorf("failed to load replay state: %w", err)
+	}
+
+	return p, nil
+}
+
+// System returns the system the replay is played on.
+func (p *Player) System() *system.System {
+	return p.nes
+}
+
+// Frame returns the number of frames started so far.
+func (p *Player) Frame() int {
+	return p.frame
+}
+
+// Advance presses the buttons recorded for the next frame. It must be called
+// before the first frame and at the end of every frame. Returns false once all
+// the frames have been played.
+func (p *Player) Advance() bool {
+	if p.frame >= len(p.replay.Inputs) {
+		return false
+	}
+
+	in := p.replay.Inputs[p.frame]
+	p.joy1.SetButtons(in[0])
+
+	if p.joy2 != nil {
+		p.joy2.SetButtons(in[1])
+	}
+
+	p.frame++
+
+	return true
+}
+
+// Verify checks that the system is in the recorded state. It is only
+// meaningful after all the frames have been played.
+func (p *Player) Verify() error {
+	if sum := checksum(p.nes, p.replay.stateVersion()); sum != p.replay.FinalCRC32 {
+		return fmt.Errorf("%w: crc32 is %08X, expected %08X", ErrMismatch, sum, p.replay.FinalCRC32)
+	}
+
+	return nil
+}
+
+// playAll plays the rest of the frames as fast as possible.
+func (p *Player) playAll() {
+	for p.Advance() {
+		for !p.nes.FrameReady() {
+			p.nes.Tick()
+		}
+	}
+}
+
+// Play plays the replay on the new system with the cartridge inserted, and
+// returns the system in the state after the last frame.
+func (r *Replay) Play(cart ines.Cartridge) (*system.System, error) {
+	p, err := r.NewPlayer(cart)
+	if err != nil {
+		return nil, err
+	}
+
+	p.playAll()
+
+	return p.nes, nil
+}
+
+// Verify plays the replay and checks that it ends in the recorded state.
+func (r *Replay) Verify(cart ines.Cartridge) error {
+	p, err := r.NewPlayer(cart)
+	if err != nil {
+		return err
+	}
+
+	p.playAll()
+
+	return p.Verify()
+}
+
+// Recorder records the replay of the running game.
+type Recorder struct {
+	nes        *system.System
+	replay     Replay
+	cycles     uint64 // at the last frame
+	generation uint64
+}
+
+// NewRecorder starts recording the game from its current state, which must be
+// at the end of a frame.
+func NewRecorder(nes *system.System, romFile, port2 string, noSpriteLimit bool) *Recorder {
+	r := &Recorder{nes: nes}
+	r.replay.ROMFile = romFile
+	r.replay.ROMCRC32 = nes.ROM().CRC32
+	r.replay.Port2 = port2
+	r.replay.NoSpriteLimit = noSpriteLimit
+	r.restart()
+
+	return r
+}
+
+func (r *Recorder) restart() {
+	var buf bytes.Buffer
+
+	if err := r.nes.WriteStateFile(&buf); err != nil {
+		panic(fmt.Sprintf("replay: failed to save state: %s", err))
+	}
+
+	r.replay.State = buf.Bytes()
+	r.replay.Inputs = r.replay.Inputs[:0]
+	r.cycles = r.nes.Cycles()
+	r.generation = r.nes.Generation()
+}
+
+// Frame records the buttons held on the controllers since the previous call.
+// It must be called at the end of every frame, before the buttons change, but
+// the frames emulated in between, e.g. while fast-forwarding, are accounted
+// for. If the state has changed other than by the emulation since, e.g. when a
+// state is loaded, the recording starts over from the current state, and true
+// is returned.
+func (r *Recorder) Frame(port1, port2 uint8) (restarted bool) {
+	cycles := r.nes.Cycles()
+
+	if r.nes.Generation() != r.generation || cycles < r.cycles {
+		r.restart()
+		return true
+	}
+
+	frames := int(math.Round(float64(cycles-r.cycles) / (consts.CPUTicksPerFrame * 3)))
+	for i := 0; i < frames; i++ {
+		r.replay.Inputs = append(r.replay.Inputs, [2]uint8{port1, port2})
+	}
+
+	r.cycles = cycles
+
+	return false
+}
+
+// Finish ends the recording at the end of the last frame recorded with Frame.
+func (r *Recorder) Finish() *Replay {
+	rep := r.replay
+	rep.FinalCRC32 = Checksum(r.nes)
+
+	return &rep
+}
@@ -0,0 +1,223 @@
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+const testROM = "../nestest/nestest.nes"
+
+func loadCartridge(t *testing.T) ines.Cartridge {
+	t.Helper()
+
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	rom, err := ines.NewFromFile(testROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cart
+}
+
+func runFrames(nes *system.System, n int) {
+	for i := 0; i < n; i++ {
+		for !nes.FrameReady() {
+			nes.Tick()
+		}
+	}
+}
+
+// record plays nestest, which starts the tests when Start is pressed, and
+// returns the replay of it.
+func record(t *testing.T) *Replay {
+	joy1, joy2 := input.NewJoystick(), input.NewJoystick()
+	nes := system.New(loadCartridge(t), joy1, joy2)
+	rec := NewRecorder(nes, testROM, DeviceJoystick, false)
+
+	for frame := 0; frame < 120; frame++ {
+		runFrames(nes, 1)
+		rec.Frame(joy1.Buttons(), joy2.Buttons())
+
+		if frame >= 30 && frame < 35 {
+			joy1.SetButtons(input.ButtonStart)
+		} else {
+			joy1.SetButtons(0)
+		}
+	}
+
+	return rec.Finish()
+}
+
+func TestReplay_Verify(t *testing.T) {
+	rep := record(t)
+	testutil.Equal(t, len(rep.Inputs), 120)
+
+	var buf bytes.Buffer
+	if err := rep.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, read.ROMFile, testROM)
+	testutil.Equal(t, len(read.Inputs), len(rep.Inputs))
+
+	if err := read.Verify(loadCartridge(t)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplay_VerifyMismatch(t *testing.T) {
+	rep := record(t)
+
+	// Without Start pressed, the tests are never run.
+	for i := range rep.Inputs {
+		rep.Inputs[i][0] = 0
+	}
+
+	if err := rep.Verify(loadCartridge(t)); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+}
+
+// The systems share no state, so that the replays can be verified in parallel,
+// the way the relay does it.
+func TestReplay_VerifyConcurrent(t *testing.T) {
+	rep := record(t)
+
+	carts := make([]ines.Cartridge, 4)
+	for i := range carts {
+		carts[i] = loadCartridge(t)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(carts))
+
+	for i, cart := range carts {
+		wg.Add(1)
+
+		go func(i int, cart ines.Cartridge) {
+			defer wg.Done()
+			errs[i] = rep.Verify(cart)
+		}(i, cart)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// deterministicCRC32 is the checksum of the state at the end of the replay
+// made by record. It must be the same on every GOARCH, see the package doc of
+// system. Run "make determinism" to check the architectures the machine can run,
+// the CI checks amd64, 386 and arm64.
+const deterministicCRC32 = 0xF389E0DE
+
+func TestReplay_Deterministic(t *testing.T) {
+	rep := record(t)
+	testutil.Equal(t, rep.FinalCRC32, deterministicCRC32)
+
+	p, err := rep.NewPlayer(loadCartridge(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Taking the audio samples, which is done in floats, must not change the
+	// state, so that it does not matter whether the audio is played or not.
+	for p.Advance() {
+		nes := p.System()
+
+		for !nes.FrameReady() {
+			nes.Tick()
+			nes.AudioSample()
+		}
+	}
+
+	if err := p.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	rep := record(t)
+
+	p, err := rep.NewPlayer(loadCartridge(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for p.Advance() {
+		runFrames(p.System(), 1)
+	}
+
+	testutil.Equal(t, p.Frame(), len(rep.Inputs))
+
+	if err := p.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecorder_FastForward(t *testing.T) {
+	joy1, joy2 := input.NewJoystick(), input.NewJoystick()
+	nes := system.New(loadCartridge(t), joy1, joy2)
+	rec := NewRecorder(nes, testROM, DeviceJoystick, false)
+
+	runFrames(nes, 1)
+	rec.Frame(0, 0)
+	runFrames(nes, 4)
+	rec.Frame(0, 0)
+
+	rep := rec.Finish()
+	testutil.Equal(t, len(rep.Inputs), 5)
+
+	if err := rep.Verify(loadCartridge(t)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecorder_RestartsOnStateChange(t *testing.T) {
+	joy1, joy2 := input.NewJoystick(), input.NewJoystick()
+	nes := system.New(loadCartridge(t), joy1, joy2)
+	rec := NewRecorder(nes, testROM, DeviceJoystick, false)
+
+	runFrames(nes, 10)
+	testutil.Equal(t, rec.Frame(0, 0), false)
+
+	nes.Poke(0x0000, 0xFF)
+	runFrames(nes, 1)
+	testutil.Equal(t, rec.Frame(0, 0), true)
+
+	runFrames(nes, 3)
+	rec.Frame(0, 0)
+
+	rep := rec.Finish()
+	testutil.Equal(t, len(rep.Inputs), 3)
+
+	if err := rep.Verify(loadCartridge(t)); err != nil {
+		t.Fatal(err)
+	}
+}
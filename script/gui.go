@@ -0,0 +1,293 @@
+package script
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	ppupkg "github.com/maxpoletaev/dendy/ppu"
+)
+
+var colorNames = map[string]color.RGBA{
+	"white":  {255, 255, 255, 255},
+	"black":  {0, 0, 0, 255},
+	"red":    {255, 0, 0, 255},
+	"green":  {0, 255, 0, 255},
+	"blue":   {0, 0, 255, 255},
+	"yellow": {255, 255, 0, 255},
+	"orange": {255, 128, 0, 255},
+	"purple": {128, 0, 255, 255},
+	"gray":   {128, 128, 128, 255},
+	"grey":   {128, 128, 128, 255},
+	"clear":  {0, 0, 0, 0},
+}
+
+// checkColor converts the color argument, which is either a name, an "#RRGGBB"
+// or "#RRGGBBAA" string, a 0xRRGGBBAA number, or an {r=, g=, b=, a=} table.
+func checkColor(L *lua.LState, n int, def color.RGBA) color.RGBA {
+	switch v := L.Get(n).(type) {
+	case *lua.LNilType:
+		return def
+
+	case lua.LNumber:
+		c := uint32(v)
+		return color.RGBA{R: uint8(c >> 24), G: uint8(c >> 16), B: uint8(c >> 8), A: uint8(c)}
+
+	case lua.LString:
+		s := strings.ToLower(string(v))
+		if c, ok := colorNames[s]; ok {
+			return c
+		}
+
+		if hex := strings.TrimPrefix(s, "#"); hex != s && (len(hex) == 6 || len(hex) == 8) {
+			if len(hex) == 6 {
+				hex += "ff"
+			}
+
+			if c, err := strconv.ParseUint(hex, 16, 32); err == nil {
+				return color.RGBA{R: uint8(c >> 24), G: uint8(c >> 16), B: uint8(c >> 8), A: uint8(c)}
+			}
+		}
+
+	case *lua.LTable:
+		component := func(name string, def int) uint8 {
+			if c, ok := v.RawGetString(name).(lua.LNumber); ok {
+				return uint8(c)
+			}
+
+			return uint8(def)
+		}
+
+		return color.RGBA{R: component("r", 0), G: component("g", 0), B: component("b", 0), A: component("a", 255)}
+	}
+
+	L.ArgError(n, "invalid color")
+
+	return def
+}
+
+// pixel blends the color into the frame. Pixels outside of it are ignored.
+func (e *Engine) pixel(x, y int, c color.RGBA) {
+	if x < 0 || y < 0 || x >= ppupkg.FrameWidth || y >= ppupkg.FrameHeight || c.A == 0 {
+		return
+	}
+
+	frame := e.nes.Frame()
+	dst := &frame[y*ppupkg.FrameWidth+x]
+
+	if c.A == 255 {
+		*dst = c
+		return
+	}
+
+	blend := func(src, dst uint8) uint8 {
+		return uint8((int(src)*int(c.A) + int(dst)*(255-int(c.A))) / 255)
+	}
+
+	dst.R, dst.G, dst.B = blend(c.R, dst.R), blend(c.G, dst.G), blend(c.B, dst.B)
+}
+
+// line draws the line with the Bresenham's algorithm. The line is clipped to
+// the frame first, so that the huge lines do not take forever.
+func (e *Engine) line(x1, y1, x2, y2 int, c color.RGBA) {
+	x1, y1, x2, y2, ok := clipLine(x1, y1, x2, y2)
+	if !ok {
+		return
+	}
+
+	dx, sx := abs(x2-x1), sign(x2-x1)
+	dy, sy := -abs(y2-y1), sign(y2-y1)
+	err := dx + dy
+
+	for {
+		e.pixel(x1, y1, c)
+
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+
+		e2 := 2 * err
+
+		if e2 >= dy {
+			err += dy
+			x1 += sx
+		}
+
+		if e2 <= dx {
+			err += dx
+			y1 += sy
+		}
+	}
+}
+
+// box draws the box with the outline. Only the part of it inside the frame is
+// drawn, so that the huge boxes do not take forever.
+func (e *Engine) box(x1, y1, x2, y2 int, fill, outline color.RGBA) {
+	x1, x2 = min(x1, x2), max(x1, x2)
+	y1, y2 = min(y1, y2), max(y1, y2)
+
+	for y := max(y1, 0); y <= min(y2, ppupkg.FrameHeight-1); y++ {
+		for x := max(x1, 0); x <= min(x2, ppupkg.FrameWidth-1); x++ {
+			if x == x1 || x == x2 || y == y1 || y == y2 {
+				e.pixel(x, y, outline)
+			} else {
+				e.pixel(x, y, fill)
+			}
+		}
+	}
+}
+
+// text draws the text with the 7x13 font, with the top-left corner at x, y.
+func (e *Engine) text(x, y int, text string, fg, bg color.RGBA) {
+	face := basicfont.Face7x13
+
+	for i, line := range strings.Split(text, "\n") {
+		dot := fixed.P(x, y+i*face.Height+face.Ascent)
+
+		for _, r := range line {
+			if dot.X.Floor() >= ppupkg.FrameWidth {
+				break
+			}
+
+			dr, mask, maskp, advance, ok := face.Glyph(dot, r)
+			if !ok {
+				dr, mask, maskp, advance, _ = face.Glyph(dot, '?')
+			}
+
+			e.glyph(dr, mask, maskp, fg, bg)
+			dot.X += advance
+		}
+	}
+}
+
+func (e *Engine) glyph(dr image.Rectangle, mask image.Image, maskp image.Point, fg, bg color.RGBA) {
+	for y := dr.Min.Y; y < dr.Max.Y; y++ {
+		for x := dr.Min.X; x < dr.Max.X; x++ {
+			_, _, _, a := mask.At(maskp.X+x-dr.Min.X, maskp.Y+y-dr.Min.Y).RGBA()
+
+			if a > 0 {
+				e.pixel(x, y, fg)
+			} else {
+				e.pixel(x, y, bg)
+			}
+		}
+	}
+}
+
+func (e *Engine) registerGUI() {
+	var (
+		L     = e.state
+		white = colorNames["white"]
+		black = colorNames["black"]
+	)
+
+	// The drawing is kept until the next frame, to be drawn again by Draw.
+	draw := func(fn func()) {
+		e.overlay = append(e.overlay, fn)
+	}
+
+	pixel := func(L *lua.LState) int {
+		x, y, c := L.CheckInt(1), L.CheckInt(2), checkColor(L, 3, white)
+		draw(func() { e.pixel(x, y, c) })
+
+		return 0
+	}
+
+	box := func(L *lua.LState) int {
+		// The box is filled with translucent white by default, and the outline
+		// is the fill color made opaque, as in FCEUX.
+		fill := checkColor(L, 5, color.RGBA{R: 255, G: 255, B: 255, A: 63})
+		outline := fill
+		outline.A = 255
+		outline = checkColor(L, 6, outline)
+
+		x1, y1, x2, y2 := L.CheckInt(1), L.CheckInt(2), L.CheckInt(3), L.CheckInt(4)
+		draw(func() { e.box(x1, y1, x2, y2, fill, outline) })
+
+		return 0
+	}
+
+	L.SetGlobal("gui", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"pixel":    pixel,
+		"setpixel": pixel,
+		"line": func(L *lua.LState) int {
+			x1, y1, x2, y2 := L.CheckInt(1), L.CheckInt(2), L.CheckInt(3), L.CheckInt(4)
+			c := checkColor(L, 5, white)
+			draw(func() { e.line(x1, y1, x2, y2, c) })
+
+			return 0
+		},
+		"box":  box,
+		"rect": box,
+		"text": func(L *lua.LState) int {
+			x, y, text := L.CheckInt(1), L.CheckInt(2), L.ToStringMeta(L.Get(3)).String()
+			fg, bg := checkColor(L, 4, white), checkColor(L, 5, black)
+			draw(func() { e.text(x, y, text, fg, bg) })
+
+			return 0
+		},
+	}))
+}
+
+// clipLine clips the line to the frame with the Liang-Barsky algorithm. Returns
+// false if the line is outside of the frame.
+func clipLine(x1, y1, x2, y2 int) (int, int, int, int, bool) {
+	var (
+		t0, t1 = 0.0, 1.0
+		dx, dy = float64(x2 - x1), float64(y2 - y1)
+	)
+
+	edges := [4][2]float64{
+		{-dx, float64(x1)},                         // left
+		{dx, float64(ppupkg.FrameWidth - 1 - x1)},  // right
+		{-dy, float64(y1)},                         // top
+		{dy, float64(ppupkg.FrameHeight - 1 - y1)}, // bottom
+	}
+
+	for _, edge := range edges {
+		p, q := edge[0], edge[1]
+
+		switch {
+		case p == 0:
+			if q < 0 {
+				return 0, 0, 0, 0, false // parallel and outside
+			}
+		case p < 0:
+			t0 = max(t0, q/p)
+		default:
+			t1 = min(t1, q/p)
+		}
+	}
+
+	if t0 > t1 {
+		return 0, 0, 0, 0, false
+	}
+
+	return x1 + int(math.Round(t0*dx)), y1 + int(math.Round(t0*dy)),
+		x1 + int(math.Round(t1*dx)), y1 + int(math.Round(t1*dy)), true
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
+
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	default:
+		return 0
+	}
+}
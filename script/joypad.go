@@ -0,0 +1,92 @@
+package script
+
+import (
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/maxpoletaev/dendy/input"
+)
+
+// buttonNames are the names of the buttons in the joypad tables, as in FCEUX.
+var buttonNames = []struct {
+	name   string
+	button input.Button
+}{
+	{"A", input.ButtonA},
+	{"B", input.ButtonB},
+	{"select", input.ButtonSelect},
+	{"start", input.ButtonStart},
+	{"up", input.ButtonUp},
+	{"down", input.ButtonDown},
+	{"left", input.ButtonLeft},
+	{"right", input.ButtonRight},
+}
+
+// checkJoypad returns the zero-based port of the joystick for the player.
+func (e *Engine) checkJoypad(L *lua.LState, n int) int {
+	player := L.CheckInt(n)
+	if player < 1 || player > 2 || e.joypads[player-1] == nil {
+		L.ArgError(n, "no joypad for this player")
+	}
+
+	return player - 1
+}
+
+// applyJoypads forces the buttons set by the script for the next frame. Buttons
+// set to nil are left to the player.
+func (e *Engine) applyJoypads() {
+	for i, joy := range e.joypads {
+		if joy != nil && (e.pressed[i] != 0 || e.released[i] != 0) {
+			joy.SetButtons(joy.Buttons()&^e.released[i] | e.pressed[i])
+		}
+	}
+
+	e.pressed = [2]uint8{}
+	e.released = [2]uint8{}
+}
+
+func (e *Engine) registerJoypad() {
+	L := e.state
+
+	read := func(L *lua.LState) int {
+		var (
+			port    = e.checkJoypad(L, 1)
+			buttons = e.joypads[port].Buttons()
+			tbl     = L.NewTable()
+		)
+
+		for _, b := range buttonNames {
+			if buttons&b.button != 0 {
+				tbl.RawSetString(b.name, lua.LTrue)
+			}
+		}
+
+		L.Push(tbl)
+
+		return 1
+	}
+
+	L.SetGlobal("joypad", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"read": read,
+		"get":  read,
+		"set": func(L *lua.LState) int {
+			var (
+				port = e.checkJoypad(L, 1)
+				tbl  = L.CheckTable(2)
+			)
+
+			for _, b := range buttonNames {
+				switch v := tbl.RawGetString(b.name); {
+				case v == lua.LNil:
+				case lua.LVAsBool(v):
+					e.pressed[port] |= b.button
+					e.released[port] &^= b.button
+				default:
+					e.released[port] |= b.button
+					e.pressed[port] &^= b.button
+				}
+			}
+
+			return 0
+		},
+	}))
+}
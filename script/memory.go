@@ -0,0 +1,96 @@
+package script
+
+import (
+	lua "github.com/yuin/gopher-lua"
+)
+
+func (e *Engine) registerMemory() {
+	L := e.state
+
+	L.SetGlobal("memory", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"readbyte": func(L *lua.LState) int {
+			L.Push(lua.LNumber(e.nes.Peek(checkAddr(L, 1))))
+			return 1
+		},
+		"readbytesigned": func(L *lua.LState) int {
+			L.Push(lua.LNumber(int8(e.nes.Peek(checkAddr(L, 1)))))
+			return 1
+		},
+		"readword": func(L *lua.LState) int {
+			lo := checkAddr(L, 1)
+			hi := lo + 1
+
+			// The high byte may be stored separately, as in FCEUX.
+			if L.GetTop() >= 2 {
+				hi = checkAddr(L, 2)
+			}
+
+			L.Push(lua.LNumber(uint16(e.nes.Peek(hi))<<8 | uint16(e.nes.Peek(lo))))
+
+			return 1
+		},
+		"readbyterange": func(L *lua.LState) int {
+			addr := checkAddr(L, 1)
+			data := make([]byte, L.CheckInt(2))
+
+			for i := range data {
+				data[i] = e.nes.Peek(addr + uint16(i))
+			}
+
+			L.Push(lua.LString(data))
+
+			return 1
+		},
+		"writebyte": func(L *lua.LState) int {
+			e.nes.Poke(checkAddr(L, 1), uint8(L.CheckInt(2)))
+			return 0
+		},
+		"getregister": func(L *lua.LState) int {
+			cpu := e.nes.CPU()
+
+			switch name := L.CheckString(1); name {
+			case "a":
+				L.Push(lua.LNumber(cpu.A))
+			case "x":
+				L.Push(lua.LNumber(cpu.X))
+			case "y":
+				L.Push(lua.LNumber(cpu.Y))
+			case "s", "sp":
+				L.Push(lua.LNumber(cpu.SP))
+			case "p":
+				L.Push(lua.LNumber(cpu.P))
+			case "pc":
+				L.Push(lua.LNumber(cpu.PC))
+			default:
+				L.ArgError(1, "unknown register: "+name)
+			}
+
+			return 1
+		},
+		"setregister": func(L *lua.LState) int {
+			var (
+				cpu   = e.nes.CPU()
+				value = L.CheckInt(2)
+			)
+
+			switch name := L.CheckString(1); name {
+			case "a":
+				cpu.A = uint8(value)
+			case "x":
+				cpu.X = uint8(value)
+			case "y":
+				cpu.Y = uint8(value)
+			case "s", "sp":
+				cpu.SP = uint8(value)
+			case "p":
+				cpu.P = uint8(value)
+			case "pc":
+				cpu.PC = uint16(value)
+			default:
+				L.ArgError(1, "unknown register: "+name)
+			}
+
+			return 0
+		},
+	}))
+}
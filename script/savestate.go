@@ -0,0 +1,82 @@
+package script
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+const savestateType = "savestate"
+
+// savestate is an in-memory state made by the script, e.g. to retry a section
+// of the game with different inputs.
+type savestate struct {
+	data []byte // nil until saved
+}
+
+func checkSavestate(L *lua.LState, n int) *savestate {
+	if st, ok := L.CheckUserData(n).Value.(*savestate); ok {
+		return st
+	}
+
+	L.ArgError(n, "savestate expected")
+
+	return nil
+}
+
+func (e *Engine) registerSavestate() {
+	L := e.state
+
+	L.NewTypeMetatable(savestateType)
+
+	create := func(L *lua.LState) int {
+		ud := L.NewUserData()
+		ud.Value = &savestate{}
+		L.SetMetatable(ud, L.GetTypeMetatable(savestateType))
+		L.Push(ud)
+
+		return 1
+	}
+
+	L.SetGlobal("savestate", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"create": create,
+		"object": create,
+		"save": func(L *lua.LState) int {
+			var (
+				st  = checkSavestate(L, 1)
+				buf = bytes.NewBuffer(st.data[:0])
+			)
+
+			if err := e.nes.SaveState(binario.NewWriter(buf, binary.LittleEndian)); err != nil {
+				L.RaiseError("failed to save state: %s", err)
+			}
+
+			st.data = buf.Bytes()
+
+			return 0
+		},
+		"load": func(L *lua.LState) int {
+			st := checkSavestate(L, 1)
+			if st.data == nil {
+				L.RaiseError("savestate has not been saved")
+			}
+
+			if err := e.nes.LoadState(binario.NewReader(bytes.NewReader(st.data), binary.LittleEndian)); err != nil {
+				L.RaiseError("failed to load state: %s", err)
+			}
+
+			return 0
+		},
+		"registersave": func(L *lua.LState) int {
+			e.onSave = callback(L, 1)
+			return 0
+		},
+		"registerload": func(L *lua.LState) int {
+			e.onLoad = callback(L, 1)
+			return 0
+		},
+	}))
+}
@@ -0,0 +1,277 @@
+// Package script runs Lua scripts alongside the emulation, with an API modelled
+// after the one in FCEUX, so that many of the existing scripts work as is. The
+// scripts can read and write the memory and the CPU registers, draw over the
+// frame, press the buttons, and make save states.
+package script
+
+import (
+	"fmt"
+	"log"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// Options configures the script engine.
+type Options struct {
+	System   *system.System
+	Joypads  [2]*input.Joystick // nil for the ports without a joystick
+	ShowText func(text string)  // shows emu.message() text, logged if nil
+}
+
+// Engine runs a single script. The main chunk of the script runs in a coroutine
+// which is suspended by emu.frameadvance() until the next frame, so the scripts
+// can be written as loops, the usual way for FCEUX.
+type Engine struct {
+	state    *lua.LState
+	thread   *lua.LState
+	main     *lua.LFunction // nil after the main chunk has returned
+	nes      *system.System
+	joypads  [2]*input.Joystick
+	showText func(text string)
+
+	before *lua.LFunction
+	after  *lua.LFunction
+	exit   *lua.LFunction
+	onSave *lua.LFunction
+	onLoad *lua.LFunction
+
+	// Buttons forced by joypad.set() for the next frame.
+	pressed  [2]uint8
+	released [2]uint8
+
+	// The gui calls of the frame, kept to be drawn again by Draw.
+	overlay []func()
+
+	exitRequested bool
+	failed        bool
+}
+
+// safeLibs are the standard libraries opened for the scripts. The io, os and
+// debug libraries are left out, as the scripts shared by the community must not
+// run the commands or touch the files of the user.
+var safeLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+	{lua.CoroutineLibName, lua.OpenCoroutine},
+}
+
+// unsafeBaseFuncs are the base functions that load the code from the files.
+var unsafeBaseFuncs = []string{"dofile", "loadfile", "require", "module"}
+
+func newState() *lua.LState {
+	state := lua.NewState(lua.Options{SkipOpenLibs: true})
+
+	for _, lib := range safeLibs {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+
+	for _, name := range unsafeBaseFuncs {
+		state.SetGlobal(name, lua.LNil)
+	}
+
+	return state
+}
+
+// Load compiles the script and prepares it to run from the next frame. The
+// script only has the emulator API and the standard libraries without the
+// access to the system, see safeLibs.
+func Load(filename string, opts Options) (*Engine, error) {
+	e := &Engine{
+		state:    newState(),
+		nes:      opts.System,
+		joypads:  opts.Joypads,
+		showText: opts.ShowText,
+	}
+
+	e.registerEmu()
+	e.registerMemory()
+	e.registerGUI()
+	e.registerJoypad()
+	e.registerSavestate()
+
+	fn, err := e.state.LoadFile(filename)
+	if err != nil {
+		e.state.Close()
+		return nil, err
+	}
+
+	e.main = fn
+	e.thread, _ = e.state.NewThread()
+
+	return e, nil
+}
+
+// Frame runs the script for the frame that has just been completed. Should be
+// called after the input is read, so that the buttons pressed by the script
+// take precedence. The frame buffer is drawn over and should be displayed
+// afterwards. A failed script is stopped, but the game keeps running.
+func (e *Engine) Frame() {
+	e.overlay = e.overlay[:0]
+
+	if e.failed {
+		return
+	}
+
+	defer e.Draw()
+
+	e.call(e.after)
+
+	if e.main != nil && !e.exitRequested {
+		state, err, _ := e.state.Resume(e.thread, e.main)
+
+		switch state {
+		case lua.ResumeError:
+			e.fail(err)
+			return
+		case lua.ResumeOK:
+			e.main = nil
+		}
+	}
+
+	e.call(e.before)
+	e.applyJoypads()
+}
+
+// Draw draws what the script has drawn during the last frame over the frame
+// buffer again, for when it has been replaced by the frame run ahead.
+func (e *Engine) Draw() {
+	for _, draw := range e.overlay {
+		draw()
+	}
+}
+
+// ExitRequested returns true if the script has called emu.exit().
+func (e *Engine) ExitRequested() bool {
+	return e.exitRequested
+}
+
+// StateSaved runs the savestate.registersave() callback, if any.
+func (e *Engine) StateSaved() {
+	e.call(e.onSave)
+}
+
+// StateLoaded runs the savestate.registerload() callback, if any.
+func (e *Engine) StateLoaded() {
+	e.call(e.onLoad)
+}
+
+// Close runs the emu.registerexit() callback and releases the Lua state.
+func (e *Engine) Close() {
+	e.call(e.exit)
+	e.state.Close()
+}
+
+func (e *Engine) call(fn *lua.LFunction) {
+	if fn == nil || e.failed {
+		return
+	}
+
+	if err := e.state.CallByParam(lua.P{Fn: fn, Protect: true}); err != nil {
+		e.fail(err)
+	}
+}
+
+func (e *Engine) fail(err error) {
+	log.Printf("[ERROR] script stopped: %s", err)
+	e.failed = true
+}
+
+func (e *Engine) message(text string) {
+	if e.showText != nil {
+		e.showText(text)
+		return
+	}
+
+	log.Printf("[INFO] script: %s", text)
+}
+
+// callback returns the function argument, or nil to unregister the callback.
+func callback(L *lua.LState, n int) *lua.LFunction {
+	if L.Get(n) == lua.LNil {
+		return nil
+	}
+
+	return L.CheckFunction(n)
+}
+
+func (e *Engine) registerEmu() {
+	L := e.state
+
+	L.SetGlobal("print", L.NewFunction(func(L *lua.LState) int {
+		var text string
+
+		for i := 1; i <= L.GetTop(); i++ {
+			if i > 1 {
+				text += "\t"
+			}
+
+			text += L.ToStringMeta(L.Get(i)).String()
+		}
+
+		log.Printf("[INFO] script: %s", text)
+
+		return 0
+	}))
+
+	L.SetGlobal("emu", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"frameadvance": func(L *lua.LState) int {
+			if L != e.thread {
+				L.RaiseError("emu.frameadvance() can only be called from the main script")
+			}
+
+			return L.Yield()
+		},
+		"framecount": func(L *lua.LState) int {
+			L.Push(lua.LNumber(e.nes.FrameCount()))
+			return 1
+		},
+		"softreset": func(L *lua.LState) int {
+			e.nes.Reset()
+			return 0
+		},
+		"message": func(L *lua.LState) int {
+			e.message(L.ToStringMeta(L.Get(1)).String())
+			return 0
+		},
+		"exit": func(L *lua.LState) int {
+			e.exitRequested = true
+
+			if L == e.thread {
+				return L.Yield()
+			}
+
+			return 0
+		},
+		"registerbefore": func(L *lua.LState) int {
+			e.before = callback(L, 1)
+			return 0
+		},
+		"registerafter": func(L *lua.LState) int {
+			e.after = callback(L, 1)
+			return 0
+		},
+		"registerexit": func(L *lua.LState) int {
+			e.exit = callback(L, 1)
+			return 0
+		},
+	}))
+}
+
+func checkAddr(L *lua.LState, n int) uint16 {
+	addr := L.CheckInt(n)
+	if addr < 0 || addr > 0xFFFF {
+		L.ArgError(n, fmt.Sprintf("address out of range: %X", addr))
+	}
+
+	return uint16(addr)
+}
@@ -0,0 +1,237 @@
+package script
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+	ppupkg "github.com/maxpoletaev/dendy/ppu"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// newTestEngine loads the script for the system running an endless loop, with
+// the joystick in the first port.
+func newTestEngine(t *testing.T, code string) (*Engine, *system.System, *input.Joystick) {
+	t.Helper()
+
+	data := testutil.NewROMFile(0, 1, 1)
+	copy(data.PRG(), []byte{0x4C, 0x00, 0x80}) // JMP $8000
+	data.SetResetVector(0x8000)
+
+	rom, err := ines.NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	joy := input.NewJoystick()
+	nes := system.New(cart, joy, input.NewJoystick())
+	nes.Reset()
+
+	filename := filepath.Join(t.TempDir(), "test.lua")
+	if err := os.WriteFile(filename, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := Load(filename, Options{System: nes, Joypads: [2]*input.Joystick{joy}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(e.Close)
+
+	return e, nes, joy
+}
+
+func framePixel(nes *system.System, x, y int) color.RGBA {
+	return nes.Frame()[y*ppupkg.FrameWidth+x]
+}
+
+func TestEngine_FrameAdvance(t *testing.T) {
+	e, nes, _ := newTestEngine(t, `
+		local n = 0
+		while true do
+			n = n + 1
+			memory.writebyte(0x10, n)
+			emu.frameadvance()
+		end
+	`)
+
+	for i := 0; i < 3; i++ {
+		e.Frame()
+	}
+
+	testutil.Equal(t, nes.Peek(0x10), uint8(3))
+}
+
+func TestEngine_JoypadSet(t *testing.T) {
+	e, _, joy := newTestEngine(t, `
+		while true do
+			joypad.set(1, {A = true, start = false})
+			emu.frameadvance()
+		end
+	`)
+
+	joy.SetButtons(input.ButtonStart | input.ButtonB)
+	e.Frame()
+
+	testutil.Equal(t, joy.Buttons(), input.ButtonA|input.ButtonB)
+}
+
+func TestEngine_Exit(t *testing.T) {
+	e, _, _ := newTestEngine(t, `
+		emu.exit()
+		memory.writebyte(0x10, 1)
+	`)
+
+	e.Frame()
+	e.Frame()
+
+	testutil.Equal(t, e.ExitRequested(), true)
+}
+
+// The failed script is stopped, without taking the game down.
+func TestEngine_Error(t *testing.T) {
+	e, nes, _ := newTestEngine(t, `
+		memory.writebyte(0x10, memory.readbyte(0x10) + 1)
+		error("boom")
+	`)
+
+	e.Frame()
+	e.Frame()
+
+	testutil.Equal(t, e.failed, true)
+	testutil.Equal(t, nes.Peek(0x10), uint8(1))
+}
+
+// The scripts have no access to the files and the commands of the user, but
+// still have the libraries that do not touch the system.
+func TestEngine_Sandbox(t *testing.T) {
+	e, _, _ := newTestEngine(t, ``)
+
+	tests := map[string]bool{
+		"os.execute":      false,
+		"os.remove":       false,
+		"io.open":         false,
+		"debug.getinfo":   false,
+		"dofile":          false,
+		"loadfile":        false,
+		"require":         false,
+		"module":          false,
+		"string.format":   true,
+		"table.insert":    true,
+		"math.floor":      true,
+		"coroutine.yield": true,
+		"pcall":           true,
+	}
+
+	for name, defined := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Indexing the missing library fails, the same as the missing function.
+			code := fmt.Sprintf("local ok, v = pcall(function() return %s end) return ok and v ~= nil", name)
+			if err := e.state.DoString(code); err != nil {
+				t.Fatal(err)
+			}
+
+			value := e.state.Get(-1)
+			e.state.Pop(1)
+
+			testutil.Equal(t, lua.LVAsBool(value), defined)
+		})
+	}
+}
+
+// The drawing is kept for the frame, so that it can be drawn over the frame
+// run ahead.
+func TestEngine_Draw(t *testing.T) {
+	e, nes, _ := newTestEngine(t, `
+		while true do
+			gui.pixel(10, 20, "red")
+			emu.frameadvance()
+		end
+	`)
+
+	e.Frame()
+	testutil.Equal(t, framePixel(nes, 10, 20), colorNames["red"])
+
+	clear(nes.Frame())
+	e.Draw()
+	testutil.Equal(t, framePixel(nes, 10, 20), colorNames["red"])
+}
+
+// The shapes far beyond the frame are clipped to it, rather than drawn pixel by
+// pixel.
+func TestEngine_HugeShapes(t *testing.T) {
+	e, nes, _ := newTestEngine(t, `
+		gui.box(0, 0, 1e9, 1e9, "blue", "red")
+		gui.line(-1e9, -1e9, 1e9, 1e9, "green")
+		gui.text(0, 100, string.rep("W", 1e6))
+	`)
+
+	e.Frame()
+
+	testutil.Equal(t, framePixel(nes, 0, 50), colorNames["red"]) // the outline
+	testutil.Equal(t, framePixel(nes, 255, 239), colorNames["blue"])
+	testutil.Equal(t, framePixel(nes, 50, 50), colorNames["green"])
+}
+
+func TestEngine_Colors(t *testing.T) {
+	tests := map[string]struct {
+		color string
+		want  color.RGBA
+	}{
+		"name":        {color: `"yellow"`, want: color.RGBA{255, 255, 0, 255}},
+		"hex":         {color: `"#102030"`, want: color.RGBA{0x10, 0x20, 0x30, 255}},
+		"number":      {color: `0x102030FF`, want: color.RGBA{0x10, 0x20, 0x30, 255}},
+		"table":       {color: `{r = 1, g = 2, b = 3}`, want: color.RGBA{1, 2, 3, 255}},
+		"translucent": {color: `"#FF000080"`, want: color.RGBA{128, 0, 0, 0}},
+		"clear":       {color: `"clear"`, want: color.RGBA{}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, nes, _ := newTestEngine(t, `gui.pixel(1, 2, `+tt.color+`)`)
+			e.Frame()
+
+			testutil.Equal(t, framePixel(nes, 1, 2), tt.want)
+		})
+	}
+}
+
+func TestClipLine(t *testing.T) {
+	tests := map[string]struct {
+		in   [4]int
+		want [4]int
+		ok   bool
+	}{
+		"inside":     {in: [4]int{1, 2, 3, 4}, want: [4]int{1, 2, 3, 4}, ok: true},
+		"diagonal":   {in: [4]int{-10, -10, 300, 300}, want: [4]int{0, 0, 239, 239}, ok: true},
+		"horizontal": {in: [4]int{-1e9, 5, 1e9, 5}, want: [4]int{0, 5, 255, 5}, ok: true},
+		"vertical":   {in: [4]int{7, 1e9, 7, -1e9}, want: [4]int{7, 239, 7, 0}, ok: true},
+		"outside":    {in: [4]int{-5, -5, -1, 100}},
+		"parallel":   {in: [4]int{0, 300, 100, 300}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			x1, y1, x2, y2, ok := clipLine(tt.in[0], tt.in[1], tt.in[2], tt.in[3])
+
+			testutil.Equal(t, ok, tt.ok)
+
+			if ok {
+				testutil.Equal(t, [4]int{x1, y1, x2, y2}, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+#version 330
+
+// Input vertex attributes (from vertex shader)
+in vec2 fragTexCoord;
+in vec4 fragColor;
+
+// Input uniform values
+uniform sampler2D texture0;
+uniform vec4 colDiffuse;
+uniform float time;
+uniform float scale;
+uniform vec2 resolution;
+
+// Output fragment color
+out vec4 finalColor;
+
+const vec2 textureSize = vec2(256.0, 240.0);
+const float curvature = 4.5;        // lower values give a more curved screen
+const float maskStrength = 0.25;    // how much the RGB triads darken the image
+const float bloomStrength = 0.30;   // how much bright pixels bleed into neighbours
+const float scanlineStrength = 0.35;
+
+// Bend the texture coordinates to mimic the curved glass of a CRT tube.
+vec2 curve(vec2 uv)
+{
+    uv = uv * 2.0 - 1.0;
+    vec2 offset = abs(uv.yx) / curvature;
+    uv = uv + uv * offset * offset;
+    return uv * 0.5 + 0.5;
+}
+
+// Cheap box blur of the surrounding texels, added on top of the original color.
+vec3 bloom(vec2 uv)
+{
+    vec2 texel = 1.0 / textureSize;
+    vec3 sum = vec3(0.0);
+
+    for (int x = -2; x <= 2; x++) {
+        for (int y = -2; y <= 2; y++) {
+            sum += texture(texture0, uv + vec2(x, y) * texel).rgb;
+        }
+    }
+
+    return sum / 25.0;
+}
+
+void main()
+{
+    vec2 uv = curve(fragTexCoord);
+
+    // Everything outside of the curved screen is black.
+    if (uv.x < 0.0 || uv.x > 1.0 || uv.y < 0.0 || uv.y > 1.0) {
+        finalColor = vec4(0.0, 0.0, 0.0, 1.0);
+        return;
+    }
+
+    vec3 color = texture(texture0, uv).rgb;
+    color += bloom(uv) * bloomStrength;
+
+    // Scanlines follow the curvature, one dark line per NES pixel row.
+    float line = sin(uv.y * textureSize.y * 6.28318) * 0.5 + 0.5;
+    color *= 1.0 - scanlineStrength * line;
+
+    // Aperture grille mask based on the screen pixel position.
+    vec3 mask = vec3(1.0 - maskStrength);
+    float px = mod(gl_FragCoord.x, 3.0);
+    if (px < 1.0) {
+        mask.r = 1.0;
+    } else if (px < 2.0) {
+        mask.g = 1.0;
+    } else {
+        mask.b = 1.0;
+    }
+    color *= mask;
+
+    // Darken the corners a bit.
+    vec2 vignette = uv * (1.0 - uv.yx);
+    color *= pow(vignette.x * vignette.y * 15.0, 0.25);
+
+    finalColor = vec4(color, 1.0) * colDiffuse;
+}
@@ -6,3 +6,12 @@ import (
 
 //go:embed scanline.fs
 var ScanlineFragment string
+
+//go:embed crt.fs
+var CRTFragment string
+
+// Presets maps the names of the bundled fragment shaders to their source code.
+var Presets = map[string]string{
+	"scanline": ScanlineFragment,
+	"crt":      CRTFragment,
+}
@@ -0,0 +1,180 @@
+package stateimport
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// fceuxMagic starts the FCEUX state files (.fc0-.fc9, .fcs). The older files
+// starting with "FCS" and the version byte are not supported.
+const fceuxMagic = "FCSX"
+
+// fceuxUncompressed is the compressed size of the files saved without the
+// compression.
+const fceuxUncompressed = 0xFFFFFFFF
+
+// The sections of the FCEUX state, each holding the named chunks of one part
+// of the console. Only the parts that are converted are read.
+const (
+	fceuxSectionCPU    = 1
+	fceuxSectionPPU    = 3
+	fceuxSectionMapper = 0x10
+)
+
+// readFCEUX reads the FCEUX state. The file has the 16-byte header: the magic,
+// the size of the data, the version of FCEUX and the compressed size of the
+// data, which follows the header. The data is the list of the sections with the
+// type and the size, each consisting of the chunks with the 4-byte name and the
+// size. All the numbers are in little-endian.
+func readFCEUX(data []byte, rom *ines.ROM) (*system.ImportedState, error) {
+	if err := checkMapper(rom); err != nil {
+		return nil, err
+	}
+
+	if len(data) < 16 {
+		return nil, errors.New("truncated header")
+	}
+
+	var (
+		size       = binary.LittleEndian.Uint32(data[4:])
+		compressed = binary.LittleEndian.Uint32(data[12:])
+		body       = data[16:]
+	)
+
+	if compressed != fceuxUncompressed {
+		if int(compressed) > len(body) {
+			return nil, errors.New("truncated data")
+		}
+
+		var err error
+		if body, err = inflate(body[:compressed]); err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+	}
+
+	if int(size) > len(body) {
+		return nil, errors.New("truncated data")
+	}
+
+	f, err := readFCEUXSections(body[:size])
+	if err != nil {
+		return nil, err
+	}
+
+	st := &system.ImportedState{
+		PC: f.uint16("PC"),
+		A:  f.uint8("A"),
+		X:  f.uint8("X"),
+		Y:  f.uint8("Y"),
+		P:  f.uint8("P"),
+		SP: f.uint8("S"),
+	}
+
+	f.bytes(st.RAM[:], "RAM")
+
+	// The PPU registers are $2000-$2003, in order.
+	var regs [4]byte
+	f.bytes(regs[:], "PPUR")
+
+	ppu := &st.PPU
+	ppu.Ctrl, ppu.Mask, ppu.Status, ppu.OAMAddr = regs[0], regs[1], regs[2], regs[3]
+	ppu.VRAMAddr = f.uint16("RADD")
+	ppu.TmpAddr = f.uint16("TADD")
+	ppu.FineX = f.uint8("XOFF")
+	ppu.AddrLatch = f.flag("VTGL")
+	ppu.VRAMBuffer = f.uint8("VBUF")
+
+	f.bytes(ppu.OAM[:], "SPRA")
+	f.bytes(ppu.Palette[:], "PRAM")
+
+	var nameTables [0x800]byte
+	f.bytes(nameTables[:], "NTAR")
+	copy(ppu.NameTables[0][:], nameTables[:0x400])
+	copy(ppu.NameTables[1][:], nameTables[0x400:])
+
+	if hasPRGRAM(rom.MapperID) {
+		st.PRGRAM = f.optional("WRAM")
+	}
+
+	if rom.CHRRAM() {
+		st.CHRRAM = f.optional("CHRR")
+	}
+
+	var m mapperRegs
+
+	switch rom.MapperID {
+	case 1:
+		f.bytes(m.mmc1[:], "DREG")
+	case 2, 3, 7:
+		m.latch = f.uint8("LATC")
+	case 4:
+		f.bytes(m.mmc3Banks[:], "REGS")
+		m.mmc3Select = f.uint8("CMD")
+		m.mmc3Mirror = f.uint8("A000")
+		m.mmc3IRQLatch = f.uint8("IRQL")
+		m.mmc3IRQEnable = f.flag("IRQA")
+	}
+
+	st.MapperWrites = m.writes(rom.MapperID)
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return st, nil
+}
+
+// readFCEUXSections collects the chunks of the sections that are converted.
+// The trailing zeros of the chunk names are dropped, so "RAM\0" is "RAM".
+func readFCEUXSections(data []byte) (*fields, error) {
+	f := &fields{values: make(map[string][]byte)}
+
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, errors.New("truncated section header")
+		}
+
+		kind, size := data[0], binary.LittleEndian.Uint32(data[1:])
+		data = data[5:]
+
+		if int(size) > len(data) {
+			return nil, fmt.Errorf("truncated section %d", kind)
+		}
+
+		section := data[:size]
+		data = data[size:]
+
+		switch kind {
+		case fceuxSectionCPU, fceuxSectionPPU, fceuxSectionMapper:
+		default:
+			continue
+		}
+
+		for len(section) > 0 {
+			if len(section) < 8 {
+				return nil, fmt.Errorf("truncated chunk header in section %d", kind)
+			}
+
+			name := strings.TrimRight(string(section[:4]), "\x00")
+			size := binary.LittleEndian.Uint32(section[4:])
+			section = section[8:]
+
+			if int(size) > len(section) {
+				return nil, fmt.Errorf("truncated chunk %q", name)
+			}
+
+			if _, ok := f.values[name]; !ok {
+				f.values[name] = section[:size]
+			}
+
+			section = section[size:]
+		}
+	}
+
+	return f, nil
+}
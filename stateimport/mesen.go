@@ -0,0 +1,215 @@
+package stateimport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+const (
+	// mesenMagic starts the Mesen 2 state files (.mss).
+	mesenMagic = "MSS"
+
+	// mesen1Magic starts the Mesen 1 state files (.mst), which store the values
+	// in the order that changes with every version of the emulator.
+	mesen1Magic = "MST"
+)
+
+// mesenMirrorScreenB is the mirroring of Mesen with the second nametable on
+// all four screens, which AxROM selects with bit 4 of the register.
+const mesenMirrorScreenB = 3
+
+// readMesen reads the Mesen 2 state. The header, with the versions, the
+// screenshot and the name of the ROM, is followed by the state itself: the
+// original and the compressed size, and the zlib stream of the named values.
+// The layout of the header has changed between the versions, so the state is
+// found by its size instead, as it always ends the file.
+func readMesen(data []byte, rom *ines.ROM) (*system.ImportedState, error) {
+	if err := checkMapper(rom); err != nil {
+		return nil, err
+	}
+
+	body, err := findMesenState(data)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := readMesenValues(body)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &system.ImportedState{
+		PC: f.uint16("cpu.pc"),
+		A:  f.uint8("cpu.a"),
+		X:  f.uint8("cpu.x"),
+		Y:  f.uint8("cpu.y"),
+		P:  f.uint8("cpu.ps"),
+		SP: f.uint8("cpu.sp"),
+	}
+
+	f.bytes(st.RAM[:], "memorymanager.internalram")
+
+	ppu := &st.PPU
+	ppu.Ctrl = f.uint8("ppu.control")
+	ppu.Mask = f.uint8("ppu.mask")
+	ppu.Status = f.uint8("ppu.status")
+	ppu.OAMAddr = f.uint8("ppu.spriteramaddr")
+	ppu.VRAMAddr = f.uint16("ppu.videoramaddr")
+	ppu.TmpAddr = f.uint16("ppu.tmpvideoramaddr")
+	ppu.FineX = f.uint8("ppu.xscroll")
+	ppu.AddrLatch = f.flag("ppu.writetoggle")
+	ppu.VRAMBuffer = f.uint8("ppu.memoryreadbuffer")
+
+	f.bytes(ppu.OAM[:], "ppu.spriteram")
+	f.bytes(ppu.Palette[:], "ppu.paletteram")
+
+	var nameTables [0x800]byte
+	f.bytes(nameTables[:], "mapper.nametableram")
+	copy(ppu.NameTables[0][:], nameTables[:0x400])
+	copy(ppu.NameTables[1][:], nameTables[0x400:])
+
+	if hasPRGRAM(rom.MapperID) {
+		st.PRGRAM = f.optional("mapper.saveram", "mapper.workram")
+	}
+
+	if rom.CHRRAM() {
+		st.CHRRAM = f.optional("mapper.chrram")
+	}
+
+	var m mapperRegs
+
+	switch rom.MapperID {
+	case 1:
+		m.mmc1 = [4]uint8{
+			f.uint8("mapper.reg8000"),
+			f.uint8("mapper.rega000"),
+			f.uint8("mapper.regc000"),
+			f.uint8("mapper.rege000"),
+		}
+
+	case 2, 3, 7:
+		// The discrete mappers have no registers in Mesen, only the banks
+		// mapped into the 256-byte pages of the address space, which the
+		// register is made up from.
+		m.latch = mesenLatch(f, rom.MapperID)
+
+	case 4:
+		f.bytes(m.mmc3Banks[:], "mapper.registers")
+		m.mmc3Select = f.uint8("mapper.reg8000")
+		m.mmc3Mirror = f.uint8("mapper.rega000")
+		m.mmc3IRQLatch = f.uint8("mapper.irqreloadvalue")
+		m.mmc3IRQEnable = f.flag("mapper.irqenabled")
+	}
+
+	st.MapperWrites = m.writes(rom.MapperID)
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return st, nil
+}
+
+// mesenLatch returns the value written to the register of UxROM, CNROM or
+// AxROM, by the offsets of the banks mapped at $8000 and the PPU $0000.
+func mesenLatch(f *fields, mapperID uint8) uint8 {
+	pageOffset := func(name string, page int) uint32 {
+		offsets := f.optional(name)
+		if len(offsets) < (page+1)*4 {
+			f.fail(name, errors.New("not found"))
+			return 0
+		}
+
+		return binary.LittleEndian.Uint32(offsets[page*4:])
+	}
+
+	switch mapperID {
+	case 2:
+		return uint8(pageOffset("mapper.prgmemoryoffset", 0x80) / 0x4000)
+	case 3:
+		return uint8(pageOffset("mapper.chrmemoryoffset", 0) / 0x2000)
+	default: // 7
+		latch := uint8(pageOffset("mapper.prgmemoryoffset", 0x80) / 0x8000)
+		if f.uint32("mapper.mirroringtype") == mesenMirrorScreenB {
+			latch |= 0x10
+		}
+
+		return latch
+	}
+}
+
+// findMesenState looks for the compressed state at the end of the file and
+// decompresses it.
+func findMesenState(data []byte) ([]byte, error) {
+	for i := len(mesenMagic); i+8 < len(data); i++ {
+		size := binary.LittleEndian.Uint32(data[i+4:])
+
+		// The zlib stream starts with 0x78 for all compression levels.
+		if uint64(i)+8+uint64(size) == uint64(len(data)) && data[i+8] == 0x78 {
+			body, err := inflate(data[i+8:])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress: %w", err)
+			}
+
+			return body, nil
+		}
+	}
+
+	return nil, errors.New("state data not found")
+}
+
+// readMesenValues reads the values stored one after another: the name ending
+// with zero, the size and the data. The names are the paths of the fields in
+// the source code of Mesen, like "cpu._state.PC". They are normalized to
+// "cpu.pc", and stored under every suffix ("pc" too), so that the values are
+// found wherever the console is in the tree.
+func readMesenValues(data []byte) (*fields, error) {
+	f := &fields{values: make(map[string][]byte)}
+
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 || len(data) < end+5 {
+			return nil, errors.New("truncated value header")
+		}
+
+		name := string(data[:end])
+		size := binary.LittleEndian.Uint32(data[end+1:])
+		data = data[end+5:]
+
+		if int(size) > len(data) {
+			return nil, fmt.Errorf("truncated value %q", name)
+		}
+
+		value := data[:size]
+		data = data[size:]
+
+		path := normalizeMesenName(name)
+		for i := range path {
+			key := strings.Join(path[i:], ".")
+			if _, ok := f.values[key]; !ok {
+				f.values[key] = value
+			}
+		}
+	}
+
+	return f, nil
+}
+
+func normalizeMesenName(name string) []string {
+	var path []string
+
+	for _, part := range strings.Split(strings.ToLower(name), ".") {
+		part = strings.TrimLeft(part, "_")
+		if part != "" && part != "state" {
+			path = append(path, part)
+		}
+	}
+
+	return path
+}
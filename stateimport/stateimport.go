@@ -0,0 +1,215 @@
+// Package stateimport reads the save states of other emulators, so that the
+// games in progress can be continued in dendy. Only the emulated console is
+// converted: the CPU, the memory, the PPU and the mappers dendy supports. The
+// sound starts from the power-on state, which is rarely noticeable, as most
+// games set it up again on every note.
+package stateimport
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown save state format")
+)
+
+// Format is the emulator the state file is from.
+type Format string
+
+const (
+	FormatFCEUX Format = "FCEUX"
+	FormatMesen Format = "Mesen"
+)
+
+// ReadFile reads the state saved by another emulator for the game in the ROM.
+func ReadFile(filename string, rom *ines.ROM) (*system.ImportedState, Format, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return Read(data, rom)
+}
+
+// Read converts the state saved by another emulator, detecting which one by
+// the signature at the beginning.
+func Read(data []byte, rom *ines.ROM) (*system.ImportedState, Format, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte(fceuxMagic)):
+		st, err := readFCEUX(data, rom)
+		return st, FormatFCEUX, err
+	case bytes.HasPrefix(data, []byte(mesenMagic)):
+		st, err := readMesen(data, rom)
+		return st, FormatMesen, err
+	case bytes.HasPrefix(data, []byte(mesen1Magic)):
+		return nil, FormatMesen, errors.New("the states of Mesen 1 are not supported, save it with Mesen 2")
+	default:
+		return nil, "", ErrUnknownFormat
+	}
+}
+
+// fields are the named values of the state. Both formats store the values in
+// little-endian, each under its own name, so they are read the same way.
+type fields struct {
+	values map[string][]byte
+	err    error // the first missing field
+}
+
+func (f *fields) fail(name string, err error) {
+	if f.err == nil {
+		f.err = fmt.Errorf("%s: %w", name, err)
+	}
+}
+
+// optional returns the value of the first of the names found, or nil.
+func (f *fields) optional(names ...string) []byte {
+	for _, name := range names {
+		if v, ok := f.values[name]; ok {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// bytes copies the value into dst, which the value must fill.
+func (f *fields) bytes(dst []byte, names ...string) {
+	v := f.optional(names...)
+
+	switch {
+	case v == nil:
+		f.fail(names[0], errors.New("not found"))
+	case len(v) < len(dst):
+		f.fail(names[0], fmt.Errorf("%d bytes, want %d", len(v), len(dst)))
+	default:
+		copy(dst, v)
+	}
+}
+
+// uint32 reads the integer of any width up to 4 bytes.
+func (f *fields) uint32(names ...string) uint32 {
+	v := f.optional(names...)
+	if v == nil {
+		f.fail(names[0], errors.New("not found"))
+		return 0
+	}
+
+	var n uint32
+	for i := min(len(v), 4) - 1; i >= 0; i-- {
+		n = n<<8 | uint32(v[i])
+	}
+
+	return n
+}
+
+func (f *fields) uint8(names ...string) uint8 {
+	return uint8(f.uint32(names...))
+}
+
+func (f *fields) uint16(names ...string) uint16 {
+	return uint16(f.uint32(names...))
+}
+
+func (f *fields) flag(names ...string) bool {
+	return f.uint32(names...) != 0
+}
+
+// inflate decompresses the zlib stream, which both emulators use.
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = zr.Close()
+	}()
+
+	return io.ReadAll(zr)
+}
+
+// mapperRegs are the registers of the supported mappers, as the converters
+// read them. They are written to the mapper the same way the game did.
+type mapperRegs struct {
+	latch uint8    // UxROM, CNROM, AxROM: the value written to $8000-$FFFF
+	mmc1  [4]uint8 // control, CHR bank 0, CHR bank 1, PRG bank
+
+	mmc3Select    uint8    // $8000
+	mmc3Banks     [8]uint8 // R0-R7, written to $8001
+	mmc3Mirror    uint8    // $A000
+	mmc3IRQLatch  uint8    // $C000
+	mmc3IRQEnable bool     // $E001 if set, $E000 otherwise
+}
+
+// checkMapper returns an error if the mapper of the game is not converted.
+func checkMapper(rom *ines.ROM) error {
+	switch rom.MapperID {
+	case 0, 1, 2, 3, 4, 7:
+		return nil
+	default:
+		return fmt.Errorf("unsupported mapper: %d", rom.MapperID)
+	}
+}
+
+// hasPRGRAM returns true for the mappers with the RAM at $6000-$7FFF. The
+// others may treat the writes there as the writes to the registers.
+func hasPRGRAM(mapperID uint8) bool {
+	return mapperID == 1 || mapperID == 4
+}
+
+// writes returns the register writes that bring the mapper to the state. The
+// MMC3 IRQ counter is not set directly, it is reloaded on the next scanline,
+// which is what the games expect in the vertical blank anyway.
+func (m *mapperRegs) writes(mapperID uint8) []system.RegisterWrite {
+	switch mapperID {
+	case 2, 3, 7:
+		return []system.RegisterWrite{{Addr: 0x8000, Data: m.latch}}
+
+	case 1:
+		// The shift register is reset first. Then each of the registers is
+		// written a bit at a time, starting with the lowest one.
+		writes := []system.RegisterWrite{{Addr: 0x8000, Data: 0x80}}
+
+		for i, addr := range []uint16{0x8000, 0xA000, 0xC000, 0xE000} {
+			for bit := 0; bit < 5; bit++ {
+				writes = append(writes, system.RegisterWrite{Addr: addr, Data: m.mmc1[i] >> bit & 1})
+			}
+		}
+
+		return writes
+
+	case 4:
+		var writes []system.RegisterWrite
+
+		for i, bank := range m.mmc3Banks {
+			writes = append(writes,
+				system.RegisterWrite{Addr: 0x8000, Data: m.mmc3Select&0xC0 | uint8(i)},
+				system.RegisterWrite{Addr: 0x8001, Data: bank},
+			)
+		}
+
+		irq := uint16(0xE000)
+		if m.mmc3IRQEnable {
+			irq = 0xE001
+		}
+
+		return append(writes,
+			system.RegisterWrite{Addr: 0x8000, Data: m.mmc3Select},
+			system.RegisterWrite{Addr: 0xA000, Data: m.mmc3Mirror},
+			system.RegisterWrite{Addr: 0xC000, Data: m.mmc3IRQLatch},
+			system.RegisterWrite{Addr: 0xC001},
+			system.RegisterWrite{Addr: irq},
+		)
+
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,201 @@
+package stateimport
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+	"github.com/maxpoletaev/dendy/system"
+)
+
+// newTestROM creates the game with CHR-RAM and 8 PRG banks filled with NOPs,
+// where the byte at $x100 of every bank is the number of the bank. The last
+// bank loops at $C000, where the game starts.
+func newTestROM(t *testing.T, mapperID uint8) *ines.ROM {
+	t.Helper()
+
+	data := testutil.NewROMFile(mapperID, 8, 0)
+
+	prg := data.PRG()
+	for i := range prg {
+		prg[i] = 0xEA
+	}
+
+	for bank := 0; bank < 8; bank++ {
+		prg[bank*0x4000+0x100] = byte(bank)
+	}
+
+	last := prg[7*0x4000:]
+	copy(last, []byte{0x4C, 0x00, 0xC0}) // JMP $C000
+	last[0x3FFC], last[0x3FFD] = 0x00, 0xC0
+
+	rom, err := ines.NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rom
+}
+
+func importInto(t *testing.T, rom *ines.ROM, data []byte, want Format) *system.System {
+	t.Helper()
+
+	st, format, err := Read(data, rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, format, want)
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nes := system.New(cart, input.NewJoystick(), input.NewJoystick())
+	nes.Import(st)
+
+	return nes
+}
+
+func compress(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRead_FCEUX(t *testing.T) {
+	chunk := func(name string, data ...byte) []byte {
+		b := make([]byte, 8, 8+len(data))
+		copy(b, name)
+		binary.LittleEndian.PutUint32(b[4:], uint32(len(data)))
+		return append(b, data...)
+	}
+
+	section := func(kind byte, chunks ...[]byte) []byte {
+		body := bytes.Join(chunks, nil)
+		b := []byte{kind, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(b[1:], uint32(len(body)))
+		return append(b, body...)
+	}
+
+	ram := make([]byte, 0x800)
+	ram[0x10] = 0x42
+	wram := make([]byte, 0x2000)
+	wram[0] = 0x99
+	chrRAM := make([]byte, 0x2000)
+	chrRAM[5] = 0x77
+
+	body := bytes.Join([][]byte{
+		section(fceuxSectionCPU,
+			chunk("PC", 0x34, 0x12), chunk("A", 1), chunk("P", 0x24),
+			chunk("X", 2), chunk("Y", 3), chunk("S", 0xF0), chunk("RAM", ram...),
+		),
+		section(5, chunk("P", 0xFF)), // the sound is skipped
+		section(fceuxSectionPPU,
+			chunk("NTAR", make([]byte, 0x800)...), chunk("PRAM", make([]byte, 0x20)...),
+			chunk("SPRA", make([]byte, 0x100)...), chunk("PPUR", 0x80, 0x1E, 0, 0),
+			chunk("XOFF", 3), chunk("VTGL", 0), chunk("RADD", 0, 0x24),
+			chunk("TADD", 0, 0x24), chunk("VBUF", 0),
+		),
+		section(fceuxSectionMapper,
+			chunk("DREG", 0x0C, 0, 0, 2), chunk("WRAM", wram...), chunk("CHRR", chrRAM...),
+		),
+	}, nil)
+
+	compressed := compress(t, body)
+
+	header := make([]byte, 16)
+	copy(header, fceuxMagic)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(body)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(compressed)))
+
+	rom := newTestROM(t, 1)
+	nes := importInto(t, rom, append(header, compressed...), FormatFCEUX)
+
+	testutil.Equal(t, nes.CPU().PC, 0x1234)
+	testutil.Equal(t, nes.CPU().SP, 0xF0)
+	testutil.Equal(t, nes.Peek(0x0010), 0x42)
+	testutil.Equal(t, nes.Peek(0x6000), 0x99)
+	testutil.Equal(t, nes.Peek(0x8100), 2) // the switched bank
+	testutil.Equal(t, nes.Peek(0xC100), 7) // the fixed bank
+	testutil.Equal(t, rom.CHR[5], 0x77)
+}
+
+func TestRead_Mesen(t *testing.T) {
+	var body []byte
+
+	value := func(name string, data ...byte) {
+		body = append(body, name...)
+		body = append(body, 0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(body[len(body)-4:], uint32(len(data)))
+		body = append(body, data...)
+	}
+
+	ram := make([]byte, 0x800)
+	ram[0x10] = 0x42
+	prgOffsets := make([]byte, 0x100*4)
+	binary.LittleEndian.PutUint32(prgOffsets[0x80*4:], 3*0x4000)
+
+	value("cpu._state.PC", 0x34, 0x12)
+	value("cpu._state.SP", 0xF0)
+	value("cpu._state.A", 1)
+	value("cpu._state.X", 2)
+	value("cpu._state.Y", 3)
+	value("cpu._state.PS", 0x24)
+	value("memoryManager._internalRam", ram...)
+	value("ppu._state.Control", 0x80)
+	value("ppu._state.Mask", 0x1E)
+	value("ppu._state.Status", 0)
+	value("ppu._state.SpriteRamAddr", 0)
+	value("ppu._state.VideoRamAddr", 0, 0x24)
+	value("ppu._state.TmpVideoRamAddr", 0, 0x24)
+	value("ppu._state.XScroll", 3)
+	value("ppu._state.WriteToggle", 0)
+	value("ppu._memoryReadBuffer", 0)
+	value("ppu._spriteRam", make([]byte, 0x100)...)
+	value("ppu._paletteRam", make([]byte, 0x20)...)
+	value("mapper._nametableRam", make([]byte, 0x800)...)
+	value("mapper._prgMemoryOffset", prgOffsets...)
+
+	compressed := compress(t, body)
+
+	// The header is followed by the sizes of the state.
+	data := []byte(mesenMagic + "header, screenshot, rom name")
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(body)))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(compressed)))
+	data = append(data, compressed...)
+
+	nes := importInto(t, newTestROM(t, 2), data, FormatMesen)
+
+	testutil.Equal(t, nes.CPU().PC, 0x1234)
+	testutil.Equal(t, nes.CPU().A, 1)
+	testutil.Equal(t, nes.Peek(0x0010), 0x42)
+	testutil.Equal(t, nes.Peek(0x8100), 3)
+}
+
+func TestRead_UnsupportedMapper(t *testing.T) {
+	rom := newTestROM(t, 1)
+	rom.MapperID = 9
+
+	_, _, err := Read([]byte(fceuxMagic), rom)
+	testutil.Equal(t, err != nil, true)
+
+	_, _, err = Read([]byte("unknown"), rom)
+	testutil.Equal(t, err, ErrUnknownFormat)
+}
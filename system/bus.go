@@ -2,6 +2,7 @@ package system
 
 import (
 	apupkg "github.com/maxpoletaev/dendy/apu"
+	"github.com/maxpoletaev/dendy/cheats"
 	"github.com/maxpoletaev/dendy/ines"
 	"github.com/maxpoletaev/dendy/input"
 	ppupkg "github.com/maxpoletaev/dendy/ppu"
@@ -10,22 +11,38 @@ import (
 // Bus represents the main CPU memory bus. It is responsible for routing memory
 // read and write operations to the appropriate devices.
 type Bus struct {
-	ram   []byte // 2KB
+	ram   *[ramSize]byte
 	ppu   *ppupkg.PPU
 	apu   *apupkg.APU
 	cart  ines.Cartridge
 	port1 input.Device
 	port2 input.Device
+	dma   dma
+
+	microphone bool         // the Famicom microphone on the second controller
+	cheats     *cheats.List // nil when no cheats are used
 }
 
+const ramSize = 0x0800 // 2KB, mirrored up to 0x1FFF
+
+// The CPU address space is split into the 8KB regions by the top three bits of
+// the address. The bus is accessed on every memory access of the CPU, which
+// adds up when rolling back in netplay, so the region is picked with a single
+// switch instead of comparing the address with each of the ranges.
+const (
+	regionRAM = 0 // 0x0000-0x1FFF
+	regionPPU = 1 // 0x2000-0x3FFF, the registers mirrored every 8 bytes
+	regionIO  = 2 // 0x4000-0x401F, then the cartridge up to 0x5FFF
+)
+
 func newBus(
-	ram []uint8,
+	ram *[ramSize]byte,
 	ppu *ppupkg.PPU,
 	apu *apupkg.APU,
 	cart ines.Cartridge,
 	port1, port2 input.Device,
 ) *Bus {
-	return &Bus{
+	b := &Bus{
 		ram:   ram,
 		ppu:   ppu,
 		apu:   apu,
@@ -33,49 +50,82 @@ func newBus(
 		port1: port1,
 		port2: port2,
 	}
+
+	b.dma.bus = b
+
+	return b
 }
 
 func (b *Bus) Read(addr uint16) uint8 {
-	switch {
-	case addr >= 0x0000 && addr <= 0x1FFF: // Internal RAM.
-		return b.ram[addr%0x0800]
-	case addr >= 0x2000 && addr <= 0x3FFF: // PPU registers.
+	switch addr >> 13 {
+	case regionRAM:
+		return b.ram[addr&(ramSize-1)]
+	case regionPPU:
 		return b.ppu.Read(addr)
-	case addr >= 0x4000 && addr <= 0x4014: // Open bus.
-		return 0
-	case addr == 0x4015: // APU status.
+	case regionIO:
+		if addr <= 0x401F {
+			return b.readIO(addr)
+		}
+	}
+
+	// Cartridge space.
+	data := b.cart.ReadPRG(addr)
+	if b.cheats != nil {
+		data = b.cheats.PatchRead(addr, data)
+	}
+
+	return data
+}
+
+func (b *Bus) readIO(addr uint16) uint8 {
+	switch addr {
+	case 0x4015: // APU status.
 		return b.apu.Read(addr)
-	case addr == 0x4016: // Controller 1.
-		return b.port1.Read()
-	case addr == 0x4017: // Controller 2.
+	case 0x4016: // Controller 1, and the microphone of controller 2.
+		data := b.port1.Read()
+		if b.microphone {
+			data |= 1 << 2
+		}
+
+		return data
+	case 0x4017: // Controller 2.
 		return b.port2.Read()
-	case addr >= 0x4018 && addr <= 0x401F: // Unused APU/IO registers.
+	default: // Open bus and unused APU/IO registers.
 		return 0
-	default: // Cartridge space.
-		return b.cart.ReadPRG(addr)
 	}
 }
 
 func (b *Bus) Write(addr uint16, data uint8) {
-	switch {
-	case addr >= 0x0000 && addr <= 0x1FFF: // Internal RAM.
-		b.ram[addr%0x0800] = data
-	case addr >= 0x2000 && addr <= 0x3FFF: // PPU registers.
+	switch addr >> 13 {
+	case regionRAM:
+		b.ram[addr&(ramSize-1)] = data
+	case regionPPU:
 		b.ppu.Write(addr, data)
-	case addr >= 0x4000 && addr <= 0x4013: // APU registers.
+	case regionIO:
+		if addr <= 0x401F {
+			b.writeIO(addr, data)
+			return
+		}
+
+		b.cart.WritePRG(addr, data)
+	default: // Cartridge space.
+		b.cart.WritePRG(addr, data)
+	}
+}
+
+func (b *Bus) writeIO(addr uint16, data uint8) {
+	switch {
+	case addr <= 0x4013: // APU registers.
 		b.apu.Write(addr, data)
 	case addr == 0x4014: // PPU OAM DMA.
-		b.ppu.TransferOAM(data)
+		b.dma.startOAM(data)
 	case addr == 0x4015: // APU status.
 		b.apu.Write(addr, data)
 	case addr == 0x4016: // Controller strobe.
 		b.port1.Write(data)
 		b.port2.Write(data)
-	case addr <= 0x4017: // APU frame counter.
+	case addr == 0x4017: // APU frame counter.
 		b.apu.Write(addr, data)
-	case addr >= 0x4018 && addr <= 0x401F: // Unused APU/IO registers.
-		return
-	default: // Cartridge space.
-		b.cart.WritePRG(addr, data)
+	default: // Unused APU/IO registers.
 	}
 }
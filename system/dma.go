@@ -0,0 +1,101 @@
+package system
+
+import (
+	"errors"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+)
+
+const (
+	// oamDMACycles is the length of the OAM DMA: the CPU is halted for a cycle,
+	// then another one is taken to align with the reads, followed by 256 reads
+	// and writes. On the hardware, the alignment cycle is only needed on the odd
+	// cycles, here it is always taken.
+	oamDMACycles = 514
+
+	// dmcDMACycles is how long the CPU is stalled while the DMC sample is read.
+	dmcDMACycles = 4
+)
+
+// dma is the unit copying the memory on behalf of the CPU: the sprites to the
+// PPU OAM, when $4014 is written, and the samples to the APU, when the DMC
+// needs one. Both take the bus from the CPU, which does not run on the cycles
+// the unit does. The OAM transfer is done a byte at a time, so the state can
+// be saved in the middle of it.
+type dma struct {
+	bus *Bus
+
+	oamPage   uint8  // the high byte of the address the sprites are copied from
+	oamCycles uint16 // cycles left of the OAM transfer
+	oamData   uint8  // read on one cycle, written to the OAM on the next one
+	dmcStall  uint8  // cycles left of the DMC sample read
+}
+
+func (d *dma) reset() {
+	d.oamPage = 0
+	d.oamCycles = 0
+	d.oamData = 0
+	d.dmcStall = 0
+}
+
+// startOAM starts the transfer of the page to the OAM, when the CPU is done
+// with the current instruction.
+func (d *dma) startOAM(page uint8) {
+	d.oamPage = page
+	d.oamCycles = oamDMACycles
+}
+
+// readDMC reads the DMC sample and stalls the CPU for the time it takes. The
+// sample is read right away, as the APU needs it on the same cycle.
+func (d *dma) readDMC(addr uint16) uint8 {
+	d.dmcStall += dmcDMACycles
+	return d.bus.Read(addr)
+}
+
+// tick takes the CPU cycle if there is a transfer in progress. The OAM transfer
+// only starts between the instructions, and waits for the DMC reads, which have
+// priority. Returns false if the CPU has the bus.
+func (d *dma) tick(cpuIdle bool) bool {
+	if d.dmcStall > 0 {
+		d.dmcStall--
+		return true
+	}
+
+	if d.oamCycles == 0 || !cpuIdle {
+		return false
+	}
+
+	d.oamCycles--
+
+	// The halt and the alignment cycles are followed by the reads and the writes
+	// of the 256 bytes, one after another.
+	if d.oamCycles < 512 {
+		n := 511 - d.oamCycles
+
+		if n%2 == 0 {
+			d.oamData = d.bus.Read(uint16(d.oamPage)<<8 | n/2)
+		} else {
+			d.bus.ppu.Write(0x2004, d.oamData)
+		}
+	}
+
+	return true
+}
+
+func (d *dma) saveState(w *binario.Writer) error {
+	return errors.Join(
+		w.WriteUint8(d.oamPage),
+		w.WriteUint16(d.oamCycles),
+		w.WriteUint8(d.oamData),
+		w.WriteUint8(d.dmcStall),
+	)
+}
+
+func (d *dma) loadState(r *binario.Reader) error {
+	return errors.Join(
+		r.ReadUint8To(&d.oamPage),
+		r.ReadUint16To(&d.oamCycles),
+		r.ReadUint8To(&d.oamData),
+		r.ReadUint8To(&d.dmcStall),
+	)
+}
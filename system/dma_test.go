@@ -0,0 +1,75 @@
+package system
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/binario"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newDMATestSystem creates the system running the program that copies the
+// page $02 to the OAM in a loop.
+func newDMATestSystem(t *testing.T) *System {
+	t.Helper()
+
+	data := testutil.NewROMFile(0, 1, 1)
+	copy(data.PRG(), []byte{
+		0xA9, 0x02, // LDA #$02
+		0x8D, 0x14, 0x40, // STA $4014
+		0x4C, 0x00, 0x80, // JMP $8000
+	})
+	data.SetResetVector(0x8000)
+
+	nes := newTestSystem(t, data)
+	for i := uint16(0); i < 256; i++ {
+		nes.Poke(0x0200+i, uint8(i+1))
+	}
+
+	return nes
+}
+
+func saveState(t *testing.T, nes *System) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := nes.SaveState(binario.NewWriter(&buf, binary.LittleEndian)); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// The state saved in the middle of the OAM DMA continues the transfer when it
+// is loaded, the same way as without saving.
+func TestDMA_SaveStateMidTransfer(t *testing.T) {
+	nes := newDMATestSystem(t)
+
+	for nes.bus.dma.oamCycles != oamDMACycles/2 {
+		nes.Tick()
+	}
+
+	loaded := newDMATestSystem(t)
+	state := saveState(t, nes)
+
+	if err := loaded.LoadState(binario.NewReader(bytes.NewReader(state), binary.LittleEndian)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < oamDMACycles*3; i++ {
+		nes.Tick()
+		loaded.Tick()
+	}
+
+	if !bytes.Equal(saveState(t, nes), saveState(t, loaded)) {
+		t.Fatal("state differs after the transfer")
+	}
+
+	// The transfer wraps the OAM address around, back to the first sprite.
+	for loaded.bus.dma.oamCycles != 0 {
+		loaded.Tick()
+	}
+
+	testutil.Equal(t, loaded.ppu.Read(0x2004), 1)
+}
@@ -0,0 +1,76 @@
+package system
+
+import (
+	ppupkg "github.com/maxpoletaev/dendy/ppu"
+)
+
+// ImportedState is the state of the console saved by another emulator, as read
+// by the stateimport package. It only has what all the emulators keep in some
+// form. The rest, like the sound, is left as it is after the power on.
+type ImportedState struct {
+	A, X, Y, P, SP uint8
+	PC             uint16
+
+	RAM [ramSize]byte
+	PPU ppupkg.ImportedState
+
+	PRGRAM []byte // nil if the cartridge has none
+	CHRRAM []byte // nil if the cartridge has CHR-ROM
+
+	// MapperWrites bring the mapper to the saved state, as its registers are
+	// not stored the same way by any two emulators.
+	MapperWrites []RegisterWrite
+}
+
+// RegisterWrite is the write of the CPU to the address of a mapper register.
+type RegisterWrite struct {
+	Addr uint16
+	Data uint8
+}
+
+// Import powers the system on, runs it up to the start of the vertical blank,
+// where the other emulators save their states too, and replaces the state with
+// the imported one. The system must have just been created.
+func (s *System) Import(st *ImportedState) {
+	for !s.FrameReady() {
+		s.Tick()
+	}
+
+	for _, w := range st.MapperWrites {
+		s.cart.WritePRG(w.Addr, w.Data)
+	}
+
+	for i, b := range st.PRGRAM {
+		if i >= 0x2000 {
+			break
+		}
+
+		s.cart.WritePRG(0x6000+uint16(i), b)
+	}
+
+	if rom := s.cart.ROM(); rom.CHRRAM() {
+		copy(rom.CHR, st.CHRRAM)
+	}
+
+	*s.ram = st.RAM
+
+	s.cpu.A = st.A
+	s.cpu.X = st.X
+	s.cpu.Y = st.Y
+	s.cpu.P = st.P
+	s.cpu.SP = st.SP
+	s.cpu.PC = st.PC
+	s.cpu.Halt = 0 // the next instruction starts on the next cycle
+
+	// The emulators save their states either just before or just after the
+	// vertical blank starts, so it is started here either way, along with the
+	// NMI, to run the next frame the same way.
+	ppu := st.PPU
+	ppu.Status |= ppupkg.StatusVBlank
+	s.ppu.Import(&ppu)
+	s.ppu.PendingNMI = ppu.Ctrl&ppupkg.CtrlNMI != 0
+
+	s.bus.dma.reset()
+
+	s.generation++
+}
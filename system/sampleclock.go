@@ -0,0 +1,29 @@
+package system
+
+import "github.com/maxpoletaev/dendy/consts"
+
+// SampleClock tells when to take the next audio sample. A sample period is not
+// a whole number of ticks, so periods of 121 and 122 ticks are alternated to keep
+// the sample rate exact on average. Rounding it down to 121 ticks would make the
+// emulator produce the audio for about 59.7 frames per second, slowing down the
+// game when the audio output sets the pace.
+type SampleClock struct {
+	// Period is the number of ticks per sample, TicksPerAudioSample of the
+	// system, or of NTSC if zero.
+	Period float64
+
+	remainder float64
+}
+
+// Next returns the number of ticks to emulate before taking the next sample.
+func (c *SampleClock) Next() int {
+	if c.Period == 0 {
+		c.Period = consts.TicksPerAudioSample
+	}
+
+	c.remainder += c.Period
+	ticks := int(c.remainder)
+	c.remainder -= float64(ticks)
+
+	return ticks
+}
@@ -0,0 +1,358 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/internal/binario"
+	ppupkg "github.com/maxpoletaev/dendy/ppu"
+)
+
+// stateMagic starts the save state files, followed by the format version and
+// the layout of the components. The in-memory states used for rewinding and
+// netplay are always made by the same build, so they have no header.
+const stateMagic = "DENDYSAV"
+
+// gzipMagic starts the compressed files.
+const gzipMagic = "\x1f\x8b"
+
+// StateVersion is the version of the save state files. It must be bumped when
+// any component changes the way it saves its state, along with a loader that
+// converts the files of the previous version.
+//
+// Version 1 files have no header, as it was only added in version 2, and the
+// metadata was added in version 3. The state itself is the same in all three.
+// Version 4 stores the counters and the lengths of the memory as varints, the
+// older files are read in the fixed-width mode of the reader. Version 5 adds the
+// DMA transfer in progress at the end. Version 6 stores the components in the
+// tagged chunks, so that the ones added later can be missing from the file,
+// and the ones removed are skipped, without another version.
+const StateVersion = 6
+
+// ErrNoStateInfo is returned by ReadStateInfo for the files saved before the
+// metadata was added to them.
+var ErrNoStateInfo = errors.New("state file has no metadata")
+
+// StateInfo is the metadata stored in the save state files. It can be read
+// without loading the state, e.g. to display the save slots.
+type StateInfo struct {
+	ROMCRC32  uint32
+	MapperID  uint8
+	Time      time.Time
+	Frame     uint64      // frames since the power on or reset
+	Thumbnail image.Image // half-sized screenshot, nil if missing
+}
+
+// stateLayout describes the components stored in the state, in order. States
+// with another layout, e.g. made with a different input device plugged in, are
+// rejected, as loading them would corrupt the emulation.
+func (s *System) stateLayout() string {
+	typeName := func(v any) string {
+		return strings.TrimPrefix(fmt.Sprintf("%T", v), "*")
+	}
+
+	// The states of the Dendy may be on the scanlines the NTSC does not have.
+	ppu := "ppu"
+	if s.ppu.Dendy {
+		ppu = "ppu-dendy"
+	}
+
+	return strings.Join([]string{
+		"ram",
+		"cpu",
+		ppu,
+		"apu",
+		typeName(s.cart),
+		typeName(s.port1),
+		typeName(s.port2),
+	}, ",")
+}
+
+// stateInfo collects the metadata of the current state.
+func (s *System) stateInfo() StateInfo {
+	rom := s.cart.ROM()
+
+	return StateInfo{
+		ROMCRC32:  rom.CRC32,
+		MapperID:  rom.MapperID,
+		Time:      time.Now(),
+		Frame:     s.FrameCount(),
+		Thumbnail: thumbnail(s.Frame()),
+	}
+}
+
+// thumbnail scales the frame down by half, averaging every 2x2 pixels.
+func thumbnail(frame []color.RGBA) image.Image {
+	const width, height = ppupkg.FrameWidth / 2, ppupkg.FrameHeight / 2
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if len(frame) < ppupkg.FrameWidth*ppupkg.FrameHeight {
+		return img
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var r, g, b int
+
+			for _, i := range [4]int{0, 1, ppupkg.FrameWidth, ppupkg.FrameWidth + 1} {
+				c := frame[(y*2)*ppupkg.FrameWidth+x*2+i]
+				r, g, b = r+int(c.R), g+int(c.G), b+int(c.B)
+			}
+
+			img.SetRGBA(x, y, color.RGBA{R: uint8(r / 4), G: uint8(g / 4), B: uint8(b / 4), A: 255})
+		}
+	}
+
+	return img
+}
+
+func writeStateInfo(w *binario.Writer, info StateInfo) error {
+	var thumb bytes.Buffer
+	if info.Thumbnail != nil {
+		if err := png.Encode(&thumb, info.Thumbnail); err != nil {
+			return fmt.Errorf("failed to encode thumbnail: %w", err)
+		}
+	}
+
+	return errors.Join(
+		w.WriteUint32(info.ROMCRC32),
+		w.WriteUint8(info.MapperID),
+		w.WriteUint64(uint64(info.Time.Unix())),
+		w.WriteUint64(info.Frame),
+		w.WriteByteSlice(thumb.Bytes()),
+	)
+}
+
+func readStateInfo(r *binario.Reader) (StateInfo, error) {
+	var (
+		info  StateInfo
+		unix  uint64
+		thumb []byte
+	)
+
+	err := errors.Join(
+		r.ReadUint32To(&info.ROMCRC32),
+		r.ReadUint8To(&info.MapperID),
+		r.ReadUint64To(&unix),
+		r.ReadUint64To(&info.Frame),
+	)
+	if err == nil {
+		thumb, err = r.ReadByteSlice()
+	}
+
+	if err != nil {
+		return StateInfo{}, fmt.Errorf("failed to read state metadata: %w", err)
+	}
+
+	info.Time = time.Unix(int64(unix), 0)
+
+	// The thumbnail is not essential, so a broken one is simply dropped.
+	if len(thumb) > 0 {
+		info.Thumbnail, _ = png.Decode(bytes.NewReader(thumb))
+	}
+
+	return info, nil
+}
+
+// WriteStateFile saves the state of the system with the header identifying the
+// format version and the layout, followed by the metadata. The file is gzipped,
+// as most of the state is memory that is either empty or full of similar tiles.
+func (s *System) WriteStateFile(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	bw := binario.NewWriter(zw, binary.LittleEndian)
+
+	err := errors.Join(
+		bw.WriteRawBytes([]byte(stateMagic)),
+		bw.WriteUint16(StateVersion),
+		bw.WriteString(s.stateLayout()),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := writeStateInfo(bw, s.stateInfo()); err != nil {
+		return err
+	}
+
+	if err := bw.WriteChunks(s.stateChunks()...); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// stateHeader is the beginning of the state file, up to the state itself.
+type stateHeader struct {
+	version uint16
+	layout  string
+	info    *StateInfo // nil before version 3
+}
+
+// readStateHeader decompresses the file if needed and reads the header. The
+// returned reader is positioned at the beginning of the state. Files without
+// the header are version 1.
+func readStateHeader(r io.Reader) (stateHeader, *binario.Reader, error) {
+	br := bufio.NewReader(r)
+
+	if magic, err := br.Peek(len(gzipMagic)); err == nil && string(magic) == gzipMagic {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return stateHeader{}, nil, fmt.Errorf("failed to decompress state: %w", err)
+		}
+
+		br = bufio.NewReader(zr)
+	}
+
+	magic, err := br.Peek(len(stateMagic))
+	if err != nil || string(magic) != stateMagic {
+		return stateHeader{version: 1}, binario.NewReader(br, binary.LittleEndian), nil
+	}
+
+	if _, err := br.Discard(len(stateMagic)); err != nil {
+		return stateHeader{}, nil, err
+	}
+
+	var (
+		reader = binario.NewReader(br, binary.LittleEndian)
+		header stateHeader
+	)
+
+	if header.version, err = reader.ReadUint16(); err != nil {
+		return stateHeader{}, nil, fmt.Errorf("failed to read state version: %w", err)
+	}
+
+	if header.version > StateVersion {
+		return stateHeader{}, nil, fmt.Errorf("unsupported state version %d (up to %d is supported)", header.version, StateVersion)
+	}
+
+	if header.layout, err = reader.ReadString(); err != nil {
+		return stateHeader{}, nil, fmt.Errorf("failed to read state layout: %w", err)
+	}
+
+	if header.version >= 3 {
+		info, err := readStateInfo(reader)
+		if err != nil {
+			return stateHeader{}, nil, err
+		}
+
+		header.info = &info
+	}
+
+	return header, reader, nil
+}
+
+// ReadStateFile loads the state written by WriteStateFile or by an older version
+// of the emulator. The header is checked before any of the components is loaded,
+// so the system is left untouched if the state is not compatible. Compressed
+// and uncompressed files are both accepted.
+func (s *System) ReadStateFile(r io.Reader) error {
+	return s.readStateFile(r, false)
+}
+
+// ReadStateFileRebuilt loads the state saved with another build of the game,
+// which is being developed, so its checksum changes with every build. Only the
+// layout is checked, and it is up to the developer whether the new code copes
+// with the memory left by the old one. The files saved before the checksum was
+// included in the metadata are rejected, as the checksum is also in the state.
+func (s *System) ReadStateFileRebuilt(r io.Reader) error {
+	return s.readStateFile(r, true)
+}
+
+func (s *System) readStateFile(r io.Reader, rebuilt bool) error {
+	header, reader, err := readStateHeader(r)
+	if err != nil {
+		return err
+	}
+
+	if header.version >= 2 {
+		if want := s.stateLayout(); header.layout != want {
+			return fmt.Errorf("incompatible state layout: %s (expected %s)", header.layout, want)
+		}
+	}
+
+	rom := s.cart.ROM()
+
+	switch {
+	case rebuilt && header.info == nil:
+		return ErrNoStateInfo
+	case rebuilt:
+		// The ROM is given the checksum of the old build while the state is
+		// loaded, as the cartridge checks it too.
+		crc := rom.CRC32
+		rom.CRC32 = header.info.ROMCRC32
+
+		defer func() {
+			rom.CRC32 = crc
+		}()
+	case header.info != nil && header.info.ROMCRC32 != rom.CRC32:
+		return fmt.Errorf("%w: state is for ROM %08X", ines.ErrSavedStateMismatch, header.info.ROMCRC32)
+	}
+
+	reader.SetFixedWidth(header.version < 4)
+	s.generation++
+
+	if header.version < 6 {
+		return s.loadState(reader, header.version)
+	}
+
+	return s.loadStateChunks(reader)
+}
+
+// stateChunks returns the components of the state file, tagged by the names of
+// the state layout. The in-memory states have no chunks, as they are made and
+// loaded by the same build, often enough for the tags to be a waste.
+func (s *System) stateChunks() []binario.Chunk {
+	return []binario.Chunk{
+		{Tag: "ram", Write: s.saveRAM},
+		{Tag: "cpu", Write: s.cpu.SaveState},
+		{Tag: "ppu", Write: s.ppu.SaveState},
+		{Tag: "apu", Write: s.apu.SaveState},
+		{Tag: "cart", Write: s.cart.SaveState},
+		{Tag: "port1", Write: s.port1.SaveState},
+		{Tag: "port2", Write: s.port2.SaveState},
+		{Tag: "dma", Write: s.bus.dma.saveState},
+	}
+}
+
+// loadStateChunks loads the chunks of the state file. The DMA is reset first,
+// so that it is not in progress if the chunk is missing.
+func (s *System) loadStateChunks(r *binario.Reader) error {
+	s.bus.dma.reset()
+
+	return r.ReadChunks(map[string]func(r *binario.Reader) error{
+		"ram":   s.loadRAM,
+		"cpu":   s.cpu.LoadState,
+		"ppu":   s.ppu.LoadState,
+		"apu":   s.apu.LoadState,
+		"cart":  s.cart.LoadState,
+		"port1": s.port1.LoadState,
+		"port2": s.port2.LoadState,
+		"dma":   s.bus.dma.loadState,
+	})
+}
+
+// ReadStateInfo reads the metadata of the state file without loading the state.
+// Returns ErrNoStateInfo for the files made by older versions of the emulator.
+func ReadStateInfo(r io.Reader) (StateInfo, error) {
+	header, _, err := readStateHeader(r)
+	if err != nil {
+		return StateInfo{}, err
+	}
+
+	if header.info == nil {
+		return StateInfo{}, ErrNoStateInfo
+	}
+
+	return *header.info, nil
+}
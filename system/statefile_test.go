@@ -0,0 +1,102 @@
+package system
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// The state of the previous build of the game is only loaded when asked for,
+// and the checksum of the new build stays.
+func TestSystem_ReadStateFileRebuilt(t *testing.T) {
+	nes := newLoopSystem(t)
+	nes.Poke(0x0010, 0x42)
+
+	var buf bytes.Buffer
+	if err := nes.WriteStateFile(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	rebuilt := newLoopSystem(t)
+	rebuilt.ROM().CRC32++
+
+	err := rebuilt.ReadStateFile(bytes.NewReader(buf.Bytes()))
+	testutil.Equal(t, errors.Is(err, ines.ErrSavedStateMismatch), true)
+
+	if err := rebuilt.ReadStateFileRebuilt(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, rebuilt.Peek(0x0010), 0x42)
+	testutil.Equal(t, rebuilt.ROM().CRC32, nes.ROM().CRC32+1)
+}
+
+// The states of version 3, with the fixed-width counters and lengths, are still
+// loaded. The file is saved by the emulator of that version after running the
+// endless loop of newLoopSystem for 100000 cycles, with $42 poked at $0010.
+func TestSystem_ReadStateFileV3(t *testing.T) {
+	data, err := os.ReadFile("testdata/state-v3.sav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := ReadStateInfo(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nes := newLoopSystem(t)
+	testutil.Equal(t, info.ROMCRC32, nes.ROM().CRC32)
+
+	if err := nes.ReadStateFile(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, nes.Peek(0x0010), 0x42)
+	testutil.Equal(t, nes.cycles, uint64(100000))
+}
+
+// The states of version 5, with the components in a row rather than in the
+// chunks, are still loaded. The file is saved the same way as the one above.
+func TestSystem_ReadStateFileV5(t *testing.T) {
+	data, err := os.ReadFile("testdata/state-v5.sav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nes := newLoopSystem(t)
+
+	if err := nes.ReadStateFile(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.Equal(t, nes.Peek(0x0010), 0x42)
+	testutil.Equal(t, nes.cycles, uint64(100000))
+}
+
+// The states of the Dendy timing are only loaded with the same timing, as they
+// may be on the scanlines the NTSC does not have.
+func TestSystem_ReadStateFileRegion(t *testing.T) {
+	nes := newLoopSystem(t)
+	nes.SetRegion(ines.RegionDendy)
+
+	var buf bytes.Buffer
+	if err := nes.WriteStateFile(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ntsc := newLoopSystem(t)
+	err := ntsc.ReadStateFile(bytes.NewReader(buf.Bytes()))
+	testutil.Equal(t, err != nil, true)
+
+	dendy := newLoopSystem(t)
+	dendy.SetRegion(ines.RegionDendy)
+
+	if err := dendy.ReadStateFile(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+}
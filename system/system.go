@@ -1,3 +1,14 @@
+// Package system puts the CPU, the PPU, the APU and the cartridge together into
+// the console.
+//
+// The emulation is deterministic: the same inputs from the same state always
+// lead to the same state, on every platform, which the netplay and the replays
+// rely on. To keep it this way, the emulated state is only changed with integer
+// math, and nothing in it depends on the time, the map order or the randomness.
+// The audio samples are the only floats, and they are made from the state
+// without changing it, so the audio output does not affect the game. The state
+// after the power on is always the same, with the memory cleared, rather than
+// random the way it is on the real console.
 package system
 
 import (
@@ -11,6 +22,8 @@ import (
 	"time"
 
 	apupkg "github.com/maxpoletaev/dendy/apu"
+	"github.com/maxpoletaev/dendy/cheats"
+	"github.com/maxpoletaev/dendy/consts"
 	cpupkg "github.com/maxpoletaev/dendy/cpu"
 	"github.com/maxpoletaev/dendy/disasm"
 	"github.com/maxpoletaev/dendy/ines"
@@ -30,7 +43,7 @@ const (
 // running the emulation.
 type System struct {
 	bus   *Bus
-	ram   []byte
+	ram   *[ramSize]byte
 	cpu   *cpupkg.CPU
 	ppu   *ppupkg.PPU
 	apu   *apupkg.APU
@@ -38,10 +51,14 @@ type System struct {
 	port1 input.Device
 	port2 input.Device
 
+	cpuClocked ines.CPUClocked // nil unless the mapper counts the CPU cycles
+
 	scanlineReady bool
 	frameReady    bool
 	cycles        uint64
+	generation    uint64
 	debugWriter   io.StringWriter
+	trace         *instructionTrace
 
 	autoSaves      *ringbuf.Buffer[[]byte]
 	removedBuffers chan []byte
@@ -52,7 +69,7 @@ type System struct {
 
 // New creates a new System instance with the given Cartridge and input devices.
 func New(cart ines.Cartridge, port1, port2 input.Device) *System {
-	ram := make([]byte, 2048)
+	ram := new([ramSize]byte)
 	ppu := ppupkg.New(cart)
 	cpu := cpupkg.New()
 	apu := apupkg.New()
@@ -70,34 +87,33 @@ func New(cart ines.Cartridge, port1, port2 input.Device) *System {
 		removedBuffers: make(chan []byte, maxAutoSaves),
 	}
 
-	s.initDMACallbacks()
+	for _, port := range []input.Device{port1, port2} {
+		if gun, ok := input.AsLightGun(port); ok {
+			gun.SetScreen(ppu)
+			ppu.LightGun = true
+		}
+	}
+
+	// The rewind goes back as far as the last auto-saves, the older ones make
+	// room for the new ones.
+	s.autoSaves.Policy = ringbuf.PolicyOverwrite
+
+	s.cpuClocked, _ = ines.AsCPUClocked(cart)
+	s.apu.SetExpansion(expansionAudio(cart))
+	s.apu.SetDMACallback(s.bus.dma.readDMC)
 
 	s.Reset()
 
 	return s
 }
 
-func (s *System) initDMACallbacks() {
-	// PPU DMA transfers 256 bytes of data from CPU memory to PPU OAM memory.
-	// It is triggered by writing to $4014 and takes 513 CPU cycles to complete.
-	s.ppu.SetDMACallback(func(addr uint16, data []byte) {
-		for i := uint16(0); i < uint16(len(data)); i++ {
-			data[i] = s.bus.Read(addr + i)
-		}
-
-		s.cpu.Halt += 513
-		if s.cpu.Halt%2 == 1 {
-			s.cpu.Halt++
-		}
-	})
+// expansionAudio returns the output of the sound channels of the cartridge.
+func expansionAudio(cart ines.Cartridge) func() float32 {
+	if audio, ok := ines.AsExpansionAudio(cart); ok {
+		return audio.AudioOutput
+	}
 
-	// APU DMA transfers an audio sample (1 byte) from CPU memory to APU memory.
-	// It happens automatically when DMC requests a sample and takes 4 CPU cycles.
-	s.apu.SetDMACallback(func(addr uint16) byte {
-		data := s.bus.Read(addr)
-		s.cpu.Halt += 4
-		return data
-	})
+	return nil
 }
 
 func (s *System) Reset() {
@@ -107,11 +123,34 @@ func (s *System) Reset() {
 	s.apu.Reset()
 	s.port1.Reset()
 	s.port2.Reset()
+	s.bus.dma.reset()
 	s.cpu.Reset(s.bus)
 
 	s.cycles = 0
 	s.frameReady = false
 	s.scanlineReady = false
+	s.generation++
+}
+
+// InsertCartridge powers the console off, swaps the cartridge and powers it on
+// again, so that another game is started without creating a new system. The
+// memory, the cheats and the rewind history of the previous game are cleared.
+// The controllers and the rest of the settings stay.
+func (s *System) InsertCartridge(cart ines.Cartridge) {
+	s.cart = cart
+	s.bus.cart = cart
+	s.bus.cheats = nil
+	s.cpuClocked, _ = ines.AsCPUClocked(cart)
+	s.apu.SetExpansion(expansionAudio(cart))
+
+	*s.ram = [ramSize]byte{}
+	s.ppu.InsertCartridge(cart)
+
+	s.autoSaves.Clear()
+	s.lastAutoSave = time.Time{}
+	s.lastRewind = time.Time{}
+
+	s.Reset()
 }
 
 func (s *System) disassemble() {
@@ -128,10 +167,16 @@ func (s *System) Tick() {
 	s.cycles++
 
 	if s.cycles%3 == 0 {
-		instructionComplete := s.cpu.Tick(s.bus)
-
-		if instructionComplete && s.debugWriter != nil {
-			s.disassemble()
+		if s.bus.dma.tick(s.cpu.Halt == 0) {
+			s.cpu.Stall()
+		} else if s.cpu.Tick(s.bus) {
+			if s.debugWriter != nil {
+				s.disassemble()
+			}
+
+			if s.trace != nil {
+				s.recordTrace()
+			}
 		}
 
 		s.apu.Tick()
@@ -140,6 +185,14 @@ func (s *System) Tick() {
 			s.apu.PendingIRQ = false
 			s.cpu.TriggerIRQ()
 		}
+
+		if s.cpuClocked != nil {
+			s.cpuClocked.CPUTick()
+
+			if s.cart.PendingIRQ() {
+				s.cpu.TriggerIRQ()
+			}
+		}
 	}
 
 	s.ppu.Tick()
@@ -164,6 +217,10 @@ func (s *System) Tick() {
 		s.ppu.FrameComplete = false
 		s.frameReady = true
 
+		if s.bus.cheats != nil {
+			s.bus.cheats.Freeze(s.bus.Write)
+		}
+
 		if s.rewindEnabled && time.Since(s.lastAutoSave) >= autoSaveInterval {
 			s.lastAutoSave = time.Now()
 			s.createAutoSave()
@@ -177,11 +234,65 @@ func (s *System) SetFastForward(v bool) {
 	s.ppu.FastForward = v
 }
 
+// SetRegion sets the timing of the console, which must match the one the game
+// was made for. Only the NTSC and the Dendy timings are emulated, the games of
+// the other regions run with the NTSC one. The timing may be changed while the
+// game is running, which cuts the frame short.
+func (s *System) SetRegion(region ines.Region) {
+	s.ppu.Dendy = region == ines.RegionDendy
+}
+
+// Region returns the timing set with SetRegion, either NTSC or Dendy.
+func (s *System) Region() ines.Region {
+	if s.ppu.Dendy {
+		return ines.RegionDendy
+	}
+
+	return ines.RegionNTSC
+}
+
+// FrameRate returns the number of frames per second of the timing.
+func (s *System) FrameRate() float64 {
+	if s.ppu.Dendy {
+		return consts.DendyFrameRate
+	}
+
+	return consts.FrameRate
+}
+
+// TicksPerAudioSample returns the period of the audio samples of the timing,
+// for the SampleClock.
+func (s *System) TicksPerAudioSample() float64 {
+	if s.ppu.Dendy {
+		return consts.DendyTicksPerAudioSample
+	}
+
+	return consts.TicksPerAudioSample
+}
+
+// SetMicrophone sets whether something is heard by the microphone built into
+// the second controller of the Famicom. Few games use it, like Zelda to scare
+// off the Pols Voice. It is read in bit 2 of $4016.
+func (s *System) SetMicrophone(v bool) {
+	s.bus.microphone = v
+}
+
 // SetNoSpriteLimit enables or disables scanline sprite limit on the PPU.
 func (s *System) SetNoSpriteLimit(v bool) {
 	s.ppu.NoSpriteLimit = v
 }
 
+// SetPalette changes the palette the next frames are drawn with. Every system
+// has its own, DefaultPalette unless changed.
+func (s *System) SetPalette(colors *ppupkg.Palette) {
+	s.ppu.SetPalette(colors)
+}
+
+// Palette returns the palette the frames are drawn with.
+func (s *System) Palette() *ppupkg.Palette {
+	return s.ppu.Palette()
+}
+
 // ScanlineReady returns true if a scanline has just completed.
 func (s *System) ScanlineReady() (v bool) {
 	if s.scanlineReady {
@@ -206,11 +317,92 @@ func (s *System) Frame() []color.RGBA {
 	return s.ppu.Frame
 }
 
+// Cycles returns the number of the PPU cycles since the power on or the last
+// reset.
+func (s *System) Cycles() uint64 {
+	return s.cycles
+}
+
+// Generation is incremented every time the state changes other than by the
+// emulation itself: on reset, on loading a state file, on rewind and on writing
+// to the memory with Poke. The in-memory states loaded with LoadState, e.g. by
+// the run-ahead, do not count, as they are expected to be restored right away.
+func (s *System) Generation() uint64 {
+	return s.generation
+}
+
+// FrameCount returns the number of frames since the power on or the last reset.
+func (s *System) FrameCount() uint64 {
+	if s.ppu.Dendy {
+		return s.cycles / (consts.DendyCPUTicksPerFrame * 3)
+	}
+
+	return s.cycles * 2 / (consts.CPUTicksPerFrame * 2 * 3)
+}
+
+// Peek reads the byte from the CPU address space without the side effects of
+// reading the hardware registers, which are always read as zero. It is meant for
+// the scripts and debugging tools that inspect the memory while the game runs.
+// The registers of the mappers at $4020-$5FFF are read as zero as well, unless
+// the mapper can read them without the side effects.
+func (s *System) Peek(addr uint16) uint8 {
+	switch {
+	case addr <= 0x1FFF:
+		return s.ram[addr&(ramSize-1)]
+	case addr <= 0x401F:
+		return 0
+	}
+
+	if peeker, ok := ines.AsPRGPeeker(s.cart); ok {
+		return peeker.PeekPRG(addr)
+	}
+
+	if addr <= 0x5FFF {
+		return 0
+	}
+
+	return s.cart.ReadPRG(addr)
+}
+
+// Poke writes the byte to the CPU address space, the same way the CPU does, so
+// writing to the registers has the usual effect.
+func (s *System) Poke(addr uint16, data uint8) {
+	s.bus.Write(addr, data)
+	s.generation++
+}
+
+// SetCheats sets the cheat codes patching the reads from the cartridge, the way
+// Game Genie does, and freezing the RAM values at the end of every frame. Nil
+// disables the cheats.
+func (s *System) SetCheats(l *cheats.List) {
+	s.bus.cheats = l
+}
+
+// ROM returns the ROM of the inserted cartridge.
+func (s *System) ROM() *ines.ROM {
+	return s.cart.ROM()
+}
+
+// CPU returns the CPU, e.g. to inspect or change its registers.
+func (s *System) CPU() *cpupkg.CPU {
+	return s.cpu
+}
+
+// Cartridge returns the inserted cartridge, e.g. to inspect its mapper.
+func (s *System) Cartridge() ines.Cartridge {
+	return s.cart
+}
+
 // AudioSample returns the next audio sample from the APU.
 func (s *System) AudioSample() float32 {
 	return s.apu.Output()
 }
 
+// PPU returns the PPU, e.g. to inspect its memory.
+func (s *System) PPU() *ppupkg.PPU {
+	return s.ppu
+}
+
 // SetDebugWriter sets the writer for debug (disassembly) output.
 func (s *System) SetDebugWriter(w io.StringWriter) {
 	s.debugWriter = w
@@ -218,9 +410,25 @@ func (s *System) SetDebugWriter(w io.StringWriter) {
 
 // SaveState saves the current state of the system to the given writer.
 func (s *System) SaveState(w *binario.Writer) error {
+	return s.saveState(w, StateVersion)
+}
+
+// SaveStateVersion saves the state in the format of the given StateVersion, to
+// compare it with the states saved by the older versions, e.g. the checksums of
+// the replays. The writer is switched to the fixed-width mode before version 4.
+func (s *System) SaveStateVersion(w *binario.Writer, version uint16) error {
+	if version > StateVersion {
+		return fmt.Errorf("unsupported state version %d", version)
+	}
+
+	w.SetFixedWidth(version < 4)
+
+	return s.saveState(w, version)
+}
+
+func (s *System) saveState(w *binario.Writer, version uint16) error {
 	err := errors.Join(
-		w.WriteByteSlice(s.ram[:]),
-		w.WriteUint64(s.cycles),
+		s.saveRAM(w),
 		s.cpu.SaveState(w),
 		s.ppu.SaveState(w),
 		s.apu.SaveState(w),
@@ -229,14 +437,37 @@ func (s *System) SaveState(w *binario.Writer) error {
 		s.port2.SaveState(w),
 	)
 
+	// The DMA was done at once before version 5, so it was never in progress.
+	if err == nil && version >= 5 {
+		err = s.bus.dma.saveState(w)
+	}
+
 	return err
 }
 
+// saveRAM saves the internal RAM along with the cycle counter.
+func (s *System) saveRAM(w *binario.Writer) error {
+	return errors.Join(
+		w.WriteVarBytes(s.ram[:]),
+		w.WriteVarUint(s.cycles),
+	)
+}
+
+func (s *System) loadRAM(r *binario.Reader) error {
+	return errors.Join(
+		r.ReadVarBytesTo(s.ram[:]),
+		r.ReadVarUintTo(&s.cycles),
+	)
+}
+
 // LoadState loads the state of the system from the given reader.
 func (s *System) LoadState(r *binario.Reader) error {
+	return s.loadState(r, StateVersion)
+}
+
+func (s *System) loadState(r *binario.Reader, version uint16) error {
 	err := errors.Join(
-		r.ReadByteSliceTo(s.ram[:]),
-		r.ReadUint64To(&s.cycles),
+		s.loadRAM(r),
 		s.cpu.LoadState(r),
 		s.ppu.LoadState(r),
 		s.apu.LoadState(r),
@@ -245,6 +476,14 @@ func (s *System) LoadState(r *binario.Reader) error {
 		s.port2.LoadState(r),
 	)
 
+	if err == nil {
+		if version >= 5 {
+			err = s.bus.dma.loadState(r)
+		} else {
+			s.bus.dma.reset()
+		}
+	}
+
 	return err
 }
 
@@ -284,7 +523,7 @@ func (s *System) createAutoSave() {
 		return
 	}
 
-	s.autoSaves.PushBackEvict(buf.Bytes())
+	s.autoSaves.PushBack(buf.Bytes())
 }
 
 // SetRewindEnabled enables or disables the rewind feature.
@@ -292,6 +531,11 @@ func (s *System) SetRewindEnabled(v bool) {
 	s.rewindEnabled = v
 }
 
+// RewindEnabled returns true if the rewind feature is enabled.
+func (s *System) RewindEnabled() bool {
+	return s.rewindEnabled
+}
+
 // Rewind rewinds the game to the previous auto-save (up to 5 seconds ago).
 func (s *System) Rewind() {
 	if s.autoSaves.Empty() {
@@ -311,6 +555,8 @@ func (s *System) Rewind() {
 		panic(fmt.Sprintf("error loading state: %v", err))
 	}
 
+	s.generation++
+
 	now := time.Now()
 	s.lastRewind = now
 	s.lastAutoSave = now // prevent immediate re-saves
@@ -0,0 +1,85 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/maxpoletaev/dendy/consts"
+	"github.com/maxpoletaev/dendy/ines"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newTestSystem creates the system running the game made by the test.
+func newTestSystem(t *testing.T, data testutil.ROMFile) *System {
+	t.Helper()
+
+	rom, err := ines.NewFromBuffer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cart, err := ines.NewCartridge(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(cart, input.NewJoystick(), input.NewJoystick())
+}
+
+// newLoopSystem creates the system running the endless loop at $8000.
+func newLoopSystem(t *testing.T) *System {
+	t.Helper()
+
+	data := testutil.NewROMFile(0, 1, 1)
+	copy(data.PRG(), []byte{0x4C, 0x00, 0x80}) // JMP $8000
+	data.SetResetVector(0x8000)
+
+	return newTestSystem(t, data)
+}
+
+// Peek does not move the auto-incremented address of the N163 audio port,
+// which the read by the CPU does.
+func TestSystem_PeekRegisters(t *testing.T) {
+	nes := newTestSystem(t, testutil.NewROMFile(19, 2, 1))
+
+	nes.Poke(0xF800, 0x80) // the address 0, auto-increment
+	nes.Poke(0x4800, 0x11)
+	nes.Poke(0x4800, 0x22)
+	nes.Poke(0xF800, 0x80)
+
+	testutil.Equal(t, nes.Peek(0x4800), 0x11)
+	testutil.Equal(t, nes.Peek(0x4800), 0x11)
+
+	// The registers of the mappers that cannot peek are read as zero.
+	nes = newTestSystem(t, testutil.NewROMFile(2, 2, 0))
+	testutil.Equal(t, nes.Peek(0x5000), 0)
+}
+
+func TestSystem_Region(t *testing.T) {
+	tests := map[string]struct {
+		region ines.Region
+		want   ines.Region
+		ticks  uint64 // per frame
+		rate   float64
+	}{
+		"NTSC":  {region: ines.RegionNTSC, want: ines.RegionNTSC, ticks: 89342, rate: consts.FrameRate},
+		"Dendy": {region: ines.RegionDendy, want: ines.RegionDendy, ticks: 341 * 312, rate: consts.DendyFrameRate},
+		"PAL":   {region: ines.RegionPAL, want: ines.RegionNTSC, ticks: 89342, rate: consts.FrameRate},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			nes := newLoopSystem(t)
+			nes.SetRegion(tt.region)
+
+			testutil.Equal(t, nes.Region(), tt.want)
+			testutil.Equal(t, nes.FrameRate(), tt.rate)
+
+			for i := uint64(0); i < tt.ticks*10; i++ {
+				nes.Tick()
+			}
+
+			testutil.Equal(t, nes.FrameCount(), 10)
+		})
+	}
+}
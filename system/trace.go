@@ -0,0 +1,71 @@
+package system
+
+import (
+	cpupkg "github.com/maxpoletaev/dendy/cpu"
+	"github.com/maxpoletaev/dendy/disasm"
+)
+
+// instructionTrace keeps the CPU state before each of the last executed
+// instructions in a ring. Only the registers are recorded, as reading the
+// instruction bytes on every instruction slows down the emulation noticeably,
+// so they are read when the trace is disassembled. The code that was since
+// overwritten in RAM or switched out of the bank may show the wrong bytes.
+type instructionTrace struct {
+	entries []cpupkg.CPU
+	next    int
+	full    bool
+}
+
+func (s *System) recordTrace() {
+	t := s.trace
+	t.entries[t.next] = *s.cpu
+
+	if t.next++; t.next == len(t.entries) {
+		t.next = 0
+		t.full = true
+	}
+}
+
+// peekMemory is the memory without the side effects, for the disassembler.
+type peekMemory struct {
+	*System
+}
+
+func (m peekMemory) Read(addr uint16) uint8 {
+	return m.Peek(addr)
+}
+
+func (m peekMemory) Write(addr uint16, data uint8) {}
+
+// SetTraceSize keeps the last n executed instructions in memory, to be
+// disassembled with Trace, e.g. after a crash. Zero disables the trace.
+func (s *System) SetTraceSize(n int) {
+	if n == 0 {
+		s.trace = nil
+		return
+	}
+
+	s.trace = &instructionTrace{entries: make([]cpupkg.CPU, n)}
+}
+
+// Trace returns the disassembly of the last executed instructions, the oldest
+// first, in the same format as the debug output.
+func (s *System) Trace() []string {
+	t := s.trace
+	if t == nil {
+		return nil
+	}
+
+	entries := t.entries[:t.next]
+	if t.full {
+		entries = append(t.entries[t.next:], entries...)
+	}
+
+	lines := make([]string, len(entries))
+
+	for i := range entries {
+		lines[i] = disasm.DebugStep(peekMemory{s}, &entries[i])
+	}
+
+	return lines
+}
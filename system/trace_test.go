@@ -0,0 +1,72 @@
+package system
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+// newTraceSystem runs LDA #$01, NOP and JMP $8000 in a loop, 8 CPU cycles each.
+func newTraceSystem(t *testing.T) *System {
+	t.Helper()
+
+	data := testutil.NewROMFile(0, 1, 1)
+	copy(data.PRG(), []byte{0xA9, 0x01, 0xEA, 0x4C, 0x00, 0x80})
+	data.SetResetVector(0x8000)
+
+	return newTestSystem(t, data)
+}
+
+// tracePCs returns the addresses of the instructions in the trace.
+func tracePCs(nes *System) string {
+	var pcs []string
+
+	for _, line := range nes.Trace() {
+		pcs = append(pcs, strings.Fields(line)[0])
+	}
+
+	return strings.Join(pcs, ",")
+}
+
+func TestSystem_Trace(t *testing.T) {
+	tests := map[string]struct {
+		size  int
+		ticks int
+		want  string
+	}{
+		"not full":  {size: 16, ticks: 60, want: "8000,8002,8003,8000,8002,8003,8000"},
+		"wrapped":   {size: 4, ticks: 100, want: "8003,8000,8002,8003"},
+		"disabled":  {size: 0, ticks: 100, want: ""},
+		"exact fit": {size: 7, ticks: 60, want: "8000,8002,8003,8000,8002,8003,8000"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			nes := newTraceSystem(t)
+			nes.SetTraceSize(tt.size)
+
+			for i := 0; i < tt.ticks; i++ {
+				nes.Tick()
+			}
+
+			testutil.Equal(t, tracePCs(nes), tt.want)
+		})
+	}
+}
+
+// The trace is disassembled in the format of the debug output, with the CPU
+// state before the instruction.
+func TestSystem_TraceFormat(t *testing.T) {
+	nes := newTraceSystem(t)
+	nes.SetTraceSize(1)
+
+	for i := 0; i < 100; i++ {
+		nes.Tick()
+	}
+
+	trace := nes.Trace()
+	testutil.Equal(t, len(trace), 1)
+	testutil.Equal(t, strings.HasPrefix(trace[0], "8003  4C 00 80  JMP $8000"), true)
+	testutil.Equal(t, strings.Contains(trace[0], " A:01 "), true)
+}
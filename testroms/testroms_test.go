@@ -0,0 +1,137 @@
+//go:build testrom
+
+package testroms
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/console"
+	"github.com/maxpoletaev/dendy/internal/loglevel"
+	"github.com/maxpoletaev/dendy/internal/testrom"
+)
+
+const expectedFile = "expected.txt"
+
+var update = flag.Bool("update", false, "record the frame checksums into "+expectedFile)
+
+type testROM struct {
+	line     int
+	rom      string
+	frames   int
+	expected string
+}
+
+func disableLogger(t *testing.T) {
+	t.Helper()
+
+	log.SetOutput(loglevel.New(os.Stderr, loglevel.LevelNone))
+
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
+
+func readExpected(t *testing.T) ([]string, []*testROM) {
+	t.Helper()
+
+	data, err := os.ReadFile(expectedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		lines []string
+		roms  []*testROM
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		lines = append(lines, line)
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if len(fields) != 3 {
+			t.Fatalf("%s:%d: expected <rom> <frames> <expected>", expectedFile, len(lines))
+		}
+
+		frames, err := strconv.Atoi(fields[1])
+		if err != nil || frames < 1 {
+			t.Fatalf("%s:%d: invalid number of frames: %s", expectedFile, len(lines), fields[1])
+		}
+
+		roms = append(roms, &testROM{
+			line:     len(lines) - 1,
+			rom:      fields[0],
+			frames:   frames,
+			expected: fields[2],
+		})
+	}
+
+	return lines, roms
+}
+
+func TestROMs(t *testing.T) {
+	disableLogger(t)
+
+	lines, roms := readExpected(t)
+	updated := false
+
+	for _, tr := range roms {
+		tr := tr
+
+		t.Run(tr.rom, func(t *testing.T) {
+			c, err := console.Open(tr.rom)
+			if os.IsNotExist(err) {
+				t.Skip("rom not found")
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if tr.expected == "status" {
+				if r := testrom.Run(c, testrom.Criteria{Status: true, Timeout: tr.frames}); !r.Passed {
+					t.Fatal(r.Message)
+				}
+
+				return
+			}
+
+			for i := 0; i < tr.frames; i++ {
+				c.RunFrame()
+			}
+
+			actual := testrom.FrameChecksum(c)
+
+			if *update {
+				if actual != tr.expected {
+					lines[tr.line] = fmt.Sprintf("%s %d %s", tr.rom, tr.frames, actual)
+					updated = true
+				}
+
+				return
+			}
+
+			if actual != tr.expected {
+				t.Fatalf("frame %d: expected %s, got %s", tr.frames, tr.expected, actual)
+			}
+		})
+	}
+
+	if updated {
+		data := strings.Join(lines, "\n") + "\n"
+
+		if err := os.WriteFile(expectedFile, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
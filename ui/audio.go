@@ -1,12 +1,16 @@
+//go:build !sdl && !ebiten
+
 package ui
 
 import (
-	"time"
+	"math"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
 type AudioOut struct {
+	*audioPump
+
 	stream   rl.AudioStream
 	volume   float32
 	muted    bool
@@ -21,41 +25,69 @@ func CreateAudio(sampleRate, sampleSize, channels, bufferSize int) *AudioOut {
 	rl.SetAudioStreamVolume(stream, 1.0)
 	rl.PlayAudioStream(stream)
 
+	ready := func() bool {
+		return rl.IsAudioStreamProcessed(stream)
+	}
+
+	write := func(buf []float32) {
+		rl.UpdateAudioStream(stream, buf)
+	}
+
 	return &AudioOut{
-		channels: channels,
-		stream:   stream,
-		volume:   1.0,
+		audioPump: startAudioPump(sampleRate, bufferSize, ready, write),
+		channels:  channels,
+		stream:    stream,
+		volume:    1.0,
 	}
 }
 
 func (s *AudioOut) SetVolume(volume float32) {
-	if volume > 1.0 {
-		volume = 1.0
+	volume = max(0, min(1, volume))
+	s.volume = volume
+
+	if !s.muted {
+		rl.SetMasterVolume(volume)
 	}
+}
 
-	rl.SetMasterVolume(volume)
-	s.volume = volume
+// ChangeVolume adjusts the volume by the given delta and returns the new value.
+// Changing the volume also unmutes the sound.
+func (s *AudioOut) ChangeVolume(delta float32) float32 {
+	volume := s.volume + delta
+	volume = float32(math.Round(float64(volume)*100) / 100) // avoid accumulating float errors
+
+	s.muted = false
+	s.SetVolume(volume)
+
+	return s.volume
+}
+
+func (s *AudioOut) Volume() float32 {
+	return s.volume
+}
+
+func (s *AudioOut) Muted() bool {
+	return s.muted
 }
 
 func (s *AudioOut) Close() {
+	s.stop()
 	rl.StopAudioStream(s.stream)
 	rl.CloseAudioDevice()
 }
 
-func (s *AudioOut) IsStreamProcessed() bool {
-	return rl.IsAudioStreamProcessed(s.stream)
-}
+// SetPaused stops the playback without closing the stream, so that the last
+// buffer is not played over and over while the emulation is paused.
+func (s *AudioOut) SetPaused(paused bool) {
+	s.paused.Store(paused)
 
-func (s *AudioOut) WaitStreamProcessed() {
-	for !rl.IsAudioStreamProcessed(s.stream) {
-		time.Sleep(time.Millisecond * 16)
+	if paused {
+		rl.PauseAudioStream(s.stream)
+	} else {
+		rl.ResumeAudioStream(s.stream)
 	}
 }
 
-func (s *AudioOut) UpdateStream(buf []float32) {
-	rl.UpdateAudioStream(s.stream, buf)
-}
-
 func (s *AudioOut) Mute(m bool) {
 	s.muted = m
 
@@ -66,12 +98,8 @@ func (s *AudioOut) Mute(m bool) {
 	}
 }
 
-func (s *AudioOut) ToggleMute() {
-	s.muted = !s.muted
-
-	if s.muted {
-		rl.SetMasterVolume(0)
-	} else {
-		rl.SetMasterVolume(s.volume)
-	}
+// ToggleMute mutes or unmutes the sound and returns the new state.
+func (s *AudioOut) ToggleMute() bool {
+	s.Mute(!s.muted)
+	return s.muted
 }
@@ -0,0 +1,148 @@
+package ui
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/maxpoletaev/dendy/internal/ringbuf"
+)
+
+// audioRingBuffers is the number of buffers the ring between the emulation and
+// the audio output can hold. The offline emulation keeps it nearly empty, as it
+// waits for the stream to be processed, the rest is for the netplay, which
+// does not.
+const audioRingBuffers = 3
+
+// AudioStats are the counters of the problems with the audio output since it
+// was created.
+type AudioStats struct {
+	Underruns uint64 // times the output ran out of the samples to play
+	Dropped   uint64 // samples dropped as the ring was full
+}
+
+// audioPump passes the samples from the emulation to the audio output on its
+// own goroutine, so that the emulation never waits for the output. The samples
+// go through a lock-free ring, as the emulation pushes them in the middle of the
+// frame. The output is given a whole buffer at a time, unless it runs out of
+// the samples, which is counted as an underrun.
+type audioPump struct {
+	ring       *ringbuf.SPSC[float32]
+	buf        []float32
+	bufferTime time.Duration
+	ready      func() bool // the output can take another buffer
+	write      func(buf []float32)
+
+	paused    atomic.Bool
+	underruns atomic.Uint64
+	dropped   atomic.Uint64
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+func startAudioPump(sampleRate, bufferSize int, ready func() bool, write func([]float32)) *audioPump {
+	p := &audioPump{
+		ring:       ringbuf.NewSPSC[float32](bufferSize * audioRingBuffers),
+		buf:        make([]float32, bufferSize),
+		bufferTime: time.Duration(bufferSize) * time.Second / time.Duration(sampleRate),
+		ready:      ready,
+		write:      write,
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+
+	go p.run()
+
+	return p
+}
+
+func (p *audioPump) run() {
+	defer close(p.stopped)
+
+	var (
+		starving time.Time // since when the output waits for the samples
+		played   bool      // nothing to run out of before the first samples
+	)
+
+	for {
+		select {
+		case <-p.done:
+			return
+		default:
+		}
+
+		switch {
+		case p.paused.Load():
+			// The samples queued before the pause are not played after it.
+			p.ring.Discard()
+			starving = time.Time{}
+
+		case !p.ready():
+			starving = time.Time{}
+
+		case p.ring.Len() < len(p.buf):
+			// The output still has the last buffer to play, which is the time
+			// left for the emulation to catch up.
+			if starving.IsZero() {
+				starving = time.Now()
+			} else if time.Since(starving) >= p.bufferTime {
+				if played {
+					p.underruns.Add(1)
+				}
+
+				p.flush()
+
+				starving = time.Time{}
+			}
+
+		default:
+			p.flush()
+			played = true
+
+			continue
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (p *audioPump) flush() {
+	if n := p.ring.Pop(p.buf); n > 0 {
+		p.write(p.buf[:n])
+	}
+}
+
+func (p *audioPump) stop() {
+	close(p.done)
+	<-p.stopped
+}
+
+// IsStreamProcessed returns true when less than a buffer is waiting to be
+// played, so that the next one can be queued without adding to the latency.
+func (p *audioPump) IsStreamProcessed() bool {
+	return p.ring.Len() < len(p.buf)
+}
+
+// WaitStreamProcessed waits until the next buffer can be queued, which keeps
+// the emulation at the pace of the audio output.
+func (p *audioPump) WaitStreamProcessed() {
+	for !p.IsStreamProcessed() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// UpdateStream queues the samples without waiting for the output. The ones
+// that do not fit into the ring are dropped.
+func (p *audioPump) UpdateStream(buf []float32) {
+	if n := p.ring.Push(buf); n < len(buf) {
+		p.dropped.Add(uint64(len(buf) - n))
+	}
+}
+
+// Stats returns the counters of the audio problems. Safe to call from any
+// goroutine.
+func (p *audioPump) Stats() AudioStats {
+	return AudioStats{
+		Underruns: p.underruns.Load(),
+		Dropped:   p.dropped.Load(),
+	}
+}
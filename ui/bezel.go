@@ -0,0 +1,133 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+)
+
+// bezelAlphaThreshold is the opacity below which a bezel pixel is considered
+// a part of the cutout. Bezels often have a semi-transparent glass reflection
+// over the screen, which should not be mistaken for the border.
+const bezelAlphaThreshold = 0x80
+
+// Bezel is a decorative border image drawn around the frame in fullscreen mode.
+// The frame is fitted into the cutout, which is the transparent area in the
+// middle of the image, with black bars if the aspect ratios do not match.
+type Bezel struct {
+	Image  *image.NRGBA    // straight alpha, as the frontends expect
+	Cutout image.Rectangle // in the image pixels
+}
+
+// LoadBezel reads the bezel from a PNG file. If the cutout is empty, it is
+// detected as the transparent rectangle around the centre of the image.
+func LoadBezel(filename string, cutout image.Rectangle) (*Bezel, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	src, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode bezel: %w", err)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	if cutout.Empty() {
+		if cutout, err = findCutout(img); err != nil {
+			return nil, err
+		}
+	}
+
+	if !cutout.In(img.Bounds()) {
+		return nil, fmt.Errorf("bezel cutout %v is outside of the image %v", cutout, img.Bounds())
+	}
+
+	return &Bezel{Image: img, Cutout: cutout}, nil
+}
+
+// findCutout scans the image from the centre along the middle row and column
+// until it reaches the opaque pixels on each side.
+func findCutout(img *image.NRGBA) (image.Rectangle, error) {
+	var (
+		bounds = img.Bounds()
+		cx     = bounds.Dx() / 2
+		cy     = bounds.Dy() / 2
+	)
+
+	transparent := func(x, y int) bool {
+		return img.NRGBAAt(x, y).A < bezelAlphaThreshold
+	}
+
+	if !transparent(cx, cy) {
+		return image.Rectangle{}, errors.New("bezel has no transparent cutout in the centre")
+	}
+
+	r := image.Rect(cx, cy, cx+1, cy+1)
+
+	for r.Min.X > bounds.Min.X && transparent(r.Min.X-1, cy) {
+		r.Min.X--
+	}
+
+	for r.Max.X < bounds.Max.X && transparent(r.Max.X, cy) {
+		r.Max.X++
+	}
+
+	for r.Min.Y > bounds.Min.Y && transparent(cx, r.Min.Y-1) {
+		r.Min.Y--
+	}
+
+	for r.Max.Y < bounds.Max.Y && transparent(cx, r.Max.Y) {
+		r.Max.Y++
+	}
+
+	return r, nil
+}
+
+// layout returns the area of the screen the bezel is drawn to, which is the
+// whole image scaled to fit the screen, and the area of its cutout.
+func (b *Bezel) layout(screenWidth, screenHeight float32) (area, cutout viewport) {
+	var (
+		imageWidth  = float32(b.Image.Bounds().Dx())
+		imageHeight = float32(b.Image.Bounds().Dy())
+		scale       = min(screenWidth/imageWidth, screenHeight/imageHeight)
+	)
+
+	area = viewport{
+		x:      (screenWidth - imageWidth*scale) / 2,
+		y:      (screenHeight - imageHeight*scale) / 2,
+		width:  imageWidth * scale,
+		height: imageHeight * scale,
+	}
+
+	cutout = viewport{
+		x:      area.x + float32(b.Cutout.Min.X)*scale,
+		y:      area.y + float32(b.Cutout.Min.Y)*scale,
+		width:  float32(b.Cutout.Dx()) * scale,
+		height: float32(b.Cutout.Dy()) * scale,
+	}
+
+	return area, cutout
+}
+
+// fitBezelViewport is fitViewport for the screen with the bezel, in which case
+// the frame is fitted into the cutout instead of the whole screen.
+func fitBezelViewport(b *Bezel, screenWidth, screenHeight float32, mode ScaleMode, pixelAspect bool) viewport {
+	if b == nil {
+		return fitViewport(screenWidth, screenHeight, mode, pixelAspect)
+	}
+
+	_, cutout := b.layout(screenWidth, screenHeight)
+	v := fitViewport(cutout.width, cutout.height, mode, pixelAspect)
+	v.x += cutout.x
+	v.y += cutout.y
+
+	return v
+}
@@ -0,0 +1,140 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	"path/filepath"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	browserFontSize   = 10
+	browserLineHeight = 14
+	browserPadding    = 10
+)
+
+type romBrowser struct {
+	dir      string
+	recent   []RecentROM
+	entries  []browserEntry
+	selected int
+	scroll   int
+	err      error
+}
+
+func (b *romBrowser) open(dir string) {
+	entries, err := listROMs(dir)
+	if err != nil {
+		b.err = err
+		return
+	}
+
+	b.dir = dir
+	b.err = nil
+	b.entries = b.entries[:0]
+	b.selected = 0
+	b.scroll = 0
+
+	// Recently played games are only listed at the starting directory.
+	for _, r := range b.recent {
+		label := "* " + filepath.Base(r.Path)
+		if r.Detail != "" {
+			label += "  (" + r.Detail + ")"
+		}
+
+		b.entries = append(b.entries, browserEntry{label: label, path: r.Path})
+	}
+
+	b.recent = nil
+
+	if parent := filepath.Dir(dir); parent != dir {
+		b.entries = append(b.entries, browserEntry{label: "../", path: parent, dir: true})
+	}
+
+	b.entries = append(b.entries, entries...)
+}
+
+func (b *romBrowser) move(delta int) {
+	b.selected = max(0, min(len(b.entries)-1, b.selected+delta))
+}
+
+// SelectROM displays a simple file browser starting at the given directory,
+// with the recently played games listed on top. It blocks until a ROM file is
+// chosen and returns its path, or an empty string if the window was closed.
+func (w *Window) SelectROM(dir string, recent []RecentROM) string {
+	browser := &romBrowser{recent: recent}
+	browser.open(dir)
+
+	for !w.ShouldClose() {
+		visibleLines := (rl.GetScreenHeight() - browserPadding*3 - browserLineHeight*2) / browserLineHeight
+		visibleLines = max(1, visibleLines)
+
+		switch {
+		case rl.IsKeyPressed(rl.KeyEscape):
+			return ""
+		case rl.IsKeyPressed(rl.KeyDown), rl.IsKeyPressedRepeat(rl.KeyDown):
+			browser.move(1)
+		case rl.IsKeyPressed(rl.KeyUp), rl.IsKeyPressedRepeat(rl.KeyUp):
+			browser.move(-1)
+		case rl.IsKeyPressed(rl.KeyPageDown):
+			browser.move(visibleLines)
+		case rl.IsKeyPressed(rl.KeyPageUp):
+			browser.move(-visibleLines)
+		case rl.IsKeyPressed(rl.KeyBackspace):
+			browser.open(filepath.Dir(browser.dir))
+		case rl.IsKeyPressed(rl.KeyEnter):
+			if len(browser.entries) > 0 {
+				entry := browser.entries[browser.selected]
+				if !entry.dir {
+					return entry.path
+				}
+
+				browser.open(entry.path)
+			}
+		}
+
+		if wheel := rl.GetMouseWheelMove(); wheel != 0 {
+			browser.move(-int(wheel) * 3)
+		}
+
+		// Keep the selected line visible.
+		if browser.selected < browser.scroll {
+			browser.scroll = browser.selected
+		} else if browser.selected >= browser.scroll+visibleLines {
+			browser.scroll = browser.selected - visibleLines + 1
+		}
+
+		rl.BeginDrawing()
+		rl.ClearBackground(rl.Black)
+		w.drawBrowser(browser, visibleLines)
+		rl.EndDrawing()
+	}
+
+	return ""
+}
+
+func (w *Window) drawBrowser(b *romBrowser, visibleLines int) {
+	y := int32(browserPadding)
+	w.drawTextWithShadow(b.dir, browserPadding, y, browserFontSize, rl.White)
+	y += browserLineHeight + browserPadding
+
+	if b.err != nil {
+		w.drawTextWithShadow(b.err.Error(), browserPadding, y, browserFontSize, rl.Red)
+		y += browserLineHeight
+	}
+
+	for i := b.scroll; i < len(b.entries) && i < b.scroll+visibleLines; i++ {
+		colour := rl.LightGray
+		if i == b.selected {
+			colour = rl.Yellow
+		}
+
+		w.drawTextWithShadow(b.entries[i].label, browserPadding, y, browserFontSize, colour)
+		y += browserLineHeight
+	}
+
+	hint := "Enter: open   Backspace: parent directory   Esc: quit"
+	screenHeight := int32(rl.GetScreenHeight())
+	w.drawTextWithShadow(hint, browserPadding, screenHeight-browserFontSize-browserPadding, browserFontSize, rl.Gray)
+}
@@ -0,0 +1,200 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	"fmt"
+	"strconv"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+
+	"github.com/maxpoletaev/dendy/cheats"
+)
+
+// cheatSearchView is the state of the cheat search panel. The search itself is
+// kept in Window.CheatSearch, so that it survives closing the panel to play.
+type cheatSearchView struct {
+	operand  string // decimal number typed for the comparisons that take one
+	selected int
+	last     string // description of the last filter applied
+}
+
+func (w *Window) openCheatSearch() {
+	if w.CheatSearch == nil {
+		return
+	}
+
+	w.cheatView = &cheatSearchView{}
+}
+
+func (w *Window) closeCheatSearch() {
+	w.cheatView = nil
+}
+
+func (w *Window) filterCheatSearch(cmp cheats.Comparison) {
+	var (
+		v       = w.cheatView
+		n, err  = strconv.Atoi(v.operand)
+		operand = uint8(n)
+	)
+
+	switch cmp {
+	case cheats.IncreasedBy, cheats.DecreasedBy, cheats.EqualTo:
+		if err != nil || n > 255 {
+			w.ShowMessage("Type a number from 0 to 255 first")
+			return
+		}
+
+		v.last = fmt.Sprintf("%s %d", cmp, n)
+	default:
+		v.last = cmp.String()
+	}
+
+	w.CheatSearch.Filter(cmp, operand)
+	v.operand = ""
+	v.selected = 0
+}
+
+// freezeSelected turns the selected candidate into a cheat freezing its value,
+// which is the current one, unless another value is typed.
+func (w *Window) freezeSelected() {
+	v := w.cheatView
+
+	candidates := w.CheatSearch.Candidates(v.selected + 1)
+	if w.FreezeDelegate == nil || v.selected >= len(candidates) {
+		return
+	}
+
+	var (
+		c     = candidates[v.selected]
+		value = c.Value
+	)
+
+	if v.operand != "" {
+		n, err := strconv.Atoi(v.operand)
+		if err != nil || n > 255 {
+			w.ShowMessage("Type a number from 0 to 255 first")
+			return
+		}
+
+		value = uint8(n)
+		v.operand = ""
+	}
+
+	w.FreezeDelegate(c.Addr, value)
+}
+
+// handleCheatSearchKeys processes the panel keys. The filters are typed as
+// characters, so that the symbols on the shifted keys work on any layout.
+func (w *Window) handleCheatSearchKeys() {
+	v := w.cheatView
+
+	switch {
+	case rl.IsKeyPressed(rl.KeyF6), rl.IsKeyPressed(rl.KeyEscape):
+		w.closeCheatSearch()
+		return
+
+	case rl.IsKeyPressed(rl.KeyBackspace):
+		if len(v.operand) > 0 {
+			v.operand = v.operand[:len(v.operand)-1]
+		}
+
+	case rl.IsKeyPressed(rl.KeyDown):
+		v.selected = min(v.selected+1, max(w.CheatSearch.Count()-1, 0))
+
+	case rl.IsKeyPressed(rl.KeyUp):
+		v.selected = max(v.selected-1, 0)
+
+	case rl.IsKeyPressed(rl.KeyEnter):
+		w.freezeSelected()
+	}
+
+	for c := rl.GetCharPressed(); c != 0; c = rl.GetCharPressed() {
+		switch {
+		case c >= '0' && c <= '9':
+			if len(v.operand) < 3 {
+				v.operand += string(c)
+			}
+
+		case c == '=':
+			if v.operand != "" {
+				w.filterCheatSearch(cheats.EqualTo)
+			} else {
+				w.filterCheatSearch(cheats.Unchanged)
+			}
+
+		case c == '!':
+			w.filterCheatSearch(cheats.Changed)
+		case c == '>':
+			w.filterCheatSearch(cheats.Increased)
+		case c == '<':
+			w.filterCheatSearch(cheats.Decreased)
+		case c == '+':
+			w.filterCheatSearch(cheats.IncreasedBy)
+		case c == '-':
+			w.filterCheatSearch(cheats.DecreasedBy)
+
+		case c == 'r', c == 'R':
+			w.CheatSearch.Restart()
+			v.selected = 0
+			v.last = ""
+		}
+	}
+}
+
+func (w *Window) drawCheatSearch() {
+	const (
+		padding   = 10
+		titleSize = 20
+		textSize  = 10
+		lineSize  = 12
+	)
+
+	var (
+		v            = w.cheatView
+		screenWidth  = int32(rl.GetScreenWidth())
+		screenHeight = int32(rl.GetScreenHeight())
+		count        = w.CheatSearch.Count()
+	)
+
+	rl.DrawRectangle(0, 0, screenWidth, screenHeight, memViewBackground)
+	w.drawTextWithShadow(fmt.Sprintf("Cheat Search: %d found", count), padding, padding, titleSize, rl.White)
+
+	status := "Value: " + v.operand + "_"
+	if v.last != "" {
+		status += "   Last filter: " + v.last
+	}
+
+	top := int32(padding*2 + titleSize)
+	w.drawTextWithShadow(status, padding, top, textSize, rl.Yellow)
+	top += lineSize * 2
+
+	// Scroll the list to keep the selected candidate visible.
+	rows := max(int((screenHeight-top-textSize*2-padding*3)/lineSize), 1)
+	first := max(v.selected-rows+1, 0)
+
+	for i, c := range w.CheatSearch.Candidates(first + rows)[first:] {
+		colour := rl.LightGray
+		if c.Value != c.Prev {
+			colour = rl.Red
+		}
+
+		if first+i == v.selected {
+			rl.DrawRectangle(padding-2, top-1, screenWidth-padding*2, lineSize, rl.DarkBlue)
+		}
+
+		line := fmt.Sprintf("%04X   %3d -> %3d   ($%02X)", c.Addr, c.Prev, c.Value, c.Value)
+		w.drawTextWithShadow(line, padding, top, textSize, colour)
+		top += lineSize
+	}
+
+	hints := []string{
+		"=: same or equal to value   !: changed   > <: greater/less   + -: by value",
+		"0-9: value   Enter: freeze selected   R: restart   F6: close",
+	}
+
+	for i, hint := range hints {
+		y := screenHeight - padding - int32(len(hints)-i)*lineSize
+		w.drawTextWithShadow(hint, padding, y, textSize, rl.LightGray)
+	}
+}
@@ -0,0 +1,76 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// copyImageCommand returns the command that puts the PNG file into the system
+// clipboard. Neither raylib nor SDL can copy images, so this is left to the
+// tools that come with the system, or are commonly installed on Linux.
+func copyImageCommand(path string) (*exec.Cmd, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf(`set the clipboard to (read (POSIX file %q) as «class PNGf»)`, path)
+		return exec.Command("osascript", "-e", script), nil
+
+	case "windows":
+		script := "Add-Type -AssemblyName System.Windows.Forms, System.Drawing; " +
+			"[System.Windows.Forms.Clipboard]::SetImage([System.Drawing.Image]::FromFile('" +
+			strings.ReplaceAll(path, "'", "''") + "'))"
+		return exec.Command("powershell", "-NoProfile", "-STA", "-Command", script), nil
+
+	default:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var cmd *exec.Cmd
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			cmd = exec.Command("wl-copy", "--type", "image/png")
+		} else {
+			cmd = exec.Command("xclip", "-selection", "clipboard", "-target", "image/png")
+		}
+
+		// The file is passed as is rather than through a pipe, since the tools
+		// fork into the background to serve the clipboard, and Run would not
+		// return until the pipe is closed by all of them.
+		cmd.Stdin = f
+
+		return cmd, nil
+	}
+}
+
+// copyImageToClipboard copies the PNG file to the clipboard in the background,
+// as it takes a while to start the external tool. Errors are only logged.
+func copyImageToClipboard(path string) {
+	cmd, err := copyImageCommand(path)
+	if err != nil {
+		log.Printf("[ERROR] failed to copy screenshot to clipboard: %s", err)
+		return
+	}
+
+	go func() {
+		if f, ok := cmd.Stdin.(*os.File); ok {
+			defer f.Close()
+		}
+
+		if err := cmd.Run(); err != nil {
+			log.Printf("[ERROR] failed to copy screenshot to clipboard: %s", err)
+			return
+		}
+
+		log.Printf("[INFO] screenshot copied to clipboard: %s", path)
+	}()
+}
@@ -0,0 +1,188 @@
+//go:build ebiten && !sdl
+
+package ui
+
+import (
+	"encoding/binary"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2/audio"
+)
+
+// audioQueue is the source of the Ebiten audio player. The samples are queued
+// by UpdateStream and played in the 16-bit stereo format Ebiten requires.
+type audioQueue struct {
+	mut sync.Mutex
+	buf []byte
+}
+
+// Read never blocks, the missing samples are filled with silence.
+func (q *audioQueue) Read(p []byte) (int, error) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	n := copy(p, q.buf)
+	q.buf = q.buf[:copy(q.buf, q.buf[n:])]
+	clear(p[n:])
+
+	return len(p), nil
+}
+
+func (q *audioQueue) queued() int {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	return len(q.buf)
+}
+
+func (q *audioQueue) push(samples []byte) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	q.buf = append(q.buf, samples...)
+}
+
+func (q *audioQueue) clear() {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	q.buf = q.buf[:0]
+}
+
+// AudioOut is the Ebiten implementation of the audio output.
+type AudioOut struct {
+	*audioPump
+
+	player     *audio.Player
+	queue      *audioQueue
+	volume     float32
+	muted      bool
+	channels   int
+	bufferSize int
+	samples    []byte
+}
+
+func CreateAudio(sampleRate, sampleSize, channels, bufferSize int) *AudioOut {
+	queue := &audioQueue{}
+	ctx := audio.NewContext(sampleRate)
+
+	player, err := ctx.NewPlayer(queue)
+	if err != nil {
+		log.Fatalf("[ERROR] failed to create audio player: %s", err)
+	}
+
+	// Keep the latency close to the other frontends.
+	player.SetBufferSize(time.Duration(bufferSize) * time.Second / time.Duration(sampleRate))
+	player.Play()
+
+	s := &AudioOut{
+		player:     player,
+		queue:      queue,
+		channels:   channels,
+		bufferSize: bufferSize,
+		volume:     1.0,
+	}
+
+	s.audioPump = startAudioPump(sampleRate, bufferSize, s.processed, s.push)
+
+	return s
+}
+
+func (s *AudioOut) SetVolume(volume float32) {
+	s.volume = max(0, min(1, volume))
+
+	if !s.muted {
+		s.player.SetVolume(float64(s.volume))
+	}
+}
+
+// ChangeVolume adjusts the volume by the given delta and returns the new value.
+// Changing the volume also unmutes the sound.
+func (s *AudioOut) ChangeVolume(delta float32) float32 {
+	volume := s.volume + delta
+	volume = float32(math.Round(float64(volume)*100) / 100) // avoid accumulating float errors
+
+	s.muted = false
+	s.SetVolume(volume)
+
+	return s.volume
+}
+
+func (s *AudioOut) Volume() float32 {
+	return s.volume
+}
+
+func (s *AudioOut) Muted() bool {
+	return s.muted
+}
+
+func (s *AudioOut) Close() {
+	s.stop()
+
+	if err := s.player.Close(); err != nil {
+		log.Printf("[ERROR] failed to close audio player: %s", err)
+	}
+}
+
+// processed returns true when no more than one buffer is left in the queue,
+// so that the next one can be queued without a gap in the playback.
+func (s *AudioOut) processed() bool {
+	const bytesPerFrame = 4 // 16-bit stereo
+	return s.queue.queued()/bytesPerFrame <= s.bufferSize
+}
+
+// push is called by the audio pump with the samples to play. They are
+// converted to 16-bit stereo and queued.
+func (s *AudioOut) push(buf []float32) {
+	s.samples = s.samples[:0]
+
+	for i := 0; i < len(buf); i += s.channels {
+		left := buf[i]
+		right := left
+
+		if s.channels > 1 {
+			right = buf[i+1]
+		}
+
+		s.samples = binary.LittleEndian.AppendUint16(s.samples, uint16(toInt16(left)))
+		s.samples = binary.LittleEndian.AppendUint16(s.samples, uint16(toInt16(right)))
+	}
+
+	s.queue.push(s.samples)
+}
+
+func toInt16(sample float32) int16 {
+	return int16(max(-1, min(1, sample)) * math.MaxInt16)
+}
+
+// SetPaused stops the playback without closing the player. The queued samples
+// are dropped, so that they are not played after resuming.
+func (s *AudioOut) SetPaused(paused bool) {
+	s.paused.Store(paused)
+
+	if paused {
+		s.player.Pause()
+		s.queue.clear()
+	} else {
+		s.player.Play()
+	}
+}
+
+func (s *AudioOut) Mute(m bool) {
+	s.muted = m
+
+	if s.muted {
+		s.player.SetVolume(0)
+	} else {
+		s.player.SetVolume(float64(s.volume))
+	}
+}
+
+// ToggleMute mutes or unmutes the sound and returns the new state.
+func (s *AudioOut) ToggleMute() bool {
+	s.Mute(!s.muted)
+	return s.muted
+}
@@ -0,0 +1,74 @@
+//go:build ebiten && !sdl
+
+package ui
+
+import (
+	"log"
+	"slices"
+
+	"github.com/hajimehoshi/ebiten/v2"
+
+	"github.com/maxpoletaev/dendy/input"
+)
+
+// Buttons are mapped by their position, so that B and A are the left and the
+// right face buttons, as on the NES controller.
+var gamepadMap = map[ebiten.StandardGamepadButton]input.Button{
+	ebiten.StandardGamepadButtonLeftTop:     input.ButtonUp,
+	ebiten.StandardGamepadButtonLeftBottom:  input.ButtonDown,
+	ebiten.StandardGamepadButtonLeftLeft:    input.ButtonLeft,
+	ebiten.StandardGamepadButtonLeftRight:   input.ButtonRight,
+	ebiten.StandardGamepadButtonRightRight:  input.ButtonA,
+	ebiten.StandardGamepadButtonRightBottom: input.ButtonB,
+	ebiten.StandardGamepadButtonCenterRight: input.ButtonStart,
+	ebiten.StandardGamepadButtonCenterLeft:  input.ButtonSelect,
+}
+
+// checkGamepad notifies about the gamepad being connected or disconnected. Only
+// the gamepads with the standard layout are used, as the buttons of the others
+// cannot be mapped reliably.
+func (w *Window) checkGamepad() {
+	w.gamepadIDs = ebiten.AppendGamepadIDs(w.gamepadIDs[:0])
+
+	if w.gamepadConnected {
+		if slices.Contains(w.gamepadIDs, w.gamepadID) {
+			return
+		}
+
+		w.gamepadConnected = false
+		log.Printf("[INFO] gamepad disconnected")
+		w.ShowMessage("Gamepad disconnected, using keyboard")
+	}
+
+	for _, id := range w.gamepadIDs {
+		if ebiten.IsStandardGamepadLayoutAvailable(id) {
+			w.gamepadID = id
+			w.gamepadConnected = true
+
+			name := ebiten.GamepadName(id)
+			log.Printf("[INFO] gamepad connected: %s", name)
+			w.ShowMessage("Gamepad connected: %s", name)
+
+			return
+		}
+	}
+}
+
+// readGamepad returns the joystick buttons held on the gamepad, with the left
+// analog stick acting as the d-pad.
+func (w *Window) readGamepad() (buttons uint8) {
+	if !w.gamepadConnected || (!w.backgroundInput && !ebiten.IsFocused()) {
+		return 0
+	}
+
+	for b, button := range gamepadMap {
+		if ebiten.IsStandardGamepadButtonPressed(w.gamepadID, b) {
+			buttons |= button
+		}
+	}
+
+	x := ebiten.StandardGamepadAxisValue(w.gamepadID, ebiten.StandardGamepadAxisLeftStickHorizontal)
+	y := ebiten.StandardGamepadAxisValue(w.gamepadID, ebiten.StandardGamepadAxisLeftStickVertical)
+
+	return buttons | stickButtons(float32(x), float32(y))
+}
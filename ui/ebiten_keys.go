@@ -0,0 +1,97 @@
+//go:build ebiten && !sdl
+
+package ui
+
+import (
+	"fmt"
+
+	"github.com/hajimehoshi/ebiten/v2"
+
+	"github.com/maxpoletaev/dendy/input"
+)
+
+var defaultKeyMap = map[int32]input.Button{
+	int32(ebiten.KeyW):          input.ButtonUp,
+	int32(ebiten.KeyS):          input.ButtonDown,
+	int32(ebiten.KeyA):          input.ButtonLeft,
+	int32(ebiten.KeyD):          input.ButtonRight,
+	int32(ebiten.KeyK):          input.ButtonA,
+	int32(ebiten.KeyJ):          input.ButtonB,
+	int32(ebiten.KeyEnter):      input.ButtonStart,
+	int32(ebiten.KeyShiftRight): input.ButtonSelect,
+}
+
+// defaultMicKey is held to speak into the microphone, "V" for "voice".
+const defaultMicKey = int32(ebiten.KeyV)
+
+// KeyName returns a human-readable name of a keyboard key, which is also used
+// to store key bindings in the config file.
+func KeyName(key int32) string {
+	return ebiten.Key(key).String()
+}
+
+// ParseKey converts a key name returned by KeyName back to the key code.
+func ParseKey(name string) (int32, error) {
+	var key ebiten.Key
+	if err := key.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown key: %s", name)
+	}
+
+	return int32(key), nil
+}
+
+func (w *Window) UpdateJoystick() {
+	if w.InputDelegate == nil {
+		return
+	}
+
+	var buttons uint8
+
+	w.checkGamepad()
+
+	for key, button := range w.keyMap {
+		if ebiten.IsKeyPressed(ebiten.Key(key)) {
+			buttons |= button
+		}
+	}
+
+	w.InputDelegate(buttons | w.readGamepad())
+
+	if w.MicrophoneDelegate != nil {
+		w.MicrophoneDelegate(ebiten.IsKeyPressed(ebiten.Key(w.micKey)))
+	}
+}
+
+// BindKey assigns the keyboard key to the joystick button, replacing the key
+// that was previously assigned to it.
+func (w *Window) BindKey(button input.Button, key int32) {
+	for k, b := range w.keyMap {
+		if b == button || k == key {
+			delete(w.keyMap, k)
+		}
+	}
+
+	w.keyMap[key] = button
+}
+
+// BoundKey returns the keyboard key assigned to the joystick button.
+func (w *Window) BoundKey(button input.Button) (int32, bool) {
+	for k, b := range w.keyMap {
+		if b == button {
+			return k, true
+		}
+	}
+
+	return 0, false
+}
+
+// BindMicrophoneKey assigns the keyboard key held to speak into the microphone
+// of the second controller.
+func (w *Window) BindMicrophoneKey(key int32) {
+	w.micKey = key
+}
+
+// MicrophoneKey returns the keyboard key assigned to the microphone.
+func (w *Window) MicrophoneKey() int32 {
+	return w.micKey
+}
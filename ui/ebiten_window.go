@@ -0,0 +1,823 @@
+//go:build ebiten && !sdl
+
+package ui
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"github.com/maxpoletaev/dendy/cheats"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/ppu"
+	"github.com/maxpoletaev/dendy/ramwatch"
+)
+
+const (
+	osdMaxMessages    = 4
+	osdDuration       = 3 * time.Second
+	volumeBarDuration = 1500 * time.Millisecond
+	volumeBarWidth    = 100
+	volumeBarHeight   = 6
+	debugCharWidth    = 6 // width of the ebitenutil debug font
+)
+
+// windows passes the created window to Run, which runs the Ebiten event loop on
+// the main thread.
+var windows = make(chan *Window)
+
+// Run starts the main function of the program in a separate goroutine, and
+// runs the Ebiten game loop on the main thread once a window is created. Only
+// one window can be created per process, as Ebiten cannot be restarted.
+func Run(main func()) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		main()
+	}()
+
+	var started bool
+
+	for {
+		select {
+		case w := <-windows:
+			if started {
+				log.Fatalf("[ERROR] the Ebiten frontend supports only one window per process")
+			}
+
+			started = true
+
+			if err := ebiten.RunGame(&ebitenGame{w: w}); err != nil {
+				log.Printf("[ERROR] ebiten: %s", err)
+			}
+
+			w.shouldClose.Store(true) // the window may be closed by the user
+			close(w.exited)
+
+		case <-done:
+			return
+		}
+	}
+}
+
+type timedMessage struct {
+	text    string
+	expires time.Time
+}
+
+// hudState is a snapshot of everything drawn on top of the frame. It is taken
+// by Refresh on the emulator goroutine, and used by Draw on the main thread.
+type hudState struct {
+	overlay     Overlay
+	bezel       *Bezel
+	scaleMode   ScaleMode
+	scaleFilter ScaleFilter
+	pixelAspect bool
+	paused      bool
+	recording   bool
+	muted       bool
+	fastForward bool
+	showVolume  bool
+	volume      float32
+	fpsText     string // empty when not shown
+	pingText    string
+	messages    []string
+	perfRects   []perfRect
+	perfText    []string
+	perfX       int32 // of the text
+	perfY       int32
+}
+
+// Window is the Ebiten implementation of the frontend. Ebiten is pure Go on
+// Windows, so no C compiler is needed to build the emulator for it.
+// Text is drawn with the built-in debug font. Menus, the ROM browser and
+// shaders are not supported.
+type Window struct {
+	ZapperDelegate      func(x, y int, trigger bool)
+	InputDelegate       func(buttons uint8)
+	MicrophoneDelegate  func(on bool)
+	MuteDelegate        func() bool
+	VolumeDelegate      func(delta float32) float32
+	ResyncDelegate      func()
+	ResetDelegate       func()
+	RewindDelegate      func()
+	FastForwardDelegate func(enabled bool)
+	PauseDelegate       func()
+	FrameStepDelegate   func()
+	ListSlotsDelegate   func() []SaveSlot
+	SaveSlotDelegate    func(slot int) error
+	LoadSlotDelegate    func(slot int) error
+	RecordDelegate      func() bool
+	MenuDelegate        func() []MenuItem
+	GIFDelegate         func()
+	PPUDelegate         func() *ppu.PPU                // the PPU viewer is only in the raylib frontend
+	DiskSideDelegate    func()                         // switches the side of the FDS disk
+	MemorySpaces        []MemorySpace                  // the memory viewer is only in the raylib frontend
+	CheatSearch         *cheats.Search                 // same for the cheat search
+	FreezeDelegate      func(addr uint16, value uint8) // and for freezing its results
+	RAMWatch            *ramwatch.List                 // and for the RAM watch
+	RAMWatchDelegate    func()
+	RegistersDelegate   func() []string // and for the register overlay
+	ShowPing            bool
+	ShowFPS             bool
+	ShowPerf            bool
+	FPS                 int
+
+	micKey      int32
+	keyMap      map[int32]input.Button
+	pressed     map[ebiten.Key]bool
+	frame       []color.RGBA
+	overlay     Overlay
+	bezel       *Bezel
+	remotePing  int64
+	grayscale   bool
+	scaleMode   ScaleMode
+	scaleFilter ScaleFilter
+	pixelAspect bool
+	fastForward bool
+	paused      bool
+	recording   bool
+	muted       bool
+	volume      float32
+	messages    []timedMessage
+	fpsCounter  fpsCounter
+	fpsText     numberText
+	pingText    numberText
+	pacer       framePacer
+	perf        *perfStats
+
+	volumeShownUntil time.Time
+	gamepadID        ebiten.GamepadID
+	gamepadIDs       []ebiten.GamepadID
+	gamepadConnected bool
+	backgroundInput  bool
+
+	screenshotDir    string
+	screenshotPrefix string
+	copyScreenshots  bool
+
+	// Shared with the Ebiten goroutine.
+	mut          sync.Mutex
+	texture      *ebiten.Image
+	pixels       []byte
+	dirty        bool
+	hud          hudState
+	pendingKeys  []ebiten.Key
+	screenWidth  int
+	screenHeight int
+	hudWidth     int32         // of the HUD layer, in the window coordinates
+	drawTime     time.Duration // of the last Draw, for the performance HUD
+	exited       chan struct{}
+	shouldClose  atomic.Bool
+}
+
+// CreateWindow creates the window and hands it over to Run, so it must only be
+// called from the main function passed to Run.
+func CreateWindow(opts WindowOptions) *Window {
+	frameWidth := float64(ppu.FrameWidth)
+	if opts.PixelAspect {
+		frameWidth *= pixelAspect87
+	}
+
+	ebiten.SetWindowTitle("Dendy Emulator")
+	ebiten.SetWindowSize(int(math.Round(frameWidth*float64(opts.Scale))), ppu.FrameHeight*opts.Scale)
+	ebiten.SetWindowSizeLimits(ppu.FrameWidth, ppu.FrameHeight, -1, -1)
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+	ebiten.SetFullscreen(opts.Fullscreen)
+	ebiten.SetVsyncEnabled(opts.VSync)
+	ebiten.SetRunnableOnUnfocused(true) // the remote player does not wait
+
+	keyMap := make(map[int32]input.Button, len(defaultKeyMap))
+	for key, button := range defaultKeyMap {
+		keyMap[key] = button
+	}
+
+	w := &Window{
+		micKey:      defaultMicKey,
+		keyMap:      keyMap,
+		pressed:     make(map[ebiten.Key]bool),
+		texture:     ebiten.NewImage(ppu.FrameWidth, ppu.FrameHeight),
+		pixels:      make([]byte, ppu.FrameWidth*ppu.FrameHeight*4),
+		exited:      make(chan struct{}),
+		scaleMode:   opts.ScaleMode,
+		scaleFilter: opts.Filter,
+		pixelAspect: opts.PixelAspect,
+		overlay:     opts.Overlay,
+		volume:      1.0,
+		fpsText:     numberText{suffix: " fps"},
+		pingText:    numberText{suffix: " ms"},
+
+		backgroundInput:  opts.BackgroundInput,
+		screenshotDir:    opts.ScreenshotDir,
+		screenshotPrefix: opts.ScreenshotPrefix,
+		copyScreenshots:  opts.CopyScreenshots,
+	}
+
+	windows <- w
+
+	return w
+}
+
+// EnableShader is not supported by the Ebiten frontend, since Ebiten shaders
+// are written in its own language rather than GLSL.
+func (w *Window) EnableShader(code string) {
+	log.Printf("[WARN] GLSL shaders are not supported by the Ebiten frontend")
+}
+
+// DisableShader is a no-op, as shaders are not supported by the Ebiten frontend.
+func (w *Window) DisableShader() {}
+
+// SetScaleMode changes how the frame is fitted into the window.
+func (w *Window) SetScaleMode(mode ScaleMode) {
+	w.scaleMode = mode
+}
+
+// SetScaleFilter changes how the frame pixels are interpolated when scaled.
+func (w *Window) SetScaleFilter(f ScaleFilter) {
+	w.scaleFilter = f
+}
+
+// SetPixelAspect enables or disables the 8:7 pixel aspect ratio correction.
+func (w *Window) SetPixelAspect(enabled bool) {
+	w.pixelAspect = enabled
+}
+
+// SetOverlay sets the overlay filter drawn on top of the frame.
+func (w *Window) SetOverlay(o Overlay) {
+	w.overlay = o
+}
+
+// SetBezel sets the image drawn around the frame in fullscreen mode, or removes
+// it if nil.
+func (w *Window) SetBezel(b *Bezel) {
+	w.bezel = b
+}
+
+// activeBezel returns the bezel if it should be drawn, which is only the case
+// in fullscreen mode, as there is no room for it in a window.
+func activeBezel(b *Bezel) *Bezel {
+	if b == nil || !ebiten.IsFullscreen() {
+		return nil
+	}
+
+	return b
+}
+
+func (w *Window) SetTitle(title string) {
+	ebiten.SetWindowTitle(title)
+}
+
+// SetFrameRate limits the number of frames per second. The Ebiten game loop only
+// runs at whole rates, so Refresh paces the frames by itself and the game loop
+// keeps drawing the latest one. Ebiten does not report the monitor refresh rate,
+// so the frames cannot be synchronized with it as in the other frontends.
+func (w *Window) SetFrameRate(fps float64) {
+	w.pacer.setRate(fps)
+}
+
+func (w *Window) SetGrayscale(grayscale bool) {
+	w.grayscale = grayscale
+}
+
+// Close stops the Ebiten game loop and waits until the window is closed.
+func (w *Window) Close() {
+	w.shouldClose.Store(true)
+	<-w.exited
+}
+
+func (w *Window) ShouldClose() bool {
+	return w.shouldClose.Load()
+}
+
+func (w *Window) SetPingInfo(pingMs int64) {
+	w.remotePing = pingMs
+}
+
+// SetFrameTimes reports the time spent emulating the frame about to be shown
+// and replaying the netplay rollbacks, for the performance HUD.
+func (w *Window) SetFrameTimes(emulation, rollback time.Duration) {
+	if w.perf != nil {
+		w.perf.report(emulation, rollback)
+	}
+}
+
+// SetRecording controls whether the recording indicator is displayed.
+func (w *Window) SetRecording(recording bool) {
+	w.recording = recording
+}
+
+// SetPaused controls whether the pause message is displayed on top of the frame.
+func (w *Window) SetPaused(paused bool) {
+	w.paused = paused
+}
+
+// ShowMessage adds a message to the on-screen display, only the most recent
+// messages are kept.
+func (w *Window) ShowMessage(format string, args ...any) {
+	if len(w.messages) == osdMaxMessages {
+		w.messages = w.messages[1:]
+	}
+
+	w.messages = append(w.messages, timedMessage{
+		text:    fmt.Sprintf(format, args...),
+		expires: time.Now().Add(osdDuration),
+	})
+}
+
+// MenuOpen always returns false, as menus are not supported by the Ebiten frontend.
+func (w *Window) MenuOpen() bool {
+	return false
+}
+
+// CloseMenu is a no-op, as menus are not supported by the Ebiten frontend.
+func (w *Window) CloseMenu() {}
+
+// OpenSlotMenu is not supported by the Ebiten frontend.
+func (w *Window) OpenSlotMenu() {
+	log.Printf("[WARN] the save slot menu is not supported by the Ebiten frontend")
+}
+
+// SelectROM is not supported by the Ebiten frontend, the ROM file must be
+// passed on the command line.
+func (w *Window) SelectROM(dir string, recent []RecentROM) string {
+	log.Printf("[ERROR] the ROM browser is not supported by the Ebiten frontend")
+	return ""
+}
+
+func (w *Window) InFocus() bool {
+	return ebiten.IsFocused()
+}
+
+func (w *Window) isKeyPressed(key ebiten.Key) bool {
+	return w.pressed[key]
+}
+
+func (w *Window) isModifierPressed() bool {
+	return ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+}
+
+func (w *Window) viewport() viewport {
+	w.mut.Lock()
+	width, height := w.screenWidth, w.screenHeight
+	w.mut.Unlock()
+
+	return fitBezelViewport(activeBezel(w.bezel), float32(width), float32(height), w.scaleMode, w.pixelAspect)
+}
+
+func (w *Window) snapshotHUD(now time.Time) hudState {
+	for len(w.messages) > 0 && !w.messages[0].expires.After(now) {
+		w.messages = w.messages[1:]
+	}
+
+	messages := make([]string, len(w.messages))
+	for i, msg := range w.messages {
+		messages[i] = msg.text
+	}
+
+	hud := hudState{
+		overlay:     w.overlay,
+		bezel:       w.bezel,
+		scaleMode:   w.scaleMode,
+		scaleFilter: w.scaleFilter,
+		pixelAspect: w.pixelAspect,
+		paused:      w.paused,
+		recording:   w.recording,
+		muted:       w.muted,
+		fastForward: w.fastForward,
+		showVolume:  now.Before(w.volumeShownUntil),
+		volume:      w.volume,
+		messages:    messages,
+	}
+
+	if w.ShowFPS && w.fpsCounter.fps > 0 {
+		hud.fpsText = w.fpsText.format(w.fpsCounter.fps)
+	}
+
+	if w.ShowPing && w.remotePing > 0 {
+		hud.pingText = w.pingText.format(int(w.remotePing))
+	}
+
+	// The graph is laid out here, as the stats are only used on this goroutine.
+	// Drawing it takes the copies, which are not changed by the next frame.
+	if w.ShowPerf && w.perf != nil {
+		hud.perfRects, hud.perfX, hud.perfY = w.perf.graph(nil, w.hudWidth)
+		hud.perfText = slices.Clone(w.perf.text())
+	}
+
+	return hud
+}
+
+// Refresh passes the frame to the Ebiten goroutine and waits until the next
+// frame is due.
+func (w *Window) Refresh(ppuFrame []color.RGBA) {
+	if w.grayscale {
+		for i, c := range ppuFrame {
+			ppuFrame[i] = toGrayscale(c)
+		}
+	}
+
+	now := time.Now()
+	w.frame = ppuFrame
+	w.fpsCounter.tick(now)
+	clear(w.pressed)
+
+	w.mut.Lock()
+
+	if len(ppuFrame) > 0 {
+		copy(w.pixels, unsafe.Slice((*byte)(unsafe.Pointer(&ppuFrame[0])), len(ppuFrame)*4))
+		w.dirty = true
+	}
+
+	for _, key := range w.pendingKeys {
+		w.pressed[key] = true
+	}
+
+	w.pendingKeys = w.pendingKeys[:0]
+
+	if w.ShowPerf && w.perf == nil {
+		w.perf = newPerfStats()
+	}
+
+	if w.perf != nil {
+		w.perf.record(now, w.drawTime)
+	}
+
+	w.hud = w.snapshotHUD(now)
+	w.mut.Unlock()
+
+	w.pacer.wait()
+}
+
+func (w *Window) handleFastForward() {
+	if w.FastForwardDelegate == nil {
+		return
+	}
+
+	// Fast-forward is active for as long as the key is held.
+	if held := ebiten.IsKeyPressed(ebiten.KeyTab); held != w.fastForward {
+		w.fastForward = held
+		w.FastForwardDelegate(held)
+	}
+}
+
+// SetMuted sets the initial state of the mute indicator.
+func (w *Window) SetMuted(muted bool) {
+	w.muted = muted
+}
+
+// ChangeVolume adjusts the volume through VolumeDelegate and displays the bar.
+func (w *Window) ChangeVolume(delta float32) {
+	if w.VolumeDelegate == nil {
+		return
+	}
+
+	w.volume = w.VolumeDelegate(delta)
+	w.muted = false // changing the volume unmutes the sound
+	w.volumeShownUntil = time.Now().Add(volumeBarDuration)
+}
+
+func (w *Window) toggleMute() {
+	if w.MuteDelegate == nil {
+		return
+	}
+
+	w.muted = w.MuteDelegate()
+
+	if w.muted {
+		w.ShowMessage("Muted")
+	} else {
+		w.ShowMessage("Unmuted")
+	}
+}
+
+func (w *Window) HandleHotKeys() {
+	w.handleFastForward()
+
+	switch {
+	case w.isKeyPressed(ebiten.KeyF12):
+		w.takeScreenshot()
+
+	case w.isKeyPressed(ebiten.KeyF9):
+		if w.RecordDelegate != nil {
+			w.recording = w.RecordDelegate()
+		}
+
+	case w.isKeyPressed(ebiten.KeyF10):
+		if w.GIFDelegate != nil {
+			w.GIFDelegate()
+		}
+
+	case w.isKeyPressed(ebiten.KeyF4):
+		if w.DiskSideDelegate != nil {
+			w.DiskSideDelegate()
+		}
+
+	case w.isKeyPressed(ebiten.KeyF8):
+		w.overlay = (w.overlay + 1) % overlayCount
+		w.ShowMessage("Overlay: %s", w.overlay)
+		log.Printf("[INFO] overlay: %s", w.overlay)
+
+	case w.isKeyPressed(ebiten.KeyP):
+		if w.PauseDelegate != nil {
+			w.PauseDelegate()
+		}
+
+	case w.isKeyPressed(ebiten.KeyN):
+		if w.paused && w.FrameStepDelegate != nil {
+			w.FrameStepDelegate()
+		}
+
+	case w.isKeyPressed(ebiten.KeyM):
+		w.toggleMute()
+
+	case w.isKeyPressed(ebiten.KeyEqual), w.isKeyPressed(ebiten.KeyNumpadAdd):
+		w.ChangeVolume(VolumeStep)
+
+	case w.isKeyPressed(ebiten.KeyMinus), w.isKeyPressed(ebiten.KeyNumpadSubtract):
+		w.ChangeVolume(-VolumeStep)
+
+	case w.isModifierPressed() && w.isKeyPressed(ebiten.KeyQ):
+		w.shouldClose.Store(true)
+
+	case w.isModifierPressed() && w.isKeyPressed(ebiten.KeyR):
+		if w.ResetDelegate != nil {
+			w.ResetDelegate()
+		}
+
+	case w.isModifierPressed() && w.isKeyPressed(ebiten.KeyX):
+		if w.ResyncDelegate != nil {
+			w.ResyncDelegate()
+		}
+
+	case w.isModifierPressed() && w.isKeyPressed(ebiten.KeyZ):
+		if w.RewindDelegate != nil {
+			w.RewindDelegate()
+		}
+	}
+}
+
+func (w *Window) UpdateZapper() {
+	if w.ZapperDelegate == nil {
+		return
+	}
+
+	mx, my := ebiten.CursorPosition()
+	trigger := ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+
+	x, y, ok := w.viewport().frameCoords(float32(mx), float32(my))
+	if !ok {
+		w.ZapperDelegate(-1, -1, trigger)
+		return
+	}
+
+	w.ZapperDelegate(x, y, trigger)
+}
+
+// takeScreenshot saves the last frame in its original resolution, without the
+// overlay and the HUD.
+func (w *Window) takeScreenshot() {
+	path, err := saveFrameScreenshot(w.screenshotDir, w.screenshotPrefix, w.frame)
+	if err != nil {
+		log.Printf("[ERROR] failed to save screenshot: %s", err)
+		return
+	}
+
+	log.Printf("[INFO] screenshot saved: %s", path)
+
+	if w.copyScreenshots {
+		copyImageToClipboard(path)
+		w.ShowMessage("Screenshot saved and copied")
+	} else {
+		w.ShowMessage("Screenshot saved")
+	}
+}
+
+// ebitenGame implements ebiten.Game. Its methods are called on the main thread.
+type ebitenGame struct {
+	w         *Window
+	hudLayer  *ebiten.Image
+	prescaled *ebiten.Image
+
+	bezel      *Bezel
+	bezelImage *ebiten.Image
+}
+
+func (g *ebitenGame) Update() error {
+	w := g.w
+
+	w.mut.Lock()
+	w.pendingKeys = inpututil.AppendJustPressedKeys(w.pendingKeys)
+	w.mut.Unlock()
+
+	if w.shouldClose.Load() {
+		return ebiten.Termination
+	}
+
+	return nil
+}
+
+// Layout makes the screen as large as the window in physical pixels, so that
+// the picture is not upscaled by Ebiten and blurred on high-DPI screens. The
+// cursor position is reported in the same pixels.
+func (g *ebitenGame) Layout(outsideWidth, outsideHeight int) (int, int) {
+	scale := ebiten.DeviceScaleFactor()
+	width := int(math.Ceil(float64(outsideWidth) * scale))
+	height := int(math.Ceil(float64(outsideHeight) * scale))
+
+	g.w.mut.Lock()
+	g.w.screenWidth, g.w.screenHeight = width, height
+	g.w.mut.Unlock()
+
+	return width, height
+}
+
+func (g *ebitenGame) Draw(screen *ebiten.Image) {
+	w := g.w
+	start := time.Now()
+
+	w.mut.Lock()
+
+	if w.dirty {
+		w.texture.WritePixels(w.pixels)
+		w.dirty = false
+	}
+
+	hud := w.hud
+	w.mut.Unlock()
+
+	bounds := screen.Bounds()
+	bezel := activeBezel(hud.bezel)
+	v := fitBezelViewport(bezel, float32(bounds.Dx()), float32(bounds.Dy()), hud.scaleMode, hud.pixelAspect)
+
+	frame := w.texture
+	op := &ebiten.DrawImageOptions{Filter: ebiten.FilterNearest}
+
+	if hud.scaleFilter == ScaleFilterSharpBilinear {
+		frame = g.prescale(v.prescaleFactor())
+		op.Filter = ebiten.FilterLinear
+	}
+
+	op.GeoM.Scale(float64(v.width)/float64(frame.Bounds().Dx()), float64(v.height)/float64(frame.Bounds().Dy()))
+	op.GeoM.Translate(float64(v.x), float64(v.y))
+	screen.DrawImage(frame, op)
+
+	drawEbitenOverlay(screen, v, hud.overlay)
+
+	if bezel != nil {
+		g.drawBezel(screen, bezel)
+	}
+
+	// The debug font has a fixed size in pixels, so the HUD is drawn in the
+	// window coordinates and scaled up to keep it readable on high-DPI screens.
+	scale := ebiten.DeviceScaleFactor()
+	hudWidth := int(float64(bounds.Dx()) / scale)
+	hudHeight := int(float64(bounds.Dy()) / scale)
+
+	if g.hudLayer == nil || g.hudLayer.Bounds().Dx() != hudWidth || g.hudLayer.Bounds().Dy() != hudHeight {
+		if g.hudLayer != nil {
+			g.hudLayer.Dispose()
+		}
+
+		g.hudLayer = ebiten.NewImage(max(1, hudWidth), max(1, hudHeight))
+	}
+
+	g.hudLayer.Clear()
+	drawEbitenHUD(g.hudLayer, v.scaled(float32(1/scale)), &hud)
+
+	hudOp := &ebiten.DrawImageOptions{Filter: ebiten.FilterNearest}
+	hudOp.GeoM.Scale(scale, scale)
+	screen.DrawImage(g.hudLayer, hudOp)
+
+	w.mut.Lock()
+	w.drawTime = time.Since(start)
+	w.hudWidth = int32(hudWidth)
+	w.mut.Unlock()
+}
+
+// prescale draws the frame enlarged by the integer factor with the nearest
+// filter, so that the linear filter only blends the edges of the NES pixels.
+func (g *ebitenGame) prescale(factor int32) *ebiten.Image {
+	width, height := int(ppu.FrameWidth*factor), int(ppu.FrameHeight*factor)
+
+	// The image is recreated whenever the window size crosses an integer scale.
+	if g.prescaled == nil || g.prescaled.Bounds().Dy() != height {
+		if g.prescaled != nil {
+			g.prescaled.Dispose()
+		}
+
+		g.prescaled = ebiten.NewImage(width, height)
+	}
+
+	op := &ebiten.DrawImageOptions{Filter: ebiten.FilterNearest}
+	op.GeoM.Scale(float64(factor), float64(factor))
+	g.prescaled.DrawImage(g.w.texture, op)
+
+	return g.prescaled
+}
+
+// drawBezel draws the bezel image fitted to the screen. The image is uploaded
+// lazily, so that it is created on the main thread, where it is drawn.
+func (g *ebitenGame) drawBezel(screen *ebiten.Image, b *Bezel) {
+	if g.bezel != b {
+		if g.bezelImage != nil {
+			g.bezelImage.Dispose()
+		}
+
+		g.bezel = b
+		g.bezelImage = ebiten.NewImageFromImage(b.Image)
+	}
+
+	area, _ := b.layout(float32(screen.Bounds().Dx()), float32(screen.Bounds().Dy()))
+
+	op := &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear}
+	op.GeoM.Scale(float64(area.width)/float64(b.Image.Bounds().Dx()), float64(area.height)/float64(b.Image.Bounds().Dy()))
+	op.GeoM.Translate(float64(area.x), float64(area.y))
+	screen.DrawImage(g.bezelImage, op)
+}
+
+var overlayShade = color.RGBA{A: 90}
+
+// drawEbitenOverlay darkens every other row (or column) of NES pixels.
+func drawEbitenOverlay(screen *ebiten.Image, v viewport, overlay Overlay) {
+	switch overlay {
+	case OverlayScanlines:
+		step := v.height / ppu.FrameHeight
+		for i := 0; i < ppu.FrameHeight; i++ {
+			y := v.y + float32(i)*step + step/2
+			vector.DrawFilledRect(screen, v.x, y, v.width, step/2, overlayShade, false)
+		}
+	case OverlayGrille:
+		step := v.width / ppu.FrameWidth
+		for i := 0; i < ppu.FrameWidth; i++ {
+			x := v.x + float32(i)*step + step/2
+			vector.DrawFilledRect(screen, x, v.y, step/2, v.height, overlayShade, false)
+		}
+	}
+}
+
+func drawEbitenHUD(screen *ebiten.Image, v viewport, hud *hudState) {
+	bounds := screen.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	offsetY := 0
+
+	if hud.recording {
+		vector.DrawFilledCircle(screen, float32(width-10), 10, 4, color.RGBA{R: 255, A: 255}, true)
+	}
+
+	if hud.fpsText != "" {
+		ebitenutil.DebugPrintAt(screen, hud.fpsText, 4, offsetY)
+		offsetY += 14
+	}
+
+	if hud.fastForward {
+		ebitenutil.DebugPrintAt(screen, ">>", 4, offsetY)
+		offsetY += 14
+	}
+
+	if hud.pingText != "" {
+		ebitenutil.DebugPrintAt(screen, hud.pingText, 4, offsetY)
+	}
+
+	for i, text := range hud.messages {
+		y := height - 18 - (len(hud.messages)-1-i)*14
+		ebitenutil.DebugPrintAt(screen, text, 4, y)
+	}
+
+	if hud.muted {
+		ebitenutil.DebugPrintAt(screen, "MUTE", width-4-4*debugCharWidth, height-18)
+	}
+
+	if hud.showVolume {
+		x := float32(width)/2 - volumeBarWidth/2
+		y := float32(height) - volumeBarHeight - 20
+		vector.DrawFilledRect(screen, x, y, volumeBarWidth, volumeBarHeight, color.RGBA{R: 80, G: 80, B: 80, A: 255}, false)
+		vector.DrawFilledRect(screen, x, y, hud.volume*volumeBarWidth, volumeBarHeight, color.White, false)
+	}
+
+	for _, r := range hud.perfRects {
+		vector.DrawFilledRect(screen, float32(r.x), float32(r.y), float32(r.width), float32(r.height), r.colour, false)
+	}
+
+	for i, line := range hud.perfText {
+		ebitenutil.DebugPrintAt(screen, line, int(hud.perfX), int(hud.perfY)+i*14)
+	}
+
+	if hud.paused {
+		const text = "PAUSED"
+		x := int(v.x+v.width/2) - len(text)*debugCharWidth/2
+		y := int(v.y+v.height/2) - 8
+		ebitenutil.DebugPrintAt(screen, text, x, y)
+	}
+}
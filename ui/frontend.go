@@ -0,0 +1,77 @@
+package ui
+
+import (
+	"image/color"
+	"time"
+
+	"github.com/maxpoletaev/dendy/input"
+)
+
+// Frontend is the contract every window implementation must satisfy. The
+// raylib implementation is used by default, the SDL2 and Ebiten ones are
+// selected with the sdl and ebiten build tags. Since an interface cannot
+// describe fields, the delegates (InputDelegate, PauseDelegate, etc.) and the
+// ShowFPS/ShowPing/ShowPerf flags must be declared by every implementation in the same
+// way, along with the CreateWindow, CreateAudio and Run functions.
+type Frontend interface {
+	SetTitle(title string)
+	SetFrameRate(fps float64)
+	Refresh(frame []color.RGBA)
+	ShouldClose() bool
+	InFocus() bool
+	Close()
+
+	HandleHotKeys()
+	UpdateJoystick()
+	UpdateZapper()
+	BindKey(button input.Button, key int32)
+	BoundKey(button input.Button) (int32, bool)
+	BindMicrophoneKey(key int32)
+	MicrophoneKey() int32
+
+	ShowMessage(format string, args ...any)
+	SetGrayscale(grayscale bool)
+	SetPaused(paused bool)
+	SetPingInfo(pingMs int64)
+	SetFrameTimes(emulation, rollback time.Duration)
+	SetRecording(recording bool)
+	SetMuted(muted bool)
+	ChangeVolume(delta float32)
+
+	EnableShader(code string)
+	DisableShader()
+	SetOverlay(o Overlay)
+	SetBezel(b *Bezel)
+	SetScaleMode(mode ScaleMode)
+	SetScaleFilter(f ScaleFilter)
+	SetPixelAspect(enabled bool)
+
+	MenuOpen() bool
+	CloseMenu()
+	OpenSlotMenu()
+	SelectROM(dir string, recent []RecentROM) string
+}
+
+// Audio is the contract of the audio output implementations. The stream is
+// filled with mono float32 samples, one buffer at a time, which are played on
+// another goroutine, so that queueing them never blocks.
+type Audio interface {
+	IsStreamProcessed() bool
+	WaitStreamProcessed()
+	UpdateStream(buf []float32)
+	SetPaused(paused bool)
+	Stats() AudioStats
+
+	SetVolume(volume float32)
+	ChangeVolume(delta float32) float32
+	Volume() float32
+	Mute(m bool)
+	ToggleMute() bool
+	Muted() bool
+	Close()
+}
+
+var (
+	_ Frontend = (*Window)(nil)
+	_ Audio    = (*AudioOut)(nil)
+)
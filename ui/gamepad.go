@@ -0,0 +1,67 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	"log"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+
+	"github.com/maxpoletaev/dendy/input"
+)
+
+// gamepadID is the raylib gamepad used for player 1. The keyboard keeps working
+// alongside it, so nothing needs to be configured when the gamepad is unplugged.
+const gamepadID = 0
+
+// Buttons are mapped by their position, so that B and A are the left and the
+// right face buttons, as on the NES controller.
+var gamepadMap = map[int32]input.Button{
+	rl.GamepadButtonLeftFaceUp:     input.ButtonUp,
+	rl.GamepadButtonLeftFaceDown:   input.ButtonDown,
+	rl.GamepadButtonLeftFaceLeft:   input.ButtonLeft,
+	rl.GamepadButtonLeftFaceRight:  input.ButtonRight,
+	rl.GamepadButtonRightFaceRight: input.ButtonA,
+	rl.GamepadButtonRightFaceDown:  input.ButtonB,
+	rl.GamepadButtonMiddleRight:    input.ButtonStart,
+	rl.GamepadButtonMiddleLeft:     input.ButtonSelect,
+}
+
+// checkGamepad notifies about the gamepad being connected or disconnected.
+// Raylib polls the gamepads every frame, so they can be plugged in at any time.
+func (w *Window) checkGamepad() {
+	connected := rl.IsGamepadAvailable(gamepadID)
+	if connected == w.gamepadConnected {
+		return
+	}
+
+	w.gamepadConnected = connected
+
+	if connected {
+		name := rl.GetGamepadName(gamepadID)
+		log.Printf("[INFO] gamepad connected: %s", name)
+		w.ShowMessage("Gamepad connected: %s", name)
+	} else {
+		log.Printf("[INFO] gamepad disconnected")
+		w.ShowMessage("Gamepad disconnected, using keyboard")
+	}
+}
+
+// readGamepad returns the joystick buttons held on the gamepad, with the left
+// analog stick acting as the d-pad.
+func (w *Window) readGamepad() (buttons uint8) {
+	if !w.gamepadConnected || (!w.backgroundInput && !rl.IsWindowFocused()) {
+		return 0
+	}
+
+	for b, button := range gamepadMap {
+		if rl.IsGamepadButtonDown(gamepadID, b) {
+			buttons |= button
+		}
+	}
+
+	x := rl.GetGamepadAxisMovement(gamepadID, rl.GamepadAxisLeftX)
+	y := rl.GetGamepadAxisMovement(gamepadID, rl.GamepadAxisLeftY)
+
+	return buttons | stickButtons(x, y)
+}
@@ -0,0 +1,153 @@
+package ui
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+)
+
+// Names of the HUD elements, used as keys of HUDLayout.
+const (
+	HUDFPS         = "fps"
+	HUDPing        = "ping"
+	HUDFastForward = "fastforward"
+)
+
+// HUDElements lists the names of all HUD elements in the order they are
+// stacked when sharing the same corner.
+var HUDElements = []string{HUDFPS, HUDFastForward, HUDPing}
+
+type HUDPosition int
+
+const (
+	HUDTopLeft HUDPosition = iota
+	HUDTopRight
+	HUDBottomLeft
+	HUDBottomRight
+)
+
+var hudPositionNames = map[HUDPosition]string{
+	HUDTopLeft:     "top-left",
+	HUDTopRight:    "top-right",
+	HUDBottomLeft:  "bottom-left",
+	HUDBottomRight: "bottom-right",
+}
+
+func ParseHUDPosition(s string) (HUDPosition, error) {
+	for p, name := range hudPositionNames {
+		if name == s {
+			return p, nil
+		}
+	}
+
+	return HUDTopLeft, fmt.Errorf("invalid hud position: %s", s)
+}
+
+func (p HUDPosition) String() string {
+	return hudPositionNames[p]
+}
+
+// HUDElement describes where and how a HUD element is displayed.
+type HUDElement struct {
+	Position HUDPosition
+	Scale    int // text size multiplier
+	Hidden   bool
+}
+
+// HUDLayout maps the HUD element names to their settings. Elements missing
+// from the map are displayed with the default settings.
+type HUDLayout map[string]HUDElement
+
+// DefaultHUDLayout returns the layout with all elements stacked in the top-left
+// corner with the smallest text size.
+func DefaultHUDLayout() HUDLayout {
+	layout := make(HUDLayout, len(HUDElements))
+	for _, name := range HUDElements {
+		layout[name] = HUDElement{Position: HUDTopLeft, Scale: 1}
+	}
+
+	return layout
+}
+
+func (l HUDLayout) element(name string) HUDElement {
+	if e, ok := l[name]; ok {
+		return e
+	}
+
+	return HUDElement{Position: HUDTopLeft, Scale: 1}
+}
+
+const (
+	hudFontSize = 10
+	hudMarginX  = 6
+	hudMarginY  = 5
+)
+
+type hudText struct {
+	name   string
+	text   string
+	colour color.RGBA
+}
+
+type hudPlacement struct {
+	text   string
+	x, y   int32
+	size   int32
+	colour color.RGBA
+}
+
+// numberText is the text of a number drawn on every frame, such as the FPS
+// counter. It is only formatted when the number changes, so that drawing it
+// does not allocate.
+type numberText struct {
+	prefix string
+	suffix string
+	value  int
+	text   string
+}
+
+func (t *numberText) format(value int) string {
+	if t.text == "" || value != t.value {
+		t.value = value
+		t.text = t.prefix + strconv.Itoa(value) + t.suffix
+	}
+
+	return t.text
+}
+
+// placeHUD positions the HUD texts according to the layout, appending them to
+// the placements, which are reused between the frames. Texts sharing a corner
+// are stacked towards the centre of the screen. The measure function returns
+// the width of the text drawn with the given font size.
+func placeHUD(placements []hudPlacement, layout HUDLayout, texts []hudText, screenWidth, screenHeight int32, measure func(text string, size int32) int32) []hudPlacement {
+	var offsets [4]int32 // per corner
+
+	for _, t := range texts {
+		e := layout.element(t.name)
+		if e.Hidden {
+			continue
+		}
+
+		size := int32(hudFontSize * max(1, e.Scale))
+		p := hudPlacement{text: t.text, size: size, colour: t.colour}
+
+		switch e.Position {
+		case HUDTopLeft, HUDBottomLeft:
+			p.x = hudMarginX
+		default:
+			p.x = screenWidth - hudMarginX - measure(t.text, size)
+		}
+
+		switch e.Position {
+		case HUDTopLeft, HUDTopRight:
+			p.y = hudMarginY + offsets[e.Position]
+		default:
+			p.y = screenHeight - hudMarginY - size - offsets[e.Position]
+		}
+
+		offsets[e.Position] += size
+		placements = append(placements, p)
+	}
+
+	return placements
+}
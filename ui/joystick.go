@@ -1,3 +1,5 @@
+//go:build !sdl && !ebiten
+
 package ui
 
 import (
@@ -6,7 +8,7 @@ import (
 	"github.com/maxpoletaev/dendy/input"
 )
 
-var keyMap = map[int32]input.Button{
+var defaultKeyMap = map[int32]input.Button{
 	rl.KeyW:          input.ButtonUp,
 	rl.KeyS:          input.ButtonDown,
 	rl.KeyA:          input.ButtonLeft,
@@ -17,18 +19,75 @@ var keyMap = map[int32]input.Button{
 	rl.KeyRightShift: input.ButtonSelect,
 }
 
+// defaultMicKey is held to speak into the microphone, "V" for "voice".
+const defaultMicKey = rl.KeyV
+
 func (w *Window) UpdateJoystick() {
 	if w.InputDelegate == nil {
 		return
 	}
 
-	var buttons uint8
+	var (
+		buttons uint8
+		mic     bool
+	)
+
+	w.checkGamepad()
 
-	for key, button := range keyMap {
-		if rl.IsKeyDown(key) {
-			buttons |= button
+	// The keyboard is used for navigation while a menu is open. The memory
+	// viewer, the cheat search and the RAM watch editor leave the game running,
+	// so it can still be played with the gamepad meanwhile.
+	if !w.MenuOpen() {
+		if w.memView == nil && w.cheatView == nil && w.watchView == nil {
+			for key, button := range w.keyMap {
+				if rl.IsKeyDown(key) {
+					buttons |= button
+				}
+			}
+
+			mic = rl.IsKeyDown(w.micKey)
 		}
+
+		buttons |= w.readGamepad()
 	}
 
 	w.InputDelegate(buttons)
+
+	if w.MicrophoneDelegate != nil {
+		w.MicrophoneDelegate(mic)
+	}
+}
+
+// BindKey assigns the keyboard key to the joystick button, replacing the key
+// that was previously assigned to it.
+func (w *Window) BindKey(button input.Button, key int32) {
+	for k, b := range w.keyMap {
+		if b == button || k == key {
+			delete(w.keyMap, k)
+		}
+	}
+
+	w.keyMap[key] = button
+}
+
+// BoundKey returns the keyboard key assigned to the joystick button.
+func (w *Window) BoundKey(button input.Button) (int32, bool) {
+	for k, b := range w.keyMap {
+		if b == button {
+			return k, true
+		}
+	}
+
+	return 0, false
+}
+
+// BindMicrophoneKey assigns the keyboard key held to speak into the microphone
+// of the second controller.
+func (w *Window) BindMicrophoneKey(key int32) {
+	w.micKey = key
+}
+
+// MicrophoneKey returns the keyboard key assigned to the microphone.
+func (w *Window) MicrophoneKey() int32 {
+	return w.micKey
 }
@@ -0,0 +1,80 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var specialKeyNames = map[int32]string{
+	rl.KeySpace:        "Space",
+	rl.KeyEnter:        "Enter",
+	rl.KeyTab:          "Tab",
+	rl.KeyBackspace:    "Backspace",
+	rl.KeyInsert:       "Insert",
+	rl.KeyDelete:       "Delete",
+	rl.KeyRight:        "Right",
+	rl.KeyLeft:         "Left",
+	rl.KeyDown:         "Down",
+	rl.KeyUp:           "Up",
+	rl.KeyPageUp:       "PageUp",
+	rl.KeyPageDown:     "PageDown",
+	rl.KeyHome:         "Home",
+	rl.KeyEnd:          "End",
+	rl.KeyLeftShift:    "LeftShift",
+	rl.KeyRightShift:   "RightShift",
+	rl.KeyLeftControl:  "LeftControl",
+	rl.KeyRightControl: "RightControl",
+	rl.KeyLeftAlt:      "LeftAlt",
+	rl.KeyRightAlt:     "RightAlt",
+	rl.KeyKpEnter:      "KpEnter",
+}
+
+// KeyName returns a human-readable name of a keyboard key, which is also used
+// to store key bindings in the config file.
+func KeyName(key int32) string {
+	if name, ok := specialKeyNames[key]; ok {
+		return name
+	}
+
+	switch {
+	case key > rl.KeySpace && key <= rl.KeyGrave:
+		return string(rune(key))
+	case key >= rl.KeyF1 && key <= rl.KeyF12:
+		return "F" + strconv.Itoa(int(key-rl.KeyF1+1))
+	case key >= rl.KeyKp0 && key <= rl.KeyKp9:
+		return "Kp" + strconv.Itoa(int(key-rl.KeyKp0))
+	default:
+		return "Key" + strconv.Itoa(int(key))
+	}
+}
+
+// ParseKey converts a key name returned by KeyName back to the key code.
+func ParseKey(name string) (int32, error) {
+	for key, n := range specialKeyNames {
+		if strings.EqualFold(n, name) {
+			return key, nil
+		}
+	}
+
+	if len(name) == 1 {
+		key := int32(strings.ToUpper(name)[0])
+		if key > rl.KeySpace && key <= rl.KeyGrave {
+			return key, nil
+		}
+	}
+
+	for prefix, base := range map[string]int32{"Key": 0, "Kp": rl.KeyKp0, "F": rl.KeyF1 - 1} {
+		if n, ok := strings.CutPrefix(name, prefix); ok {
+			if v, err := strconv.Atoi(n); err == nil {
+				return base + int32(v), nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("unknown key: %s", name)
+}
@@ -0,0 +1,287 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	"fmt"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+
+	"github.com/maxpoletaev/dendy/ppu"
+)
+
+const (
+	memViewColumns   = 16
+	memViewPadding   = 10
+	memViewTextSize  = 10
+	memViewLineSize  = 12
+	memViewHighlight = 60 // frames a changed byte stays highlighted for
+)
+
+var memViewBackground = rl.NewColor(0, 0, 0, 220)
+
+// memViewer is the hex dump of the memory, drawn either over the game, which
+// keeps running underneath, or docked as the panel beside it, in which case the
+// game is scaled down to the rest of the window. The bytes that changed recently
+// are highlighted, which is tracked by comparing the visible rows with their
+// values in the previous frame, so only the changes made while the rows are on
+// screen are seen.
+type memViewer struct {
+	space  int // index in Window.MemorySpaces
+	offset int // address of the first visible row
+	cursor int // address of the selected byte
+	rows   int // visible rows, as of the last draw
+	docked bool
+
+	// Editing the selected byte, the high nibble is typed first.
+	editing   bool
+	editValue uint8
+
+	prev    []uint8 // visible bytes as of the last frame
+	changed []int   // frames since each of the visible bytes has changed
+}
+
+// openMemView opens the viewer, docked the same way as the last time. There is
+// room for one docked panel only, so the PPU viewer is closed to dock it.
+func (w *Window) openMemView() {
+	if len(w.MemorySpaces) == 0 {
+		return
+	}
+
+	if w.memViewDocked {
+		w.closePPUView()
+	}
+
+	w.memView = &memViewer{docked: w.memViewDocked}
+}
+
+// memViewDock returns the width of the docked viewer, or 0 if it is not docked.
+// In the window too narrow to fit the frame beside it, it is drawn over the game
+// as usual. The default font is not monospaced, so every byte is drawn in its
+// own column, as wide as the widest pair of digits.
+func (w *Window) memViewDock() int32 {
+	if w.memView == nil || !w.memView.docked {
+		return 0
+	}
+
+	dock := memViewPadding*2 + memViewAddrSize() + memViewColumns*memViewCellSize()
+	if int32(rl.GetScreenWidth()) < dock+ppu.FrameWidth {
+		return 0
+	}
+
+	return dock
+}
+
+func memViewCellSize() int32 {
+	return rl.MeasureText("DD", memViewTextSize) + 6
+}
+
+func memViewAddrSize() int32 {
+	return rl.MeasureText("DDDD", memViewTextSize) + 12
+}
+
+func (w *Window) closeMemView() {
+	w.memView = nil
+}
+
+// resetTracking forgets the previous values after scrolling, so that the rows
+// that come into view are not highlighted all at once.
+func (m *memViewer) resetTracking() {
+	m.prev = nil
+	m.changed = nil
+}
+
+// moveCursor moves the selected byte and scrolls the view to keep it visible.
+func (m *memViewer) moveCursor(delta, size int) {
+	m.cursor = min(max(m.cursor+delta, 0), size-1)
+	m.editing = false
+
+	rows := max(m.rows, 1)
+	offset := m.offset
+
+	if m.cursor < offset {
+		offset = m.cursor / memViewColumns * memViewColumns
+	} else if m.cursor >= offset+rows*memViewColumns {
+		offset = (m.cursor/memViewColumns - rows + 1) * memViewColumns
+	}
+
+	if offset != m.offset {
+		m.offset = offset
+		m.resetTracking()
+	}
+}
+
+func hexDigit(c int32) (uint8, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return uint8(c - '0'), true
+	case c >= 'a' && c <= 'f':
+		return uint8(c - 'a' + 10), true
+	case c >= 'A' && c <= 'F':
+		return uint8(c - 'A' + 10), true
+	default:
+		return 0, false
+	}
+}
+
+// handleMemViewKeys processes the navigation and the editing. Like the menus,
+// the viewer takes over the keyboard while it is open.
+func (w *Window) handleMemViewKeys() {
+	var (
+		m     = w.memView
+		space = w.MemorySpaces[m.space]
+		page  = max(m.rows, 1) * memViewColumns
+	)
+
+	switch {
+	case rl.IsKeyPressed(rl.KeyF7) && w.isShiftPressed():
+		m.docked = !m.docked
+		w.memViewDocked = m.docked
+
+		if m.docked {
+			w.closePPUView()
+		}
+
+	case rl.IsKeyPressed(rl.KeyF7), rl.IsKeyPressed(rl.KeyEscape):
+		w.closeMemView()
+		return
+
+	case rl.IsKeyPressed(rl.KeyTab):
+		m.space = (m.space + 1) % len(w.MemorySpaces)
+		m.offset, m.cursor, m.editing = 0, 0, false
+		m.resetTracking()
+
+	case rl.IsKeyPressed(rl.KeyRight):
+		m.moveCursor(1, space.Size)
+	case rl.IsKeyPressed(rl.KeyLeft):
+		m.moveCursor(-1, space.Size)
+	case rl.IsKeyPressed(rl.KeyDown):
+		m.moveCursor(memViewColumns, space.Size)
+	case rl.IsKeyPressed(rl.KeyUp):
+		m.moveCursor(-memViewColumns, space.Size)
+	case rl.IsKeyPressed(rl.KeyPageDown):
+		m.moveCursor(page, space.Size)
+	case rl.IsKeyPressed(rl.KeyPageUp):
+		m.moveCursor(-page, space.Size)
+	case rl.IsKeyPressed(rl.KeyHome):
+		m.moveCursor(-space.Size, space.Size)
+	case rl.IsKeyPressed(rl.KeyEnd):
+		m.moveCursor(space.Size, space.Size)
+	}
+
+	for c := rl.GetCharPressed(); c != 0; c = rl.GetCharPressed() {
+		digit, ok := hexDigit(c)
+		if !ok || space.Write == nil {
+			continue
+		}
+
+		if !m.editing {
+			m.editing = true
+			m.editValue = digit << 4
+			continue
+		}
+
+		space.Write(m.cursor, m.editValue|digit)
+		m.moveCursor(1, space.Size)
+	}
+}
+
+func (w *Window) drawMemView() {
+	var (
+		m            = w.memView
+		space        = w.MemorySpaces[m.space]
+		screenWidth  = int32(rl.GetScreenWidth())
+		screenHeight = int32(rl.GetScreenHeight())
+		left         = int32(memViewPadding)
+	)
+
+	if dock := w.memViewDock(); dock > 0 {
+		left += screenWidth - dock
+		rl.DrawRectangle(screenWidth-dock, 0, dock, screenHeight, rl.Black)
+	} else {
+		rl.DrawRectangle(0, 0, screenWidth, screenHeight, memViewBackground)
+	}
+
+	title := fmt.Sprintf("%s memory   $%04X", space.Name, m.cursor)
+	w.drawTextWithShadow(title, left, memViewPadding, 20, rl.White)
+
+	var (
+		top      = int32(memViewPadding*2 + 20)
+		cellSize = memViewCellSize()
+		addrSize = memViewAddrSize()
+		rows     = int((screenHeight - top - memViewTextSize*2 - memViewPadding*3) / memViewLineSize)
+	)
+
+	rows = min(max(rows, 1), (space.Size+memViewColumns-1)/memViewColumns)
+
+	if rows != m.rows {
+		m.rows = rows
+		m.moveCursor(0, space.Size)
+		m.resetTracking()
+	}
+
+	visible := min(rows*memViewColumns, space.Size-m.offset)
+	if len(m.prev) != visible {
+		m.prev = make([]uint8, visible)
+		m.changed = make([]int, visible)
+
+		for i := range m.prev {
+			m.prev[i] = space.Read(m.offset + i)
+			m.changed[i] = memViewHighlight
+		}
+	}
+
+	for i := 0; i < visible; i++ {
+		var (
+			addr  = m.offset + i
+			value = space.Read(addr)
+			x     = left + addrSize + int32(i%memViewColumns)*cellSize
+			y     = top + int32(i/memViewColumns)*memViewLineSize
+		)
+
+		if i%memViewColumns == 0 {
+			w.drawTextWithShadow(fmt.Sprintf("%04X", addr), left, y, memViewTextSize, rl.Gray)
+		}
+
+		if value != m.prev[i] {
+			m.prev[i] = value
+			m.changed[i] = 0
+		} else if m.changed[i] < memViewHighlight {
+			m.changed[i]++
+		}
+
+		// The changed bytes fade from red back to white.
+		colour := rl.LightGray
+		if age := m.changed[i]; age < memViewHighlight {
+			fade := uint8(age * 255 / memViewHighlight)
+			colour = rl.NewColor(255, fade, fade, 255)
+		}
+
+		text := fmt.Sprintf("%02X", value)
+
+		if addr == m.cursor {
+			rl.DrawRectangle(x-3, y-1, cellSize, memViewLineSize, rl.DarkBlue)
+
+			if m.editing {
+				text = fmt.Sprintf("%X_", m.editValue>>4)
+				colour = rl.Yellow
+			}
+		}
+
+		w.drawTextWithShadow(text, x, y, memViewTextSize, colour)
+	}
+
+	// The hints are on two lines to fit the docked panel.
+	hint := "Arrows/PgUp/PgDn: move   0-F: edit   Tab: memory"
+	if space.Write == nil {
+		hint = "Arrows/PgUp/PgDn: move   Tab: memory"
+	}
+
+	dockHint := "Shift+F7: dock   F7: close"
+	if m.docked {
+		dockHint = "Shift+F7: undock   F7: close"
+	}
+
+	w.drawTextWithShadow(hint, left, screenHeight-memViewTextSize*2-memViewPadding*2, memViewTextSize, rl.LightGray)
+	w.drawTextWithShadow(dockHint, left, screenHeight-memViewTextSize-memViewPadding, memViewTextSize, rl.LightGray)
+}
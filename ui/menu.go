@@ -0,0 +1,134 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import rl "github.com/gen2brain/raylib-go/raylib"
+
+const (
+	menuFontSize   = 10
+	menuLineHeight = 16
+	menuPadding    = 10
+	menuValueX     = 140
+)
+
+type settingsMenu struct {
+	items    []MenuItem
+	selected int
+	binding  bool
+}
+
+// MenuOpen returns true if either the settings or the save slot menu is open.
+// The emulation is usually paused while the menu is displayed.
+func (w *Window) MenuOpen() bool {
+	return w.menu != nil || w.slotMenu != nil
+}
+
+func (w *Window) openMenu() {
+	if w.MenuDelegate == nil {
+		return
+	}
+
+	if items := w.MenuDelegate(); len(items) > 0 {
+		w.menu = &settingsMenu{items: items}
+	}
+}
+
+// CloseMenu closes the settings menu. Intended to be used as a menu item action.
+func (w *Window) CloseMenu() {
+	w.menu = nil
+}
+
+// OpenSlotMenu closes the settings menu and displays the save slot menu.
+// Intended to be used as a menu item action.
+func (w *Window) OpenSlotMenu() {
+	w.CloseMenu()
+	w.openSlotMenu()
+}
+
+func (w *Window) handleMenuKeys() {
+	menu := w.menu
+	item := menu.items[menu.selected]
+
+	// Waiting for a key to bind, Escape cancels the binding.
+	if menu.binding {
+		if key := rl.GetKeyPressed(); key != 0 {
+			if key != rl.KeyEscape {
+				item.BindKey(key)
+			}
+
+			menu.binding = false
+		}
+
+		return
+	}
+
+	switch {
+	case rl.IsKeyPressed(rl.KeyEscape):
+		w.CloseMenu()
+
+	case rl.IsKeyPressed(rl.KeyDown), rl.IsKeyPressedRepeat(rl.KeyDown):
+		menu.selected = (menu.selected + 1) % len(menu.items)
+
+	case rl.IsKeyPressed(rl.KeyUp), rl.IsKeyPressedRepeat(rl.KeyUp):
+		menu.selected = (menu.selected + len(menu.items) - 1) % len(menu.items)
+
+	case rl.IsKeyPressed(rl.KeyRight), rl.IsKeyPressedRepeat(rl.KeyRight):
+		if item.Change != nil {
+			item.Change(1)
+		}
+
+	case rl.IsKeyPressed(rl.KeyLeft), rl.IsKeyPressedRepeat(rl.KeyLeft):
+		if item.Change != nil {
+			item.Change(-1)
+		}
+
+	case rl.IsKeyPressed(rl.KeyEnter):
+		switch {
+		case item.BindKey != nil:
+			menu.binding = true
+		case item.Action != nil:
+			item.Action()
+		case item.Change != nil:
+			item.Change(1)
+		}
+	}
+}
+
+func (w *Window) drawMenu() {
+	var (
+		menu         = w.menu
+		screenWidth  = int32(rl.GetScreenWidth())
+		screenHeight = int32(rl.GetScreenHeight())
+	)
+
+	rl.DrawRectangle(0, 0, screenWidth, screenHeight, slotMenuBackground)
+	w.drawTextWithShadow("Settings", menuPadding, menuPadding, 20, rl.White)
+
+	y := int32(menuPadding*2 + 20)
+
+	for i, item := range menu.items {
+		colour := rl.LightGray
+		if i == menu.selected {
+			colour = rl.Yellow
+		}
+
+		w.drawTextWithShadow(item.Label, menuPadding, y, menuFontSize, colour)
+
+		value := ""
+		if item.Value != nil {
+			value = item.Value()
+		}
+
+		if i == menu.selected && menu.binding {
+			value = "press a key..."
+		} else if item.Change != nil {
+			value = "< " + value + " >"
+		}
+
+		w.drawTextWithShadow(value, menuValueX, y, menuFontSize, colour)
+		y += menuLineHeight
+	}
+
+	hint := "Up/Down: select   Left/Right: change   Enter: confirm   Esc: close"
+	w.drawTextWithShadow(hint, menuPadding, screenHeight-menuFontSize-menuPadding, menuFontSize, rl.Gray)
+}
@@ -0,0 +1,607 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/ppu"
+)
+
+// This file contains the types and helpers shared by all window implementations.
+
+// VolumeStep is the volume change per key press.
+const VolumeStep = 0.1
+
+func toGrayscale(c color.RGBA) color.RGBA {
+	gray := uint8(float64(c.R)*0.3 + float64(c.G)*0.59 + float64(c.B)*0.11)
+	return color.RGBA{R: gray, G: gray, B: gray, A: c.A}
+}
+
+// ScaleMode determines how the frame is fitted into the window.
+type ScaleMode uint8
+
+const (
+	// ScaleModeFit scales the frame to fill the window as much as possible while
+	// keeping its aspect ratio. The scale factor may be fractional.
+	ScaleModeFit ScaleMode = iota
+	// ScaleModeInteger only uses whole-number scale factors, so that every NES
+	// pixel is rendered with the same number of screen pixels.
+	ScaleModeInteger
+	// ScaleModeStretch stretches the frame to the whole window, ignoring the
+	// aspect ratio.
+	ScaleModeStretch
+)
+
+// ParseScaleMode converts a scale mode name (fit, integer, stretch) to ScaleMode.
+func ParseScaleMode(s string) (ScaleMode, error) {
+	switch s {
+	case "fit":
+		return ScaleModeFit, nil
+	case "integer":
+		return ScaleModeInteger, nil
+	case "stretch":
+		return ScaleModeStretch, nil
+	default:
+		return 0, fmt.Errorf("unknown scale mode: %s", s)
+	}
+}
+
+func (m ScaleMode) String() string {
+	switch m {
+	case ScaleModeFit:
+		return "fit"
+	case ScaleModeInteger:
+		return "integer"
+	case ScaleModeStretch:
+		return "stretch"
+	default:
+		return "unknown"
+	}
+}
+
+// ScaleFilter determines how the frame pixels are interpolated when scaled.
+type ScaleFilter uint8
+
+const (
+	// ScaleFilterNearest keeps the pixels sharp, but with a fractional scale
+	// factor some of them are one screen pixel wider than the others, which
+	// shimmers when the picture scrolls.
+	ScaleFilterNearest ScaleFilter = iota
+	// ScaleFilterSharpBilinear prescales the frame by the whole part of the
+	// scale factor with the nearest filter and does the rest with the bilinear
+	// one, so that only the pixel edges are blended.
+	ScaleFilterSharpBilinear
+)
+
+// ParseScaleFilter converts a filter name (nearest, sharp-bilinear) to ScaleFilter.
+func ParseScaleFilter(s string) (ScaleFilter, error) {
+	switch s {
+	case "nearest":
+		return ScaleFilterNearest, nil
+	case "sharp-bilinear":
+		return ScaleFilterSharpBilinear, nil
+	default:
+		return 0, fmt.Errorf("unknown scale filter: %s", s)
+	}
+}
+
+func (f ScaleFilter) String() string {
+	switch f {
+	case ScaleFilterNearest:
+		return "nearest"
+	case ScaleFilterSharpBilinear:
+		return "sharp-bilinear"
+	default:
+		return "unknown"
+	}
+}
+
+// pixelAspect87 is the width-to-height ratio of a single NES pixel on a CRT TV.
+const pixelAspect87 = 8.0 / 7.0
+
+// viewport is the area of the window the frame is drawn to.
+type viewport struct {
+	x, y          float32
+	width, height float32
+}
+
+// fitViewport calculates the viewport for the given window size. Depending on
+// the scale mode, the frame is either stretched to the whole window or centered
+// with black bars around it.
+func fitViewport(screenWidth, screenHeight float32, mode ScaleMode, pixelAspect bool) viewport {
+	var (
+		frameWidth  = float32(ppu.FrameWidth)
+		frameHeight = float32(ppu.FrameHeight)
+	)
+
+	if mode == ScaleModeStretch {
+		return viewport{
+			width:  screenWidth,
+			height: screenHeight,
+		}
+	}
+
+	if pixelAspect {
+		frameWidth *= pixelAspect87
+	}
+
+	scale := min(screenWidth/frameWidth, screenHeight/frameHeight)
+
+	// The window may be smaller than the frame, in which case we have no other
+	// choice but to downscale it.
+	if mode == ScaleModeInteger && scale >= 1 {
+		scale = float32(math.Floor(float64(scale)))
+	}
+
+	width := frameWidth * scale
+	height := frameHeight * scale
+
+	return viewport{
+		x:      float32(math.Floor(float64(screenWidth-width) / 2)),
+		y:      float32(math.Floor(float64(screenHeight-height) / 2)),
+		width:  width,
+		height: height,
+	}
+}
+
+// scaled multiplies the viewport coordinates by the factor. Used to convert the
+// viewport between the physical pixels and the window coordinates, which do not
+// match on high-DPI screens.
+func (v viewport) scaled(f float32) viewport {
+	return viewport{
+		x:      v.x * f,
+		y:      v.y * f,
+		width:  v.width * f,
+		height: v.height * f,
+	}
+}
+
+// prescaleFactor returns the integer factor the frame is enlarged by before the
+// bilinear scaling, given the viewport size in physical pixels. Prescaling to
+// the viewport size or beyond would make the filter no different from nearest.
+func (v viewport) prescaleFactor() int32 {
+	return max(1, int32(v.height/ppu.FrameHeight))
+}
+
+// frameCoords converts window coordinates to the frame pixel coordinates.
+// Returns false if the point is outside the viewport.
+func (v viewport) frameCoords(px, py float32) (int, int, bool) {
+	if px < v.x || py < v.y {
+		return 0, 0, false
+	}
+
+	x := int((px - v.x) * ppu.FrameWidth / v.width)
+	if x >= ppu.FrameWidth {
+		return 0, 0, false
+	}
+
+	y := int((py - v.y) * ppu.FrameHeight / v.height)
+	if y >= ppu.FrameHeight {
+		return 0, 0, false
+	}
+
+	return x, y, true
+}
+
+// WindowOptions configures the window at creation time.
+type WindowOptions struct {
+	Scale       int       // initial window size multiplier
+	ScaleMode   ScaleMode // how the frame is fitted into the window
+	PixelAspect bool      // correct the 8:7 pixel aspect ratio
+	Fullscreen  bool      // start in fullscreen mode
+	Overlay     Overlay   // initial overlay filter
+	VSync       bool      // synchronize buffer swaps with the monitor refresh
+	Verbose     bool      // enable raylib logging
+	HUD         HUDLayout // position, size and visibility of the HUD elements
+
+	// BackgroundInput keeps reading the gamepad while the window is not focused,
+	// e.g. when streaming software is. The keyboard is only available in focus.
+	BackgroundInput bool
+
+	// Filter is how the frame pixels are interpolated when the frame is scaled.
+	Filter ScaleFilter
+
+	ScreenshotDir    string // directory where screenshots are saved
+	ScreenshotPrefix string // file name prefix for screenshots, usually the ROM name
+	CopyScreenshots  bool   // copy the unscaled screenshots to the clipboard
+}
+
+// Overlay is a cheap CRT-like filter drawn on top of the frame. Unlike shaders,
+// it is just a semi-transparent texture repeated over the viewport, so it works
+// everywhere and costs almost nothing.
+type Overlay uint8
+
+const (
+	OverlayNone Overlay = iota
+	OverlayScanlines
+	OverlayGrille
+	overlayCount
+)
+
+// ParseOverlay converts an overlay name (none, scanlines, grille) to Overlay.
+func ParseOverlay(s string) (Overlay, error) {
+	switch s {
+	case "none":
+		return OverlayNone, nil
+	case "scanlines":
+		return OverlayScanlines, nil
+	case "grille":
+		return OverlayGrille, nil
+	default:
+		return 0, fmt.Errorf("unknown overlay: %s", s)
+	}
+}
+
+func (o Overlay) String() string {
+	switch o {
+	case OverlayNone:
+		return "none"
+	case OverlayScanlines:
+		return "scanlines"
+	case OverlayGrille:
+		return "grille"
+	default:
+		return "unknown"
+	}
+}
+
+// SaveSlot describes a save state slot displayed in the slot menu.
+type SaveSlot struct {
+	Empty     bool
+	Time      time.Time
+	Thumbnail image.Image // may be nil if the slot has no screenshot
+}
+
+// MemorySpace is an address space shown in the memory viewer. The functions
+// are called from the main loop, between the frames.
+type MemorySpace struct {
+	Name  string
+	Size  int
+	Read  func(addr int) uint8
+	Write func(addr int, data uint8) // nil if read-only
+}
+
+// MenuItem is a single line of the settings menu. Depending on which of the
+// callbacks are set, the item either has a value that is changed with the
+// left/right keys, performs an action on Enter, or waits for a key press to
+// assign a new key binding.
+type MenuItem struct {
+	Label   string
+	Value   func() string   // current value displayed next to the label
+	Change  func(delta int) // called with -1 or 1 when left/right is pressed
+	Action  func()          // called when Enter is pressed
+	BindKey func(key int32) // called with the next key pressed after Enter
+}
+
+// ButtonNames lists the joystick buttons in the order they are displayed in
+// the settings menu, along with the names used in the config file.
+var ButtonNames = []struct {
+	Button input.Button
+	Name   string
+}{
+	{input.ButtonUp, "up"},
+	{input.ButtonDown, "down"},
+	{input.ButtonLeft, "left"},
+	{input.ButtonRight, "right"},
+	{input.ButtonA, "a"},
+	{input.ButtonB, "b"},
+	{input.ButtonSelect, "select"},
+	{input.ButtonStart, "start"},
+}
+
+const maxScreenshotsPerDay = 999
+
+// screenshotPath returns the first unused file name in the form of
+// <prefix>_<date>_<number>.png, so that the previous screenshots taken
+// on the same day are never overwritten.
+func screenshotPath(dir, prefix string, now time.Time) (string, error) {
+	prefix = strings.ReplaceAll(prefix, " ", "_")
+	date := now.Format("2006-01-02")
+
+	for n := 1; n <= maxScreenshotsPerDay; n++ {
+		name := fmt.Sprintf("%s_%s_%03d.png", prefix, date, n)
+		path := filepath.Join(dir, name)
+
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("too many screenshots taken on %s", date)
+}
+
+// RecentROM is a recently played game, listed on top of the ROM browser.
+type RecentROM struct {
+	Path   string
+	Detail string // shown after the file name, e.g. the play time
+}
+
+type browserEntry struct {
+	label string
+	path  string
+	dir   bool
+}
+
+// listROMs returns the subdirectories and the .nes and .fds files of the given
+// directory, directories first, both sorted by name. Hidden files are skipped.
+func listROMs(dir string) ([]browserEntry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs, roms []browserEntry
+
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+
+		switch {
+		case f.IsDir():
+			dirs = append(dirs, browserEntry{label: name + "/", path: path, dir: true})
+		case strings.EqualFold(filepath.Ext(name), ".nes"), strings.EqualFold(filepath.Ext(name), ".fds"):
+			roms = append(roms, browserEntry{label: name, path: path})
+		}
+	}
+
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].label < dirs[j].label })
+	sort.Slice(roms, func(i, j int) bool { return roms[i].label < roms[j].label })
+
+	return append(dirs, roms...), nil
+}
+
+// fpsCounter measures the number of frames displayed per second, for the
+// frontends that have no built-in counter.
+type fpsCounter struct {
+	frames int
+	since  time.Time
+	fps    int
+}
+
+func (c *fpsCounter) tick(now time.Time) {
+	c.frames++
+
+	if elapsed := now.Sub(c.since); elapsed >= time.Second {
+		c.fps = int(float64(c.frames) / elapsed.Seconds())
+		c.frames = 0
+		c.since = now
+	}
+}
+
+// stickDeadZone is how far the analog stick must be tilted to count as a d-pad
+// press, so that a worn stick does not move the character on its own.
+const stickDeadZone = 0.5
+
+// stickButtons converts the analog stick position into the d-pad buttons. Both
+// axes range from -1 to 1, with the positive values pointing right and down.
+func stickButtons(x, y float32) (buttons uint8) {
+	switch {
+	case x <= -stickDeadZone:
+		buttons |= input.ButtonLeft
+	case x >= stickDeadZone:
+		buttons |= input.ButtonRight
+	}
+
+	switch {
+	case y <= -stickDeadZone:
+		buttons |= input.ButtonUp
+	case y >= stickDeadZone:
+		buttons |= input.ButtonDown
+	}
+
+	return buttons
+}
+
+// framePacerMaxLag is the number of frames the pacer may fall behind before it
+// gives up on catching up and restarts the schedule.
+const framePacerMaxLag = 3
+
+// framePacer spaces the frames at a fractional frame rate, such as 60.0988Hz of
+// the NTSC console. The deadline of every frame is counted from the start of the
+// schedule rather than from the previous frame, so the oversleeping and rounding
+// errors are corrected on the next frame instead of accumulating into a drift.
+type framePacer struct {
+	fps    float64
+	start  time.Time
+	frames int64
+
+	// Set by syncRefresh when the buffer swaps wait for the monitor refresh.
+	refreshesPerFrame float64
+	refreshPeriod     time.Duration
+	refreshPhase      float64
+	swappedAt         time.Time
+}
+
+// setRate changes the frame rate and restarts the schedule. Zero disables the
+// pacing.
+func (p *framePacer) setRate(fps float64) {
+	p.fps = max(0, fps)
+	p.start = time.Time{}
+	p.refreshesPerFrame = 0
+}
+
+// setFrameRate sets the frame rate of the pacer. With vsync, swapping the
+// buffers already blocks until the next refresh, and limiting the frame rate on
+// top of that would make the window miss some of the refreshes, so the frames
+// are counted in the refreshes of the monitor instead. Returns whether they are.
+func (p *framePacer) setFrameRate(fps float64, vsync bool, refreshRate func() (float64, error)) bool {
+	p.setRate(fps)
+
+	if !vsync {
+		return false
+	}
+
+	rate, err := refreshRate()
+	if err != nil {
+		log.Printf("[ERROR] %s", err)
+		return false
+	}
+
+	if !p.syncRefresh(rate) {
+		return false
+	}
+
+	log.Printf("[INFO] frame timing is synchronized with the %.0fHz refresh rate", rate)
+
+	return true
+}
+
+// refreshTolerance is how far the refresh rate may be from a multiple of the
+// frame rate to be treated as one. Monitors often report the rate rounded to a
+// whole number, such as 59Hz for 59.94Hz.
+const refreshTolerance = 0.03
+
+// syncRefresh makes the pacer count the monitor refreshes instead of time, for
+// when the buffer swaps are synchronized with the monitor. Every frame is then
+// shown for a whole number of refreshes: exactly one, two or four at 60, 120
+// and 240Hz, and alternately two or three at 144Hz, which is as even as it gets.
+// A fixed frame rate would beat against the refresh rate instead, showing random
+// frames for longer. Returns false if the monitor is slower than the emulator,
+// in which case the frame rate set with setRate is kept.
+func (p *framePacer) syncRefresh(refreshRate float64) bool {
+	p.refreshesPerFrame = 0
+
+	if p.fps == 0 || refreshRate <= 0 {
+		return false
+	}
+
+	ratio := refreshRate / p.fps
+	if n := math.Round(ratio); math.Abs(ratio-n) <= n*refreshTolerance {
+		ratio = n
+	}
+
+	if ratio < 1 {
+		return false
+	}
+
+	p.refreshesPerFrame = ratio
+	p.refreshPeriod = time.Duration(float64(time.Second) / refreshRate)
+	p.refreshPhase = 0
+	p.swappedAt = time.Time{}
+
+	return true
+}
+
+// swapped records the time of the buffer swap. With vsync it returns right after
+// a refresh, so the swaps are used to follow the monitor clock.
+func (p *framePacer) swapped() {
+	if p.refreshesPerFrame > 0 {
+		p.swappedAt = time.Now()
+	}
+}
+
+// wait sleeps until the next frame is due and returns the current time. When
+// the frames come too late, e.g. after the game was paused or the window was
+// dragged, the schedule is restarted rather than rushing through the backlog.
+func (p *framePacer) wait() time.Time {
+	now := time.Now()
+
+	if p.fps == 0 {
+		return now
+	}
+
+	if p.refreshesPerFrame > 0 {
+		return p.waitRefresh(now)
+	}
+
+	if p.start.IsZero() {
+		p.start, p.frames = now, 0
+		return now
+	}
+
+	p.frames++
+	period := float64(time.Second) / p.fps
+	deadline := p.start.Add(time.Duration(float64(p.frames) * period))
+
+	if delay := deadline.Sub(now); delay > 0 {
+		time.Sleep(delay)
+		return time.Now()
+	} else if float64(-delay) > framePacerMaxLag*period {
+		p.start, p.frames = now, 0
+	}
+
+	return now
+}
+
+// waitRefresh sleeps until half a refresh before the one the next frame is due
+// at, so that the buffer swap blocks until exactly that refresh. The deadline is
+// counted from the previous swap, as the monitor clock drifts away from ours.
+func (p *framePacer) waitRefresh(now time.Time) time.Time {
+	p.refreshPhase += p.refreshesPerFrame
+	refreshes := int(p.refreshPhase)
+	p.refreshPhase -= float64(refreshes)
+
+	// Waiting for a single refresh is what the buffer swap does anyway.
+	if refreshes < 2 || p.swappedAt.IsZero() {
+		return now
+	}
+
+	deadline := p.swappedAt.Add(time.Duration(refreshes)*p.refreshPeriod - p.refreshPeriod/2)
+	if delay := deadline.Sub(now); delay > 0 {
+		time.Sleep(delay)
+		return time.Now()
+	}
+
+	return now
+}
+
+// saveFrameScreenshot saves the frame in its original resolution, without the
+// overlay and the HUD, into the screenshot directory. Returns the file path.
+func saveFrameScreenshot(dir, prefix string, frame []color.RGBA) (string, error) {
+	if len(frame) == 0 {
+		return "", errors.New("no frame to save")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create screenshot directory: %w", err)
+	}
+
+	path, err := screenshotPath(dir, prefix, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	if err := saveFramePNG(path, frame); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// saveFramePNG writes the frame in its original resolution into a PNG file.
+// Used for screenshots by the frontends that cannot read back the window.
+func saveFramePNG(path string, frame []color.RGBA) error {
+	img := image.NewRGBA(image.Rect(0, 0, ppu.FrameWidth, ppu.FrameHeight))
+	for i, c := range frame {
+		img.SetRGBA(i%ppu.FrameWidth, i/ppu.FrameWidth, c)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(f, img); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
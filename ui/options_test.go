@@ -0,0 +1,45 @@
+package ui
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/maxpoletaev/dendy/internal/testutil"
+)
+
+func TestFramePacer_SetFrameRate(t *testing.T) {
+	tests := map[string]struct {
+		vsync    bool
+		refresh  float64
+		err      error
+		synced   bool
+		perFrame float64
+	}{
+		"no vsync":       {refresh: 120},
+		"60Hz":           {vsync: true, refresh: 60, synced: true, perFrame: 1},
+		"rounded 59Hz":   {vsync: true, refresh: 59, synced: true, perFrame: 1},
+		"120Hz":          {vsync: true, refresh: 120, synced: true, perFrame: 2},
+		"144Hz":          {vsync: true, refresh: 144, synced: true, perFrame: 144 / 60.0},
+		"slower monitor": {vsync: true, refresh: 50},
+		"no refresh":     {vsync: true, err: errors.New("no display")},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				p      framePacer
+				called bool
+			)
+
+			synced := p.setFrameRate(60, tt.vsync, func() (float64, error) {
+				called = true
+				return tt.refresh, tt.err
+			})
+
+			testutil.Equal(t, called, tt.vsync)
+			testutil.Equal(t, synced, tt.synced)
+			testutil.Equal(t, p.refreshesPerFrame, tt.perFrame)
+			testutil.Equal(t, p.fps, 60.0)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	"fmt"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	osdMaxMessages = 4
+	osdDuration    = 3.0 // seconds
+	osdFadeTime    = 0.5 // seconds before expiration when the message starts fading
+	osdFontSize    = 10
+)
+
+type osdMessage struct {
+	text    string
+	expires float64
+}
+
+// ShowMessage adds a message to the on-screen display. Messages are stacked in
+// the bottom-left corner of the window and fade out after a few seconds. Only
+// the most recent messages are kept when there are too many of them.
+func (w *Window) ShowMessage(format string, args ...any) {
+	msg := osdMessage{
+		text:    fmt.Sprintf(format, args...),
+		expires: rl.GetTime() + osdDuration,
+	}
+
+	if len(w.messages) == osdMaxMessages {
+		copy(w.messages, w.messages[1:])
+		w.messages = w.messages[:len(w.messages)-1]
+	}
+
+	w.messages = append(w.messages, msg)
+}
+
+func (w *Window) drawMessages() {
+	now := rl.GetTime()
+
+	// Drop expired messages, they are always at the front of the queue.
+	for len(w.messages) > 0 && w.messages[0].expires <= now {
+		w.messages = w.messages[1:]
+	}
+
+	y := int32(rl.GetScreenHeight()) - 5
+
+	for i := len(w.messages) - 1; i >= 0; i-- {
+		msg := w.messages[i]
+		y -= osdFontSize + 2
+
+		alpha := float32(1.0)
+		if left := msg.expires - now; left < osdFadeTime {
+			alpha = float32(left / osdFadeTime)
+		}
+
+		rl.DrawText(msg.text, 7, y+1, osdFontSize, rl.Fade(rl.Black, alpha))
+		rl.DrawText(msg.text, 6, y, osdFontSize, rl.Fade(rl.White, alpha))
+	}
+}
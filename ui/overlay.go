@@ -0,0 +1,141 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	"image/color"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+
+	"github.com/maxpoletaev/dendy/ppu"
+)
+
+var overlayShade = rl.NewColor(0, 0, 0, 90)
+
+type overlayTextures struct {
+	scanlines rl.Texture2D // 1x2: clear row followed by a dark row
+	grille    rl.Texture2D // 2x1: clear column followed by a dark column
+}
+
+func loadOverlayTexture(width, height int32) rl.Texture2D {
+	img := rl.GenImageColor(int(width), int(height), rl.Blank)
+	defer rl.UnloadImage(img)
+
+	rl.ImageDrawPixel(img, width-1, height-1, overlayShade)
+
+	texture := rl.LoadTextureFromImage(img)
+	rl.SetTextureFilter(texture, rl.FilterPoint)
+	rl.SetTextureWrap(texture, rl.WrapRepeat)
+
+	return texture
+}
+
+func loadOverlayTextures() overlayTextures {
+	return overlayTextures{
+		scanlines: loadOverlayTexture(1, 2),
+		grille:    loadOverlayTexture(2, 1),
+	}
+}
+
+func (t *overlayTextures) unload() {
+	rl.UnloadTexture(t.scanlines)
+	rl.UnloadTexture(t.grille)
+}
+
+// SetOverlay sets the overlay filter drawn on top of the frame.
+func (w *Window) SetOverlay(o Overlay) {
+	w.overlay = o
+}
+
+func (w *Window) cycleOverlay() {
+	w.overlay = (w.overlay + 1) % overlayCount
+}
+
+// drawOverlay repeats the overlay texture once per NES pixel row (or column)
+// over the given viewport rectangle.
+func (w *Window) drawOverlay(dest rl.Rectangle) {
+	var (
+		texture rl.Texture2D
+		source  rl.Rectangle
+	)
+
+	switch w.overlay {
+	case OverlayScanlines:
+		texture = w.overlayTextures.scanlines
+		source = rl.Rectangle{Width: 1, Height: ppu.FrameHeight * 2}
+	case OverlayGrille:
+		texture = w.overlayTextures.grille
+		source = rl.Rectangle{Width: ppu.FrameWidth * 2, Height: 1}
+	default:
+		return
+	}
+
+	rl.DrawTexturePro(texture, source, dest, rl.Vector2{}, 0, rl.White)
+}
+
+// SetBezel sets the image drawn around the frame in fullscreen mode, or removes
+// it if nil.
+func (w *Window) SetBezel(b *Bezel) {
+	if w.bezel != nil {
+		rl.UnloadTexture(w.bezelTexture)
+	}
+
+	w.bezel = b
+
+	if b == nil {
+		return
+	}
+
+	width, height := b.Image.Bounds().Dx(), b.Image.Bounds().Dy()
+	img := rl.GenImageColor(width, height, rl.Blank)
+	defer rl.UnloadImage(img)
+
+	w.bezelTexture = rl.LoadTextureFromImage(img)
+	rl.SetTextureFilter(w.bezelTexture, rl.FilterBilinear)
+
+	pixels := make([]color.RGBA, 0, width*height)
+	for i := 0; i < len(b.Image.Pix); i += 4 {
+		p := b.Image.Pix[i : i+4]
+		pixels = append(pixels, color.RGBA{R: p[0], G: p[1], B: p[2], A: p[3]})
+	}
+
+	rl.UpdateTexture(w.bezelTexture, pixels)
+}
+
+// activeBezel returns the bezel if it should be drawn, which is only the case
+// in fullscreen mode, as there is no room for it in a window.
+func (w *Window) activeBezel() *Bezel {
+	if w.bezel == nil || !rl.IsWindowFullscreen() {
+		return nil
+	}
+
+	return w.bezel
+}
+
+func (w *Window) drawBezel() {
+	b := w.activeBezel()
+	if b == nil {
+		return
+	}
+
+	dpi := w.dpiScale()
+	area, _ := b.layout(float32(rl.GetScreenWidth())*dpi, float32(rl.GetScreenHeight())*dpi)
+	area = area.scaled(1 / dpi)
+
+	rl.DrawTexturePro(
+		w.bezelTexture,
+		rl.Rectangle{
+			Width:  float32(w.bezelTexture.Width),
+			Height: float32(w.bezelTexture.Height),
+		},
+		rl.Rectangle{
+			X:      area.x,
+			Y:      area.y,
+			Width:  area.width,
+			Height: area.height,
+		},
+		rl.Vector2{},
+		0,
+		rl.White,
+	)
+}
@@ -0,0 +1,201 @@
+package ui
+
+import (
+	"fmt"
+	"image/color"
+	"slices"
+	"time"
+
+	"github.com/maxpoletaev/dendy/internal/ringbuf"
+)
+
+const (
+	// perfHistory is the number of the frames in the graph, two seconds.
+	perfHistory = 120
+
+	// perfTextInterval is how often the percentiles are recalculated, slow
+	// enough for the numbers to be read.
+	perfTextInterval = 250 * time.Millisecond
+
+	// perfFrameBudget is the time of one frame, which is half the height of
+	// the graph, marked with the line.
+	perfFrameBudget = time.Second / 60
+
+	perfBarWidth    = 2
+	perfGraphHeight = 60
+	perfGraphWidth  = perfHistory * perfBarWidth
+	perfMarginTop   = 20 // below the recording indicator
+)
+
+// Colours of the parts of the frame time in the graph.
+var (
+	perfColourEmulation = color.RGBA{R: 80, G: 200, B: 120, A: 255}
+	perfColourRollback  = color.RGBA{R: 240, G: 160, B: 40, A: 255}
+	perfColourRender    = color.RGBA{R: 80, G: 160, B: 240, A: 255}
+	perfColourIdle      = color.RGBA{R: 60, G: 60, B: 60, A: 160}
+	perfColourBudget    = color.RGBA{R: 255, G: 255, B: 255, A: 160}
+)
+
+// frameTimes are the parts of the time between two refreshes of the window.
+type frameTimes struct {
+	emulation time.Duration // reported with SetFrameTimes
+	rollback  time.Duration // same, for the netplay
+	render    time.Duration // drawing the frame, measured by the window
+	idle      time.Duration // the rest: the frame pacing, the vsync and the audio
+}
+
+// perfStats keeps the frame times of the recent frames for the performance
+// HUD, which tells whether the stutter comes from the emulation, the drawing
+// or the netplay rollbacks.
+type perfStats struct {
+	frames    *ringbuf.Buffer[frameTimes]
+	reported  frameTimes // by the caller, for the frame being drawn
+	lastFrame time.Time
+	lastText  time.Time
+	lines     []string
+	summary   string          // the 99th percentiles on one line, for the window title
+	sorted    []time.Duration // reused for the percentiles
+}
+
+func newPerfStats() *perfStats {
+	return &perfStats{
+		frames: ringbuf.New[frameTimes](perfHistory),
+		sorted: make([]time.Duration, 0, perfHistory),
+	}
+}
+
+// report sets the time the caller has spent on the frame about to be drawn.
+func (s *perfStats) report(emulation, rollback time.Duration) {
+	s.reported.emulation = emulation
+	s.reported.rollback = rollback
+}
+
+// record adds the frame, drawn in the given time and shown now. The idle time
+// is what is left of the time since the previous frame.
+func (s *perfStats) record(now time.Time, render time.Duration) {
+	if !s.lastFrame.IsZero() {
+		t := s.reported
+		t.render = render
+		t.idle = max(0, now.Sub(s.lastFrame)-t.emulation-t.rollback-t.render)
+		s.frames.PushBackEvict(t)
+	}
+
+	s.lastFrame = now
+	s.reported = frameTimes{}
+
+	if now.Sub(s.lastText) >= perfTextInterval {
+		s.lastText = now
+		s.updateText()
+	}
+}
+
+// updateText formats the median and the 99th percentile of every part. The
+// rollbacks are only listed once there have been any.
+func (s *perfStats) updateText() {
+	if s.frames.Len() == 0 {
+		return
+	}
+
+	s.lines = append(s.lines[:0], "       p50    p99")
+	s.summary = "p99"
+
+	parts := []struct {
+		name string
+		time func(t frameTimes) time.Duration
+	}{
+		{"emu", func(t frameTimes) time.Duration { return t.emulation }},
+		{"rbk", func(t frameTimes) time.Duration { return t.rollback }},
+		{"draw", func(t frameTimes) time.Duration { return t.render }},
+		{"idle", func(t frameTimes) time.Duration { return t.idle }},
+	}
+
+	for _, p := range parts {
+		s.sorted = s.sorted[:0]
+		for i := 0; i < s.frames.Len(); i++ {
+			s.sorted = append(s.sorted, p.time(s.frames.At(i)))
+		}
+
+		slices.Sort(s.sorted)
+
+		p50, p99 := percentile(s.sorted, 50), percentile(s.sorted, 99)
+		if p.name == "rbk" && s.sorted[len(s.sorted)-1] == 0 {
+			continue
+		}
+
+		s.lines = append(s.lines, fmt.Sprintf("%-4s %6.2f %6.2f", p.name, ms(p50), ms(p99)))
+		s.summary += fmt.Sprintf(" %s %.2f", p.name, ms(p99))
+	}
+
+	s.summary += " ms"
+}
+
+// text returns the lines of the percentiles, empty until enough frames have
+// been recorded.
+func (s *perfStats) text() []string {
+	if s.frames.Len() == 0 {
+		return nil
+	}
+
+	return s.lines
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// perfRect is a filled rectangle of the graph.
+type perfRect struct {
+	x, y, width, height int32
+	colour              color.RGBA
+}
+
+// graph lays out the graph in the top-right corner of the screen, appending
+// its rectangles to rects, which are reused between the frames. Each frame is
+// a bar with the parts stacked from the bottom, the newest frame on the right.
+// Returns the position of the text, below the graph.
+func (s *perfStats) graph(rects []perfRect, screenWidth int32) ([]perfRect, int32, int32) {
+	x0 := screenWidth - hudMarginX - perfGraphWidth
+	bottom := int32(perfMarginTop + perfGraphHeight)
+
+	height := func(d time.Duration) int32 {
+		return int32(int64(d) * perfGraphHeight / int64(2*perfFrameBudget))
+	}
+
+	first := perfHistory - s.frames.Len()
+
+	for i := 0; i < s.frames.Len(); i++ {
+		t := s.frames.At(i)
+		x, y := x0+int32(first+i)*perfBarWidth, bottom
+
+		for _, part := range [...]struct {
+			d      time.Duration
+			colour color.RGBA
+		}{
+			{t.emulation, perfColourEmulation},
+			{t.rollback, perfColourRollback},
+			{t.render, perfColourRender},
+			{t.idle, perfColourIdle},
+		} {
+			h := min(height(part.d), y-perfMarginTop)
+			if h <= 0 {
+				continue
+			}
+
+			y -= h
+			rects = append(rects, perfRect{x: x, y: y, width: perfBarWidth, height: h, colour: part.colour})
+		}
+	}
+
+	budgetY := bottom - height(perfFrameBudget)
+	rects = append(rects, perfRect{x: x0, y: budgetY, width: perfGraphWidth, height: 1, colour: perfColourBudget})
+
+	return rects, x0, bottom + 4
+}
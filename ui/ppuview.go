@@ -0,0 +1,244 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	"fmt"
+	"image/color"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+
+	"github.com/maxpoletaev/dendy/ppu"
+)
+
+const (
+	ppuViewPadding  = 10
+	ppuViewTextSize = 10
+	ppuViewWidth    = ppu.NameTablesWidth + ppuViewPadding*2
+)
+
+type ppuViewPage int
+
+const (
+	ppuViewNameTables ppuViewPage = iota
+	ppuViewPatternTables
+	ppuViewSprites
+	ppuViewPages
+)
+
+func (p ppuViewPage) String() string {
+	switch p {
+	case ppuViewNameTables:
+		return "Nametables"
+	case ppuViewPatternTables:
+		return "Pattern tables"
+	case ppuViewSprites:
+		return "Sprites"
+	default:
+		return "Unknown"
+	}
+}
+
+// ppuViewer is the panel docked to the right of the game, showing what is in the
+// PPU memory. The window is widened by the width of the panel when it is opened,
+// so the game is not shrunk, unless the window is maximized or in fullscreen, in
+// which case the game is scaled down to the rest of it.
+type ppuViewer struct {
+	page      ppuViewPage
+	paletteID uint8 // pattern tables palette, 0-3 for background, 4-7 for sprites
+	pixels    []color.RGBA
+	texture   rl.Texture2D
+	widened   bool // whether the window has been widened to fit the panel
+}
+
+func (w *Window) openPPUView() {
+	if w.PPUDelegate == nil {
+		return
+	}
+
+	img := rl.GenImageColor(ppu.NameTablesWidth, ppu.NameTablesHeight, rl.Black)
+	defer rl.UnloadImage(img)
+
+	w.ppuView = &ppuViewer{
+		pixels:  make([]color.RGBA, ppu.NameTablesWidth*ppu.NameTablesHeight),
+		texture: rl.LoadTextureFromImage(img),
+	}
+
+	if !rl.IsWindowFullscreen() && !rl.IsWindowMaximized() {
+		rl.SetWindowSize(rl.GetScreenWidth()+ppuViewWidth, rl.GetScreenHeight())
+		w.ppuView.widened = true
+	}
+}
+
+func (w *Window) closePPUView() {
+	if w.ppuView == nil {
+		return
+	}
+
+	if w.ppuView.widened && !rl.IsWindowFullscreen() {
+		rl.SetWindowSize(max(rl.GetScreenWidth()-ppuViewWidth, ppu.FrameWidth), rl.GetScreenHeight())
+	}
+
+	rl.UnloadTexture(w.ppuView.texture)
+	w.ppuView = nil
+}
+
+// cyclePPUView switches the panel to the next page, closing it after the last.
+func (w *Window) cyclePPUView() {
+	if w.ppuView == nil {
+		w.openPPUView()
+		return
+	}
+
+	w.ppuView.page++
+	if w.ppuView.page == ppuViewPages {
+		w.closePPUView()
+	}
+}
+
+// dockWidth returns the width of the panel docked beside the game, either the
+// memory viewer or the PPU viewer, or 0 if there is none. In the window too
+// narrow to fit the frame beside it, the PPU viewer is not drawn at all.
+func (w *Window) dockWidth() int32 {
+	if dock := w.memViewDock(); dock > 0 {
+		return dock
+	}
+
+	if w.ppuView == nil || int32(rl.GetScreenWidth()) < ppuViewWidth+ppu.FrameWidth {
+		return 0
+	}
+
+	return ppuViewWidth
+}
+
+func (w *Window) handlePPUViewMouse() {
+	v := w.ppuView
+	if v == nil || v.page != ppuViewPatternTables || w.dockWidth() == 0 {
+		return
+	}
+
+	left := float32(rl.GetScreenWidth()) - ppuViewWidth
+	if rl.IsMouseButtonPressed(rl.MouseLeftButton) && rl.GetMousePosition().X >= left {
+		v.paletteID = (v.paletteID + 1) % 8
+	}
+}
+
+// drawPPUViewPicture draws the top-left part of the texture of the given size,
+// scaled by the given factor, or less if it does not fit the height.
+func (w *Window) drawPPUViewPicture(left, top, width, height, maxHeight int32, scale float32) rl.Rectangle {
+	scale = min(scale, float32(maxHeight)/float32(height))
+
+	dest := rl.Rectangle{
+		X:      float32(left),
+		Y:      float32(top),
+		Width:  float32(width) * scale,
+		Height: float32(height) * scale,
+	}
+
+	src := rl.Rectangle{
+		Width:  float32(width),
+		Height: float32(height),
+	}
+
+	rl.DrawTexturePro(w.ppuView.texture, src, dest, rl.Vector2{}, 0, rl.White)
+
+	return dest
+}
+
+func (w *Window) drawPPUView() {
+	dock := w.dockWidth()
+	if w.ppuView == nil || dock == 0 {
+		return
+	}
+
+	var (
+		v            = w.ppuView
+		p            = w.PPUDelegate()
+		screenWidth  = int32(rl.GetScreenWidth())
+		screenHeight = int32(rl.GetScreenHeight())
+		left         = screenWidth - dock + ppuViewPadding
+		top          = int32(ppuViewPadding*2 + 20)
+		maxHeight    = screenHeight - top - ppuViewTextSize - ppuViewPadding*2
+		hint         = "F11: next view"
+	)
+
+	rl.DrawRectangle(screenWidth-dock, 0, dock, screenHeight, rl.Black)
+	w.drawTextWithShadow(v.page.String(), left, ppuViewPadding, 20, rl.White)
+
+	switch v.page {
+	case ppuViewNameTables:
+		p.DrawNameTables(v.pixels)
+		rl.UpdateTexture(v.texture, v.pixels)
+		w.drawPPUViewPicture(left, top, ppu.NameTablesWidth, ppu.NameTablesHeight, maxHeight, 1)
+
+	case ppuViewPatternTables:
+		p.DrawPatternTables(v.pixels[:ppu.PatternTablesWidth*ppu.PatternTablesHeight], v.paletteID)
+		rl.UpdateTextureRec(v.texture, rl.Rectangle{Width: ppu.PatternTablesWidth, Height: ppu.PatternTablesHeight}, v.pixels)
+		rect := w.drawPPUViewPicture(left, top, ppu.PatternTablesWidth, ppu.PatternTablesHeight, maxHeight, 2)
+		w.drawTextWithShadow(fmt.Sprintf("Palette %d", v.paletteID), left, int32(rect.Y+rect.Height)+ppuViewPadding, ppuViewTextSize, rl.LightGray)
+		hint = "Click: palette   F11: next view"
+
+	case ppuViewSprites:
+		p.DrawSprites(v.pixels[:ppu.SpritesWidth*ppu.SpritesHeight])
+		rl.UpdateTextureRec(v.texture, rl.Rectangle{Width: ppu.SpritesWidth, Height: ppu.SpritesHeight}, v.pixels)
+		rect := w.drawPPUViewPicture(left, top, ppu.SpritesWidth, ppu.SpritesHeight, maxHeight, 3)
+		w.drawSpriteInfo(p, rect, int32(rect.X+rect.Width)+ppuViewPadding, top)
+		hint = "Mouse: sprite info   F11: close"
+	}
+
+	w.drawTextWithShadow(hint, left, screenHeight-ppuViewTextSize-ppuViewPadding, ppuViewTextSize, rl.LightGray)
+}
+
+// drawSpriteInfo prints the OAM entry of the sprite under the mouse cursor, or
+// of the sprite zero if the cursor is not over any.
+func (w *Window) drawSpriteInfo(p *ppu.PPU, rect rl.Rectangle, x, y int32) {
+	var (
+		idx   int
+		mouse = rl.GetMousePosition()
+		cellW = rect.Width / 8
+		cellH = rect.Height / 8
+	)
+
+	if rl.CheckCollisionPointRec(mouse, rect) {
+		col := int((mouse.X - rect.X) / cellW)
+		row := int((mouse.Y - rect.Y) / cellH)
+		idx = min(row, 7)*8 + min(col, 7)
+	}
+
+	cell := rl.Rectangle{
+		X:      rect.X + float32(idx%8)*cellW,
+		Y:      rect.Y + float32(idx/8)*cellH,
+		Width:  cellW,
+		Height: cellH,
+	}
+
+	rl.DrawRectangleLinesEx(cell, 1, rl.Yellow)
+
+	spriteX, spriteY, tile, attr := p.OAMEntry(idx)
+
+	lines := [...]string{
+		fmt.Sprintf("Sprite %d", idx),
+		fmt.Sprintf("X: %d  Y: %d", spriteX, spriteY),
+		fmt.Sprintf("Tile: $%02X", tile),
+		fmt.Sprintf("Palette: %d", attr&0x03),
+		fmt.Sprintf("Flip: %s", spriteFlip(attr)),
+		fmt.Sprintf("Behind background: %t", attr&0x20 != 0),
+	}
+
+	for i, line := range lines {
+		w.drawTextWithShadow(line, x, y+int32(i)*(ppuViewTextSize+4), ppuViewTextSize, rl.White)
+	}
+}
+
+func spriteFlip(attr uint8) string {
+	switch attr & 0xC0 {
+	case 0x40:
+		return "horizontal"
+	case 0x80:
+		return "vertical"
+	case 0xC0:
+		return "both"
+	default:
+		return "none"
+	}
+}
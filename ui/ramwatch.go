@@ -0,0 +1,215 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+
+	"github.com/maxpoletaev/dendy/ramwatch"
+)
+
+var ramWatchBackground = rl.NewColor(0, 0, 0, 160)
+
+// ramWatchEditor is the state of the panel editing the watches. The watches
+// themselves are kept in Window.RAMWatch and shown in the corner of the screen
+// while playing, once the panel is closed.
+type ramWatchEditor struct {
+	input    string // "<address> [name]" of the watch to add
+	selected int
+}
+
+func (w *Window) openRAMWatch() {
+	if w.RAMWatch == nil {
+		return
+	}
+
+	w.watchView = &ramWatchEditor{}
+}
+
+func (w *Window) closeRAMWatch() {
+	w.watchView = nil
+}
+
+func (w *Window) toggleRAMWatch() {
+	if w.RAMWatch == nil {
+		return
+	}
+
+	w.watchShown = !w.watchShown
+}
+
+func (w *Window) ramWatchChanged() {
+	if w.RAMWatchDelegate != nil {
+		w.RAMWatchDelegate()
+	}
+}
+
+// addTypedWatch adds the watch from the typed address, given in hex, and the
+// optional name following it.
+func (w *Window) addTypedWatch() {
+	v := w.watchView
+	addrText, name, _ := strings.Cut(strings.TrimSpace(v.input), " ")
+
+	addr, err := strconv.ParseUint(strings.TrimPrefix(addrText, "$"), 16, 16)
+	if err != nil {
+		w.ShowMessage("Type the address in hex first")
+		return
+	}
+
+	w.RAMWatch.Add(uint16(addr), strings.TrimSpace(name))
+	v.selected = len(w.RAMWatch.Watches()) - 1
+	v.input = ""
+
+	// Showing the watches right away, as they are what the panel is for.
+	w.watchShown = true
+	w.ramWatchChanged()
+}
+
+// handleRAMWatchKeys processes the panel keys. The selected watch is changed
+// with the keys that are not used for typing.
+func (w *Window) handleRAMWatchKeys() {
+	var (
+		v        = w.watchView
+		watches  = w.RAMWatch.Watches()
+		selected *ramwatch.Watch
+	)
+
+	if v.selected < len(watches) {
+		selected = watches[v.selected]
+	}
+
+	switch {
+	case rl.IsKeyPressed(rl.KeyF5), rl.IsKeyPressed(rl.KeyEscape):
+		w.closeRAMWatch()
+		return
+
+	case rl.IsKeyPressed(rl.KeyBackspace):
+		if len(v.input) > 0 {
+			v.input = v.input[:len(v.input)-1]
+		}
+
+	case rl.IsKeyPressed(rl.KeyEnter):
+		w.addTypedWatch()
+
+	case rl.IsKeyPressed(rl.KeyDown):
+		v.selected = min(v.selected+1, max(len(watches)-1, 0))
+
+	case rl.IsKeyPressed(rl.KeyUp):
+		v.selected = max(v.selected-1, 0)
+
+	case selected == nil:
+		// The rest of the keys change the selected watch.
+
+	case rl.IsKeyPressed(rl.KeyDelete):
+		w.RAMWatch.Remove(selected)
+		v.selected = max(min(v.selected, len(watches)-2), 0)
+		w.ramWatchChanged()
+
+	case rl.IsKeyPressed(rl.KeyTab):
+		selected.CycleType()
+		w.ramWatchChanged()
+
+	case rl.IsKeyPressed(rl.KeyRight), rl.IsKeyPressed(rl.KeyLeft):
+		selected.CycleBase()
+		w.ramWatchChanged()
+	}
+
+	for c := rl.GetCharPressed(); c != 0; c = rl.GetCharPressed() {
+		if c >= ' ' && c <= '~' && len(v.input) < 32 {
+			v.input += string(c)
+		}
+	}
+}
+
+// drawRAMWatch draws the watches with their current values in the top left
+// corner, over the game.
+func (w *Window) drawRAMWatch() {
+	const (
+		padding  = 4
+		textSize = 10
+		lineSize = 12
+	)
+
+	watches := w.RAMWatch.Watches()
+	if len(watches) == 0 {
+		return
+	}
+
+	var (
+		labels     = make([]string, len(watches))
+		values     = make([]string, len(watches))
+		labelWidth int32
+		valueWidth int32
+	)
+
+	for i, watch := range watches {
+		labels[i] = watch.Label()
+		values[i] = w.RAMWatch.Value(watch)
+		labelWidth = max(labelWidth, rl.MeasureText(labels[i], textSize))
+		valueWidth = max(valueWidth, rl.MeasureText(values[i], textSize))
+	}
+
+	var (
+		width  = labelWidth + valueWidth + padding*4
+		height = int32(len(watches))*lineSize + padding*2
+	)
+
+	rl.DrawRectangle(padding, padding, width, height, ramWatchBackground)
+
+	for i := range watches {
+		y := padding*2 + int32(i)*lineSize
+		w.drawTextWithShadow(labels[i], padding*2, y, textSize, rl.LightGray)
+		w.drawTextWithShadow(values[i], padding*3+labelWidth, y, textSize, rl.White)
+	}
+}
+
+func (w *Window) drawRAMWatchEditor() {
+	const (
+		padding   = 10
+		titleSize = 20
+		textSize  = 10
+		lineSize  = 12
+	)
+
+	var (
+		v            = w.watchView
+		screenWidth  = int32(rl.GetScreenWidth())
+		screenHeight = int32(rl.GetScreenHeight())
+		watches      = w.RAMWatch.Watches()
+	)
+
+	rl.DrawRectangle(0, 0, screenWidth, screenHeight, memViewBackground)
+	w.drawTextWithShadow(fmt.Sprintf("RAM Watch: %d", len(watches)), padding, padding, titleSize, rl.White)
+
+	top := int32(padding*2 + titleSize)
+	w.drawTextWithShadow("Add: "+v.input+"_", padding, top, textSize, rl.Yellow)
+	top += lineSize * 2
+
+	// Scroll the list to keep the selected watch visible.
+	rows := max(int((screenHeight-top-textSize*2-padding*3)/lineSize), 1)
+	first := max(v.selected-rows+1, 0)
+
+	for i, watch := range watches[first:min(first+rows, len(watches))] {
+		if first+i == v.selected {
+			rl.DrawRectangle(padding-2, top-1, screenWidth-padding*2, lineSize, rl.DarkBlue)
+		}
+
+		line := fmt.Sprintf("%04X  %-3s  %s  %-10s  %s", watch.Addr, watch.Type, watch.Base, w.RAMWatch.Value(watch), watch.Name)
+		w.drawTextWithShadow(line, padding, top, textSize, rl.LightGray)
+		top += lineSize
+	}
+
+	hints := []string{
+		"Type <address> [name], e.g. 0075 Health, and Enter: add   Del: remove",
+		"Tab: type (u8/u16/bcd)   Left/Right: base (dec/hex/bin)   F5: close",
+	}
+
+	for i, hint := range hints {
+		y := screenHeight - padding - int32(len(hints)-i)*lineSize
+		w.drawTextWithShadow(hint, padding, y, textSize, rl.LightGray)
+	}
+}
@@ -0,0 +1,48 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func (w *Window) toggleRegisters() {
+	if w.RegistersDelegate == nil {
+		return
+	}
+
+	w.showRegisters = !w.showRegisters
+}
+
+// drawRegisters draws the lines describing the state of the hardware in the
+// bottom left corner, over the game. They are requested on every frame, so the
+// registers seen are the ones as of the end of the frame.
+func (w *Window) drawRegisters() {
+	const (
+		padding  = 4
+		textSize = 10
+		lineSize = 12
+	)
+
+	lines := w.RegistersDelegate()
+	if len(lines) == 0 {
+		return
+	}
+
+	var (
+		screenHeight = int32(rl.GetScreenHeight())
+		height       = int32(len(lines))*lineSize + padding*2
+		top          = screenHeight - height - padding
+		width        int32
+	)
+
+	for _, line := range lines {
+		width = max(width, rl.MeasureText(line, textSize))
+	}
+
+	rl.DrawRectangle(padding, top, width+padding*2, height, ramWatchBackground)
+
+	for i, line := range lines {
+		w.drawTextWithShadow(line, padding*2, top+padding+int32(i)*lineSize, textSize, rl.White)
+	}
+}
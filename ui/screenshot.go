@@ -0,0 +1,56 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	"log"
+	"os"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// takeScreenshot saves the current window contents into the screenshot
+// directory, creating it if necessary.
+func (w *Window) takeScreenshot() {
+	if err := os.MkdirAll(w.screenshotDir, 0755); err != nil {
+		log.Printf("[ERROR] failed to create screenshot directory: %s", err)
+		return
+	}
+
+	path, err := screenshotPath(w.screenshotDir, w.screenshotPrefix, time.Now())
+	if err != nil {
+		log.Printf("[ERROR] failed to take screenshot: %s", err)
+		return
+	}
+
+	img := rl.LoadImageFromScreen()
+	defer rl.UnloadImage(img)
+
+	if !rl.ExportImage(*img, path) {
+		log.Printf("[ERROR] failed to save screenshot: %s", path)
+		return
+	}
+
+	log.Printf("[INFO] screenshot saved: %s", path)
+	w.ShowMessage("Screenshot saved")
+}
+
+// takeFrameScreenshot saves the last frame in its original resolution, unlike
+// takeScreenshot, which captures the scaled picture along with the HUD.
+func (w *Window) takeFrameScreenshot() {
+	path, err := saveFrameScreenshot(w.screenshotDir, w.screenshotPrefix, w.frame)
+	if err != nil {
+		log.Printf("[ERROR] failed to save screenshot: %s", err)
+		return
+	}
+
+	log.Printf("[INFO] screenshot saved: %s", path)
+
+	if w.copyScreenshots {
+		copyImageToClipboard(path)
+		w.ShowMessage("Frame saved and copied")
+	} else {
+		w.ShowMessage("Frame saved")
+	}
+}
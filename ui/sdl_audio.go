@@ -0,0 +1,156 @@
+//go:build sdl && !ebiten
+
+package ui
+
+import (
+	"log"
+	"math"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// AudioOut is the SDL2 implementation of the audio output. The samples are
+// pushed to the device queue, and the volume is applied in software since SDL
+// has no master volume control.
+type AudioOut struct {
+	*audioPump
+
+	device     sdl.AudioDeviceID
+	volume     float32
+	muted      bool
+	gain       atomic.Uint32 // float32 bits of the volume applied, 0 if muted
+	channels   int
+	bufferSize int
+	scaled     []float32
+}
+
+func CreateAudio(sampleRate, sampleSize, channels, bufferSize int) *AudioOut {
+	if sampleSize != 32 {
+		log.Fatalf("[ERROR] unsupported sample size: %d", sampleSize)
+	}
+
+	if err := sdl.InitSubSystem(sdl.INIT_AUDIO); err != nil {
+		log.Fatalf("[ERROR] failed to initialize SDL audio: %s", err)
+	}
+
+	spec := &sdl.AudioSpec{
+		Freq:     int32(sampleRate),
+		Format:   sdl.AUDIO_F32SYS,
+		Channels: uint8(channels),
+		Samples:  uint16(bufferSize),
+	}
+
+	device, err := sdl.OpenAudioDevice("", false, spec, nil, 0)
+	if err != nil {
+		log.Fatalf("[ERROR] failed to open audio device: %s", err)
+	}
+
+	sdl.PauseAudioDevice(device, false)
+
+	s := &AudioOut{
+		device:     device,
+		channels:   channels,
+		bufferSize: bufferSize,
+	}
+
+	s.SetVolume(1.0)
+	s.audioPump = startAudioPump(sampleRate, bufferSize, s.processed, s.queue)
+
+	return s
+}
+
+func (s *AudioOut) SetVolume(volume float32) {
+	s.volume = max(0, min(1, volume))
+	s.updateGain()
+}
+
+// updateGain publishes the volume to the goroutine queueing the samples.
+func (s *AudioOut) updateGain() {
+	gain := s.volume
+	if s.muted {
+		gain = 0
+	}
+
+	s.gain.Store(math.Float32bits(gain))
+}
+
+// ChangeVolume adjusts the volume by the given delta and returns the new value.
+// Changing the volume also unmutes the sound.
+func (s *AudioOut) ChangeVolume(delta float32) float32 {
+	volume := s.volume + delta
+	volume = float32(math.Round(float64(volume)*100) / 100) // avoid accumulating float errors
+
+	s.muted = false
+	s.SetVolume(volume)
+
+	return s.volume
+}
+
+func (s *AudioOut) Volume() float32 {
+	return s.volume
+}
+
+func (s *AudioOut) Muted() bool {
+	return s.muted
+}
+
+func (s *AudioOut) Close() {
+	s.stop()
+	sdl.CloseAudioDevice(s.device)
+	sdl.QuitSubSystem(sdl.INIT_AUDIO)
+}
+
+// processed returns true when no more than one buffer is left in the queue,
+// so that the next one can be queued without a gap in the playback.
+func (s *AudioOut) processed() bool {
+	queued := int(sdl.GetQueuedAudioSize(s.device)) / 4 / s.channels
+	return queued <= s.bufferSize
+}
+
+// queue is called by the audio pump with the samples to play.
+func (s *AudioOut) queue(buf []float32) {
+	if len(buf) == 0 {
+		return
+	}
+
+	volume := math.Float32frombits(s.gain.Load())
+
+	if cap(s.scaled) < len(buf) {
+		s.scaled = make([]float32, len(buf))
+	}
+
+	scaled := s.scaled[:len(buf)]
+	for i, sample := range buf {
+		scaled[i] = sample * volume
+	}
+
+	data := unsafe.Slice((*byte)(unsafe.Pointer(&scaled[0])), len(scaled)*4)
+	if err := sdl.QueueAudio(s.device, data); err != nil {
+		log.Printf("[ERROR] failed to queue audio: %s", err)
+	}
+}
+
+// SetPaused stops the playback without closing the device. The queued samples
+// are dropped, so that they are not played after resuming.
+func (s *AudioOut) SetPaused(paused bool) {
+	s.paused.Store(paused)
+
+	if paused {
+		sdl.ClearQueuedAudio(s.device)
+	}
+
+	sdl.PauseAudioDevice(s.device, paused)
+}
+
+func (s *AudioOut) Mute(m bool) {
+	s.muted = m
+	s.updateGain()
+}
+
+// ToggleMute mutes or unmutes the sound and returns the new state.
+func (s *AudioOut) ToggleMute() bool {
+	s.Mute(!s.muted)
+	return s.muted
+}
@@ -0,0 +1,72 @@
+//go:build sdl && !ebiten
+
+package ui
+
+import (
+	"log"
+	"math"
+
+	"github.com/veandco/go-sdl2/sdl"
+
+	"github.com/maxpoletaev/dendy/input"
+)
+
+// Buttons are mapped by their position, so that B and A are the left and the
+// right face buttons, as on the NES controller.
+var gamepadMap = map[sdl.GameControllerButton]input.Button{
+	sdl.CONTROLLER_BUTTON_DPAD_UP:    input.ButtonUp,
+	sdl.CONTROLLER_BUTTON_DPAD_DOWN:  input.ButtonDown,
+	sdl.CONTROLLER_BUTTON_DPAD_LEFT:  input.ButtonLeft,
+	sdl.CONTROLLER_BUTTON_DPAD_RIGHT: input.ButtonRight,
+	sdl.CONTROLLER_BUTTON_B:          input.ButtonA,
+	sdl.CONTROLLER_BUTTON_A:          input.ButtonB,
+	sdl.CONTROLLER_BUTTON_START:      input.ButtonStart,
+	sdl.CONTROLLER_BUTTON_BACK:       input.ButtonSelect,
+}
+
+// handleControllerEvent opens the first game controller connected and closes it
+// when it is unplugged. SDL also reports the controllers present at startup as
+// connected, so there is no need to look for them separately.
+func (w *Window) handleControllerEvent(e *sdl.ControllerDeviceEvent) {
+	switch e.Type {
+	case sdl.CONTROLLERDEVICEADDED:
+		if w.controller != nil {
+			return
+		}
+
+		if w.controller = sdl.GameControllerOpen(int(e.Which)); w.controller == nil {
+			log.Printf("[WARN] failed to open game controller: %s", sdl.GetError())
+			return
+		}
+
+		w.ShowMessage("Gamepad connected: %s", w.controller.Name())
+
+	case sdl.CONTROLLERDEVICEREMOVED:
+		if w.controller == nil || w.controller.Joystick().InstanceID() != e.Which {
+			return
+		}
+
+		w.controller.Close()
+		w.controller = nil
+		w.ShowMessage("Gamepad disconnected, using keyboard")
+	}
+}
+
+// readGamepad returns the joystick buttons held on the game controller, with
+// the left analog stick acting as the d-pad.
+func (w *Window) readGamepad() (buttons uint8) {
+	if w.controller == nil || (!w.backgroundInput && !w.InFocus()) {
+		return 0
+	}
+
+	for b, button := range gamepadMap {
+		if w.controller.Button(b) != 0 {
+			buttons |= button
+		}
+	}
+
+	x := float32(w.controller.Axis(sdl.CONTROLLER_AXIS_LEFTX)) / math.MaxInt16
+	y := float32(w.controller.Axis(sdl.CONTROLLER_AXIS_LEFTY)) / math.MaxInt16
+
+	return buttons | stickButtons(x, y)
+}
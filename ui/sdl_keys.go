@@ -0,0 +1,105 @@
+//go:build sdl && !ebiten
+
+package ui
+
+import (
+	"fmt"
+
+	"github.com/veandco/go-sdl2/sdl"
+
+	"github.com/maxpoletaev/dendy/input"
+)
+
+// Keys are identified by SDL scancodes, so the bindings do not depend on the
+// keyboard layout.
+var defaultKeyMap = map[int32]input.Button{
+	sdl.SCANCODE_W:      input.ButtonUp,
+	sdl.SCANCODE_S:      input.ButtonDown,
+	sdl.SCANCODE_A:      input.ButtonLeft,
+	sdl.SCANCODE_D:      input.ButtonRight,
+	sdl.SCANCODE_K:      input.ButtonA,
+	sdl.SCANCODE_J:      input.ButtonB,
+	sdl.SCANCODE_RETURN: input.ButtonStart,
+	sdl.SCANCODE_RSHIFT: input.ButtonSelect,
+}
+
+// defaultMicKey is held to speak into the microphone, "V" for "voice".
+const defaultMicKey = sdl.SCANCODE_V
+
+// KeyName returns a human-readable name of a keyboard key, which is also used
+// to store key bindings in the config file.
+func KeyName(key int32) string {
+	if name := sdl.GetScancodeName(sdl.Scancode(key)); name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("Key%d", key)
+}
+
+// ParseKey converts a key name returned by KeyName back to the key code.
+func ParseKey(name string) (int32, error) {
+	var key int32
+	if _, err := fmt.Sscanf(name, "Key%d", &key); err == nil {
+		return key, nil
+	}
+
+	if code := sdl.GetScancodeFromName(name); code != sdl.SCANCODE_UNKNOWN {
+		return int32(code), nil
+	}
+
+	return 0, fmt.Errorf("unknown key: %s", name)
+}
+
+func (w *Window) UpdateJoystick() {
+	if w.InputDelegate == nil {
+		return
+	}
+
+	var buttons uint8
+
+	for key, button := range w.keyMap {
+		if w.isKeyDown(sdl.Scancode(key)) {
+			buttons |= button
+		}
+	}
+
+	w.InputDelegate(buttons | w.readGamepad())
+
+	if w.MicrophoneDelegate != nil {
+		w.MicrophoneDelegate(w.isKeyDown(sdl.Scancode(w.micKey)))
+	}
+}
+
+// BindKey assigns the keyboard key to the joystick button, replacing the key
+// that was previously assigned to it.
+func (w *Window) BindKey(button input.Button, key int32) {
+	for k, b := range w.keyMap {
+		if b == button || k == key {
+			delete(w.keyMap, k)
+		}
+	}
+
+	w.keyMap[key] = button
+}
+
+// BoundKey returns the keyboard key assigned to the joystick button.
+func (w *Window) BoundKey(button input.Button) (int32, bool) {
+	for k, b := range w.keyMap {
+		if b == button {
+			return k, true
+		}
+	}
+
+	return 0, false
+}
+
+// BindMicrophoneKey assigns the keyboard key held to speak into the microphone
+// of the second controller.
+func (w *Window) BindMicrophoneKey(key int32) {
+	w.micKey = key
+}
+
+// MicrophoneKey returns the keyboard key assigned to the microphone.
+func (w *Window) MicrophoneKey() int32 {
+	return w.micKey
+}
@@ -0,0 +1,815 @@
+//go:build sdl && !ebiten
+
+package ui
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"runtime"
+	"time"
+	"unsafe"
+
+	"github.com/veandco/go-sdl2/sdl"
+
+	"github.com/maxpoletaev/dendy/cheats"
+	"github.com/maxpoletaev/dendy/input"
+	"github.com/maxpoletaev/dendy/ppu"
+	"github.com/maxpoletaev/dendy/ramwatch"
+)
+
+const volumeBarDuration = 1500 // milliseconds
+
+// Window is the SDL2 implementation of the frontend. It has the same API as the
+// raylib one, but has no text rendering, so the on-screen messages are written
+// to the log and the status is displayed in the window title instead. Menus,
+// the ROM browser and shaders are not supported.
+type Window struct {
+	ZapperDelegate      func(x, y int, trigger bool)
+	InputDelegate       func(buttons uint8)
+	MicrophoneDelegate  func(on bool)
+	MuteDelegate        func() bool
+	VolumeDelegate      func(delta float32) float32
+	ResyncDelegate      func()
+	ResetDelegate       func()
+	RewindDelegate      func()
+	FastForwardDelegate func(enabled bool)
+	PauseDelegate       func()
+	FrameStepDelegate   func()
+	ListSlotsDelegate   func() []SaveSlot
+	SaveSlotDelegate    func(slot int) error
+	LoadSlotDelegate    func(slot int) error
+	RecordDelegate      func() bool
+	MenuDelegate        func() []MenuItem
+	GIFDelegate         func()
+	PPUDelegate         func() *ppu.PPU                // the PPU viewer is only in the raylib frontend
+	DiskSideDelegate    func()                         // switches the side of the FDS disk
+	MemorySpaces        []MemorySpace                  // the memory viewer is only in the raylib frontend
+	CheatSearch         *cheats.Search                 // same for the cheat search
+	FreezeDelegate      func(addr uint16, value uint8) // and for freezing its results
+	RAMWatch            *ramwatch.List                 // and for the RAM watch
+	RAMWatchDelegate    func()
+	RegistersDelegate   func() []string // and for the register overlay
+	ShowPing            bool
+	ShowFPS             bool
+	ShowPerf            bool
+	FPS                 int
+
+	window      *sdl.Window
+	renderer    *sdl.Renderer
+	texture     *sdl.Texture
+	prescaled   *sdl.Texture
+	prescaledBy int32
+	controller  *sdl.GameController
+	bezel       *Bezel
+	bezelImage  *sdl.Texture
+	micKey      int32
+	keyMap      map[int32]input.Button
+	pressed     map[sdl.Scancode]bool
+	frame       []color.RGBA
+	title       string
+	shownTitle  titleState
+	overlay     Overlay
+	remotePing  int64
+	shouldClose bool
+	grayscale   bool
+	scaleMode   ScaleMode
+	scaleFilter ScaleFilter
+	pixelAspect bool
+	vsync       bool
+	fastForward bool
+	paused      bool
+	recording   bool
+	muted       bool
+	volume      float32
+	pacer       framePacer
+	fpsCounter  fpsCounter
+	perf        *perfStats
+
+	volumeShownUntil uint64
+	backgroundInput  bool
+
+	// Reused on every frame, as the pointers passed to SDL escape to the heap.
+	screenRect   sdl.Rect
+	bezelRect    sdl.Rect
+	overlayRects []sdl.Rect
+	perfRects    []perfRect
+	perfBar      sdl.Rect
+
+	screenshotDir    string
+	screenshotPrefix string
+	copyScreenshots  bool
+}
+
+func init() {
+	// SDL video functions must be called from the main thread.
+	runtime.LockOSThread()
+}
+
+// Run calls the main function of the program in place, as the main goroutine is
+// already locked to the main thread.
+func Run(main func()) {
+	main()
+}
+
+// windowsDPIAwareness is the SDL_HINT_WINDOWS_DPI_AWARENESS hint, which is not
+// exposed by go-sdl2. Without it, Windows upscales the window when the display
+// scaling is enabled, which makes the picture blurry.
+const windowsDPIAwareness = "SDL_WINDOWS_DPI_AWARENESS"
+
+func CreateWindow(opts WindowOptions) *Window {
+	sdl.SetHint(windowsDPIAwareness, "permonitorv2")
+
+	if opts.BackgroundInput {
+		sdl.SetHint(sdl.HINT_JOYSTICK_ALLOW_BACKGROUND_EVENTS, "1")
+	}
+
+	if err := sdl.Init(sdl.INIT_VIDEO | sdl.INIT_GAMECONTROLLER); err != nil {
+		log.Fatalf("[ERROR] failed to initialize SDL: %s", err)
+	}
+
+	frameWidth := float64(ppu.FrameWidth)
+	if opts.PixelAspect {
+		frameWidth *= pixelAspect87
+	}
+
+	// On Windows, the window size is in physical pixels, so it is enlarged
+	// according to the display scaling. On macOS, the size is in points and
+	// the high-DPI framebuffer is enabled with the window flag.
+	contentScale := 1.0
+	if runtime.GOOS == "windows" {
+		if _, hdpi, _, err := sdl.GetDisplayDPI(0); err == nil && hdpi > 0 {
+			contentScale = float64(hdpi) / 96
+		}
+	}
+
+	windowWidth := int32(math.Round(frameWidth * float64(opts.Scale) * contentScale))
+	windowHeight := int32(math.Round(ppu.FrameHeight * float64(opts.Scale) * contentScale))
+
+	var windowFlags uint32 = sdl.WINDOW_RESIZABLE | sdl.WINDOW_ALLOW_HIGHDPI
+	if opts.Fullscreen {
+		windowFlags |= sdl.WINDOW_FULLSCREEN_DESKTOP
+	}
+
+	window, err := sdl.CreateWindow("Dendy Emulator", sdl.WINDOWPOS_CENTERED, sdl.WINDOWPOS_CENTERED,
+		windowWidth, windowHeight, windowFlags)
+	if err != nil {
+		log.Fatalf("[ERROR] failed to create window: %s", err)
+	}
+
+	window.SetMinimumSize(ppu.FrameWidth, ppu.FrameHeight)
+
+	var rendererFlags uint32 = sdl.RENDERER_ACCELERATED
+	if opts.VSync {
+		rendererFlags |= sdl.RENDERER_PRESENTVSYNC
+	}
+
+	renderer, err := sdl.CreateRenderer(window, -1, rendererFlags)
+	if err != nil {
+		log.Fatalf("[ERROR] failed to create renderer: %s", err)
+	}
+
+	// ABGR8888 matches the memory layout of color.RGBA on little-endian machines.
+	texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_ABGR8888, sdl.TEXTUREACCESS_STREAMING,
+		ppu.FrameWidth, ppu.FrameHeight)
+	if err != nil {
+		log.Fatalf("[ERROR] failed to create texture: %s", err)
+	}
+
+	keyMap := make(map[int32]input.Button, len(defaultKeyMap))
+	for key, button := range defaultKeyMap {
+		keyMap[key] = button
+	}
+
+	return &Window{
+		window:      window,
+		renderer:    renderer,
+		texture:     texture,
+		micKey:      defaultMicKey,
+		keyMap:      keyMap,
+		pressed:     make(map[sdl.Scancode]bool),
+		title:       "Dendy Emulator",
+		scaleMode:   opts.ScaleMode,
+		scaleFilter: opts.Filter,
+		pixelAspect: opts.PixelAspect,
+		vsync:       opts.VSync,
+		overlay:     opts.Overlay,
+
+		backgroundInput:  opts.BackgroundInput,
+		screenshotDir:    opts.ScreenshotDir,
+		screenshotPrefix: opts.ScreenshotPrefix,
+		copyScreenshots:  opts.CopyScreenshots,
+	}
+}
+
+// EnableShader is not supported by the SDL frontend.
+func (w *Window) EnableShader(code string) {
+	log.Printf("[WARN] shaders are not supported by the SDL frontend")
+}
+
+// DisableShader is a no-op, as shaders are not supported by the SDL frontend.
+func (w *Window) DisableShader() {}
+
+// SetScaleMode changes how the frame is fitted into the window.
+func (w *Window) SetScaleMode(mode ScaleMode) {
+	w.scaleMode = mode
+}
+
+// SetScaleFilter changes how the frame pixels are interpolated when scaled.
+func (w *Window) SetScaleFilter(f ScaleFilter) {
+	w.scaleFilter = f
+}
+
+// SetPixelAspect enables or disables the 8:7 pixel aspect ratio correction.
+func (w *Window) SetPixelAspect(enabled bool) {
+	w.pixelAspect = enabled
+}
+
+// SetOverlay sets the overlay filter drawn on top of the frame.
+func (w *Window) SetOverlay(o Overlay) {
+	w.overlay = o
+}
+
+func (w *Window) SetTitle(title string) {
+	w.title = title
+}
+
+// SetFrameRate limits the number of frames per second. Unlike raylib, SDL has
+// no built-in frame limiter, so Refresh sleeps for the rest of the frame. With
+// vsync, the frames are counted in the monitor refreshes instead.
+func (w *Window) SetFrameRate(fps float64) {
+	w.pacer.setFrameRate(fps, w.vsync, func() (float64, error) {
+		display, err := w.window.GetDisplayIndex()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get display index: %w", err)
+		}
+
+		mode, err := sdl.GetCurrentDisplayMode(display)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get display mode: %w", err)
+		}
+
+		return float64(mode.RefreshRate), nil
+	})
+}
+
+func (w *Window) SetGrayscale(grayscale bool) {
+	w.grayscale = grayscale
+}
+
+func (w *Window) Close() {
+	if w.controller != nil {
+		w.controller.Close()
+	}
+
+	w.destroyPrescaled()
+	w.SetBezel(nil)
+	_ = w.texture.Destroy()
+	_ = w.renderer.Destroy()
+	_ = w.window.Destroy()
+	sdl.Quit()
+}
+
+func (w *Window) ShouldClose() bool {
+	return w.shouldClose
+}
+
+func (w *Window) SetPingInfo(pingMs int64) {
+	w.remotePing = pingMs
+}
+
+// SetFrameTimes reports the time spent emulating the frame about to be shown
+// and replaying the netplay rollbacks, for the performance HUD.
+func (w *Window) SetFrameTimes(emulation, rollback time.Duration) {
+	if w.perf != nil {
+		w.perf.report(emulation, rollback)
+	}
+}
+
+// SetRecording controls whether the recording indicator is displayed.
+func (w *Window) SetRecording(recording bool) {
+	w.recording = recording
+}
+
+// SetPaused controls whether the frame is dimmed to indicate the pause.
+func (w *Window) SetPaused(paused bool) {
+	w.paused = paused
+}
+
+// ShowMessage writes the message to the log, since the SDL frontend cannot
+// render text.
+func (w *Window) ShowMessage(format string, args ...any) {
+	log.Printf("[INFO] %s", fmt.Sprintf(format, args...))
+}
+
+// MenuOpen always returns false, as menus are not supported by the SDL frontend.
+func (w *Window) MenuOpen() bool {
+	return false
+}
+
+// CloseMenu is a no-op, as menus are not supported by the SDL frontend.
+func (w *Window) CloseMenu() {}
+
+// OpenSlotMenu is not supported by the SDL frontend.
+func (w *Window) OpenSlotMenu() {
+	log.Printf("[WARN] the save slot menu is not supported by the SDL frontend")
+}
+
+// SelectROM is not supported by the SDL frontend, the ROM file must be passed
+// on the command line.
+func (w *Window) SelectROM(dir string, recent []RecentROM) string {
+	log.Printf("[ERROR] the ROM browser is not supported by the SDL frontend")
+	return ""
+}
+
+func (w *Window) InFocus() bool {
+	return w.window.GetFlags()&sdl.WINDOW_INPUT_FOCUS != 0
+}
+
+// pollEvents processes the pending window events and remembers which keys were
+// pressed since the previous frame.
+func (w *Window) pollEvents() {
+	clear(w.pressed)
+
+	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+		switch e := event.(type) {
+		case *sdl.QuitEvent:
+			w.shouldClose = true
+		case *sdl.KeyboardEvent:
+			if e.Type == sdl.KEYDOWN && e.Repeat == 0 {
+				w.pressed[e.Keysym.Scancode] = true
+			}
+		case *sdl.ControllerDeviceEvent:
+			w.handleControllerEvent(e)
+		}
+	}
+}
+
+func (w *Window) isKeyPressed(key sdl.Scancode) bool {
+	return w.pressed[key]
+}
+
+func (w *Window) isKeyDown(key sdl.Scancode) bool {
+	return sdl.GetKeyboardState()[key] != 0
+}
+
+func (w *Window) isModifierPressed() bool {
+	ctrl := w.isKeyDown(sdl.SCANCODE_LCTRL) || w.isKeyDown(sdl.SCANCODE_RCTRL)
+	super := w.isKeyDown(sdl.SCANCODE_LGUI) || w.isKeyDown(sdl.SCANCODE_RGUI)
+	return super || ctrl
+}
+
+// dpiScale returns the number of renderer pixels per window coordinate, which
+// is used to convert the mouse position on high-DPI screens.
+func (w *Window) dpiScale() float32 {
+	outputWidth, _, err := w.renderer.GetOutputSize()
+	windowWidth, _ := w.window.GetSize()
+
+	if err != nil || windowWidth == 0 {
+		return 1
+	}
+
+	return float32(outputWidth) / float32(windowWidth)
+}
+
+func (w *Window) viewport() viewport {
+	width, height, err := w.renderer.GetOutputSize()
+	if err != nil {
+		log.Printf("[ERROR] failed to get window size: %s", err)
+	}
+
+	return fitBezelViewport(w.activeBezel(), float32(width), float32(height), w.scaleMode, w.pixelAspect)
+}
+
+func (v viewport) rect() sdl.Rect {
+	return sdl.Rect{
+		X: int32(v.x),
+		Y: int32(v.y),
+		W: int32(v.width),
+		H: int32(v.height),
+	}
+}
+
+func (w *Window) updateTexture(ppuFrame []color.RGBA) {
+	if w.grayscale {
+		for i, c := range ppuFrame {
+			ppuFrame[i] = toGrayscale(c)
+		}
+	}
+
+	w.frame = ppuFrame
+
+	if len(ppuFrame) == 0 {
+		return
+	}
+
+	err := w.texture.Update(nil, unsafe.Pointer(&ppuFrame[0]), ppu.FrameWidth*4)
+	if err != nil {
+		log.Printf("[ERROR] failed to update texture: %s", err)
+	}
+}
+
+// drawOverlay darkens every other row (or column) of NES pixels.
+func (w *Window) drawOverlay(v viewport) {
+	rects := w.overlayRects[:0]
+
+	switch w.overlay {
+	case OverlayScanlines:
+		step := v.height / ppu.FrameHeight
+		for i := 0; i < ppu.FrameHeight; i++ {
+			y := v.y + float32(i)*step + step/2
+			rects = append(rects, sdl.Rect{X: int32(v.x), Y: int32(y), W: int32(v.width), H: int32(math.Ceil(float64(step / 2)))})
+		}
+	case OverlayGrille:
+		step := v.width / ppu.FrameWidth
+		for i := 0; i < ppu.FrameWidth; i++ {
+			x := v.x + float32(i)*step + step/2
+			rects = append(rects, sdl.Rect{X: int32(x), Y: int32(v.y), W: int32(math.Ceil(float64(step / 2))), H: int32(v.height)})
+		}
+	default:
+		return
+	}
+
+	w.overlayRects = rects
+
+	_ = w.renderer.SetDrawColor(0, 0, 0, 90)
+	_ = w.renderer.FillRects(rects)
+}
+
+func (w *Window) drawHUD(v viewport) {
+	width, height, _ := w.renderer.GetOutputSize()
+
+	if w.paused {
+		_ = w.renderer.SetDrawColor(0, 0, 0, 120)
+		_ = w.renderer.FillRect(&w.screenRect)
+	}
+
+	if w.recording {
+		_ = w.renderer.SetDrawColor(255, 0, 0, 255)
+		_ = w.renderer.FillRect(&sdl.Rect{X: width - 14, Y: 6, W: 8, H: 8})
+	}
+
+	if sdl.GetTicks64() <= w.volumeShownUntil {
+		x := width/2 - 50
+		y := height - 26
+		_ = w.renderer.SetDrawColor(80, 80, 80, 255)
+		_ = w.renderer.FillRect(&sdl.Rect{X: x, Y: y, W: 100, H: 6})
+		_ = w.renderer.SetDrawColor(255, 255, 255, 255)
+		_ = w.renderer.FillRect(&sdl.Rect{X: x, Y: y, W: int32(w.volume * 100), H: 6})
+	}
+
+	if w.ShowPerf && w.perf != nil {
+		w.drawPerf(width)
+	}
+}
+
+// drawPerf draws the frame time graph, the percentiles go to the title.
+func (w *Window) drawPerf(screenWidth int32) {
+	w.perfRects, _, _ = w.perf.graph(w.perfRects[:0], screenWidth)
+
+	for _, r := range w.perfRects {
+		w.perfBar = sdl.Rect{X: r.x, Y: r.y, W: r.width, H: r.height}
+		_ = w.renderer.SetDrawColor(r.colour.R, r.colour.G, r.colour.B, r.colour.A)
+		_ = w.renderer.FillRect(&w.perfBar)
+	}
+}
+
+// titleState is what the title is made of, so that it is only formatted when
+// any of it changes.
+type titleState struct {
+	title       string
+	fps         int
+	ping        int64
+	perf        string
+	fastForward bool
+	muted       bool
+	paused      bool
+}
+
+// updateTitle displays the information the raylib frontend draws as text.
+func (w *Window) updateTitle() {
+	state := titleState{
+		title:       w.title,
+		fastForward: w.fastForward,
+		muted:       w.muted,
+		paused:      w.paused,
+	}
+
+	if w.ShowFPS {
+		state.fps = w.fpsCounter.fps
+	}
+
+	if w.ShowPing {
+		state.ping = w.remotePing
+	}
+
+	if w.ShowPerf && w.perf != nil {
+		state.perf = w.perf.summary
+	}
+
+	if state == w.shownTitle {
+		return
+	}
+
+	title := state.title
+
+	if w.ShowFPS {
+		title += fmt.Sprintf(" | %d fps", state.fps)
+	}
+
+	if state.ping > 0 {
+		title += fmt.Sprintf(" | %d ms", state.ping)
+	}
+
+	if state.perf != "" {
+		title += " | " + state.perf
+	}
+
+	if state.fastForward {
+		title += " | >>"
+	}
+
+	if state.muted {
+		title += " | MUTE"
+	}
+
+	if state.paused {
+		title += " | PAUSED"
+	}
+
+	w.window.SetTitle(title)
+	w.shownTitle = state
+}
+
+func (w *Window) Refresh(ppuFrame []color.RGBA) {
+	w.fpsCounter.tick(w.pacer.wait())
+	renderStart := time.Now()
+
+	if w.ShowPerf && w.perf == nil {
+		w.perf = newPerfStats()
+	}
+
+	w.pollEvents()
+	w.updateTexture(ppuFrame)
+
+	v := w.viewport()
+
+	_ = w.renderer.SetDrawColor(0, 0, 0, 255)
+	_ = w.renderer.Clear()
+	w.screenRect = v.rect()
+	_ = w.renderer.Copy(w.prescale(v), nil, &w.screenRect)
+	_ = w.renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+
+	w.drawOverlay(v)
+	w.drawBezel()
+	w.drawHUD(v)
+	w.updateTitle()
+
+	w.renderer.Present()
+	w.pacer.swapped()
+
+	if w.perf != nil {
+		w.perf.record(time.Now(), time.Since(renderStart))
+	}
+}
+
+// prescale renders the frame enlarged by the integer factor with the nearest
+// filter into a texture, which is then scaled to the viewport with the linear
+// one. Returns the texture to be copied to the viewport.
+func (w *Window) prescale(v viewport) *sdl.Texture {
+	if w.scaleFilter != ScaleFilterSharpBilinear || !w.renderer.RenderTargetSupported() {
+		w.destroyPrescaled()
+		return w.texture
+	}
+
+	factor := v.prescaleFactor()
+
+	// The texture is recreated whenever the window size crosses an integer scale.
+	if w.prescaled == nil || w.prescaledBy != factor {
+		w.destroyPrescaled()
+
+		// SDL picks the scaling filter of a texture when it is created.
+		sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "linear")
+		texture, err := w.renderer.CreateTexture(sdl.PIXELFORMAT_ABGR8888, sdl.TEXTUREACCESS_TARGET,
+			ppu.FrameWidth*factor, ppu.FrameHeight*factor)
+		sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "nearest")
+
+		if err != nil {
+			log.Printf("[ERROR] failed to create prescale texture: %s", err)
+			w.scaleFilter = ScaleFilterNearest
+			return w.texture
+		}
+
+		w.prescaled = texture
+		w.prescaledBy = factor
+	}
+
+	_ = w.renderer.SetRenderTarget(w.prescaled)
+	_ = w.renderer.Copy(w.texture, nil, nil)
+	_ = w.renderer.SetRenderTarget(nil)
+
+	return w.prescaled
+}
+
+func (w *Window) destroyPrescaled() {
+	if w.prescaled != nil {
+		_ = w.prescaled.Destroy()
+		w.prescaled = nil
+	}
+}
+
+// SetBezel sets the image drawn around the frame in fullscreen mode, or removes
+// it if nil.
+func (w *Window) SetBezel(b *Bezel) {
+	if w.bezelImage != nil {
+		_ = w.bezelImage.Destroy()
+		w.bezelImage = nil
+	}
+
+	w.bezel = nil
+
+	if b == nil {
+		return
+	}
+
+	width, height := int32(b.Image.Bounds().Dx()), int32(b.Image.Bounds().Dy())
+
+	sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "linear")
+	texture, err := w.renderer.CreateTexture(sdl.PIXELFORMAT_ABGR8888, sdl.TEXTUREACCESS_STATIC, width, height)
+	sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "nearest")
+
+	if err != nil {
+		log.Printf("[ERROR] failed to create bezel texture: %s", err)
+		return
+	}
+
+	if err := texture.Update(nil, unsafe.Pointer(&b.Image.Pix[0]), b.Image.Stride); err != nil {
+		log.Printf("[ERROR] failed to update bezel texture: %s", err)
+		_ = texture.Destroy()
+		return
+	}
+
+	_ = texture.SetBlendMode(sdl.BLENDMODE_BLEND)
+	w.bezel = b
+	w.bezelImage = texture
+}
+
+// activeBezel returns the bezel if it should be drawn, which is only the case
+// in fullscreen mode, as there is no room for it in a window.
+func (w *Window) activeBezel() *Bezel {
+	if w.bezel == nil || w.window.GetFlags()&sdl.WINDOW_FULLSCREEN == 0 {
+		return nil
+	}
+
+	return w.bezel
+}
+
+func (w *Window) drawBezel() {
+	b := w.activeBezel()
+	if b == nil {
+		return
+	}
+
+	width, height, err := w.renderer.GetOutputSize()
+	if err != nil {
+		return
+	}
+
+	area, _ := b.layout(float32(width), float32(height))
+	w.bezelRect = area.rect()
+	_ = w.renderer.Copy(w.bezelImage, nil, &w.bezelRect)
+}
+
+func (w *Window) handleFastForward() {
+	if w.FastForwardDelegate == nil {
+		return
+	}
+
+	// Fast-forward is active for as long as the key is held.
+	if held := w.isKeyDown(sdl.SCANCODE_TAB); held != w.fastForward {
+		w.fastForward = held
+		w.FastForwardDelegate(held)
+	}
+}
+
+// SetMuted sets the initial state of the mute indicator.
+func (w *Window) SetMuted(muted bool) {
+	w.muted = muted
+}
+
+// ChangeVolume adjusts the volume through VolumeDelegate and displays the bar.
+func (w *Window) ChangeVolume(delta float32) {
+	if w.VolumeDelegate == nil {
+		return
+	}
+
+	w.volume = w.VolumeDelegate(delta)
+	w.muted = false // changing the volume unmutes the sound
+	w.volumeShownUntil = sdl.GetTicks64() + volumeBarDuration
+}
+
+func (w *Window) toggleMute() {
+	if w.MuteDelegate != nil {
+		w.muted = w.MuteDelegate()
+	}
+}
+
+func (w *Window) HandleHotKeys() {
+	w.handleFastForward()
+
+	switch {
+	case w.isKeyPressed(sdl.SCANCODE_F12):
+		w.takeScreenshot()
+
+	case w.isKeyPressed(sdl.SCANCODE_F9):
+		if w.RecordDelegate != nil {
+			w.recording = w.RecordDelegate()
+		}
+
+	case w.isKeyPressed(sdl.SCANCODE_F10):
+		if w.GIFDelegate != nil {
+			w.GIFDelegate()
+		}
+
+	case w.isKeyPressed(sdl.SCANCODE_F4):
+		if w.DiskSideDelegate != nil {
+			w.DiskSideDelegate()
+		}
+
+	case w.isKeyPressed(sdl.SCANCODE_F8):
+		w.overlay = (w.overlay + 1) % overlayCount
+		log.Printf("[INFO] overlay: %s", w.overlay)
+
+	case w.isKeyPressed(sdl.SCANCODE_P):
+		if w.PauseDelegate != nil {
+			w.PauseDelegate()
+		}
+
+	case w.isKeyPressed(sdl.SCANCODE_N):
+		if w.paused && w.FrameStepDelegate != nil {
+			w.FrameStepDelegate()
+		}
+
+	case w.isKeyPressed(sdl.SCANCODE_M):
+		w.toggleMute()
+
+	case w.isKeyPressed(sdl.SCANCODE_EQUALS), w.isKeyPressed(sdl.SCANCODE_KP_PLUS):
+		w.ChangeVolume(VolumeStep)
+
+	case w.isKeyPressed(sdl.SCANCODE_MINUS), w.isKeyPressed(sdl.SCANCODE_KP_MINUS):
+		w.ChangeVolume(-VolumeStep)
+
+	case w.isModifierPressed() && w.isKeyPressed(sdl.SCANCODE_Q):
+		w.shouldClose = true
+
+	case w.isModifierPressed() && w.isKeyPressed(sdl.SCANCODE_R):
+		if w.ResetDelegate != nil {
+			w.ResetDelegate()
+		}
+
+	case w.isModifierPressed() && w.isKeyPressed(sdl.SCANCODE_X):
+		if w.ResyncDelegate != nil {
+			w.ResyncDelegate()
+		}
+
+	case w.isModifierPressed() && w.isKeyPressed(sdl.SCANCODE_Z):
+		if w.RewindDelegate != nil {
+			w.RewindDelegate()
+		}
+	}
+}
+
+func (w *Window) UpdateZapper() {
+	if w.ZapperDelegate == nil {
+		return
+	}
+
+	mx, my, state := sdl.GetMouseState()
+	trigger := state&sdl.ButtonLMask() != 0
+	dpi := w.dpiScale()
+
+	x, y, ok := w.viewport().frameCoords(float32(mx)*dpi, float32(my)*dpi)
+	if !ok {
+		w.ZapperDelegate(-1, -1, trigger)
+		return
+	}
+
+	w.ZapperDelegate(x, y, trigger)
+}
+
+// takeScreenshot saves the last frame in its original resolution, without the
+// overlay, since SDL cannot read back the window contents reliably.
+func (w *Window) takeScreenshot() {
+	path, err := saveFrameScreenshot(w.screenshotDir, w.screenshotPrefix, w.frame)
+	if err != nil {
+		log.Printf("[ERROR] failed to save screenshot: %s", err)
+		return
+	}
+
+	log.Printf("[INFO] screenshot saved: %s", path)
+
+	if w.copyScreenshots {
+		copyImageToClipboard(path)
+	}
+}
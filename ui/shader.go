@@ -1,20 +1,24 @@
+//go:build !sdl && !ebiten
+
 package ui
 
 import rl "github.com/gen2brain/raylib-go/raylib"
 
 type shaderFacade struct {
-	shader   rl.Shader
-	timeLoc  int32
-	scaleLoc int32
+	shader        rl.Shader
+	timeLoc       int32
+	scaleLoc      int32
+	resolutionLoc int32
 }
 
 func newShader(code string) *shaderFacade {
 	shader := rl.LoadShaderFromMemory("", code)
 
 	return &shaderFacade{
-		shader:   shader,
-		timeLoc:  rl.GetShaderLocation(shader, "time"),
-		scaleLoc: rl.GetShaderLocation(shader, "scale"),
+		shader:        shader,
+		timeLoc:       rl.GetShaderLocation(shader, "time"),
+		scaleLoc:      rl.GetShaderLocation(shader, "scale"),
+		resolutionLoc: rl.GetShaderLocation(shader, "resolution"),
 	}
 }
 
@@ -37,3 +41,7 @@ func (s *shaderFacade) setTimeUniform(time float32) {
 func (s *shaderFacade) setScaleUniform(scale float32) {
 	rl.SetShaderValue(s.shader, s.scaleLoc, []float32{scale}, rl.ShaderUniformFloat)
 }
+
+func (s *shaderFacade) setResolutionUniform(width, height float32) {
+	rl.SetShaderValue(s.shader, s.resolutionLoc, []float32{width, height}, rl.ShaderUniformVec2)
+}
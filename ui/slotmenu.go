@@ -0,0 +1,195 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	"fmt"
+	"image"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+
+	"github.com/maxpoletaev/dendy/ppu"
+)
+
+const (
+	slotMenuColumns = 3
+	slotMenuPadding = 10
+)
+
+var slotMenuBackground = rl.NewColor(0, 0, 0, 200)
+
+type slotMenu struct {
+	slots    []SaveSlot
+	textures []rl.Texture2D
+	selected int
+}
+
+func (m *slotMenu) unload() {
+	for _, t := range m.textures {
+		if t.ID != 0 {
+			rl.UnloadTexture(t)
+		}
+	}
+}
+
+func loadThumbnail(img image.Image) rl.Texture2D {
+	rlImg := rl.NewImageFromImage(img)
+	defer rl.UnloadImage(rlImg)
+
+	return rl.LoadTextureFromImage(rlImg)
+}
+
+func (w *Window) openSlotMenu() {
+	if w.ListSlotsDelegate == nil {
+		return
+	}
+
+	slots := w.ListSlotsDelegate()
+	if len(slots) == 0 {
+		return
+	}
+
+	menu := &slotMenu{
+		textures: make([]rl.Texture2D, len(slots)),
+		slots:    slots,
+	}
+
+	for i, slot := range slots {
+		if !slot.Empty && slot.Thumbnail != nil {
+			menu.textures[i] = loadThumbnail(slot.Thumbnail)
+		}
+	}
+
+	w.slotMenu = menu
+}
+
+func (w *Window) closeSlotMenu() {
+	if w.slotMenu != nil {
+		w.slotMenu.unload()
+		w.slotMenu = nil
+	}
+}
+
+// refreshSlotMenu reloads the slot list, e.g. after the state has been saved.
+func (w *Window) refreshSlotMenu() {
+	selected := w.slotMenu.selected
+	w.closeSlotMenu()
+	w.openSlotMenu()
+
+	if w.slotMenu != nil {
+		w.slotMenu.selected = selected
+	}
+}
+
+// handleSlotMenuKeys processes the menu navigation. While the menu is open, it
+// takes over the keyboard, so that the other hotkeys are not triggered.
+func (w *Window) handleSlotMenuKeys() {
+	menu := w.slotMenu
+	count := len(menu.slots)
+
+	switch {
+	case rl.IsKeyPressed(rl.KeyF2), rl.IsKeyPressed(rl.KeyEscape):
+		w.closeSlotMenu()
+
+	case rl.IsKeyPressed(rl.KeyRight):
+		menu.selected = (menu.selected + 1) % count
+
+	case rl.IsKeyPressed(rl.KeyLeft):
+		menu.selected = (menu.selected + count - 1) % count
+
+	case rl.IsKeyPressed(rl.KeyDown):
+		if menu.selected+slotMenuColumns < count {
+			menu.selected += slotMenuColumns
+		}
+
+	case rl.IsKeyPressed(rl.KeyUp):
+		if menu.selected-slotMenuColumns >= 0 {
+			menu.selected -= slotMenuColumns
+		}
+
+	case rl.IsKeyPressed(rl.KeyS):
+		if w.SaveSlotDelegate != nil {
+			if err := w.SaveSlotDelegate(menu.selected); err != nil {
+				w.ShowMessage("Failed to save state")
+				return
+			}
+
+			w.ShowMessage("State saved to slot %d", menu.selected+1)
+			w.refreshSlotMenu()
+		}
+
+	case rl.IsKeyPressed(rl.KeyEnter):
+		if w.LoadSlotDelegate != nil && !menu.slots[menu.selected].Empty {
+			if err := w.LoadSlotDelegate(menu.selected); err != nil {
+				w.ShowMessage("Failed to load state")
+				return
+			}
+
+			w.ShowMessage("State loaded from slot %d", menu.selected+1)
+			w.closeSlotMenu()
+		}
+	}
+}
+
+func (w *Window) drawSlotMenu() {
+	var (
+		menu         = w.slotMenu
+		screenWidth  = int32(rl.GetScreenWidth())
+		screenHeight = int32(rl.GetScreenHeight())
+		rows         = int32((len(menu.slots) + slotMenuColumns - 1) / slotMenuColumns)
+	)
+
+	rl.DrawRectangle(0, 0, screenWidth, screenHeight, slotMenuBackground)
+
+	const (
+		titleSize = 20
+		textSize  = 10
+	)
+
+	// Fit the grid into the window, leaving space for the title, the hint
+	// line at the bottom and the caption under every thumbnail.
+	cellWidth := (screenWidth - slotMenuPadding*(slotMenuColumns+1)) / slotMenuColumns
+	cellHeight := (screenHeight - titleSize - textSize - slotMenuPadding*(rows+3)) / rows
+	thumbHeight := min(cellHeight-textSize-4, cellWidth*ppu.FrameHeight/ppu.FrameWidth)
+	thumbWidth := thumbHeight * ppu.FrameWidth / ppu.FrameHeight
+
+	w.drawTextWithShadow("Save States", slotMenuPadding, slotMenuPadding, titleSize, rl.White)
+
+	for i, slot := range menu.slots {
+		col := int32(i % slotMenuColumns)
+		row := int32(i / slotMenuColumns)
+		x := slotMenuPadding + col*(cellWidth+slotMenuPadding) + (cellWidth-thumbWidth)/2
+		y := titleSize + slotMenuPadding*2 + row*(cellHeight+slotMenuPadding)
+
+		thumbRect := rl.Rectangle{
+			X:      float32(x),
+			Y:      float32(y),
+			Width:  float32(thumbWidth),
+			Height: float32(thumbHeight),
+		}
+
+		if texture := menu.textures[i]; texture.ID != 0 {
+			source := rl.Rectangle{Width: float32(texture.Width), Height: float32(texture.Height)}
+			rl.DrawTexturePro(texture, source, thumbRect, rl.Vector2{}, 0, rl.White)
+		} else {
+			rl.DrawRectangleRec(thumbRect, rl.DarkGray)
+		}
+
+		colour := rl.LightGray
+		if i == menu.selected {
+			colour = rl.Yellow
+		}
+
+		rl.DrawRectangleLinesEx(thumbRect, 2, colour)
+
+		caption := fmt.Sprintf("%d: empty", i+1)
+		if !slot.Empty {
+			caption = fmt.Sprintf("%d: %s", i+1, slot.Time.Format("2006-01-02 15:04"))
+		}
+
+		w.drawTextWithShadow(caption, x, y+thumbHeight+4, textSize, colour)
+	}
+
+	hint := "Arrows: select   Enter: load   S: save   F2: close"
+	w.drawTextWithShadow(hint, slotMenuPadding, screenHeight-textSize-slotMenuPadding, textSize, rl.LightGray)
+}
@@ -0,0 +1,83 @@
+package terminal
+
+import (
+	"image/color"
+	"os"
+	"strconv"
+)
+
+// DetectTrueColor reports whether the terminal advertises 24-bit colour support
+// through the COLORTERM environment variable. Other terminals are assumed to
+// support the 256-colour palette, which is available almost everywhere.
+func DetectTrueColor() bool {
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return true
+	default:
+		return false
+	}
+}
+
+// cubeIndex maps a colour component to the closest of the six levels of the
+// xterm colour cube (0, 95, 135, 175, 215, 255).
+func cubeIndex(v uint8) uint8 {
+	switch {
+	case v < 48:
+		return 0
+	case v < 115:
+		return 1
+	default:
+		return (v - 35) / 40
+	}
+}
+
+// to256 returns the closest colour of the xterm 256-colour palette. Shades of
+// grey use the dedicated grayscale ramp, which has finer steps than the cube.
+func to256(c color.RGBA) uint8 {
+	if c.R == c.G && c.G == c.B {
+		switch {
+		case c.R < 8:
+			return 16
+		case c.R > 238:
+			return 231
+		default:
+			return 232 + (c.R-8)/10
+		}
+	}
+
+	return 16 + 36*cubeIndex(c.R) + 6*cubeIndex(c.G) + cubeIndex(c.B)
+}
+
+// cellColor packs the colour into a single value that is compared between
+// frames, so that only the cells that have changed are redrawn.
+func cellColor(c color.RGBA, trueColor bool) uint32 {
+	if trueColor {
+		return uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+	}
+
+	return uint32(to256(c))
+}
+
+// appendColor appends the escape sequence setting the foreground or background
+// colour previously packed with cellColor.
+func appendColor(buf []byte, c uint32, trueColor, background bool) []byte {
+	if background {
+		buf = append(buf, "\x1b[48;"...)
+	} else {
+		buf = append(buf, "\x1b[38;"...)
+	}
+
+	if trueColor {
+		buf = append(buf, "2;"...)
+		buf = strconv.AppendUint(buf, uint64(c>>16&0xFF), 10)
+		buf = append(buf, ';')
+		buf = strconv.AppendUint(buf, uint64(c>>8&0xFF), 10)
+		buf = append(buf, ';')
+		buf = strconv.AppendUint(buf, uint64(c&0xFF), 10)
+	} else {
+		buf = append(buf, "5;"...)
+		buf = strconv.AppendUint(buf, uint64(c), 10)
+	}
+
+	return append(buf, 'm')
+}
@@ -0,0 +1,134 @@
+package terminal
+
+import (
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/maxpoletaev/dendy/input"
+)
+
+// Special keys are represented with values outside the Unicode range.
+const (
+	keyUp rune = unicode.MaxRune + 1 + iota
+	keyDown
+	keyLeft
+	keyRight
+)
+
+const (
+	keyCtrlC = 0x03
+	keyCtrlR = 0x12
+	keyEnter = '\r'
+)
+
+var keyMap = map[rune]input.Button{
+	'w':      input.ButtonUp,
+	's':      input.ButtonDown,
+	'a':      input.ButtonLeft,
+	'd':      input.ButtonRight,
+	keyUp:    input.ButtonUp,
+	keyDown:  input.ButtonDown,
+	keyLeft:  input.ButtonLeft,
+	keyRight: input.ButtonRight,
+	'k':      input.ButtonA,
+	'j':      input.ButtonB,
+	keyEnter: input.ButtonStart,
+	' ':      input.ButtonSelect,
+}
+
+// Pressing a direction releases the opposite one right away, instead of
+// waiting for it to time out.
+var oppositeButtons = map[input.Button]input.Button{
+	input.ButtonUp:    input.ButtonDown,
+	input.ButtonDown:  input.ButtonUp,
+	input.ButtonLeft:  input.ButtonRight,
+	input.ButtonRight: input.ButtonLeft,
+}
+
+// parseKeys splits the raw terminal input into key presses. Only the escape
+// sequences of the arrow keys are recognized, other sequences are dropped.
+func parseKeys(data []byte) []rune {
+	var keys []rune
+
+	for len(data) > 0 {
+		if data[0] == 0x1b {
+			if len(data) >= 3 && (data[1] == '[' || data[1] == 'O') {
+				switch data[2] {
+				case 'A':
+					keys = append(keys, keyUp)
+				case 'B':
+					keys = append(keys, keyDown)
+				case 'C':
+					keys = append(keys, keyRight)
+				case 'D':
+					keys = append(keys, keyLeft)
+				}
+
+				data = data[3:]
+				continue
+			}
+
+			data = data[1:]
+			continue
+		}
+
+		r, size := utf8.DecodeRune(data)
+		keys = append(keys, unicode.ToLower(r))
+		data = data[size:]
+	}
+
+	return keys
+}
+
+// keyboard keeps track of the joystick buttons. Terminals only report key
+// presses (repeated while the key is held), but not releases, so a button is
+// considered held for some time after the last press.
+type keyboard struct {
+	mut       sync.Mutex
+	holdTime  time.Duration
+	pressedAt map[input.Button]time.Time
+}
+
+func newKeyboard(holdTime time.Duration) *keyboard {
+	return &keyboard{
+		holdTime:  holdTime,
+		pressedAt: make(map[input.Button]time.Time),
+	}
+}
+
+// press registers a key press and returns false if the key is not mapped to a
+// joystick button.
+func (k *keyboard) press(key rune, now time.Time) bool {
+	button, ok := keyMap[key]
+	if !ok {
+		return false
+	}
+
+	k.mut.Lock()
+	defer k.mut.Unlock()
+
+	k.pressedAt[button] = now
+
+	if opposite, ok := oppositeButtons[button]; ok {
+		delete(k.pressedAt, opposite)
+	}
+
+	return true
+}
+
+func (k *keyboard) buttons(now time.Time) uint8 {
+	k.mut.Lock()
+	defer k.mut.Unlock()
+
+	var buttons uint8
+
+	for button, t := range k.pressedAt {
+		if now.Sub(t) < k.holdTime {
+			buttons |= button
+		}
+	}
+
+	return buttons
+}
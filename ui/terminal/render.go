@@ -0,0 +1,118 @@
+package terminal
+
+import (
+	"image/color"
+	"strconv"
+
+	"github.com/maxpoletaev/dendy/ppu"
+)
+
+// upperHalfBlock is drawn with the foreground colour set to the upper pixel and
+// the background colour set to the lower one, so each character cell displays
+// two vertically stacked pixels.
+const upperHalfBlock = "▀"
+
+type cell struct {
+	fg, bg uint32
+}
+
+// renderer converts frames into escape sequences. It remembers the previously
+// drawn cells and only redraws the ones that have changed, which keeps the
+// output small enough to be played over SSH.
+type renderer struct {
+	trueColor bool
+	cols      int
+	rows      int
+	width     int // picture width in cells
+	height    int // picture height in cells
+	offsetX   int
+	offsetY   int
+	cells     []cell
+	valid     bool
+	buf       []byte
+}
+
+// resize fits the picture into the terminal of the given size, keeping the
+// aspect ratio. Returns true if the layout has changed.
+func (r *renderer) resize(cols, rows int) bool {
+	if cols == r.cols && rows == r.rows {
+		return false
+	}
+
+	scale := min(float64(cols)/ppu.FrameWidth, float64(rows*2)/ppu.FrameHeight)
+
+	r.cols, r.rows = cols, rows
+	r.width = max(1, int(ppu.FrameWidth*scale))
+	r.height = max(1, int(ppu.FrameHeight*scale)/2)
+	r.offsetX = max(0, (cols-r.width)/2)
+	r.offsetY = max(0, (rows-r.height)/2)
+	r.cells = make([]cell, r.width*r.height)
+	r.valid = false
+
+	return true
+}
+
+func (r *renderer) moveTo(x, y int) {
+	r.buf = append(r.buf, "\x1b["...)
+	r.buf = strconv.AppendInt(r.buf, int64(r.offsetY+y+1), 10)
+	r.buf = append(r.buf, ';')
+	r.buf = strconv.AppendInt(r.buf, int64(r.offsetX+x+1), 10)
+	r.buf = append(r.buf, 'H')
+}
+
+// render returns the output that updates the terminal to display the frame.
+// The returned slice is only valid until the next call.
+func (r *renderer) render(frame []color.RGBA) []byte {
+	r.buf = r.buf[:0]
+
+	if !r.valid {
+		r.buf = append(r.buf, "\x1b[0m\x1b[2J"...)
+	}
+
+	var (
+		cursorX, cursorY = -1, -1
+		fg, bg           = ^uint32(0), ^uint32(0)
+	)
+
+	for y := 0; y < r.height; y++ {
+		topY := (2 * y) * ppu.FrameHeight / (2 * r.height)
+		bottomY := (2*y + 1) * ppu.FrameHeight / (2 * r.height)
+
+		for x := 0; x < r.width; x++ {
+			frameX := x * ppu.FrameWidth / r.width
+
+			c := cell{
+				fg: cellColor(frame[topY*ppu.FrameWidth+frameX], r.trueColor),
+				bg: cellColor(frame[bottomY*ppu.FrameWidth+frameX], r.trueColor),
+			}
+
+			i := y*r.width + x
+			if r.valid && r.cells[i] == c {
+				continue
+			}
+
+			r.cells[i] = c
+
+			if cursorX != x || cursorY != y {
+				r.moveTo(x, y)
+			}
+
+			if c.fg != fg {
+				r.buf = appendColor(r.buf, c.fg, r.trueColor, false)
+				fg = c.fg
+			}
+
+			if c.bg != bg {
+				r.buf = appendColor(r.buf, c.bg, r.trueColor, true)
+				bg = c.bg
+			}
+
+			r.buf = append(r.buf, upperHalfBlock...)
+			cursorX, cursorY = x+1, y
+		}
+	}
+
+	r.valid = true
+
+	return r.buf
+}
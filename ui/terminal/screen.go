@@ -0,0 +1,201 @@
+// Package terminal implements a frontend that draws the frames in a terminal
+// using half-block characters and ANSI colours, so the emulator can be played
+// over SSH. There is no sound, and the keyboard is read in the raw mode.
+package terminal
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/maxpoletaev/dendy/ppu"
+)
+
+const defaultHoldTime = 150 * time.Millisecond
+
+type Options struct {
+	// TrueColor enables 24-bit colours. Otherwise, the colours are reduced to
+	// the 256-colour palette.
+	TrueColor bool
+
+	// HoldTime is how long a button stays pressed after the key press was
+	// reported by the terminal. It should be longer than the key repeat
+	// interval of the terminal.
+	HoldTime time.Duration
+}
+
+// Screen is a terminal frontend. Its API resembles ui.Window, and is supposed
+// to be used from the emulation loop in the same way.
+type Screen struct {
+	InputDelegate func(buttons uint8)
+	PauseDelegate func()
+	ResetDelegate func()
+
+	in       *os.File
+	out      *os.File
+	oldState *term.State
+	keyboard *keyboard
+	hotkeys  chan rune
+	frames   chan []color.RGBA
+	free     chan []color.RGBA
+	wg       sync.WaitGroup
+	closing  atomic.Bool
+	renderer renderer
+}
+
+// Open switches the terminal into the raw mode and the alternate screen
+// buffer. The original state is restored by Close.
+func Open(opts Options) (*Screen, error) {
+	in, out := os.Stdin, os.Stdout
+
+	if !term.IsTerminal(int(in.Fd())) || !term.IsTerminal(int(out.Fd())) {
+		return nil, fmt.Errorf("stdin and stdout must be a terminal")
+	}
+
+	oldState, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to enter raw mode: %w", err)
+	}
+
+	if opts.HoldTime == 0 {
+		opts.HoldTime = defaultHoldTime
+	}
+
+	s := &Screen{
+		in:       in,
+		out:      out,
+		oldState: oldState,
+		keyboard: newKeyboard(opts.HoldTime),
+		hotkeys:  make(chan rune, 16),
+		frames:   make(chan []color.RGBA, 1),
+		free:     make(chan []color.RGBA, 2),
+		renderer: renderer{trueColor: opts.TrueColor},
+	}
+
+	// Two buffers are enough: one is being drawn while the other is filled.
+	for i := 0; i < cap(s.free); i++ {
+		s.free <- make([]color.RGBA, ppu.FrameWidth*ppu.FrameHeight)
+	}
+
+	// Alternate screen buffer, hidden cursor.
+	_, _ = out.WriteString("\x1b[?1049h\x1b[?25l")
+
+	s.wg.Add(1)
+	go s.drawLoop()
+
+	// The input loop is not waited for, as it is blocked reading stdin.
+	go s.inputLoop()
+
+	return s, nil
+}
+
+// Close restores the terminal to its original state.
+func (s *Screen) Close() {
+	s.closing.Store(true)
+	close(s.frames)
+	s.wg.Wait()
+
+	_, _ = s.out.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+
+	if err := term.Restore(int(s.in.Fd()), s.oldState); err != nil {
+		log.Printf("[ERROR] failed to restore terminal: %s", err)
+	}
+}
+
+func (s *Screen) inputLoop() {
+	buf := make([]byte, 64)
+
+	for {
+		n, err := s.in.Read(buf)
+		if err != nil {
+			s.closing.Store(true)
+			return
+		}
+
+		now := time.Now()
+
+		for _, key := range parseKeys(buf[:n]) {
+			if s.keyboard.press(key, now) {
+				continue
+			}
+
+			select {
+			case s.hotkeys <- key:
+			default:
+			}
+		}
+	}
+}
+
+func (s *Screen) drawLoop() {
+	defer s.wg.Done()
+
+	for frame := range s.frames {
+		cols, rows, err := term.GetSize(int(s.out.Fd()))
+		if err == nil {
+			s.renderer.resize(cols, rows)
+		}
+
+		if _, err := s.out.Write(s.renderer.render(frame)); err != nil {
+			log.Printf("[ERROR] failed to draw frame: %s", err)
+		}
+
+		s.free <- frame
+	}
+}
+
+// Refresh draws the frame in background. If the terminal cannot keep up, for
+// example over a slow connection, the frame is dropped.
+func (s *Screen) Refresh(frame []color.RGBA) {
+	select {
+	case buf := <-s.free:
+		copy(buf, frame)
+		s.frames <- buf
+	default:
+	}
+}
+
+// ShouldClose returns true once Ctrl+C or Q was pressed.
+func (s *Screen) ShouldClose() bool {
+	return s.closing.Load()
+}
+
+func (s *Screen) UpdateJoystick() {
+	if s.InputDelegate != nil {
+		s.InputDelegate(s.keyboard.buttons(time.Now()))
+	}
+}
+
+func (s *Screen) HandleHotKeys() {
+	for {
+		select {
+		case key := <-s.hotkeys:
+			s.handleHotKey(key)
+		default:
+			return
+		}
+	}
+}
+
+func (s *Screen) handleHotKey(key rune) {
+	switch key {
+	case keyCtrlC, 'q':
+		s.closing.Store(true)
+
+	case 'p':
+		if s.PauseDelegate != nil {
+			s.PauseDelegate()
+		}
+
+	case keyCtrlR:
+		if s.ResetDelegate != nil {
+			s.ResetDelegate()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+//go:build !sdl && !ebiten
+
+package ui
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	volumeBarDuration = 1.5 // seconds
+	volumeBarWidth    = 100
+	volumeBarHeight   = 6
+)
+
+// SetMuted sets the initial state of the mute indicator.
+func (w *Window) SetMuted(muted bool) {
+	w.muted = muted
+}
+
+// ChangeVolume adjusts the volume through VolumeDelegate and displays the bar.
+func (w *Window) ChangeVolume(delta float32) {
+	if w.VolumeDelegate == nil {
+		return
+	}
+
+	w.volume = w.VolumeDelegate(delta)
+	w.muted = false // changing the volume unmutes the sound
+	w.volumeShownUntil = rl.GetTime() + volumeBarDuration
+}
+
+func (w *Window) toggleMute() {
+	if w.MuteDelegate == nil {
+		return
+	}
+
+	w.muted = w.MuteDelegate()
+
+	if w.muted {
+		w.ShowMessage("Muted")
+	} else {
+		w.ShowMessage("Unmuted")
+	}
+}
+
+// drawVolume displays the volume bar for a short time after the volume has
+// been changed, and a permanent indicator in the corner while muted.
+func (w *Window) drawVolume() {
+	screenWidth := int32(rl.GetScreenWidth()) - w.dockWidth()
+	screenHeight := int32(rl.GetScreenHeight())
+
+	if w.muted {
+		w.drawTextWithShadow("MUTE", screenWidth-40, screenHeight-15, 10, rl.White)
+	}
+
+	if rl.GetTime() > w.volumeShownUntil {
+		return
+	}
+
+	x := screenWidth/2 - volumeBarWidth/2
+	y := screenHeight - volumeBarHeight - 20
+	filled := int32(w.volume * volumeBarWidth)
+
+	label := w.volumeText.format(int(w.volume*100 + 0.5))
+	labelWidth := rl.MeasureText(label, 10)
+	w.drawTextWithShadow(label, screenWidth/2-labelWidth/2, y-14, 10, rl.White)
+
+	rl.DrawRectangle(x, y, volumeBarWidth, volumeBarHeight, rl.DarkGray)
+	rl.DrawRectangle(x, y, filled, volumeBarHeight, rl.White)
+}
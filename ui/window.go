@@ -1,79 +1,224 @@
+//go:build !sdl && !ebiten
+
 package ui
 
 import (
 	"image/color"
 	"log"
-	"strconv"
+	"math"
+	"time"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 
+	"github.com/maxpoletaev/dendy/cheats"
+	"github.com/maxpoletaev/dendy/input"
 	"github.com/maxpoletaev/dendy/ppu"
-	"github.com/maxpoletaev/dendy/shaders"
+	"github.com/maxpoletaev/dendy/ramwatch"
 )
 
-func toGrayscale(c color.RGBA) color.RGBA {
-	gray := uint8(float64(c.R)*0.3 + float64(c.G)*0.59 + float64(c.B)*0.11)
-	return color.RGBA{R: gray, G: gray, B: gray, A: c.A}
+type Window struct {
+	ZapperDelegate      func(x, y int, trigger bool)
+	InputDelegate       func(buttons uint8)
+	MicrophoneDelegate  func(on bool)
+	MuteDelegate        func() bool
+	VolumeDelegate      func(delta float32) float32
+	ResyncDelegate      func()
+	ResetDelegate       func()
+	RewindDelegate      func()
+	FastForwardDelegate func(enabled bool)
+	PauseDelegate       func()
+	FrameStepDelegate   func()
+	ListSlotsDelegate   func() []SaveSlot
+	SaveSlotDelegate    func(slot int) error
+	LoadSlotDelegate    func(slot int) error
+	RecordDelegate      func() bool
+	MenuDelegate        func() []MenuItem
+	GIFDelegate         func()
+	PPUDelegate         func() *ppu.PPU
+	DiskSideDelegate    func() // switches the side of the FDS disk
+	MemorySpaces        []MemorySpace
+	CheatSearch         *cheats.Search
+	FreezeDelegate      func(addr uint16, value uint8)
+	RAMWatch            *ramwatch.List
+	RAMWatchDelegate    func() // called when the watches are changed, to save them
+	RegistersDelegate   func() []string
+	ShowPing            bool
+	ShowFPS             bool
+	ShowPerf            bool
+	FPS                 int
+
+	micKey          int32
+	keyMap          map[int32]input.Button
+	viewport        rl.RenderTexture2D
+	shader          *shaderFacade
+	overlay         Overlay
+	overlayTextures overlayTextures
+	bezel           *Bezel
+	bezelTexture    rl.Texture2D
+	hudLayout       HUDLayout
+	remotePing      int64
+	shouldClose     bool
+	grayscale       bool
+	scale           int
+	scaleMode       ScaleMode
+	scaleFilter     ScaleFilter
+	prescaled       rl.RenderTexture2D
+	pixelAspect     bool
+	vsync           bool
+	pacer           framePacer
+	fastForward     bool
+	paused          bool
+	recording       bool
+	muted           bool
+	volume          float32
+	slotMenu        *slotMenu
+	memView         *memViewer
+	memViewDocked   bool // whether the memory viewer is opened docked
+	cheatView       *cheatSearchView
+	watchView       *ramWatchEditor
+	watchShown      bool
+	showRegisters   bool
+	menu            *settingsMenu
+	ppuView         *ppuViewer
+	messages        []osdMessage
+	frame           []color.RGBA
+
+	// Reused on every frame to draw the HUD without allocating.
+	hudTexts      []hudText
+	hudPlacements []hudPlacement
+	fpsText       numberText
+	pingText      numberText
+	volumeText    numberText
+	perfRects     []perfRect
+	perf          *perfStats
+
+	volumeShownUntil float64
+	gamepadConnected bool
+	backgroundInput  bool
+
+	screenshotDir    string
+	screenshotPrefix string
+	copyScreenshots  bool
 }
 
-type Window struct {
-	ZapperDelegate func(brightness uint8, trigger bool)
-	InputDelegate  func(buttons uint8)
-	MuteDelegate   func()
-	ResyncDelegate func()
-	ResetDelegate  func()
-	RewindDelegate func()
-	ShowPing       bool
-	ShowFPS        bool
-	FPS            int
-
-	viewport    rl.RenderTexture2D
-	shader      *shaderFacade
-	remotePing  int64
-	shouldClose bool
-	grayscale   bool
-	scale       int
-	width       int
-	height      int
-}
-
-func CreateWindow(scale int, verbose bool) *Window {
-	if !verbose {
+// Run calls the main function of the program. Raylib must be used from the
+// main thread, which is already locked by raylib-go, so the function is simply
+// called in place.
+func Run(main func()) {
+	main()
+}
+
+func CreateWindow(opts WindowOptions) *Window {
+	if !opts.Verbose {
 		rl.SetTraceLogLevel(rl.LogWarning)
 	}
 
-	windowWidth := ppu.FrameWidth * scale
-	windowHeight := ppu.FrameHeight * scale
+	frameWidth := float64(ppu.FrameWidth)
+	if opts.PixelAspect {
+		frameWidth *= pixelAspect87
+	}
+
+	windowWidth := int(math.Round(frameWidth * float64(opts.Scale)))
+	windowHeight := ppu.FrameHeight * opts.Scale
 
+	// With the high-DPI flag, the window is sized according to the display
+	// scaling and the framebuffer has the native resolution of the screen,
+	// rather than being upscaled by the system and looking blurry.
+	var flags uint32 = rl.FlagWindowResizable | rl.FlagWindowHighdpi
+	if opts.VSync {
+		flags |= rl.FlagVsyncHint
+	}
+
+	rl.SetConfigFlags(flags)
 	rl.InitWindow(int32(windowWidth), int32(windowHeight), "Dendy Emulator")
+	rl.SetWindowMinSize(ppu.FrameWidth, ppu.FrameHeight)
 	rl.SetExitKey(0) // disable exit on ESC
 
+	if opts.Fullscreen {
+		monitor := rl.GetCurrentMonitor()
+		rl.SetWindowSize(rl.GetMonitorWidth(monitor), rl.GetMonitorHeight(monitor))
+		rl.ToggleFullscreen()
+	}
+
 	viewport := rl.LoadRenderTexture(ppu.FrameWidth, ppu.FrameHeight)
 	rl.SetTextureFilter(viewport.Texture, rl.FilterPoint)
 
+	keyMap := make(map[int32]input.Button, len(defaultKeyMap))
+	for key, button := range defaultKeyMap {
+		keyMap[key] = button
+	}
+
 	return &Window{
-		viewport: viewport,
-		scale:    scale,
-		width:    windowWidth,
-		height:   windowHeight,
+		micKey:          defaultMicKey,
+		keyMap:          keyMap,
+		viewport:        viewport,
+		overlayTextures: loadOverlayTextures(),
+		scale:           opts.Scale,
+		scaleMode:       opts.ScaleMode,
+		scaleFilter:     opts.Filter,
+		pixelAspect:     opts.PixelAspect,
+		vsync:           opts.VSync,
+		overlay:         opts.Overlay,
+		hudLayout:       opts.HUD,
+		backgroundInput: opts.BackgroundInput,
+		fpsText:         numberText{suffix: " fps"},
+		pingText:        numberText{suffix: " ms"},
+		volumeText:      numberText{prefix: "Volume ", suffix: "%"},
+
+		screenshotDir:    opts.ScreenshotDir,
+		screenshotPrefix: opts.ScreenshotPrefix,
+		copyScreenshots:  opts.CopyScreenshots,
 	}
 }
 
-func (w *Window) EnableCRT() {
+// EnableShader compiles the given GLSL fragment shader and applies it when
+// drawing the frame. The shader receives the standard raylib inputs along with
+// the time, scale and resolution uniforms.
+func (w *Window) EnableShader(code string) {
 	if w.scale == 1 {
-		log.Printf("[WARN] CRT effect cannot be used with scale 1 (not enough pixels)")
-		return
+		log.Printf("[WARN] shader effects are disabled until the window is at least 2x the original size")
+	}
+
+	if w.shader != nil {
+		w.shader.unload()
 	}
 
-	w.shader = newShader(shaders.ScanlineFragment)
+	w.shader = newShader(code)
+}
+
+// DisableShader removes the shader effect enabled with EnableShader.
+func (w *Window) DisableShader() {
+	if w.shader != nil {
+		w.shader.unload()
+		w.shader = nil
+	}
+}
+
+// SetScaleMode changes how the frame is fitted into the window.
+func (w *Window) SetScaleMode(mode ScaleMode) {
+	w.scaleMode = mode
+}
+
+// SetScaleFilter changes how the frame pixels are interpolated when scaled.
+func (w *Window) SetScaleFilter(f ScaleFilter) {
+	w.scaleFilter = f
+}
+
+// SetPixelAspect enables or disables the 8:7 pixel aspect ratio correction.
+func (w *Window) SetPixelAspect(enabled bool) {
+	w.pixelAspect = enabled
 }
 
 func (w *Window) SetTitle(title string) {
 	rl.SetWindowTitle(title)
 }
 
-func (w *Window) SetFrameRate(fps int) {
-	rl.SetTargetFPS(int32(fps))
+// SetFrameRate limits the number of frames per second. The frames are paced by
+// the window rather than by raylib, since raylib only supports whole frame rates.
+func (w *Window) SetFrameRate(fps float64) {
+	w.pacer.setFrameRate(fps, w.vsync, func() (float64, error) {
+		return float64(rl.GetMonitorRefreshRate(rl.GetCurrentMonitor())), nil
+	})
 }
 
 func (w *Window) SetGrayscale(grayscale bool) {
@@ -85,7 +230,12 @@ func (w *Window) Close() {
 		w.shader.unload()
 	}
 
+	w.closeSlotMenu()
+	w.closePPUView()
+	w.overlayTextures.unload()
+	w.SetBezel(nil)
 	rl.UnloadRenderTexture(w.viewport)
+	w.unloadPrescaled()
 	rl.CloseWindow()
 }
 
@@ -97,6 +247,24 @@ func (w *Window) SetPingInfo(pingMs int64) {
 	w.remotePing = pingMs
 }
 
+// SetFrameTimes reports the time spent emulating the frame about to be shown
+// and replaying the netplay rollbacks, for the performance HUD.
+func (w *Window) SetFrameTimes(emulation, rollback time.Duration) {
+	if w.perf != nil {
+		w.perf.report(emulation, rollback)
+	}
+}
+
+// SetRecording controls whether the recording indicator is displayed.
+func (w *Window) SetRecording(recording bool) {
+	w.recording = recording
+}
+
+// SetPaused controls whether the pause message is displayed on top of the frame.
+func (w *Window) SetPaused(paused bool) {
+	w.paused = paused
+}
+
 func (w *Window) drawTextWithShadow(text string, x int32, y int32, size int32, colour rl.Color) {
 	rl.DrawText(text, x+1, y+1, size, rl.Black)
 	rl.DrawText(text, x, y, size, colour)
@@ -109,13 +277,121 @@ func (w *Window) updateTexture(ppuFrame []color.RGBA) {
 		}
 	}
 
+	w.frame = ppuFrame
 	rl.UpdateTexture(w.viewport.Texture, ppuFrame)
 }
 
-func (w *Window) drawScreen() {
-	if w.shader != nil {
+// dpiScale returns the number of physical pixels per window coordinate, e.g. 2
+// on retina screens. Raylib draws in the window coordinates and scales them to
+// the framebuffer on its own.
+func (w *Window) dpiScale() float32 {
+	if scale := rl.GetWindowScaleDPI().X; scale > 0 {
+		return scale
+	}
+
+	return 1
+}
+
+// screenViewport returns the area of the window the frame is drawn to, in the
+// window coordinates, beside the docked debug panel if any. It is fitted in the
+// physical pixels, so that the integer scaling remains integer on high-DPI
+// screens with fractional scaling.
+func (w *Window) screenViewport() viewport {
+	dpi := w.dpiScale()
+	width := float32(rl.GetScreenWidth()-int(w.dockWidth())) * dpi
+	height := float32(rl.GetScreenHeight()) * dpi
+
+	return fitBezelViewport(w.activeBezel(), width, height, w.scaleMode, w.pixelAspect).scaled(1 / dpi)
+}
+
+// viewportRect returns the area of the window the frame is drawn to. The window
+// can be resized at any time, so the rectangle is recalculated on every frame.
+func (w *Window) viewportRect() rl.Rectangle {
+	v := w.screenViewport()
+
+	return rl.Rectangle{
+		X:      v.x,
+		Y:      v.y,
+		Width:  v.width,
+		Height: v.height,
+	}
+}
+
+// prescale renders the frame enlarged by the integer factor with the nearest
+// filter into a texture, which is then scaled to the viewport with the bilinear
+// one. Must be called outside of BeginDrawing, as ending the texture mode resets
+// the screen projection. Returns false if the filter is not needed.
+func (w *Window) prescale() bool {
+	dpi := w.dpiScale()
+	factor := w.screenViewport().scaled(dpi).prescaleFactor()
+
+	if w.scaleFilter != ScaleFilterSharpBilinear || (w.shader != nil && factor >= 2) {
+		w.unloadPrescaled()
+		return false
+	}
+
+	// The texture is recreated whenever the window size crosses an integer scale.
+	if w.prescaled.ID == 0 || w.prescaled.Texture.Height != ppu.FrameHeight*factor {
+		w.unloadPrescaled()
+		w.prescaled = rl.LoadRenderTexture(ppu.FrameWidth*factor, ppu.FrameHeight*factor)
+		rl.SetTextureFilter(w.prescaled.Texture, rl.FilterBilinear)
+	}
+
+	rl.BeginTextureMode(w.prescaled)
+	rl.DrawTexturePro(
+		w.viewport.Texture,
+		rl.Rectangle{
+			Width:  float32(w.viewport.Texture.Width),
+			Height: float32(w.viewport.Texture.Height),
+		},
+		rl.Rectangle{
+			Width:  float32(w.prescaled.Texture.Width),
+			Height: float32(w.prescaled.Texture.Height),
+		},
+		rl.Vector2{},
+		0,
+		rl.White,
+	)
+	rl.EndTextureMode()
+
+	return true
+}
+
+func (w *Window) unloadPrescaled() {
+	if w.prescaled.ID != 0 {
+		rl.UnloadRenderTexture(w.prescaled)
+		w.prescaled = rl.RenderTexture2D{}
+	}
+}
+
+func (w *Window) drawScreen(prescaled bool) {
+	dest := w.viewportRect()
+	dpi := w.dpiScale()
+
+	if prescaled {
+		// Render textures are stored upside down, hence the negative height.
+		rl.DrawTexturePro(
+			w.prescaled.Texture,
+			rl.Rectangle{
+				Width:  float32(w.prescaled.Texture.Width),
+				Height: -float32(w.prescaled.Texture.Height),
+			},
+			dest,
+			rl.Vector2{},
+			0,
+			rl.White,
+		)
+
+		return
+	}
+
+	// Shader effects need at least two screen pixels per NES pixel to look
+	// right, which may not be the case when the window is shrunk. The shader
+	// runs on the physical pixels, so the uniforms include the DPI scale.
+	if w.shader != nil && dest.Height*dpi >= 2*ppu.FrameHeight {
 		w.shader.setTimeUniform(float32(rl.GetTime()))
-		w.shader.setScaleUniform(float32(w.scale))
+		w.shader.setScaleUniform(dest.Height * dpi / ppu.FrameHeight)
+		w.shader.setResolutionUniform(dest.Width*dpi, dest.Height*dpi)
 
 		w.shader.begin()
 		defer w.shader.end()
@@ -127,10 +403,7 @@ func (w *Window) drawScreen() {
 			Width:  float32(w.viewport.Texture.Width),
 			Height: float32(w.viewport.Texture.Height),
 		},
-		rl.Rectangle{
-			Width:  float32(w.width),
-			Height: float32(w.height),
-		},
+		dest,
 		rl.Vector2{
 			X: 0,
 			Y: 0,
@@ -141,17 +414,25 @@ func (w *Window) drawScreen() {
 }
 
 func (w *Window) drawHUD() {
-	var offsetY int32
+	screenWidth := int32(rl.GetScreenWidth()) - w.dockWidth()
+	screenHeight := int32(rl.GetScreenHeight())
+
+	if w.recording {
+		rl.DrawCircle(screenWidth-10, 10, 4, rl.Red)
+	}
+
+	texts := w.hudTexts[:0]
 
 	if w.ShowFPS {
-		textY := offsetY + 5
-		fpsText := strconv.Itoa(int(rl.GetFPS())) + " fps"
-		w.drawTextWithShadow(fpsText, 6, textY, 10, rl.White)
-		offsetY += 10
+		fpsText := w.fpsText.format(int(rl.GetFPS()))
+		texts = append(texts, hudText{name: HUDFPS, text: fpsText, colour: rl.White})
+	}
+
+	if w.fastForward {
+		texts = append(texts, hudText{name: HUDFastForward, text: ">>", colour: rl.White})
 	}
 
 	if w.ShowPing && w.remotePing > 0 {
-		textY := offsetY + 5
 		colour := rl.Green
 
 		if w.remotePing > 150 {
@@ -160,21 +441,102 @@ func (w *Window) drawHUD() {
 			colour = rl.Yellow
 		}
 
-		pingText := strconv.Itoa(int(w.remotePing)) + " ms"
-		w.drawTextWithShadow(pingText, 6, textY, 10, colour)
+		pingText := w.pingText.format(int(w.remotePing))
+		texts = append(texts, hudText{name: HUDPing, text: pingText, colour: colour})
+	}
+
+	if w.ShowPerf && w.perf != nil {
+		w.drawPerf(screenWidth)
+	}
+
+	w.hudTexts = texts
+	w.hudPlacements = placeHUD(w.hudPlacements[:0], w.hudLayout, texts, screenWidth, screenHeight, rl.MeasureText)
+
+	for _, p := range w.hudPlacements {
+		w.drawTextWithShadow(p.text, p.x, p.y, p.size, p.colour)
+	}
+}
+
+func (w *Window) drawPerf(screenWidth int32) {
+	rects, x, y := w.perf.graph(w.perfRects[:0], screenWidth)
+	w.perfRects = rects
+
+	for _, r := range rects {
+		rl.DrawRectangle(r.x, r.y, r.width, r.height, r.colour)
+	}
+
+	for i, line := range w.perf.text() {
+		w.drawTextWithShadow(line, x, y+int32(i)*12, 10, rl.White)
 	}
 }
 
+func (w *Window) drawPauseMessage() {
+	const (
+		text     = "PAUSED"
+		fontSize = 20
+	)
+
+	rect := w.viewportRect()
+	textWidth := rl.MeasureText(text, fontSize)
+	x := int32(rect.X+rect.Width/2) - textWidth/2
+	y := int32(rect.Y+rect.Height/2) - fontSize/2
+
+	w.drawTextWithShadow(text, x, y, fontSize, rl.White)
+}
+
 func (w *Window) Refresh(ppuFrame []color.RGBA) {
+	// Waiting before drawing rather than after lets raylib poll the input right
+	// before the next frame is emulated.
+	w.pacer.wait()
+	renderStart := time.Now()
+
+	if w.ShowPerf && w.perf == nil {
+		w.perf = newPerfStats()
+	}
+
 	w.updateTexture(ppuFrame)
+	prescaled := w.prescale()
 
 	rl.BeginDrawing()
 	rl.ClearBackground(rl.Black)
 
-	w.drawScreen()
+	w.drawScreen(prescaled)
+	w.drawOverlay(w.viewportRect())
+	w.drawBezel()
 	w.drawHUD()
 
+	if w.watchShown && w.watchView == nil {
+		w.drawRAMWatch()
+	}
+
+	if w.showRegisters {
+		w.drawRegisters()
+	}
+
+	w.drawMessages()
+	w.drawVolume()
+	w.drawPPUView()
+
+	if w.menu != nil {
+		w.drawMenu()
+	} else if w.slotMenu != nil {
+		w.drawSlotMenu()
+	} else if w.memView != nil {
+		w.drawMemView()
+	} else if w.cheatView != nil {
+		w.drawCheatSearch()
+	} else if w.watchView != nil {
+		w.drawRAMWatchEditor()
+	} else if w.paused {
+		w.drawPauseMessage()
+	}
+
 	rl.EndDrawing()
+	w.pacer.swapped()
+
+	if w.perf != nil {
+		w.perf.record(time.Now(), time.Since(renderStart))
+	}
 }
 
 func (w *Window) InFocus() bool {
@@ -187,16 +549,125 @@ func (w *Window) isModifierPressed() bool {
 	return super || ctrl
 }
 
+func (w *Window) isShiftPressed() bool {
+	return rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift)
+}
+
+func (w *Window) handleFastForward() {
+	if w.FastForwardDelegate == nil {
+		return
+	}
+
+	// Fast-forward is active for as long as the key is held.
+	if held := rl.IsKeyDown(rl.KeyTab); held != w.fastForward {
+		w.fastForward = held
+		w.FastForwardDelegate(held)
+	}
+}
+
 func (w *Window) HandleHotKeys() {
+	if w.menu != nil {
+		w.handleMenuKeys()
+		return
+	}
+
+	if w.slotMenu != nil {
+		w.handleSlotMenuKeys()
+		return
+	}
+
+	if w.memView != nil {
+		w.handleMemViewKeys()
+		return
+	}
+
+	if w.cheatView != nil {
+		w.handleCheatSearchKeys()
+		return
+	}
+
+	if w.watchView != nil {
+		w.handleRAMWatchKeys()
+		return
+	}
+
+	w.handleFastForward()
+	w.handlePPUViewMouse()
+
 	switch {
+	case rl.IsKeyPressed(rl.KeyEscape):
+		w.openMenu()
+
+	case rl.IsKeyPressed(rl.KeyF2):
+		w.openSlotMenu()
+
+	case rl.IsKeyPressed(rl.KeyF12) && w.isShiftPressed():
+		w.takeFrameScreenshot()
+
 	case rl.IsKeyPressed(rl.KeyF12):
-		rl.TakeScreenshot("screenshot.png")
+		w.takeScreenshot()
 
-	case rl.IsKeyPressed(rl.KeyM):
-		if w.MuteDelegate != nil {
-			w.MuteDelegate()
+	case rl.IsKeyPressed(rl.KeyF9):
+		if w.RecordDelegate != nil {
+			w.recording = w.RecordDelegate()
+		}
+
+	case rl.IsKeyPressed(rl.KeyF10):
+		if w.GIFDelegate != nil {
+			w.GIFDelegate()
 		}
 
+	case rl.IsKeyPressed(rl.KeyF11):
+		w.cyclePPUView()
+
+	case rl.IsKeyPressed(rl.KeyF4):
+		if w.DiskSideDelegate != nil {
+			w.DiskSideDelegate()
+		}
+
+	case rl.IsKeyPressed(rl.KeyF3):
+		w.toggleRegisters()
+
+	case rl.IsKeyPressed(rl.KeyF5) && w.isShiftPressed():
+		w.openRAMWatch()
+
+	case rl.IsKeyPressed(rl.KeyF5):
+		w.toggleRAMWatch()
+
+	case rl.IsKeyPressed(rl.KeyF6):
+		w.openCheatSearch()
+
+	case rl.IsKeyPressed(rl.KeyF7) && w.isShiftPressed():
+		w.memViewDocked = true
+		w.openMemView()
+
+	case rl.IsKeyPressed(rl.KeyF7):
+		w.openMemView()
+
+	case rl.IsKeyPressed(rl.KeyF8):
+		w.cycleOverlay()
+		w.ShowMessage("Overlay: %s", w.overlay)
+		log.Printf("[INFO] overlay: %s", w.overlay)
+
+	case rl.IsKeyPressed(rl.KeyP):
+		if w.PauseDelegate != nil {
+			w.PauseDelegate()
+		}
+
+	case rl.IsKeyPressed(rl.KeyN):
+		if w.paused && w.FrameStepDelegate != nil {
+			w.FrameStepDelegate()
+		}
+
+	case rl.IsKeyPressed(rl.KeyM):
+		w.toggleMute()
+
+	case rl.IsKeyPressed(rl.KeyEqual), rl.IsKeyPressed(rl.KeyKpAdd):
+		w.ChangeVolume(VolumeStep)
+
+	case rl.IsKeyPressed(rl.KeyMinus), rl.IsKeyPressed(rl.KeyKpSubtract):
+		w.ChangeVolume(-VolumeStep)
+
 	case w.isModifierPressed() && rl.IsKeyPressed(rl.KeyQ):
 		w.shouldClose = true
 
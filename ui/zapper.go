@@ -1,27 +1,14 @@
+//go:build !sdl && !ebiten
+
 package ui
 
 import (
-	"image/color"
-
 	"github.com/gen2brain/raylib-go/raylib"
-
-	"github.com/maxpoletaev/dendy/ppu"
 )
 
 func (w *Window) getFrameMousePosition() (int, int, bool) {
 	pos := rl.GetMousePosition()
-
-	x := int(pos.X) / w.scale
-	if x < 0 || x >= ppu.FrameWidth {
-		return 0, 0, false
-	}
-
-	y := int(pos.Y) / w.scale
-	if y < 0 || y >= ppu.FrameHeight {
-		return 0, 0, false
-	}
-
-	return x, y, true
+	return w.screenViewport().frameCoords(pos.X, pos.Y)
 }
 
 func (w *Window) isTriggerPressed() bool {
@@ -29,7 +16,7 @@ func (w *Window) isTriggerPressed() bool {
 		rl.IsMouseButtonPressed(rl.MouseLeftButton)
 }
 
-func (w *Window) UpdateZapper(ppuFrame []color.RGBA) {
+func (w *Window) UpdateZapper() {
 	if w.ZapperDelegate == nil {
 		return
 	}
@@ -40,13 +27,9 @@ func (w *Window) UpdateZapper(ppuFrame []color.RGBA) {
 	)
 
 	if x, y, ok = w.getFrameMousePosition(); !ok {
-		w.ZapperDelegate(0, w.isTriggerPressed())
+		w.ZapperDelegate(-1, -1, w.isTriggerPressed())
 		return
 	}
 
-	rgb := ppuFrame[y*ppu.FrameWidth+x]
-
-	brightness := (rgb.R + rgb.G + rgb.B) / 3
-
-	w.ZapperDelegate(brightness, w.isTriggerPressed())
+	w.ZapperDelegate(x, y, w.isTriggerPressed())
 }